@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Default seconds within which same type activity is collapsed.
+const compactActivityDefaultWindow = 60
+
+// Activity types collapsed by default. Only types whose latest entry
+// sums up the ones before it (eg. the new rating) are safe to compact.
+var compactActivityDefaultTypes = []ActivityType{RATING_CHANGED, STATUS_CHANGED, THOUGHTS_CHANGED}
+
+// Max activity rows removed per delete query.
+const compactActivityDeleteBatch = 500
+
+func getCompactActivityWindow() time.Duration {
+	if Config.TASK_COMPACT_ACTIVITY_WINDOW > 0 {
+		return time.Duration(Config.TASK_COMPACT_ACTIVITY_WINDOW) * time.Second
+	}
+	return compactActivityDefaultWindow * time.Second
+}
+
+func getCompactActivityTypes() []ActivityType {
+	if len(Config.TASK_COMPACT_ACTIVITY_TYPES) > 0 {
+		return Config.TASK_COMPACT_ACTIVITY_TYPES
+	}
+	return compactActivityDefaultTypes
+}
+
+// Collapse bursts of same type activity on a watched entry (eg. rating
+// changed 7, 8, then 7 within seconds) into the last entry of the burst.
+// An entry is part of a burst if it was made within the window of the
+// entry before it. Entries with a custom date were set by the user and
+// are never touched, nor are entries newer than the window (their
+// burst may not be over yet).
+func compactActivity(db *gorm.DB) error {
+	window := getCompactActivityWindow()
+	rows, err := db.Model(&Activity{}).
+		Where("type IN ? AND custom_date IS NULL AND created_at < ?", getCompactActivityTypes(), taskClock.Now().Add(-window)).
+		Order("watched_id, type, created_at").
+		Select("id", "watched_id", "type", "created_at").
+		Rows()
+	if err != nil {
+		slog.Error("compactActivity: Failed to get activity", "error", err)
+		return errors.New("failed to get activity")
+	}
+	var (
+		scanned  int
+		bursts   int
+		collapse []uint
+		prev     Activity
+		inBurst  bool
+	)
+	for rows.Next() {
+		var a Activity
+		if err := rows.Scan(&a.ID, &a.WatchedID, &a.Type, &a.CreatedAt); err != nil {
+			rows.Close()
+			slog.Error("compactActivity: Failed to scan activity", "error", err)
+			return errors.New("failed to scan activity")
+		}
+		scanned++
+		if prev.ID != 0 && a.WatchedID == prev.WatchedID && a.Type == prev.Type && a.CreatedAt.Sub(prev.CreatedAt) <= window {
+			// Only the last entry of a burst is kept.
+			collapse = append(collapse, prev.ID)
+			if !inBurst {
+				bursts++
+				inBurst = true
+			}
+		} else {
+			inBurst = false
+		}
+		prev = a
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		slog.Error("compactActivity: Failed reading activity", "error", err)
+		return errors.New("failed reading activity")
+	}
+	collapsed := 0
+	for i := 0; i < len(collapse); i += compactActivityDeleteBatch {
+		ids := collapse[i:min(i+compactActivityDeleteBatch, len(collapse))]
+		res := db.Delete(&Activity{}, ids)
+		if res.Error != nil {
+			slog.Error("compactActivity: Failed to remove collapsed activity", "error", res.Error)
+			setTaskSummary("compact_activity", map[string]any{"scanned": scanned, "bursts": bursts, "collapsed": collapsed})
+			return errors.New("failed to remove collapsed activity")
+		}
+		collapsed += int(res.RowsAffected)
+	}
+	setTaskSummary("compact_activity", map[string]any{"scanned": scanned, "bursts": bursts, "collapsed": collapsed})
+	return nil
+}
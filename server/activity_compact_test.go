@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Add activity of type `at` to `w`, made at `created`.
+func addTestActivity(t *testing.T, db *gorm.DB, w Watched, at ActivityType, data string, created time.Time) Activity {
+	t.Helper()
+	a := Activity{UserID: w.UserID, WatchedID: w.ID, Type: at, Data: data}
+	a.CreatedAt = created
+	if err := db.Create(&a).Error; err != nil {
+		t.Fatalf("failed to create activity: %v", err)
+	}
+	return a
+}
+
+// Ids of activity left on `w`, oldest first.
+func getTestActivityIDs(t *testing.T, db *gorm.DB, w Watched) []uint {
+	t.Helper()
+	var ids []uint
+	if err := db.Model(&Activity{}).Where("watched_id = ?", w.ID).Order("created_at, id").Pluck("id", &ids).Error; err != nil {
+		t.Fatalf("failed to get activity: %v", err)
+	}
+	return ids
+}
+
+func TestCompactActivityBursts(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	user := User{Username: "compact"}
+	db.Create(&user)
+	c := Content{TmdbID: 701, Title: "Compact Movie", Type: MOVIE}
+	db.Create(&c)
+	other := Content{TmdbID: 702, Title: "Other Movie", Type: MOVIE}
+	db.Create(&other)
+	w := Watched{UserID: user.ID, ContentID: &c.ID, Status: FINISHED}
+	db.Create(&w)
+	w2 := Watched{UserID: user.ID, ContentID: &other.ID, Status: FINISHED}
+	db.Create(&w2)
+
+	base := time.Now().Add(-time.Hour)
+	// Rated 7, 8, then 7 within seconds, only the last is kept.
+	r1 := addTestActivity(t, db, w, RATING_CHANGED, "7", base)
+	r2 := addTestActivity(t, db, w, RATING_CHANGED, "8", base.Add(10*time.Second))
+	r3 := addTestActivity(t, db, w, RATING_CHANGED, "7", base.Add(20*time.Second))
+	// Rated again long after.
+	r4 := addTestActivity(t, db, w, RATING_CHANGED, "9", base.Add(5*time.Minute))
+	status := addTestActivity(t, db, w, STATUS_CHANGED, "FINISHED", base.Add(5*time.Second))
+	// Not a compacted type by default.
+	added1 := addTestActivity(t, db, w, ADDED_WATCHED, "", base.Add(time.Second))
+	added2 := addTestActivity(t, db, w, ADDED_WATCHED, "", base.Add(2*time.Second))
+	// Dated by the user.
+	custom := addTestActivity(t, db, w, RATING_CHANGED, "6", base.Add(15*time.Second))
+	db.Model(&custom).Update("custom_date", base)
+	// Burst may still be going.
+	recent1 := addTestActivity(t, db, w, RATING_CHANGED, "5", time.Now().Add(-10*time.Second))
+	recent2 := addTestActivity(t, db, w, RATING_CHANGED, "4", time.Now().Add(-5*time.Second))
+	// Same time as the burst, but on another watched entry.
+	otherRating := addTestActivity(t, db, w2, RATING_CHANGED, "8", base.Add(15*time.Second))
+
+	if err := compactActivity(db); err != nil {
+		t.Fatalf("compact failed: %v", err)
+	}
+	want := []uint{added1.ID, added2.ID, status.ID, custom.ID, r3.ID, r4.ID, recent1.ID, recent2.ID}
+	slices.Sort(want)
+	got := getTestActivityIDs(t, db, w)
+	slices.Sort(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got activity %v, want %v (%d and %d collapsed into %d)", got, want, r1.ID, r2.ID, r3.ID)
+	}
+	if got := getTestActivityIDs(t, db, w2); len(got) != 1 || got[0] != otherRating.ID {
+		t.Errorf("activity of another entry changed to %v", got)
+	}
+	if s := getTaskStatus("compact_activity").Summary; s["bursts"] != 1 || s["collapsed"] != 2 {
+		t.Errorf("got summary %v, want 1 burst with 2 collapsed", s)
+	}
+
+	Config.TASK_COMPACT_ACTIVITY_TYPES = []ActivityType{ADDED_WATCHED}
+	Config.TASK_COMPACT_ACTIVITY_WINDOW = 2
+	if err := compactActivity(db); err != nil {
+		t.Fatalf("compact with configured types failed: %v", err)
+	}
+	if got := getTestActivityIDs(t, db, w); slices.Contains(got, added1.ID) || !slices.Contains(got, added2.ID) || !slices.Contains(got, r4.ID) {
+		t.Errorf("got activity %v, want only the configured type collapsed", got)
+	}
+}
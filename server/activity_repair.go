@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"gorm.io/gorm"
+)
+
+// Activity found by a repair rule.
+type ActivityRepair struct {
+	ID        uint
+	UserID    uint
+	WatchedID uint
+	Type      ActivityType
+}
+
+// Repair rules for activity, each finds activity that would show broken
+// (or someone elses) watched entries. Found activity is soft deleted,
+// never removed, so a rule that turns out wrong can be undone by
+// clearing `deleted_at`. Activity of soft deleted watched entries is
+// fine, it is kept so it comes back if the entry is restored.
+var activityRepairRules = []struct {
+	name string
+	// Condition on the activities table matching activity to repair.
+	where  string
+	reason string
+}{
+	{
+		// Left behind by entries removed outside of the api. Sqlite can
+		// reuse their ids, which would attach this to a new entry.
+		name: "missingWatched",
+		where: `NOT EXISTS (
+	SELECT 1 FROM watcheds w WHERE w.id = activities.watched_id
+)`,
+		reason: "watched entry doesn't exist",
+	},
+	{
+		name: "wrongUser",
+		where: `EXISTS (
+	SELECT 1 FROM watcheds w WHERE w.id = activities.watched_id AND w.user_id != activities.user_id
+)`,
+		reason: "watched entry belongs to another user",
+	},
+}
+
+// Find and repair activity whose watched entry doesn't exist or belongs
+// to another user, per `activityRepairRules`. Each repair is logged.
+// Watched entries whose content (or game) doesn't exist are only
+// reported, they are the users own data and can't be repaired.
+func repairActivity(db *gorm.DB) error {
+	summary := map[string]any{}
+	var errs []error
+	for _, rule := range activityRepairRules {
+		var found []ActivityRepair
+		if res := db.Model(&Activity{}).Where(rule.where).Find(&found); res.Error != nil {
+			slog.Error("repairActivity: Failed to find activity to repair", "rule", rule.name, "error", res.Error)
+			errs = append(errs, fmt.Errorf("%s: failed to find activity to repair", rule.name))
+			continue
+		}
+		repaired := 0
+		for _, a := range found {
+			if res := db.Where("id = ?", a.ID).Delete(&Activity{}); res.Error != nil {
+				slog.Error("repairActivity: Failed to remove activity", "rule", rule.name, "activity_id", a.ID, "error", res.Error)
+				errs = append(errs, res.Error)
+				continue
+			}
+			slog.Info("repairActivity: Soft deleted activity.", "rule", rule.name, "reason", rule.reason, "activity_id", a.ID, "user_id", a.UserID, "watched_id", a.WatchedID, "type", a.Type)
+			repaired++
+		}
+		summary[rule.name] = repaired
+	}
+	var missingContent int64
+	res := db.Model(&Watched{}).
+		Where("(content_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM contents c WHERE c.id = watcheds.content_id)) OR (game_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM games g WHERE g.id = watcheds.game_id))").
+		Count(&missingContent)
+	if res.Error != nil {
+		slog.Error("repairActivity: Failed to count watched entries missing content", "error", res.Error)
+		errs = append(errs, errors.New("failed to count watched entries missing content"))
+	} else if missingContent > 0 {
+		slog.Warn("repairActivity: Found watched entries whose content doesn't exist, they can't be repaired.", "amount", missingContent)
+	}
+	summary["watchedMissingContent"] = missingContent
+	setTaskSummary("repair_activity", summary)
+	if len(errs) > 0 {
+		return fmt.Errorf("failed %d repairs: %w", len(errs), errors.Join(errs...))
+	}
+	return nil
+}
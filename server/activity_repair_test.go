@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRepairActivityDanglingReferences(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	alice := User{Username: "alice"}
+	db.Create(&alice)
+	bob := User{Username: "bob"}
+	db.Create(&bob)
+	missing, tmdbId := 999, 800
+	addWatched := func(u User, contentId *int) Watched {
+		if contentId == nil {
+			tmdbId++
+			c := Content{TmdbID: tmdbId, Title: "Repair Movie", Type: MOVIE}
+			if err := db.Create(&c).Error; err != nil {
+				t.Fatalf("failed to create content: %v", err)
+			}
+			contentId = &c.ID
+		}
+		w := Watched{UserID: u.ID, ContentID: contentId, Status: FINISHED}
+		if err := db.Create(&w).Error; err != nil {
+			t.Fatalf("failed to create watched: %v", err)
+		}
+		return w
+	}
+	now := time.Now()
+	ok := addWatched(alice, nil)
+	kept := []uint{addTestActivity(t, db, ok, ADDED_WATCHED, "", now).ID}
+	// Removed outside of the api, its activity left behind.
+	gone := addWatched(alice, nil)
+	repaired := []uint{
+		addTestActivity(t, db, gone, ADDED_WATCHED, "", now).ID,
+		addTestActivity(t, db, gone, RATING_CHANGED, "7", now).ID,
+	}
+	db.Unscoped().Delete(&gone)
+	// Removed by the user, its activity comes back if it is restored.
+	removed := addWatched(alice, nil)
+	kept = append(kept, addTestActivity(t, db, removed, ADDED_WATCHED, "", now).ID)
+	db.Delete(&removed)
+	// Activity of bobs entry on alices feed.
+	bobs := addWatched(bob, nil)
+	kept = append(kept, addTestActivity(t, db, bobs, ADDED_WATCHED, "", now).ID)
+	wrong := addTestActivity(t, db, bobs, REMOVED_WATCHED, "", now)
+	wrong.UserID = alice.ID
+	db.Save(&wrong)
+	repaired = append(repaired, wrong.ID)
+	// Only reported.
+	addWatched(bob, &missing)
+
+	if err := repairActivity(db); err != nil {
+		t.Fatalf("repair failed: %v", err)
+	}
+	want := map[string]any{"missingWatched": 2, "wrongUser": 1, "watchedMissingContent": int64(1)}
+	if s := getTaskStatus("repair_activity").Summary; !reflect.DeepEqual(s, want) {
+		t.Errorf("got summary %v, want %v", s, want)
+	}
+	var left, deleted []uint
+	db.Model(&Activity{}).Order("id").Pluck("id", &left)
+	db.Unscoped().Model(&Activity{}).Where("deleted_at IS NOT NULL").Order("id").Pluck("id", &deleted)
+	slices.Sort(kept)
+	if !slices.Equal(left, kept) {
+		t.Errorf("activity %v left, want %v", left, kept)
+	}
+	// Soft deleted, so it can be undone.
+	if !slices.Equal(deleted, repaired) {
+		t.Errorf("activity %v soft deleted, want %v", deleted, repaired)
+	}
+
+	if err := repairActivity(db); err != nil {
+		t.Fatalf("second repair failed: %v", err)
+	}
+	if s := getTaskStatus("repair_activity").Summary; s["missingWatched"] != 0 || s["wrongUser"] != 0 {
+		t.Errorf("second repair got summary %v, want nothing left to repair", s)
+	}
+}
@@ -105,6 +105,8 @@ func addSonarr(s SonarrSettings) error {
 	}
 	Config.SONARR = append(Config.SONARR, s)
 	writeConfig()
+	// Arr tasks are kept back until there is a server.
+	syncFeatureTasks()
 	return nil
 }
 
@@ -125,6 +127,7 @@ func rmSonarr(name string) error {
 		if v.Name == name {
 			Config.SONARR = append(Config.SONARR[:i], Config.SONARR[i+1:]...)
 			writeConfig()
+			pruneRemovedArrServers()
 			return nil
 		}
 	}
@@ -160,6 +163,8 @@ func addRadarr(s RadarrSettings) error {
 	}
 	Config.RADARR = append(Config.RADARR, s)
 	writeConfig()
+	// Arr tasks are kept back until there is a server.
+	syncFeatureTasks()
 	return nil
 }
 
@@ -180,6 +185,7 @@ func rmRadarr(name string) error {
 		if v.Name == name {
 			Config.RADARR = append(Config.RADARR[:i], Config.RADARR[i+1:]...)
 			writeConfig()
+			pruneRemovedArrServers()
 			return nil
 		}
 	}
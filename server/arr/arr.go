@@ -13,6 +13,24 @@ import (
 	"strconv"
 )
 
+// Returned when a request to a service fails.
+// Its message is kept generic, the cause can be found with errors.As/Is.
+type RequestError struct {
+	Err error
+}
+
+func (e *RequestError) Error() string { return "request to service failed" }
+func (e *RequestError) Unwrap() error { return e.Err }
+
+// Returned when a service responds with an unexpected status code.
+type StatusError struct {
+	StatusCode int
+	// Response body, services usually explain what went wrong in it.
+	Body string
+}
+
+func (e *StatusError) Error() string { return e.Body }
+
 type ArrType string
 
 var (
@@ -72,7 +90,7 @@ func (a *Arr) GetQualityProfiles() ([]QualityProfile, error) {
 	_, err := request(*a.Host, "/qualityprofile", map[string]string{"apikey": *a.Key}, &resp)
 	if err != nil {
 		slog.Error("GetQualityProfiles request failed", "service", a.Type, "error", err)
-		return []QualityProfile{}, errors.New("request to service failed")
+		return []QualityProfile{}, &RequestError{Err: err}
 	}
 	return resp, nil
 }
@@ -83,7 +101,7 @@ func (a *Arr) GetRootFolders() ([]RootFolder, error) {
 	_, err := request(*a.Host, "/rootfolder", map[string]string{"apikey": *a.Key}, &resp)
 	if err != nil {
 		slog.Error("GetRootFolders request failed", "service", a.Type, "error", err)
-		return []RootFolder{}, errors.New("request to service failed")
+		return []RootFolder{}, &RequestError{Err: err}
 	}
 	return resp, nil
 }
@@ -96,7 +114,7 @@ func (a *Arr) GetLangaugeProfiles() ([]LanguageProfile, error) {
 	_, err := request(*a.Host, "/languageprofile", map[string]string{"apikey": *a.Key}, &resp)
 	if err != nil {
 		slog.Error("GetLangaugeProfiles request failed", "service", a.Type, "error", err)
-		return []LanguageProfile{}, errors.New("request to service failed")
+		return []LanguageProfile{}, &RequestError{Err: err}
 	}
 	return resp, nil
 }
@@ -107,7 +125,7 @@ func (a *Arr) RunCommand(name string) (CommandResponse, error) {
 	err := requestPost(*a.Host, "/command", *a.Key, map[string]interface{}{"name": name}, &resp)
 	if err != nil {
 		slog.Error("RunCommand request failed", "name", name, "service", a.Type, "error", err)
-		return CommandResponse{}, errors.New("request to service failed")
+		return CommandResponse{}, &RequestError{Err: err}
 	}
 	return resp, nil
 }
@@ -126,11 +144,27 @@ func (a *Arr) GetQueueDetails(arrId string, resp interface{}) error {
 	_, err := request(*a.Host, "/queue/details", p, resp)
 	if err != nil {
 		slog.Error("GetQueueDetails request failed", "arrId", arrId, "service", a.Type, "error", err)
-		return errors.New("request to service failed")
+		return &RequestError{Err: err}
 	}
 	return nil
 }
 
+// Get a page of the whole download queue.
+func (a *Arr) GetQueue(page int, pageSize int) (QueuePage, error) {
+	slog.Debug("GetQueue", "page", page, "pageSize", pageSize, "type", a.Type, "host", *a.Host, "key", *a.Key)
+	var resp QueuePage
+	_, err := request(*a.Host, "/queue", map[string]string{
+		"apikey":   *a.Key,
+		"page":     strconv.Itoa(page),
+		"pageSize": strconv.Itoa(pageSize),
+	}, &resp)
+	if err != nil {
+		slog.Error("GetQueue request failed", "service", a.Type, "error", err)
+		return QueuePage{}, &RequestError{Err: err}
+	}
+	return resp, nil
+}
+
 // Get movie/show
 func (a *Arr) GetContent(arrId int) (MovieSerie, int, error) {
 	slog.Debug("GetContent", "arrId", arrId, "type", a.Type, "host", *a.Host, "key", *a.Key)
@@ -143,11 +177,26 @@ func (a *Arr) GetContent(arrId int) (MovieSerie, int, error) {
 	respStatusCode, err := request(*a.Host, "/"+e+"/"+arrIdStr, map[string]string{"apikey": *a.Key}, &resp)
 	if err != nil {
 		slog.Error("GetContent request failed", "arrId", arrId, "service", a.Type, "error", err)
-		return MovieSerie{}, respStatusCode, errors.New("request to service failed")
+		return MovieSerie{}, respStatusCode, &RequestError{Err: err}
 	}
 	return resp, respStatusCode, nil
 }
 
+// Get all movies/shows on the server.
+func (a *Arr) GetLibrary() ([]LibraryItem, error) {
+	e := "movie"
+	if a.Type == SONARR {
+		e = "series"
+	}
+	var resp []LibraryItem
+	_, err := request(*a.Host, "/"+e, map[string]string{"apikey": *a.Key}, &resp)
+	if err != nil {
+		slog.Error("GetLibrary request failed", "service", a.Type, "error", err)
+		return []LibraryItem{}, &RequestError{Err: err}
+	}
+	return resp, nil
+}
+
 func (a *Arr) LookupByTmdbId(tmdbId int) ([]MovieSerie, error) {
 	slog.Debug("LookupByTmdbId", "tmdbId", tmdbId, "type", a.Type, "host", *a.Host, "key", *a.Key)
 	e := "movie"
@@ -159,7 +208,7 @@ func (a *Arr) LookupByTmdbId(tmdbId int) ([]MovieSerie, error) {
 	_, err := request(*a.Host, "/"+e+"/lookup", map[string]string{"apikey": *a.Key, "term": "tmdb:" + tmdbIdStr}, &resp)
 	if err != nil {
 		slog.Error("LookupByTmdbId request failed", "tmdbId", tmdbId, "service", a.Type, "error", err)
-		return []MovieSerie{}, errors.New("request to service failed")
+		return []MovieSerie{}, &RequestError{Err: err}
 	}
 	return resp, nil
 }
@@ -209,12 +258,47 @@ func (a *Arr) AddContent(b map[string]interface{}) (map[string]interface{}, erro
 	err := requestPost(*a.Host, "/"+ep, *a.Key, b, &resp)
 	if err != nil {
 		slog.Error("AddContent request failed", "service", a.Type, "error", err)
-		return map[string]interface{}{}, errors.New("request to service failed")
+		return map[string]interface{}{}, &RequestError{Err: err}
 	}
 	slog.Debug("AddContent", "type", ep, "created_id", resp["id"])
 	return resp, nil
 }
 
+// Stop monitoring a movie/show, so nothing more is downloaded for it.
+// Files that have already been downloaded are left alone.
+func (a *Arr) Unmonitor(arrId int) error {
+	ep, idsKey := "/movie/editor", "movieIds"
+	if a.Type == SONARR {
+		ep, idsKey = "/series/editor", "seriesIds"
+	}
+	b := map[string]interface{}{
+		idsKey:      []int{arrId},
+		"monitored": false,
+	}
+	err := requestWithBody(http.MethodPut, *a.Host, ep, *a.Key, map[string]string{}, b)
+	if err != nil {
+		slog.Error("Unmonitor request failed", "arrId", arrId, "service", a.Type, "error", err)
+		return &RequestError{Err: err}
+	}
+	return nil
+}
+
+// Remove a movie/show from the server.
+// Its files are never deleted, only the servers record of it.
+func (a *Arr) DeleteContent(arrId int) error {
+	ep, exclusionKey := "/movie/", "addImportExclusion"
+	if a.Type == SONARR {
+		ep, exclusionKey = "/series/", "addImportListExclusion"
+	}
+	p := map[string]string{"deleteFiles": "false", exclusionKey: "false"}
+	err := requestWithBody(http.MethodDelete, *a.Host, ep+strconv.Itoa(arrId), *a.Key, p, nil)
+	if err != nil {
+		slog.Error("DeleteContent request failed", "arrId", arrId, "service", a.Type, "error", err)
+		return &RequestError{Err: err}
+	}
+	return nil
+}
+
 func request(host string, ep string, p map[string]string, resp interface{}) (int, error) {
 	slog.Debug("arrAPIRequest", "endpoint", ep, "params", p)
 	base, err := url.Parse(host)
@@ -249,7 +333,7 @@ func request(host string, ep string, p map[string]string, resp interface{}) (int
 	}
 	if res.StatusCode != 200 {
 		slog.Error("arr non 200 status code:", "status_code", res.StatusCode)
-		return res.StatusCode, errors.New(string(body))
+		return res.StatusCode, &StatusError{StatusCode: res.StatusCode, Body: string(body)}
 	}
 	// slog.Info("", "body", body)
 	err = json.Unmarshal([]byte(body), &resp)
@@ -293,7 +377,7 @@ func requestPost(host string, ep string, key string, p map[string]interface{}, r
 	}
 	if !(res.StatusCode >= 200 && res.StatusCode <= 299) {
 		slog.Error("arr non 2xx status code:", "status_code", res.StatusCode)
-		return errors.New(string(body))
+		return &StatusError{StatusCode: res.StatusCode, Body: string(body)}
 	}
 	err = json.Unmarshal([]byte(body), &resp)
 	if err != nil {
@@ -301,3 +385,55 @@ func requestPost(host string, ep string, key string, p map[string]interface{}, r
 	}
 	return nil
 }
+
+// Send a request with `method` and json body `b` (if not nil),
+// for requests whose response we don't need.
+func requestWithBody(method string, host string, ep string, key string, p map[string]string, b map[string]interface{}) error {
+	base, err := url.Parse(host)
+	if err != nil {
+		return errors.New("failed to parse api uri")
+	}
+
+	// Path params
+	base.Path += "/api/v3" + ep
+
+	// Query params
+	params := url.Values{}
+	params.Add("apikey", key)
+	for k, v := range p {
+		params.Add(k, v)
+	}
+
+	// Add params to url
+	base.RawQuery = params.Encode()
+
+	var body io.Reader
+	if b != nil {
+		jsonb, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(jsonb)
+	}
+	req, err := http.NewRequest(method, base.String(), body)
+	if err != nil {
+		return err
+	}
+	if b != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resBody, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return err
+	}
+	if !(res.StatusCode >= 200 && res.StatusCode <= 299) {
+		slog.Error("arr non 2xx status code:", "status_code", res.StatusCode)
+		return &StatusError{StatusCode: res.StatusCode, Body: string(resBody)}
+	}
+	return nil
+}
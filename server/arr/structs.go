@@ -141,3 +141,31 @@ type MovieSerie struct {
 	IsAvailable   bool      `json:"isAvailable"`
 	Added         time.Time `json:"added"`
 }
+
+// From `GET /movie` or `GET /series`.
+// Not all fields described here, just the wanted ones.
+type LibraryItem struct {
+	ID     int    `json:"id"`
+	Title  string `json:"title"`
+	TmdbID int    `json:"tmdbId"`
+	ImdbID string `json:"imdbId"`
+	// Radarr only.
+	HasFile bool `json:"hasFile"`
+	// Sonarr only.
+	Statistics struct {
+		EpisodeFileCount int `json:"episodeFileCount"`
+	} `json:"statistics"`
+}
+
+// If the movie/show has anything downloaded that can be watched.
+func (l LibraryItem) Downloaded() bool {
+	return l.HasFile || l.Statistics.EpisodeFileCount > 0
+}
+
+// From `GET /queue`.
+type QueuePage struct {
+	Page         int           `json:"page"`
+	PageSize     int           `json:"pageSize"`
+	TotalRecords int           `json:"totalRecords"`
+	Records      []QueueDetail `json:"records"`
+}
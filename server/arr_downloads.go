@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/sbondCo/Watcharr/arr"
+	"gorm.io/gorm"
+)
+
+const taskIdCheckArrDownloads = "check_arr_downloads"
+
+// Check if content requested through Watcharr has finished downloading
+// on its sonarr/radarr server and mark the request as available.
+// Requests are matched by arr id, falling back to tmdb/imdb id if the
+// content was re-added on the server. Content on the server that wasn't
+// requested through Watcharr is ignored.
+func checkArrDownloads(db *gorm.DB) error {
+	var errs []error
+	available, untracked := 0, 0
+	check := func(t arr.ArrType, name string, host string, key string) {
+		target := string(t) + " " + name
+		if !breakerAllow(taskIdCheckArrDownloads, target) {
+			slog.Debug("checkArrDownloads: Skipping server, circuit breaker is open.", "server", target)
+			return
+		}
+		a, u, err := checkArrServerDownloads(db, arr.New(t, &host, &key), name)
+		available += a
+		untracked += u
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", target, err))
+		}
+	}
+	for _, v := range Config.RADARR {
+		check(arr.RADARR, v.Name, v.Host, v.Key)
+	}
+	for _, v := range Config.SONARR {
+		check(arr.SONARR, v.Name, v.Host, v.Key)
+	}
+	setTaskSummary(taskIdCheckArrDownloads, map[string]any{"available": available, "untracked": untracked, "failedServers": len(errs)})
+	return errors.Join(errs...)
+}
+
+// Returns how many requests became available, and how much content on
+// the server has no request at all (untracked).
+func checkArrServerDownloads(db *gorm.DB, a *arr.Arr, name string) (int, int, error) {
+	contentType := MOVIE
+	if a.Type == arr.SONARR {
+		contentType = SHOW
+	}
+	// Every request on the server is needed to tell which of its content
+	// is untracked, only those not downloaded yet are checked.
+	var all []ArrRequest
+	res := db.Joins("Content").
+		Where("server_name = ? AND Content.type = ?", name, contentType).
+		Find(&all)
+	if res.Error != nil {
+		slog.Error("checkArrServerDownloads: Failed to get requests from db", "server", name, "error", res.Error)
+		return 0, 0, errors.New("failed to get requests")
+	}
+	var reqs []ArrRequest
+	for _, r := range all {
+		if r.Status == ARR_REQUEST_APPROVED || r.Status == ARR_REQUEST_AUTO_APPROVED || r.Status == ARR_REQUEST_FOUND {
+			reqs = append(reqs, r)
+		}
+	}
+	if len(reqs) == 0 {
+		slog.Debug("checkArrServerDownloads: No requests waiting on server.", "server", name)
+		return 0, 0, nil
+	}
+	target := string(a.Type) + " " + name
+	lib, err := a.GetLibrary()
+	breakerRecord(taskIdCheckArrDownloads, target, err)
+	if err != nil {
+		return 0, 0, err
+	}
+	byId := map[int]int{}
+	byTmdb := map[int]int{}
+	byImdb := map[string]int{}
+	for i, v := range lib {
+		byId[v.ID] = i
+		if v.TmdbID != 0 {
+			byTmdb[v.TmdbID] = i
+		}
+		if v.ImdbID != "" {
+			byImdb[v.ImdbID] = i
+		}
+	}
+	find := func(r ArrRequest) (int, bool) {
+		i, ok := byId[r.ArrID]
+		if !ok && r.Content != nil {
+			if i, ok = byTmdb[r.Content.TmdbID]; !ok && r.Content.ImdbID != "" {
+				i, ok = byImdb[r.Content.ImdbID]
+			}
+		}
+		return i, ok
+	}
+	tracked := map[int]bool{}
+	for _, r := range all {
+		if i, ok := find(r); ok {
+			tracked[i] = true
+		}
+	}
+	available := 0
+	var errs []error
+	for _, r := range reqs {
+		i, ok := find(r)
+		if !ok {
+			slog.Debug("checkArrServerDownloads: Requested content not found on server.", "server", name, "request_id", r.ID, "arr_id", r.ArrID)
+			continue
+		}
+		item := lib[i]
+		if !item.Downloaded() {
+			continue
+		}
+		// Requests FOUND before found was tracked are marked here, so
+		// where the content came from isn't lost with the status.
+		res := db.Model(&ArrRequest{}).Where("id = ?", r.ID).Updates(map[string]interface{}{"arr_id": item.ID, "status": ARR_REQUEST_AVAILABLE, "found": r.Found || r.Status == ARR_REQUEST_FOUND})
+		if res.Error != nil {
+			slog.Error("checkArrServerDownloads: Failed to update request status", "request_id", r.ID, "error", res.Error)
+			errs = append(errs, res.Error)
+			continue
+		}
+		available++
+		if Config.TASK_ARR_NOTIFY_AVAILABLE {
+			notifyArrRequestAvailable(db, r, item.Title)
+		}
+	}
+	slog.Info("checkArrServerDownloads: Finished.", "server", name, "requests", len(reqs), "available", available, "untracked", len(lib)-len(tracked))
+	return available, len(lib) - len(tracked), errors.Join(errs...)
+}
+
+// Let the user who made a request know it can be watched now.
+// Failing to notify doesn't fail the check.
+func notifyArrRequestAvailable(db *gorm.DB, r ArrRequest, arrTitle string) {
+	title := arrTitle
+	n := Notification{
+		UserID: r.UserID,
+		Type:   NOTIFICATION_ARR_AVAILABLE,
+	}
+	if r.Content != nil {
+		title = r.Content.Title
+		var w Watched
+		if db.Where("user_id = ? AND content_id = ?", r.UserID, r.Content.ID).Select("id").Limit(1).Find(&w).Error == nil && w.ID != 0 {
+			n.WatchedID = &w.ID
+		}
+	}
+	n.Message = fmt.Sprintf("%s that you requested is now available to watch.", title)
+	if err := db.Create(&n).Error; err != nil {
+		slog.Error("notifyArrRequestAvailable: Failed to create notification", "request_id", r.ID, "error", err)
+	}
+}
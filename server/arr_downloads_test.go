@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/sbondCo/Watcharr/arr"
+	"gorm.io/gorm"
+)
+
+// Use a fake radarr named `name`, serving `lib` as its library.
+// Movies not in `lib` return a 404.
+func useTestRadarr(t *testing.T, name string, lib []arr.LibraryItem) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v3/movie" {
+			json.NewEncoder(w).Encode(lib)
+			return
+		}
+		for _, v := range lib {
+			if r.URL.Path == "/api/v3/movie/"+strconv.Itoa(v.ID) {
+				json.NewEncoder(w).Encode(v)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(srv.Close)
+	Config.RADARR = []RadarrSettings{{ArrSettings: ArrSettings{Name: name, Host: srv.URL, Key: "key"}}}
+}
+
+func addTestArrRequest(t *testing.T, db *gorm.DB, server string, tmdbId int, arrId int, status ArrRequestStatus) ArrRequest {
+	t.Helper()
+	c := Content{TmdbID: tmdbId, Title: "Movie " + strconv.Itoa(tmdbId), Type: MOVIE}
+	if err := db.Create(&c).Error; err != nil {
+		t.Fatalf("failed to create content: %v", err)
+	}
+	r := ArrRequest{UserID: 1, ServerName: server, ContentID: &c.ID, ArrID: arrId, Status: status}
+	if err := db.Create(&r).Error; err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	return r
+}
+
+func getTestArrRequestStatus(t *testing.T, db *gorm.DB, id uint) ArrRequestStatus {
+	t.Helper()
+	var r ArrRequest
+	if err := db.Where("id = ?", id).Take(&r).Error; err != nil {
+		t.Fatalf("failed to get request: %v", err)
+	}
+	return r.Status
+}
+
+func TestCheckArrDownloads(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	db.Create(&User{Username: "requester"})
+	useTestRadarr(t, "test_downloads", []arr.LibraryItem{
+		{ID: 1, TmdbID: 101, HasFile: true},
+		{ID: 2, TmdbID: 102},
+		// Re-added on the server, so has a new arr id.
+		{ID: 30, TmdbID: 103, HasFile: true},
+		// Downloaded before.
+		{ID: 4, TmdbID: 104, HasFile: true},
+		// Not requested through Watcharr.
+		{ID: 5, TmdbID: 105, HasFile: true},
+	})
+	done := addTestArrRequest(t, db, "test_downloads", 101, 1, ARR_REQUEST_APPROVED)
+	waiting := addTestArrRequest(t, db, "test_downloads", 102, 2, ARR_REQUEST_AUTO_APPROVED)
+	readded := addTestArrRequest(t, db, "test_downloads", 103, 3, ARR_REQUEST_FOUND)
+	already := addTestArrRequest(t, db, "test_downloads", 104, 4, ARR_REQUEST_AVAILABLE)
+
+	if err := checkArrDownloads(db); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	for r, want := range map[uint]ArrRequestStatus{
+		done.ID:    ARR_REQUEST_AVAILABLE,
+		waiting.ID: ARR_REQUEST_AUTO_APPROVED,
+		readded.ID: ARR_REQUEST_AVAILABLE,
+		already.ID: ARR_REQUEST_AVAILABLE,
+	} {
+		if got := getTestArrRequestStatus(t, db, r); got != want {
+			t.Errorf("request %d is %s, want %s", r, got, want)
+		}
+	}
+	var r ArrRequest
+	db.Where("id = ?", readded.ID).Take(&r)
+	if r.ArrID != 30 {
+		t.Errorf("re-added request has arr id %d, want 30", r.ArrID)
+	}
+	// The already available request is tracked, only the unrequested movie isn't.
+	s := getTaskStatus(taskIdCheckArrDownloads).Summary
+	if s["available"] != 2 || s["untracked"] != 1 {
+		t.Errorf("got summary %v, want 2 available and 1 untracked", s)
+	}
+	var n int64
+	db.Model(&Notification{}).Count(&n)
+	if n != 0 {
+		t.Errorf("sent %d notifications with TASK_ARR_NOTIFY_AVAILABLE off", n)
+	}
+}
+
+func TestArrRequestInfoRemovesAvailableRequestGoneFromServer(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	useTestRadarr(t, "test_info", []arr.LibraryItem{{ID: 1, TmdbID: 201, HasFile: true}})
+	kept := addTestArrRequest(t, db, "test_info", 201, 1, ARR_REQUEST_AVAILABLE)
+	gone := addTestArrRequest(t, db, "test_info", 202, 2, ARR_REQUEST_AVAILABLE)
+	if _, err := getRadarrRequestInfo(db, kept.ID); err != nil {
+		t.Errorf("failed to get info for a request still on the server: %v", err)
+	}
+	if _, err := getRadarrRequestInfo(db, gone.ID); err == nil || err.Error() != "request deleted" {
+		t.Errorf("got error %v, want the request deleted", err)
+	}
+	var n int64
+	db.Model(&ArrRequest{}).Where("id = ?", gone.ID).Count(&n)
+	if n != 0 {
+		t.Error("available request removed from the server wasn't deleted")
+	}
+}
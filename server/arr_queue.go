@@ -2,8 +2,11 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"log/slog"
 	"math"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/sbondCo/Watcharr/arr"
@@ -31,6 +34,49 @@ type SonarrDetailsResponse struct {
 	Items []SonarrDetailsResponseItem `json:"items"`
 }
 
+// A single item in an arr servers download queue.
+type ArrQueueItem struct {
+	Server   string      `json:"server"`
+	Type     arr.ArrType `json:"type"`
+	Title    string      `json:"title"`
+	Progress int         `json:"progress"`
+	Status   string      `json:"status"`
+	// Empty if unknown.
+	TimeLeft                string    `json:"timeLeft,omitempty"`
+	EstimatedCompletionTime time.Time `json:"estimatedCompletionTime"`
+	TrackedDownloadStatus   string    `json:"trackedDownloadStatus"`
+	TrackedDownloadState    string    `json:"trackedDownloadState"`
+}
+
+// Snapshot of an arr servers queue, taken by the
+// Refresh Arr Queues task.
+type ArrQueueSnapshot struct {
+	Server    string         `json:"server"`
+	Type      arr.ArrType    `json:"type"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	Total     int            `json:"total"`
+	Items     []ArrQueueItem `json:"items"`
+}
+
+type ArrQueueResponse struct {
+	// When the oldest included snapshot was taken.
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Total items in all queues (may be more than we have stored).
+	Total    int            `json:"total"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"pageSize"`
+	Items    []ArrQueueItem `json:"items"`
+}
+
+// Max items we will store from each servers queue.
+const arrQueueMaxItems = 250
+
+var (
+	// Latest queue snapshot for each server (key is `TYPE name`).
+	arrQueueSnapshots   = map[string]ArrQueueSnapshot{}
+	arrQueueSnapshotsMu sync.RWMutex
+)
+
 func getRadarrQueueDetails(serverName string, arrId string) (*ArrDetailsResponse, error) {
 	server, err := getRadarr(serverName)
 	if err != nil {
@@ -119,15 +165,156 @@ func getSonarrQueueDetails(serverName string, arrId string) (*SonarrDetailsRespo
 // Refresh download queues for our sonarr/radarr servers.
 // If the queues don't refresh regularly, our queue detail
 // calls will just always return the same info.
-func refreshArrQueues() {
+// A snapshot of each servers queue is also stored, see `getArrQueue`.
+func refreshArrQueues() error {
 	slog.Debug("refreshArrQueues: Refreshing queues for all configured arr servers.")
 	// We don't care about responses, errors will be logged by the RunCommand func.
+	// Errors are still collected so the task can be marked as failed.
+	// Servers that keep failing are skipped for a while by their circuit breaker.
+	var errs []error
+	refresh := func(t arr.ArrType, name string, host string, key string) {
+		target := string(t) + " " + name
+		if !breakerAllow(taskIdRefreshArrQueues, target) {
+			slog.Debug("refreshArrQueues: Skipping server, circuit breaker is open.", "server", target)
+			return
+		}
+		a := arr.New(t, &host, &key)
+		_, err := a.RunCommand("RefreshMonitoredDownloads")
+		if err == nil {
+			err = snapshotArrQueue(a, target, name)
+		}
+		breakerRecord(taskIdRefreshArrQueues, target, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", target, err))
+		}
+	}
+	for _, v := range Config.RADARR {
+		refresh(arr.RADARR, v.Name, v.Host, v.Key)
+	}
+	for _, v := range Config.SONARR {
+		refresh(arr.SONARR, v.Name, v.Host, v.Key)
+	}
+	pruneRemovedArrServers()
+	return errors.Join(errs...)
+}
+
+// Take a snapshot of an arr servers queue, so we can show
+// what is downloading without hitting the server every time.
+func snapshotArrQueue(a *arr.Arr, target string, name string) error {
+	q, err := a.GetQueue(1, arrQueueMaxItems)
+	if err != nil {
+		return err
+	}
+	snap := ArrQueueSnapshot{
+		Server:    name,
+		Type:      a.Type,
+		UpdatedAt: time.Now(),
+		Total:     q.TotalRecords,
+		Items:     make([]ArrQueueItem, 0, len(q.Records)),
+	}
+	for i, v := range q.Records {
+		if i >= arrQueueMaxItems {
+			break
+		}
+		progress := 0
+		if v.Size > 0 {
+			progress = int(math.Round((1 - (v.SizeLeft / v.Size)) * 100))
+		}
+		snap.Items = append(snap.Items, ArrQueueItem{
+			Server:                  name,
+			Type:                    a.Type,
+			Title:                   v.Title,
+			Progress:                progress,
+			Status:                  v.Status,
+			TimeLeft:                v.TimeLeft,
+			EstimatedCompletionTime: v.EstimatedCompletionTime,
+			TrackedDownloadStatus:   v.TrackedDownloadStatus,
+			TrackedDownloadState:    v.TrackedDownloadState,
+		})
+	}
+	if snap.Total < len(snap.Items) {
+		snap.Total = len(snap.Items)
+	}
+	arrQueueSnapshotsMu.Lock()
+	arrQueueSnapshots[target] = snap
+	arrQueueSnapshotsMu.Unlock()
+	return nil
+}
+
+// Targets (`type name`, eg. `sonarr Main`) of all configured arr servers.
+func getConfiguredArrTargets() map[string]bool {
+	configured := map[string]bool{}
 	for _, v := range Config.RADARR {
-		radarr := arr.New(arr.RADARR, &v.Host, &v.Key)
-		radarr.RunCommand("RefreshMonitoredDownloads")
+		configured[string(arr.RADARR)+" "+v.Name] = true
 	}
 	for _, v := range Config.SONARR {
-		sonarr := arr.New(arr.SONARR, &v.Host, &v.Key)
-		sonarr.RunCommand("RefreshMonitoredDownloads")
+		configured[string(arr.SONARR)+" "+v.Name] = true
+	}
+	return configured
+}
+
+// Remove snapshots for servers that are no longer configured.
+// Returns the targets of removed snapshots.
+func pruneArrQueueSnapshots() []string {
+	configured := getConfiguredArrTargets()
+	arrQueueSnapshotsMu.Lock()
+	defer arrQueueSnapshotsMu.Unlock()
+	var removed []string
+	for k := range arrQueueSnapshots {
+		if !configured[k] {
+			delete(arrQueueSnapshots, k)
+			removed = append(removed, k)
+		}
+	}
+	return removed
+}
+
+// Remove state cached for arr servers that are no longer configured,
+// their queue snapshots and the circuit breakers of tasks using them.
+// Requests made to them are kept, they are users history.
+// Called whenever a server is removed (as well as after each queue
+// refresh), since the arr tasks don't run at all once no servers are configured.
+func pruneRemovedArrServers() {
+	configured := getConfiguredArrTargets()
+	keep := func(target string) bool { return configured[target] }
+	snapshots := pruneArrQueueSnapshots()
+	breakers := append(pruneTaskBreakers(taskIdRefreshArrQueues, keep), pruneTaskBreakers(taskIdCheckArrDownloads, keep)...)
+	if len(snapshots) == 0 && len(breakers) == 0 {
+		return
+	}
+	slog.Info("pruneRemovedArrServers: Cleaned up state of arr servers no longer configured.", "snapshots", snapshots, "breakers", breakers)
+}
+
+// Get a page of items from all stored queue snapshots.
+// Pages start at 1.
+func getArrQueue(page int, pageSize int) ArrQueueResponse {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	arrQueueSnapshotsMu.RLock()
+	keys := make([]string, 0, len(arrQueueSnapshots))
+	for k := range arrQueueSnapshots {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	resp := ArrQueueResponse{Page: page, PageSize: pageSize, Items: []ArrQueueItem{}}
+	var items []ArrQueueItem
+	for _, k := range keys {
+		s := arrQueueSnapshots[k]
+		if resp.UpdatedAt.IsZero() || s.UpdatedAt.Before(resp.UpdatedAt) {
+			resp.UpdatedAt = s.UpdatedAt
+		}
+		resp.Total += s.Total
+		items = append(items, s.Items...)
+	}
+	arrQueueSnapshotsMu.RUnlock()
+	start := (page - 1) * pageSize
+	if start < len(items) {
+		end := min(start+pageSize, len(items))
+		resp.Items = items[start:end]
 	}
+	return resp
 }
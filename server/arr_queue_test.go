@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sbondCo/Watcharr/arr"
+)
+
+// Clear queue snapshots and refresh breakers until the test ends.
+func useTestArrQueueSnapshots(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		arrQueueSnapshotsMu.Lock()
+		arrQueueSnapshots = map[string]ArrQueueSnapshot{}
+		arrQueueSnapshotsMu.Unlock()
+		resetTaskBreakers(taskIdRefreshArrQueues)
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// Fake arr server with `q` as its queue. Returns its url.
+func newTestArrQueueServer(t *testing.T, q arr.QueuePage) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/command":
+			json.NewEncoder(w).Encode(arr.CommandResponse{})
+		case "/api/v3/queue":
+			json.NewEncoder(w).Encode(q)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestRefreshArrQueuesSnapshotsQueues(t *testing.T) {
+	useTestConfig(t)
+	useTestArrQueueSnapshots(t)
+	radarr := newTestArrQueueServer(t, arr.QueuePage{
+		// More than the server sent us.
+		TotalRecords: 300,
+		Records: []arr.QueueDetail{
+			{Title: "Movie One", Size: 100, SizeLeft: 25, Status: "downloading", TimeLeft: "00:10:00"},
+			{Title: "Movie Two", Size: 0, Status: "queued"},
+		},
+	})
+	sonarr := newTestArrQueueServer(t, arr.QueuePage{
+		TotalRecords: 1,
+		Records:      []arr.QueueDetail{{Title: "Show S01E01", Size: 10, SizeLeft: 10, Status: "paused"}},
+	})
+	Config.RADARR = []RadarrSettings{{ArrSettings: ArrSettings{Name: "movies", Host: radarr, Key: "key"}}}
+	Config.SONARR = []SonarrSettings{{ArrSettings: ArrSettings{Name: "shows", Host: sonarr, Key: "key"}}}
+
+	if err := refreshArrQueues(); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	q := getArrQueue(1, 2)
+	if q.Total != 301 || q.UpdatedAt.IsZero() {
+		t.Errorf("got total %d updated at %s, want 301 and a time", q.Total, q.UpdatedAt)
+	}
+	if len(q.Items) != 2 || q.Items[0].Title != "Movie One" || q.Items[0].Progress != 75 || q.Items[0].Server != "movies" || q.Items[1].Progress != 0 {
+		t.Fatalf("got first page %+v, want both movies", q.Items)
+	}
+	q = getArrQueue(2, 2)
+	if len(q.Items) != 1 || q.Items[0].Title != "Show S01E01" || q.Items[0].Type != arr.SONARR || q.Items[0].Status != "paused" {
+		t.Errorf("got second page %+v, want the show", q.Items)
+	}
+	if q = getArrQueue(3, 2); len(q.Items) != 0 {
+		t.Errorf("got third page %+v, want it empty", q.Items)
+	}
+
+	// Removed servers snapshots are dropped.
+	Config.SONARR = nil
+	if err := refreshArrQueues(); err != nil {
+		t.Fatalf("second refresh failed: %v", err)
+	}
+	if q = getArrQueue(1, 20); q.Total != 300 || len(q.Items) != 2 {
+		t.Errorf("got total %d with %d items after removing sonarr, want only the movies", q.Total, len(q.Items))
+	}
+}
+
+func TestRemovedArrServerStatePurged(t *testing.T) {
+	useTestConfig(t)
+	useTestArrQueueSnapshots(t)
+	resetTaskBreakers(taskIdCheckArrDownloads)
+	t.Cleanup(func() {
+		resetTaskBreakers(taskIdCheckArrDownloads)
+	})
+	Config.RADARR = []RadarrSettings{{ArrSettings: ArrSettings{Name: "movies"}}, {ArrSettings: ArrSettings{Name: "old"}}}
+	Config.SONARR = []SonarrSettings{{ArrSettings: ArrSettings{Name: "shows"}}}
+	targets := []string{"RADARR movies", "RADARR old", "SONARR shows"}
+	arrQueueSnapshotsMu.Lock()
+	for _, target := range targets {
+		arrQueueSnapshots[target] = ArrQueueSnapshot{Server: target, Total: 1}
+	}
+	arrQueueSnapshotsMu.Unlock()
+	for _, task := range []string{taskIdRefreshArrQueues, taskIdCheckArrDownloads} {
+		for _, target := range targets {
+			breakerRecord(task, target, &arr.StatusError{StatusCode: http.StatusBadGateway})
+		}
+	}
+
+	if err := rmRadarr("old"); err != nil {
+		t.Fatalf("failed to remove radarr: %v", err)
+	}
+	arrQueueSnapshotsMu.RLock()
+	for _, target := range targets {
+		if _, ok := arrQueueSnapshots[target]; ok != (target != "RADARR old") {
+			t.Errorf("queue snapshot of %s kept %v after removing RADARR old", target, ok)
+		}
+	}
+	arrQueueSnapshotsMu.RUnlock()
+	for _, task := range []string{taskIdRefreshArrQueues, taskIdCheckArrDownloads} {
+		breakers := getTaskBreakers(task)
+		for _, target := range targets {
+			if _, ok := breakers[target]; ok != (target != "RADARR old") {
+				t.Errorf("%s breaker of %s kept %v after removing RADARR old", task, target, ok)
+			}
+		}
+	}
+}
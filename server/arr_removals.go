@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/sbondCo/Watcharr/arr"
+	"gorm.io/gorm"
+)
+
+const taskIdSyncArrRemovals = "sync_arr_removals"
+
+// What is done on sonarr/radarr to requested content that was removed.
+type ArrRemovalAction string
+
+var (
+	// Stop monitoring it, so nothing more is downloaded.
+	ARR_REMOVAL_UNMONITOR ArrRemovalAction = "unmonitor"
+	// Remove it from the server. Its files are never deleted.
+	ARR_REMOVAL_DELETE ArrRemovalAction = "delete"
+)
+
+// Actions taken on one sonarr/radarr server by a sync.
+type ArrRemovalResult struct {
+	// Requests unmonitored/removed on the server.
+	Synced int `json:"synced"`
+	// Requests whose content was already gone from the server
+	// (eg. removed by hand), marked REMOVED like synced ones.
+	Gone   int `json:"gone"`
+	Failed int `json:"failed"`
+}
+
+func isArrSyncRemovalsEnabled() bool {
+	return Config.TASK_ARR_SYNC_REMOVALS
+}
+
+// Get the action taken for removed content from config, defaults to
+// unmonitoring, the least destructive option.
+func getArrRemovalAction() ArrRemovalAction {
+	switch ArrRemovalAction(Config.TASK_ARR_REMOVAL_ACTION) {
+	case ARR_REMOVAL_DELETE:
+		return ARR_REMOVAL_DELETE
+	case "", ARR_REMOVAL_UNMONITOR:
+		return ARR_REMOVAL_UNMONITOR
+	}
+	slog.Error("getArrRemovalAction: Invalid arr removal action. Using unmonitor.", "action", Config.TASK_ARR_REMOVAL_ACTION)
+	return ARR_REMOVAL_UNMONITOR
+}
+
+// Unmonitor (or remove, see TASK_ARR_REMOVAL_ACTION) content on sonarr/radarr
+// whose request was made through Watcharr, once the user who requested it
+// has removed it from their watched list. Content still on anyones list is
+// left alone, as is content that was already on the server (FOUND, even
+// once it is AVAILABLE), since it wasn't added by us. Synced requests are
+// marked REMOVED, so each request is only ever synced once.
+func syncArrRemovals(db *gorm.DB) error {
+	var reqs []ArrRequest
+	res := db.Joins("Content").
+		Where("arr_requests.status IN ? AND arr_requests.arr_id != 0", []ArrRequestStatus{ARR_REQUEST_APPROVED, ARR_REQUEST_AUTO_APPROVED, ARR_REQUEST_AVAILABLE}).
+		Where("NOT arr_requests.found").
+		Where(`EXISTS (
+	SELECT 1 FROM watcheds w
+	WHERE w.user_id = arr_requests.user_id AND w.content_id = arr_requests.content_id
+	AND w.deleted_at IS NOT NULL AND w.deleted_at > arr_requests.created_at
+)`).
+		Where("NOT EXISTS (SELECT 1 FROM watcheds w WHERE w.content_id = arr_requests.content_id AND w.deleted_at IS NULL)").
+		Find(&reqs)
+	if res.Error != nil {
+		slog.Error("syncArrRemovals: Failed to get removed requests from db", "error", res.Error)
+		return errors.New("failed to get removed requests")
+	}
+	action := getArrRemovalAction()
+	results := map[string]*ArrRemovalResult{}
+	clients := map[string]*arr.Arr{}
+	var errs []error
+	for _, r := range reqs {
+		if r.Content == nil {
+			continue
+		}
+		t := arr.RADARR
+		if r.Content.Type == SHOW {
+			t = arr.SONARR
+		}
+		target := string(t) + " " + r.ServerName
+		a, ok := clients[target]
+		if !ok {
+			a = getArrRemovalClient(t, r.ServerName)
+			clients[target] = a
+		}
+		if a == nil {
+			slog.Debug("syncArrRemovals: Server of request no longer exists, skipping.", "server", target, "request_id", r.ID)
+			continue
+		}
+		if !breakerAllow(taskIdSyncArrRemovals, target) {
+			slog.Debug("syncArrRemovals: Skipping server, circuit breaker is open.", "server", target)
+			continue
+		}
+		if results[target] == nil {
+			results[target] = &ArrRemovalResult{}
+		}
+		var err error
+		if action == ARR_REMOVAL_DELETE {
+			err = a.DeleteContent(r.ArrID)
+		} else {
+			err = a.Unmonitor(r.ArrID)
+		}
+		gone := isArrNotFound(err)
+		if gone {
+			// Nothing left to sync, and the server answered fine.
+			err = nil
+		}
+		breakerRecord(taskIdSyncArrRemovals, target, err)
+		if err != nil {
+			results[target].Failed++
+			errs = append(errs, fmt.Errorf("%s: request %d: %w", target, r.ID, err))
+			continue
+		}
+		if res := db.Model(&ArrRequest{}).Where("id = ?", r.ID).Update("status", ARR_REQUEST_REMOVED); res.Error != nil {
+			// Syncing it again next run is harmless.
+			slog.Error("syncArrRemovals: Failed to update request status", "request_id", r.ID, "error", res.Error)
+			errs = append(errs, fmt.Errorf("request %d: failed to update request status", r.ID))
+		}
+		if gone {
+			results[target].Gone++
+			slog.Info("syncArrRemovals: Content of request already gone from server.", "server", target, "request_id", r.ID, "arr_id", r.ArrID)
+			continue
+		}
+		results[target].Synced++
+		slog.Info("syncArrRemovals: Synced removal to server.", "server", target, "request_id", r.ID, "arr_id", r.ArrID, "action", action)
+	}
+	summary := map[string]any{"action": action, "requests": len(reqs)}
+	for target, v := range results {
+		summary[target] = *v
+	}
+	setTaskSummary(taskIdSyncArrRemovals, summary)
+	return errors.Join(errs...)
+}
+
+// If `err` is a sonarr/radarr server saying the content doesn't exist.
+func isArrNotFound(err error) bool {
+	var se *arr.StatusError
+	return errors.As(err, &se) && se.StatusCode == http.StatusNotFound
+}
+
+// Get a client for a sonarr/radarr server, nil if it isn't configured anymore.
+func getArrRemovalClient(t arr.ArrType, name string) *arr.Arr {
+	if t == arr.SONARR {
+		s, err := getSonarr(name)
+		if err != nil {
+			return nil
+		}
+		return arr.New(t, &s.Host, &s.Key)
+	}
+	s, err := getRadarr(name)
+	if err != nil {
+		return nil
+	}
+	return arr.New(t, &s.Host, &s.Key)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/sbondCo/Watcharr/arr"
+	"gorm.io/gorm"
+)
+
+// Use a fake radarr named `name` that records the removal calls made to
+// it. Deleting movies in `gone` returns a 404, like radarr does.
+func useTestRadarrRemovals(t *testing.T, name string, gone map[string]bool) func() []string {
+	t.Helper()
+	var (
+		calls []string
+		mu    sync.Mutex
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path+" "+string(body))
+		mu.Unlock()
+		if r.Method == http.MethodDelete && gone[r.URL.Path] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	Config.RADARR = []RadarrSettings{{ArrSettings: ArrSettings{Name: name, Host: srv.URL, Key: "key"}}}
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, calls...)
+	}
+}
+
+// Add the content of `r` to the watched list of `userId`,
+// removed from it again if `removed`.
+func addTestArrRequestWatched(t *testing.T, db *gorm.DB, r ArrRequest, userId uint, removed bool) {
+	t.Helper()
+	w := Watched{UserID: userId, ContentID: r.ContentID, Status: FINISHED}
+	if err := db.Create(&w).Error; err != nil {
+		t.Fatalf("failed to create watched: %v", err)
+	}
+	if removed {
+		if err := db.Delete(&w).Error; err != nil {
+			t.Fatalf("failed to remove watched: %v", err)
+		}
+	}
+}
+
+func TestSyncArrRemovalsOffByDefault(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	_, features := getTaskDefinitions(db, db)
+	ft, ok := features[taskIdSyncArrRemovals]
+	if !ok {
+		t.Fatal("sync arr removals isn't a feature task")
+	}
+	if ft.enabled() {
+		t.Error("sync arr removals is enabled without TASK_ARR_SYNC_REMOVALS")
+	}
+	Config.TASK_ARR_SYNC_REMOVALS = true
+	if !ft.enabled() {
+		t.Error("sync arr removals isn't enabled with TASK_ARR_SYNC_REMOVALS")
+	}
+	if getArrRemovalAction() != ARR_REMOVAL_UNMONITOR {
+		t.Errorf("default removal action is %s, want unmonitor", getArrRemovalAction())
+	}
+}
+
+func TestSyncArrRemovalsUnmonitors(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	requester := User{Username: "requester"}
+	db.Create(&requester)
+	other := User{Username: "other"}
+	db.Create(&other)
+	calls := useTestRadarrRemovals(t, "test_removals", nil)
+
+	removed := addTestArrRequest(t, db, "test_removals", 201, 1, ARR_REQUEST_APPROVED)
+	addTestArrRequestWatched(t, db, removed, requester.ID, true)
+	// Still on someone elses list.
+	shared := addTestArrRequest(t, db, "test_removals", 202, 2, ARR_REQUEST_AVAILABLE)
+	addTestArrRequestWatched(t, db, shared, requester.ID, true)
+	addTestArrRequestWatched(t, db, shared, other.ID, false)
+	// Already on the server before it was requested.
+	found := addTestArrRequest(t, db, "test_removals", 203, 3, ARR_REQUEST_FOUND)
+	addTestArrRequestWatched(t, db, found, requester.ID, true)
+
+	if err := syncArrRemovals(db); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	want := `PUT /api/v3/movie/editor {"monitored":false,"movieIds":[1]}`
+	got := calls()
+	if len(got) != 1 || got[0] != want {
+		t.Fatalf("got calls %q, want %q", got, want)
+	}
+	for r, want := range map[uint]ArrRequestStatus{
+		removed.ID: ARR_REQUEST_REMOVED,
+		shared.ID:  ARR_REQUEST_AVAILABLE,
+		found.ID:   ARR_REQUEST_FOUND,
+	} {
+		if s := getTestArrRequestStatus(t, db, r); s != want {
+			t.Errorf("request %d is %s, want %s", r, s, want)
+		}
+	}
+
+	// Synced requests aren't synced again.
+	if err := syncArrRemovals(db); err != nil {
+		t.Fatalf("second sync failed: %v", err)
+	}
+	if got := calls(); len(got) != 1 {
+		t.Errorf("second sync made calls %q", got[1:])
+	}
+}
+
+func TestSyncArrRemovalsContentGoneFromServer(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_ARR_REMOVAL_ACTION = string(ARR_REMOVAL_DELETE)
+	resetTaskBreakers(taskIdSyncArrRemovals)
+	t.Cleanup(func() {
+		resetTaskBreakers(taskIdSyncArrRemovals)
+	})
+	db := newTestDb(t)
+	requester := User{Username: "requester"}
+	db.Create(&requester)
+	calls := useTestRadarrRemovals(t, "test_removals_gone", map[string]bool{"/api/v3/movie/9": true})
+
+	deleted := addTestArrRequest(t, db, "test_removals_gone", 301, 1, ARR_REQUEST_APPROVED)
+	addTestArrRequestWatched(t, db, deleted, requester.ID, true)
+	// Removed from radarr by hand already.
+	gone := addTestArrRequest(t, db, "test_removals_gone", 302, 9, ARR_REQUEST_AVAILABLE)
+	addTestArrRequestWatched(t, db, gone, requester.ID, true)
+
+	if err := syncArrRemovals(db); err != nil {
+		t.Fatalf("sync failed with content gone from the server: %v", err)
+	}
+	if got := calls(); len(got) != 2 {
+		t.Fatalf("got calls %q, want a delete of each", got)
+	}
+	for _, r := range []ArrRequest{deleted, gone} {
+		if s := getTestArrRequestStatus(t, db, r.ID); s != ARR_REQUEST_REMOVED {
+			t.Errorf("request %d is %s, want removed", r.ID, s)
+		}
+	}
+	res, ok := getTaskStatus(taskIdSyncArrRemovals).Summary["RADARR test_removals_gone"].(ArrRemovalResult)
+	if !ok || res.Synced != 1 || res.Gone != 1 || res.Failed != 0 {
+		t.Errorf("got result %+v, want 1 synced and 1 gone", res)
+	}
+	if b := getTaskBreakers(taskIdSyncArrRemovals)["RADARR test_removals_gone"]; b.ConsecutiveFailures != 0 {
+		t.Errorf("404 counted towards the breaker: %+v", b)
+	}
+}
+
+func TestSyncArrRemovalsAfterDownloadsKeepsFound(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	requester := User{Username: "requester"}
+	db.Create(&requester)
+	useTestRadarr(t, "test_removals_found", []arr.LibraryItem{
+		{ID: 1, TmdbID: 401, HasFile: true},
+		{ID: 2, TmdbID: 402, HasFile: true},
+	})
+	added := addTestArrRequest(t, db, "test_removals_found", 401, 1, ARR_REQUEST_APPROVED)
+	addTestArrRequestWatched(t, db, added, requester.ID, true)
+	// Already on the server, FOUND before found was tracked.
+	found := addTestArrRequest(t, db, "test_removals_found", 402, 2, ARR_REQUEST_FOUND)
+	addTestArrRequestWatched(t, db, found, requester.ID, true)
+
+	if err := checkArrDownloads(db); err != nil {
+		t.Fatalf("downloads check failed: %v", err)
+	}
+	for _, r := range []ArrRequest{added, found} {
+		if s := getTestArrRequestStatus(t, db, r.ID); s != ARR_REQUEST_AVAILABLE {
+			t.Fatalf("request %d is %s after the downloads check, want available", r.ID, s)
+		}
+	}
+	calls := useTestRadarrRemovals(t, "test_removals_found", nil)
+	if err := syncArrRemovals(db); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	want := `PUT /api/v3/movie/editor {"monitored":false,"movieIds":[1]}`
+	if got := calls(); len(got) != 1 || got[0] != want {
+		t.Errorf("got calls %q, want only %q", got, want)
+	}
+	if s := getTestArrRequestStatus(t, db, found.ID); s != ARR_REQUEST_AVAILABLE {
+		t.Errorf("found request is %s, want it left available", s)
+	}
+}
@@ -22,6 +22,11 @@ const (
 	ARR_REQUEST_DENIED ArrRequestStatus = "DENIED"
 	// Content was found on sonarr/radarr already, nothing needs to be done.
 	ARR_REQUEST_FOUND ArrRequestStatus = "FOUND"
+	// Content has been downloaded by sonarr/radarr and is ready to watch.
+	ARR_REQUEST_AVAILABLE ArrRequestStatus = "AVAILABLE"
+	// Content was removed from the requesters watched list, so it was
+	// unmonitored/removed on sonarr/radarr (see TASK_ARR_SYNC_REMOVALS).
+	ARR_REQUEST_REMOVED ArrRequestStatus = "REMOVED"
 )
 
 type ArrRequest struct {
@@ -42,11 +47,23 @@ type ArrRequest struct {
 	ArrID int `json:"arrId"`
 	// Tracked request status
 	Status ArrRequestStatus `json:"status" gorm:"default:PENDING"`
+	// If the content was already on sonarr/radarr when requested (FOUND),
+	// kept once the request becomes AVAILABLE, so we know we didn't add it.
+	Found bool `json:"found"`
 	// Full request made by user (arr.SonarrRequest / arr.RadarrRequest)
 	// so we know how to fulfil the request if approved.
 	RequestJson string `json:"requestJson"`
 }
 
+// If the request was added to sonarr/radarr by us (approved, and
+// maybe already downloaded), so it going missing there means it was removed.
+func isArrRequestAdded(r ArrRequest) bool {
+	if r.Found {
+		return false
+	}
+	return r.Status == ARR_REQUEST_APPROVED || r.Status == ARR_REQUEST_AUTO_APPROVED || r.Status == ARR_REQUEST_AVAILABLE
+}
+
 func deleteArrRequest(db *gorm.DB, id uint) error {
 	resp := db.Delete(&ArrRequest{ID: id})
 	if resp.Error != nil {
@@ -130,13 +147,14 @@ func createSonarrRequest(db *gorm.DB, userId uint, userPerms int, ur arr.SonarrR
 		found := lookupRes[0] // There should only be one result when looking up by id.
 		// If it has an ID, then it will have already been added to Sonarr.
 		if found.ID != 0 {
-			dbResp := db.Model(&ArrRequest{}).Where("id = ?", arrReq.ID).Update("arr_id", found.ID).Update("status", ARR_REQUEST_FOUND)
+			dbResp := db.Model(&ArrRequest{}).Where("id = ?", arrReq.ID).Updates(map[string]interface{}{"arr_id": found.ID, "status": ARR_REQUEST_FOUND, "found": true})
 			if dbResp.Error != nil {
 				slog.Error("createSonarrRequest: Failed to update request in db", "error", err)
 				return &ArrRequest{}, errors.New("content was requested, but we failed to update the db")
 			} else {
 				slog.Debug("createSonarrRequest: Result from lookup had an ID. Request in database has been updated with it.", "arr_id", found.ID)
 				arrReq.ArrID = found.ID
+				arrReq.Found = true
 				return arrReq, nil
 			}
 		}
@@ -191,13 +209,14 @@ func createRadarrRequest(db *gorm.DB, userId uint, userPerms int, ur arr.RadarrR
 		found := lookupRes[0] // There should only be one result when looking up by id.
 		// If it has an ID, then it will have already been added to Radarr.
 		if found.ID != 0 {
-			dbResp := db.Model(&ArrRequest{}).Where("id = ?", arrReq.ID).Update("arr_id", found.ID).Update("status", ARR_REQUEST_FOUND)
+			dbResp := db.Model(&ArrRequest{}).Where("id = ?", arrReq.ID).Updates(map[string]interface{}{"arr_id": found.ID, "status": ARR_REQUEST_FOUND, "found": true})
 			if dbResp.Error != nil {
 				slog.Error("createRadarrRequest: Failed to update request in db", "error", err)
 				return &ArrRequest{}, errors.New("content was requested, but we failed to update the db")
 			} else {
 				slog.Debug("createRadarrRequest: Result from lookup had an ID. Request in database has been updated with it.", "arr_id", found.ID)
 				arrReq.ArrID = found.ID
+				arrReq.Found = true
 				return arrReq, nil
 			}
 		}
@@ -246,7 +265,7 @@ func getRadarrRequestInfo(db *gorm.DB, requestId uint) (arr.MovieSerie, error) {
 	resp, respStatusCode, err := radarr.GetContent(arrRequest.ArrID)
 	if err != nil {
 		slog.Error("radarr info: Failed to get info", "error", err)
-		if (arrRequest.Status == ARR_REQUEST_APPROVED || arrRequest.Status == ARR_REQUEST_AUTO_APPROVED) && respStatusCode == 404 {
+		if isArrRequestAdded(arrRequest) && respStatusCode == 404 {
 			slog.Error("radarr info: 404 returned.. content must've been removed.. removing request.")
 			err := deleteArrRequest(db, arrRequest.ID)
 			if err != nil {
@@ -279,7 +298,7 @@ func getSonarrRequestInfo(db *gorm.DB, requestId uint) (arr.MovieSerie, error) {
 	resp, respStatusCode, err := sonarr.GetContent(arrRequest.ArrID)
 	if err != nil {
 		slog.Error("sonarr info: Failed to get info", "error", err)
-		if (arrRequest.Status == ARR_REQUEST_APPROVED || arrRequest.Status == ARR_REQUEST_AUTO_APPROVED) && respStatusCode == 404 {
+		if isArrRequestAdded(arrRequest) && respStatusCode == 404 {
 			slog.Error("sonarr info: 404 returned.. content must've been removed.. removing request.")
 			err := deleteArrRequest(db, arrRequest.ID)
 			if err != nil {
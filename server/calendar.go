@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Default days ahead calendars cover.
+	calendarDefaultDays = 30
+	// Time between each request to tmdb, so we stay well under its rate limit.
+	calendarRequestInterval = 250 * time.Millisecond
+	// How long after a users list changes their calendar is refreshed,
+	// so a burst of changes (eg. an import) only refreshes it once.
+	calendarRefreshDelay = 30 * time.Second
+	// Format of tmdb air dates.
+	calendarDateFormat = "2006-01-02"
+)
+
+// An upcoming episode of a show a user is watching,
+// precomputed by the Refresh Calendars task.
+type CalendarEpisode struct {
+	ID            uint     `json:"-" gorm:"primarykey"`
+	UserID        uint     `json:"-" gorm:"index;not null"`
+	ContentID     int      `json:"-" gorm:"not null"`
+	Content       *Content `json:"content,omitempty"`
+	SeasonNumber  int      `json:"seasonNumber"`
+	EpisodeNumber int      `json:"episodeNumber"`
+	Name          string   `json:"name"`
+	// Date the episode airs, in `YYYY-MM-DD` format.
+	AirDate   string    `json:"airDate"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Only what calendars need of tmdb show details.
+type calendarShowDetails struct {
+	NumberOfSeasons  int `json:"number_of_seasons"`
+	NextEpisodeToAir *struct {
+		SeasonNumber int `json:"season_number"`
+	} `json:"next_episode_to_air"`
+}
+
+// A show on a users list that is being watched.
+type calendarShow struct {
+	UserID    uint
+	ContentID int
+	TmdbID    int
+}
+
+var (
+	// Pending calendar refreshes, by user.
+	calendarRefreshes   = map[uint]*time.Timer{}
+	calendarRefreshesMu sync.Mutex
+)
+
+func getCalendarDays() int {
+	if Config.TASK_CALENDAR_DAYS > 0 {
+		return Config.TASK_CALENDAR_DAYS
+	}
+	return calendarDefaultDays
+}
+
+// Refresh every users calendar of upcoming episodes.
+func refreshCalendars(db *gorm.DB) error {
+	return refreshCalendarsFor(db, nil)
+}
+
+// Refresh the calendars of `userIds` (all users if nil): episodes of shows
+// they are watching that air in the next TASK_CALENDAR_DAYS. Each show is
+// requested from tmdb once, however many users are watching it.
+func refreshCalendarsFor(db *gorm.DB, userIds []uint) error {
+	q := db.Model(&Watched{}).
+		Joins("JOIN contents c ON c.id = watcheds.content_id").
+		Where("watcheds.status = ? AND c.type = ?", WATCHING, SHOW)
+	if userIds != nil {
+		q = q.Where("watcheds.user_id IN ?", userIds)
+	}
+	var shows []calendarShow
+	res := q.Select("watcheds.user_id AS user_id", "c.id AS content_id", "c.tmdb_id AS tmdb_id").Find(&shows)
+	if res.Error != nil {
+		slog.Error("refreshCalendarsFor: Failed to get watched shows", "error", res.Error)
+		return errors.New("failed to get watched shows")
+	}
+	from := time.Now().Format(calendarDateFormat)
+	to := time.Now().AddDate(0, 0, getCalendarDays()).Format(calendarDateFormat)
+	var (
+		// Upcoming episodes by content id.
+		upcoming = map[int][]CalendarEpisode{}
+		// Content ids of shows we failed to get.
+		failed []int
+		tried  = map[int]bool{}
+		errs   []error
+	)
+	ticker := time.NewTicker(calendarRequestInterval)
+	defer ticker.Stop()
+	for _, s := range shows {
+		if tried[s.ContentID] {
+			continue
+		}
+		tried[s.ContentID] = true
+		eps, err := getUpcomingEpisodes(s.TmdbID, from, to, ticker)
+		if err != nil {
+			failed = append(failed, s.ContentID)
+			errs = append(errs, err)
+			continue
+		}
+		upcoming[s.ContentID] = eps
+	}
+	var entries []CalendarEpisode
+	for _, s := range shows {
+		for _, e := range upcoming[s.ContentID] {
+			e.UserID = s.UserID
+			e.ContentID = s.ContentID
+			entries = append(entries, e)
+		}
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Calendars are replaced, except for shows we failed to get, so
+		// users keep what they had for those rather than losing them.
+		del := tx.Where("1 = 1")
+		if userIds != nil {
+			del = tx.Where("user_id IN ?", userIds)
+		}
+		if len(failed) > 0 {
+			del = del.Where("content_id NOT IN ?", failed)
+		}
+		if err := del.Delete(&CalendarEpisode{}).Error; err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&entries, 500).Error
+	})
+	if err != nil {
+		slog.Error("refreshCalendarsFor: Failed to save calendars", "error", err)
+		return errors.New("failed to save calendars")
+	}
+	if userIds == nil {
+		users := map[uint]bool{}
+		for _, s := range shows {
+			users[s.UserID] = true
+		}
+		setTaskSummary("refresh_calendars", map[string]any{"users": len(users), "shows": len(tried), "failedShows": len(failed), "episodes": len(entries)})
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to get upcoming episodes of %d shows: %w", len(errs), errors.Join(errs...))
+	}
+	return nil
+}
+
+// Get episodes of a show that air between `from` and `to` (inclusive).
+// Only seasons from the next episode to air on are requested, shows
+// with nothing announced need just the one request.
+func getUpcomingEpisodes(tmdbId int, from string, to string, ticker *time.Ticker) ([]CalendarEpisode, error) {
+	<-ticker.C
+	id := strconv.Itoa(tmdbId)
+	var details calendarShowDetails
+	if err := tmdbTaskRequest("refresh_calendars", "/tv/"+id, map[string]string{}, &details); err != nil {
+		slog.Error("getUpcomingEpisodes: Failed to get show details", "tmdb_id", tmdbId, "error", err)
+		// Not wrapped, request errors can include our api key.
+		return nil, fmt.Errorf("show %d: request to tmdb failed", tmdbId)
+	}
+	eps := []CalendarEpisode{}
+	if details.NextEpisodeToAir == nil {
+		return eps, nil
+	}
+	for n := details.NextEpisodeToAir.SeasonNumber; n <= max(details.NumberOfSeasons, details.NextEpisodeToAir.SeasonNumber); n++ {
+		<-ticker.C
+		season, err := taskSeasonDetails("refresh_calendars", id, strconv.Itoa(n))
+		if err != nil {
+			return nil, fmt.Errorf("show %d season %d: %w", tmdbId, n, err)
+		}
+		for _, e := range season.Episodes {
+			// Dates are all the same format, so compare as is.
+			if e.AirDate == "" || e.AirDate < from || e.AirDate > to {
+				continue
+			}
+			eps = append(eps, CalendarEpisode{SeasonNumber: e.SeasonNumber, EpisodeNumber: e.EpisodeNumber, Name: e.Name, AirDate: e.AirDate})
+		}
+	}
+	return eps, nil
+}
+
+// Refresh a users calendar shortly, after their watched list changed.
+// Repeated calls push the refresh back, so it only happens once things settle.
+func queueCalendarRefresh(db *gorm.DB, userId uint) {
+	calendarRefreshesMu.Lock()
+	defer calendarRefreshesMu.Unlock()
+	if t, ok := calendarRefreshes[userId]; ok {
+		t.Reset(calendarRefreshDelay)
+		return
+	}
+	calendarRefreshes[userId] = time.AfterFunc(calendarRefreshDelay, func() {
+		calendarRefreshesMu.Lock()
+		delete(calendarRefreshes, userId)
+		calendarRefreshesMu.Unlock()
+		if err := refreshCalendarsFor(db, []uint{userId}); err != nil {
+			slog.Error("queueCalendarRefresh: Failed to refresh calendar", "user_id", userId, "error", err)
+		}
+	})
+}
+
+// Remove a watched entries episodes from its users calendar, after it was
+// removed or is no longer being watched. No need to ask tmdb for that.
+func removeFromCalendar(db *gorm.DB, userId uint, watchedId uint) {
+	res := db.Where("user_id = ? AND content_id = (SELECT content_id FROM watcheds WHERE id = ?)", userId, watchedId).Delete(&CalendarEpisode{})
+	if res.Error != nil {
+		slog.Error("removeFromCalendar: Failed to remove episodes from calendar", "user_id", userId, "watched_id", watchedId, "error", res.Error)
+	}
+}
+
+// Get a users upcoming episodes, soonest first.
+func getCalendar(db *gorm.DB, userId uint) ([]CalendarEpisode, error) {
+	eps := []CalendarEpisode{}
+	res := db.Preload("Content").
+		Where("user_id = ? AND air_date >= ?", userId, time.Now().Format(calendarDateFormat)).
+		Order("air_date, season_number, episode_number").
+		Find(&eps)
+	if res.Error != nil {
+		slog.Error("getCalendar: Failed to get calendar", "user_id", userId, "error", res.Error)
+		return []CalendarEpisode{}, errors.New("failed to get calendar")
+	}
+	return eps, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRefreshCalendars(t *testing.T) {
+	useTestConfig(t)
+	useTestTMDBLimiter(t)
+	day := func(d int) string {
+		return time.Now().AddDate(0, 0, d).Format(calendarDateFormat)
+	}
+	var (
+		requests = map[string]int{}
+		mu       sync.Mutex
+	)
+	useTestTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/3/tv/701":
+			w.Write([]byte(`{"number_of_seasons":2,"next_episode_to_air":{"season_number":2}}`))
+		case "/3/tv/701/season/2":
+			fmt.Fprintf(w, `{"episodes":[
+				{"season_number":2,"episode_number":1,"name":"Aired","air_date":%q},
+				{"season_number":2,"episode_number":2,"name":"Soon","air_date":%q},
+				{"season_number":2,"episode_number":3,"name":"Later","air_date":%q},
+				{"season_number":2,"episode_number":4,"name":"Too Far","air_date":%q},
+				{"season_number":2,"episode_number":5,"name":"Undated","air_date":""}
+			]}`, day(-1), day(3), day(10), day(calendarDefaultDays+1))
+		case "/3/tv/702":
+			// Nothing announced.
+			w.Write([]byte(`{"number_of_seasons":4}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	db := newTestDb(t)
+	alice := User{Username: "alice"}
+	db.Create(&alice)
+	bob := User{Username: "bob"}
+	db.Create(&bob)
+	add := func(c Content, status WatchedStatus, users ...User) Content {
+		db.Create(&c)
+		for _, u := range users {
+			db.Create(&Watched{UserID: u.ID, ContentID: &c.ID, Status: status})
+		}
+		return c
+	}
+	add(Content{TmdbID: 701, Title: "Airing Show", Type: SHOW}, WATCHING, alice, bob)
+	add(Content{TmdbID: 702, Title: "Ended Show", Type: SHOW}, WATCHING, alice)
+	add(Content{TmdbID: 703, Title: "Planned Show", Type: SHOW}, PLANNED, alice)
+	add(Content{TmdbID: 704, Title: "Watching Movie", Type: MOVIE}, WATCHING, alice)
+	broken := add(Content{TmdbID: 705, Title: "Broken Show", Type: SHOW}, WATCHING, bob)
+	// From an earlier refresh, kept since the show can't be got now.
+	db.Create(&CalendarEpisode{UserID: bob.ID, ContentID: broken.ID, SeasonNumber: 1, EpisodeNumber: 8, Name: "Kept", AirDate: day(5)})
+
+	if err := refreshCalendars(db); err == nil {
+		t.Error("refresh didn't return an error for the show that failed")
+	}
+	want := map[string]any{"users": 2, "shows": 3, "failedShows": 1, "episodes": 4}
+	if s := getTaskStatus("refresh_calendars").Summary; !reflect.DeepEqual(s, want) {
+		t.Errorf("got summary %v, want %v", s, want)
+	}
+	mu.Lock()
+	if n := requests["/3/tv/701"]; n != 1 {
+		t.Errorf("show watched by 2 users requested %d times, want once", n)
+	}
+	for _, p := range []string{"/3/tv/701/season/1", "/3/tv/702/season/4", "/3/tv/703", "/3/tv/704"} {
+		if requests[p] != 0 {
+			t.Errorf("requested %s, want only what can have upcoming episodes", p)
+		}
+	}
+	mu.Unlock()
+
+	for _, c := range []struct {
+		user User
+		want []string
+	}{
+		{alice, []string{"Airing Show Soon " + day(3), "Airing Show Later " + day(10)}},
+		{bob, []string{"Airing Show Soon " + day(3), "Broken Show Kept " + day(5), "Airing Show Later " + day(10)}},
+	} {
+		eps, err := getCalendar(db, c.user.ID)
+		if err != nil {
+			t.Fatalf("failed to get calendar of %s: %v", c.user.Username, err)
+		}
+		got := []string{}
+		for _, e := range eps {
+			got = append(got, e.Content.Title+" "+e.Name+" "+e.AirDate)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("calendar of %s is %q, want %q", c.user.Username, got, c.want)
+		}
+	}
+	if eps, _ := getCalendar(db, alice.ID); len(eps) == 0 || eps[0].SeasonNumber != 2 || eps[0].EpisodeNumber != 2 {
+		t.Errorf("first episode of %+v isn't S2E2", eps)
+	}
+}
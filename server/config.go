@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"os"
 	"path"
+	"sync"
 	"time"
 
 	"github.com/sbondCo/Watcharr/game"
@@ -49,6 +50,16 @@ type ServerConfig struct {
 	// If unprovided, the default Watcharr API key will be used.
 	TMDB_KEY string `json:",omitempty"`
 
+	// Optional: Max tmdb requests per second, shared by user requests
+	// and tasks. Task requests wait once over it, user requests don't.
+	// Defaults to 40.
+	TMDB_RATE_LIMIT int `json:",omitempty"`
+
+	// Optional: Percent of TMDB_RATE_LIMIT tasks can't use, so they
+	// don't starve user requests. Defaults to 25. Tasks always keep
+	// at least one request per second.
+	TMDB_USER_RESERVE int `json:",omitempty"`
+
 	// Optional: Point to Plex install to enable plex features.
 	PLEX_HOST string `json:",omitempty"`
 
@@ -62,9 +73,247 @@ type ServerConfig struct {
 	RADARR []RadarrSettings `json:",omitempty"`
 	TWITCH game.IGDB        `json:",omitempty"`
 
+	// Optional: Trakt api app, enables users linking
+	// their trakt account to sync watched items to it.
+	TRAKT_SYNC TraktSyncSettings `json:",omitempty"`
+
 	// Optional: Schedule for tasks.
+	// All TASK_ maps are keyed by task id (eg. `cleanup_tokens`).
 	TASK_SCHEDULE map[string]int `json:",omitempty"`
 
+	// Optional: Stop startup if TASK_SCHEDULE (or TASK_SCHEDULE_RANGE) has
+	// intervals out of range, instead of clamping them into range.
+	TASK_SCHEDULE_STRICT bool `json:",omitempty"`
+
+	// Optional: Multiplier for default task intervals, eg. 2 runs
+	// all tasks half as often. Tasks with a TASK_SCHEDULE are not affected.
+	TASK_INTERVAL_MULTIPLIER float64 `json:",omitempty"`
+
+	// Optional: Display names for tasks, to rename
+	// (or translate) them without changing their id.
+	TASK_NAMES map[string]string `json:",omitempty"`
+
+	// Optional: Random schedule range for tasks, each run picks
+	// an interval between Min and Max. Takes priority over TASK_SCHEDULE.
+	TASK_SCHEDULE_RANGE map[string]TaskScheduleRange `json:",omitempty"`
+
+	// Optional: Tasks hidden from the task list, eg. internal tasks on a
+	// managed deployment. Hidden tasks still run and report metrics.
+	TASK_HIDDEN map[string]bool `json:",omitempty"`
+
+	// Optional: Tasks that are disabled, their runs are skipped until they
+	// are rescheduled. Set by rescheduling a task to 0 seconds.
+	TASK_DISABLED map[string]bool `json:",omitempty"`
+
+	// Optional: Consecutive failures after which a task disables itself
+	// and admins are notified. Unlike the circuit breaker this doesn't wear
+	// off, the task stays disabled until an admin enables it again.
+	TASK_DISABLE_AFTER_FAILURES map[string]int `json:",omitempty"`
+
+	// Set by the server: Why tasks disabled themselves (see
+	// TASK_DISABLE_AFTER_FAILURES), removed once they are enabled again.
+	TASK_AUTO_DISABLED map[string]TaskAutoDisabled `json:",omitempty"`
+
+	// Optional: If a tasks runs are deferred while an import is running,
+	// so it doesn't contend with the imports writes. Deferred runs are
+	// retried every minute until imports finish. Defaults to true for
+	// maintenance tasks and false for the rest.
+	TASK_DEFER_DURING_IMPORT map[string]bool `json:",omitempty"`
+
+	// Optional: Region (eg. `GB`) the Refresh Watch Providers task
+	// gets streaming availability for. DEFAULT_COUNTRY if not set.
+	TASK_WATCH_PROVIDERS_REGION string `json:",omitempty"`
+
+	// Optional: Secret for triggering tasks from outside (eg. an external
+	// cron) with `POST /api/trigger/task/:id`, sent in the
+	// `X-Task-Trigger-Secret` header. Triggering is disabled if not set.
+	TASK_TRIGGER_SECRET string `json:",omitempty"`
+
+	// Optional: Secret for scraping task metrics (eg. by prometheus) from
+	// `GET /api/task/metrics`, sent as `Authorization: Bearer <secret>`.
+	// Metrics can't be scraped if not set.
+	TASK_METRICS_SECRET string `json:",omitempty"`
+
+	// Optional: Max task runs kept in history, across all tasks. Once over,
+	// the oldest runs are removed first, whichever task they are from.
+	// Runs are still removed after 30 days. Unlimited by default.
+	TASK_HISTORY_MAX_RUNS int `json:",omitempty"`
+
+	// Optional: Expected max duration (seconds) of a tasks run.
+	// Runs going over are warned about and counted, but not stopped.
+	TASK_SLA map[string]int `json:",omitempty"`
+
+	// Optional: What to do when a task misses a run, because the server was
+	// down: `skip` (default) or `catch-up` (run as soon as the server starts).
+	TASK_MISSED_RUN map[string]TaskMissedRunPolicy `json:",omitempty"`
+
+	// Optional: Max amount of tasks that can run at once in each
+	// task pool (`light` and `heavy`). Unlimited by default.
+	TASK_CONCURRENCY int `json:",omitempty"`
+
+	// Optional: Max amount of tasks that can run at once in a
+	// specific pool, keyed by pool name. Overrides TASK_CONCURRENCY.
+	TASK_POOL_CONCURRENCY map[string]int `json:",omitempty"`
+
+	// Optional: Priority of tasks (higher first, default 0), used to pick
+	// which waiting task runs next when its pools limit is reached.
+	// Best effort, running tasks are never stopped for a higher priority one.
+	TASK_PRIORITY map[string]int `json:",omitempty"`
+
+	// Optional: OS priority (nice value, 1-19, higher is lower priority)
+	// to run a task at, so heavy tasks get out of the way of requests.
+	// Linux only, ignored elsewhere. Only the tasks own goroutine is
+	// lowered, goroutines it starts run at normal priority.
+	TASK_NICE map[string]int `json:",omitempty"`
+
+	// Optional: Window (seconds) a task failing with the same error over
+	// and over is only logged once per, with a count of the failures that
+	// weren't. Failures are still all recorded in the tasks stats.
+	// Every failure is logged by default.
+	TASK_ERROR_LOG_WINDOW map[string]int `json:",omitempty"`
+
+	// Optional: Run a task a delay (seconds) after another task succeeds,
+	// instead of on its own schedule, eg. `{"cleanup_images": {"Task":
+	// "refresh_watch_providers", "Delay": 300}}`. Entries that would
+	// make tasks run after each other forever are ignored.
+	TASK_AFTER map[string]TaskAfter `json:",omitempty"`
+
+	// Optional: Windows of the day a task is allowed to run in, eg.
+	// `{"refresh_arr_queues": [{"Start": "18:00", "End": "23:00"}]}`.
+	// Runs outside all of them are skipped. Windows can go past midnight
+	// and use the schedulers timezone. Tasks without any always run.
+	TASK_WINDOWS map[string][]TaskWindow `json:",omitempty"`
+
+	// Optional: Defaults for the per task settings above (priority, SLA,
+	// missed run, nice, error log window), TASK_DISABLE_AFTER_FAILURES
+	// and TASK_DEFER_DURING_IMPORT, applied to every task that doesn't set
+	// its own. A task setting its own value always takes precedence.
+	TASK_DEFAULTS TaskDefaults `json:",omitempty"`
+
+	// Optional: Sqlite database (dsn, eg. a path) read heavy tasks (eg.
+	// Compute Recommendations) scan instead of the main one, such as a
+	// replica kept up to date with litestream. Their writes still go to the
+	// main database. Defaults to the main database. Pointing this at the
+	// main database file itself does little, sqlite connections to one
+	// file still share its locks.
+	TASK_READ_DB string `json:",omitempty"`
+
+	// Optional: Report tasks, each runs a read only SELECT on an interval
+	// and caches its rows for admins to view (`GET /api/task/report/:id`).
+	TASK_REPORTS []TaskReport `json:",omitempty"`
+
+	// Optional: Seconds to wait after startup before the task
+	// scheduler is started. Gives the db and external services
+	// (eg arr servers) time to become ready before tasks first run.
+	TASK_STARTUP_DELAY int `json:",omitempty"`
+
+	// Optional: Merge duplicate watched entries found by the
+	// Detect Duplicates task, instead of only reporting them.
+	TASK_MERGE_DUPLICATES bool `json:",omitempty"`
+
+	// Optional: Notify users when content they requested
+	// has been downloaded by sonarr/radarr.
+	TASK_ARR_NOTIFY_AVAILABLE bool `json:",omitempty"`
+
+	// Optional: Enable the Sync Arr Removals task, which unmonitors
+	// content on sonarr/radarr that was requested through Watcharr,
+	// once its requester removes it from their watched list.
+	// Off by default, since it changes what the servers download.
+	TASK_ARR_SYNC_REMOVALS bool `json:",omitempty"`
+
+	// Optional: What the Sync Arr Removals task does to removed content:
+	// `unmonitor` (default) or `delete` (remove it from the server,
+	// its files are never deleted).
+	TASK_ARR_REMOVAL_ACTION string `json:",omitempty"`
+
+	// Optional: Opt in to the Send Telemetry task, which sends anonymous
+	// totals (content tracked, task health, see `TelemetryPayload`) to
+	// TASK_TELEMETRY_URL weekly. Nothing about any user is ever sent.
+	// Preview what would be sent with `GET /api/task/telemetry/preview`.
+	TASK_TELEMETRY bool `json:",omitempty"`
+
+	// Optional: Where the Send Telemetry task posts to.
+	// Nothing is sent without it, even if TASK_TELEMETRY is enabled.
+	TASK_TELEMETRY_URL string `json:",omitempty"`
+
+	// Optional: Enable the Stale Watching Reminders task, which
+	// reminds users about shows/movies they are still watching
+	// but have had no activity on for TASK_STALE_WATCHING_DAYS.
+	TASK_STALE_WATCHING_REMINDERS bool `json:",omitempty"`
+
+	// Optional: Days without activity before a watching entry
+	// gets a reminder. Defaults to 180.
+	TASK_STALE_WATCHING_DAYS int `json:",omitempty"`
+
+	// Optional: Times tmdb can rate limit us (429) in an hour before
+	// the Check TMDB Rate Limits task warns. Defaults to 10.
+	TASK_TMDB_RATE_LIMIT_WARN int `json:",omitempty"`
+
+	// Optional: Percent of the tmdb requests tasks can make (TMDB_RATE_LIMIT
+	// less TMDB_USER_RESERVE) one task should use on average. Tasks making
+	// tmdb requests can't be rescheduled to run more often than keeps their
+	// busiest recent run under it. Defaults to 10.
+	TASK_TMDB_SHARE int `json:",omitempty"`
+
+	// Optional: TMDB size backdrops are cached at by the Cache Backdrops
+	// task: `w300`, `w780`, `w1280` (default) or `original`. Backdrops
+	// already cached aren't redownloaded when it is changed.
+	TASK_BACKDROP_SIZE string `json:",omitempty"`
+
+	// Optional: Days ahead the Refresh Calendars task looks
+	// for upcoming episodes of shows users are watching.
+	// Defaults to 30.
+	TASK_CALENDAR_DAYS int `json:",omitempty"`
+
+	// Optional: Seconds within which activity of the same type on the same
+	// watched entry is collapsed by the Compact Activity task. Defaults to 60.
+	TASK_COMPACT_ACTIVITY_WINDOW int `json:",omitempty"`
+
+	// Optional: Types of activity the Compact Activity task collapses.
+	// Defaults to RATING_CHANGED, STATUS_CHANGED and THOUGHTS_CHANGED.
+	TASK_COMPACT_ACTIVITY_TYPES []ActivityType `json:",omitempty"`
+
+	// Optional: Window of time (server local time) in which
+	// no tasks will run. Runs due inside it are skipped.
+	TASK_QUIET_HOURS TaskQuietHours `json:",omitempty"`
+
+	// Optional: Weighted failures in a row (see TASK_BREAKER_WEIGHTS) before
+	// a task stops trying an external service (eg. an arr server). Defaults to 5.
+	TASK_BREAKER_THRESHOLD int `json:",omitempty"`
+
+	// Optional: How much each kind of failure (`auth`, `transient`
+	// or `unknown`) counts towards TASK_BREAKER_THRESHOLD. Defaults to
+	// auth opening it straight away, transient 1 and unknown 2.
+	TASK_BREAKER_WEIGHTS map[string]int `json:",omitempty"`
+
+	// Optional: Seconds a task waits before trying a failing
+	// external service again. Defaults to 300.
+	TASK_BREAKER_COOLDOWN int `json:",omitempty"`
+
+	// Optional: Amount of image files the Cleanup Images task
+	// removes at once. Can speed it up on slow storage. Defaults to 1.
+	TASK_CLEANUP_IMAGES_WORKERS int `json:",omitempty"`
+
+	// Optional: Enable the Rotate Logs task, which rotates the log
+	// file on a schedule once it is over LOG_MAX_SIZE, rather than
+	// only when it is next written to.
+	TASK_ROTATE_LOGS bool `json:",omitempty"`
+
+	// Optional: Size (megabytes) the log file can grow to before
+	// it is rotated. Defaults to 1.
+	LOG_MAX_SIZE int `json:",omitempty"`
+
+	// Optional: Amount of rotated log files to keep. Defaults to 3.
+	LOG_MAX_BACKUPS int `json:",omitempty"`
+
+	// Optional: Log task run summaries as a single `summary` attribute
+	// holding JSON, instead of an attribute per figure. Easier for
+	// log aggregators to parse.
+	LOG_TASK_SUMMARY_JSON bool `json:",omitempty"`
+
+	// Optional: Gzip rotated log files.
+	LOG_COMPRESS bool `json:",omitempty"`
+
 	// Enable/disable debug logging. Useful for when trying
 	// to figure out exactly what the server is doing at a point
 	// of failure.
@@ -101,6 +350,10 @@ func (c *ServerConfig) GetSafe() ServerConfig {
 var (
 	// Our server config.. `readConfig` will overwrite from watcharr.json cfg file.
 	Config = ServerConfig{}
+	// Guards the TASK_* maps in Config, tasks read them while running
+	// as the api changes them. No other lock may be taken while holding
+	// this one, and it mustn't be held when calling `writeConfig`.
+	taskConfigMu sync.RWMutex
 )
 
 // Read config file
@@ -178,12 +431,19 @@ func updateConfig(k string, v any) error {
 	} else {
 		return errors.New("invalid setting")
 	}
-	return writeConfig()
+	if err := writeConfig(); err != nil {
+		return err
+	}
+	// Jellyfin tasks are kept back until there is a host.
+	syncFeatureTasks()
+	return nil
 }
 
 // Write current Config to file
 func writeConfig() error {
+	taskConfigMu.RLock()
 	barej, err := json.MarshalIndent(Config, "", "\t")
+	taskConfigMu.RUnlock()
 	if err != nil {
 		return err
 	}
@@ -30,6 +30,7 @@ type Content struct {
 	TmdbID           int         `json:"tmdbId" gorm:"uniqueIndex:contentidtotypeidx;not null"`
 	Title            string      `json:"title"`
 	PosterPath       string      `json:"poster_path"`
+	BackdropPath     string      `json:"backdrop_path"`
 	Overview         string      `json:"overview"`
 	Type             ContentType `json:"type" gorm:"uniqueIndex:contentidtotypeidx;not null"`
 	ReleaseDate      *time.Time  `json:"release_date,omitempty"`
@@ -43,10 +44,19 @@ type Content struct {
 	Runtime          uint32      `json:"runtime"`
 	NumberOfEpisodes uint32      `json:"numberOfEpisodes"`
 	NumberOfSeasons  uint32      `json:"numberOfSeasons"`
+	// Where it can be streamed, kept up to date by the Refresh Watch Providers task.
+	WatchProviders *ContentWatchProviders `json:"watchProviders,omitempty" gorm:"foreignKey:ContentID"`
+	// Collection it belongs to, kept up to date by the Sync Collections task.
+	Collection *ContentCollection `json:"collection,omitempty" gorm:"foreignKey:ContentID"`
+	// Average rating across users, kept up to date by the Recompute Ratings task.
+	Rating *ContentRating `json:"rating,omitempty" gorm:"foreignKey:ContentID"`
+	// When the Backfill Images task last tried to fetch its images.
+	ImagesBackfilledAt *time.Time `json:"-"`
 }
 
 // onlyUpdate - If we should only update existing row if exists, or false to create/update if not exist.
-func saveContent(db *gorm.DB, c *Content, onlyUpdate bool) error {
+// task - Task saving the content, empty if not a task. Its poster is downloaded for it.
+func saveContent(task string, db *gorm.DB, c *Content, onlyUpdate bool) error {
 	slog.Info("Saving content to db", "id", c.TmdbID, "title", c.Title)
 	if c.TmdbID == 0 || c.Title == "" || c.Type == "" {
 		slog.Error("saveContent: content missing id, title or type!", "id", c.TmdbID, "title", c.Title, "type", c.Type)
@@ -67,6 +77,7 @@ func saveContent(db *gorm.DB, c *Content, onlyUpdate bool) error {
 			DoUpdates: clause.AssignmentColumns([]string{
 				"title",
 				"poster_path",
+				"backdrop_path",
 				"overview",
 				"release_date",
 				"popularity",
@@ -92,15 +103,36 @@ func saveContent(db *gorm.DB, c *Content, onlyUpdate bool) error {
 	// If row created, download the image
 	if res.RowsAffected > 0 {
 		slog.Debug("saveContent: Downloading poster.")
-		err := download("https://image.tmdb.org/t/p/w500"+c.PosterPath, path.Join(DataPath, "img", c.PosterPath), false)
+		err := downloadPosterFor(task, c.PosterPath, false)
 		if err != nil {
-			slog.Error("saveContent: Failed to download content image!", "error", err.Error())
+			slog.Error("saveContent: Failed to download content image! Queued to retry later.", "error", err.Error())
+			enqueueTask(db, "download_poster", map[string]string{"posterPath": c.PosterPath})
 		}
 	}
 	return nil
 }
 
-func cacheContentTv(db *gorm.DB, content TMDBShowDetails, onlyUpdate bool) (Content, error) {
+// Where a tmdb poster is cached in our img dir.
+func posterCachePath(posterPath string) string {
+	return path.Join(DataPath, "img", posterPath)
+}
+
+// Download a tmdb poster into our img dir.
+// Unless `force`, nothing is done if it is already cached.
+func downloadPoster(posterPath string, force bool) error {
+	return downloadPosterFor("", posterPath, force)
+}
+
+// Like `downloadPoster`, for task `task` (see `waitTMDBImageQuota`).
+func downloadPosterFor(task string, posterPath string, force bool) error {
+	outf := posterCachePath(posterPath)
+	if err := waitTMDBImageQuota(task, outf, force); err != nil {
+		return err
+	}
+	return download(tmdbImageBase+"w500"+posterPath, outf, force)
+}
+
+func cacheContentTv(task string, db *gorm.DB, content TMDBShowDetails, onlyUpdate bool) (Content, error) {
 	slog.Debug("cacheContentTv", "content", content)
 	var (
 		releaseDate time.Time
@@ -120,6 +152,7 @@ func cacheContentTv(db *gorm.DB, content TMDBShowDetails, onlyUpdate bool) (Cont
 		Title:            content.Name,
 		Overview:         content.Overview,
 		PosterPath:       content.PosterPath,
+		BackdropPath:     content.BackdropPath,
 		Type:             SHOW,
 		ReleaseDate:      &releaseDate,
 		Popularity:       content.Popularity,
@@ -131,7 +164,7 @@ func cacheContentTv(db *gorm.DB, content TMDBShowDetails, onlyUpdate bool) (Cont
 		NumberOfSeasons:  content.NumberOfSeasons,
 	}
 
-	err = saveContent(db, &c, onlyUpdate)
+	err = saveContent(task, db, &c, onlyUpdate)
 	if err != nil {
 		slog.Error("cacheContentTv: Failed to save content!", "error", err)
 		return Content{}, errors.New("failed to save content")
@@ -140,7 +173,7 @@ func cacheContentTv(db *gorm.DB, content TMDBShowDetails, onlyUpdate bool) (Cont
 	return c, nil
 }
 
-func cacheContentMovie(db *gorm.DB, content TMDBMovieDetails, onlyUpdate bool) (Content, error) {
+func cacheContentMovie(task string, db *gorm.DB, content TMDBMovieDetails, onlyUpdate bool) (Content, error) {
 	var (
 		releaseDate time.Time
 	)
@@ -152,23 +185,24 @@ func cacheContentMovie(db *gorm.DB, content TMDBMovieDetails, onlyUpdate bool) (
 	}
 
 	c := Content{
-		TmdbID:      content.ID,
-		Title:       content.Title,
-		Overview:    content.Overview,
-		PosterPath:  content.PosterPath,
-		Type:        MOVIE,
-		ReleaseDate: &releaseDate,
-		Popularity:  content.Popularity,
-		VoteAverage: content.VoteAverage,
-		VoteCount:   content.VoteCount,
-		ImdbID:      content.ImdbID,
-		Status:      content.Status,
-		Budget:      content.Budget,
-		Revenue:     content.Revenue,
-		Runtime:     content.Runtime,
-	}
-
-	err = saveContent(db, &c, onlyUpdate)
+		TmdbID:       content.ID,
+		Title:        content.Title,
+		Overview:     content.Overview,
+		PosterPath:   content.PosterPath,
+		BackdropPath: content.BackdropPath,
+		Type:         MOVIE,
+		ReleaseDate:  &releaseDate,
+		Popularity:   content.Popularity,
+		VoteAverage:  content.VoteAverage,
+		VoteCount:    content.VoteCount,
+		ImdbID:       content.ImdbID,
+		Status:       content.Status,
+		Budget:       content.Budget,
+		Revenue:      content.Revenue,
+		Runtime:      content.Runtime,
+	}
+
+	err = saveContent(task, db, &c, onlyUpdate)
 	if err != nil {
 		slog.Error("cacheContentMovie: Failed to save content!", "error", err)
 		return Content{}, errors.New("failed to save content")
@@ -179,6 +213,11 @@ func cacheContentMovie(db *gorm.DB, content TMDBMovieDetails, onlyUpdate bool) (
 
 // Get content from our cache, or cache it if it doesn't exist.
 func getOrCacheContent(db *gorm.DB, contentType ContentType, tmdbId int) (Content, error) {
+	return getOrCacheContentFor("", db, contentType, tmdbId)
+}
+
+// Like `getOrCacheContent`, for task `task`. Its tmdb requests are task requests.
+func getOrCacheContentFor(task string, db *gorm.DB, contentType ContentType, tmdbId int) (Content, error) {
 	var content Content
 	// Look in db for content.
 	db.Where("type = ? AND tmdb_id = ?", contentType, tmdbId).Find(&content)
@@ -186,7 +225,7 @@ func getOrCacheContent(db *gorm.DB, contentType ContentType, tmdbId int) (Conten
 	if content == (Content{}) {
 		slog.Debug("Content not in db, fetching...", "type", contentType, "tmdbId", tmdbId)
 
-		resp, err := tmdbAPIRequest("/"+string(contentType)+"/"+strconv.Itoa(tmdbId), map[string]string{})
+		resp, err := tmdbAPIRequestFor(task, "/"+string(contentType)+"/"+strconv.Itoa(tmdbId), map[string]string{})
 		if err != nil {
 			slog.Error("getOrCacheContent: content tmdb api request failed", "error", err)
 			return Content{}, errors.New("failed to find requested media")
@@ -199,7 +238,7 @@ func getOrCacheContent(db *gorm.DB, contentType ContentType, tmdbId int) (Conten
 				slog.Error("Failed to unmarshal movie details", "error", err)
 				return Content{}, errors.New("failed to process movie details response")
 			}
-			content, err = cacheContentMovie(db, *c, false)
+			content, err = cacheContentMovie(task, db, *c, false)
 			if err != nil {
 				slog.Error("getOrCacheContent: failed to cache movie content", "type", contentType, "content_id", tmdbId, "err", err)
 				return Content{}, errors.New("failed to cache content")
@@ -211,7 +250,7 @@ func getOrCacheContent(db *gorm.DB, contentType ContentType, tmdbId int) (Conten
 				slog.Error("Failed to unmarshal tv details", "error", err)
 				return Content{}, errors.New("failed to process tv details response")
 			}
-			content, err = cacheContentTv(db, *c, false)
+			content, err = cacheContentTv(task, db, *c, false)
 			if err != nil {
 				slog.Error("getOrCacheContent: failed to cache tv content", "type", contentType, "content_id", tmdbId, "err", err)
 				return Content{}, errors.New("failed to cache content")
@@ -246,11 +285,16 @@ func transformProviders(c *interface{}, country string) {
 }
 
 func searchContent(query string, pageNum int) (TMDBSearchMultiResponse, error) {
+	return searchContentFor("", query, pageNum)
+}
+
+// Like `searchContent`, for task `task`.
+func searchContentFor(task string, query string, pageNum int) (TMDBSearchMultiResponse, error) {
 	resp := new(TMDBSearchMultiResponse)
 	if pageNum == 0 {
 		pageNum = 1
 	}
-	err := tmdbRequest("/search/multi", map[string]string{"query": query, "page": strconv.Itoa(pageNum)}, &resp)
+	err := tmdbRequestFor(task, "/search/multi", map[string]string{"query": query, "page": strconv.Itoa(pageNum)}, &resp)
 	if err != nil {
 		slog.Error("Failed to complete multi search request!", "error", err.Error())
 		return TMDBSearchMultiResponse{}, errors.New("failed to complete multi search request")
@@ -309,11 +353,16 @@ func searchPeople(query string, pageNum int) (TMDBSearchPeopleResponse, error) {
 // Search for content by an external id (imdb, etc).
 // Defaults to imdb if no source if provided (probably most common).
 func searchByExternalId(id string, source string) (TMDBSearchMultiResponse, error) {
+	return searchByExternalIdFor("", id, source)
+}
+
+// Like `searchByExternalId`, for task `task`.
+func searchByExternalIdFor(task string, id string, source string) (TMDBSearchMultiResponse, error) {
 	resp := new(TMDBFindByExternalIdResponse)
 	if source == "" {
 		source = "imdb"
 	}
-	err := tmdbRequest("/find/"+id, map[string]string{"external_source": source + "_id"}, &resp)
+	err := tmdbRequestFor(task, "/find/"+id, map[string]string{"external_source": source + "_id"}, &resp)
 	if err != nil {
 		slog.Error("Failed to complete find/external_id request!", "error", err.Error())
 		return TMDBSearchMultiResponse{}, errors.New("failed to complete find/external_id request")
@@ -334,14 +383,19 @@ func searchByExternalId(id string, source string) (TMDBSearchMultiResponse, erro
 }
 
 func movieDetails(db *gorm.DB, id string, country string, rParams map[string]string) (TMDBMovieDetails, error) {
+	return movieDetailsFor("", db, id, country, rParams)
+}
+
+// Like `movieDetails`, for task `task`.
+func movieDetailsFor(task string, db *gorm.DB, id string, country string, rParams map[string]string) (TMDBMovieDetails, error) {
 	resp := new(TMDBMovieDetails)
-	err := tmdbRequest("/movie/"+id, rParams, &resp)
+	err := tmdbRequestFor(task, "/movie/"+id, rParams, &resp)
 	if err != nil {
 		slog.Error("Failed to complete movie details request!", "error", err.Error())
 		return TMDBMovieDetails{}, errors.New("failed to complete movie details request")
 	}
 	transformProviders(&resp.WatchProviders, country)
-	go cacheContentMovie(db, *resp, true)
+	go cacheContentMovie(task, db, *resp, true)
 	return *resp, nil
 }
 
@@ -356,14 +410,19 @@ func movieCredits(id string) (TMDBContentCredits, error) {
 }
 
 func tvDetails(db *gorm.DB, id string, country string, rParams map[string]string) (TMDBShowDetails, error) {
+	return tvDetailsFor("", db, id, country, rParams)
+}
+
+// Like `tvDetails`, for task `task`.
+func tvDetailsFor(task string, db *gorm.DB, id string, country string, rParams map[string]string) (TMDBShowDetails, error) {
 	resp := new(TMDBShowDetails)
-	err := tmdbRequest("/tv/"+id, rParams, &resp)
+	err := tmdbRequestFor(task, "/tv/"+id, rParams, &resp)
 	if err != nil {
 		slog.Error("Failed to complete tv details request!", "error", err.Error())
 		return TMDBShowDetails{}, errors.New("failed to complete tv details request")
 	}
 	transformProviders(&resp.WatchProviders, country)
-	go cacheContentTv(db, *resp, true)
+	go cacheContentTv(task, db, *resp, true)
 	return *resp, nil
 }
 
@@ -379,6 +438,17 @@ func tvCredits(id string) (TMDBContentCredits, error) {
 
 // This method is manually cached, so it can be easily used in other places (on the server) with cache benefits
 func seasonDetails(tvId string, seasonNumber string) (TMDBSeasonDetails, error) {
+	return seasonDetailsFor("", tvId, seasonNumber)
+}
+
+// Like `seasonDetails`, for task `task`. Its request (if not cached)
+// is a task request, see `tmdbTaskRequest`.
+func taskSeasonDetails(task string, tvId string, seasonNumber string) (TMDBSeasonDetails, error) {
+	return seasonDetailsFor(task, tvId, seasonNumber)
+}
+
+// Get season details for task `task`, or for a user if `task` is empty.
+func seasonDetailsFor(task string, tvId string, seasonNumber string) (TMDBSeasonDetails, error) {
 	var cacheKey = "contentstore-seasondetails-" + tvId + "-" + seasonNumber
 	resp := new(TMDBSeasonDetails)
 	if err := ContentStore.Get(cacheKey, &resp); err != nil {
@@ -389,7 +459,7 @@ func seasonDetails(tvId string, seasonNumber string) (TMDBSeasonDetails, error)
 		slog.Debug("seasonDetails: Returning cache.")
 		return *resp, nil
 	}
-	err := tmdbRequest("/tv/"+tvId+"/season/"+seasonNumber, map[string]string{}, &resp)
+	err := tmdbRequestFor(task, "/tv/"+tvId+"/season/"+seasonNumber, map[string]string{}, &resp)
 	if err != nil {
 		slog.Error("seasonDetails: Failed to complete season details request!", "error", err.Error())
 		return TMDBSeasonDetails{}, errors.New("failed to complete season details request")
@@ -420,7 +490,7 @@ func personCredits(id string) (TMDBPersonCombinedCredits, error) {
 	return *resp, nil
 }
 
-func discoverMovies() (TMDBDiscoverMovies, error) {
+func fetchDiscoverMovies() (TMDBDiscoverMovies, error) {
 	resp := new(TMDBDiscoverMovies)
 	err := tmdbRequest("/discover/movie", map[string]string{"page": "1"}, &resp)
 	if err != nil {
@@ -430,7 +500,7 @@ func discoverMovies() (TMDBDiscoverMovies, error) {
 	return *resp, nil
 }
 
-func discoverTv() (TMDBDiscoverShows, error) {
+func fetchDiscoverTv() (TMDBDiscoverShows, error) {
 	resp := new(TMDBDiscoverShows)
 	err := tmdbRequest("/discover/tv", map[string]string{"page": "1"}, &resp)
 	if err != nil {
@@ -440,7 +510,7 @@ func discoverTv() (TMDBDiscoverShows, error) {
 	return *resp, nil
 }
 
-func allTrending() (TMDBTrendingAll, error) {
+func fetchAllTrending() (TMDBTrendingAll, error) {
 	resp := new(TMDBTrendingAll)
 	err := tmdbRequest("/trending/all/day", map[string]string{}, &resp)
 	if err != nil {
@@ -450,7 +520,7 @@ func allTrending() (TMDBTrendingAll, error) {
 	return *resp, nil
 }
 
-func upcomingMovies() (TMDBUpcomingMovies, error) {
+func fetchUpcomingMovies() (TMDBUpcomingMovies, error) {
 	resp := new(TMDBUpcomingMovies)
 	err := tmdbRequest("/movie/upcoming", map[string]string{"page": "1"}, &resp)
 	if err != nil {
@@ -461,7 +531,7 @@ func upcomingMovies() (TMDBUpcomingMovies, error) {
 }
 
 // Theres no upcoming endpoint for tv ;( - using discover with future dates
-func upcomingTv() (TMDBUpcomingShows, error) {
+func fetchUpcomingTv() (TMDBUpcomingShows, error) {
 	resp := new(TMDBUpcomingShows)
 	dFmt := "2006-01-02"
 	mind := time.Now().Format(dFmt)
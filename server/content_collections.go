@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// How long stored collection membership (and collections) are kept
+	// before being refreshed. Collections rarely change, new parts are
+	// only added when a sequel is announced.
+	collectionsMaxAge = 30 * 24 * time.Hour
+	// Max movies checked per run, the rest are picked up next run.
+	collectionsMaxPerRun = 500
+	// Time between each request to tmdb, so we stay well under its rate limit.
+	collectionsRequestInterval = 250 * time.Millisecond
+)
+
+// A tmdb collection (franchise), eg. all movies of a series.
+type Collection struct {
+	// Tmdb id of the collection.
+	ID         int              `json:"id" gorm:"primaryKey;autoIncrement:false"`
+	Name       string           `json:"name"`
+	PosterPath string           `json:"posterPath"`
+	Parts      []CollectionPart `json:"parts" gorm:"serializer:json"`
+	UpdatedAt  time.Time        `json:"updatedAt"`
+}
+
+// A movie in a collection.
+type CollectionPart struct {
+	TmdbID      int    `json:"tmdbId"`
+	Title       string `json:"title"`
+	PosterPath  string `json:"posterPath"`
+	ReleaseDate string `json:"releaseDate"`
+}
+
+// Which collection a movie belongs to, stored even when it belongs to
+// none, so it isn't requested again until it is stale.
+type ContentCollection struct {
+	ContentID int `json:"-" gorm:"primaryKey;autoIncrement:false"`
+	// Tmdb id of the collection, 0 if the movie isn't in one.
+	CollectionID int       `json:"collectionId"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// A collection and which of its parts a user has on their watched list.
+type CollectionProgress struct {
+	Collection Collection `json:"collection"`
+	// Tmdb ids of parts on the users watched list.
+	Tracked []int `json:"tracked"`
+	// Tmdb ids of parts the user has finished.
+	Finished []int `json:"finished"`
+}
+
+// Fetch and store collection membership of tracked movies that have
+// none stored or haven't been refreshed for `collectionsMaxAge`, along
+// with the collections they belong to. Oldest first, so everything gets a turn.
+func syncCollections(db *gorm.DB) error {
+	var stale []Content
+	res := db.Model(&Content{}).
+		Joins("LEFT JOIN content_collections cc ON cc.content_id = contents.id").
+		Where("contents.type = ? AND contents.id IN (SELECT content_id FROM watcheds WHERE deleted_at IS NULL AND content_id IS NOT NULL)", MOVIE).
+		Where("cc.content_id IS NULL OR cc.updated_at < ?", time.Now().Add(-collectionsMaxAge)).
+		Order("cc.updated_at IS NOT NULL, cc.updated_at ASC").
+		Limit(collectionsMaxPerRun).
+		Select("contents.id", "contents.tmdb_id").
+		Find(&stale)
+	if res.Error != nil {
+		slog.Error("syncCollections: Failed to get movies to refresh", "error", res.Error)
+		return errors.New("failed to get movies to refresh")
+	}
+	var (
+		enriched int
+		synced   = map[int]bool{}
+		errs     []error
+	)
+	ticker := time.NewTicker(collectionsRequestInterval)
+	defer ticker.Stop()
+	for _, c := range stale {
+		<-ticker.C
+		var details TMDBMovieCollectionRef
+		if err := tmdbTaskRequest("sync_collections", "/movie/"+strconv.Itoa(c.TmdbID), map[string]string{}, &details); err != nil {
+			slog.Error("syncCollections: Failed to get movie details", "tmdb_id", c.TmdbID, "error", err)
+			// Not wrapped, request errors can include our api key.
+			errs = append(errs, fmt.Errorf("movie %d: request to tmdb failed", c.TmdbID))
+			continue
+		}
+		cc := ContentCollection{ContentID: c.ID}
+		if details.BelongsToCollection != nil {
+			cc.CollectionID = details.BelongsToCollection.ID
+		}
+		if cc.CollectionID != 0 && !synced[cc.CollectionID] {
+			<-ticker.C
+			if err := syncCollection(db, cc.CollectionID); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			synced[cc.CollectionID] = true
+		}
+		if err := db.Save(&cc).Error; err != nil {
+			slog.Error("syncCollections: Failed to save collection membership", "content_id", c.ID, "error", err)
+			errs = append(errs, err)
+			continue
+		}
+		if cc.CollectionID != 0 {
+			enriched++
+		}
+	}
+	setTaskSummary("sync_collections", map[string]any{
+		"checked":     len(stale),
+		"enriched":    enriched,
+		"collections": len(synced),
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to sync %d of %d movies: %w", len(errs), len(stale), errors.Join(errs...))
+	}
+	return nil
+}
+
+// Fetch and store a collection (and its parts) by tmdb id.
+func syncCollection(db *gorm.DB, id int) error {
+	var details TMDBCollectionDetails
+	if err := tmdbTaskRequest("sync_collections", "/collection/"+strconv.Itoa(id), map[string]string{}, &details); err != nil {
+		slog.Error("syncCollection: Failed to get collection details", "collection_id", id, "error", err)
+		return fmt.Errorf("collection %d: request to tmdb failed", id)
+	}
+	col := Collection{ID: id, Name: details.Name, PosterPath: details.PosterPath, Parts: []CollectionPart{}}
+	for _, p := range details.Parts {
+		col.Parts = append(col.Parts, CollectionPart{TmdbID: p.ID, Title: p.Title, PosterPath: p.PosterPath, ReleaseDate: p.ReleaseDate})
+	}
+	if err := db.Save(&col).Error; err != nil {
+		slog.Error("syncCollection: Failed to save collection", "collection_id", id, "error", err)
+		return errors.New("failed to save collection")
+	}
+	return nil
+}
+
+// Get a stored collection, along with which of its parts a user tracks.
+func getCollectionProgress(db *gorm.DB, userId uint, id int) (CollectionProgress, error) {
+	var col Collection
+	res := db.Where("id = ?", id).Find(&col)
+	if res.Error != nil {
+		slog.Error("getCollectionProgress: Failed to get collection", "collection_id", id, "error", res.Error)
+		return CollectionProgress{}, errors.New("failed to get collection")
+	}
+	if res.RowsAffected == 0 {
+		return CollectionProgress{}, errors.New("collection not found")
+	}
+	ids := make([]int, len(col.Parts))
+	for i, p := range col.Parts {
+		ids[i] = p.TmdbID
+	}
+	var rows []struct {
+		TmdbID int
+		Status WatchedStatus
+	}
+	res = db.Model(&Watched{}).
+		Joins("JOIN contents ON contents.id = watcheds.content_id").
+		Where("watcheds.user_id = ? AND contents.type = ? AND contents.tmdb_id IN ?", userId, MOVIE, ids).
+		Select("contents.tmdb_id", "watcheds.status").
+		Scan(&rows)
+	if res.Error != nil {
+		slog.Error("getCollectionProgress: Failed to get users watched parts", "collection_id", id, "error", res.Error)
+		return CollectionProgress{}, errors.New("failed to get watched parts")
+	}
+	p := CollectionProgress{Collection: col, Tracked: []int{}, Finished: []int{}}
+	for _, r := range rows {
+		p.Tracked = append(p.Tracked, r.TmdbID)
+		if r.Status == FINISHED {
+			p.Finished = append(p.Finished, r.TmdbID)
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestSyncCollections(t *testing.T) {
+	useTestConfig(t)
+	useTestTMDBLimiter(t)
+	var (
+		requests []string
+		mu       sync.Mutex
+	)
+	useTestTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/3/movie/901", "/3/movie/902":
+			w.Write([]byte(`{"belongs_to_collection":{"id":10}}`))
+		case "/3/movie/903":
+			w.Write([]byte(`{"belongs_to_collection":null}`))
+		case "/3/collection/10":
+			w.Write([]byte(`{"id":10,"name":"Test Collection","parts":[{"id":901,"title":"One"},{"id":902,"title":"Two"},{"id":904,"title":"Three"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	db := newTestDb(t)
+	user := User{Username: "collector"}
+	db.Create(&user)
+	track := func(c Content, status WatchedStatus) {
+		db.Create(&c)
+		db.Create(&Watched{UserID: user.ID, ContentID: &c.ID, Status: status})
+	}
+	track(Content{TmdbID: 901, Title: "One", Type: MOVIE}, FINISHED)
+	track(Content{TmdbID: 902, Title: "Two", Type: MOVIE}, PLANNED)
+	track(Content{TmdbID: 903, Title: "Alone", Type: MOVIE}, FINISHED)
+	track(Content{TmdbID: 905, Title: "Show", Type: SHOW}, FINISHED)
+
+	if err := syncCollections(db); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	want := map[string]any{"checked": 3, "enriched": 2, "collections": 1}
+	if s := getTaskStatus("sync_collections").Summary; !reflect.DeepEqual(s, want) {
+		t.Errorf("got summary %v, want %v", s, want)
+	}
+	p, err := getCollectionProgress(db, user.ID, 10)
+	if err != nil {
+		t.Fatalf("failed to get collection progress: %v", err)
+	}
+	slices.Sort(p.Tracked)
+	if p.Collection.Name != "Test Collection" || len(p.Collection.Parts) != 3 {
+		t.Errorf("got collection %+v, want it stored with its 3 parts", p.Collection)
+	}
+	if !reflect.DeepEqual(p.Tracked, []int{901, 902}) || !reflect.DeepEqual(p.Finished, []int{901}) {
+		t.Errorf("got %v tracked and %v finished, want 2 tracked and 1 finished", p.Tracked, p.Finished)
+	}
+
+	// Nothing is stale now.
+	if err := syncCollections(db); err != nil {
+		t.Fatalf("second sync failed: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 4 {
+		t.Errorf("got requests %q, want each movie and the collection once", requests)
+	}
+}
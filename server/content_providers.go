@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// How long stored watch providers are kept before being refreshed.
+	watchProvidersMaxAge = 7 * 24 * time.Hour
+	// Max items refreshed per run, the rest are picked up next run.
+	watchProvidersMaxPerRun = 500
+	// Time between each request to tmdb, so we stay well under its rate limit.
+	watchProvidersRequestInterval = 250 * time.Millisecond
+)
+
+// Where content can be streamed (in one region), so lists can
+// show it without requesting it from tmdb for every item.
+type ContentWatchProviders struct {
+	ContentID int    `json:"-" gorm:"primaryKey;autoIncrement:false"`
+	Region    string `json:"region"`
+	// Services it can be streamed on (tmdb `flatrate` and `free`).
+	// Empty if tmdb has no providers for it in Region.
+	Providers []WatchProvider `json:"providers" gorm:"serializer:json"`
+	// Tmdb page listing all ways to watch it.
+	Link      string    `json:"link,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Region watch providers are stored for.
+func getWatchProvidersRegion() string {
+	if Config.TASK_WATCH_PROVIDERS_REGION != "" {
+		return Config.TASK_WATCH_PROVIDERS_REGION
+	}
+	if Config.DEFAULT_COUNTRY != "" {
+		return Config.DEFAULT_COUNTRY
+	}
+	return "US"
+}
+
+// Fetch and store watch providers of tracked content that has none
+// stored, has them for another region or hasn't been refreshed for
+// `watchProvidersMaxAge`. Oldest first, so everything gets a turn.
+func refreshWatchProviders(db *gorm.DB) error {
+	region := getWatchProvidersRegion()
+	var stale []Content
+	res := db.Model(&Content{}).
+		Joins("LEFT JOIN content_watch_providers p ON p.content_id = contents.id").
+		Where("contents.type IN ? AND contents.id IN (SELECT content_id FROM watcheds WHERE deleted_at IS NULL AND content_id IS NOT NULL)", []ContentType{MOVIE, SHOW}).
+		Where("p.content_id IS NULL OR p.region != ? OR p.updated_at < ?", region, time.Now().Add(-watchProvidersMaxAge)).
+		Order("p.updated_at IS NOT NULL, p.updated_at ASC").
+		Limit(watchProvidersMaxPerRun).
+		Select("contents.id", "contents.tmdb_id", "contents.type").
+		Find(&stale)
+	if res.Error != nil {
+		slog.Error("refreshWatchProviders: Failed to get content to refresh", "error", res.Error)
+		return errors.New("failed to get content to refresh")
+	}
+	var (
+		updated     int
+		noProviders int
+		errs        []error
+	)
+	ticker := time.NewTicker(watchProvidersRequestInterval)
+	defer ticker.Stop()
+	for _, c := range stale {
+		<-ticker.C
+		var resp TMDBWatchProviders
+		if err := tmdbTaskRequest("refresh_watch_providers", "/"+string(c.Type)+"/"+strconv.Itoa(c.TmdbID)+"/watch/providers", map[string]string{}, &resp); err != nil {
+			slog.Error("refreshWatchProviders: Failed to get watch providers", "tmdb_id", c.TmdbID, "type", c.Type, "error", err)
+			// Not wrapped, request errors can include our api key.
+			errs = append(errs, fmt.Errorf("%s %d: request to tmdb failed", c.Type, c.TmdbID))
+			continue
+		}
+		wp := ContentWatchProviders{ContentID: c.ID, Region: region, Providers: []WatchProvider{}}
+		if r, ok := resp.Results[region]; ok {
+			wp.Link = r.Link
+			wp.Providers = append(append(wp.Providers, r.Flatrate...), r.Free...)
+		}
+		if len(wp.Providers) == 0 {
+			// Still stored, so it isn't requested again until it is stale.
+			noProviders++
+		}
+		if err := db.Save(&wp).Error; err != nil {
+			slog.Error("refreshWatchProviders: Failed to save watch providers", "content_id", c.ID, "error", err)
+			errs = append(errs, err)
+			continue
+		}
+		updated++
+	}
+	setTaskSummary("refresh_watch_providers", map[string]any{
+		"region":      region,
+		"checked":     len(stale),
+		"updated":     updated,
+		"noProviders": noProviders,
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to refresh %d of %d items: %w", len(errs), len(stale), errors.Join(errs...))
+	}
+	return nil
+}
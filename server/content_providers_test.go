@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRefreshWatchProviders(t *testing.T) {
+	useTestConfig(t)
+	useTestTMDBLimiter(t)
+	var (
+		requests []string
+		mu       sync.Mutex
+	)
+	useTestTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/3/movie/601/watch/providers":
+			w.Write([]byte(`{"id":601,"results":{"US":{"link":"https://tmdb/601","flatrate":[{"provider_id":8,"provider_name":"Netflix"}],"free":[{"provider_id":73,"provider_name":"Tubi"}],"rent":[{"provider_id":2,"provider_name":"Apple TV"}]}}}`))
+		case "/3/tv/602/watch/providers":
+			// Only available in another region.
+			w.Write([]byte(`{"id":602,"results":{"GB":{"flatrate":[{"provider_id":8,"provider_name":"Netflix"}]}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	db := newTestDb(t)
+	user := User{Username: "providers"}
+	db.Create(&user)
+	track := func(c Content) Content {
+		db.Create(&c)
+		db.Create(&Watched{UserID: user.ID, ContentID: &c.ID, Status: PLANNED})
+		return c
+	}
+	movie := track(Content{TmdbID: 601, Title: "Streaming Movie", Type: MOVIE})
+	show := track(Content{TmdbID: 602, Title: "Elsewhere Show", Type: SHOW})
+	fresh := track(Content{TmdbID: 603, Title: "Fresh Movie", Type: MOVIE})
+	db.Create(&ContentWatchProviders{ContentID: fresh.ID, Region: "US", Providers: []WatchProvider{}, UpdatedAt: time.Now()})
+
+	if err := refreshWatchProviders(db); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	want := map[string]any{"region": "US", "checked": 2, "updated": 2, "noProviders": 1}
+	if s := getTaskStatus("refresh_watch_providers").Summary; !reflect.DeepEqual(s, want) {
+		t.Errorf("got summary %v, want %v", s, want)
+	}
+	var wp ContentWatchProviders
+	if err := db.Take(&wp, movie.ID).Error; err != nil {
+		t.Fatalf("movie has no watch providers stored: %v", err)
+	}
+	wantProviders := []WatchProvider{{ProviderID: 8, ProviderName: "Netflix"}, {ProviderID: 73, ProviderName: "Tubi"}}
+	if !reflect.DeepEqual(wp.Providers, wantProviders) || wp.Link != "https://tmdb/601" {
+		t.Errorf("got providers %+v at %q, want the streaming ones %+v", wp.Providers, wp.Link, wantProviders)
+	}
+	var none ContentWatchProviders
+	if err := db.Take(&none, show.ID).Error; err != nil {
+		t.Fatalf("show with no providers in the region wasn't stored: %v", err)
+	}
+	if len(none.Providers) != 0 {
+		t.Errorf("got providers %+v for the show, want none in US", none.Providers)
+	}
+
+	// Nothing is stale now.
+	if err := refreshWatchProviders(db); err != nil {
+		t.Fatalf("second refresh failed: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 2 {
+		t.Errorf("got requests %q, want only the 2 stale items once", requests)
+	}
+}
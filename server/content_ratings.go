@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Average rating of content across all users, kept up to date by
+// the Recompute Ratings task so it doesn't have to be worked out
+// every time it is shown.
+type ContentRating struct {
+	ContentID int `json:"-" gorm:"primaryKey;autoIncrement:false"`
+	// Average of all ratings (out of 10).
+	Average float64 `json:"average"`
+	// Number of users that have rated it.
+	Count     int       `json:"count"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Recalculate the average rating (and number of ratings) of all rated
+// content from users watched lists. Unrated entries (rating 0) and lists
+// of private users aren't counted. Content that has lost all of its
+// ratings since the last run has its stored rating removed.
+// Ratings are read from `readDb` (see TASK_READ_DB), saved to `db`.
+func recomputeRatings(db *gorm.DB, readDb *gorm.DB) error {
+	var computed []ContentRating
+	res := readDb.Model(&Watched{}).
+		Joins("JOIN users u ON u.id = watcheds.user_id").
+		Where("watcheds.content_id IS NOT NULL AND watcheds.rating > 0").
+		Where("u.private IS NULL OR u.private = 0").
+		Group("watcheds.content_id").
+		Select("watcheds.content_id AS content_id", "AVG(watcheds.rating) AS average", "COUNT(*) AS count").
+		Find(&computed)
+	if res.Error != nil {
+		slog.Error("recomputeRatings: Failed to compute ratings", "error", res.Error)
+		return errors.New("failed to compute ratings")
+	}
+	var stored []ContentRating
+	if res := db.Find(&stored); res.Error != nil {
+		slog.Error("recomputeRatings: Failed to get stored ratings", "error", res.Error)
+		return errors.New("failed to get stored ratings")
+	}
+	existing := map[int]ContentRating{}
+	for _, r := range stored {
+		existing[r.ContentID] = r
+	}
+	var changed []ContentRating
+	for _, r := range computed {
+		if e, ok := existing[r.ContentID]; ok {
+			delete(existing, r.ContentID)
+			if e.Average == r.Average && e.Count == r.Count {
+				continue
+			}
+		}
+		changed = append(changed, r)
+	}
+	// Whatever is left no longer has any ratings.
+	removed := make([]int, 0, len(existing))
+	for id := range existing {
+		removed = append(removed, id)
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if len(changed) > 0 {
+			res := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "content_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"average", "count", "updated_at"}),
+			}).CreateInBatches(&changed, 500)
+			if res.Error != nil {
+				return res.Error
+			}
+		}
+		if len(removed) > 0 {
+			if res := tx.Where("content_id IN ?", removed).Delete(&ContentRating{}); res.Error != nil {
+				return res.Error
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("recomputeRatings: Failed to save ratings", "error", err)
+		return errors.New("failed to save ratings")
+	}
+	setTaskSummary("recompute_ratings", map[string]any{
+		"rated":   len(computed),
+		"updated": len(changed),
+		"removed": len(removed),
+	})
+	return nil
+}
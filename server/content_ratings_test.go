@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// Stored ratings by content id, without when they were updated.
+func getTestContentRatings(t *testing.T, db *gorm.DB) map[int]ContentRating {
+	t.Helper()
+	var stored []ContentRating
+	if err := db.Find(&stored).Error; err != nil {
+		t.Fatalf("failed to get stored ratings: %v", err)
+	}
+	ratings := map[int]ContentRating{}
+	for _, r := range stored {
+		ratings[r.ContentID] = ContentRating{ContentID: r.ContentID, Average: r.Average, Count: r.Count}
+	}
+	return ratings
+}
+
+func TestRecomputeRatings(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	var content []Content
+	for i := 1; i <= 3; i++ {
+		c := Content{TmdbID: 1100 + i, Title: "Movie", Type: MOVIE}
+		db.Create(&c)
+		content = append(content, c)
+	}
+	user := func(name string, private bool) User {
+		u := User{Username: name, UserSettings: UserSettings{Private: &private}}
+		db.Create(&u)
+		return u
+	}
+	rate := func(u User, c Content, rating float64) Watched {
+		w := Watched{UserID: u.ID, ContentID: &c.ID, Status: FINISHED, Rating: rating}
+		db.Create(&w)
+		return w
+	}
+	alice := user("alice", false)
+	bob := user("bob", false)
+	carol := user("carol", true)
+	rate(alice, content[0], 8)
+	aliceSecond := rate(alice, content[1], 6)
+	rate(bob, content[0], 6)
+	// Unrated.
+	rate(bob, content[1], 0)
+	// Private lists aren't counted.
+	rate(carol, content[0], 10)
+
+	if err := recomputeRatings(db, db); err != nil {
+		t.Fatalf("recompute failed: %v", err)
+	}
+	want := map[int]ContentRating{
+		content[0].ID: {ContentID: content[0].ID, Average: 7, Count: 2},
+		content[1].ID: {ContentID: content[1].ID, Average: 6, Count: 1},
+	}
+	if got := getTestContentRatings(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("got ratings %+v, want %+v", got, want)
+	}
+	if s := getTaskStatus("recompute_ratings").Summary; !reflect.DeepEqual(s, map[string]any{"rated": 2, "updated": 2, "removed": 0}) {
+		t.Errorf("got summary %v, want 2 rated and updated", s)
+	}
+
+	// Second movie loses its only rating, the third gains one.
+	db.Model(&aliceSecond).Update("rating", 0)
+	rate(bob, content[2], 9)
+	if err := recomputeRatings(db, db); err != nil {
+		t.Fatalf("second recompute failed: %v", err)
+	}
+	want = map[int]ContentRating{
+		content[0].ID: {ContentID: content[0].ID, Average: 7, Count: 2},
+		content[2].ID: {ContentID: content[2].ID, Average: 9, Count: 1},
+	}
+	if got := getTestContentRatings(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("got ratings %+v after ratings changed, want %+v", got, want)
+	}
+	if s := getTaskStatus("recompute_ratings").Summary; !reflect.DeepEqual(s, map[string]any{"rated": 2, "updated": 1, "removed": 1}) {
+		t.Errorf("got summary %v, want 1 updated and 1 removed", s)
+	}
+}
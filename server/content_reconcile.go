@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// Tmdb statuses of shows that won't get any new seasons/episodes.
+var showStatusesEnded = []string{"Ended", "Canceled"}
+
+// Refresh season/episode totals (and status) of shows users have on
+// their watched list, so new seasons are picked up and progress stays
+// accurate. Ended shows are skipped once their totals are known, they
+// aren't getting any more episodes, so checking them wastes api calls.
+func reconcileShowCounts(db *gorm.DB) error {
+	var shows []Content
+	res := db.Model(&Content{}).
+		Where("type = ? AND id IN (SELECT content_id FROM watcheds WHERE deleted_at IS NULL AND content_id IS NOT NULL)", SHOW).
+		Find(&shows)
+	if res.Error != nil {
+		slog.Error("reconcileShowCounts: Failed to get tracked shows", "error", res.Error)
+		return errors.New("failed to get tracked shows")
+	}
+	var (
+		checked int
+		skipped int
+		updated int
+		errs    []error
+	)
+	for _, c := range shows {
+		if c.NumberOfSeasons > 0 && isShowEnded(c.Status) {
+			skipped++
+			continue
+		}
+		checked++
+		var details TMDBShowDetails
+		if err := tmdbTaskRequest("reconcile_show_counts", "/tv/"+strconv.Itoa(c.TmdbID), map[string]string{}, &details); err != nil {
+			slog.Error("reconcileShowCounts: Failed to get show details", "tmdb_id", c.TmdbID, "error", err)
+			// Not wrapped, request errors can include our api key.
+			errs = append(errs, fmt.Errorf("show %d: request to tmdb failed", c.TmdbID))
+			continue
+		}
+		if details.NumberOfSeasons == c.NumberOfSeasons && details.NumberOfEpisodes == c.NumberOfEpisodes && details.Status == c.Status {
+			continue
+		}
+		res := db.Model(&Content{}).Where("id = ?", c.ID).
+			Select("number_of_seasons", "number_of_episodes", "status").
+			Updates(Content{NumberOfSeasons: details.NumberOfSeasons, NumberOfEpisodes: details.NumberOfEpisodes, Status: details.Status})
+		if res.Error != nil {
+			slog.Error("reconcileShowCounts: Failed to update show", "tmdb_id", c.TmdbID, "error", res.Error)
+			errs = append(errs, res.Error)
+			continue
+		}
+		slog.Debug("reconcileShowCounts: Updated show.", "tmdb_id", c.TmdbID, "title", c.Title,
+			"seasons", details.NumberOfSeasons, "episodes", details.NumberOfEpisodes, "status", details.Status)
+		updated++
+	}
+	setTaskSummary("reconcile_show_counts", map[string]any{"checked": checked, "skippedEnded": skipped, "updated": updated})
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to reconcile %d of %d shows: %w", len(errs), checked, errors.Join(errs...))
+	}
+	return nil
+}
+
+func isShowEnded(status string) bool {
+	for _, s := range showStatusesEnded {
+		if status == s {
+			return true
+		}
+	}
+	return false
+}
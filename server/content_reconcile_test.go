@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestReconcileShowCountsNewSeason(t *testing.T) {
+	useTestConfig(t)
+	useTestTMDBLimiter(t)
+	var (
+		requests []string
+		mu       sync.Mutex
+	)
+	useTestTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/3/tv/501":
+			// Got a new season.
+			w.Write([]byte(`{"status":"Returning Series","number_of_seasons":3,"number_of_episodes":30}`))
+		case "/3/tv/502":
+			w.Write([]byte(`{"status":"Returning Series","number_of_seasons":1,"number_of_episodes":8}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	db := newTestDb(t)
+	user := User{Username: "user"}
+	db.Create(&user)
+	grown := Content{TmdbID: 501, Title: "Growing Show", Type: SHOW, Status: "Returning Series", NumberOfSeasons: 2, NumberOfEpisodes: 20}
+	same := Content{TmdbID: 502, Title: "Same Show", Type: SHOW, Status: "Returning Series", NumberOfSeasons: 1, NumberOfEpisodes: 8}
+	ended := Content{TmdbID: 503, Title: "Ended Show", Type: SHOW, Status: "Ended", NumberOfSeasons: 4, NumberOfEpisodes: 40}
+	untracked := Content{TmdbID: 504, Title: "Untracked Show", Type: SHOW, Status: "Returning Series", NumberOfSeasons: 1}
+	for _, c := range []*Content{&grown, &same, &ended, &untracked} {
+		db.Create(c)
+	}
+	for _, c := range []Content{grown, same, ended} {
+		db.Create(&Watched{UserID: user.ID, ContentID: &c.ID, Status: WATCHING})
+	}
+
+	if err := reconcileShowCounts(db); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	mu.Lock()
+	if want := []string{"/3/tv/501", "/3/tv/502"}; !reflect.DeepEqual(requests, want) {
+		t.Errorf("requested %q, want only tracked shows that haven't ended %q", requests, want)
+	}
+	mu.Unlock()
+	var got Content
+	db.First(&got, grown.ID)
+	if got.NumberOfSeasons != 3 || got.NumberOfEpisodes != 30 {
+		t.Errorf("show has %d seasons and %d episodes, want 3 and 30", got.NumberOfSeasons, got.NumberOfEpisodes)
+	}
+	var gotEnded Content
+	db.First(&gotEnded, ended.ID)
+	if gotEnded.NumberOfSeasons != 4 || gotEnded.NumberOfEpisodes != 40 {
+		t.Errorf("ended show changed to %d seasons and %d episodes", gotEnded.NumberOfSeasons, gotEnded.NumberOfEpisodes)
+	}
+	want := map[string]any{"checked": 2, "skippedEnded": 1, "updated": 1}
+	if s := getTaskStatus("reconcile_show_counts").Summary; !reflect.DeepEqual(s, want) {
+		t.Errorf("got summary %v, want %v", s, want)
+	}
+}
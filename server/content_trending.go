@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/cache/persistence"
+)
+
+const taskIdWarmTrendingCache = "warm_trending_cache"
+
+// How long trending/discover results are cached for. Much longer
+// than the Warm Trending Cache tasks default schedule, so results
+// don't expire (causing a slow page load) between warm ups.
+const trendingCacheExp = 24 * time.Hour
+
+var (
+	// When each trending cache key was last filled.
+	trendingCacheUpdated   = map[string]time.Time{}
+	trendingCacheUpdatedMu sync.Mutex
+)
+
+// Cache keys of trending/discover lists shown on the home page.
+const (
+	trendingKeyDiscoverMovies = "contentstore-discover-movies"
+	trendingKeyDiscoverTv     = "contentstore-discover-tv"
+	trendingKeyAll            = "contentstore-trending-all"
+	trendingKeyUpcomingMovies = "contentstore-upcoming-movies"
+	trendingKeyUpcomingTv     = "contentstore-upcoming-tv"
+)
+
+// Funcs to refresh each trending/discover list, keyed by cache key.
+var trendingCaches = map[string]func(cacheKey string) error{
+	trendingKeyDiscoverMovies: trendingWarmer(fetchDiscoverMovies),
+	trendingKeyDiscoverTv:     trendingWarmer(fetchDiscoverTv),
+	trendingKeyAll:            trendingWarmer(fetchAllTrending),
+	trendingKeyUpcomingMovies: trendingWarmer(fetchUpcomingMovies),
+	trendingKeyUpcomingTv:     trendingWarmer(fetchUpcomingTv),
+}
+
+func discoverMovies() (TMDBDiscoverMovies, error) {
+	return getTrendingCached(trendingKeyDiscoverMovies, fetchDiscoverMovies)
+}
+
+func discoverTv() (TMDBDiscoverShows, error) {
+	return getTrendingCached(trendingKeyDiscoverTv, fetchDiscoverTv)
+}
+
+func allTrending() (TMDBTrendingAll, error) {
+	return getTrendingCached(trendingKeyAll, fetchAllTrending)
+}
+
+func upcomingMovies() (TMDBUpcomingMovies, error) {
+	return getTrendingCached(trendingKeyUpcomingMovies, fetchUpcomingMovies)
+}
+
+func upcomingTv() (TMDBUpcomingShows, error) {
+	return getTrendingCached(trendingKeyUpcomingTv, fetchUpcomingTv)
+}
+
+// Get a trending/discover list from cache, fetching
+// (and caching) it from tmdb if it isn't cached.
+func getTrendingCached[T any](cacheKey string, fetch func() (T, error)) (T, error) {
+	var resp T
+	if err := ContentStore.Get(cacheKey, &resp); err != nil {
+		if err != persistence.ErrCacheMiss {
+			slog.Error("getTrendingCached: Cache failed for some reason", "key", cacheKey, "error", err)
+		}
+	} else {
+		return resp, nil
+	}
+	resp, err := fetch()
+	if err != nil {
+		return resp, err
+	}
+	setTrendingCache(cacheKey, resp)
+	return resp, nil
+}
+
+func setTrendingCache(cacheKey string, v any) {
+	if err := ContentStore.Set(cacheKey, v, trendingCacheExp); err != nil {
+		slog.Error("setTrendingCache: Failed to set cache!", "key", cacheKey, "error", err)
+		return
+	}
+	trendingCacheUpdatedMu.Lock()
+	trendingCacheUpdated[cacheKey] = time.Now()
+	trendingCacheUpdatedMu.Unlock()
+}
+
+// Get a func that fetches a trending/discover list from tmdb and
+// replaces its cached copy. The old copy is kept if fetching fails.
+func trendingWarmer[T any](fetch func() (T, error)) func(cacheKey string) error {
+	return func(cacheKey string) error {
+		resp, err := fetch()
+		if err != nil {
+			return err
+		}
+		setTrendingCache(cacheKey, resp)
+		return nil
+	}
+}
+
+// Refresh all cached trending/discover lists, so the home
+// page loads quickly without waiting on tmdb.
+func warmTrendingCache() error {
+	var errs []error
+	for k, warm := range trendingCaches {
+		if err := warm(k); err != nil {
+			slog.Error("warmTrendingCache: Failed to warm cache", "key", k, "error", err)
+			errs = append(errs, err)
+		}
+	}
+	// Report how fresh the cache is, the oldest entry
+	// is what a failing warm up leaves behind.
+	var oldest time.Time
+	trendingCacheUpdatedMu.Lock()
+	cached := len(trendingCacheUpdated)
+	for _, t := range trendingCacheUpdated {
+		if oldest.IsZero() || t.Before(oldest) {
+			oldest = t
+		}
+	}
+	trendingCacheUpdatedMu.Unlock()
+	summary := map[string]any{"cached": cached}
+	if !oldest.IsZero() {
+		summary["oldestUpdatedAt"] = oldest
+		summary["oldestAgeSeconds"] = int(time.Since(oldest).Seconds())
+	}
+	setTaskSummary(taskIdWarmTrendingCache, summary)
+	slog.Debug("warmTrendingCache: Finished.", "warmed", len(trendingCaches)-len(errs), "failed", len(errs))
+	return errors.Join(errs...)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-contrib/cache/persistence"
+)
+
+// Use an empty content cache until the test ends.
+func useTestContentStore(t *testing.T) {
+	t.Helper()
+	old := ContentStore
+	ContentStore = persistence.NewInMemoryStore(time.Hour)
+	trendingCacheUpdatedMu.Lock()
+	oldUpdated := trendingCacheUpdated
+	trendingCacheUpdated = map[string]time.Time{}
+	trendingCacheUpdatedMu.Unlock()
+	t.Cleanup(func() {
+		ContentStore = old
+		trendingCacheUpdatedMu.Lock()
+		trendingCacheUpdated = oldUpdated
+		trendingCacheUpdatedMu.Unlock()
+	})
+}
+
+func TestWarmTrendingCache(t *testing.T) {
+	useTestConfig(t)
+	useTestTMDBLimiter(t)
+	useTestContentStore(t)
+	resetTaskStatus(taskIdWarmTrendingCache)
+	var (
+		requests = map[string]int{}
+		mu       sync.Mutex
+		failing  atomic.Bool
+		page     atomic.Int32
+	)
+	page.Store(1)
+	useTestTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"page":` + strconv.Itoa(int(page.Load())) + `,"results":[]}`))
+	}))
+	countRequests := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		n := 0
+		for _, v := range requests {
+			n += v
+		}
+		return n
+	}
+
+	if err := warmTrendingCache(); err != nil {
+		t.Fatalf("warm failed: %v", err)
+	}
+	if n := countRequests(); n != len(trendingCaches) {
+		t.Errorf("made %d requests, want one for each of the %d lists", n, len(trendingCaches))
+	}
+	if s := getTaskStatus(taskIdWarmTrendingCache).Summary; s["cached"] != len(trendingCaches) {
+		t.Errorf("got summary %v, want all %d lists cached", s, len(trendingCaches))
+	}
+	// Served from cache.
+	if m, err := discoverMovies(); err != nil || m.Page != 1 {
+		t.Errorf("got page %d (%v), want the warmed page 1", m.Page, err)
+	}
+	if n := countRequests(); n != len(trendingCaches) {
+		t.Errorf("getting a warmed list made %d more requests", n-len(trendingCaches))
+	}
+
+	// Refreshed on the next warm up.
+	page.Store(2)
+	if err := warmTrendingCache(); err != nil {
+		t.Fatalf("second warm failed: %v", err)
+	}
+	if m, _ := discoverMovies(); m.Page != 2 {
+		t.Errorf("got page %d after warming again, want 2", m.Page)
+	}
+
+	// Failing keeps the last copy.
+	failing.Store(true)
+	if err := warmTrendingCache(); err == nil {
+		t.Error("warm passed with tmdb failing")
+	}
+	if m, err := discoverMovies(); err != nil || m.Page != 2 {
+		t.Errorf("got page %d (%v) with tmdb failing, want the cached page 2", m.Page, err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Every model auto migrated at startup. New models must be added here.
+var dbModels = []any{
+	&User{},
+	&UserServices{},
+	&Content{},
+	&Watched{},
+	&WatchedSeason{},
+	&WatchedEpisode{},
+	&Activity{},
+	&Token{},
+	&Follow{},
+	&Image{},
+	&Game{},
+	&ArrRequest{},
+	&Tag{},
+	&TraktSync{},
+	&TraktSyncedItem{},
+	&QueuedTask{},
+	&TaskRun{},
+	&Notification{},
+	&ContentWatchProviders{},
+	&Collection{},
+	&ContentCollection{},
+	&UserRecommendation{},
+	&TaskFlag{},
+	&ContentRating{},
+	&CalendarEpisode{},
+	&TaskAudit{},
+}
+
+type MigrationState string
+
+var (
+	// Every table, column and index our models need exists.
+	MIGRATIONS_CURRENT MigrationState = "CURRENT"
+	// Something our models need is missing from the db.
+	MIGRATIONS_PENDING MigrationState = "PENDING"
+	// The db couldn't be checked.
+	MIGRATIONS_UNKNOWN MigrationState = "UNKNOWN"
+)
+
+// Result of the last migration check.
+type MigrationStatus struct {
+	State MigrationState `json:"state"`
+	// What is missing, as `table`, `table.column` or `index:name`.
+	Missing []string `json:"missing,omitempty"`
+	// Why the check failed, if State is UNKNOWN.
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+var (
+	migrationStatus   = MigrationStatus{State: MIGRATIONS_UNKNOWN}
+	migrationStatusMu sync.Mutex
+)
+
+// Check the db schema has everything our models (and tasks) need, so a
+// migration that didn't apply (eg. the db was swapped for an older one
+// while running) is noticed before it causes odd failures. Gorm keeps no
+// schema version, so the schema is compared with the models directly.
+func checkMigrations(db *gorm.DB) MigrationStatus {
+	missing, err := getMissingMigrations(db)
+	s := MigrationStatus{State: MIGRATIONS_CURRENT, Missing: missing, CheckedAt: time.Now()}
+	if err != nil {
+		s.State = MIGRATIONS_UNKNOWN
+		s.Error = err.Error()
+	} else if len(missing) > 0 {
+		s.State = MIGRATIONS_PENDING
+	}
+	migrationStatusMu.Lock()
+	prev := migrationStatus.State
+	migrationStatus = s
+	migrationStatusMu.Unlock()
+	if s.State == MIGRATIONS_PENDING && prev != MIGRATIONS_PENDING {
+		slog.Error("checkMigrations: DATABASE MIGRATIONS ARE PENDING. Parts of Watcharr will break until the server is restarted to migrate the database.", "missing", missing)
+		notifyAdmins(db, NOTIFICATION_MIGRATIONS_PENDING, "The database is missing "+strings.Join(missing, ", ")+". Restart the server so it can migrate the database, or check the logs for why migrating failed.")
+	} else if s.State == MIGRATIONS_CURRENT && prev == MIGRATIONS_PENDING {
+		slog.Info("checkMigrations: Database migrations are current again.")
+	}
+	return s
+}
+
+// Check migrations once they have been ran at startup.
+func checkMigrationsAtStartup(db *gorm.DB) {
+	if s := checkMigrations(db); s.State == MIGRATIONS_CURRENT {
+		slog.Info("checkMigrationsAtStartup: Database migrations are current.")
+	}
+}
+
+// Get tables, columns and indexes missing from the db.
+func getMissingMigrations(db *gorm.DB) ([]string, error) {
+	m := db.Migrator()
+	missing := []string{}
+	for _, model := range dbModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			slog.Error("getMissingMigrations: Failed to parse model", "error", err)
+			return nil, errors.New("failed to parse model")
+		}
+		table := stmt.Schema.Table
+		if !m.HasTable(model) {
+			missing = append(missing, table)
+			continue
+		}
+		for _, f := range stmt.Schema.Fields {
+			if f.DBName == "" || f.IgnoreMigration {
+				continue
+			}
+			if !m.HasColumn(model, f.DBName) {
+				missing = append(missing, table+"."+f.DBName)
+			}
+		}
+	}
+	for _, v := range taskIndexes {
+		if !m.HasIndex(v.model, v.name) {
+			missing = append(missing, "index:"+v.name)
+		}
+	}
+	return missing, nil
+}
+
+// Check migrations are still current, for the Check Migrations task.
+func checkMigrationsTask(db *gorm.DB) error {
+	s := checkMigrations(db)
+	setTaskSummary("check_migrations", map[string]any{"state": s.State, "missing": len(s.Missing)})
+	switch s.State {
+	case MIGRATIONS_PENDING:
+		return errors.New("database migrations are pending")
+	case MIGRATIONS_UNKNOWN:
+		return errors.New(s.Error)
+	}
+	return nil
+}
+
+func getMigrationStatus() MigrationStatus {
+	migrationStatusMu.Lock()
+	defer migrationStatusMu.Unlock()
+	return migrationStatus
+}
+
+type ServerHealthResponse struct {
+	Migrations MigrationStatus `json:"migrations"`
+	TMDBKey    TMDBKeyStatus   `json:"tmdbKey"`
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestCheckMigrationsPending(t *testing.T) {
+	useTestConfig(t)
+	t.Cleanup(func() {
+		migrationStatusMu.Lock()
+		migrationStatus = MigrationStatus{State: MIGRATIONS_UNKNOWN}
+		migrationStatusMu.Unlock()
+	})
+	db := newTestDb(t)
+	ensureTaskIndexes(db)
+	r, token := newTestTaskRouter(t, db)
+	newBaseRouter(db, r.Group("/api")).addServerRoutes()
+	getAdminNotifications := func() []Notification {
+		t.Helper()
+		var n []Notification
+		if err := db.Where("type = ?", NOTIFICATION_MIGRATIONS_PENDING).Find(&n).Error; err != nil {
+			t.Fatalf("failed to get notifications: %v", err)
+		}
+		return n
+	}
+
+	if err := checkMigrationsTask(db); err != nil {
+		t.Fatalf("check failed on a migrated db: %v", err)
+	}
+	if s := getMigrationStatus(); s.State != MIGRATIONS_CURRENT || len(s.Missing) != 0 {
+		t.Fatalf("got %+v on a migrated db, want current", s)
+	}
+
+	// Like a migration that didn't apply.
+	if err := db.Migrator().DropTable(&TaskAudit{}); err != nil {
+		t.Fatalf("failed to drop table: %v", err)
+	}
+	if err := db.Migrator().DropColumn(&CalendarEpisode{}, "air_date"); err != nil {
+		t.Fatalf("failed to drop column: %v", err)
+	}
+	if err := db.Exec("DROP INDEX idx_tokens_created_at").Error; err != nil {
+		t.Fatalf("failed to drop index: %v", err)
+	}
+	if err := checkMigrationsTask(db); err == nil {
+		t.Error("check didn't fail with migrations pending")
+	}
+	s := getMigrationStatus()
+	slices.Sort(s.Missing)
+	if want := []string{"calendar_episodes.air_date", "index:idx_tokens_created_at", "task_audits"}; s.State != MIGRATIONS_PENDING || !slices.Equal(s.Missing, want) {
+		t.Errorf("got %+v, want pending with %q missing", s, want)
+	}
+	if sum := getTaskStatus("check_migrations").Summary; sum["state"] != MIGRATIONS_PENDING || sum["missing"] != 3 {
+		t.Errorf("got task summary %v, want pending with 3 missing", sum)
+	}
+	if n := getAdminNotifications(); len(n) != 1 {
+		t.Fatalf("got %d admin notifications, want 1", len(n))
+	}
+	// Only alerted when they become pending, not on every check.
+	checkMigrationsTask(db)
+	if n := getAdminNotifications(); len(n) != 1 {
+		t.Errorf("got %d admin notifications after checking again, want still 1", len(n))
+	}
+
+	w := doTestRequest(t, r, http.MethodGet, "/api/server/health", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d getting health, want 200: %s", w.Code, w.Body)
+	}
+	var health ServerHealthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil {
+		t.Fatalf("failed to decode health: %v", err)
+	}
+	if health.Migrations.State != MIGRATIONS_PENDING || len(health.Migrations.Missing) != 3 {
+		t.Errorf("health has migrations %+v, want pending with 3 missing", health.Migrations)
+	}
+}
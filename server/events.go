@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type EventType string
+
+var (
+	EVENT_WATCHED_ADDED   EventType = "watched_added"
+	EVENT_WATCHED_REMOVED EventType = "watched_removed"
+	EVENT_RATING_CHANGED  EventType = "rating_changed"
+)
+
+// Something a user did, published by the api for subscribers
+// to react to (instead of tasks polling for it).
+type Event struct {
+	Type      EventType
+	UserID    uint
+	WatchedID uint
+	// Content the watched entry is for, if known.
+	ContentID int
+	Time      time.Time
+}
+
+// Reacts to events of one type.
+type EventSubscriber struct {
+	// Name of subscriber, for logs.
+	Name string
+	Type EventType
+	// Handle the event. Ran on the bus goroutine, so should be quick-ish.
+	Handle func(db *gorm.DB, e Event) error
+	// Optional: Queue the work durably (eg. with `enqueueTask`), for when
+	// Handle fails or the event couldn't be delivered (the bus is full or
+	// not running). Events without one are only logged when that happens.
+	Fallback func(db *gorm.DB, e Event) error
+}
+
+// Events buffered before new ones are given to fallbacks instead.
+const eventBufferSize = 256
+
+var (
+	// Nil until the bus is started.
+	eventCh   chan Event
+	eventChMu sync.Mutex
+)
+
+// Subscribers reacting to events, registered when the bus starts.
+func getEventSubscribers() []EventSubscriber {
+	return []EventSubscriber{
+		{
+			Name:   "fetch_poster",
+			Type:   EVENT_WATCHED_ADDED,
+			Handle: fetchPosterOnAdd,
+			Fallback: func(db *gorm.DB, e Event) error {
+				p, err := getEventPosterPath(db, e)
+				if err != nil || p == "" {
+					return err
+				}
+				return enqueueTask(db, "download_poster", map[string]string{"posterPath": p})
+			},
+		},
+	}
+}
+
+// Start delivering published events to subscribers. Must be called
+// once at startup, events published before are given to fallbacks.
+func startEventBus(db *gorm.DB) {
+	subs := map[EventType][]EventSubscriber{}
+	for _, s := range getEventSubscribers() {
+		subs[s.Type] = append(subs[s.Type], s)
+	}
+	ch := make(chan Event, eventBufferSize)
+	eventChMu.Lock()
+	eventCh = ch
+	eventChMu.Unlock()
+	go func() {
+		for e := range ch {
+			for _, s := range subs[e.Type] {
+				if err := s.Handle(db, e); err != nil {
+					slog.Error("eventBus: Subscriber failed to handle event.", "subscriber", s.Name, "type", e.Type, "error", err)
+					runEventFallback(db, s, e)
+				}
+			}
+		}
+	}()
+}
+
+// Publish an event to subscribers. Never blocks, if the bus is full
+// (or not running) the event is handed to each subscribers fallback.
+func publishEvent(db *gorm.DB, e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	eventChMu.Lock()
+	ch := eventCh
+	eventChMu.Unlock()
+	if ch != nil {
+		select {
+		case ch <- e:
+			return
+		default:
+		}
+	}
+	slog.Warn("publishEvent: Event bus is full or not running, using fallbacks.", "type", e.Type)
+	for _, s := range getEventSubscribers() {
+		if s.Type == e.Type {
+			runEventFallback(db, s, e)
+		}
+	}
+}
+
+func runEventFallback(db *gorm.DB, s EventSubscriber, e Event) {
+	if s.Fallback == nil {
+		slog.Warn("runEventFallback: Subscriber has no fallback, event is dropped.", "subscriber", s.Name, "type", e.Type)
+		return
+	}
+	if err := s.Fallback(db, e); err != nil {
+		slog.Error("runEventFallback: Fallback failed, event is dropped.", "subscriber", s.Name, "type", e.Type, "error", err)
+	}
+}
+
+// Get the poster path of the content an event is for.
+func getEventPosterPath(db *gorm.DB, e Event) (string, error) {
+	if e.ContentID == 0 {
+		return "", nil
+	}
+	var paths []string
+	if res := db.Model(&Content{}).Where("id = ?", e.ContentID).Pluck("poster_path", &paths); res.Error != nil {
+		slog.Error("getEventPosterPath: Failed to get content poster path", "content_id", e.ContentID, "error", res.Error)
+		return "", errors.New("failed to get content poster path")
+	}
+	if len(paths) == 0 {
+		return "", nil
+	}
+	return paths[0], nil
+}
+
+// Make sure the poster of content added to a list is cached. It is
+// normally downloaded when the content is first cached, this gets it
+// back if it has gone since (eg. removed by Cleanup Images while the
+// content wasn't on any list).
+func fetchPosterOnAdd(db *gorm.DB, e Event) error {
+	p, err := getEventPosterPath(db, e)
+	if err != nil || p == "" {
+		return err
+	}
+	if info, err := os.Stat(posterCachePath(p)); err == nil && info.Size() > 0 {
+		return nil
+	}
+	slog.Debug("fetchPosterOnAdd: Poster missing, downloading.", "poster_path", p)
+	// Forced, so empty files are replaced.
+	return downloadPoster(p, true)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// Run the event bus until the test ends.
+func useTestEventBus(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	startEventBus(db)
+	t.Cleanup(func() {
+		eventChMu.Lock()
+		close(eventCh)
+		eventCh = nil
+		eventChMu.Unlock()
+	})
+}
+
+// Get the poster paths queued for download.
+func getTestQueuedPosters(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	var payloads []string
+	if err := db.Model(&QueuedTask{}).Where("type = ?", "download_poster").Pluck("payload", &payloads).Error; err != nil {
+		t.Fatalf("failed to get queued tasks: %v", err)
+	}
+	return payloads
+}
+
+func TestEventBusFetchesPosterOnAdd(t *testing.T) {
+	useTestConfig(t)
+	useTestTMDBLimiter(t)
+	useTestTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/t/p/w500/added.jpg" {
+			w.Write([]byte("poster"))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	db := newTestDb(t)
+	os.MkdirAll(path.Join(DataPath, "img"), 0755)
+	added := Content{TmdbID: 1, Title: "Added", Type: MOVIE, PosterPath: "/added.jpg"}
+	db.Create(&added)
+	// Tmdb is failing to serve it.
+	failing := Content{TmdbID: 2, Title: "Failing", Type: MOVIE, PosterPath: "/failing.jpg"}
+	db.Create(&failing)
+	useTestEventBus(t, db)
+
+	publishEvent(db, Event{Type: EVENT_WATCHED_ADDED, UserID: 1, WatchedID: 1, ContentID: added.ID})
+	waitFor(t, "poster of added content to be fetched", func() bool {
+		info, err := os.Stat(posterCachePath("/added.jpg"))
+		return err == nil && info.Size() > 0
+	})
+	// Subscriber fails, its fallback queues the download.
+	publishEvent(db, Event{Type: EVENT_WATCHED_ADDED, UserID: 1, WatchedID: 2, ContentID: failing.ID})
+	waitFor(t, "failed poster fetch to be queued", func() bool {
+		return len(getTestQueuedPosters(t, db)) == 1
+	})
+	if q := getTestQueuedPosters(t, db); q[0] != `{"posterPath":"/failing.jpg"}` {
+		t.Errorf("queued %q, want the failing poster", q)
+	}
+}
+
+func TestEventBusNotRunningUsesFallback(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	c := Content{TmdbID: 1, Title: "Added", Type: MOVIE, PosterPath: "/added.jpg"}
+	db.Create(&c)
+
+	publishEvent(db, Event{Type: EVENT_WATCHED_ADDED, UserID: 1, WatchedID: 1, ContentID: c.ID})
+	// No subscriber for these, nothing is queued.
+	publishEvent(db, Event{Type: EVENT_WATCHED_REMOVED, UserID: 1, WatchedID: 1, ContentID: c.ID})
+	if q := getTestQueuedPosters(t, db); len(q) != 1 || q[0] != `{"posterPath":"/added.jpg"}` {
+		t.Errorf("queued %q with the bus not running, want the poster download", q)
+	}
+}
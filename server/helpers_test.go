@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-co-op/gocron/v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Open a new database with all models migrated, removed when the test ends.
+func newTestDb(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(path.Join(t.TempDir(), "watcharr.db")), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(dbModels...); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDb, err := db.DB(); err == nil {
+			sqlDb.Close()
+		}
+	})
+	return db
+}
+
+// Use an empty config (and a temp data dir) until the test ends.
+func useTestConfig(t *testing.T) {
+	t.Helper()
+	oldConfig, oldDataPath := Config, DataPath
+	Config = ServerConfig{}
+	DataPath = t.TempDir()
+	t.Cleanup(func() {
+		Config, DataPath = oldConfig, oldDataPath
+	})
+}
+
+// Use a new (stopped) scheduler with only the tasks in `tfs` registered,
+// until the test ends. Task ids should be unique to the test, state kept
+// by id elsewhere (statuses, breakers, etc) isn't reset.
+func useTestScheduler(t *testing.T, tfs map[string]TaskFunc) {
+	t.Helper()
+	s, err := gocron.NewScheduler()
+	if err != nil {
+		t.Fatalf("failed to create scheduler: %v", err)
+	}
+	oldScheduler, oldDb := taskScheduler, taskDb
+	taskFuncsMu.Lock()
+	oldFuncs := taskFuncs
+	taskFuncs = map[string]TaskFunc{}
+	taskFuncsMu.Unlock()
+	taskScheduler = s
+	taskDb = nil
+	setupTaskPools()
+	t.Cleanup(func() {
+		s.Shutdown()
+		taskScheduler, taskDb = oldScheduler, oldDb
+		taskFuncsMu.Lock()
+		taskFuncs = oldFuncs
+		taskFuncsMu.Unlock()
+		setupTaskPools()
+	})
+	for id, tf := range tfs {
+		if err := registerTask(id, tf); err != nil {
+			t.Fatalf("failed to register task %s: %v", id, err)
+		}
+	}
+}
+
+// Use only the feature tasks in `fts`, and no kept back tasks, until
+// the test ends. Call after `useTestScheduler`, since syncing registers them.
+func useTestFeatureTasks(t *testing.T, fts map[string]FeatureTask) {
+	t.Helper()
+	featureTasksMu.Lock()
+	old, oldConditional := featureTasks, conditionalTasks
+	featureTasks, conditionalTasks = fts, map[string]TaskFunc{}
+	featureTasksMu.Unlock()
+	t.Cleanup(func() {
+		featureTasksMu.Lock()
+		featureTasks, conditionalTasks = old, oldConditional
+		featureTasksMu.Unlock()
+	})
+}
+
+// Task clock that only moves when told to.
+type fakeTaskClock struct {
+	mu  sync.Mutex
+	now time.Time
+	// Optional: Called on each Sleep, before the clock is moved forward.
+	onSleep func(d time.Duration)
+}
+
+func (c *fakeTaskClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeTaskClock) Sleep(d time.Duration) {
+	if c.onSleep != nil {
+		c.onSleep(d)
+	}
+	c.Advance(d)
+}
+
+// Move the clock forward by `d`.
+func (c *fakeTaskClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Use a fake task clock starting at `now`, until the test ends.
+func useFakeTaskClock(t *testing.T, now time.Time) *fakeTaskClock {
+	t.Helper()
+	c := &fakeTaskClock{now: now}
+	old := taskClock
+	taskClock = c
+	t.Cleanup(func() {
+		taskClock = old
+	})
+	return c
+}
+
+// Wait up to a second for `cond` to be true.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Router with only the task routes, and an admin token to call them with.
+// Needs useTestConfig, the token is signed with its JWT_SECRET.
+func newTestTaskRouter(t *testing.T, db *gorm.DB) (*gin.Engine, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	Config.JWT_SECRET = "test"
+	admin := User{Username: "admin", Permissions: PERM_ADMIN}
+	if err := db.Create(&admin).Error; err != nil {
+		t.Fatalf("failed to create admin: %v", err)
+	}
+	token, err := signJWT(&admin)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	r := gin.New()
+	newBaseRouter(db, r.Group("/api")).addTaskRoutes()
+	return r, token
+}
+
+// Make a request to `r`, with `body` (if not nil) sent as json.
+func doTestRequest(t *testing.T, r http.Handler, method string, url string, token string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var b bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&b).Encode(body); err != nil {
+			t.Fatalf("failed to encode body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, url, &b)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
@@ -10,6 +11,7 @@ import (
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
+	"io/fs"
 	"log"
 	"log/slog"
 	"mime/multipart"
@@ -17,6 +19,9 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/buckket/go-blurhash"
@@ -68,41 +73,283 @@ func getBlurHash(img io.Reader) (string, error) {
 	return bh, nil
 }
 
-func cleanupImages(db *gorm.DB) {
+// Suffix of files being downloaded into the img dir,
+// they are renamed (to remove it) once fully downloaded.
+const imageTempSuffix = ".tmp"
+
+// Junk in the img dir (partial downloads, broken symlinks) newer than this is
+// left alone by `cleanupImageJunk`, it may still be being downloaded.
+const imageJunkMinAge = 15 * time.Minute
+
+// Cached posters newer than this are never removed by
+// `cleanupStalePosters`, the content row they are for
+// may not have been saved yet.
+const stalePosterMinAge = time.Hour
+
+func cleanupImages(db *gorm.DB) error {
 	slog.Info("cleanupImages running")
+	// Junk first, so stale poster cleanup doesn't report it as posters.
+	junk, junkBytes, junkErr := cleanupImageJunk()
+	// Before unused images, so avatars of deleted users are removed this run.
+	avatars, avatarsErr := releaseDeletedUserAvatars(db)
+	unused, unusedErr := cleanupUnusedImages(db)
+	posters, postersBytes, postersErr := cleanupStalePosters(db)
+	backdrops, backdropsBytes, backdropsErr := cleanupStaleBackdrops(db)
+	setTaskSummary("cleanup_images", map[string]any{
+		"releasedAvatars":       avatars,
+		"removedImages":         unused,
+		"removedPosters":        posters,
+		"removedPostersBytes":   postersBytes,
+		"removedBackdrops":      backdrops,
+		"removedBackdropsBytes": backdropsBytes,
+		"removedJunk":           junk,
+		"removedJunkBytes":      junkBytes,
+	})
+	return errors.Join(avatarsErr, unusedErr, junkErr, postersErr, backdropsErr)
+}
+
+// Unset avatars of deleted users, so their images are removed by
+// `cleanupUnusedImages`. Watcharr has no way to delete a user, this is
+// only for users soft deleted by hand in the db (setting deleted_at).
+// Their rows are kept, so their avatars would otherwise stay referenced
+// forever. Nothing is done when there are no such users. Images are
+// deduplicated by hash, an avatar that is also used by a user that still
+// exists (or a game) is still referenced and won't be removed.
+func releaseDeletedUserAvatars(db *gorm.DB) (int64, error) {
+	res := db.Unscoped().Model(&User{}).
+		Where("deleted_at IS NOT NULL AND avatar_id != 0").
+		Update("avatar_id", 0)
+	if res.Error != nil {
+		slog.Error("releaseDeletedUserAvatars: failed to unset avatars of deleted users", "error", res.Error)
+		return 0, errors.New("failed to unset avatars of deleted users")
+	}
+	slog.Info("releaseDeletedUserAvatars: finished", "released", res.RowsAffected)
+	return res.RowsAffected, nil
+}
+
+// Size of the worker pools image tasks use for file work.
+func getImageWorkers() int {
+	taskConfigMu.RLock()
+	defer taskConfigMu.RUnlock()
+	return max(Config.TASK_CLEANUP_IMAGES_WORKERS, 1)
+}
+
+// Remove images (and their files) that are no longer referenced.
+// Returns the amount removed.
+func cleanupUnusedImages(db *gorm.DB) (int, error) {
 	var unusedImgs []Image
 	// Select images that are not referenced by at least one other row.
-	// Currently only used for user avatars, add new tables when used.
-	db.Raw(`SELECT *
+	// Currently used for user avatars and game covers, add new tables when used.
+	res := db.Raw(`SELECT *
 FROM images
 WHERE NOT EXISTS (
 	SELECT 1
 	FROM users
 	WHERE users.avatar_id = images.id
+) AND NOT EXISTS (
+	SELECT 1
+	FROM games
+	WHERE games.poster_id = images.id
 );`).Scan(&unusedImgs)
-	slog.Info("cleanupImages: scanned for unused images", "amount", len(unusedImgs))
-	if len(unusedImgs) > 0 {
-		for _, v := range unusedImgs {
-			slog.Debug("cleanupImages: removing an image", "id", v.ID, "path", v.Path)
-			err := db.Transaction(func(tx *gorm.DB) error {
-				// Try to delete image from db
-				if err := tx.Where("id = ?", v.ID).Delete(&Image{}).Error; err != nil {
-					return err
-				}
-				// hope its ok to do this sorta thing here :skull:
-				if err := os.Remove(path.Join(DataPath, v.Path)); err != nil {
-					return err
-				}
-				// commit transaction if no errors
+	if res.Error != nil {
+		slog.Error("cleanupUnusedImages: failed to scan for unused images", "error", res.Error)
+		return 0, errors.New("failed to scan for unused images")
+	}
+	slog.Info("cleanupUnusedImages: scanned for unused images", "amount", len(unusedImgs))
+	if len(unusedImgs) == 0 {
+		return 0, nil
+	}
+	// Files are removed by a pool of workers, since on slow (eg. network)
+	// storage it can take a while. Db rows are removed after in one go,
+	// sqlite doesn't like concurrent writes.
+	workers := getImageWorkers()
+	var (
+		removed []uint
+		mu      sync.Mutex
+	)
+	// Cancelling stops more files being removed, rows of those already are still removed.
+	ctx := getTaskRunContext("cleanup_images")
+	p, _ := runParallel(ctx, unusedImgs, workers, func(_ context.Context, v Image) error {
+		// Never touch files outside of our img dir, incase a path is bad.
+		if !isImagePathSafe(v.Path) {
+			slog.Error("cleanupUnusedImages: skipping image with path outside of img dir", "id", v.ID, "path", v.Path)
+			return errors.New("image path outside of img dir")
+		}
+		slog.Debug("cleanupUnusedImages: removing an image", "id", v.ID, "path", v.Path)
+		// If file is already gone, we still want to remove the row.
+		if err := os.Remove(path.Join(DataPath, v.Path)); err != nil && !os.IsNotExist(err) {
+			slog.Error("cleanupUnusedImages: failed to remove image file - db row and file kept", "img", v, "error", err)
+			return err
+		}
+		mu.Lock()
+		removed = append(removed, v.ID)
+		mu.Unlock()
+		return nil
+	}, func(p ParallelProgress) {
+		if p.Done%100 == 0 {
+			slog.Debug("cleanupUnusedImages: progress", "done", p.Done, "failed", p.Failed, "total", p.Total)
+		}
+	})
+	if len(removed) > 0 {
+		// If this fails, rows will be removed next run (their files are already gone).
+		if err := db.Where("id IN ?", removed).Delete(&Image{}).Error; err != nil {
+			slog.Error("cleanupUnusedImages: failed to remove image rows - files already removed", "amount", len(removed), "error", err)
+			return 0, errors.New("failed to remove unused image rows")
+		}
+	}
+	slog.Info("cleanupUnusedImages: finished", "removed", len(removed), "failed", p.Failed, "workers", workers)
+	if ctx.Err() != nil {
+		return len(removed), fmt.Errorf("cancelled after removing %d of %d unused images", len(removed), len(unusedImgs))
+	}
+	if p.Failed > 0 {
+		return len(removed), fmt.Errorf("failed to remove %d of %d unused images", p.Failed, len(unusedImgs))
+	}
+	return len(removed), nil
+}
+
+// Remove junk left in our img dir by interrupted downloads (`.tmp`
+// files) and symlinks with missing targets. Nothing else is touched,
+// real images never end in `.tmp` and are never symlinks.
+// Returns the amount of junk removed and bytes reclaimed.
+func cleanupImageJunk() (int, int64, error) {
+	imgDir := path.Join(DataPath, "img")
+	ctx := getTaskRunContext("cleanup_images")
+	var (
+		removed   int
+		failed    int
+		reclaimed int64
+	)
+	err := filepath.WalkDir(imgDir, func(p string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return filepath.SkipAll
+		}
+		if err != nil {
+			if os.IsNotExist(err) && p == imgDir {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		isLink := d.Type()&fs.ModeSymlink != 0
+		if !isLink && !(d.Type().IsRegular() && strings.HasSuffix(d.Name(), imageTempSuffix)) {
+			return nil
+		}
+		if isLink {
+			// Only broken links are junk.
+			if _, err := os.Stat(p); !os.IsNotExist(err) {
 				return nil
-			})
-			if err != nil {
-				slog.Error("cleanupImages: failed to remove image - db row and file kept", "img", v, "error", err)
-			} else {
-				slog.Debug("cleanupImages: successfully removed unused image.", "id", v.ID)
 			}
 		}
+		info, err := os.Lstat(p)
+		if err != nil || taskSince(info.ModTime()) < imageJunkMinAge {
+			return nil
+		}
+		slog.Debug("cleanupImageJunk: removing junk", "path", p, "symlink", isLink)
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			slog.Error("cleanupImageJunk: failed to remove junk", "path", p, "error", err)
+			failed++
+			return nil
+		}
+		removed++
+		if !isLink {
+			reclaimed += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("cleanupImageJunk: failed to walk img dir", "error", err)
+		return removed, reclaimed, errors.New("failed to walk img dir")
+	}
+	slog.Info("cleanupImageJunk: finished", "removed", removed, "failed", failed, "reclaimed_bytes", reclaimed)
+	if ctx.Err() != nil {
+		return removed, reclaimed, fmt.Errorf("cancelled after removing %d junk files", removed)
+	}
+	if failed > 0 {
+		return removed, reclaimed, fmt.Errorf("failed to remove %d junk files", failed)
+	}
+	return removed, reclaimed, nil
+}
+
+// Remove cached TMDB posters that no content uses anymore.
+// Posters are cached at `img/<poster_path>` and are never removed
+// when TMDB gives content a new poster, so the old ones pile up.
+// Only one size (w500) of each poster is cached, so there are no
+// size variants to remove, only posters nothing references.
+// Returns the amount removed and bytes reclaimed.
+func cleanupStalePosters(db *gorm.DB) (int, int64, error) {
+	var used []string
+	if err := db.Model(&Content{}).Where("poster_path != ''").Pluck("poster_path", &used).Error; err != nil {
+		slog.Error("cleanupStalePosters: failed to get poster paths in use", "error", err)
+		return 0, 0, errors.New("failed to get poster paths in use")
+	}
+	inUse := make(map[string]bool, len(used))
+	for _, v := range used {
+		inUse[path.Base(v)] = true
+	}
+	// Posters are stored in the root of our img dir,
+	// everything else is in a sub dir, which we skip.
+	removed, reclaimed, err := removeStaleImageFiles(getTaskRunContext("cleanup_images"), "cleanupStalePosters", path.Join(DataPath, "img"), inUse)
+	if err != nil {
+		return removed, reclaimed, fmt.Errorf("stale posters: %w", err)
+	}
+	return removed, reclaimed, nil
+}
+
+// Remove regular files directly in `dir` that aren't in `inUse` (by
+// name) and are older than `stalePosterMinAge`. Files are checked and
+// removed by a pool of workers, since each is a stat and remove, which
+// is slow on network storage. Once `ctx` is done no more are removed.
+// `caller` is used in logs. Returns the amount removed and bytes reclaimed.
+func removeStaleImageFiles(ctx context.Context, caller string, dir string, inUse map[string]bool) (int, int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		slog.Error(caller+": failed to read dir", "dir", dir, "error", err)
+		return 0, 0, errors.New("failed to read dir")
+	}
+	var stale []fs.DirEntry
+	for _, v := range entries {
+		if v.Type().IsRegular() && !inUse[v.Name()] {
+			stale = append(stale, v)
+		}
+	}
+	var (
+		removed   atomic.Int64
+		reclaimed atomic.Int64
+	)
+	p, _ := runParallel(ctx, stale, getImageWorkers(), func(_ context.Context, v fs.DirEntry) error {
+		info, err := v.Info()
+		if err != nil {
+			return nil
+		}
+		// The content it is for may not have been saved yet.
+		if taskSince(info.ModTime()) < stalePosterMinAge {
+			return nil
+		}
+		slog.Debug(caller+": removing a file", "name", v.Name(), "size", info.Size())
+		if err := os.Remove(path.Join(dir, v.Name())); err != nil && !os.IsNotExist(err) {
+			slog.Error(caller+": failed to remove file", "name", v.Name(), "error", err)
+			return err
+		}
+		removed.Add(1)
+		reclaimed.Add(info.Size())
+		return nil
+	}, nil)
+	n, size := int(removed.Load()), reclaimed.Load()
+	slog.Info(caller+": finished", "removed", n, "failed", p.Failed, "reclaimed_bytes", size)
+	if ctx.Err() != nil {
+		return n, size, fmt.Errorf("cancelled after removing %d files", n)
+	}
+	if p.Failed > 0 {
+		return n, size, fmt.Errorf("failed to remove %d files", p.Failed)
 	}
+	return n, size, nil
+}
+
+// If an images path is local to and inside our img dir.
+func isImagePathSafe(p string) bool {
+	return filepath.IsLocal(p) && strings.HasPrefix(filepath.ToSlash(filepath.Clean(p)), "img/")
 }
 
 func isValidImageType(f multipart.File) error {
@@ -163,7 +410,9 @@ func downloadAndInsertImage(db *gorm.DB, url string, imgSubPath string) (Image,
 	dataOutP := path.Join(DataPath, outp)
 
 	// Create the file
-	out, err := os.Create(dataOutP)
+	// Written to a temp file first, then moved into place (like `download`).
+	tmpOutP := dataOutP + imageTempSuffix
+	out, err := os.Create(tmpOutP)
 	if err != nil {
 		if os.IsNotExist(err) {
 			err = os.MkdirAll(path.Dir(dataOutP), 0764)
@@ -171,7 +420,7 @@ func downloadAndInsertImage(db *gorm.DB, url string, imgSubPath string) (Image,
 				return Image{}, err
 			}
 			// If dirs made, try making file again
-			out, err = os.Create(dataOutP)
+			out, err = os.Create(tmpOutP)
 			if err != nil {
 				return Image{}, err
 			}
@@ -179,9 +428,16 @@ func downloadAndInsertImage(db *gorm.DB, url string, imgSubPath string) (Image,
 			return Image{}, err
 		}
 	}
-	defer out.Close()
 	_, err = io.Copy(out, br)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
 	if err != nil {
+		os.Remove(tmpOutP)
+		return Image{}, err
+	}
+	if err = os.Rename(tmpOutP, dataOutP); err != nil {
+		os.Remove(tmpOutP)
 		return Image{}, err
 	}
 
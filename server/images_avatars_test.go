@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// Add an avatar with a file in the img dir.
+func addTestAvatar(t *testing.T, db *gorm.DB, name string) Image {
+	t.Helper()
+	img := Image{Hash: name, Path: path.Join("img", name+".webp")}
+	if err := db.Create(&img).Error; err != nil {
+		t.Fatalf("failed to create image: %v", err)
+	}
+	os.MkdirAll(path.Join(DataPath, "img"), 0755)
+	if err := os.WriteFile(path.Join(DataPath, img.Path), []byte("avatar"), 0644); err != nil {
+		t.Fatalf("failed to write image: %v", err)
+	}
+	return img
+}
+
+func TestCleanupImagesRemovesDeletedUserAvatars(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	present := addTestAvatar(t, db, "present")
+	deleted := addTestAvatar(t, db, "deleted")
+	// Same upload by two users, one of them deleted.
+	shared := addTestAvatar(t, db, "shared")
+	addUser := func(name string, avatar Image, remove bool) {
+		u := User{Username: name, AvatarID: avatar.ID}
+		if err := db.Create(&u).Error; err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+		if remove {
+			db.Delete(&u)
+		}
+	}
+	addUser("alice", present, false)
+	addUser("bob", deleted, true)
+	addUser("carol", shared, true)
+	addUser("dave", shared, false)
+
+	if err := cleanupImages(db); err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+	s := getTaskStatus("cleanup_images").Summary
+	if s["releasedAvatars"] != int64(2) || s["removedImages"] != 1 {
+		t.Errorf("got summary %v, want 2 avatars released and 1 image removed", s)
+	}
+	for img, kept := range map[Image]bool{present: true, deleted: false, shared: true} {
+		if _, err := os.Stat(path.Join(DataPath, img.Path)); (err == nil) != kept {
+			t.Errorf("avatar %s file kept is %v, want %v", img.Hash, err == nil, kept)
+		}
+		var n int64
+		db.Model(&Image{}).Where("id = ?", img.ID).Count(&n)
+		if (n == 1) != kept {
+			t.Errorf("avatar %s row kept is %v, want %v", img.Hash, n == 1, kept)
+		}
+	}
+}
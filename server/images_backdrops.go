@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Max backdrops downloaded per run, the rest are picked up next run.
+	backdropCacheMaxPerRun = 200
+	// Time between starting each backdrop download, so we don't hammer tmdb.
+	backdropCacheInterval = 200 * time.Millisecond
+	// Default tmdb size backdrops are cached at.
+	backdropDefaultSize = "w1280"
+	// Sub dir of our img dir backdrops are cached in, so they
+	// are kept apart from posters (in the root of it).
+	backdropDir = "backdrops"
+)
+
+// Get the tmdb size backdrops are cached at, from TASK_BACKDROP_SIZE.
+func getBackdropSize() string {
+	switch Config.TASK_BACKDROP_SIZE {
+	case "":
+		return backdropDefaultSize
+	case "w300", "w780", "w1280", "original":
+		return Config.TASK_BACKDROP_SIZE
+	}
+	slog.Error("getBackdropSize: Invalid backdrop size. Using default.", "size", Config.TASK_BACKDROP_SIZE, "default", backdropDefaultSize)
+	return backdropDefaultSize
+}
+
+// Where a tmdb backdrop is cached in our img dir.
+func backdropCachePath(backdropPath string) string {
+	return path.Join(DataPath, "img", backdropDir, backdropPath)
+}
+
+// Download a tmdb backdrop into our img dir.
+// Unless `force`, nothing is done if it is already cached.
+func downloadBackdrop(backdropPath string, force bool) error {
+	return downloadBackdropFor("", backdropPath, force)
+}
+
+// Like `downloadBackdrop`, for task `task` (see `waitTMDBImageQuota`).
+func downloadBackdropFor(task string, backdropPath string, force bool) error {
+	outf := backdropCachePath(backdropPath)
+	if err := waitTMDBImageQuota(task, outf, force); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Join(DataPath, "img", backdropDir), 0764); err != nil {
+		return err
+	}
+	return download(tmdbImageBase+getBackdropSize()+backdropPath, outf, force)
+}
+
+// Cache backdrops of tracked content that are missing from our img dir
+// (or are empty files). Unlike posters, backdrops aren't downloaded when
+// content is added, they are large and only needed on detail pages.
+func cacheBackdrops(db *gorm.DB) error {
+	var backdrops []string
+	res := db.Model(&Content{}).
+		Where("backdrop_path != '' AND id IN (SELECT content_id FROM watcheds WHERE deleted_at IS NULL AND content_id IS NOT NULL)").
+		Distinct().
+		Pluck("backdrop_path", &backdrops)
+	if res.Error != nil {
+		slog.Error("cacheBackdrops: Failed to get backdrop paths of tracked content", "error", res.Error)
+		return errors.New("failed to get backdrop paths of tracked content")
+	}
+	var missing []string
+	for _, p := range backdrops {
+		info, err := os.Stat(backdropCachePath(p))
+		if err == nil && info.Size() > 0 {
+			continue
+		}
+		if err != nil && !os.IsNotExist(err) {
+			slog.Error("cacheBackdrops: Failed to stat backdrop", "backdrop_path", p, "error", err)
+			continue
+		}
+		missing = append(missing, p)
+	}
+	queued := missing
+	if len(queued) > backdropCacheMaxPerRun {
+		queued = queued[:backdropCacheMaxPerRun]
+	}
+	workers := getImageWorkers()
+	var (
+		succeeded atomic.Int32
+		wg        sync.WaitGroup
+	)
+	paths := make(chan string)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range paths {
+				// Forced, so empty files are replaced.
+				if err := downloadBackdropFor("cache_backdrops", p, true); err != nil {
+					slog.Error("cacheBackdrops: Failed to download backdrop", "backdrop_path", p, "error", err)
+					continue
+				}
+				succeeded.Add(1)
+			}
+		}()
+	}
+	ticker := time.NewTicker(backdropCacheInterval)
+	for _, p := range queued {
+		<-ticker.C
+		paths <- p
+	}
+	ticker.Stop()
+	close(paths)
+	wg.Wait()
+	failed := len(queued) - int(succeeded.Load())
+	setTaskSummary("cache_backdrops", map[string]any{
+		"tracked":  len(backdrops),
+		"missing":  len(missing),
+		"cached":   succeeded.Load(),
+		"failed":   failed,
+		"size":     getBackdropSize(),
+		"deferred": len(missing) - len(queued),
+	})
+	if failed > 0 {
+		return fmt.Errorf("failed to cache %d of %d missing backdrops", failed, len(queued))
+	}
+	return nil
+}
+
+// Remove cached backdrops that no tracked content uses anymore, because
+// tmdb gave it a new one or it was removed from every list.
+// Returns the amount removed and bytes reclaimed.
+func cleanupStaleBackdrops(db *gorm.DB) (int, int64, error) {
+	var used []string
+	err := db.Model(&Content{}).
+		Where("backdrop_path != '' AND id IN (SELECT content_id FROM watcheds WHERE deleted_at IS NULL AND content_id IS NOT NULL)").
+		Pluck("backdrop_path", &used).Error
+	if err != nil {
+		slog.Error("cleanupStaleBackdrops: failed to get backdrop paths in use", "error", err)
+		return 0, 0, errors.New("failed to get backdrop paths in use")
+	}
+	inUse := make(map[string]bool, len(used))
+	for _, v := range used {
+		inUse[path.Base(v)] = true
+	}
+	removed, reclaimed, err := removeStaleImageFiles(getTaskRunContext("cleanup_images"), "cleanupStaleBackdrops", path.Join(DataPath, "img", backdropDir), inUse)
+	if err != nil {
+		return removed, reclaimed, fmt.Errorf("stale backdrops: %w", err)
+	}
+	return removed, reclaimed, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheBackdrops(t *testing.T) {
+	useTestConfig(t)
+	useTestTMDBLimiter(t)
+	Config.TASK_BACKDROP_SIZE = "w780"
+	var (
+		requests = map[string]int{}
+		mu       sync.Mutex
+	)
+	useTestTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/t/p/w780/missing.jpg", "/t/p/w780/empty.jpg":
+			w.Write([]byte("backdrop"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	db := newTestDb(t)
+	user := User{Username: "backdrops"}
+	db.Create(&user)
+	track := func(c Content) {
+		db.Create(&c)
+		db.Create(&Watched{UserID: user.ID, ContentID: &c.ID, Status: FINISHED})
+	}
+	track(Content{TmdbID: 1, Title: "Missing", Type: MOVIE, PosterPath: "/poster.jpg", BackdropPath: "/missing.jpg"})
+	// Left empty by a failed download.
+	track(Content{TmdbID: 2, Title: "Empty", Type: MOVIE, BackdropPath: "/empty.jpg"})
+	track(Content{TmdbID: 3, Title: "Cached", Type: SHOW, BackdropPath: "/cached.jpg"})
+	track(Content{TmdbID: 4, Title: "No Backdrop", Type: MOVIE})
+	db.Create(&Content{TmdbID: 5, Title: "Untracked", Type: MOVIE, BackdropPath: "/untracked.jpg"})
+	os.MkdirAll(path.Join(DataPath, "img", backdropDir), 0755)
+	os.WriteFile(backdropCachePath("/empty.jpg"), nil, 0644)
+	os.WriteFile(backdropCachePath("/cached.jpg"), []byte("backdrop"), 0644)
+
+	if err := cacheBackdrops(db); err != nil {
+		t.Fatalf("cache failed: %v", err)
+	}
+	s := getTaskStatus("cache_backdrops").Summary
+	if s["tracked"] != 3 || s["missing"] != 2 || s["cached"] != int32(2) || s["failed"] != 0 || s["size"] != "w780" {
+		t.Errorf("got summary %v, want 2 of 3 tracked backdrops cached at w780", s)
+	}
+	for _, p := range []string{"/missing.jpg", "/empty.jpg"} {
+		if b, err := os.ReadFile(backdropCachePath(p)); err != nil || string(b) != "backdrop" {
+			t.Errorf("backdrop %s wasn't cached: %v", p, err)
+		}
+	}
+	if _, err := os.Stat(posterCachePath("/missing.jpg")); err == nil {
+		t.Error("backdrop cached with the posters")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 2 {
+		t.Errorf("got requests %v, want only the 2 missing backdrops", requests)
+	}
+}
+
+func TestCleanupImagesRemovesOrphanedBackdrops(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	user := User{Username: "backdrops"}
+	db.Create(&user)
+	used := Content{TmdbID: 1, Title: "Tracked", Type: MOVIE, PosterPath: "/poster.jpg", BackdropPath: "/used.jpg"}
+	db.Create(&used)
+	db.Create(&Watched{UserID: user.ID, ContentID: &used.ID, Status: FINISHED})
+	removed := Content{TmdbID: 2, Title: "Removed", Type: MOVIE, BackdropPath: "/removed.jpg"}
+	db.Create(&removed)
+	w := Watched{UserID: user.ID, ContentID: &removed.ID, Status: PLANNED}
+	db.Create(&w)
+	db.Delete(&w)
+
+	os.MkdirAll(path.Join(DataPath, "img", backdropDir), 0755)
+	old := time.Now().Add(-2 * stalePosterMinAge)
+	for _, p := range []string{"/used.jpg", "/removed.jpg", "/replaced.jpg", "/new.jpg"} {
+		os.WriteFile(backdropCachePath(p), []byte("backdrop"), 0644)
+		if p != "/new.jpg" {
+			os.Chtimes(backdropCachePath(p), old, old)
+		}
+	}
+	os.WriteFile(posterCachePath("/poster.jpg"), []byte("poster"), 0644)
+	os.Chtimes(posterCachePath("/poster.jpg"), old, old)
+
+	if err := cleanupImages(db); err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+	s := getTaskStatus("cleanup_images").Summary
+	if s["removedBackdrops"] != 2 || s["removedBackdropsBytes"] != int64(2*len("backdrop")) || s["removedPosters"] != 0 || s["removedPostersBytes"] != int64(0) {
+		t.Errorf("got summary %v, want 2 backdrops and their bytes, and no posters removed", s)
+	}
+	for p, kept := range map[string]bool{"/used.jpg": true, "/removed.jpg": false, "/replaced.jpg": false, "/new.jpg": true} {
+		if _, err := os.Stat(backdropCachePath(p)); (err == nil) != kept {
+			t.Errorf("backdrop %s kept is %v, want %v", p, err == nil, kept)
+		}
+	}
+	if _, err := os.Stat(posterCachePath("/poster.jpg")); err != nil {
+		t.Errorf("poster of tracked content removed with the backdrops: %v", err)
+	}
+}
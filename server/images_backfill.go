@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	taskIdBackfillImages = "backfill_images"
+	// Max content backfilled per run, the rest are picked up next run.
+	imageBackfillMaxPerRun = 100
+	// Time between backfilling each content, so we don't hammer tmdb.
+	imageBackfillInterval = 250 * time.Millisecond
+	// Content tried (whether it worked or not) isn't tried again for this
+	// long, so content tmdb has no images for doesn't fill every run.
+	imageBackfillRetryAfter = 7 * 24 * time.Hour
+)
+
+// Poster and backdrop paths of content, from tmdb.
+type tmdbContentImages struct {
+	PosterPath   string `json:"poster_path"`
+	BackdropPath string `json:"backdrop_path"`
+}
+
+// If the image at `p` is cached (exists and isn't empty).
+func isImageCached(p string) bool {
+	info, err := os.Stat(p)
+	return err == nil && info.Size() > 0
+}
+
+// Fetch images of tracked content that has neither its poster nor its
+// backdrop cached, eg. because it was added while tmdb was down and its
+// images were never fetched at all. Content with no image paths saved
+// has them fetched from tmdb first. Refetch Missing Posters and Cache
+// Backdrops only cover content whose paths we already have.
+// Runs can be cancelled, content not reached is left for the next run.
+// Content never tried is backfilled first, content tried in the last
+// imageBackfillRetryAfter is skipped.
+func backfillImages(db *gorm.DB) error {
+	var tracked []Content
+	res := db.Model(&Content{}).
+		Select("id", "tmdb_id", "type", "title", "poster_path", "backdrop_path", "images_backfilled_at").
+		Where("id IN (SELECT content_id FROM watcheds WHERE deleted_at IS NULL AND content_id IS NOT NULL)").
+		Order("images_backfilled_at IS NOT NULL, images_backfilled_at ASC").
+		Find(&tracked)
+	if res.Error != nil {
+		slog.Error("backfillImages: Failed to get tracked content", "error", res.Error)
+		return errors.New("failed to get tracked content")
+	}
+	var (
+		missing          []Content
+		recentlyTried    int
+		retryTriedBefore = taskClock.Now().Add(-imageBackfillRetryAfter)
+	)
+	for _, c := range tracked {
+		posterCached := c.PosterPath != "" && isImageCached(posterCachePath(c.PosterPath))
+		backdropCached := c.BackdropPath != "" && isImageCached(backdropCachePath(c.BackdropPath))
+		if posterCached || backdropCached {
+			continue
+		}
+		if c.ImagesBackfilledAt != nil && c.ImagesBackfilledAt.After(retryTriedBefore) {
+			recentlyTried++
+			continue
+		}
+		missing = append(missing, c)
+	}
+	queued := missing
+	if len(queued) > imageBackfillMaxPerRun {
+		queued = queued[:imageBackfillMaxPerRun]
+	}
+	var (
+		succeeded int
+		failed    int
+		cancelled bool
+	)
+	ticker := time.NewTicker(imageBackfillInterval)
+	defer ticker.Stop()
+	for _, c := range queued {
+		<-ticker.C
+		if isTaskRunCancelled(taskIdBackfillImages) {
+			slog.Info("backfillImages: Run cancelled.", "done", succeeded+failed, "queued", len(queued))
+			cancelled = true
+			break
+		}
+		err := backfillContentImages(db, c)
+		// Recorded either way, so content that keeps failing doesn't hold up the rest.
+		if res := db.Model(&Content{}).Where("id = ?", c.ID).Update("images_backfilled_at", taskClock.Now()); res.Error != nil {
+			slog.Error("backfillImages: Failed to record backfill attempt", "content_id", c.ID, "error", res.Error)
+		}
+		if err != nil {
+			slog.Error("backfillImages: Failed to backfill images", "content_id", c.ID, "title", c.Title, "error", err)
+			failed++
+			continue
+		}
+		succeeded++
+	}
+	setTaskSummary(taskIdBackfillImages, map[string]any{
+		"missing":       len(missing),
+		"recentlyTried": recentlyTried,
+		"queued":        len(queued),
+		"succeeded":     succeeded,
+		"failed":        failed,
+		"cancelled":     cancelled,
+	})
+	if failed > 0 {
+		return fmt.Errorf("failed to backfill images of %d of %d content", failed, succeeded+failed)
+	}
+	return nil
+}
+
+// Fetch the poster and backdrop of `c`, getting their paths from
+// tmdb first if we have neither.
+func backfillContentImages(db *gorm.DB, c Content) error {
+	if c.PosterPath == "" && c.BackdropPath == "" {
+		var imgs tmdbContentImages
+		if err := tmdbTaskRequest(taskIdBackfillImages, "/"+string(c.Type)+"/"+strconv.Itoa(c.TmdbID), map[string]string{}, &imgs); err != nil {
+			// Not wrapped, request errors can include our api key.
+			return errors.New("request to tmdb failed")
+		}
+		if imgs.PosterPath == "" && imgs.BackdropPath == "" {
+			slog.Debug("backfillContentImages: Content has no images on tmdb.", "content_id", c.ID)
+			return nil
+		}
+		res := db.Model(&Content{}).Where("id = ?", c.ID).Updates(map[string]any{"poster_path": imgs.PosterPath, "backdrop_path": imgs.BackdropPath})
+		if res.Error != nil {
+			slog.Error("backfillContentImages: Failed to save image paths", "content_id", c.ID, "error", res.Error)
+			return errors.New("failed to save image paths")
+		}
+		c.PosterPath = imgs.PosterPath
+		c.BackdropPath = imgs.BackdropPath
+	}
+	var errs []error
+	if c.PosterPath != "" {
+		// Forced, so empty files are replaced.
+		if err := downloadPosterFor(taskIdBackfillImages, c.PosterPath, true); err != nil {
+			errs = append(errs, fmt.Errorf("poster: %w", err))
+		}
+	}
+	if c.BackdropPath != "" {
+		if err := downloadBackdropFor(taskIdBackfillImages, c.BackdropPath, true); err != nil {
+			errs = append(errs, fmt.Errorf("backdrop: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
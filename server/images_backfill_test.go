@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Serve the tmdb api and images from `h` until the test ends.
+func useTestTMDB(t *testing.T, h http.Handler) {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	oldAPI, oldImage := tmdbAPIBase, tmdbImageBase
+	tmdbAPIBase = srv.URL + "/3"
+	tmdbImageBase = srv.URL + "/t/p/"
+	t.Cleanup(func() {
+		tmdbAPIBase, tmdbImageBase = oldAPI, oldImage
+		srv.Close()
+	})
+}
+
+func TestBackfillImagesOfContentWithNoneCached(t *testing.T) {
+	useTestConfig(t)
+	useTestTMDBLimiter(t)
+	clock := useFakeTaskClock(t, time.Now())
+	var (
+		requests = map[string]int{}
+		mu       sync.Mutex
+	)
+	useTestTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/t/p/w500/never-fetched.jpg":
+			w.Write([]byte("poster"))
+		case "/3/movie/2":
+			// Tmdb has no images for it.
+			w.Write([]byte(`{}`))
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	getRequests := func(p string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests[p]
+	}
+
+	db := newTestDb(t)
+	user := User{Username: "backfill"}
+	db.Create(&user)
+	track := func(c Content) Content {
+		db.Create(&c)
+		db.Create(&Watched{UserID: user.ID, ContentID: &c.ID, Status: FINISHED})
+		return c
+	}
+	// Paths saved, but never downloaded.
+	track(Content{TmdbID: 1, Title: "Never Fetched", Type: MOVIE, PosterPath: "/never-fetched.jpg"})
+	// Added while tmdb was down, no paths saved.
+	noImages := track(Content{TmdbID: 2, Title: "No Images", Type: MOVIE})
+	// Already cached.
+	track(Content{TmdbID: 3, Title: "Cached", Type: MOVIE, PosterPath: "/cached.jpg"})
+	os.MkdirAll(path.Join(DataPath, "img"), 0755)
+	os.WriteFile(posterCachePath("/cached.jpg"), []byte("poster"), 0644)
+	// Not tracked by anyone.
+	db.Create(&Content{TmdbID: 4, Title: "Untracked", Type: MOVIE})
+
+	if err := backfillImages(db); err != nil {
+		t.Fatalf("backfill failed: %v", err)
+	}
+	s := getTaskStatus(taskIdBackfillImages).Summary
+	if s["missing"] != 2 || s["succeeded"] != 2 || s["failed"] != 0 {
+		t.Errorf("got summary %v, want 2 missing and succeeded", s)
+	}
+	if !isImageCached(posterCachePath("/never-fetched.jpg")) {
+		t.Error("never fetched poster wasn't downloaded")
+	}
+	var c Content
+	db.Take(&c, noImages.ID)
+	if c.ImagesBackfilledAt == nil {
+		t.Fatal("attempt at content with no images wasn't recorded")
+	}
+
+	// Tried recently, so it isn't every run.
+	if err := backfillImages(db); err != nil {
+		t.Fatalf("second backfill failed: %v", err)
+	}
+	if n := getRequests("/3/movie/2"); n != 1 {
+		t.Errorf("content with no images requested %d times, want once", n)
+	}
+	if s := getTaskStatus(taskIdBackfillImages).Summary; s["missing"] != 0 || s["recentlyTried"] != 1 {
+		t.Errorf("got summary %v, want nothing missing and 1 recently tried", s)
+	}
+
+	clock.Advance(imageBackfillRetryAfter + time.Hour)
+	if err := backfillImages(db); err != nil {
+		t.Fatalf("third backfill failed: %v", err)
+	}
+	if n := getRequests("/3/movie/2"); n != 2 {
+		t.Errorf("content with no images requested %d times after the retry wait, want twice", n)
+	}
+}
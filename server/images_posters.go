@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Max posters refetched per run, the rest are picked up next run.
+	posterRefetchMaxPerRun = 500
+	// Time between starting each poster download, so we don't hammer tmdb.
+	posterRefetchInterval = 200 * time.Millisecond
+)
+
+// Refetch posters of tracked content that are missing from our img dir
+// (or are empty files), eg. because downloading it failed when the
+// content was added and the retry queue gave up.
+func refetchMissingPosters(db *gorm.DB) error {
+	var posters []string
+	res := db.Model(&Content{}).
+		Where("poster_path != '' AND id IN (SELECT content_id FROM watcheds WHERE deleted_at IS NULL AND content_id IS NOT NULL)").
+		Distinct().
+		Pluck("poster_path", &posters)
+	if res.Error != nil {
+		slog.Error("refetchMissingPosters: Failed to get poster paths of tracked content", "error", res.Error)
+		return errors.New("failed to get poster paths of tracked content")
+	}
+	var missing []string
+	for _, p := range posters {
+		info, err := os.Stat(posterCachePath(p))
+		if err == nil && info.Size() > 0 {
+			continue
+		}
+		if err != nil && !os.IsNotExist(err) {
+			slog.Error("refetchMissingPosters: Failed to stat poster", "poster_path", p, "error", err)
+			continue
+		}
+		missing = append(missing, p)
+	}
+	requeued := missing
+	if len(requeued) > posterRefetchMaxPerRun {
+		requeued = requeued[:posterRefetchMaxPerRun]
+	}
+	workers := getImageWorkers()
+	var (
+		succeeded atomic.Int32
+		wg        sync.WaitGroup
+	)
+	paths := make(chan string)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range paths {
+				// Forced, so empty files are replaced.
+				if err := downloadPosterFor("refetch_missing_posters", p, true); err != nil {
+					slog.Error("refetchMissingPosters: Failed to download poster", "poster_path", p, "error", err)
+					continue
+				}
+				succeeded.Add(1)
+			}
+		}()
+	}
+	ticker := time.NewTicker(posterRefetchInterval)
+	for _, p := range requeued {
+		<-ticker.C
+		paths <- p
+	}
+	ticker.Stop()
+	close(paths)
+	wg.Wait()
+	failed := len(requeued) - int(succeeded.Load())
+	setTaskSummary("refetch_missing_posters", map[string]any{
+		"missing":   len(missing),
+		"requeued":  len(requeued),
+		"succeeded": succeeded.Load(),
+		"failed":    failed,
+	})
+	if failed > 0 {
+		return fmt.Errorf("failed to refetch %d of %d missing posters", failed, len(requeued))
+	}
+	return nil
+}
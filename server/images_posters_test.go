@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"testing"
+)
+
+func TestRefetchMissingPosters(t *testing.T) {
+	useTestConfig(t)
+	useTestTMDBLimiter(t)
+	var (
+		requests = map[string]int{}
+		mu       sync.Mutex
+	)
+	useTestTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/t/p/w500/missing.jpg", "/t/p/w500/empty.jpg":
+			w.Write([]byte("poster"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	db := newTestDb(t)
+	user := User{Username: "posters"}
+	db.Create(&user)
+	track := func(c Content) {
+		db.Create(&c)
+		db.Create(&Watched{UserID: user.ID, ContentID: &c.ID, Status: FINISHED})
+	}
+	track(Content{TmdbID: 1, Title: "Missing", Type: MOVIE, PosterPath: "/missing.jpg"})
+	// Left empty by a failed download.
+	track(Content{TmdbID: 2, Title: "Empty", Type: MOVIE, PosterPath: "/empty.jpg"})
+	track(Content{TmdbID: 3, Title: "Cached", Type: MOVIE, PosterPath: "/cached.jpg"})
+	// Tmdb doesn't have it anymore.
+	track(Content{TmdbID: 4, Title: "Gone", Type: MOVIE, PosterPath: "/gone.jpg"})
+	db.Create(&Content{TmdbID: 5, Title: "Untracked", Type: MOVIE, PosterPath: "/untracked.jpg"})
+	os.MkdirAll(path.Join(DataPath, "img"), 0755)
+	os.WriteFile(posterCachePath("/empty.jpg"), nil, 0644)
+	os.WriteFile(posterCachePath("/cached.jpg"), []byte("poster"), 0644)
+
+	if err := refetchMissingPosters(db); err == nil {
+		t.Error("no error with a poster that failed to download")
+	}
+	s := getTaskStatus("refetch_missing_posters").Summary
+	if s["missing"] != 3 || s["requeued"] != 3 || s["succeeded"] != int32(2) || s["failed"] != 1 {
+		t.Errorf("got summary %v, want 3 missing requeued with 2 succeeded", s)
+	}
+	for _, p := range []string{"/missing.jpg", "/empty.jpg"} {
+		if info, err := os.Stat(posterCachePath(p)); err != nil || info.Size() == 0 {
+			t.Errorf("poster %s wasn't refetched", p)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, p := range []string{"/t/p/w500/cached.jpg", "/t/p/w500/untracked.jpg"} {
+		if n := requests[p]; n != 0 {
+			t.Errorf("requested %s %d times, want it left alone", p, n)
+		}
+	}
+}
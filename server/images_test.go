@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Add unused images (not anyones avatar or game cover) with files.
+func addUnusedTestImages(t *testing.T, db *gorm.DB, n int) {
+	t.Helper()
+	if err := os.MkdirAll(path.Join(DataPath, "img"), 0755); err != nil {
+		t.Fatalf("failed to create img dir: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		p := path.Join("img", "unused"+string(rune('a'+i))+".jpg")
+		if err := os.WriteFile(path.Join(DataPath, p), []byte("img"), 0644); err != nil {
+			t.Fatalf("failed to write image: %v", err)
+		}
+		if err := db.Create(&Image{Hash: p, Path: p}).Error; err != nil {
+			t.Fatalf("failed to add image: %v", err)
+		}
+	}
+}
+
+func TestCleanupUnusedImages(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	addUnusedTestImages(t, db, 3)
+	removed, err := cleanupUnusedImages(db)
+	if err != nil || removed != 3 {
+		t.Fatalf("removed %d (%v), want 3", removed, err)
+	}
+	var left int64
+	db.Model(&Image{}).Count(&left)
+	if left != 0 {
+		t.Errorf("%d image rows left, want 0", left)
+	}
+}
+
+func TestCleanupUnusedImagesStopsWhenCancelled(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{
+		"cleanup_images": {name: "Cleanup Images", f: func() error { return nil }, dd: time.Hour, cancellable: true},
+	})
+	db := newTestDb(t)
+	addUnusedTestImages(t, db, 3)
+	token, ok := startTaskRun("cleanup_images")
+	if !ok {
+		t.Fatal("failed to start run")
+	}
+	defer finishTaskRun("cleanup_images", token)
+	if err := cancelTaskRun("cleanup_images"); err != nil {
+		t.Fatalf("failed to cancel: %v", err)
+	}
+	if getTaskRunContext("cleanup_images").Err() == nil {
+		t.Fatal("cancelled runs context isn't done")
+	}
+	removed, err := cleanupUnusedImages(db)
+	if err == nil || removed != 0 {
+		t.Errorf("cancelled run removed %d (%v), want none and an error", removed, err)
+	}
+	var left int64
+	db.Model(&Image{}).Count(&left)
+	if left != 3 {
+		t.Errorf("%d image rows left, want all 3", left)
+	}
+}
+
+// Add `n` poster files to the img dir, old enough to be removed if
+// unused. Every third one is used by content. Returns the used names.
+func addTestPosters(t *testing.T, db *gorm.DB, n int) map[string]bool {
+	t.Helper()
+	dir := path.Join(DataPath, "img")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("failed to create img dir: %v", err)
+	}
+	old := time.Now().Add(-2 * stalePosterMinAge)
+	used := map[string]bool{}
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("poster%d.jpg", i)
+		p := path.Join(dir, name)
+		if err := os.WriteFile(p, []byte("img"), 0644); err != nil {
+			t.Fatalf("failed to write poster: %v", err)
+		}
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatalf("failed to age poster: %v", err)
+		}
+		if i%3 == 0 {
+			used[name] = true
+			db.Create(&Content{TmdbID: i + 1, Title: name, Type: MOVIE, PosterPath: "/" + name})
+		}
+	}
+	return used
+}
+
+func TestCleanupStalePostersParallel(t *testing.T) {
+	for _, workers := range []int{1, 8} {
+		t.Run(fmt.Sprint(workers, " workers"), func(t *testing.T) {
+			useTestConfig(t)
+			Config.TASK_CLEANUP_IMAGES_WORKERS = workers
+			db := newTestDb(t)
+			used := addTestPosters(t, db, 300)
+			removed, reclaimed, err := cleanupStalePosters(db)
+			if err != nil || removed != 200 || reclaimed != int64(200*len("img")) {
+				t.Fatalf("removed %d, reclaimed %d bytes (%v), want 200 posters", removed, reclaimed, err)
+			}
+			entries, _ := os.ReadDir(path.Join(DataPath, "img"))
+			if len(entries) != len(used) {
+				t.Fatalf("%d posters left, want the %d used", len(entries), len(used))
+			}
+			for _, e := range entries {
+				if !used[e.Name()] {
+					t.Errorf("unused poster %s left", e.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestCleanupStalePostersStopsWhenCancelled(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_CLEANUP_IMAGES_WORKERS = 4
+	useTestScheduler(t, map[string]TaskFunc{
+		"cleanup_images": {name: "Cleanup Images", f: func() error { return nil }, dd: time.Hour, cancellable: true},
+	})
+	db := newTestDb(t)
+	addTestPosters(t, db, 30)
+	token, ok := startTaskRun("cleanup_images")
+	if !ok {
+		t.Fatal("failed to start run")
+	}
+	defer finishTaskRun("cleanup_images", token)
+	if err := cancelTaskRun("cleanup_images"); err != nil {
+		t.Fatalf("failed to cancel: %v", err)
+	}
+	if removed, _, err := cleanupStalePosters(db); err == nil || removed != 0 {
+		t.Errorf("cancelled run removed %d (%v), want none and an error", removed, err)
+	}
+	if _, _, err := cleanupImageJunk(); err == nil {
+		t.Error("cancelled junk cleanup didn't return an error")
+	}
+}
+
+// Write an image file at `p` (in the data dir), old enough to be removed if unused.
+func writeTestImageFile(t *testing.T, p string) {
+	t.Helper()
+	writeTestImageFileAt(t, p, time.Now().Add(-2*stalePosterMinAge))
+}
+
+// Write an image file at `p` (in the data dir), last modified at `mod`.
+func writeTestImageFileAt(t *testing.T, p string, mod time.Time) {
+	t.Helper()
+	full := path.Join(DataPath, p)
+	if err := os.MkdirAll(path.Dir(full), 0755); err != nil {
+		t.Fatalf("failed to create image dir: %v", err)
+	}
+	if err := os.WriteFile(full, []byte("img"), 0644); err != nil {
+		t.Fatalf("failed to write image: %v", err)
+	}
+	if err := os.Chtimes(full, mod, mod); err != nil {
+		t.Fatalf("failed to set image mod time: %v", err)
+	}
+}
+
+func TestCleanupImagesKeepsAvatarsAndGameCovers(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	avatar := Image{Hash: "avatar", Path: "img/up/a/avatar.png"}
+	db.Create(&avatar)
+	writeTestImageFile(t, avatar.Path)
+	db.Create(&User{Username: "user", AvatarID: avatar.ID})
+	cover := Image{Hash: "cover", Path: "img/games/c/cover.png"}
+	db.Create(&cover)
+	writeTestImageFile(t, cover.Path)
+	db.Create(&Game{IgdbID: 1, Name: "Game", PosterID: &cover.ID})
+	// Uploaded without a row yet, not ours to remove.
+	writeTestImageFile(t, "img/up/b/uploading.png")
+	writeTestImageFile(t, "img/stale.jpg")
+	writeTestImageFile(t, "img/partial.jpg.tmp")
+
+	if err := cleanupImages(db); err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+	s := getTaskStatus("cleanup_images").Summary
+	if s["removedJunk"] != 1 || s["removedJunkBytes"] != int64(len("img")) {
+		t.Errorf("got summary %v, want the partial download counted as junk", s)
+	}
+	if s["removedPosters"] != 1 || s["removedPostersBytes"] != int64(len("img")) {
+		t.Errorf("got summary %v, want the stale poster and its bytes counted", s)
+	}
+	for _, p := range []string{avatar.Path, cover.Path, "img/up/b/uploading.png"} {
+		if _, err := os.Stat(path.Join(DataPath, p)); err != nil {
+			t.Errorf("%s was removed: %v", p, err)
+		}
+	}
+	if _, err := os.Stat(path.Join(DataPath, "img/stale.jpg")); !os.IsNotExist(err) {
+		t.Errorf("stale poster wasn't removed: %v", err)
+	}
+	var left int64
+	db.Model(&Image{}).Count(&left)
+	if left != 2 {
+		t.Errorf("%d image rows left, want the avatar and cover", left)
+	}
+}
+
+func TestCleanupUnusedImagesSkipsPathsOutsideImgDir(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	outside := path.Join(DataPath, "watcharr.json")
+	if err := os.WriteFile(outside, []byte("{}"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	db.Create(&Image{Hash: "bad", Path: "img/../watcharr.json"})
+	if removed, err := cleanupUnusedImages(db); err == nil || removed != 0 {
+		t.Errorf("removed %d (%v), want none and an error", removed, err)
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("file outside img dir was removed: %v", err)
+	}
+}
+
+func TestCleanupStalePostersAfterPosterChanged(t *testing.T) {
+	useTestConfig(t)
+	clock := useFakeTaskClock(t, time.Now())
+	db := newTestDb(t)
+	writeTestImageFileAt(t, "img/old.jpg", clock.Now())
+	c := Content{TmdbID: 1, Title: "Movie", Type: MOVIE, PosterPath: "/old.jpg"}
+	db.Create(&c)
+	clock.Advance(stalePosterMinAge)
+	if removed, _, err := cleanupStalePosters(db); err != nil || removed != 0 {
+		t.Fatalf("removed %d (%v) while the poster was in use, want 0", removed, err)
+	}
+
+	// TMDB gave it a new poster, which was just downloaded.
+	db.Model(&c).Update("poster_path", "/new.jpg")
+	writeTestImageFileAt(t, "img/new.jpg", clock.Now())
+	// Downloaded for content that isn't saved yet.
+	writeTestImageFileAt(t, "img/downloading.jpg", clock.Now())
+	if removed, _, err := cleanupStalePosters(db); err != nil || removed != 1 {
+		t.Fatalf("removed %d (%v), want only the old poster", removed, err)
+	}
+	if _, err := os.Stat(path.Join(DataPath, "img", "old.jpg")); !os.IsNotExist(err) {
+		t.Errorf("old poster wasn't removed: %v", err)
+	}
+	for _, name := range []string{"new.jpg", "downloading.jpg"} {
+		if _, err := os.Stat(path.Join(DataPath, "img", name)); err != nil {
+			t.Errorf("%s was removed: %v", name, err)
+		}
+	}
+
+	// Its content was never saved.
+	clock.Advance(stalePosterMinAge)
+	if removed, _, err := cleanupStalePosters(db); err != nil || removed != 1 {
+		t.Fatalf("removed %d (%v), want only the unsaved poster", removed, err)
+	}
+	if _, err := os.Stat(path.Join(DataPath, "img", "downloading.jpg")); !os.IsNotExist(err) {
+		t.Errorf("unsaved poster wasn't removed: %v", err)
+	}
+}
+
+func TestCleanupImageJunk(t *testing.T) {
+	useTestConfig(t)
+	clock := useFakeTaskClock(t, time.Now())
+	dir := path.Join(DataPath, "img")
+	for _, p := range []string{"poster.jpg", "partial.jpg.tmp", "up/a/avatar.png", "up/a/partial.png.tmp", "tmp.jpg", "not.tmp.jpg"} {
+		writeTestImageFile(t, path.Join("img", p))
+	}
+	if err := os.Symlink(path.Join(dir, "poster.jpg"), path.Join(dir, "linked.jpg")); err != nil {
+		t.Fatalf("failed to create link: %v", err)
+	}
+	if err := os.Symlink(path.Join(dir, "gone.jpg"), path.Join(dir, "broken.jpg")); err != nil {
+		t.Fatalf("failed to create broken link: %v", err)
+	}
+	// Partial downloads are old, the broken link could still be downloading.
+	if removed, reclaimed, err := cleanupImageJunk(); err != nil || removed != 2 || reclaimed != int64(2*len("img")) {
+		t.Fatalf("removed %d, reclaimed %d bytes (%v), want both partial downloads", removed, reclaimed, err)
+	}
+	if _, err := os.Lstat(path.Join(dir, "broken.jpg")); err != nil {
+		t.Errorf("new broken link was removed: %v", err)
+	}
+
+	clock.Advance(imageJunkMinAge + time.Second)
+	removed, reclaimed, err := cleanupImageJunk()
+	if err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+	// Broken links don't count towards reclaimed bytes.
+	if removed != 1 || reclaimed != 0 {
+		t.Errorf("removed %d and reclaimed %d bytes, want only the broken link", removed, reclaimed)
+	}
+	for _, p := range []string{"partial.jpg.tmp", "up/a/partial.png.tmp", "broken.jpg"} {
+		if _, err := os.Lstat(path.Join(dir, p)); !os.IsNotExist(err) {
+			t.Errorf("junk %s wasn't removed: %v", p, err)
+		}
+	}
+	for _, p := range []string{"poster.jpg", "up/a/avatar.png", "tmp.jpg", "not.tmp.jpg", "linked.jpg"} {
+		if _, err := os.Lstat(path.Join(dir, p)); err != nil {
+			t.Errorf("%s was removed: %v", p, err)
+		}
+	}
+}
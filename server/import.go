@@ -51,36 +51,43 @@ type ImportResponse struct {
 }
 
 func importContent(db *gorm.DB, userId uint, ar ImportRequest) (ImportResponse, error) {
+	return importContentFor("", db, userId, ar)
+}
+
+// Like `importContent`, for task (or import) `task`. Its tmdb requests
+// are task requests, so a big import can't use up the users quota.
+func importContentFor(task string, db *gorm.DB, userId uint, ar ImportRequest) (ImportResponse, error) {
+	touchTaskImport("import-" + strconv.FormatUint(uint64(userId), 10))
 	// If tmdbId and type passed in request body
 	// we dont need to use a search tmdb request.
 	// Retrieve the details directly.
 	if ar.TmdbID != 0 && (ar.Type == MOVIE || ar.Type == SHOW) {
 		tid := strconv.Itoa(ar.TmdbID)
 		if ar.Type == MOVIE {
-			cr, err := movieDetails(db, tid, "", map[string]string{})
+			cr, err := movieDetailsFor(task, db, tid, "", map[string]string{})
 			if err != nil {
 				return ImportResponse{}, errors.New("movie details request failed")
 			}
 			slog.Debug("import: by tmdbid of movie", "cr", cr)
-			return successfulImport(db, userId, cr.ID, MOVIE, ar)
+			return successfulImport(task, db, userId, cr.ID, MOVIE, ar)
 		} else if ar.Type == SHOW {
-			cr, err := tvDetails(db, tid, "", map[string]string{})
+			cr, err := tvDetailsFor(task, db, tid, "", map[string]string{})
 			if err != nil {
 				return ImportResponse{}, errors.New("tv details request failed")
 			}
 			slog.Debug("import: by tmdbid of tv", "cr", cr)
-			return successfulImport(db, userId, cr.ID, SHOW, ar)
+			return successfulImport(task, db, userId, cr.ID, SHOW, ar)
 		}
 	}
 	// If imdb id passed, attempt to get content with it
 	if ar.ImdbID != "" && (ar.Type == MOVIE || ar.Type == SHOW || ar.Type == SHOW_EPISODE) {
-		if imdbResp, err := searchByExternalId(ar.ImdbID, "imdb"); err == nil {
+		if imdbResp, err := searchByExternalIdFor(task, ar.ImdbID, "imdb"); err == nil {
 			if len(imdbResp.Results) == 1 {
 				onlyResult := imdbResp.Results[0]
 				if onlyResult.MediaType == string(MOVIE) || onlyResult.MediaType == string(SHOW) {
 					// Will only be one result
 					slog.Debug("import: importing imdb match", "imdb_id", ar.ImdbID, "tmdb_id_thatwasfound", onlyResult.ID)
-					return successfulImport(db, userId, onlyResult.ID, ContentType(onlyResult.MediaType), ar)
+					return successfulImport(task, db, userId, onlyResult.ID, ContentType(onlyResult.MediaType), ar)
 				} else if onlyResult.MediaType == string(SHOW_EPISODE) {
 					// Handle episodes differently.
 					// Clients must import tv episodes last so that the actual show can be imported first
@@ -118,7 +125,7 @@ func importContent(db *gorm.DB, userId uint, ar ImportRequest) (ImportResponse,
 		}
 	}
 	// tmdbId not passed.. search for the content by name.
-	sr, err := searchContent(ar.Name, 1)
+	sr, err := searchContentFor(task, ar.Name, 1)
 	if err != nil {
 		slog.Error("import: content search failed", "error", err)
 		return ImportResponse{}, errors.New("Content search failed")
@@ -159,16 +166,16 @@ func importContent(db *gorm.DB, userId uint, ar ImportRequest) (ImportResponse,
 		// If one perfect match found, import it
 		if perfectMatch.ID != 0 {
 			slog.Debug("import: importing from perfect match")
-			return successfulImport(db, userId, perfectMatch.ID, ContentType(perfectMatch.MediaType), ar)
+			return successfulImport(task, db, userId, perfectMatch.ID, ContentType(perfectMatch.MediaType), ar)
 		}
 		return ImportResponse{Type: IMPORT_MULTI, Results: pMatches}, nil
 	} else {
 		slog.Debug("import: success.. only found one result")
-		return successfulImport(db, userId, pMatches[0].ID, ContentType(pMatches[0].MediaType), ar)
+		return successfulImport(task, db, userId, pMatches[0].ID, ContentType(pMatches[0].MediaType), ar)
 	}
 }
 
-func successfulImport(db *gorm.DB, userId uint, contentId int, contentType ContentType, ar ImportRequest) (ImportResponse, error) {
+func successfulImport(task string, db *gorm.DB, userId uint, contentId int, contentType ContentType, ar ImportRequest) (ImportResponse, error) {
 	status := FINISHED
 	if ar.Status != "" {
 		status = ar.Status
@@ -182,7 +189,7 @@ func successfulImport(db *gorm.DB, userId uint, contentId int, contentType Conte
 			}
 		}
 	}
-	w, err := addWatched(db, userId, WatchedAddRequest{
+	w, err := addWatchedFor(task, db, userId, WatchedAddRequest{
 		Status:      status,
 		ContentID:   contentId,
 		ContentType: contentType,
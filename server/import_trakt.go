@@ -95,6 +95,7 @@ type TraktImportResponse struct {
 
 // TODO we could support trakt list imports when we support a similar feature (tags will function as custom lists when done #199)
 func startTraktImport(db *gorm.DB, jobId string, userId uint, traktUsername string) {
+	ctx := getJobContext(jobId)
 	// Get trakt user. We want to get their profile `slug` for use in
 	// next requests and we can check their profile isn't private while here.
 	var traktUser TraktUser
@@ -159,6 +160,10 @@ func startTraktImport(db *gorm.DB, jobId string, userId uint, traktUsername stri
 			rProc(v)
 		}
 		for i := range pageCountNum {
+			if ctx.Err() != nil {
+				slog.Info("startTraktImport: Job cancelled, stopping.", "job_id", jobId, "user_id", userId)
+				return
+			}
 			slog.Debug("startTraktImport: Getting history page", "page_num", i)
 			_, err := traktAPIRequest("users/"+userSlug+"/history", map[string]string{"limit": "1000", "page": strconv.Itoa(i)}, &history)
 			if err != nil {
@@ -321,7 +326,11 @@ func startTraktImport(db *gorm.DB, jobId string, userId uint, traktUsername stri
 	}
 	// Loop over `toImport` and finally import everything.
 	for _, v := range toImport {
-		_, err := importContent(db, userId, v)
+		if ctx.Err() != nil {
+			slog.Info("startTraktImport: Job cancelled, stopping.", "job_id", jobId, "user_id", userId)
+			return
+		}
+		_, err := importContentFor("trakt_import", db, userId, v)
 		if err != nil {
 			slog.Error("startTraktImport: Failed to do import on content!", "error", err, "import_obj", v)
 			addJobError(jobId, userId, fmt.Sprintf("Failed to import %s as %s. tmdbId: %d", v.Type, v.Status, v.TmdbID))
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Tokens expiring within this are refreshed by
+// the Refresh Integration Tokens task.
+const integrationTokenRefreshWindow = 12 * time.Hour
+
+// How refreshing one users integration token went, reported
+// per user in the Refresh Integration Tokens summary.
+type IntegrationTokenUserResult struct {
+	// "refreshed", "needsReauth" or "failed".
+	Result    string     `json:"result"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Refresh integration access tokens that are close to expiring, so syncs
+// don't fail part way through. Currently only trakt tokens can be refreshed
+// (plex and jellyfin tokens don't expire).
+// Links trakt rejects are flagged as needing reauth and skipped from then on.
+func refreshIntegrationTokens(db *gorm.DB) error {
+	if !isTraktSyncEnabled() {
+		slog.Debug("refreshIntegrationTokens: No integrations with refreshable tokens enabled, skipping.")
+		return nil
+	}
+	var links []TraktSync
+	res := db.Where("needs_reauth = ? AND expires_at < ?", false, time.Now().Add(integrationTokenRefreshWindow)).Find(&links)
+	if res.Error != nil {
+		slog.Error("refreshIntegrationTokens: Failed to get trakt links", "error", res.Error)
+		return errors.New("failed to get trakt links")
+	}
+	var (
+		refreshed   int
+		needsReauth int
+		errs        []error
+	)
+	users := map[string]IntegrationTokenUserResult{}
+	for _, v := range links {
+		uid := strconv.FormatUint(uint64(v.UserID), 10)
+		if _, err := traktSyncRefreshTokenWithin(db, &v, integrationTokenRefreshWindow); err != nil {
+			if errors.Is(err, errTraktNeedsReauth) {
+				slog.Warn("refreshIntegrationTokens: Trakt rejected refresh token, user must relink.", "user_id", v.UserID)
+				needsReauth++
+				users[uid] = IntegrationTokenUserResult{Result: "needsReauth"}
+				continue
+			}
+			slog.Error("refreshIntegrationTokens: Failed to refresh trakt token", "user_id", v.UserID, "error", err)
+			errs = append(errs, fmt.Errorf("trakt user %d: %w", v.UserID, err))
+			users[uid] = IntegrationTokenUserResult{Result: "failed", Error: err.Error()}
+			continue
+		}
+		slog.Debug("refreshIntegrationTokens: Refreshed trakt token", "user_id", v.UserID, "expires_at", v.ExpiresAt)
+		refreshed++
+		expiresAt := v.ExpiresAt
+		users[uid] = IntegrationTokenUserResult{Result: "refreshed", ExpiresAt: &expiresAt}
+	}
+	slog.Info("refreshIntegrationTokens: Finished.", "checked", len(links), "refreshed", refreshed, "needs_reauth", needsReauth, "failed", len(errs))
+	setTaskSummary("refresh_integration_tokens", map[string]any{
+		"checked":     len(links),
+		"refreshed":   refreshed,
+		"needsReauth": needsReauth,
+		"failed":      len(errs),
+		"users":       users,
+	})
+	return errors.Join(errs...)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRefreshIntegrationTokens(t *testing.T) {
+	useTestConfig(t)
+	Config.TRAKT_SYNC = TraktSyncSettings{ClientID: "id", ClientSecret: "secret"}
+	useTestTrakt(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["refresh_token"] == "revoked" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if body["refresh_token"] == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(TraktTokenResponse{
+			AccessToken:  "new_" + body["refresh_token"],
+			RefreshToken: "next_" + body["refresh_token"],
+			ExpiresIn:    int64((90 * 24 * time.Hour).Seconds()),
+			CreatedAt:    time.Now().Unix(),
+		})
+	})
+	db := newTestDb(t)
+	links := map[string]TraktSync{
+		"expired":     {ExpiresAt: time.Now().Add(-time.Hour), RefreshToken: "expired"},
+		"soon":        {ExpiresAt: time.Now().Add(time.Hour), RefreshToken: "soon"},
+		"later":       {ExpiresAt: time.Now().Add(2 * integrationTokenRefreshWindow), RefreshToken: "later"},
+		"revoked":     {ExpiresAt: time.Now().Add(time.Hour), RefreshToken: "revoked"},
+		"broken":      {ExpiresAt: time.Now().Add(time.Hour), RefreshToken: "broken"},
+		"relinkFirst": {ExpiresAt: time.Now().Add(-time.Hour), RefreshToken: "relinkFirst", NeedsReauth: true},
+	}
+	ids := map[string]string{}
+	for name, l := range links {
+		u := User{Username: name}
+		db.Create(&u)
+		l.UserID = u.ID
+		l.AccessToken = "old"
+		db.Create(&l)
+		ids[name] = strconv.FormatUint(uint64(u.ID), 10)
+	}
+
+	if err := refreshIntegrationTokens(db); err == nil {
+		t.Error("no error for the link trakt failed to refresh")
+	}
+	get := func(name string) TraktSync {
+		var ts TraktSync
+		db.Where("user_id = ?", ids[name]).Take(&ts)
+		return ts
+	}
+	for _, name := range []string{"expired", "soon"} {
+		ts := get(name)
+		if ts.AccessToken != "new_"+name || ts.RefreshToken != "next_"+name || ts.ExpiresAt.Before(time.Now().Add(80*24*time.Hour)) {
+			t.Errorf("%s link wasn't refreshed: %+v", name, ts)
+		}
+	}
+	for _, name := range []string{"later", "broken", "relinkFirst"} {
+		if ts := get(name); ts.AccessToken != "old" {
+			t.Errorf("%s link was refreshed", name)
+		}
+	}
+	if !get("revoked").NeedsReauth {
+		t.Error("link trakt rejected isn't flagged as needing reauth")
+	}
+
+	s := getTaskStatus("refresh_integration_tokens").Summary
+	if s["checked"] != 4 || s["refreshed"] != 2 || s["needsReauth"] != 1 || s["failed"] != 1 {
+		t.Errorf("got summary %v, want 4 checked, 2 refreshed, 1 needing reauth and 1 failed", s)
+	}
+	users, _ := s["users"].(map[string]IntegrationTokenUserResult)
+	for name, want := range map[string]string{"expired": "refreshed", "soon": "refreshed", "revoked": "needsReauth", "broken": "failed"} {
+		if got := users[ids[name]].Result; got != want {
+			t.Errorf("%s user result is %q, want %q", name, got, want)
+		}
+	}
+	if _, ok := users[ids["later"]]; ok {
+		t.Error("link not near expiry is in the summary")
+	}
+	if users[ids["broken"]].Error == "" {
+		t.Error("failed user has no error in the summary")
+	}
+}
+
+func TestTraktRefreshTokenSentOnce(t *testing.T) {
+	useTestConfig(t)
+	Config.TRAKT_SYNC = TraktSyncSettings{ClientID: "id", ClientSecret: "secret"}
+	var calls atomic.Int32
+	useTestTrakt(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		json.NewEncoder(w).Encode(TraktTokenResponse{
+			AccessToken:  "new",
+			RefreshToken: "next",
+			ExpiresIn:    int64((90 * 24 * time.Hour).Seconds()),
+			CreatedAt:    time.Now().Unix(),
+		})
+	})
+	db := newTestDb(t)
+	u := User{Username: "user"}
+	db.Create(&u)
+	db.Create(&TraktSync{UserID: u.ID, AccessToken: "old", RefreshToken: "once", ExpiresAt: time.Now().Add(time.Hour)})
+
+	// The sync and refresh tasks both hold a copy of the link
+	// from before either refreshed it.
+	var wg sync.WaitGroup
+	for range 2 {
+		var ts TraktSync
+		db.Where("user_id = ?", u.ID).Take(&ts)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := traktSyncRefreshTokenWithin(db, &ts, integrationTokenRefreshWindow); err != nil {
+				t.Errorf("refresh failed: %v", err)
+			}
+			if ts.AccessToken != "new" {
+				t.Errorf("got access token %q after refresh, want the new one", ts.AccessToken)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Errorf("refresh token was sent to trakt %d times, want once", n)
+	}
+}
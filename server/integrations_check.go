@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sbondCo/Watcharr/arr"
+)
+
+// Last known state of an integration, from the Check Integrations task.
+type IntegrationStatus struct {
+	// Integration name, arr servers include their name (eg. `RADARR main`).
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	// Why the last check failed, empty if healthy.
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+	// When the integration last went from healthy to failing (or back).
+	Since time.Time `json:"since"`
+}
+
+const taskIdCheckIntegrations = "check_integrations"
+
+var (
+	integrationStatuses   = map[string]*IntegrationStatus{}
+	integrationStatusesMu sync.Mutex
+)
+
+// Check that every configured integration is still reachable and our
+// credentials for it are still accepted. Admins are notified (via a task
+// event and log) only when an integration starts failing or recovers,
+// not every time it is checked.
+func checkIntegrations() error {
+	checks := map[string]func() error{
+		// Always configured, a default key is used if none is set.
+		"TMDB": func() error {
+			// Errors include the request url (with our key), so aren't returned as is.
+			if _, err := tmdbTaskAPIRequest(taskIdCheckIntegrations, "/configuration", map[string]string{}); err != nil {
+				slog.Debug("checkIntegrations: TMDB request failed.", "error", err)
+				return errors.New("request to tmdb failed")
+			}
+			return nil
+		},
+	}
+	for _, v := range Config.RADARR {
+		a := arr.New(arr.RADARR, &v.Host, &v.Key)
+		checks[string(arr.RADARR)+" "+v.Name] = func() error {
+			_, err := a.GetQualityProfiles()
+			return err
+		}
+	}
+	for _, v := range Config.SONARR {
+		a := arr.New(arr.SONARR, &v.Host, &v.Key)
+		checks[string(arr.SONARR)+" "+v.Name] = func() error {
+			_, err := a.GetQualityProfiles()
+			return err
+		}
+	}
+	if Config.JELLYFIN_HOST != "" {
+		// We have no server credentials for jellyfin (users login with
+		// their own), so we can only check that it is reachable.
+		checks["JELLYFIN"] = func() error {
+			var resp map[string]interface{}
+			return jellyfinAPIRequest("GET", "/System/Info/Public", map[string]string{}, "", "", &resp)
+		}
+	}
+	if Config.PLEX_HOST != "" {
+		checks["PLEX"] = func() error {
+			pi, err := getPlexIdentity(Config.PLEX_HOST)
+			if err != nil {
+				return err
+			}
+			if Config.PLEX_MACHINE_ID != "" && pi.MediaContainer.MachineIdentifier != Config.PLEX_MACHINE_ID {
+				return errors.New("plex machine id does not match PLEX_MACHINE_ID")
+			}
+			return nil
+		}
+	}
+
+	// Checks are ran before taking the lock, they can be slow.
+	results := make(map[string]error, len(checks))
+	for name, check := range checks {
+		results[name] = check()
+	}
+	var errs []error
+	now := time.Now()
+	integrationStatusesMu.Lock()
+	defer integrationStatusesMu.Unlock()
+	for name, err := range results {
+		s, known := integrationStatuses[name]
+		if !known {
+			s = &IntegrationStatus{Name: name, Healthy: true, Since: now}
+			integrationStatuses[name] = s
+		}
+		s.CheckedAt = now
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			s.Error = err.Error()
+			if s.Healthy {
+				s.Healthy = false
+				s.Since = now
+				slog.Warn("checkIntegrations: Integration is failing.", "integration", name, "error", err)
+				publishTaskEvent(TaskEvent{Type: TASK_EVENT_INTEGRATION_FAILED, Task: taskIdCheckIntegrations, Time: now, Reason: name, Error: err.Error()})
+			}
+			continue
+		}
+		s.Error = ""
+		if !s.Healthy {
+			s.Healthy = true
+			s.Since = now
+			slog.Info("checkIntegrations: Integration has recovered.", "integration", name)
+			publishTaskEvent(TaskEvent{Type: TASK_EVENT_INTEGRATION_RECOVERED, Task: taskIdCheckIntegrations, Time: now, Reason: name})
+		}
+	}
+	// Forget integrations that are no longer configured.
+	for name := range integrationStatuses {
+		if _, ok := results[name]; !ok {
+			delete(integrationStatuses, name)
+		}
+	}
+	slog.Info("checkIntegrations: Finished.", "checked", len(checks), "failing", len(errs))
+	return errors.Join(errs...)
+}
+
+// Get last known state of all integrations, sorted by name.
+func getIntegrationStatuses() []IntegrationStatus {
+	integrationStatusesMu.Lock()
+	defer integrationStatusesMu.Unlock()
+	resp := make([]IntegrationStatus, 0, len(integrationStatuses))
+	for _, v := range integrationStatuses {
+		resp = append(resp, *v)
+	}
+	sort.Slice(resp, func(i, j int) bool {
+		return resp[i].Name < resp[j].Name
+	})
+	return resp
+}
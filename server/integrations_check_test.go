@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// Clear integration statuses until the test ends.
+func useTestIntegrationStatuses(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		integrationStatusesMu.Lock()
+		integrationStatuses = map[string]*IntegrationStatus{}
+		integrationStatusesMu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// Fake server answering every request with 200, or 401 while `!healthy`.
+func newTestIntegrationServer(t *testing.T, healthy *atomic.Bool) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/System/Info/Public" {
+			w.Write([]byte("{}"))
+			return
+		}
+		w.Write([]byte("[]"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestCheckIntegrationsNotifiesOnTransitions(t *testing.T) {
+	useTestConfig(t)
+	useTestTMDBLimiter(t)
+	useTestIntegrationStatuses(t)
+	useTestTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+	var radarrHealthy, sonarrHealthy, jellyfinHealthy atomic.Bool
+	radarrHealthy.Store(true)
+	jellyfinHealthy.Store(true)
+	Config.RADARR = []RadarrSettings{{ArrSettings: ArrSettings{Name: "main", Host: newTestIntegrationServer(t, &radarrHealthy), Key: "key"}}}
+	Config.SONARR = []SonarrSettings{{ArrSettings: ArrSettings{Name: "main", Host: newTestIntegrationServer(t, &sonarrHealthy), Key: "bad"}}}
+	Config.JELLYFIN_HOST = newTestIntegrationServer(t, &jellyfinHealthy)
+	events, unsub := subscribeTaskEvents()
+	defer unsub()
+	// Integration events sent since last called.
+	sent := func() []TaskEvent {
+		var got []TaskEvent
+		for {
+			select {
+			case e := <-events:
+				if e.Task == taskIdCheckIntegrations {
+					got = append(got, e)
+				}
+			default:
+				return got
+			}
+		}
+	}
+
+	if err := checkIntegrations(); err == nil {
+		t.Error("check passed with sonarr failing")
+	}
+	healthy := map[string]bool{}
+	for _, v := range getIntegrationStatuses() {
+		healthy[v.Name] = v.Healthy
+	}
+	want := map[string]bool{"TMDB": true, "RADARR main": true, "SONARR main": false, "JELLYFIN": true}
+	if len(healthy) != len(want) {
+		t.Fatalf("got statuses %v, want %v", healthy, want)
+	}
+	for name, v := range want {
+		if healthy[name] != v {
+			t.Errorf("%s healthy is %v, want %v", name, healthy[name], v)
+		}
+	}
+	if got := sent(); len(got) != 1 || got[0].Type != TASK_EVENT_INTEGRATION_FAILED || got[0].Reason != "SONARR main" {
+		t.Fatalf("got events %+v, want sonarr failing", got)
+	}
+
+	// Still failing, no new notification.
+	checkIntegrations()
+	if got := sent(); len(got) != 0 {
+		t.Errorf("got events %+v while still failing, want none", got)
+	}
+
+	sonarrHealthy.Store(true)
+	jellyfinHealthy.Store(false)
+	checkIntegrations()
+	got := sent()
+	if len(got) != 2 {
+		t.Fatalf("got events %+v, want sonarr recovered and jellyfin failing", got)
+	}
+	types := map[string]TaskEventType{}
+	for _, e := range got {
+		types[e.Reason] = e.Type
+	}
+	if types["SONARR main"] != TASK_EVENT_INTEGRATION_RECOVERED || types["JELLYFIN"] != TASK_EVENT_INTEGRATION_FAILED {
+		t.Errorf("got events %+v, want sonarr recovered and jellyfin failing", got)
+	}
+
+	// Removed integrations are forgotten.
+	Config.JELLYFIN_HOST = ""
+	if err := checkIntegrations(); err != nil {
+		t.Errorf("check failed with everything healthy: %v", err)
+	}
+	if n := len(getIntegrationStatuses()); n != 3 {
+		t.Errorf("got %d statuses after removing jellyfin, want 3", n)
+	}
+}
@@ -13,6 +13,10 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// Longest a request to jellyfin can take. Syncs make lots of them,
+// one hanging server mustn't hang a sync.
+const jellyfinTimeout = 30 * time.Second
+
 type JellyfinItemSearchResponse struct {
 	Items []JellyfinItems `json:"Items"`
 }
@@ -97,7 +101,7 @@ func jellyfinAPIRequest(method string, ep string, p map[string]string, username
 	base.RawQuery = params.Encode()
 
 	// Run get request
-	client := &http.Client{}
+	client := &http.Client{Timeout: jellyfinTimeout}
 	req, err := http.NewRequest(method, base.String(), bytes.NewBuffer([]byte{}))
 	if err != nil {
 		slog.Error("Creating request to jellyfin failed", "error", err)
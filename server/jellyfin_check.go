@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"gorm.io/gorm"
+)
+
+// Jellyfin /Users/{id}/Views response, the libraries a user can see.
+type JellyfinViewsResponse struct {
+	Items []struct {
+		Name           string `json:"Name"`
+		Id             string `json:"Id"`
+		CollectionType string `json:"CollectionType"`
+	} `json:"Items"`
+}
+
+// Check the jellyfin connection of every jellyfin user: that their token
+// is still accepted and they can still see a movie or show library (sync
+// imports from these). Users whose connection broke are notified, once
+// until they read it. If the server itself is unreachable, no users are
+// checked (Check Integrations tells admins about that).
+func checkJellyfinConnections(db *gorm.DB) error {
+	var info map[string]interface{}
+	if err := jellyfinAPIRequest("GET", "/System/Info/Public", map[string]string{}, "", "", &info); err != nil {
+		setTaskSummary("check_jellyfin_connections", map[string]any{"reachable": false})
+		return errors.New("jellyfin server is unreachable")
+	}
+	var users []User
+	res := db.Where("type = ? AND third_party_id != '' AND third_party_auth != ''", JELLYFIN_USER).Find(&users)
+	if res.Error != nil {
+		slog.Error("checkJellyfinConnections: Failed to get jellyfin users", "error", res.Error)
+		return errors.New("failed to get jellyfin users")
+	}
+	var (
+		healthy     int
+		broken      int
+		noLibraries int
+	)
+	for _, u := range users {
+		reason := checkJellyfinConnection(u)
+		if reason == "" {
+			healthy++
+			continue
+		}
+		if reason == jellyfinNoLibrariesReason {
+			noLibraries++
+		} else {
+			broken++
+		}
+		slog.Warn("checkJellyfinConnections: Users jellyfin connection is broken.", "user_id", u.ID, "reason", reason)
+		notifyJellyfinBroken(db, u.ID, reason)
+	}
+	setTaskSummary("check_jellyfin_connections", map[string]any{
+		"reachable":   true,
+		"healthy":     healthy,
+		"broken":      broken,
+		"noLibraries": noLibraries,
+	})
+	if broken > 0 {
+		return fmt.Errorf("%d of %d jellyfin connections are broken", broken, len(users))
+	}
+	return nil
+}
+
+const jellyfinNoLibrariesReason = "no movie or show libraries are visible to you on Jellyfin"
+
+// Check the jellyfin connection of user `u`. Returns why it is broken,
+// empty if it isn't.
+func checkJellyfinConnection(u User) string {
+	var views JellyfinViewsResponse
+	err := jellyfinAPIRequest("GET", "/Users/"+u.ThirdPartyID+"/Views", map[string]string{}, u.Username, u.ThirdPartyAuth, &views)
+	if err != nil {
+		if err.Error() == "incorrect details" {
+			return "your Jellyfin login is no longer accepted, logging in with Jellyfin again should fix it"
+		}
+		return "requests to Jellyfin are failing"
+	}
+	for _, v := range views.Items {
+		if v.CollectionType == "movies" || v.CollectionType == "tvshows" {
+			return ""
+		}
+	}
+	return jellyfinNoLibrariesReason
+}
+
+// Notify user `userId` their jellyfin connection is broken, unless
+// they already have an unread notification about it.
+func notifyJellyfinBroken(db *gorm.DB, userId uint, reason string) {
+	var count int64
+	res := db.Model(&Notification{}).Where("user_id = ? AND type = ? AND read_at IS NULL", userId, NOTIFICATION_JELLYFIN_BROKEN).Count(&count)
+	if res.Error != nil {
+		slog.Error("notifyJellyfinBroken: Failed to check existing notifications", "user_id", userId, "error", res.Error)
+		return
+	}
+	if count > 0 {
+		return
+	}
+	n := Notification{UserID: userId, Type: NOTIFICATION_JELLYFIN_BROKEN, Message: "Jellyfin sync will not work, " + reason + "."}
+	if err := db.Create(&n).Error; err != nil {
+		slog.Error("notifyJellyfinBroken: Failed to create notification", "user_id", userId, "error", err)
+	}
+}
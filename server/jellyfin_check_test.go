@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCheckJellyfinConnections(t *testing.T) {
+	useTestConfig(t)
+	type library struct {
+		Name           string
+		Id             string
+		CollectionType string
+	}
+	var (
+		// Libraries each jellyfin user can see.
+		views = map[string][]library{
+			"jf-renamed": {{"Movies", "lib-1", "movies"}, {"Music", "lib-2", "music"}},
+			"jf-removed": {{"Shows", "lib-3", "tvshows"}},
+		}
+		up = true
+		mu sync.Mutex
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !up {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/System/Info/Public" {
+			w.Write([]byte(`{"ServerName":"test"}`))
+			return
+		}
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/Users/"), "/Views")
+		if !strings.Contains(r.Header.Get("X-Emby-Authorization"), `Token="token-`+id+`"`) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"Items": views[id]})
+	}))
+	t.Cleanup(srv.Close)
+	Config.JELLYFIN_HOST = srv.URL
+	db := newTestDb(t)
+	addUser := func(name string, id string, token string) User {
+		u := User{Username: name, Type: JELLYFIN_USER, ThirdPartyID: id, ThirdPartyAuth: token}
+		db.Create(&u)
+		return u
+	}
+	renamed := addUser("renamed", "jf-renamed", "token-jf-renamed")
+	removed := addUser("removed", "jf-removed", "token-jf-removed")
+	expired := addUser("expired", "jf-expired", "old-token")
+	db.Create(&User{Username: "local"})
+	getNotified := func() map[uint]int {
+		t.Helper()
+		var notifs []Notification
+		if err := db.Where("type = ?", NOTIFICATION_JELLYFIN_BROKEN).Find(&notifs).Error; err != nil {
+			t.Fatalf("failed to get notifications: %v", err)
+		}
+		got := map[uint]int{}
+		for _, n := range notifs {
+			got[n.UserID]++
+		}
+		return got
+	}
+
+	if err := checkJellyfinConnections(db); err == nil {
+		t.Error("no error with a broken connection")
+	}
+	want := map[string]any{"reachable": true, "healthy": 2, "broken": 1, "noLibraries": 0}
+	if s := getTaskStatus("check_jellyfin_connections").Summary; !reflect.DeepEqual(s, want) {
+		t.Errorf("got summary %v, want %v", s, want)
+	}
+
+	// Library renamed (its id is the same), the other users show library removed.
+	mu.Lock()
+	views["jf-renamed"] = []library{{"Films", "lib-1", "movies"}, {"Music", "lib-2", "music"}}
+	views["jf-removed"] = []library{}
+	mu.Unlock()
+	checkJellyfinConnections(db)
+	want = map[string]any{"reachable": true, "healthy": 1, "broken": 1, "noLibraries": 1}
+	if s := getTaskStatus("check_jellyfin_connections").Summary; !reflect.DeepEqual(s, want) {
+		t.Errorf("got summary %v after libraries changed, want %v", s, want)
+	}
+	// Expired user isn't notified again while their first is unread.
+	if got, want := getNotified(), map[uint]int{expired.ID: 1, removed.ID: 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got notifications by user %v, want %v (renamed user %d has none)", got, want, renamed.ID)
+	}
+
+	mu.Lock()
+	up = false
+	mu.Unlock()
+	if err := checkJellyfinConnections(db); err == nil {
+		t.Error("no error with jellyfin unreachable")
+	}
+	if s := getTaskStatus("check_jellyfin_connections").Summary; !reflect.DeepEqual(s, map[string]any{"reachable": false}) {
+		t.Errorf("got summary %v with jellyfin unreachable, want only reachable false", s)
+	}
+	if got := getNotified(); len(got) != 2 {
+		t.Errorf("users notified %v with jellyfin unreachable, want no new notifications", got)
+	}
+}
@@ -45,6 +45,7 @@ func startJellyfinSync(
 	userThirdPartyId string,
 	userThirdPartyAuth string,
 ) {
+	ctx := getJobContext(jobId)
 	// Get played movies
 	updateJobCurrentTask(jobId, userId, "syncing movies")
 	playedMovies := new(JellyfinItemSearchResponse)
@@ -69,6 +70,10 @@ func startJellyfinSync(
 			slog.Info("jellyfinSyncWatched: User has no played movies.", "user_id", userId)
 		} else {
 			for _, v := range playedMovies.Items {
+				if ctx.Err() != nil {
+					slog.Info("jellyfinSyncWatched: Job cancelled, stopping.", "job_id", jobId, "user_id", userId)
+					return
+				}
 				slog.Info("jellyfinSyncWatched: Importing played movie.", "movie_name", v.Name, "user_id", userId)
 				slog.Debug("jellyfinSyncWatched: Importing played movie.", "full_item", v, "user_id", userId)
 
@@ -88,7 +93,7 @@ func startJellyfinSync(
 				updateJobCurrentTask(jobId, userId, "syncing "+v.Name)
 
 				// 2. Imported watched movie
-				w, err := addWatched(db, userId, WatchedAddRequest{
+				w, err := addWatchedFor("jf_sync", db, userId, WatchedAddRequest{
 					Status:      FINISHED,
 					ContentID:   tmdbId,
 					ContentType: MOVIE,
@@ -141,6 +146,10 @@ func startJellyfinSync(
 		} else {
 			// Import series
 			for _, v := range allSeries.Items {
+				if ctx.Err() != nil {
+					slog.Info("jellyfinSyncWatched: Job cancelled, stopping.", "job_id", jobId, "user_id", userId)
+					return
+				}
 				slog.Info("jellyfinSyncWatched: Processing series.", "series_name", v.Name, "user_id", userId)
 				slog.Debug("jellyfinSyncWatched: Processing series.", "full_item", v, "user_id", userId)
 
@@ -166,7 +175,7 @@ func startJellyfinSync(
 				updateJobCurrentTask(jobId, userId, "syncing serie "+v.Name)
 
 				// 2. Imported watched series
-				w, err := addWatched(db, userId, WatchedAddRequest{
+				w, err := addWatchedFor("jf_sync", db, userId, WatchedAddRequest{
 					Status:      FINISHED,
 					ContentID:   tmdbId,
 					ContentType: SHOW,
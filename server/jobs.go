@@ -6,8 +6,10 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"log/slog"
+	"sync"
 	"time"
 )
 
@@ -32,112 +34,222 @@ type Job struct {
 	Errors []string `json:"errors"`
 	// Stored for access control.
 	UserId uint `json:"-"`
+	// When the job last made progress (was created or updated).
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Done once the job is done or cancelled. Whatever is running the
+	// job should stop when it is, see `getJobContext`.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-var activeJobs = make(map[string]*Job)
+// Jobs with no progress for this long are considered stuck.
+const jobStuckAfter = 1 * time.Hour
+
+var (
+	activeJobs   = make(map[string]*Job)
+	activeJobsMu sync.Mutex
+)
 
 // Add a job to our activeJobs map.
 // Returns id of job on success, or error if failed to add.
 // Only return safe errors for display to users, log serious errors.
 func addJob(name string, userId uint) (string, error) {
+	return insertJob(name, userId, false)
+}
+
+// Add a job, but only if one with the same `name` isn't already running.
+// Only return safe errors for display to users.
+func addUniqueJob(name string, userId uint) (string, error) {
+	return insertJob(name, userId, true)
+}
+
+// Add a job for `addJob`, if `unique` only if one with the same `name`
+// isn't already running for the user. Checked under the same lock as
+// the job is added, so two requests can't both start one.
+func insertJob(name string, userId uint, unique bool) (string, error) {
 	idk, err := generateString(8)
 	if err != nil {
 		slog.Error("addJob: Failed to generate a job id!", "error", err)
 		return "", errors.New("failed to generate a job id, please try again")
 	}
+	activeJobsMu.Lock()
+	defer activeJobsMu.Unlock()
+	if unique {
+		for _, v := range activeJobs {
+			if v.UserId == userId && v.Name == name && (v.Status == JOB_CREATED || v.Status == JOB_RUNNING) {
+				return "", errors.New("a job of this type is already running, please wait for the existing job to finish")
+			}
+		}
+	}
 	_, ok := activeJobs[idk]
 	if ok {
 		// Lets just hope this doesn't happen, may the odds be with us.
 		return "", errors.New("job already exists with id generated, please try again")
 	}
+	ctx, cancel := context.WithCancel(context.Background())
 	activeJobs[idk] = &Job{
-		Name:   name,
-		Status: JOB_CREATED,
-		UserId: userId,
+		Name:      name,
+		Status:    JOB_CREATED,
+		UserId:    userId,
+		UpdatedAt: time.Now(),
+		ctx:       ctx,
+		cancel:    cancel,
 	}
+	beginTaskImportJob(idk, name)
 	return idk, nil
 }
 
-// Add a job, but only if one with the same `name` isn't already running.
-// Only return safe errors for display to users.
-func addUniqueJob(name string, userId uint) (string, error) {
-	found := false
-	for _, v := range activeJobs {
-		if v.UserId == userId && v.Name == name && (v.Status == JOB_CREATED || v.Status == JOB_RUNNING) {
-			found = true
-			break
-		}
-	}
-	if found {
-		return "", errors.New("a job of this type is already running, please wait for the existing job to finish")
-	}
-	return addJob(name, userId)
-}
-
 func rmJob(id string, userId uint) {
 	slog.Debug("rmJob: Removing a job.", "id", id)
+	activeJobsMu.Lock()
+	defer activeJobsMu.Unlock()
 	v, ok := activeJobs[id]
 	if ok && v.UserId == userId {
+		v.cancel()
 		delete(activeJobs, id)
+		endTaskImportJob(id)
 		slog.Debug("rmJob: Removed a job.", "id", id)
 		return
 	}
 	slog.Debug("rmJob: Job to remove does not exist (or not owned by this user).", "id", id, "user_id", userId)
 }
 
-// Get a job.
-// Returns job if found, otherwise errors if job does not exist.
-func getJob(id string, userId uint) (*Job, error) {
+// Get a job owned by `userId`, must be called with activeJobsMu held.
+func getJobLocked(id string, userId uint) (*Job, error) {
 	j, ok := activeJobs[id]
 	if ok {
 		// Ensure user requesting a job, owns the job.
 		if j.UserId != userId {
 			slog.Warn("getJob: A user tried to access a job they do not own.", "user_id", userId, "job_id", id)
-			return &Job{}, errors.New("job does not exist")
+			return nil, errors.New("job does not exist")
 		}
 		return j, nil
 	}
-	return &Job{}, errors.New("job does not exist")
+	return nil, errors.New("job does not exist")
+}
+
+// Get a copy of a job.
+// Returns job if found, otherwise errors if job does not exist.
+func getJob(id string, userId uint) (Job, error) {
+	activeJobsMu.Lock()
+	defer activeJobsMu.Unlock()
+	j, err := getJobLocked(id, userId)
+	if err != nil {
+		return Job{}, err
+	}
+	c := *j
+	c.Errors = append([]string(nil), j.Errors...)
+	return c, nil
+}
+
+// Get the context of a job, done once the job is done or cancelled
+// (eg. by cleanupStuckJobs). Jobs should check it as they go and stop
+// when it is. Jobs that don't exist get an already done context.
+func getJobContext(id string) context.Context {
+	activeJobsMu.Lock()
+	defer activeJobsMu.Unlock()
+	if j, ok := activeJobs[id]; ok {
+		return j.ctx
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+// Update a job owned by `userId` with `f`, under activeJobsMu.
+func updateJob(id string, userId uint, f func(j *Job)) error {
+	activeJobsMu.Lock()
+	defer activeJobsMu.Unlock()
+	j, err := getJobLocked(id, userId)
+	if err != nil {
+		return err
+	}
+	f(j)
+	j.UpdatedAt = time.Now()
+	return nil
 }
 
 // Update a jobs status.
+// A cancelled job stays cancelled, the import it stopped may still
+// try to set it to done.
 func updateJobStatus(id string, userId uint, status JobStatus) error {
-	j, err := getJob(id, userId)
+	activeJobsMu.Lock()
+	defer activeJobsMu.Unlock()
+	j, err := getJobLocked(id, userId)
 	if err != nil {
 		slog.Error("updateJobStatus: Failed!", "status", status, "error", err)
 		return err
 	}
+	if j.Status == JOB_CANCELLED {
+		return nil
+	}
+	setJobStatusLocked(id, j, status)
+	return nil
+}
+
+// Set the status of job `id`, must be called with activeJobsMu held.
+func setJobStatusLocked(id string, j *Job, status JobStatus) {
 	j.Status = status
-	// If job is set to done, remove it after 1 minute.
+	j.UpdatedAt = time.Now()
+	// If job is set to done, remove it after 30 minutes.
 	if status == JOB_DONE || status == JOB_CANCELLED {
+		j.cancel()
+		endTaskImportJob(id)
 		slog.Debug("updateJobStatus: Job set to done or cancelled. Will be removed after 30m.", "id", id, "status", status)
+		userId := j.UserId
 		go func() {
 			time.Sleep(30 * time.Minute)
 			slog.Debug("updateJobStatus: Job done. waited 30m.. removing job now.", "id", id)
 			rmJob(id, userId)
 		}()
 	}
-	return nil
 }
 
 // Update a jobs current task.
 func updateJobCurrentTask(id string, userId uint, ct string) error {
-	j, err := getJob(id, userId)
+	err := updateJob(id, userId, func(j *Job) {
+		j.CurrentTask = ct
+	})
 	if err != nil {
 		slog.Error("updateJobCurrentTask: Failed!", "ct", ct, "error", err)
-		return err
 	}
-	j.CurrentTask = ct
-	return nil
+	return err
 }
 
 // Add an error to a job.
 func addJobError(id string, userId uint, e string) error {
-	j, err := getJob(id, userId)
+	err := updateJob(id, userId, func(j *Job) {
+		j.Errors = append(j.Errors, e)
+	})
 	if err != nil {
-		slog.Error("updateJobCurrentTask: Failed!", "e", e, "error", err)
-		return err
+		slog.Error("addJobError: Failed!", "e", e, "error", err)
+	}
+	return err
+}
+
+// Cancel jobs that haven't made progress in a while, so their
+// user isn't blocked from starting another (eg. from addUniqueJob).
+// Checked and cancelled under one lock, so a job making progress
+// right now isn't cancelled.
+func cleanupStuckJobs() error {
+	cancelled := 0
+	activeJobsMu.Lock()
+	for id, j := range activeJobs {
+		if (j.Status == JOB_CREATED || j.Status == JOB_RUNNING) && time.Since(j.UpdatedAt) > jobStuckAfter {
+			slog.Warn("cleanupStuckJobs: Cancelling stuck job.", "id", id, "user_id", j.UserId, "name", j.Name)
+			j.Errors = append(j.Errors, "job made no progress for too long and was cancelled")
+			setJobStatusLocked(id, j, JOB_CANCELLED)
+			cancelled++
+		}
+	}
+	active := len(activeJobs)
+	activeJobsMu.Unlock()
+	if cancelled > 0 {
+		slog.Info("cleanupStuckJobs: Cancelled stuck jobs.", "amount", cancelled)
 	}
-	j.Errors = append(j.Errors, e)
+	setTaskSummary("cleanup_stuck_imports", map[string]any{
+		"cancelled": cancelled,
+		"jobs":      active,
+	})
 	return nil
 }
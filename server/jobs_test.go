@@ -0,0 +1,123 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// Clear active jobs until the test ends.
+func useTestJobs(t *testing.T) {
+	t.Helper()
+	activeJobsMu.Lock()
+	old := activeJobs
+	activeJobs = make(map[string]*Job)
+	activeJobsMu.Unlock()
+	t.Cleanup(func() {
+		activeJobsMu.Lock()
+		activeJobs = old
+		activeJobsMu.Unlock()
+	})
+}
+
+// Add a job whose last progress was `age` ago.
+func addTestJob(t *testing.T, status JobStatus, age time.Duration) string {
+	t.Helper()
+	id, err := addJob("test_job", 1)
+	if err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	activeJobsMu.Lock()
+	activeJobs[id].Status = status
+	activeJobs[id].UpdatedAt = time.Now().Add(-age)
+	activeJobsMu.Unlock()
+	return id
+}
+
+func TestCleanupStuckJobs(t *testing.T) {
+	useTestJobs(t)
+	fresh := addTestJob(t, JOB_RUNNING, 10*time.Minute)
+	almost := addTestJob(t, JOB_RUNNING, jobStuckAfter-time.Minute)
+	stuck := addTestJob(t, JOB_RUNNING, 2*time.Hour)
+	stuckCreated := addTestJob(t, JOB_CREATED, 3*time.Hour)
+	oldDone := addTestJob(t, JOB_DONE, 5*time.Hour)
+
+	if err := cleanupStuckJobs(); err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+	for id, want := range map[string]JobStatus{
+		fresh:        JOB_RUNNING,
+		almost:       JOB_RUNNING,
+		stuck:        JOB_CANCELLED,
+		stuckCreated: JOB_CANCELLED,
+		oldDone:      JOB_DONE,
+	} {
+		j, err := getJob(id, 1)
+		if err != nil {
+			t.Fatalf("failed to get job: %v", err)
+		}
+		if j.Status != want {
+			t.Errorf("job last updated %s ago is %s, want %s", time.Since(j.UpdatedAt).Round(time.Minute), j.Status, want)
+		}
+	}
+	if s := getTaskStatus("cleanup_stuck_imports").Summary; s["cancelled"] != 2 {
+		t.Errorf("got summary %v, want 2 cancelled", s)
+	}
+
+	// The import running the job is told to stop, and it can't undo the cancel.
+	if getJobContext(stuck).Err() == nil {
+		t.Error("cancelled jobs context isn't done")
+	}
+	if getJobContext(fresh).Err() != nil {
+		t.Error("running jobs context is done")
+	}
+	updateJobStatus(stuck, 1, JOB_DONE)
+	if j, _ := getJob(stuck, 1); j.Status != JOB_CANCELLED {
+		t.Errorf("cancelled job was set to %s", j.Status)
+	}
+	if j, _ := getJob(stuck, 1); len(j.Errors) != 1 {
+		t.Errorf("cancelled job has errors %v, want why it was cancelled", j.Errors)
+	}
+}
+
+func TestGetJobReturnsCopy(t *testing.T) {
+	useTestJobs(t)
+	id := addTestJob(t, JOB_RUNNING, 0)
+	addJobError(id, 1, "first")
+	j, err := getJob(id, 1)
+	if err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+	j.Status = JOB_DONE
+	j.Errors[0] = "changed"
+	if j, _ := getJob(id, 1); j.Status != JOB_RUNNING || j.Errors[0] != "first" {
+		t.Errorf("changing the returned job changed the active job: %+v", j)
+	}
+	if _, err := getJob(id, 2); err == nil {
+		t.Error("got a job owned by another user")
+	}
+}
+
+func TestAddUniqueJobOnlyOnce(t *testing.T) {
+	useTestJobs(t)
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		added int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := addUniqueJob("test_unique_job", 1); err == nil {
+				mu.Lock()
+				added++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if added != 1 {
+		t.Errorf("added %d unique jobs at once, want 1", added)
+	}
+}
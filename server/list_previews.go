@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"log/slog"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Size of OpenGraph preview images, the size most sites expect.
+	listPreviewWidth  = 1200
+	listPreviewHeight = 630
+	// Posters shown in each preview, and the size they are drawn at.
+	listPreviewPosters      = 5
+	listPreviewPosterWidth  = 220
+	listPreviewPosterHeight = 330
+	listPreviewGap          = 12
+)
+
+// Background previews are drawn on.
+var listPreviewBackground = color.RGBA{R: 18, G: 18, B: 18, A: 255}
+
+// Dir previews are cached in. Not in the img dir, that is served to
+// anyone, previews are only served to those who know the lists username.
+func listPreviewDir() string {
+	return path.Join(DataPath, "previews")
+}
+
+func listPreviewPath(userId uint) string {
+	return path.Join(listPreviewDir(), strconv.FormatUint(uint64(userId), 10)+".jpg")
+}
+
+// Get the cached preview image of a users public list, for link unfurls.
+// Requires the users id and name, like viewing the list itself does.
+func getListPreview(db *gorm.DB, userId uint, username string) (string, error) {
+	var count int64
+	res := db.Model(&User{}).Where("id = ? AND username = ? AND (private IS NULL OR private = 0)", userId, username).Count(&count)
+	if res.Error != nil {
+		slog.Error("getListPreview: Failed to check user", "user_id", userId, "error", res.Error)
+		return "", errors.New("failed to check user")
+	}
+	if count == 0 {
+		return "", errors.New("no public list found")
+	}
+	p := listPreviewPath(userId)
+	if _, err := os.Stat(p); err != nil {
+		return "", errors.New("no preview generated yet")
+	}
+	return p, nil
+}
+
+// Generate preview images of public lists that changed since their
+// preview was made (or have none), and remove previews of lists that
+// are no longer public (or users that no longer exist).
+func generateListPreviews(db *gorm.DB) error {
+	if err := os.MkdirAll(listPreviewDir(), 0764); err != nil {
+		slog.Error("generateListPreviews: Failed to create previews dir", "error", err)
+		return errors.New("failed to create previews dir")
+	}
+	var lists []struct {
+		UserID uint
+		// Last time anything on the list changed, as sqlite returns it.
+		Changed string
+	}
+	res := db.Raw(`SELECT w.user_id, MAX(MAX(w.updated_at), COALESCE(MAX(w.deleted_at), '')) AS changed
+FROM watcheds w
+JOIN users u ON u.id = w.user_id AND u.deleted_at IS NULL AND (u.private IS NULL OR u.private = 0)
+GROUP BY w.user_id`).Scan(&lists)
+	if res.Error != nil {
+		slog.Error("generateListPreviews: Failed to get public lists", "error", res.Error)
+		return errors.New("failed to get public lists")
+	}
+	var (
+		generated int
+		upToDate  int
+		failed    int
+		public    = map[uint]bool{}
+	)
+	for _, l := range lists {
+		public[l.UserID] = true
+		p := listPreviewPath(l.UserID)
+		if info, err := os.Stat(p); err == nil {
+			changed, err := parseSqliteTime(l.Changed)
+			if err == nil && !changed.After(info.ModTime()) {
+				upToDate++
+				continue
+			}
+		}
+		ok, err := generateListPreview(db, l.UserID)
+		if err != nil {
+			slog.Error("generateListPreviews: Failed to generate preview", "user_id", l.UserID, "error", err)
+			failed++
+			continue
+		}
+		if !ok {
+			// Nothing to show, don't keep an old preview around.
+			delete(public, l.UserID)
+			continue
+		}
+		generated++
+	}
+	removed, err := cleanupStaleListPreviews(public)
+	setTaskSummary("generate_list_previews", map[string]any{
+		"generated": generated,
+		"upToDate":  upToDate,
+		"failed":    failed,
+		"removed":   removed,
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to generate %d of %d previews", failed, len(lists)-upToDate)
+	}
+	return nil
+}
+
+// Parse a time as stored by sqlite (gorm saves them as text).
+func parseSqliteTime(s string) (time.Time, error) {
+	for _, l := range []string{"2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05", time.RFC3339Nano} {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("invalid time")
+}
+
+// Draw and save the preview of a users list, a row of their most
+// recently changed posters. Only posters already cached are used.
+// Returns false if the list has no posters to show.
+func generateListPreview(db *gorm.DB, userId uint) (bool, error) {
+	var posters []string
+	res := db.Model(&Watched{}).
+		Joins("JOIN contents c ON c.id = watcheds.content_id").
+		Where("watcheds.user_id = ? AND c.poster_path != ''", userId).
+		Order("watcheds.updated_at DESC").
+		Limit(listPreviewPosters*2).
+		Pluck("c.poster_path", &posters)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	var imgs []image.Image
+	for _, p := range posters {
+		if len(imgs) >= listPreviewPosters {
+			break
+		}
+		img, err := readPosterImage(p)
+		if err != nil {
+			slog.Debug("generateListPreview: Skipping poster", "poster_path", p, "error", err)
+			continue
+		}
+		imgs = append(imgs, img)
+	}
+	if len(imgs) == 0 {
+		return false, nil
+	}
+	canvas := image.NewRGBA(image.Rect(0, 0, listPreviewWidth, listPreviewHeight))
+	draw.Draw(canvas, canvas.Bounds(), &image.Uniform{listPreviewBackground}, image.Point{}, draw.Src)
+	rowWidth := len(imgs)*listPreviewPosterWidth + (len(imgs)-1)*listPreviewGap
+	x := (listPreviewWidth - rowWidth) / 2
+	y := (listPreviewHeight - listPreviewPosterHeight) / 2
+	for _, img := range imgs {
+		drawScaled(canvas, image.Rect(x, y, x+listPreviewPosterWidth, y+listPreviewPosterHeight), img)
+		x += listPreviewPosterWidth + listPreviewGap
+	}
+	// Written to a temp file first, so a half written preview is never served.
+	out := listPreviewPath(userId)
+	f, err := os.Create(out + imageTempSuffix)
+	if err != nil {
+		return false, err
+	}
+	if err := jpeg.Encode(f, canvas, &jpeg.Options{Quality: 85}); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return false, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return false, err
+	}
+	return true, os.Rename(f.Name(), out)
+}
+
+// Read a cached tmdb poster.
+func readPosterImage(posterPath string) (image.Image, error) {
+	f, err := os.Open(posterCachePath(posterPath))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// Draw `src` scaled to fill `r` of `dst`, averaging the source pixels
+// each destination pixel covers (posters are always scaled down).
+func drawScaled(dst *image.RGBA, r image.Rectangle, src image.Image) {
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+	dw, dh := r.Dx(), r.Dy()
+	for dy := 0; dy < dh; dy++ {
+		sy0 := sb.Min.Y + dy*sh/dh
+		sy1 := max(sb.Min.Y+(dy+1)*sh/dh, sy0+1)
+		for dx := 0; dx < dw; dx++ {
+			sx0 := sb.Min.X + dx*sw/dw
+			sx1 := max(sb.Min.X+(dx+1)*sw/dw, sx0+1)
+			var rs, gs, bs, n uint32
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, _ := src.At(sx, sy).RGBA()
+					rs += cr >> 8
+					gs += cg >> 8
+					bs += cb >> 8
+					n++
+				}
+			}
+			dst.SetRGBA(r.Min.X+dx, r.Min.Y+dy, color.RGBA{R: uint8(rs / n), G: uint8(gs / n), B: uint8(bs / n), A: 255})
+		}
+	}
+}
+
+// Remove previews of lists not in `public` (no longer public, their user
+// was deleted or they have nothing to show). Returns the amount removed.
+func cleanupStaleListPreviews(public map[uint]bool) (int, error) {
+	entries, err := os.ReadDir(listPreviewDir())
+	if err != nil {
+		slog.Error("cleanupStaleListPreviews: Failed to read previews dir", "error", err)
+		return 0, errors.New("failed to read previews dir")
+	}
+	removed := 0
+	for _, e := range entries {
+		name := e.Name()
+		// Left behind temp files are removed too.
+		id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSuffix(name, imageTempSuffix), ".jpg"), 10, 64)
+		if err == nil && public[uint(id)] && !strings.HasSuffix(name, imageTempSuffix) {
+			continue
+		}
+		if err := os.Remove(path.Join(listPreviewDir(), name)); err != nil && !os.IsNotExist(err) {
+			slog.Error("cleanupStaleListPreviews: Failed to remove preview", "name", name, "error", err)
+			continue
+		}
+		slog.Debug("cleanupStaleListPreviews: Removed preview", "name", name)
+		removed++
+	}
+	return removed, nil
+}
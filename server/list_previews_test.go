@@ -0,0 +1,112 @@
+package main
+
+import (
+	"image"
+	"image/jpeg"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// Cache a plain poster for `posterPath`.
+func addTestPosterImage(t *testing.T, posterPath string) {
+	t.Helper()
+	os.MkdirAll(path.Join(DataPath, "img"), 0755)
+	f, err := os.Create(posterCachePath(posterPath))
+	if err != nil {
+		t.Fatalf("failed to create poster: %v", err)
+	}
+	defer f.Close()
+	img := image.NewRGBA(image.Rect(0, 0, 50, 75))
+	for i := range img.Pix {
+		img.Pix[i] = 200
+	}
+	if err := jpeg.Encode(f, img, nil); err != nil {
+		t.Fatalf("failed to encode poster: %v", err)
+	}
+}
+
+func TestGenerateListPreviews(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	private := true
+	alice := User{Username: "alice"}
+	db.Create(&alice)
+	bob := User{Username: "bob", UserSettings: UserSettings{Private: &private}}
+	db.Create(&bob)
+	// Public, but none of their posters are cached.
+	carol := User{Username: "carol"}
+	db.Create(&carol)
+	add := func(u User, tmdbId int, poster string) Watched {
+		c := Content{TmdbID: tmdbId, Title: poster, Type: MOVIE, PosterPath: poster}
+		db.Create(&c)
+		w := Watched{UserID: u.ID, ContentID: &c.ID, Status: FINISHED}
+		db.Create(&w)
+		return w
+	}
+	first := add(alice, 1, "/one.jpg")
+	add(alice, 2, "/two.jpg")
+	add(bob, 3, "/three.jpg")
+	add(carol, 4, "/uncached.jpg")
+	for _, p := range []string{"/one.jpg", "/two.jpg", "/three.jpg"} {
+		addTestPosterImage(t, p)
+	}
+	summary := func() map[string]any {
+		return getTaskStatus("generate_list_previews").Summary
+	}
+
+	if err := generateListPreviews(db); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if s := summary(); s["generated"] != 1 || s["upToDate"] != 0 || s["failed"] != 0 || s["removed"] != 0 {
+		t.Errorf("got summary %v, want only alices preview generated", s)
+	}
+	p, err := getListPreview(db, alice.ID, "alice")
+	if err != nil {
+		t.Fatalf("no preview of alices list: %v", err)
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		t.Fatalf("failed to open preview: %v", err)
+	}
+	cfg, err := jpeg.DecodeConfig(f)
+	f.Close()
+	if err != nil || cfg.Width != listPreviewWidth || cfg.Height != listPreviewHeight {
+		t.Errorf("preview is %dx%d (%v), want %dx%d", cfg.Width, cfg.Height, err, listPreviewWidth, listPreviewHeight)
+	}
+	for _, u := range []User{bob, carol} {
+		if _, err := getListPreview(db, u.ID, u.Username); err == nil {
+			t.Errorf("%s has a preview, want none", u.Username)
+		}
+	}
+	if _, err := getListPreview(db, alice.ID, "bob"); err == nil {
+		t.Error("got alices preview with the wrong username")
+	}
+
+	if err := generateListPreviews(db); err != nil {
+		t.Fatalf("second generate failed: %v", err)
+	}
+	if s := summary(); s["generated"] != 0 || s["upToDate"] != 1 {
+		t.Errorf("got summary %v with nothing changed, want alices preview up to date", s)
+	}
+	// Changed since the preview was made.
+	db.Model(&first).UpdateColumn("updated_at", time.Now().Add(time.Hour))
+	if err := generateListPreviews(db); err != nil {
+		t.Fatalf("generate after a change failed: %v", err)
+	}
+	if s := summary(); s["generated"] != 1 {
+		t.Errorf("got summary %v after alices list changed, want it regenerated", s)
+	}
+
+	db.Delete(&alice)
+	if err := generateListPreviews(db); err != nil {
+		t.Fatalf("generate after deleting the user failed: %v", err)
+	}
+	if s := summary(); s["generated"] != 0 || s["removed"] != 1 {
+		t.Errorf("got summary %v after alice was deleted, want their preview removed", s)
+	}
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Errorf("preview of deleted user still exists: %v", err)
+	}
+}
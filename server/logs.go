@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+)
+
+func isLogRotationEnabled() bool {
+	return Config.TASK_ROTATE_LOGS
+}
+
+// Rotate the log file if it is over LOG_MAX_SIZE.
+// The log file is also rotated when written to while over its max size,
+// this makes sure it happens on time even if the server isn't logging much
+// and picks up a lowered LOG_MAX_SIZE straight away.
+func rotateLogs() error {
+	maxSize := int64(logFile.MaxSize) * 1024 * 1024
+	info, err := os.Stat(logFile.Filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		slog.Error("rotateLogs: Failed to stat log file", "path", logFile.Filename, "error", err)
+		return errors.New("failed to stat log file")
+	}
+	if info.Size() < maxSize {
+		slog.Debug("rotateLogs: Log file is under max size, not rotating.", "path", logFile.Filename, "size", info.Size(), "max_size", maxSize)
+		return nil
+	}
+	// Writes after this go to a fresh file, old file
+	// is renamed (and compressed if LOG_COMPRESS is on).
+	if err := logFile.Rotate(); err != nil {
+		slog.Error("rotateLogs: Failed to rotate log file", "path", logFile.Filename, "error", err)
+		return errors.New("failed to rotate log file")
+	}
+	slog.Info("rotateLogs: Rotated log file.", "path", logFile.Filename, "size", info.Size(), "max_backups", logFile.MaxBackups, "compress", logFile.Compress)
+	return nil
+}
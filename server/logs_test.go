@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Log to a file in the temp data dir until the test ends.
+func useTestLogFile(t *testing.T, maxSize int) *lumberjack.Logger {
+	t.Helper()
+	old := logFile
+	logFile = &lumberjack.Logger{
+		Filename:   path.Join(DataPath, "watcharr.log"),
+		MaxSize:    maxSize,
+		MaxBackups: 3,
+	}
+	t.Cleanup(func() {
+		logFile.Close()
+		logFile = old
+	})
+	return logFile
+}
+
+func getTestLogBackups(t *testing.T) []string {
+	t.Helper()
+	entries, err := os.ReadDir(DataPath)
+	if err != nil {
+		t.Fatalf("failed to read data dir: %v", err)
+	}
+	var backups []string
+	for _, e := range entries {
+		if e.Name() != "watcharr.log" && strings.HasPrefix(e.Name(), "watcharr-") {
+			backups = append(backups, e.Name())
+		}
+	}
+	return backups
+}
+
+func TestRotateLogsOverMaxSize(t *testing.T) {
+	useTestConfig(t)
+	lf := useTestLogFile(t, 1)
+	big := strings.Repeat("a", 1024*1024+1)
+	if err := os.WriteFile(lf.Filename, []byte(big), 0644); err != nil {
+		t.Fatalf("failed to write log file: %v", err)
+	}
+	if err := rotateLogs(); err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+	backups := getTestLogBackups(t)
+	if len(backups) != 1 {
+		t.Fatalf("got backups %v, want 1", backups)
+	}
+	b, err := os.ReadFile(path.Join(DataPath, backups[0]))
+	if err != nil || len(b) != len(big) {
+		t.Errorf("backup has %d bytes, want the whole old log file (error: %v)", len(b), err)
+	}
+	if info, err := os.Stat(lf.Filename); err != nil || info.Size() != 0 {
+		t.Errorf("log file wasn't replaced with a fresh one (error: %v)", err)
+	}
+	// Writes go to the fresh file.
+	if _, err := lf.Write([]byte("after\n")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if b, _ := os.ReadFile(lf.Filename); string(b) != "after\n" {
+		t.Errorf("fresh log file has %q", b)
+	}
+}
+
+func TestRotateLogsUnderMaxSize(t *testing.T) {
+	useTestConfig(t)
+	lf := useTestLogFile(t, 1)
+	if err := os.WriteFile(lf.Filename, []byte("small\n"), 0644); err != nil {
+		t.Fatalf("failed to write log file: %v", err)
+	}
+	if err := rotateLogs(); err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+	if backups := getTestLogBackups(t); len(backups) != 0 {
+		t.Errorf("rotated a log file under its max size: %v", backups)
+	}
+}
+
+func TestRotateLogsTaskOptional(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{})
+	db := newTestDb(t)
+	_, features := getTaskDefinitions(db, db)
+	useTestFeatureTasks(t, map[string]FeatureTask{"rotate_logs": features["rotate_logs"]})
+	syncFeatureTasks()
+	if _, ok := getTaskFunc("rotate_logs"); ok {
+		t.Error("task registered without TASK_ROTATE_LOGS")
+	}
+	Config.TASK_ROTATE_LOGS = true
+	syncFeatureTasks()
+	if _, ok := getTaskFunc("rotate_logs"); !ok {
+		t.Error("task not registered with TASK_ROTATE_LOGS")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type NotificationType string
+
+var (
+	NOTIFICATION_STALE_WATCHING     NotificationType = "STALE_WATCHING"
+	NOTIFICATION_ARR_AVAILABLE      NotificationType = "ARR_AVAILABLE"
+	NOTIFICATION_TASK_DISABLED      NotificationType = "TASK_DISABLED"
+	NOTIFICATION_TMDB_KEY           NotificationType = "TMDB_KEY_INVALID"
+	NOTIFICATION_MIGRATIONS_PENDING NotificationType = "MIGRATIONS_PENDING"
+	NOTIFICATION_JELLYFIN_BROKEN    NotificationType = "JELLYFIN_BROKEN"
+)
+
+// Notification for a user, created by the server (eg. by a task).
+type Notification struct {
+	GormModel
+	// ID of user this notification is for.
+	UserID uint `json:"-" gorm:"not null;index"`
+	// Watched entry this notification is about (if any).
+	WatchedID *uint            `json:"watchedId,omitempty" gorm:"index"`
+	Type      NotificationType `json:"type" gorm:"not null"`
+	Message   string           `json:"message"`
+	// When the user marked it as read, nil if unread.
+	ReadAt *time.Time `json:"readAt,omitempty"`
+}
+
+// Notify all admins, for problems with the server they need to fix.
+// Failing to notify is only logged, it shouldn't stop whatever found the problem.
+func notifyAdmins(db *gorm.DB, t NotificationType, msg string) {
+	var admins []uint
+	res := db.Model(&User{}).Where("permissions & ? = ?", PERM_ADMIN, PERM_ADMIN).Pluck("id", &admins)
+	if res.Error != nil {
+		slog.Error("notifyAdmins: Failed to get admins", "type", t, "error", res.Error)
+		return
+	}
+	for _, uid := range admins {
+		n := Notification{UserID: uid, Type: t, Message: msg}
+		if err := db.Create(&n).Error; err != nil {
+			slog.Error("notifyAdmins: Failed to create notification", "type", t, "user_id", uid, "error", err)
+		}
+	}
+}
+
+func getNotifications(db *gorm.DB, userId uint, unreadOnly bool) ([]Notification, error) {
+	notifs := []Notification{}
+	q := db.Where("user_id = ?", userId)
+	if unreadOnly {
+		q = q.Where("read_at IS NULL")
+	}
+	res := q.Order("created_at DESC").Find(&notifs)
+	if res.Error != nil {
+		slog.Error("getNotifications: Failed getting notifications from database", "error", res.Error.Error())
+		return []Notification{}, errors.New("failed getting notifications")
+	}
+	return notifs, nil
+}
+
+func readNotification(db *gorm.DB, userId uint, id uint) error {
+	res := db.Model(&Notification{}).
+		Where("id = ? AND user_id = ? AND read_at IS NULL", id, userId).
+		Update("read_at", time.Now())
+	if res.Error != nil {
+		slog.Error("readNotification: Failed to update notification", "error", res.Error.Error())
+		return errors.New("failed to update notification")
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("notification does not exist or is already read")
+	}
+	return nil
+}
+
+func deleteNotification(db *gorm.DB, userId uint, id uint) error {
+	res := db.Where("id = ? AND user_id = ?", id, userId).Delete(&Notification{})
+	if res.Error != nil {
+		slog.Error("deleteNotification: Failed to delete notification", "error", res.Error.Error())
+		return errors.New("failed to delete notification")
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("notification does not exist")
+	}
+	return nil
+}
@@ -22,6 +22,7 @@ func startPlexSync(
 	userId uint,
 	userPlexLocalAuth string,
 ) {
+	ctx := getJobContext(jobId)
 	updateJobCurrentTask(jobId, userId, "fetching libraries")
 	libraries, err := getPlexLibraries(userPlexLocalAuth)
 	if err != nil {
@@ -41,6 +42,10 @@ func startPlexSync(
 				continue
 			}
 			for _, movie := range movies.MediaContainer.Metadata {
+				if ctx.Err() != nil {
+					slog.Info("plexSyncWatched: Job cancelled, stopping.", "job_id", jobId, "user_id", userId)
+					return
+				}
 				if movie.ViewCount == 0 {
 					// Not viewed and not rated, skip importing
 					slog.Debug("plexSyncWatched: Skipping unwatched movie:", "movie_name", movie.Title, "user_id", userId)
@@ -75,7 +80,7 @@ func startPlexSync(
 				}
 
 				lastViewedAt := time.Unix(movie.LastViewedAt, 0)
-				w, err := addWatched(db, userId, WatchedAddRequest{
+				w, err := addWatchedFor("plex_sync", db, userId, WatchedAddRequest{
 					Status:      FINISHED,
 					ContentID:   tmdbId,
 					ContentType: MOVIE,
@@ -113,6 +118,10 @@ func startPlexSync(
 				continue
 			}
 			for _, show := range shows.MediaContainer.Metadata {
+				if ctx.Err() != nil {
+					slog.Info("plexSyncWatched: Job cancelled, stopping.", "job_id", jobId, "user_id", userId)
+					return
+				}
 				if show.ViewedLeafCount != show.LeafCount {
 					// Not viewed, skip importing
 					// (could be improved to set status as watching when viewedLeafCount is higher than 0)
@@ -142,7 +151,7 @@ func startPlexSync(
 				}
 
 				lastViewedAt := time.Unix(show.LastViewedAt, 0)
-				w, err := addWatched(db, userId, WatchedAddRequest{
+				w, err := addWatchedFor("plex_sync", db, userId, WatchedAddRequest{
 					Status:      FINISHED,
 					ContentID:   tmdbId,
 					ContentType: SHOW,
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Most similar users recommendations are taken from.
+	recommendationsNeighbours = 20
+	// Recommendations stored per user.
+	recommendationsPerUser = 20
+)
+
+// Content recommended to a user, computed by the Compute Recommendations task.
+type UserRecommendation struct {
+	UserID    uint      `json:"-" gorm:"primaryKey;autoIncrement:false"`
+	ContentID int       `json:"-" gorm:"primaryKey;autoIncrement:false"`
+	Content   *Content  `json:"content,omitempty"`
+	Rank      int       `json:"rank"`
+	Score     float64   `json:"score"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// An entry on a users watched list, all recommendations need of it.
+type recommendationEntry struct {
+	UserID    uint
+	ContentID int
+	Status    WatchedStatus
+	Rating    float64
+}
+
+// Precompute recommendations for every user, from the watched lists of
+// the users most similar to them (by overlap of their lists). Content
+// from private users lists is never recommended to others.
+// Results only depend on the lists, so the same lists always give the
+// same recommendations. Lists are read from `readDb` (see TASK_READ_DB),
+// recommendations are saved to `db`.
+func computeRecommendations(db *gorm.DB, readDb *gorm.DB) error {
+	var entries []recommendationEntry
+	res := readDb.Model(&Watched{}).
+		Where("content_id IS NOT NULL").
+		Select("user_id", "content_id", "status", "rating").
+		Find(&entries)
+	if res.Error != nil {
+		slog.Error("computeRecommendations: Failed to get watched lists", "error", res.Error)
+		return errors.New("failed to get watched lists")
+	}
+	var private []uint
+	res = readDb.Model(&User{}).Where("private = 1").Pluck("id", &private)
+	if res.Error != nil {
+		slog.Error("computeRecommendations: Failed to get private users", "error", res.Error)
+		return errors.New("failed to get private users")
+	}
+	isPrivate := map[uint]bool{}
+	for _, id := range private {
+		isPrivate[id] = true
+	}
+	lists := map[uint]map[int]recommendationEntry{}
+	for _, e := range entries {
+		if lists[e.UserID] == nil {
+			lists[e.UserID] = map[int]recommendationEntry{}
+		}
+		lists[e.UserID][e.ContentID] = e
+	}
+	users := make([]uint, 0, len(lists))
+	for u := range lists {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+	var stored int
+	for _, u := range users {
+		recs := recommendFor(u, users, lists, isPrivate)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("user_id = ?", u).Delete(&UserRecommendation{}).Error; err != nil {
+				return err
+			}
+			if len(recs) == 0 {
+				return nil
+			}
+			return tx.Create(&recs).Error
+		})
+		if err != nil {
+			slog.Error("computeRecommendations: Failed to save recommendations", "user_id", u, "error", err)
+			return errors.New("failed to save recommendations")
+		}
+		stored += len(recs)
+	}
+	setTaskSummary("compute_recommendations", map[string]any{"users": len(users), "recommendations": stored})
+	return nil
+}
+
+// Recommend content for user `u`, not already on their list.
+func recommendFor(u uint, users []uint, lists map[uint]map[int]recommendationEntry, isPrivate map[uint]bool) []UserRecommendation {
+	type neighbour struct {
+		id  uint
+		sim float64
+	}
+	own := lists[u]
+	var neighbours []neighbour
+	for _, o := range users {
+		if o == u || isPrivate[o] {
+			continue
+		}
+		overlap := 0
+		for cid := range lists[o] {
+			if _, ok := own[cid]; ok {
+				overlap++
+			}
+		}
+		if overlap == 0 {
+			continue
+		}
+		// Jaccard, so users with huge lists don't win by size alone.
+		neighbours = append(neighbours, neighbour{o, float64(overlap) / float64(len(own)+len(lists[o])-overlap)})
+	}
+	sort.Slice(neighbours, func(i, j int) bool {
+		if neighbours[i].sim != neighbours[j].sim {
+			return neighbours[i].sim > neighbours[j].sim
+		}
+		return neighbours[i].id < neighbours[j].id
+	})
+	if len(neighbours) > recommendationsNeighbours {
+		neighbours = neighbours[:recommendationsNeighbours]
+	}
+	scores := map[int]float64{}
+	for _, n := range neighbours {
+		for cid, e := range lists[n.id] {
+			if _, ok := own[cid]; ok || e.Status == DROPPED {
+				continue
+			}
+			// Unrated content counts half, as if rated 5/10.
+			weight := 0.5
+			if e.Rating > 0 {
+				weight = e.Rating / 10
+			}
+			scores[cid] += n.sim * weight
+		}
+	}
+	recs := make([]UserRecommendation, 0, len(scores))
+	for cid, s := range scores {
+		recs = append(recs, UserRecommendation{UserID: u, ContentID: cid, Score: s})
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		if recs[i].Score != recs[j].Score {
+			return recs[i].Score > recs[j].Score
+		}
+		return recs[i].ContentID < recs[j].ContentID
+	})
+	if len(recs) > recommendationsPerUser {
+		recs = recs[:recommendationsPerUser]
+	}
+	for i := range recs {
+		recs[i].Rank = i + 1
+	}
+	return recs
+}
+
+// Get a users stored recommendations, best first.
+func getRecommendations(db *gorm.DB, userId uint) ([]UserRecommendation, error) {
+	recs := []UserRecommendation{}
+	res := db.Where("user_id = ?", userId).Preload("Content").Order("rank").Find(&recs)
+	if res.Error != nil {
+		slog.Error("getRecommendations: Failed to get recommendations", "user_id", userId, "error", res.Error)
+		return nil, errors.New("failed to get recommendations")
+	}
+	return recs, nil
+}
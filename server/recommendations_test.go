@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComputeRecommendationsDeterministic(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	var content []Content
+	for i := 1; i <= 6; i++ {
+		c := Content{TmdbID: 1000 + i, Title: "Movie", Type: MOVIE}
+		db.Create(&c)
+		content = append(content, c)
+	}
+	user := func(name string, private bool) User {
+		u := User{Username: name, UserSettings: UserSettings{Private: &private}}
+		db.Create(&u)
+		return u
+	}
+	add := func(u User, c int, status WatchedStatus, rating float64) {
+		db.Create(&Watched{UserID: u.ID, ContentID: &content[c-1].ID, Status: status, Rating: rating})
+	}
+	alice := user("alice", false)
+	add(alice, 1, FINISHED, 8)
+	add(alice, 2, FINISHED, 0)
+	bob := user("bob", false)
+	add(bob, 1, FINISHED, 0)
+	add(bob, 2, FINISHED, 0)
+	add(bob, 3, FINISHED, 10)
+	add(bob, 4, DROPPED, 0)
+	carol := user("carol", true)
+	add(carol, 1, FINISHED, 0)
+	add(carol, 5, FINISHED, 10)
+	dave := user("dave", false)
+	add(dave, 2, FINISHED, 0)
+	add(dave, 6, PLANNED, 0)
+
+	get := func() []UserRecommendation {
+		t.Helper()
+		recs, err := getRecommendations(db, alice.ID)
+		if err != nil {
+			t.Fatalf("failed to get recommendations: %v", err)
+		}
+		for i := range recs {
+			recs[i].Content = nil
+		}
+		return recs
+	}
+	if err := computeRecommendations(db, db); err != nil {
+		t.Fatalf("compute failed: %v", err)
+	}
+	first := get()
+	// Bob is the closest (2 of 4 shared), then dave (1 of 3). Dropped
+	// content and content only on private lists isn't recommended.
+	if len(first) != 2 || first[0].ContentID != content[2].ID || first[1].ContentID != content[5].ID {
+		t.Fatalf("got recommendations %+v, want content %d then %d", first, content[2].ID, content[5].ID)
+	}
+	if first[0].Rank != 1 || first[0].Score != 0.5 || first[1].Rank != 2 || first[1].Score != 0.5/3 {
+		t.Errorf("got recommendations %+v, want scores 0.5 and 1/6", first)
+	}
+	if s := getTaskStatus("compute_recommendations").Summary; s["users"] != 4 {
+		t.Errorf("got summary %v, want 4 users", s)
+	}
+
+	if err := computeRecommendations(db, db); err != nil {
+		t.Fatalf("second compute failed: %v", err)
+	}
+	second := get()
+	for i := range second {
+		// Only compare the recommendation itself.
+		second[i].CreatedAt = first[i].CreatedAt
+	}
+	if !reflect.DeepEqual(second, first) {
+		t.Errorf("got %+v on the second run, want the same as the first %+v", second, first)
+	}
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cache"
@@ -285,6 +287,52 @@ func (b *BaseRouter) addContentRoutes() {
 		c.JSON(http.StatusOK, content)
 	})
 
+	// Get content recommended to the user, best first.
+	// Computed periodically by the Compute Recommendations task.
+	content.GET("/recommendations", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		response, err := getRecommendations(b.db, userId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Get upcoming episodes of shows the user is watching, soonest first.
+	// Refreshed periodically by the Refresh Calendars task, and shortly
+	// after the users list changes.
+	content.GET("/calendar", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		response, err := getCalendar(b.db, userId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Get a collection (franchise) and which of its movies the user
+	// has on their list. Only collections of tracked movies are stored.
+	content.GET("/collection/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "collection id is not a number"})
+			return
+		}
+		userId := c.MustGet("userId").(uint)
+		response, err := getCollectionProgress(b.db, userId, id)
+		if err != nil {
+			if err.Error() == "collection not found" {
+				c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
 	// Get person details
 	content.GET("/person/:id", cache.CachePage(b.ms, exp, func(c *gin.Context) {
 		if c.Param("id") == "" {
@@ -313,55 +361,58 @@ func (b *BaseRouter) addContentRoutes() {
 		c.JSON(http.StatusOK, content)
 	}))
 
+	// Discover, trending and upcoming routes aren't page cached, their
+	// funcs cache results which the Warm Trending Cache task keeps fresh.
+
 	// Discover movies
-	content.GET("/discover/movies", cache.CachePage(b.ms, exp, func(c *gin.Context) {
+	content.GET("/discover/movies", func(c *gin.Context) {
 		content, err := discoverMovies()
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
 		c.JSON(http.StatusOK, content)
-	}))
+	})
 
 	// Discover shows
-	content.GET("/discover/tv", cache.CachePage(b.ms, exp, func(c *gin.Context) {
+	content.GET("/discover/tv", func(c *gin.Context) {
 		content, err := discoverTv()
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
 		c.JSON(http.StatusOK, content)
-	}))
+	})
 
 	// Get all trending (movies, tv, people)
-	content.GET("/trending", cache.CachePage(b.ms, exp, func(c *gin.Context) {
+	content.GET("/trending", func(c *gin.Context) {
 		content, err := allTrending()
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
 		c.JSON(http.StatusOK, content)
-	}))
+	})
 
 	// Upcoming Movies
-	content.GET("/upcoming/movies", cache.CachePage(b.ms, exp, func(c *gin.Context) {
+	content.GET("/upcoming/movies", func(c *gin.Context) {
 		content, err := upcomingMovies()
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
 		c.JSON(http.StatusOK, content)
-	}))
+	})
 
 	// Upcoming Tv
-	content.GET("/upcoming/tv", cache.CachePage(b.ms, exp, func(c *gin.Context) {
+	content.GET("/upcoming/tv", func(c *gin.Context) {
 		content, err := upcomingTv()
 		if err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
 		c.JSON(http.StatusOK, content)
-	}))
+	})
 
 	// Available regions for watch providers
 	content.GET("/regions", func(c *gin.Context) {
@@ -887,6 +938,55 @@ func (b *BaseRouter) addProfileRoutes() {
 		}
 		c.JSON(http.StatusOK, response)
 	})
+
+	// Get users trakt link.
+	profile.GET("/trakt", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		response, err := getTraktSync(b.db, userId)
+		if err != nil {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Start linking trakt account for syncing watched items to it.
+	profile.POST("/trakt/link", func(c *gin.Context) {
+		response, err := traktSyncLinkStart()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Finish linking trakt account, once user has entered their code.
+	profile.POST("/trakt/link/finish", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		var lr TraktLinkRequest
+		err := c.ShouldBindJSON(&lr)
+		if err == nil {
+			err := traktSyncLinkFinish(b.db, userId, lr)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.Status(http.StatusOK)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Unlink trakt account.
+	profile.DELETE("/trakt/link", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		err := traktSyncUnlink(b.db, userId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.Status(http.StatusOK)
+	})
 }
 
 func (b *BaseRouter) addJellyfinRoutes() {
@@ -942,6 +1042,27 @@ func (b *BaseRouter) addPlexRoutes() {
 func (b *BaseRouter) addUserRoutes() {
 	u := b.rg.Group("/user").Use(AuthRequired(b.db))
 
+	// Get preview image of a public list, for link unfurls (OpenGraph).
+	// Not behind auth, sites unfurling links won't be logged in.
+	b.rg.GET("/user/preview/:pubUserId/:pubUsername", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("pubUserId"))
+		if err != nil {
+			c.Status(400)
+			return
+		}
+		p, err := getListPreview(b.db, uint(id), c.Param("pubUsername"))
+		if err != nil {
+			if err.Error() == "failed to check user" {
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.Header("Cache-Control", "public, max-age=3600")
+		c.File(p)
+	})
+
 	// Get current user info
 	u.GET("", func(c *gin.Context) {
 		userId := c.MustGet("userId").(uint)
@@ -1145,6 +1266,25 @@ func (b *BaseRouter) addImportRoutes() {
 func (b *BaseRouter) addServerRoutes() {
 	server := b.rg.Group("/server").Use(AuthRequired(b.db), AdminRequired())
 
+	// Get last known state of integrations, from the Check Integrations task.
+	server.GET("/integrations", func(c *gin.Context) {
+		c.JSON(http.StatusOK, getIntegrationStatuses())
+	})
+
+	// Get last known state of our tmdb api key, from the Check TMDB Key task.
+	server.GET("/tmdb_key", func(c *gin.Context) {
+		c.JSON(http.StatusOK, getTMDBKeyStatus())
+	})
+
+	// Get health of the server: last known migration state (from startup or
+	// the Check Migrations task) and tmdb api key state.
+	server.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, ServerHealthResponse{
+			Migrations: getMigrationStatus(),
+			TMDBKey:    getTMDBKeyStatus(),
+		})
+	})
+
 	// Get server config (minus very sensitive fields, like JWT_SECRET)
 	server.GET("/config", func(c *gin.Context) {
 		// Return new ServerConfig with only the fields we want to show in settings ui
@@ -1597,6 +1737,19 @@ func (b *BaseRouter) addArrRequestRoutes() {
 	})
 }
 
+func (b *BaseRouter) addArrQueueRoutes() {
+	q := b.rg.Group("/arr/queue").Use(AuthRequired(b.db), AdminRequired())
+
+	// Get items downloading on all arr servers, from the
+	// snapshots taken by the Refresh Arr Queues task.
+	// Use `?page=N&pageSize=N` to paginate.
+	q.GET("/", func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.Query("page"))
+		pageSize, _ := strconv.Atoi(c.Query("pageSize"))
+		c.JSON(http.StatusOK, getArrQueue(page, pageSize))
+	})
+}
+
 func (b *BaseRouter) addJobRoutes() {
 	job := b.rg.Group("/job").Use(AuthRequired(nil))
 
@@ -1610,31 +1763,704 @@ func (b *BaseRouter) addJobRoutes() {
 			c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, *response)
+		c.JSON(http.StatusOK, response)
 	})
 }
 
 func (b *BaseRouter) addTaskRoutes() {
+	// Trigger a task from outside (eg. cron), authed by TASK_TRIGGER_SECRET
+	// rather than a user, so it is outside of the `/task` group.
+	b.rg.POST("/trigger/task/:id", TaskTriggerRequired(), func(c *gin.Context) {
+		response, err := triggerTask(c.Param("id"))
+		if err != nil {
+			if err.Error() == "no task found" {
+				c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+				return
+			}
+			if err.Error() == "task was triggered too recently" {
+				c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: err.Error()})
+				return
+			}
+			if err.Error() == "task is already running" {
+				c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, response)
+	})
+
+	// Get metrics of all tasks, in the prometheus text format. Authed by
+	// TASK_METRICS_SECRET, so scrapers don't need a user, it is outside
+	// of the `/task` group too.
+	b.rg.GET("/task/metrics", TaskMetricsRequired(), func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; version=0.0.4")
+		c.Status(http.StatusOK)
+		if err := writeTaskMetrics(c.Writer); err != nil {
+			slog.Error("task metrics route: Failed to write metrics.", "error", err)
+		}
+	})
+
 	task := b.rg.Group("/task").Use(AuthRequired(b.db), AdminRequired())
 
+	// Get all tasks.
+	// Use `?status=failing` to only get tasks that are failing.
+	// Hidden tasks are left out, use `?includeHidden=true` to include them.
 	task.GET("/", func(c *gin.Context) {
-		response := getAllTasks()
+		response := getAllTasks(c.Query("status") == "failing", c.Query("includeHidden") == "true")
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Stream task events (started, finished, etc) as they happen.
+	task.GET("/events", func(c *gin.Context) {
+		events, unsub := subscribeTaskEvents()
+		defer unsub()
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case e := <-events:
+				c.SSEvent("task", e)
+				return true
+			case <-c.Request.Context().Done():
+				return false
+			}
+		})
+	})
+
+	// Download the task config that is in effect (defaults filled
+	// in, overrides applied), for sharing when asking for support.
+	task.GET("/config", func(c *gin.Context) {
+		c.Header("Content-Disposition", `attachment; filename="watcharr-task-config.json"`)
+		c.IndentedJSON(http.StatusOK, getTaskEffectiveConfig())
+	})
+
+	// Run all maintenance (cleanup) tasks once, one after another.
+	// Returns straight away, get the report to see how it went.
+	task.POST("/maintenance", func(c *gin.Context) {
+		report, err := startMaintenance()
+		if err != nil {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	})
+
+	// Get the report of the current (or last) maintenance run.
+	task.GET("/maintenance", func(c *gin.Context) {
+		report, err := getMaintenanceReport()
+		if err != nil {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	})
+
+	// Cancel the current maintenance run.
+	task.DELETE("/maintenance", func(c *gin.Context) {
+		if err := cancelMaintenance(); err != nil {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	// Preview the tokens the Cleanup Tokens task would remove, without
+	// removing them. Use `?grace=N` to preview with a grace period of N
+	// seconds instead of the tokens max age.
+	task.GET("/cleanup_tokens/preview", func(c *gin.Context) {
+		grace := 0
+		if g := c.Query("grace"); g != "" {
+			num, err := strconv.Atoi(g)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "query parameter 'grace' is not a number"})
+				return
+			}
+			grace = num
+		}
+		response, err := previewTokenCleanup(b.db, time.Duration(grace)*time.Second)
+		if err != nil {
+			if err.Error() == "grace can't be negative" {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Get the rows a report task (from TASK_REPORTS) got on its last successful run.
+	task.GET("/report/:id", func(c *gin.Context) {
+		response, err := getTaskReportResult(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Get exactly what the Send Telemetry task would send, and if it is enabled.
+	task.GET("/telemetry/preview", func(c *gin.Context) {
+		response, err := getTelemetryPreview(b.db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Get the drain state of tasks.
+	task.GET("/drain", func(c *gin.Context) {
+		c.JSON(http.StatusOK, getTaskDrainStatus())
+	})
+
+	// Start draining tasks: no new runs start, but runs in progress
+	// finish. Poll (or watch events) for `drained` before shutting down.
+	task.POST("/drain", func(c *gin.Context) {
+		c.JSON(http.StatusOK, drainTasks())
+	})
+
+	// Stop draining tasks, runs start as usual again.
+	task.DELETE("/drain", func(c *gin.Context) {
+		c.JSON(http.StatusOK, resumeTasks())
+	})
+
+	// Get how often tmdb has rate limited the server recently.
+	task.GET("/tmdb_rate_limits", func(c *gin.Context) {
+		c.JSON(http.StatusOK, getTMDBRateLimitSummary())
+	})
+
+	// Get all task flags, which toggle experimental tasks.
+	task.GET("/flags", func(c *gin.Context) {
+		c.JSON(http.StatusOK, getTaskFlags())
+	})
+
+	// Set a task flag, its task is registered/deregistered to match.
+	task.PUT("/flags/:id", func(c *gin.Context) {
+		var ur TaskFlagUpdateRequest
+		err := c.ShouldBindJSON(&ur)
+		if err == nil {
+			response, err := setTaskFlag(b.db, c.Param("id"), *ur.Enabled)
+			if err != nil {
+				if err.Error() == "no flag found" {
+					c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Get a snapshot of the whole task scheduler, with secrets
+	// redacted, for attaching to bug reports.
+	task.GET("/snapshot", func(c *gin.Context) {
+		c.JSON(http.StatusOK, getTaskSnapshot())
+	})
+
+	// Restore a snapshot, rescheduling tasks and replacing their stats to
+	// match it. Only allowed in dev mode, since it overwrites schedules.
+	task.POST("/snapshot", func(c *gin.Context) {
+		var s TaskSnapshot
+		err := c.ShouldBindJSON(&s)
+		if err == nil {
+			oldSeconds := map[string]int{}
+			for _, t := range s.Tasks {
+				oldSeconds[t.ID] = getTaskAuditSeconds(t.ID)
+			}
+			response, err := restoreTaskSnapshot(s)
+			// Tasks restored before a failure were still changed.
+			for _, id := range response.Restored {
+				recordTaskAudit(b.db, TaskAudit{
+					UserID:     c.MustGet("userId").(uint),
+					TaskID:     id,
+					Action:     TASK_AUDIT_RESTORE,
+					OldSeconds: oldSeconds[id],
+					NewSeconds: getTaskAuditSeconds(id),
+				})
+			}
+			if err != nil {
+				switch err.Error() {
+				case "restoring snapshots is only allowed in dev mode":
+					c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+				case "unsupported snapshot version":
+					c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				default:
+					if strings.HasPrefix(err.Error(), "invalid snapshot task") {
+						c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+						return
+					}
+					c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+				}
+				return
+			}
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Get settings for the task scheduler as a whole.
+	task.GET("/settings", func(c *gin.Context) {
+		c.JSON(http.StatusOK, getTaskSettings())
+	})
+
+	// Update settings for the task scheduler as a whole.
+	// Only included settings are changed.
+	// Use `?validate=true` to only get what would change, without changing it.
+	task.PATCH("/settings", func(c *gin.Context) {
+		var ur TaskSettingsUpdateRequest
+		err := c.ShouldBindJSON(&ur)
+		if err == nil {
+			if c.Query("validate") == "true" {
+				c.JSON(http.StatusOK, validateTaskSettingsUpdate(ur))
+				return
+			}
+			response, err := updateTaskSettings(ur)
+			if err != nil {
+				if err.Error() == "failed to write config" {
+					c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+					return
+				}
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			recordTaskAudit(b.db, TaskAudit{
+				UserID: c.MustGet("userId").(uint),
+				Action: TASK_AUDIT_SETTINGS,
+			})
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Get the latest summary of every task that has reported one, by task id.
+	task.GET("/summaries", func(c *gin.Context) {
+		c.JSON(http.StatusOK, getTaskSummaries())
+	})
+
+	// Get recent errors from all tasks, newest first.
+	// Use `?limit=N` to only get the last N errors.
+	task.GET("/errors", func(c *gin.Context) {
+		limit := 0
+		if l := c.Query("limit"); l != "" {
+			num, err := strconv.Atoi(l)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "query parameter 'limit' is not a number"})
+				return
+			}
+			limit = num
+		}
+		c.JSON(http.StatusOK, getTaskRecentErrors(limit))
+	})
+
+	// Get changes admins made to tasks (reschedules, enables, runs, settings), newest first.
+	// Filter with `?task=id` and use `?limit=N` to only get N entries.
+	task.GET("/audit", func(c *gin.Context) {
+		limit := 0
+		if l := c.Query("limit"); l != "" {
+			num, err := strconv.Atoi(l)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "query parameter 'limit' is not a number"})
+				return
+			}
+			limit = num
+		}
+		entries, err := getTaskAudit(b.db, c.Query("task"), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, entries)
+	})
+
+	// Get task run history, newest first.
+	// Filter with `?task=id&from=RFC3339&to=RFC3339` and use `?limit=N` to only get N runs.
+	task.GET("/history", func(c *gin.Context) {
+		q, err := parseTaskRunQuery(c.Query("task"), c.Query("from"), c.Query("to"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		limit := 0
+		if l := c.Query("limit"); l != "" {
+			num, err := strconv.Atoi(l)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "query parameter 'limit' is not a number"})
+				return
+			}
+			limit = num
+		}
+		response, err := getTaskRuns(b.db, q, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Download task run history as csv, oldest first.
+	// Takes the same filters as `/history`.
+	task.GET("/history/csv", func(c *gin.Context) {
+		q, err := parseTaskRunQuery(c.Query("task"), c.Query("from"), c.Query("to"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", "attachment; filename=\"task_runs.csv\"")
+		c.Status(http.StatusOK)
+		if err := writeTaskRunsCSV(b.db, q, c.Writer); err != nil {
+			// Headers are already sent, nothing else we can do.
+			slog.Error("task history csv route: Failed to write csv.", "error", err)
+		}
+	})
+
+	// Export task run history as json, with stats, for importing
+	// on another server. Takes the same filters as `/history`.
+	task.GET("/history/export", func(c *gin.Context) {
+		q, err := parseTaskRunQuery(c.Query("task"), c.Query("from"), c.Query("to"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		response, err := exportTaskHistory(b.db, q)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename=\"task_runs.json\"")
 		c.JSON(http.StatusOK, response)
 	})
 
-	task.PUT(":name", func(c *gin.Context) {
-		if c.Param("name") == "" {
-			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "no task name provided"})
+	// Import task run history, from `/history/export` (json)
+	// or `/history/csv` (with `?format=csv`).
+	task.POST("/history/import", func(c *gin.Context) {
+		var runs []TaskRun
+		if c.Query("format") == "csv" {
+			r, err := readTaskRunsCSV(c.Request.Body)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			runs = r
+		} else {
+			var e TaskHistoryExport
+			if err := c.ShouldBindJSON(&e); err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			if e.Version != taskHistoryExportVersion {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "unsupported export version"})
+				return
+			}
+			runs = e.Runs
+		}
+		response, err := importTaskHistory(b.db, runs)
+		if err != nil {
+			if err.Error() == "failed to import task runs" || err.Error() == "failed to get task run stats" {
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Get tasks not scheduled yet, because their warmup probe is failing.
+	task.GET("/probes", func(c *gin.Context) {
+		c.JSON(http.StatusOK, getPendingTaskProbes())
+	})
+
+	// Get a task.
+	task.GET(":id", func(c *gin.Context) {
+		response, err := getTaskDetail(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Reschedule a task, 0 seconds disables it.
+	// Use `?validate=true` to only get what would change, without changing it.
+	task.PUT(":id", func(c *gin.Context) {
+		if c.Param("id") == "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "no task id provided"})
 			return
 		}
 		var rr TaskRescheduleRequest
 		err := c.ShouldBindJSON(&rr)
 		if err == nil {
-			err := rescheduleTask(c.Param("name"), rr)
+			if c.Query("validate") == "true" {
+				response, err := validateTaskReschedule(c.Param("id"), rr)
+				if err != nil {
+					c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+					return
+				}
+				c.JSON(http.StatusOK, response)
+				return
+			}
+			oldSeconds := getTaskAuditSeconds(c.Param("id"))
+			err := rescheduleTask(c.Param("id"), rr)
 			if err != nil {
+				if err.Error() == "no task found" {
+					c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+					return
+				}
+				if err.Error() == "seconds can't be negative" || err.Error() == "max seconds must be more than seconds" || err.Error() == "seconds is below the tasks minimum interval" {
+					c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+					return
+				}
 				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 				return
 			}
+			action := TASK_AUDIT_RESCHEDULE
+			if *rr.Seconds == 0 {
+				action = TASK_AUDIT_DISABLE
+			}
+			recordTaskAudit(b.db, TaskAudit{
+				UserID:     c.MustGet("userId").(uint),
+				TaskID:     c.Param("id"),
+				Action:     action,
+				OldSeconds: oldSeconds,
+				NewSeconds: getTaskAuditSeconds(c.Param("id")),
+			})
+			c.Status(http.StatusOK)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// Remove a task.
+	task.DELETE(":id", func(c *gin.Context) {
+		oldSeconds := getTaskAuditSeconds(c.Param("id"))
+		err := removeTask(c.Param("id"))
+		if err != nil {
+			if err.Error() == "built-in tasks cannot be removed" {
+				c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+				return
+			}
+			if err.Error() == "no task found" {
+				c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		recordTaskAudit(b.db, TaskAudit{
+			UserID:     c.MustGet("userId").(uint),
+			TaskID:     c.Param("id"),
+			Action:     TASK_AUDIT_REMOVE,
+			OldSeconds: oldSeconds,
+		})
+		c.Status(http.StatusOK)
+	})
+
+	// Reset a tasks stats and circuit breakers.
+	task.POST(":id/reset", func(c *gin.Context) {
+		response, err := resetTask(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		recordTaskAudit(b.db, TaskAudit{
+			UserID: c.MustGet("userId").(uint),
+			TaskID: c.Param("id"),
+			Action: TASK_AUDIT_RESET,
+		})
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Check if a task has ran since `?since=RFC3339`, and when it last ran.
+	task.GET(":id/ran-since", func(c *gin.Context) {
+		since, err := time.Parse(time.RFC3339, c.Query("since"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "query parameter 'since' is not a valid time"})
+			return
+		}
+		ran, last, err := taskRanSince(c.Param("id"), since)
+		if err != nil {
+			if err.Error() == "no task found" {
+				c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, TaskRanSinceResponse{Ran: ran, LastRun: last})
+	})
+
+	// Explain how a tasks next run time was worked out, for debugging schedules.
+	task.GET(":id/next-run", func(c *gin.Context) {
+		response, err := explainTaskNextRun(c.Param("id"))
+		if err != nil {
+			if err.Error() == "no task found" {
+				c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Temporarily run a task more often.
+	task.POST(":id/boost", func(c *gin.Context) {
+		var br TaskBoostRequest
+		err := c.ShouldBindJSON(&br)
+		if err == nil {
+			oldSeconds := getTaskAuditSeconds(c.Param("id"))
+			response, err := boostTask(c.Param("id"), br)
+			if err != nil {
+				if err.Error() == "no task found" {
+					c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+					return
+				}
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			recordTaskAudit(b.db, TaskAudit{
+				UserID:     c.MustGet("userId").(uint),
+				TaskID:     c.Param("id"),
+				Action:     TASK_AUDIT_BOOST,
+				OldSeconds: oldSeconds,
+				NewSeconds: br.Seconds,
+			})
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	})
+
+	// End a tasks boost early.
+	task.DELETE(":id/boost", func(c *gin.Context) {
+		err := unboostTask(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		recordTaskAudit(b.db, TaskAudit{
+			UserID:     c.MustGet("userId").(uint),
+			TaskID:     c.Param("id"),
+			Action:     TASK_AUDIT_UNBOOST,
+			NewSeconds: getTaskAuditSeconds(c.Param("id")),
+		})
+		c.Status(http.StatusOK)
+	})
+
+	// Enable a task that was disabled (or disabled itself).
+	task.POST(":id/enable", func(c *gin.Context) {
+		err := setTaskEnabled(c.Param("id"), true)
+		if err != nil {
+			if err.Error() == "no task found" {
+				c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		recordTaskAudit(b.db, TaskAudit{
+			UserID:     c.MustGet("userId").(uint),
+			TaskID:     c.Param("id"),
+			Action:     TASK_AUDIT_ENABLE,
+			NewSeconds: getTaskAuditSeconds(c.Param("id")),
+		})
+		c.Status(http.StatusOK)
+	})
+
+	// Force unlock a task thats stuck running, so it can run again.
+	task.POST(":id/unlock", func(c *gin.Context) {
+		err := forceUnlockTask(c.Param("id"))
+		if err != nil {
+			if err.Error() == "no task found" {
+				c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		recordTaskAudit(b.db, TaskAudit{
+			UserID: c.MustGet("userId").(uint),
+			TaskID: c.Param("id"),
+			Action: TASK_AUDIT_UNLOCK,
+		})
+		c.Status(http.StatusOK)
+	})
+
+	// Ask a running task to stop early, only for tasks that support it.
+	task.POST(":id/cancel", func(c *gin.Context) {
+		err := cancelTaskRun(c.Param("id"))
+		if err != nil {
+			if err.Error() == "no task found" {
+				c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		recordTaskAudit(b.db, TaskAudit{
+			UserID: c.MustGet("userId").(uint),
+			TaskID: c.Param("id"),
+			Action: TASK_AUDIT_CANCEL,
+		})
+		c.Status(http.StatusOK)
+	})
+
+	// Test action: run a task in a few seconds (`seconds`, default 10)
+	// to check it works. Its recurring schedule isn't changed.
+	task.POST(":id/seed", func(c *gin.Context) {
+		var sr TaskSeedRequest
+		// Body is optional.
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&sr); err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+		}
+		resp, err := seedTaskRun(c.Param("id"), sr)
+		if err != nil {
+			if err.Error() == "no task found" {
+				c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+				return
+			}
+			if err.Error() == "failed to schedule task" {
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		recordTaskAudit(b.db, TaskAudit{
+			UserID: c.MustGet("userId").(uint),
+			TaskID: c.Param("id"),
+			Action: TASK_AUDIT_SEED,
+			RunAt:  &resp.At,
+		})
+		c.JSON(http.StatusOK, resp)
+	})
+
+	// Run a task once at a specific time.
+	task.POST(":id/once", func(c *gin.Context) {
+		var rr TaskRunOnceRequest
+		err := c.ShouldBindJSON(&rr)
+		if err == nil {
+			err := scheduleTaskOnce(c.Param("id"), rr)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+				return
+			}
+			recordTaskAudit(b.db, TaskAudit{
+				UserID: c.MustGet("userId").(uint),
+				TaskID: c.Param("id"),
+				Action: TASK_AUDIT_RUN_ONCE,
+				RunAt:  &rr.At,
+			})
 			c.Status(http.StatusOK)
 			return
 		}
@@ -1729,3 +2555,59 @@ func (b *BaseRouter) addTagRoutes() {
 		c.Status(http.StatusOK)
 	})
 }
+
+func (b *BaseRouter) addNotificationRoutes() {
+	notif := b.rg.Group("/notification").Use(AuthRequired(nil))
+
+	// Get our notifications, newest first.
+	// ?unread=true to only get unread ones.
+	notif.GET("", func(c *gin.Context) {
+		userId := c.MustGet("userId").(uint)
+		notifs, err := getNotifications(b.db, userId, c.Query("unread") == "true")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, notifs)
+	})
+
+	// Mark a notification as read.
+	notif.POST(":id/read", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "check notification id route param"})
+			return
+		}
+		userId := c.MustGet("userId").(uint)
+		err = readNotification(b.db, userId, uint(id))
+		if err != nil {
+			if err.Error() == "failed to update notification" {
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	// Delete a notification.
+	notif.DELETE(":id", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "check notification id route param"})
+			return
+		}
+		userId := c.MustGet("userId").(uint)
+		err = deleteNotification(b.db, userId, uint(id))
+		if err != nil {
+			if err.Error() == "failed to delete notification" {
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"log/slog"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/go-co-op/gocron/v2"
@@ -11,35 +14,182 @@ import (
 
 type TaskRescheduleRequest struct {
 	// Number of seconds inbetween each run of this task.
-	Seconds int `json:"seconds" binding:"required"`
+	// 0 disables the task (its runs are skipped until it is rescheduled),
+	// more than 0 reschedules it, enabling it if it was disabled.
+	// Negative values are invalid.
+	Seconds *int `json:"seconds" binding:"required"`
+	// Optional: Run at a random interval between
+	// `Seconds` and `MaxSeconds` instead.
+	MaxSeconds int `json:"maxSeconds"`
+}
+
+// Range a tasks interval is randomly picked from each run.
+type TaskScheduleRange struct {
+	// Minimum seconds inbetween runs.
+	Min int
+	// Maximum seconds inbetween runs.
+	Max int
+}
+
+type TaskRunOnceRequest struct {
+	// When the task should run.
+	At time.Time `json:"at" binding:"required"`
+	// Optional: Cancel this runs context after this many seconds
+	// (up to `taskRunTimeoutMax`). Only applies to this run,
+	// other runs of the task still have no timeout.
+	TimeoutSeconds int `json:"timeoutSeconds"`
+}
+
+// Longest timeout a single run can be given.
+const taskRunTimeoutMax = 24 * time.Hour
+
+type TaskSeedRequest struct {
+	// Seconds from now the task should run, defaults to 10.
+	Seconds int `json:"seconds"`
+}
+
+type TaskSeedResponse struct {
+	// When the seeded run will happen.
+	At time.Time `json:"at"`
 }
 
 type AllTasksResponse struct {
-	// The tasks name.
+	TaskStatus
+	// The tasks stable id, used to reference it in the api and config.
+	ID string `json:"id"`
+	// The tasks display name, can be changed with TASK_NAMES.
 	Name string `json:"name"`
 	// When this task will next run.
 	NextRun time.Time `json:"nextRun"`
 	// Current schedule for this task (seconds).
+	// If the task runs at a random interval, this is the minimum.
 	Seconds int `json:"seconds"`
+	// Maximum seconds inbetween runs, if the task
+	// runs at a random interval.
+	MaxSeconds int `json:"maxSeconds,omitempty"`
+	// If this is a one time run of the task, rather than
+	// its recurring schedule.
+	OneTime bool `json:"oneTime,omitempty"`
+	// Where this task was defined.
+	Origin TaskOrigin `json:"origin"`
+	// Priority of this task, from TASK_PRIORITY.
+	Priority int `json:"priority"`
+	// Pool this task runs in.
+	Pool TaskPool `json:"pool"`
+	// If this task has been disabled, by rescheduling it to 0 seconds
+	// or by failing too many times in a row.
+	Disabled bool `json:"disabled,omitempty"`
+	// Set if the task disabled itself, see TASK_DISABLE_AFTER_FAILURES.
+	AutoDisabled *TaskAutoDisabled `json:"autoDisabled,omitempty"`
+	// If this task is hidden from the task list (see TASK_HIDDEN).
+	Hidden bool `json:"hidden,omitempty"`
+	// When the current run started, if the task is running.
+	RunningSince *time.Time `json:"runningSince,omitempty"`
+	// If the current run has been going for so long it is likely stuck.
+	Stuck bool `json:"stuck,omitempty"`
+	// Health of the task from 0 to 100, going by its success rate,
+	// failure streak and SLA adherence since startup (see `getTaskHealth`).
+	Health int `json:"health"`
+	// Shortest interval (seconds) this task can be rescheduled to,
+	// see `getTaskIntervalConstraints`.
+	MinSeconds int `json:"minSeconds"`
+}
+
+type TaskDetailResponse struct {
+	AllTasksResponse
+	// ID of the job in the scheduler, for debugging.
+	// Stays the same when the task is rescheduled, since the
+	// job is updated in place, but changes after a restart.
+	JobID string `json:"jobId"`
+	// Circuit breakers for external services this task uses.
+	Breakers map[string]TaskBreaker `json:"breakers"`
+	// Set while the task is boosted.
+	Boost *TaskBoost `json:"boost,omitempty"`
+	// Set if the task is experimental, toggled by a task flag.
+	Flag *TaskFlagState `json:"flag,omitempty"`
+	// Settings in effect, including those inherited from TASK_DEFAULTS.
+	Settings TaskEffectiveSettings `json:"settings"`
+	// What the tasks minimum interval comes from.
+	IntervalConstraints []TaskIntervalConstraint `json:"intervalConstraints"`
 }
 
+// What to do with a run that was missed, because the server was down.
+type TaskMissedRunPolicy string
+
+var (
+	// Missed runs are skipped, the task next runs on its usual schedule.
+	TASK_MISSED_RUN_SKIP TaskMissedRunPolicy = "skip"
+	// A missed run is caught up on as soon as the scheduler starts.
+	TASK_MISSED_RUN_CATCH_UP TaskMissedRunPolicy = "catch-up"
+)
+
+type TaskOrigin string
+
+var (
+	// Tasks defined in code, these can't be removed.
+	TASK_ORIGIN_BUILTIN TaskOrigin = "builtin"
+	// Tasks defined in the server config.
+	TASK_ORIGIN_CONFIG TaskOrigin = "config"
+	// Tasks added via the api.
+	TASK_ORIGIN_API TaskOrigin = "api"
+)
+
 type TaskFunc struct {
+	// Default display name for task.
+	name string
+	// Where this task was defined.
+	origin TaskOrigin
 	// Task function.
-	f func()
+	// Errors returned are recorded in the tasks status.
+	f func() error
 	// Default duration (schedule) for task.
 	dd time.Duration
+	// Optional: If the task has anything to do. A built-in task isn't
+	// registered while this returns false at startup, `syncFeatureTasks`
+	// registers it once it is true. It is also checked before each run,
+	// runs are skipped while it returns false, since config (eg. arr
+	// servers) can change while running.
+	shouldRun func() bool
+	// Pool the task runs in, light if not set.
+	pool TaskPool
+	// Optional: Database the task uses. Its connection is checked before
+	// each run and the run is skipped (rather than failing) if it is down.
+	db *gorm.DB
+	// If runs can be asked to stop early (see `cancelTaskRun`).
+	cancellable bool
+	// Optional: Check something the task depends on (eg. an integration)
+	// is reachable, before it is scheduled at startup. If it fails, the
+	// task isn't scheduled until it passes (see `probeTasks`). Should be
+	// quick, it holds up startup (up to taskProbeTimeout). Only for builtin tasks.
+	probe func() error
+	// If its failures report on something else (eg. our tmdb key being
+	// rejected), rather than the task itself being broken. Such tasks are
+	// never auto disabled, whatever TASK_DISABLE_AFTER_FAILURES says.
+	noAutoDisable bool
 }
 
 var taskScheduler gocron.Scheduler
 
-// All task functions are stored here so when updating (rescheduling)
+// IDs of tasks that need referencing elsewhere.
+const taskIdRefreshArrQueues = "refresh_arr_queues"
+
+// Tag given to one time jobs, so they can be told apart
+// from the recurring job of the same name.
+const taskTagOneTime = "one-time"
+
+// All task functions are stored here (by task id) so when updating (rescheduling)
 // a job, we can give it this function again.
 // Doesn't seem to be a way to only update the schedule of a job,
 // the .Update func wants the whole definition again.
 //
 // All funcs simply call a cleaning/routine method where the rest of the
 // related code lives so it's kept tidy.
-var taskFuncs map[string]TaskFunc
+var (
+	taskFuncs   map[string]TaskFunc
+	taskFuncsMu sync.RWMutex
+	// Held while updating a job in the scheduler (see `updateTaskInScheduler`).
+	taskSchedulerUpdateMu sync.Mutex
+)
 
 // Setup recurring tasks (eg cleanup every x mins)
 func setupTasks(db *gorm.DB) {
@@ -49,86 +199,761 @@ func setupTasks(db *gorm.DB) {
 		return
 	}
 	taskScheduler = ts
+	taskDb = db
+	// Only used by read heavy tasks, for their scans.
+	readDb := openTaskReadDb(db)
+	taskReadDb = readDb
+
+	builtin, features := getTaskDefinitions(db, readDb)
+
+	// Anything left running by the last run of the server should be retried.
+	resetRunningQueuedTasks(db)
+
+	reportTaskFuncs := getTaskReportFuncs(readDb)
+	prepareTaskConfig(builtin, features, reportTaskFuncs)
+
+	setupTaskPools()
+
+	// Tasks whose probe failed, they are registered once it passes.
+	heldBack := probeTasks(builtin)
+	// Tasks with nothing to do, they are registered once they have.
+	// After probing, so Retry Task Probes knows if anything is held back.
+	for k := range holdBackConditionalTasks(builtin, heldBack) {
+		heldBack[k] = true
+	}
+
+	taskFuncsMu.Lock()
+	taskFuncs = map[string]TaskFunc{}
+	for k, v := range builtin {
+		if heldBack[k] {
+			continue
+		}
+		v.origin = TASK_ORIGIN_BUILTIN
+		taskFuncs[k] = v
+	}
+	taskFuncsMu.Unlock()
+
+	// Add all jobs to scheduler.
+	for k, v := range builtin {
+		if heldBack[k] {
+			continue
+		}
+		err = addTaskToScheduler(k, v.dd)
+		if err != nil {
+			slog.Error("SetupTasks: Failed to add new job", "job", k, "err", err)
+		}
+	}
+
+	featureTasksMu.Lock()
+	featureTasks = features
+	featureTasksMu.Unlock()
+	loadTaskFlags(db)
+	syncFeatureTasks()
+
+	for k, v := range reportTaskFuncs {
+		if err := registerTask(k, v); err != nil {
+			slog.Error("SetupTasks: Failed to register report task", "job", k, "err", err)
+		}
+	}
+
+	startTaskScheduler()
+	slog.Info("SetupTasks: Jobs created and scheduler started.")
+}
+
+// Migrate and validate task config against the tasks defined, before
+// any of them run. Used by `setupTasks` and when running a single task
+// from the cli, so both run tasks with the same config.
+func prepareTaskConfig(builtin map[string]TaskFunc, features map[string]FeatureTask, reports map[string]TaskFunc) {
+	migrateTaskConfigKeys(builtin)
+	featureTaskFuncs := map[string]TaskFunc{}
+	for k, v := range features {
+		featureTaskFuncs[k] = v.task
+	}
+	migrateTaskConfigKeys(featureTaskFuncs)
+	validateTaskSchedules(builtin)
+	validateTaskSchedules(featureTaskFuncs)
+	validateTaskSchedules(reports)
+	validateTaskDefaults()
+	taskIds := map[string]bool{}
+	for _, tfs := range []map[string]TaskFunc{builtin, featureTaskFuncs, reports} {
+		for k := range tfs {
+			taskIds[k] = true
+		}
+	}
+	validateTaskAfter(taskIds)
+	validateTaskWindows(taskIds)
+}
+
+// Get how long the scheduler waits after startup before starting.
+func getTaskStartupDelay() time.Duration {
+	taskConfigMu.RLock()
+	defer taskConfigMu.RUnlock()
+	return time.Duration(Config.TASK_STARTUP_DELAY) * time.Second
+}
+
+// Start the scheduler, once TASK_STARTUP_DELAY has passed.
+// No jobs run while waiting.
+func startTaskScheduler() {
+	if delay := getTaskStartupDelay(); delay > 0 {
+		slog.Info("SetupTasks: Jobs created, waiting for startup delay before starting scheduler.", "delay", delay)
+		taskClock.Sleep(delay)
+	}
+	taskScheduler.Start()
+}
 
-	// Define all task funcs.
-	taskFuncs = map[string]TaskFunc{
-		"Cleanup Tokens": {
-			f: func() {
-				cleanupTokens(db)
+// Get all built-in and feature tasks, keyed by their id.
+// Used by `setupTasks` and when running a single task from the cli.
+func getTaskDefinitions(db *gorm.DB, readDb *gorm.DB) (map[string]TaskFunc, map[string]FeatureTask) {
+	// Define all task funcs, keyed by their id.
+	// Ids must never change, they are used in the api and config.
+	builtin := map[string]TaskFunc{
+		"cleanup_tokens": {
+			name: "Cleanup Tokens",
+			f: func() error {
+				return cleanupTokens(db)
 			},
 			dd: 60 * time.Second,
+			db: db,
 		},
-		"Refresh Arr Queues": {
-			f: func() {
-				refreshArrQueues()
+		taskIdRefreshArrQueues: {
+			name: "Refresh Arr Queues",
+			shouldRun: func() bool {
+				return len(Config.RADARR) > 0 || len(Config.SONARR) > 0
+			},
+			f: func() error {
+				return refreshArrQueues()
 			},
 			dd: 60 * time.Second,
 		},
-		"Cleanup Images": {
-			f: func() {
-				cleanupImages(db)
+		taskIdCheckArrDownloads: {
+			name: "Check Arr Downloads",
+			shouldRun: func() bool {
+				return len(Config.RADARR) > 0 || len(Config.SONARR) > 0
+			},
+			f: func() error {
+				return checkArrDownloads(db)
+			},
+			dd:   10 * time.Minute,
+			pool: TASK_POOL_HEAVY,
+			db:   db,
+		},
+		taskIdWarmTrendingCache: {
+			name: "Warm Trending Cache",
+			f: func() error {
+				return warmTrendingCache()
+			},
+			dd:   1 * time.Hour,
+			pool: TASK_POOL_HEAVY,
+		},
+		"cleanup_images": {
+			name: "Cleanup Images",
+			f: func() error {
+				return cleanupImages(db)
+			},
+			dd:          24 * time.Hour,
+			pool:        TASK_POOL_HEAVY,
+			db:          db,
+			cancellable: true,
+		},
+		"generate_list_previews": {
+			name: "Generate List Previews",
+			f: func() error {
+				return generateListPreviews(db)
+			},
+			dd:   time.Hour,
+			pool: TASK_POOL_HEAVY,
+			db:   db,
+		},
+		"sync_to_trakt": {
+			name:      "Sync To Trakt",
+			shouldRun: isTraktSyncEnabled,
+			f: func() error {
+				return syncToTrakt(db)
+			},
+			dd:   1 * time.Hour,
+			pool: TASK_POOL_HEAVY,
+			db:   db,
+		},
+		"refresh_integration_tokens": {
+			name:      "Refresh Integration Tokens",
+			shouldRun: isTraktSyncEnabled,
+			f: func() error {
+				return refreshIntegrationTokens(db)
+			},
+			dd: 1 * time.Hour,
+			db: db,
+		},
+		taskIdCheckIntegrations: {
+			name: "Check Integrations",
+			f: func() error {
+				return checkIntegrations()
+			},
+			dd:   24 * time.Hour,
+			pool: TASK_POOL_HEAVY,
+		},
+		"check_jellyfin_connections": {
+			name: "Check Jellyfin Connections",
+			shouldRun: func() bool {
+				return Config.JELLYFIN_HOST != ""
+			},
+			probe: func() error {
+				if Config.JELLYFIN_HOST == "" {
+					// Nothing to check, its runs are skipped.
+					return nil
+				}
+				var info map[string]interface{}
+				return jellyfinAPIRequest("GET", "/System/Info/Public", map[string]string{}, "", "", &info)
+			},
+			f: func() error {
+				return checkJellyfinConnections(db)
+			},
+			dd:   24 * time.Hour,
+			pool: TASK_POOL_HEAVY,
+			db:   db,
+		},
+		"process_queue": {
+			name: "Process Queue",
+			f: func() error {
+				return processQueue(db)
+			},
+			dd: 30 * time.Second,
+			db: db,
+		},
+		"cleanup_stuck_imports": {
+			name: "Cleanup Stuck Imports",
+			f: func() error {
+				return cleanupStuckJobs()
+			},
+			dd: 10 * time.Minute,
+		},
+		"detect_duplicates": {
+			name: "Detect Duplicates",
+			f: func() error {
+				return detectDuplicateWatched(db)
+			},
+			dd:   24 * time.Hour,
+			pool: TASK_POOL_HEAVY,
+			db:   db,
+		},
+		"cleanup_orphaned_episodes": {
+			name: "Cleanup Orphaned Episodes",
+			f: func() error {
+				return cleanupOrphanedEpisodes(db)
+			},
+			dd:   24 * time.Hour,
+			pool: TASK_POOL_HEAVY,
+			db:   db,
+		},
+		"cache_backdrops": {
+			name: "Cache Backdrops",
+			f: func() error {
+				return cacheBackdrops(db)
+			},
+			dd:   24 * time.Hour,
+			pool: TASK_POOL_HEAVY,
+			db:   db,
+		},
+		"refetch_missing_posters": {
+			name: "Refetch Missing Posters",
+			f: func() error {
+				return refetchMissingPosters(readDb)
+			},
+			dd:   24 * time.Hour,
+			pool: TASK_POOL_HEAVY,
+			db:   db,
+		},
+		taskIdRetryTaskProbes: {
+			name:      "Retry Task Probes",
+			shouldRun: hasPendingTaskProbes,
+			f: func() error {
+				return retryTaskProbes()
+			},
+			dd: time.Minute,
+		},
+		taskIdBackfillImages: {
+			name: "Backfill Images",
+			f: func() error {
+				return backfillImages(db)
+			},
+			dd:          24 * time.Hour,
+			pool:        TASK_POOL_HEAVY,
+			db:          db,
+			cancellable: true,
+		},
+		"refresh_watch_providers": {
+			name: "Refresh Watch Providers",
+			f: func() error {
+				return refreshWatchProviders(db)
+			},
+			dd:   24 * time.Hour,
+			pool: TASK_POOL_HEAVY,
+			db:   db,
+		},
+		"recompute_ratings": {
+			name: "Recompute Ratings",
+			f: func() error {
+				return recomputeRatings(db, readDb)
+			},
+			dd:   6 * time.Hour,
+			pool: TASK_POOL_HEAVY,
+			db:   db,
+		},
+		"refresh_calendars": {
+			name: "Refresh Calendars",
+			f: func() error {
+				return refreshCalendars(db)
+			},
+			dd:   24 * time.Hour,
+			pool: TASK_POOL_HEAVY,
+			db:   db,
+		},
+		"check_tmdb_rate_limits": {
+			name: "Check TMDB Rate Limits",
+			f:    checkTMDBRateLimits,
+			dd:   time.Hour,
+			db:   db,
+		},
+		"check_migrations": {
+			name: "Check Migrations",
+			f: func() error {
+				return checkMigrationsTask(db)
 			},
 			dd: 24 * time.Hour,
+			db: db,
+		},
+		"check_tmdb_key": {
+			name: "Check TMDB Key",
+			f: func() error {
+				return checkTMDBKey(db)
+			},
+			dd:            24 * time.Hour,
+			db:            db,
+			noAutoDisable: true,
+		},
+		"compact_activity": {
+			name: "Compact Activity",
+			f: func() error {
+				return compactActivity(db)
+			},
+			dd:   24 * time.Hour,
+			pool: TASK_POOL_HEAVY,
+			db:   db,
+		},
+		"repair_progress": {
+			name: "Repair Progress",
+			f: func() error {
+				return repairProgress(db)
+			},
+			dd:   24 * time.Hour,
+			pool: TASK_POOL_HEAVY,
+			db:   db,
+		},
+		"repair_activity": {
+			name: "Repair Activity",
+			f: func() error {
+				return repairActivity(db)
+			},
+			dd:   24 * time.Hour,
+			pool: TASK_POOL_HEAVY,
+			db:   db,
+		},
+		"reconcile_show_counts": {
+			name: "Reconcile Show Counts",
+			f: func() error {
+				return reconcileShowCounts(db)
+			},
+			dd:   24 * time.Hour,
+			pool: TASK_POOL_HEAVY,
+			db:   db,
 		},
 	}
 
-	// Add all jobs to scheduler.
-	for k, v := range taskFuncs {
-		err = addTaskToScheduler(k, v.dd)
+	// Tasks that are only registered while their feature is enabled,
+	// `syncFeatureTasks` adds/removes them when it is toggled.
+	features := map[string]FeatureTask{
+		"stale_watching_reminders": {
+			enabled: isStaleWatchingRemindersEnabled,
+			task: TaskFunc{
+				name: "Stale Watching Reminders",
+				f: func() error {
+					return remindStaleWatching(db)
+				},
+				dd:   24 * time.Hour,
+				pool: TASK_POOL_HEAVY,
+				db:   db,
+			},
+		},
+		"rotate_logs": {
+			enabled: isLogRotationEnabled,
+			task: TaskFunc{
+				name: "Rotate Logs",
+				f: func() error {
+					return rotateLogs()
+				},
+				dd: 1 * time.Hour,
+			},
+		},
+		taskIdSyncArrRemovals: {
+			enabled: isArrSyncRemovalsEnabled,
+			task: TaskFunc{
+				name: "Sync Arr Removals",
+				shouldRun: func() bool {
+					return len(Config.RADARR) > 0 || len(Config.SONARR) > 0
+				},
+				f: func() error {
+					return syncArrRemovals(db)
+				},
+				dd: 1 * time.Hour,
+				db: db,
+			},
+		},
+		taskIdSendTelemetry: {
+			enabled: isTelemetryEnabled,
+			task: TaskFunc{
+				name: "Send Telemetry",
+				f: func() error {
+					return sendTelemetry(db)
+				},
+				dd: 7 * 24 * time.Hour,
+				db: db,
+			},
+		},
+		// Experimental tasks, toggled by their task flag.
+		"sync_collections": {
+			enabled: func() bool {
+				return isTaskFlagEnabled("sync_collections")
+			},
+			task: TaskFunc{
+				name: "Sync Collections",
+				f: func() error {
+					return syncCollections(db)
+				},
+				dd:   24 * time.Hour,
+				pool: TASK_POOL_HEAVY,
+				db:   db,
+			},
+		},
+		"compute_recommendations": {
+			enabled: func() bool {
+				return isTaskFlagEnabled("compute_recommendations")
+			},
+			task: TaskFunc{
+				name: "Compute Recommendations",
+				f: func() error {
+					return computeRecommendations(db, readDb)
+				},
+				dd:   24 * time.Hour,
+				pool: TASK_POOL_HEAVY,
+				db:   db,
+			},
+		},
+	}
+	return builtin, features
+}
+
+// Indexes on columns our cleanup tasks filter by, without these
+// the cleanup deletes do full table scans on larger instances.
+var taskIndexes = []struct {
+	model  any
+	name   string
+	table  string
+	column string
+}{
+	{&Token{}, "idx_tokens_created_at", "tokens", "created_at"},
+	{&User{}, "idx_users_avatar_id", "users", "avatar_id"},
+}
+
+// Ensure indexes required by tasks exist, creating any that are missing.
+// Must be ran after db migrations, so the tables exist.
+func ensureTaskIndexes(db *gorm.DB) {
+	for _, v := range taskIndexes {
+		if db.Migrator().HasIndex(v.model, v.name) {
+			continue
+		}
+		err := db.Exec("CREATE INDEX IF NOT EXISTS " + v.name + " ON " + v.table + "(" + v.column + ")").Error
 		if err != nil {
-			slog.Error("SetupTasks: Failed to add new job", "job", k, "err", err)
+			slog.Error("ensureTaskIndexes: Failed to create index!", "index", v.name, "error", err)
+			continue
 		}
+		slog.Info("ensureTaskIndexes: Created missing index.", "index", v.name)
 	}
+}
 
-	taskScheduler.Start()
-	slog.Info("SetupTasks: Jobs created and scheduler started.")
+// Task config used to be keyed by display name, before tasks had ids.
+// Move any config still using a built-in tasks old name over to its id.
+func migrateTaskConfigKeys(builtin map[string]TaskFunc) {
+	changed := false
+	taskConfigMu.Lock()
+	for id, tf := range builtin {
+		changed = moveTaskConfigKey(Config.TASK_SCHEDULE, tf.name, id) || changed
+		changed = moveTaskConfigKey(Config.TASK_SCHEDULE_RANGE, tf.name, id) || changed
+		changed = moveTaskConfigKey(Config.TASK_SLA, tf.name, id) || changed
+		changed = moveTaskConfigKey(Config.TASK_PRIORITY, tf.name, id) || changed
+	}
+	taskConfigMu.Unlock()
+	if !changed {
+		return
+	}
+	slog.Info("migrateTaskConfigKeys: Moved task config from task names to ids.")
+	if err := writeConfig(); err != nil {
+		slog.Error("migrateTaskConfigKeys: Failed to write updated config to file!", "error", err)
+	}
+}
+
+// Move value in `m` from key `from` to `to`, unless `to` is already set.
+// Returns true if `m` was changed.
+func moveTaskConfigKey[V any](m map[string]V, from string, to string) bool {
+	v, ok := m[from]
+	if !ok {
+		return false
+	}
+	if _, exists := m[to]; !exists {
+		m[to] = v
+	}
+	delete(m, from)
+	return true
+}
+
+// Get a tasks func by id.
+func getTaskFunc(id string) (TaskFunc, bool) {
+	taskFuncsMu.RLock()
+	defer taskFuncsMu.RUnlock()
+	tf, ok := taskFuncs[id]
+	return tf, ok
+}
+
+// Get a tasks display name, from TASK_NAMES if set there.
+func getTaskDisplayName(id string) string {
+	taskConfigMu.RLock()
+	n := Config.TASK_NAMES[id]
+	taskConfigMu.RUnlock()
+	if n != "" {
+		return n
+	}
+	if tf, ok := getTaskFunc(id); ok && tf.name != "" {
+		return tf.name
+	}
+	return id
 }
 
 // Gets schedule from config, or `defaultDur` if not manually configured.
-func getTaskSeconds(name string, defaultDur time.Duration) time.Duration {
-	s := defaultDur
-	if Config.TASK_SCHEDULE[name] != 0 {
-		s = time.Duration(Config.TASK_SCHEDULE[name]) * time.Second
+// `defaultDur` is scaled by TASK_INTERVAL_MULTIPLIER, manual schedules are not.
+func getTaskSeconds(id string, defaultDur time.Duration) time.Duration {
+	if s := getTaskSchedule(id); s != 0 {
+		return time.Duration(s) * time.Second
+	}
+	if m := getTaskIntervalMultiplier(); m > 0 && m != 1 {
+		return time.Duration(float64(defaultDur) * m).Round(time.Second)
+	}
+	return defaultDur
+}
+
+// Get TASK_INTERVAL_MULTIPLIER, 0 if not set.
+func getTaskIntervalMultiplier() float64 {
+	taskConfigMu.RLock()
+	defer taskConfigMu.RUnlock()
+	return Config.TASK_INTERVAL_MULTIPLIER
+}
+
+// Get a tasks schedule (seconds) from TASK_SCHEDULE, 0 if not set.
+func getTaskSchedule(id string) int {
+	taskConfigMu.RLock()
+	defer taskConfigMu.RUnlock()
+	return Config.TASK_SCHEDULE[id]
+}
+
+// Gets random schedule range from config, if one is configured and valid.
+func getTaskRange(id string) (TaskScheduleRange, bool) {
+	taskConfigMu.RLock()
+	r, ok := Config.TASK_SCHEDULE_RANGE[id]
+	taskConfigMu.RUnlock()
+	if !ok {
+		return TaskScheduleRange{}, false
+	}
+	if r.Min <= 0 || r.Min >= r.Max {
+		slog.Error("getTaskRange: Invalid schedule range, min must be above 0 and less than max. Ignoring.", "job_name", id, "range", r)
+		return TaskScheduleRange{}, false
+	}
+	return r, true
+}
+
+// Gets a tasks missed run policy from config (or TASK_DEFAULTS), defaults to skipping
+// missed runs so a restart doesn't set off every task at once.
+func getTaskMissedRunPolicy(id string) TaskMissedRunPolicy {
+	taskConfigMu.RLock()
+	p, ok := Config.TASK_MISSED_RUN[id]
+	if !ok {
+		p = Config.TASK_DEFAULTS.MissedRun
+	}
+	taskConfigMu.RUnlock()
+	if p == "" {
+		return TASK_MISSED_RUN_SKIP
+	}
+	if p != TASK_MISSED_RUN_SKIP && p != TASK_MISSED_RUN_CATCH_UP {
+		slog.Error("getTaskMissedRunPolicy: Invalid missed run policy. Using skip.", "job_name", id, "policy", p)
+		return TASK_MISSED_RUN_SKIP
+	}
+	return p
+}
+
+// If a task should catch up on a run it missed, going by its last
+// run in history. Tasks that have never ran haven't missed anything.
+func taskMissedRun(id string, defaultDur time.Duration) bool {
+	if getTaskMissedRunPolicy(id) != TASK_MISSED_RUN_CATCH_UP || taskDb == nil {
+		return false
+	}
+	interval := getTaskSeconds(id, defaultDur)
+	if r, ok := getTaskRange(id); ok {
+		interval = time.Duration(r.Max) * time.Second
+	}
+	var last TaskRun
+	res := taskDb.Where("task_id = ?", id).Order("started_at DESC").Limit(1).Find(&last)
+	if res.Error != nil {
+		slog.Error("taskMissedRun: Failed to get last run of task.", "job_name", id, "error", res.Error)
+		return false
+	}
+	if res.RowsAffected == 0 {
+		return false
 	}
-	return s
+	return taskSince(last.StartedAt) > interval
+}
+
+// Get the interval a task runs at, using its configured schedule.
+// For tasks ran at a random interval, this is the minimum.
+func getTaskInterval(id string, defaultDur time.Duration) time.Duration {
+	if b, ok := getTaskBoost(id); ok {
+		return time.Duration(b.Seconds) * time.Second
+	}
+	if r, ok := getTaskRange(id); ok {
+		return time.Duration(r.Min) * time.Second
+	}
+	return getTaskSeconds(id, defaultDur)
+}
+
+// Get job definition for a task, using its configured schedule.
+// While a task is boosted, its boost interval is used instead.
+func getTaskJobDefinition(id string, defaultDur time.Duration) gocron.JobDefinition {
+	if b, ok := getTaskBoost(id); ok {
+		return gocron.DurationJob(time.Duration(b.Seconds) * time.Second)
+	}
+	if r, ok := getTaskRange(id); ok {
+		return gocron.DurationRandomJob(time.Duration(r.Min)*time.Second, time.Duration(r.Max)*time.Second)
+	}
+	return gocron.DurationJob(getTaskSeconds(id, defaultDur))
 }
 
 // Add new job to scheduler.
-func addTaskToScheduler(name string, defaultDur time.Duration) error {
-	s := getTaskSeconds(name, defaultDur)
+// Should only be used at startup (or when registering a task), tasks that
+// missed a run while the server was down (and want to catch up) are ran right away.
+func addTaskToScheduler(id string, defaultDur time.Duration) error {
+	opts := []gocron.JobOption{gocron.WithName(id)}
+	caughtUp := taskMissedRun(id, defaultDur)
+	if caughtUp {
+		slog.Info("addTaskToScheduler: Task missed a run while server was down, catching up.", "job_name", id)
+		opts = append(opts, gocron.WithStartAt(gocron.WithStartImmediately()))
+	}
+	setTaskCaughtUp(id, caughtUp)
 	_, err := taskScheduler.NewJob(
-		gocron.DurationJob(s),
-		gocron.NewTask(taskFuncs[name].f),
-		gocron.WithName(name),
+		getTaskJobDefinition(id, defaultDur),
+		gocron.NewTask(runScheduledTask, id),
+		opts...,
 	)
-	slog.Debug("addTaskToScheduler: Job added.", "job_name", name, "duration_used", s, "duration_default", defaultDur)
+	slog.Info("addTaskToScheduler: Job added.", "job_name", id, "duration_used", getTaskSeconds(id, defaultDur), "duration_default", defaultDur, "multiplier", getTaskIntervalMultiplier())
 	return err
 }
 
 // Get all tasks in a consumable format.
-func getAllTasks() []AllTasksResponse {
+// If `failingOnly`, only tasks whose last run failed are returned.
+// Hidden tasks are left out, unless `includeHidden`.
+func getAllTasks(failingOnly bool, includeHidden bool) []AllTasksResponse {
 	jobs := []AllTasksResponse{}
 	for _, j := range taskScheduler.Jobs() {
-		j2a := AllTasksResponse{
-			Name: j.Name(),
+		j2a := jobToTaskResponse(j)
+		if failingOnly && j2a.ConsecutiveFailures == 0 {
+			continue
 		}
-		nextRun, err := j.NextRun()
-		if err != nil {
-			slog.Error("getAllTasks: Failed to get next run time for a job.", "job_name", j2a.Name)
-		} else {
-			j2a.NextRun = nextRun
+		if j2a.Hidden && !includeHidden {
+			continue
 		}
-		j2a.Seconds = int(getTaskSeconds(j2a.Name, taskFuncs[j2a.Name].dd).Seconds())
 		jobs = append(jobs, j2a)
 	}
 	return jobs
 }
 
-// Get task (job) from scheduler by name.
-func getTask(name string) *gocron.Job {
+// Get a single (recurring) task by id, with extra detail.
+func getTaskDetail(id string) (TaskDetailResponse, error) {
+	j := getTask(id)
+	if j == nil {
+		return TaskDetailResponse{}, errors.New("no task found")
+	}
+	resp := TaskDetailResponse{
+		AllTasksResponse: jobToTaskResponse(*j),
+		JobID:            (*j).ID().String(),
+		Breakers:         getTaskBreakers(id),
+	}
+	if b, ok := getTaskBoost(id); ok {
+		resp.Boost = &b
+	}
+	if f, ok := getTaskFlag(id); ok {
+		resp.Flag = &f
+	}
+	if tf, ok := getTaskFunc(id); ok {
+		resp.Settings = getTaskEffectiveSettings(id, tf)
+		resp.IntervalConstraints = getTaskIntervalConstraints(id, tf)
+	}
+	return resp, nil
+}
+
+// Convert scheduler job to our task response.
+// Jobs are named by their task id.
+func jobToTaskResponse(j gocron.Job) AllTasksResponse {
+	j2a := AllTasksResponse{
+		ID:         j.Name(),
+		Name:       getTaskDisplayName(j.Name()),
+		TaskStatus: getTaskStatus(j.Name()),
+	}
+	tf, _ := getTaskFunc(j.Name())
+	j2a.Origin = tf.origin
+	j2a.Priority = getTaskPriority(j.Name())
+	j2a.Pool = getTaskPool(j.Name())
+	j2a.Disabled = isTaskDisabled(j.Name())
+	taskConfigMu.RLock()
+	j2a.Hidden = Config.TASK_HIDDEN[j.Name()]
+	taskConfigMu.RUnlock()
+	j2a.Health = getTaskHealth(j2a.TaskStatus, getTaskSLA(j.Name()) > 0)
+	j2a.MinSeconds = getTaskMinSeconds(j.Name(), tf)
+	if d, ok := getTaskAutoDisabled(j.Name()); ok {
+		j2a.AutoDisabled = &d
+	}
+	if since := getTaskRunningSince(j.Name()); !since.IsZero() {
+		j2a.RunningSince = &since
+		j2a.Stuck = taskSince(since) > taskStuckAfter
+	}
+	nextRun, err := j.NextRun()
+	if err != nil {
+		slog.Error("jobToTaskResponse: Failed to get next run time for a job.", "job_name", j2a.ID)
+	} else {
+		j2a.NextRun = nextRun
+	}
+	if slices.Contains(j.Tags(), taskTagOneTime) {
+		j2a.OneTime = true
+	} else {
+		if r, ok := getTaskRange(j2a.ID); ok {
+			j2a.Seconds = r.Min
+			j2a.MaxSeconds = r.Max
+		} else {
+			j2a.Seconds = int(getTaskSeconds(j2a.ID, tf.dd).Seconds())
+		}
+	}
+	return j2a
+}
+
+// Get task (job) from scheduler by id.
+// One time jobs are ignored, only the recurring job is returned.
+func getTask(id string) *gocron.Job {
 	var job *gocron.Job
 	for _, j := range taskScheduler.Jobs() {
-		if j.Name() == name {
+		if j.Name() == id && !slices.Contains(j.Tags(), taskTagOneTime) {
 			job = &j
 			break
 		}
@@ -136,38 +961,284 @@ func getTask(name string) *gocron.Job {
 	return job
 }
 
-// Reschedule a task by name.
-func rescheduleTask(name string, req TaskRescheduleRequest) error {
-	if req.Seconds == 0 {
+// Check a reschedule request is valid, without looking at the task.
+func checkTaskReschedule(req TaskRescheduleRequest) error {
+	if req.Seconds == nil {
 		return errors.New("request has no seconds")
 	}
-	j := getTask(name)
+	seconds := *req.Seconds
+	if seconds < 0 {
+		return errors.New("seconds can't be negative")
+	}
+	if seconds > 0 && req.MaxSeconds != 0 && req.MaxSeconds <= seconds {
+		return errors.New("max seconds must be more than seconds")
+	}
+	return nil
+}
+
+// Reschedule a task by id.
+func rescheduleTask(id string, req TaskRescheduleRequest) error {
+	if err := checkTaskReschedule(req); err != nil {
+		return err
+	}
+	seconds := *req.Seconds
+	j := getTask(id)
 	if j == nil {
 		return errors.New("no task found")
 	}
+	if seconds == 0 {
+		return setTaskEnabled(id, false)
+	}
+	tf, _ := getTaskFunc(id)
+	if err := checkTaskMinInterval(id, tf, seconds); err != nil {
+		return err
+	}
 	// Update config
+	taskConfigMu.Lock()
 	if Config.TASK_SCHEDULE == nil {
 		Config.TASK_SCHEDULE = map[string]int{}
 	}
-	Config.TASK_SCHEDULE[name] = req.Seconds
+	Config.TASK_SCHEDULE[id] = seconds
+	wasAutoDisabled := clearTaskDisabled(id)
+	if req.MaxSeconds != 0 {
+		if Config.TASK_SCHEDULE_RANGE == nil {
+			Config.TASK_SCHEDULE_RANGE = map[string]TaskScheduleRange{}
+		}
+		Config.TASK_SCHEDULE_RANGE[id] = TaskScheduleRange{Min: seconds, Max: req.MaxSeconds}
+	} else {
+		delete(Config.TASK_SCHEDULE_RANGE, id)
+	}
+	taskConfigMu.Unlock()
+	if wasAutoDisabled {
+		resetTaskConsecutiveFailures(id)
+	}
 	if err := writeConfig(); err != nil {
 		slog.Error("rescheduleTask: Failed to write updated config to file!", "error", err)
 		return errors.New("failed to write config")
 	}
 	// Update job in scheduler
+	if err := updateTaskInScheduler(*j, tf.dd); err != nil {
+		slog.Error("rescheduleTask: Failed to update job!", "error", err)
+		return errors.New("failed to update job")
+	}
+	return nil
+}
+
+// If a task has been disabled (see TASK_DISABLED).
+func isTaskDisabled(id string) bool {
+	taskConfigMu.RLock()
+	defer taskConfigMu.RUnlock()
+	return Config.TASK_DISABLED[id]
+}
+
+// Enable or disable a task. A disabled task keeps its job (and schedule),
+// its runs are skipped until it is enabled again.
+func setTaskEnabled(id string, enabled bool) error {
+	if _, ok := getTaskFunc(id); !ok {
+		return errors.New("no task found")
+	}
+	taskConfigMu.Lock()
+	if Config.TASK_DISABLED[id] == !enabled {
+		taskConfigMu.Unlock()
+		return nil
+	}
+	wasAutoDisabled := false
+	if enabled {
+		wasAutoDisabled = clearTaskDisabled(id)
+	} else {
+		if Config.TASK_DISABLED == nil {
+			Config.TASK_DISABLED = map[string]bool{}
+		}
+		Config.TASK_DISABLED[id] = true
+	}
+	taskConfigMu.Unlock()
+	if wasAutoDisabled {
+		resetTaskConsecutiveFailures(id)
+	}
+	if err := writeConfig(); err != nil {
+		slog.Error("setTaskEnabled: Failed to write updated config to file!", "error", err)
+		return errors.New("failed to write config")
+	}
+	slog.Info("setTaskEnabled: Task updated.", "job_name", id, "enabled", enabled)
+	return nil
+}
+
+// Mark a task as enabled in the config (without writing it).
+// Must hold taskConfigMu. Returns true if the task had disabled itself,
+// the caller must then reset its failure streak (once the lock is
+// released) so it isn't disabled again by the next failure.
+func clearTaskDisabled(id string) bool {
+	delete(Config.TASK_DISABLED, id)
+	if _, ok := Config.TASK_AUTO_DISABLED[id]; ok {
+		delete(Config.TASK_AUTO_DISABLED, id)
+		return true
+	}
+	return false
+}
+
+// Update a tasks (recurring) job in the scheduler to use its current schedule.
+// The job keeps its ID.
+//
+// Updating a job would normally restart its clock (next run = now + interval),
+// so a task changed just before it was due would have to wait a whole interval.
+// Instead, time since the tasks last run is counted, the next run is at
+// `last run + new interval` (or right away if that has passed already).
+// If the task hasn't ran yet, the earlier of its old next run and
+// `now + new interval` is used.
+func updateTaskInScheduler(j gocron.Job, defaultDur time.Duration) error {
+	id := j.Name()
+	interval := getTaskInterval(id, defaultDur)
+	now := time.Now()
+	next := now.Add(interval)
+	// Our status includes one time runs, which the job doesn't know about.
+	if last := getTaskStatus(id).LastRun; !last.IsZero() {
+		next = last.Add(interval)
+	} else if oldNext, err := j.NextRun(); err == nil && !oldNext.IsZero() && oldNext.Before(next) {
+		next = oldNext
+	}
+	startAt := gocron.WithStartImmediately()
+	// Small buffer so the start time can't be in the past by the time it is checked.
+	if next.After(now.Add(time.Second)) {
+		startAt = gocron.WithStartDateTime(next)
+	}
+	// Two updates of the same job at once can leave gocron waiting
+	// forever on a job it already replaced, so only one at a time.
+	taskSchedulerUpdateMu.Lock()
+	defer taskSchedulerUpdateMu.Unlock()
 	_, err := taskScheduler.Update(
-		(*j).ID(),
-		gocron.DurationJob(
-			time.Duration(req.Seconds)*time.Second,
-		),
-		gocron.NewTask(
-			taskFuncs[name].f,
-		),
-		gocron.WithName(name),
+		j.ID(),
+		getTaskJobDefinition(id, defaultDur),
+		gocron.NewTask(runScheduledTask, id),
+		gocron.WithName(id),
+		gocron.WithStartAt(startAt),
+	)
+	if err == nil {
+		slog.Debug("updateTaskInScheduler: Job updated.", "job_name", id, "interval", interval, "next_run", next)
+	}
+	return err
+}
+
+// Schedule a task by id to run once at `req.At`.
+// This is separate from the tasks recurring schedule, the
+// one time job removes itself from the scheduler after running.
+func scheduleTaskOnce(id string, req TaskRunOnceRequest) error {
+	if _, ok := getTaskFunc(id); !ok {
+		return errors.New("no task found")
+	}
+	if !req.At.After(time.Now()) {
+		return errors.New("run time must be in the future")
+	}
+	if req.TimeoutSeconds < 0 || req.TimeoutSeconds > int(taskRunTimeoutMax.Seconds()) {
+		return fmt.Errorf("timeoutSeconds can't be negative or more than %d", int(taskRunTimeoutMax.Seconds()))
+	}
+	timeout := time.Duration(req.TimeoutSeconds) * time.Second
+	_, err := taskScheduler.NewJob(
+		gocron.OneTimeJob(gocron.OneTimeJobStartDateTime(req.At)),
+		gocron.NewTask(runTaskWithTimeout, id, timeout),
+		gocron.WithName(id),
+		gocron.WithTags(taskTagOneTime),
+		gocron.WithLimitedRuns(1),
 	)
 	if err != nil {
-		slog.Error("rescheduleTask: Failed to update job!", "error", err)
-		return errors.New("failed to update job")
+		slog.Error("scheduleTaskOnce: Failed to add one time job!", "job_name", id, "at", req.At, "error", err)
+		return errors.New("failed to schedule task")
+	}
+	slog.Info("scheduleTaskOnce: One time job added.", "job_name", id, "at", req.At, "timeout", timeout)
+	return nil
+}
+
+// Max seconds a seeded run can be put off for.
+const taskSeedMaxSeconds = 300
+
+// Test action: run a task by id shortly (default in 10 seconds), to check it
+// works without waiting on its schedule. Uses a one time job, so the recurring
+// schedule (and its next run) is left alone.
+func seedTaskRun(id string, req TaskSeedRequest) (TaskSeedResponse, error) {
+	secs := req.Seconds
+	if secs == 0 {
+		secs = 10
+	}
+	if secs < 1 || secs > taskSeedMaxSeconds {
+		return TaskSeedResponse{}, fmt.Errorf("seconds must be between 1 and %d", taskSeedMaxSeconds)
+	}
+	at := time.Now().Add(time.Duration(secs) * time.Second)
+	if err := scheduleTaskOnce(id, TaskRunOnceRequest{At: at}); err != nil {
+		return TaskSeedResponse{}, err
 	}
+	slog.Warn("seedTaskRun: TEST ACTION, seeded a run of task outside its schedule.", "job_name", id, "at", at)
+	return TaskSeedResponse{At: at}, nil
+}
+
+// Remove a task by id.
+// Built-in tasks can't be removed, only tasks added from config or the api.
+func removeTask(id string) error {
+	tf, ok := getTaskFunc(id)
+	if !ok {
+		return errors.New("no task found")
+	}
+	if tf.origin == TASK_ORIGIN_BUILTIN {
+		return errors.New("built-in tasks cannot be removed")
+	}
+	if err := deregisterTask(id); err != nil {
+		return err
+	}
+	taskConfigMu.Lock()
+	ok = deleteTaskConfig(id)
+	taskConfigMu.Unlock()
+	if ok {
+		if err := writeConfig(); err != nil {
+			slog.Error("removeTask: Failed to write updated config to file!", "error", err)
+		}
+	}
+	slog.Info("removeTask: Task removed.", "job_name", id)
 	return nil
 }
+
+// Remove task `id` from every per task config map, so a task added
+// later with the same id doesn't pick up its settings.
+// Returns true if anything was removed.
+// Must be called with taskConfigMu held.
+func deleteTaskConfig(id string) bool {
+	removed := false
+	for _, ok := range []bool{
+		deleteConfigKey(Config.TASK_SCHEDULE, id),
+		deleteConfigKey(Config.TASK_NAMES, id),
+		deleteConfigKey(Config.TASK_SCHEDULE_RANGE, id),
+		deleteConfigKey(Config.TASK_HIDDEN, id),
+		deleteConfigKey(Config.TASK_DISABLED, id),
+		deleteConfigKey(Config.TASK_DISABLE_AFTER_FAILURES, id),
+		deleteConfigKey(Config.TASK_AUTO_DISABLED, id),
+		deleteConfigKey(Config.TASK_DEFER_DURING_IMPORT, id),
+		deleteConfigKey(Config.TASK_SLA, id),
+		deleteConfigKey(Config.TASK_MISSED_RUN, id),
+		deleteConfigKey(Config.TASK_PRIORITY, id),
+		deleteConfigKey(Config.TASK_NICE, id),
+		deleteConfigKey(Config.TASK_ERROR_LOG_WINDOW, id),
+		deleteConfigKey(Config.TASK_AFTER, id),
+		deleteConfigKey(Config.TASK_WINDOWS, id),
+	} {
+		removed = removed || ok
+	}
+	return removed
+}
+
+// Delete `key` from `m`, returning true if it was there.
+func deleteConfigKey[V any](m map[string]V, key string) bool {
+	if _, ok := m[key]; !ok {
+		return false
+	}
+	delete(m, key)
+	return true
+}
+
+// Reset a tasks run stats and close its circuit breakers.
+// Its schedule is left alone.
+func resetTask(id string) (TaskDetailResponse, error) {
+	if _, ok := getTaskFunc(id); !ok {
+		return TaskDetailResponse{}, errors.New("no task found")
+	}
+	resetTaskStatus(id)
+	resetTaskBreakers(id)
+	slog.Info("resetTask: Task stats reset.", "job_name", id)
+	return getTaskDetail(id)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+)
+
+// Run a task after another one, instead of on its own schedule.
+type TaskAfter struct {
+	// ID of the task to run after.
+	Task string
+	// Seconds after it succeeds to run.
+	Delay int
+}
+
+var (
+	// Valid TASK_AFTER entries, by the id of the task that runs after.
+	taskAfter   = map[string]TaskAfter{}
+	taskAfterMu sync.RWMutex
+	// Tasks with a run after their predecessor waiting to start.
+	taskAfterPending   = map[string]bool{}
+	taskAfterPendingMu sync.Mutex
+)
+
+// Validate TASK_AFTER against the tasks in `ids`, keeping entries whose
+// predecessor exists and doesn't (eventually) run after the task itself.
+// Entries making a cycle would never run, so they are all dropped.
+func validateTaskAfter(ids map[string]bool) {
+	taskConfigMu.RLock()
+	valid := map[string]TaskAfter{}
+	for id, a := range Config.TASK_AFTER {
+		if !ids[id] {
+			slog.Error("validateTaskAfter: Ignoring entry for a task that doesn't exist.", "job_name", id)
+			continue
+		}
+		if !ids[a.Task] {
+			slog.Error("validateTaskAfter: Ignoring entry, task to run after doesn't exist.", "job_name", id, "after", a.Task)
+			continue
+		}
+		if a.Delay < 0 {
+			slog.Warn("validateTaskAfter: Negative delay, running straight after instead.", "job_name", id, "delay", a.Delay)
+			a.Delay = 0
+		}
+		// Each task runs after at most one other, so following
+		// predecessors either ends or comes back around.
+		chain := []string{id}
+		cycle := false
+		for cur := a.Task; cur != ""; cur = Config.TASK_AFTER[cur].Task {
+			chain = append(chain, cur)
+			if cur == id {
+				cycle = true
+				break
+			}
+			if len(chain) > len(Config.TASK_AFTER)+1 {
+				// Cycle further up the chain, it is dropped when its own tasks are checked.
+				break
+			}
+		}
+		if cycle {
+			slog.Error("validateTaskAfter: Ignoring entry, tasks would run after each other forever.", "job_name", id, "cycle", strings.Join(chain, " -> "))
+			continue
+		}
+		valid[id] = a
+	}
+	taskConfigMu.RUnlock()
+	taskAfterMu.Lock()
+	taskAfter = valid
+	taskAfterMu.Unlock()
+}
+
+// Get what a task runs after, if it runs after another task.
+func getTaskAfter(id string) (TaskAfter, bool) {
+	taskAfterMu.RLock()
+	defer taskAfterMu.RUnlock()
+	a, ok := taskAfter[id]
+	return a, ok
+}
+
+// Run a task on its schedule. Tasks that run after another
+// (TASK_AFTER) skip these, they only run once it succeeds.
+// Manual runs aren't affected.
+func runScheduledTask(id string) {
+	if a, ok := getTaskAfter(id); ok {
+		slog.Debug("runScheduledTask: Skipping scheduled run, task runs after another.", "job_name", id, "after", a.Task)
+		publishTaskEvent(TaskEvent{Type: TASK_EVENT_SKIPPED, Task: id, Time: taskClock.Now(), Reason: "runs after " + a.Task})
+		return
+	}
+	runTask(id)
+}
+
+// Start the tasks that run after task `id`, called once a run of it succeeds.
+// Called by the run itself rather than from its task events, which can be
+// dropped when subscribers fall behind.
+func startTasksAfter(id string) {
+	next := getTasksAfter(id)
+	if taskScheduler == nil {
+		// Running a single task from the cli.
+		if len(next) > 0 {
+			slog.Info("startTasksAfter: Not starting tasks that run after this one, no scheduler is running.", "job_name", id, "next", next)
+		}
+		return
+	}
+	for _, n := range next {
+		scheduleTaskAfter(n, id)
+	}
+}
+
+// Get the ids of the tasks that run after task `id`.
+func getTasksAfter(id string) []string {
+	taskAfterMu.RLock()
+	defer taskAfterMu.RUnlock()
+	var next []string
+	for n, a := range taskAfter {
+		if a.Task == id {
+			next = append(next, n)
+		}
+	}
+	slices.Sort(next)
+	return next
+}
+
+// Run a task its delay after its predecessor succeeded, unless a run is
+// already waiting. Runs through the usual checks, so it is still skipped
+// while disabled, in quiet hours, etc.
+func scheduleTaskAfter(id string, after string) {
+	a, ok := getTaskAfter(id)
+	if !ok {
+		return
+	}
+	taskAfterPendingMu.Lock()
+	if taskAfterPending[id] {
+		taskAfterPendingMu.Unlock()
+		slog.Debug("scheduleTaskAfter: Run already waiting, not adding another.", "job_name", id, "after", after)
+		return
+	}
+	taskAfterPending[id] = true
+	taskAfterPendingMu.Unlock()
+	at := time.Now().Add(time.Duration(a.Delay) * time.Second)
+	start := gocron.OneTimeJobStartDateTime(at)
+	if a.Delay == 0 {
+		// Would be in the past by the time the scheduler checks it.
+		start = gocron.OneTimeJobStartImmediately()
+	}
+	_, err := taskScheduler.NewJob(
+		gocron.OneTimeJob(start),
+		gocron.NewTask(runTaskAfter, id),
+		gocron.WithName(id),
+		gocron.WithTags(taskTagOneTime),
+		gocron.WithLimitedRuns(1),
+	)
+	if err != nil {
+		slog.Error("scheduleTaskAfter: Failed to add job!", "job_name", id, "after", after, "error", err)
+		clearTaskAfterPending(id)
+		return
+	}
+	slog.Info("scheduleTaskAfter: Task will run after its predecessor succeeded.", "job_name", id, "after", after, "at", at)
+}
+
+func runTaskAfter(id string) {
+	clearTaskAfterPending(id)
+	runTask(id)
+}
+
+func clearTaskAfterPending(id string) {
+	taskAfterPendingMu.Lock()
+	defer taskAfterPendingMu.Unlock()
+	delete(taskAfterPending, id)
+}
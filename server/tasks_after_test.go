@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Tasks A and B, with B running straight after A succeeds.
+// Returns the order runs of them finished in.
+func useAfterTestTasks(t *testing.T, aErr error) func() []string {
+	t.Helper()
+	useTestConfig(t)
+	Config.TASK_AFTER = map[string]TaskAfter{"test_after_b": {Task: "test_after_a"}}
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	done := func(id string) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, id)
+	}
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_after_a": {name: "A", f: func() error { done("test_after_a"); return aErr }, dd: time.Hour},
+		"test_after_b": {name: "B", f: func() error { done("test_after_b"); return nil }, dd: time.Hour},
+	})
+	validateTaskAfter(map[string]bool{"test_after_a": true, "test_after_b": true})
+	taskScheduler.Start()
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, order...)
+	}
+}
+
+func TestTaskAfterRunsOnceItsPredecessorSucceeds(t *testing.T) {
+	order := useAfterTestTasks(t, nil)
+	if got := order(); len(got) != 0 {
+		t.Fatalf("tasks ran before A was triggered: %v", got)
+	}
+	runTaskOutcome("test_after_a")
+	waitFor(t, "B to run after A", func() bool {
+		return len(order()) == 2
+	})
+	if got := order(); got[0] != "test_after_a" || got[1] != "test_after_b" {
+		t.Errorf("runs finished in order %v, want A then B", got)
+	}
+}
+
+func TestTaskAfterNotRunWhenPredecessorFails(t *testing.T) {
+	order := useAfterTestTasks(t, errors.New("failed"))
+	runTaskOutcome("test_after_a")
+	time.Sleep(100 * time.Millisecond)
+	if got := order(); len(got) != 1 {
+		t.Errorf("runs were %v, want only A", got)
+	}
+}
+
+func TestTaskAfterSkipsScheduleAfterUpdate(t *testing.T) {
+	var runs atomic.Int32
+	useTestConfig(t)
+	Config.TASK_AFTER = map[string]TaskAfter{"test_after_updated": {Task: "test_after_pred"}}
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_after_pred":    {name: "Pred", f: func() error { return nil }, dd: time.Hour},
+		"test_after_updated": {name: "Updated", f: func() error { runs.Add(1); return nil }, dd: time.Hour},
+	})
+	validateTaskAfter(map[string]bool{"test_after_pred": true, "test_after_updated": true})
+	taskScheduler.Start()
+	// Updated jobs must still only run after their predecessor.
+	j := getTask("test_after_updated")
+	if err := updateTaskInScheduler(*j, 20*time.Millisecond); err != nil {
+		t.Fatalf("failed to update job: %v", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if n := runs.Load(); n != 0 {
+		t.Errorf("task ran %d times on its own schedule, want 0", n)
+	}
+}
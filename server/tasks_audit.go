@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type TaskAuditAction string
+
+var (
+	TASK_AUDIT_RESCHEDULE TaskAuditAction = "RESCHEDULE"
+	TASK_AUDIT_DISABLE    TaskAuditAction = "DISABLE"
+	TASK_AUDIT_ENABLE     TaskAuditAction = "ENABLE"
+	// Ran once at a set time (run now).
+	TASK_AUDIT_RUN_ONCE TaskAuditAction = "RUN_ONCE"
+	// Ran once in a few seconds, to test it.
+	TASK_AUDIT_SEED TaskAuditAction = "SEED"
+	// Ran more often for a while, or stopped doing so early.
+	TASK_AUDIT_BOOST   TaskAuditAction = "BOOST"
+	TASK_AUDIT_UNBOOST TaskAuditAction = "UNBOOST"
+	// Force unlocked while stuck running.
+	TASK_AUDIT_UNLOCK TaskAuditAction = "UNLOCK"
+	// Asked to stop its current run early.
+	TASK_AUDIT_CANCEL TaskAuditAction = "CANCEL"
+	// Stats and breakers reset.
+	TASK_AUDIT_RESET  TaskAuditAction = "RESET"
+	TASK_AUDIT_REMOVE TaskAuditAction = "REMOVE"
+	// Schedule and stats replaced by those in a snapshot.
+	TASK_AUDIT_RESTORE TaskAuditAction = "RESTORE"
+	// Settings of the scheduler as a whole changed, has no task id.
+	TASK_AUDIT_SETTINGS TaskAuditAction = "SETTINGS"
+)
+
+// A change an admin made to a task, so it is known who made it.
+type TaskAudit struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
+	// ID of the admin that made the change.
+	UserID uint `gorm:"not null" json:"userId"`
+	// Empty for changes to the scheduler as a whole.
+	TaskID string          `gorm:"index;not null" json:"taskId"`
+	Action TaskAuditAction `gorm:"not null" json:"action"`
+	// Interval (seconds) before and after a reschedule, 0 when disabled.
+	OldSeconds int `json:"oldSeconds,omitempty"`
+	NewSeconds int `json:"newSeconds,omitempty"`
+	// When a one time run was scheduled for.
+	RunAt *time.Time `json:"runAt,omitempty"`
+}
+
+// Audit entry with the username of the admin that made it.
+type TaskAuditEntry struct {
+	TaskAudit
+	Username string `json:"username"`
+}
+
+// Max audit entries returned by `getTaskAudit`.
+const taskAuditMaxLimit = 1000
+
+// Interval (seconds) a task currently runs at, for auditing
+// reschedules. 0 if disabled or the task doesn't exist.
+func getTaskAuditSeconds(id string) int {
+	tf, ok := getTaskFunc(id)
+	if !ok || isTaskDisabled(id) {
+		return 0
+	}
+	return getTaskEffectiveSettings(id, tf).Seconds
+}
+
+// Record a change an admin made to a task. Failing to is only
+// logged, the change itself has already been made.
+func recordTaskAudit(db *gorm.DB, a TaskAudit) {
+	if res := db.Create(&a); res.Error != nil {
+		slog.Error("recordTaskAudit: Failed to save audit entry.", "job_name", a.TaskID, "action", a.Action, "user_id", a.UserID, "error", res.Error)
+		return
+	}
+	slog.Info("recordTaskAudit: Task changed by admin.", "job_name", a.TaskID, "action", a.Action, "user_id", a.UserID)
+}
+
+// Get task audit entries, newest first. Only entries for `task`,
+// if not empty. Returns up to `limit` entries (capped at `taskAuditMaxLimit`).
+func getTaskAudit(db *gorm.DB, task string, limit int) ([]TaskAuditEntry, error) {
+	if limit <= 0 || limit > taskAuditMaxLimit {
+		limit = taskAuditMaxLimit
+	}
+	q := db.Model(&TaskAudit{}).
+		Select("task_audits.*, users.username").
+		Joins("LEFT JOIN users ON users.id = task_audits.user_id")
+	if task != "" {
+		q = q.Where("task_audits.task_id = ?", task)
+	}
+	entries := []TaskAuditEntry{}
+	if res := q.Order("task_audits.created_at DESC, task_audits.id DESC").Limit(limit).Scan(&entries); res.Error != nil {
+		slog.Error("getTaskAudit: Failed to get audit entries.", "error", res.Error)
+		return []TaskAuditEntry{}, errors.New("failed to get task audit")
+	}
+	return entries, nil
+}
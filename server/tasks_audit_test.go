@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTaskAuditRescheduleRecordsActor(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_audit": {
+			name: "Test Audit",
+			f: func() error {
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+	db := newTestDb(t)
+	// Another admin, so the actor isn't just the first user.
+	other := User{Username: "other", Permissions: PERM_ADMIN}
+	if err := db.Create(&other).Error; err != nil {
+		t.Fatalf("failed to create admin: %v", err)
+	}
+	r, token := newTestTaskRouter(t, db)
+	var admin User
+	db.Where("username = ?", "admin").First(&admin)
+
+	w := doTestRequest(t, r, http.MethodPut, "/api/task/test_audit", token, map[string]int{"seconds": 7200})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	entries, err := getTaskAudit(db, "test_audit", 0)
+	if err != nil {
+		t.Fatalf("failed to get audit: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d audit entries, want 1", len(entries))
+	}
+	e := entries[0]
+	if e.UserID != admin.ID || e.Username != "admin" {
+		t.Errorf("audit actor is %d (%s), want %d (admin)", e.UserID, e.Username, admin.ID)
+	}
+	if e.Action != TASK_AUDIT_RESCHEDULE || e.OldSeconds != 3600 || e.NewSeconds != 7200 {
+		t.Errorf("got audit entry %+v, want a reschedule from 3600 to 7200", e)
+	}
+}
+
+func TestTaskAuditOtherChanges(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_audit_other": {
+			name: "Test Audit Other",
+			f: func() error {
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+	db := newTestDb(t)
+	r, token := newTestTaskRouter(t, db)
+
+	for _, req := range []struct {
+		method string
+		url    string
+		body   any
+	}{
+		{http.MethodPost, "/api/task/test_audit_other/reset", nil},
+		{http.MethodPost, "/api/task/test_audit_other/boost", map[string]int{"seconds": 600, "duration": 3600}},
+		{http.MethodDelete, "/api/task/test_audit_other/boost", nil},
+		{http.MethodPatch, "/api/task/settings", map[string]int{"concurrency": 2}},
+	} {
+		if w := doTestRequest(t, r, req.method, req.url, token, req.body); w.Code != http.StatusOK {
+			t.Fatalf("%s %s got %d: %s", req.method, req.url, w.Code, w.Body)
+		}
+	}
+	// Failed changes aren't audited.
+	if w := doTestRequest(t, r, http.MethodPost, "/api/task/test_audit_other/cancel", token, nil); w.Code == http.StatusOK {
+		t.Fatal("cancelled a task that isn't cancellable")
+	}
+
+	entries, err := getTaskAudit(db, "", 0)
+	if err != nil {
+		t.Fatalf("failed to get audit: %v", err)
+	}
+	got := []TaskAuditAction{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		got = append(got, entries[i].Action)
+	}
+	want := []TaskAuditAction{TASK_AUDIT_RESET, TASK_AUDIT_BOOST, TASK_AUDIT_UNBOOST, TASK_AUDIT_SETTINGS}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got audit actions %v, want %v", got, want)
+	}
+	if boost := entries[2]; boost.OldSeconds != 3600 || boost.NewSeconds != 600 {
+		t.Errorf("got boost entry %+v, want from 3600 to 600", boost)
+	}
+	if settings := entries[0]; settings.TaskID != "" {
+		t.Errorf("settings entry is for task %q, want none", settings.TaskID)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Why a task disabled itself, see TASK_DISABLE_AFTER_FAILURES.
+type TaskAutoDisabled struct {
+	// When the task was disabled.
+	At time.Time `json:"at"`
+	// Consecutive failures it was disabled after.
+	Failures int `json:"failures"`
+	// Error of the run that disabled it.
+	Reason string `json:"reason"`
+}
+
+// Get why a task disabled itself, if it did.
+func getTaskAutoDisabled(id string) (TaskAutoDisabled, bool) {
+	taskConfigMu.RLock()
+	defer taskConfigMu.RUnlock()
+	d, ok := Config.TASK_AUTO_DISABLED[id]
+	return d, ok
+}
+
+// Disable a task if it has failed as many times in a row as its
+// TASK_DISABLE_AFTER_FAILURES allows. Called after each failed run.
+// Unlike its breakers, the task stays disabled until an admin enables it.
+func checkTaskAutoDisable(id string, err error) {
+	limit := getTaskDisableAfterFailures(id)
+	if limit <= 0 {
+		return
+	}
+	failures := getTaskStatus(id).ConsecutiveFailures
+	if failures < limit {
+		return
+	}
+	d := TaskAutoDisabled{At: taskClock.Now(), Failures: failures, Reason: err.Error()}
+	taskConfigMu.Lock()
+	if Config.TASK_DISABLED[id] {
+		// Already disabled, eg. by an admin while this run was going.
+		taskConfigMu.Unlock()
+		return
+	}
+	if Config.TASK_DISABLED == nil {
+		Config.TASK_DISABLED = map[string]bool{}
+	}
+	if Config.TASK_AUTO_DISABLED == nil {
+		Config.TASK_AUTO_DISABLED = map[string]TaskAutoDisabled{}
+	}
+	Config.TASK_DISABLED[id] = true
+	Config.TASK_AUTO_DISABLED[id] = d
+	taskConfigMu.Unlock()
+	if err := writeConfig(); err != nil {
+		// Still disabled until restart.
+		slog.Error("checkTaskAutoDisable: Failed to write updated config to file!", "error", err)
+	}
+	slog.Warn("checkTaskAutoDisable: Task disabled after failing too many times in a row.", "job_name", id, "failures", failures, "reason", d.Reason)
+	notifyAdminsTaskDisabled(id, d)
+}
+
+// Let all admins know a task disabled itself.
+// Failing to notify doesn't stop the task being disabled.
+func notifyAdminsTaskDisabled(id string, d TaskAutoDisabled) {
+	msg := fmt.Sprintf("The %s task was disabled after failing %d times in a row (%s). Enable it again once the cause is fixed.", getTaskDisplayName(id), d.Failures, d.Reason)
+	notifyAdmins(taskDb, NOTIFICATION_TASK_DISABLED, msg)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTaskAutoDisablesAfterFailures(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_DISABLE_AFTER_FAILURES = map[string]int{"test_autodisable": 3}
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_autodisable": {
+			name: "Test Auto Disable",
+			f: func() error {
+				return errors.New("integration is misconfigured")
+			},
+			dd: time.Hour,
+		},
+	})
+	taskDb = newTestDb(t)
+	admin := User{Username: "admin", Permissions: PERM_ADMIN}
+	if err := taskDb.Create(&admin).Error; err != nil {
+		t.Fatalf("failed to create admin: %v", err)
+	}
+	for i := 1; i <= 2; i++ {
+		runTaskOutcome("test_autodisable")
+		if isTaskDisabled("test_autodisable") {
+			t.Fatalf("disabled after %d failures, want 3", i)
+		}
+	}
+	runTaskOutcome("test_autodisable")
+	if !isTaskDisabled("test_autodisable") {
+		t.Fatal("not disabled after 3 failures")
+	}
+	d, ok := getTaskAutoDisabled("test_autodisable")
+	if !ok || d.Failures != 3 || d.Reason != "integration is misconfigured" {
+		t.Errorf("got auto disabled %+v (%v), want 3 failures with the run error", d, ok)
+	}
+	if out := runTaskOutcome("test_autodisable"); out.Result != TASK_RUN_SKIPPED || out.Reason != "disabled" {
+		t.Errorf("run after disabling was %s (%s), want skipped as disabled", out.Result, out.Reason)
+	}
+	var notifs int64
+	taskDb.Model(&Notification{}).Where("user_id = ? AND type = ?", admin.ID, NOTIFICATION_TASK_DISABLED).Count(&notifs)
+	if notifs != 1 {
+		t.Errorf("admin got %d notifications, want 1", notifs)
+	}
+
+	// Stays disabled until enabled again, which resets the streak.
+	if err := setTaskEnabled("test_autodisable", true); err != nil {
+		t.Fatalf("failed to enable: %v", err)
+	}
+	if _, ok := getTaskAutoDisabled("test_autodisable"); ok {
+		t.Error("still marked auto disabled after enabling")
+	}
+	if f := getTaskStatus("test_autodisable").ConsecutiveFailures; f != 0 {
+		t.Errorf("failure streak is %d after enabling, want 0", f)
+	}
+}
+
+// Run with -race, task config is read by running tasks while the api changes it.
+func TestTaskConfigConcurrentAccess(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_DISABLE_AFTER_FAILURES = map[string]int{"test_config_race": 1}
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_config_race": {
+			name: "Test Config Race",
+			f: func() error {
+				return errors.New("failed")
+			},
+			dd: time.Hour,
+		},
+	})
+	taskDb = newTestDb(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			seconds := 3600
+			rescheduleTask("test_config_race", TaskRescheduleRequest{Seconds: &seconds})
+		}()
+		go func() {
+			defer wg.Done()
+			runTaskOutcome("test_config_race")
+		}()
+		go func() {
+			defer wg.Done()
+			getTaskEffectiveConfig()
+			writeConfig()
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type TaskBoostRequest struct {
+	// Seconds inbetween runs while boosted.
+	Seconds int `json:"seconds" binding:"required"`
+	// How long the boost lasts (seconds), before the
+	// tasks usual schedule is restored.
+	Duration int `json:"duration" binding:"required"`
+}
+
+// A temporary faster schedule for a task.
+type TaskBoost struct {
+	// Seconds inbetween runs while boosted.
+	Seconds int `json:"seconds"`
+	// When the boost ends.
+	Until time.Time `json:"until"`
+	// Restores the tasks schedule when the boost ends.
+	timer *time.Timer
+}
+
+// Longest a task can be boosted for.
+const taskBoostMaxDuration = time.Hour
+
+var (
+	taskBoosts   = map[string]*TaskBoost{}
+	taskBoostsMu sync.Mutex
+)
+
+// Get a tasks boost, if it has one that hasn't ended.
+func getTaskBoost(id string) (TaskBoost, bool) {
+	taskBoostsMu.Lock()
+	defer taskBoostsMu.Unlock()
+	b, ok := taskBoosts[id]
+	if !ok || !taskClock.Now().Before(b.Until) {
+		return TaskBoost{}, false
+	}
+	return *b, true
+}
+
+// Temporarily run a task more often. Its usual schedule is restored
+// once the boost ends. Boosting an already boosted task replaces its boost.
+// Boosts aren't saved, a restart ends them.
+func boostTask(id string, req TaskBoostRequest) (TaskBoost, error) {
+	j := getTask(id)
+	if j == nil {
+		return TaskBoost{}, errors.New("no task found")
+	}
+	if req.Seconds <= 0 {
+		return TaskBoost{}, errors.New("boost seconds must be more than 0")
+	}
+	dur := time.Duration(req.Duration) * time.Second
+	if dur <= 0 || dur > taskBoostMaxDuration {
+		return TaskBoost{}, errors.New("boost duration must be between 1 and 3600 seconds")
+	}
+	tf, _ := getTaskFunc(id)
+	b := &TaskBoost{Seconds: req.Seconds, Until: taskClock.Now().Add(dur)}
+	taskBoostsMu.Lock()
+	if old, ok := taskBoosts[id]; ok {
+		old.timer.Stop()
+	}
+	taskBoosts[id] = b
+	b.timer = time.AfterFunc(dur, func() {
+		endTaskBoost(id, b)
+	})
+	taskBoostsMu.Unlock()
+	if err := updateTaskInScheduler(*j, tf.dd); err != nil {
+		slog.Error("boostTask: Failed to update job!", "job_name", id, "error", err)
+		endTaskBoost(id, b)
+		return TaskBoost{}, errors.New("failed to update job")
+	}
+	slog.Info("boostTask: Task boosted.", "job_name", id, "seconds", b.Seconds, "until", b.Until)
+	return *b, nil
+}
+
+// End a tasks boost early.
+func unboostTask(id string) error {
+	taskBoostsMu.Lock()
+	b, ok := taskBoosts[id]
+	taskBoostsMu.Unlock()
+	if !ok {
+		return errors.New("task is not boosted")
+	}
+	b.timer.Stop()
+	endTaskBoost(id, b)
+	return nil
+}
+
+// Remove boost `b` from a task and restore its usual schedule.
+// Does nothing if the task has since been given a different boost.
+func endTaskBoost(id string, b *TaskBoost) {
+	taskBoostsMu.Lock()
+	if taskBoosts[id] != b {
+		taskBoostsMu.Unlock()
+		return
+	}
+	delete(taskBoosts, id)
+	taskBoostsMu.Unlock()
+	j := getTask(id)
+	if j == nil {
+		return
+	}
+	tf, _ := getTaskFunc(id)
+	if err := updateTaskInScheduler(*j, tf.dd); err != nil {
+		slog.Error("endTaskBoost: Failed to restore task schedule!", "job_name", id, "error", err)
+		return
+	}
+	slog.Info("endTaskBoost: Task boost ended, schedule restored.", "job_name", id)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Gap between the next two scheduled runs of task `id`.
+func getTestRunGap(t *testing.T, id string) time.Duration {
+	t.Helper()
+	var next []time.Time
+	waitFor(t, "next runs of "+id, func() bool {
+		next, _ = (*getTask(id)).NextRuns(2)
+		return len(next) == 2
+	})
+	return next[1].Sub(next[0])
+}
+
+func TestBoostTaskReverts(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_boost": {name: "Test Boost", f: func() error { return nil }, dd: time.Hour},
+	})
+	taskScheduler.Start()
+	if _, err := boostTask("test_boost", TaskBoostRequest{Seconds: 5, Duration: int(taskBoostMaxDuration.Seconds()) + 1}); err == nil {
+		t.Error("boosted for longer than the max duration")
+	}
+	b, err := boostTask("test_boost", TaskBoostRequest{Seconds: 5, Duration: 1})
+	if err != nil {
+		t.Fatalf("failed to boost: %v", err)
+	}
+	d, _ := getTaskDetail("test_boost")
+	if d.Boost == nil || d.Boost.Seconds != 5 || !d.Boost.Until.Equal(b.Until) {
+		t.Errorf("got detail boost %+v, want 5 seconds until %s", d.Boost, b.Until)
+	}
+	if gap := getTestRunGap(t, "test_boost"); gap != 5*time.Second {
+		t.Errorf("boosted task runs every %s, want 5s", gap)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if _, ok := getTaskBoost("test_boost"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("boost didn't end")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	waitFor(t, "schedule to be restored", func() bool {
+		return getTestRunGap(t, "test_boost") == time.Hour
+	})
+	if d, _ := getTaskDetail("test_boost"); d.Boost != nil {
+		t.Errorf("detail still shows boost %+v after it ended", d.Boost)
+	}
+	if err := unboostTask("test_boost"); err == nil {
+		t.Error("unboosted a task whose boost already ended")
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sbondCo/Watcharr/arr"
+)
+
+type BreakerState string
+
+var (
+	// Requests to the target are allowed.
+	BREAKER_CLOSED BreakerState = "closed"
+	// Target has failed too many times, requests are skipped until cooldown ends.
+	BREAKER_OPEN BreakerState = "open"
+	// Cooldown ended, one probe request is allowed to see if target recovered.
+	BREAKER_HALF_OPEN BreakerState = "half-open"
+)
+
+// Kind of error a target failed with, decides how much
+// the failure counts towards opening its breaker.
+type BreakerErrorClass string
+
+var (
+	// Target rejected our credentials (eg. bad api key), won't fix itself.
+	BREAKER_ERROR_AUTH BreakerErrorClass = "auth"
+	// Target couldn't be reached, timed out or is overloaded, likely to pass.
+	BREAKER_ERROR_TRANSIENT BreakerErrorClass = "transient"
+	BREAKER_ERROR_UNKNOWN   BreakerErrorClass = "unknown"
+)
+
+// Default weights of each error class. Auth errors open
+// the breaker straight away (their weight is the threshold).
+var defaultBreakerWeights = map[BreakerErrorClass]int{
+	BREAKER_ERROR_TRANSIENT: 1,
+	BREAKER_ERROR_UNKNOWN:   2,
+}
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 5 * time.Minute
+)
+
+// Circuit breaker for an external target (eg. an arr server) used by a task.
+// Stops tasks hammering targets that are down.
+type TaskBreaker struct {
+	State BreakerState `json:"state"`
+	// Failures in a row for this target.
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+	// Weighted total of the failures in a row, the
+	// breaker opens when it reaches the threshold.
+	Score int `json:"score"`
+	// Class of the last error, empty if the last request succeeded.
+	LastErrorClass BreakerErrorClass `json:"lastErrorClass,omitempty"`
+	// When the breaker last opened.
+	OpenedAt time.Time `json:"openedAt,omitempty"`
+	// When the probe of a half-open breaker was let through,
+	// zero if it isn't waiting on one.
+	ProbeAt time.Time `json:"probeAt,omitempty"`
+}
+
+var (
+	// Task id -> target -> breaker
+	taskBreakers   = map[string]map[string]*TaskBreaker{}
+	taskBreakersMu sync.Mutex
+)
+
+// Get how many failures in a row open a breaker.
+func getBreakerThreshold() int {
+	taskConfigMu.RLock()
+	t := Config.TASK_BREAKER_THRESHOLD
+	taskConfigMu.RUnlock()
+	if t > 0 {
+		return t
+	}
+	return defaultBreakerThreshold
+}
+
+// Get how long a breaker stays open before probing again.
+func getBreakerCooldown() time.Duration {
+	taskConfigMu.RLock()
+	c := Config.TASK_BREAKER_COOLDOWN
+	taskConfigMu.RUnlock()
+	if c > 0 {
+		return time.Duration(c) * time.Second
+	}
+	return defaultBreakerCooldown
+}
+
+// Get how much a failure of `class` counts towards opening a breaker,
+// from TASK_BREAKER_WEIGHTS if set there.
+func getBreakerWeight(class BreakerErrorClass) int {
+	taskConfigMu.RLock()
+	w := Config.TASK_BREAKER_WEIGHTS[string(class)]
+	taskConfigMu.RUnlock()
+	if w > 0 {
+		return w
+	}
+	if w, ok := defaultBreakerWeights[class]; ok {
+		return w
+	}
+	return getBreakerThreshold()
+}
+
+// Work out what kind of error a target failed with.
+func classifyBreakerError(err error) BreakerErrorClass {
+	var se *arr.StatusError
+	if errors.As(err, &se) {
+		switch {
+		case se.StatusCode == http.StatusUnauthorized || se.StatusCode == http.StatusForbidden:
+			return BREAKER_ERROR_AUTH
+		case se.StatusCode == http.StatusRequestTimeout || se.StatusCode == http.StatusTooManyRequests || se.StatusCode >= 500:
+			return BREAKER_ERROR_TRANSIENT
+		}
+		return BREAKER_ERROR_UNKNOWN
+	}
+	var ne net.Error
+	if errors.As(err, &ne) || errors.Is(err, context.DeadlineExceeded) {
+		return BREAKER_ERROR_TRANSIENT
+	}
+	return BREAKER_ERROR_UNKNOWN
+}
+
+// Must be called with taskBreakersMu held.
+func getBreaker(task string, target string) *TaskBreaker {
+	if taskBreakers[task] == nil {
+		taskBreakers[task] = map[string]*TaskBreaker{}
+	}
+	b, ok := taskBreakers[task][target]
+	if !ok {
+		b = &TaskBreaker{State: BREAKER_CLOSED}
+		taskBreakers[task][target] = b
+	}
+	return b
+}
+
+// If a task should attempt a request to `target`.
+// Moves an open breaker to half-open once its cooldown is over, then only
+// lets one probe through until its result is recorded. A probe that is
+// never recorded (eg. its run stopped before the request) is given up on
+// after another cooldown, so the breaker can't get stuck half-open.
+func breakerAllow(task string, target string) bool {
+	taskBreakersMu.Lock()
+	defer taskBreakersMu.Unlock()
+	b := getBreaker(task, target)
+	cooldown := getBreakerCooldown()
+	if b.State == BREAKER_OPEN {
+		if taskSince(b.OpenedAt) < cooldown {
+			return false
+		}
+		b.State = BREAKER_HALF_OPEN
+		b.ProbeAt = time.Time{}
+	}
+	if b.State == BREAKER_HALF_OPEN {
+		if !b.ProbeAt.IsZero() && taskSince(b.ProbeAt) < cooldown {
+			return false
+		}
+		b.ProbeAt = taskClock.Now()
+	}
+	return true
+}
+
+// Record result of a request to `target`.
+// Failures count towards opening the breaker by the weight of their class.
+func breakerRecord(task string, target string, err error) {
+	taskBreakersMu.Lock()
+	defer taskBreakersMu.Unlock()
+	b := getBreaker(task, target)
+	b.ProbeAt = time.Time{}
+	if err == nil {
+		b.State = BREAKER_CLOSED
+		b.ConsecutiveFailures = 0
+		b.Score = 0
+		b.LastErrorClass = ""
+		return
+	}
+	b.ConsecutiveFailures++
+	b.LastErrorClass = classifyBreakerError(err)
+	b.Score += getBreakerWeight(b.LastErrorClass)
+	// A failed probe re-opens straight away.
+	if b.State == BREAKER_HALF_OPEN || b.Score >= getBreakerThreshold() {
+		b.State = BREAKER_OPEN
+		b.OpenedAt = taskClock.Now()
+	}
+}
+
+// Get a copy of all breakers for a task.
+func getTaskBreakers(task string) map[string]TaskBreaker {
+	taskBreakersMu.Lock()
+	defer taskBreakersMu.Unlock()
+	bs := map[string]TaskBreaker{}
+	for k, v := range taskBreakers[task] {
+		bs[k] = *v
+	}
+	return bs
+}
+
+// Close (remove) all breakers for a task.
+func resetTaskBreakers(task string) {
+	taskBreakersMu.Lock()
+	defer taskBreakersMu.Unlock()
+	delete(taskBreakers, task)
+}
+
+// Remove a tasks breakers for targets `keep` returns false for (eg.
+// servers that are no longer configured). Returns the removed targets.
+func pruneTaskBreakers(task string, keep func(target string) bool) []string {
+	taskBreakersMu.Lock()
+	defer taskBreakersMu.Unlock()
+	var removed []string
+	for target := range taskBreakers[task] {
+		if !keep(target) {
+			delete(taskBreakers[task], target)
+			removed = append(removed, target)
+		}
+	}
+	return removed
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sbondCo/Watcharr/arr"
+)
+
+// Open the breaker of `task` for `target`, with an auth error.
+func openTestBreaker(t *testing.T, task string, target string) {
+	t.Helper()
+	resetTaskBreakers(task)
+	t.Cleanup(func() {
+		resetTaskBreakers(task)
+	})
+	breakerRecord(task, target, &arr.StatusError{StatusCode: http.StatusUnauthorized})
+	if b := getTaskBreakers(task)[target]; b.State != BREAKER_OPEN {
+		t.Fatalf("breaker is %s after an auth error, want open", b.State)
+	}
+}
+
+func TestBreakerHalfOpenAllowsOneProbe(t *testing.T) {
+	useTestConfig(t)
+	clock := useFakeTaskClock(t, time.Now())
+	openTestBreaker(t, "test_breaker", "sonarr main")
+	if breakerAllow("test_breaker", "sonarr main") {
+		t.Fatal("open breaker allowed a request during its cooldown")
+	}
+
+	clock.Advance(getBreakerCooldown())
+	var (
+		wg      sync.WaitGroup
+		allowed atomic.Int32
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if breakerAllow("test_breaker", "sonarr main") {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := allowed.Load(); n != 1 {
+		t.Fatalf("half-open breaker allowed %d requests at once, want 1 probe", n)
+	}
+
+	// Failed probe re-opens it, the next one after the cooldown closes it.
+	breakerRecord("test_breaker", "sonarr main", &arr.StatusError{StatusCode: http.StatusBadGateway})
+	if breakerAllow("test_breaker", "sonarr main") {
+		t.Fatal("breaker allowed a request straight after a failed probe")
+	}
+	clock.Advance(getBreakerCooldown())
+	if !breakerAllow("test_breaker", "sonarr main") {
+		t.Fatal("no probe allowed after the cooldown")
+	}
+	breakerRecord("test_breaker", "sonarr main", nil)
+	for i := 0; i < 3; i++ {
+		if !breakerAllow("test_breaker", "sonarr main") {
+			t.Fatal("closed breaker didn't allow a request")
+		}
+	}
+}
+
+func TestBreakerUnrecordedProbeGivenUp(t *testing.T) {
+	useTestConfig(t)
+	clock := useFakeTaskClock(t, time.Now())
+	openTestBreaker(t, "test_breaker_lost", "radarr main")
+	clock.Advance(getBreakerCooldown())
+	if !breakerAllow("test_breaker_lost", "radarr main") {
+		t.Fatal("no probe allowed after the cooldown")
+	}
+	// Its run never records a result.
+	clock.Advance(getBreakerCooldown() - time.Second)
+	if breakerAllow("test_breaker_lost", "radarr main") {
+		t.Fatal("second probe allowed while the first could still report back")
+	}
+	clock.Advance(time.Second)
+	if !breakerAllow("test_breaker_lost", "radarr main") {
+		t.Error("breaker stuck half-open on a probe that never reported back")
+	}
+}
+
+func TestClassifyBreakerError(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		want BreakerErrorClass
+	}{
+		{&arr.StatusError{StatusCode: http.StatusUnauthorized}, BREAKER_ERROR_AUTH},
+		{fmt.Errorf("sonarr main: %w", &arr.StatusError{StatusCode: http.StatusForbidden}), BREAKER_ERROR_AUTH},
+		{&arr.RequestError{Err: &arr.StatusError{StatusCode: http.StatusServiceUnavailable}}, BREAKER_ERROR_TRANSIENT},
+		{&arr.StatusError{StatusCode: http.StatusTooManyRequests}, BREAKER_ERROR_TRANSIENT},
+		{&arr.StatusError{StatusCode: http.StatusRequestTimeout}, BREAKER_ERROR_TRANSIENT},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, BREAKER_ERROR_TRANSIENT},
+		{context.DeadlineExceeded, BREAKER_ERROR_TRANSIENT},
+		{&arr.StatusError{StatusCode: http.StatusBadRequest}, BREAKER_ERROR_UNKNOWN},
+		{errors.New("failed to decode response"), BREAKER_ERROR_UNKNOWN},
+	} {
+		if got := classifyBreakerError(c.err); got != c.want {
+			t.Errorf("%v classified as %s, want %s", c.err, got, c.want)
+		}
+	}
+}
+
+func TestBreakerWeightsByErrorClass(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		weights map[string]int
+		err     error
+		// Failures in a row until the breaker opens.
+		opensAfter int
+	}{
+		{"auth", nil, &arr.StatusError{StatusCode: http.StatusUnauthorized}, 1},
+		{"transient", nil, &arr.StatusError{StatusCode: http.StatusBadGateway}, 5},
+		{"unknown", nil, errors.New("bad response"), 3},
+		{"configured transient", map[string]int{string(BREAKER_ERROR_TRANSIENT): 5}, &arr.StatusError{StatusCode: http.StatusBadGateway}, 1},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			useTestConfig(t)
+			useFakeTaskClock(t, time.Now())
+			Config.TASK_BREAKER_WEIGHTS = c.weights
+			resetTaskBreakers("test_breaker_weights")
+			t.Cleanup(func() {
+				resetTaskBreakers("test_breaker_weights")
+			})
+			for i := 1; i <= c.opensAfter; i++ {
+				breakerRecord("test_breaker_weights", "radarr main", c.err)
+				b := getTaskBreakers("test_breaker_weights")["radarr main"]
+				if open := b.State == BREAKER_OPEN; open != (i == c.opensAfter) {
+					t.Fatalf("breaker is %s after %d failures (score %d), want it open after %d", b.State, i, b.Score, c.opensAfter)
+				}
+			}
+		})
+	}
+}
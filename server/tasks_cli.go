@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"gorm.io/gorm"
+)
+
+// Result of running a single task from the cli, printed as json.
+type TaskCliResult struct {
+	Task string `json:"task"`
+	TaskRunOutcome
+	Summary map[string]any `json:"summary,omitempty"`
+	// Runs the scheduler would have started after this one, the tasks that
+	// run after it (TASK_AFTER) or its retry once imports finish. The cli
+	// doesn't run the scheduler, so these are left to its next run.
+	NotScheduled []string `json:"notScheduled,omitempty"`
+}
+
+// Run one task to completion, without starting the scheduler, then
+// return the exit code the process should exit with: 0 if the task
+// succeeded, 1 if it failed (or doesn't exist) and 2 if it was skipped
+// (eg. it is disabled or had nothing to do).
+// For running tasks from cron on the host, or in ci.
+// The run is saved to history like any other, so it shows up in the ui.
+// No scheduler is started, so tasks that run after it and retries of
+// deferred runs aren't, they are listed in the result instead.
+func runTaskCli(db *gorm.DB, id string) int {
+	taskDb = db
+	readDb := openTaskReadDb(db)
+	taskReadDb = readDb
+
+	builtin, features := getTaskDefinitions(db, readDb)
+	reports := getTaskReportFuncs(readDb)
+	prepareTaskConfig(builtin, features, reports)
+	loadTaskFlags(db)
+	setupTaskPools()
+
+	taskFuncsMu.Lock()
+	taskFuncs = map[string]TaskFunc{}
+	for k, v := range builtin {
+		v.origin = TASK_ORIGIN_BUILTIN
+		taskFuncs[k] = v
+	}
+	// Only feature tasks whose feature is enabled, like the scheduler.
+	for k, v := range features {
+		if v.enabled() {
+			v.task.origin = TASK_ORIGIN_BUILTIN
+			taskFuncs[k] = v.task
+		}
+	}
+	for k, v := range reports {
+		taskFuncs[k] = v
+	}
+	taskFuncsMu.Unlock()
+
+	if _, ok := getTaskFunc(id); !ok {
+		slog.Error("runTaskCli: Task does not exist.", "job_name", id)
+		fmt.Fprintf(os.Stderr, "no task found with id: %s\n", id)
+		return 1
+	}
+	slog.Info("runTaskCli: Running task.", "job_name", id)
+	out := runTaskOutcome(id)
+	r := TaskCliResult{Task: id, TaskRunOutcome: out, Summary: getTaskStatus(id).Summary}
+	if out.Result == TASK_RUN_SUCCESS {
+		r.NotScheduled = getTasksAfter(id)
+	} else if out.Reason == "deferred due to import" {
+		r.NotScheduled = []string{id}
+	}
+	j, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		slog.Error("runTaskCli: Failed to marshal result.", "error", err)
+	} else {
+		fmt.Println(string(j))
+	}
+	switch out.Result {
+	case TASK_RUN_SUCCESS:
+		return 0
+	case TASK_RUN_SKIPPED:
+		return 2
+	default:
+		return 1
+	}
+}
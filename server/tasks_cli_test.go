@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestRunTaskCliPreparesConfigLikeTheServer(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{})
+	oldReadDb, oldAdjustments := taskReadDb, taskScheduleAdjustments
+	t.Cleanup(func() {
+		taskReadDb, taskScheduleAdjustments = oldReadDb, oldAdjustments
+	})
+	// Still keyed by the old display name, and an interval the server would drop.
+	Config.TASK_SLA = map[string]int{"Cleanup Tokens": 30}
+	Config.TASK_SCHEDULE = map[string]int{"cleanup_tokens": -5}
+	db := newTestDb(t)
+
+	if code := runTaskCli(db, "cleanup_tokens"); code != 0 {
+		t.Fatalf("cli run exited with %d, want 0", code)
+	}
+	if sla, ok := Config.TASK_SLA["cleanup_tokens"]; !ok || sla != 30 {
+		t.Errorf("got sla config %v, want it moved to the tasks id", Config.TASK_SLA)
+	}
+	if _, ok := Config.TASK_SCHEDULE["cleanup_tokens"]; ok {
+		t.Errorf("got schedule config %v, want the negative interval removed", Config.TASK_SCHEDULE)
+	}
+	var runs []TaskRun
+	db.Where("task_id = ?", "cleanup_tokens").Find(&runs)
+	if len(runs) != 1 || runs[0].Result != TASK_RUN_SUCCESS {
+		t.Errorf("got runs %+v, want the cli run saved to history", runs)
+	}
+}
+
+// Run task `id` from the cli without a scheduler, like `-run-task`.
+// Returns its exit code and the result it printed.
+func runTestTaskCli(t *testing.T, db *gorm.DB, id string) (int, TaskCliResult) {
+	t.Helper()
+	oldStdout, oldScheduler := os.Stdout, taskScheduler
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	os.Stdout, taskScheduler = w, nil
+	code := runTaskCli(db, id)
+	os.Stdout, taskScheduler = oldStdout, oldScheduler
+	w.Close()
+	var res TaskCliResult
+	if err := json.NewDecoder(r).Decode(&res); err != nil {
+		t.Fatalf("failed to decode cli result: %v", err)
+	}
+	return code, res
+}
+
+func TestRunTaskCliDoesNotScheduleFollowUps(t *testing.T) {
+	useTestConfig(t)
+	useTestTaskImports(t)
+	useTestScheduler(t, map[string]TaskFunc{})
+	oldReadDb, oldAdjustments := taskReadDb, taskScheduleAdjustments
+	t.Cleanup(func() {
+		taskReadDb, taskScheduleAdjustments = oldReadDb, oldAdjustments
+		Config.TASK_AFTER = nil
+		validateTaskAfter(map[string]bool{})
+	})
+	Config.TASK_AFTER = map[string]TaskAfter{
+		"check_migrations":  {Task: "cleanup_tokens"},
+		"detect_duplicates": {Task: "check_migrations", Delay: 60},
+	}
+	db := newTestDb(t)
+
+	code, res := runTestTaskCli(t, db, "cleanup_tokens")
+	if code != 0 {
+		t.Fatalf("cli run of a task others run after exited with %d, want 0", code)
+	}
+	// Only the task straight after it, the rest of the chain follows that.
+	if want := []string{"check_migrations"}; !slices.Equal(res.NotScheduled, want) {
+		t.Errorf("got not scheduled %v, want %v", res.NotScheduled, want)
+	}
+	var runs []string
+	db.Model(&TaskRun{}).Order("id").Pluck("task_id", &runs)
+	if want := []string{"cleanup_tokens"}; !slices.Equal(runs, want) {
+		t.Errorf("got runs of %v, want only %v", runs, want)
+	}
+
+	touchTaskImport("test_cli_user")
+	code, res = runTestTaskCli(t, db, "cleanup_tokens")
+	if code != 2 {
+		t.Fatalf("cli run deferred because of an import exited with %d, want 2", code)
+	}
+	if want := []string{"cleanup_tokens"}; res.Reason != "deferred due to import" || !slices.Equal(res.NotScheduled, want) {
+		t.Errorf("got result %+v, want deferred with its retry not scheduled", res)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import "time"
+
+// Source of time for task logic (quiet hours, missed runs, breakers,
+// boosts, etc), so it can be swapped out with a fake one for testing.
+// The gocron scheduler keeps its own (real) clock, so times handed to it
+// (eg. when a job next runs) still use `time.Now`.
+type TaskClock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type realTaskClock struct{}
+
+func (realTaskClock) Now() time.Time        { return time.Now() }
+func (realTaskClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// Clock used by all task logic, the real clock unless replaced.
+var taskClock TaskClock = realTaskClock{}
+
+// Time since `t`, by the task clock.
+func taskSince(t time.Time) time.Duration {
+	return taskClock.Now().Sub(t)
+}
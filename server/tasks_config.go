@@ -0,0 +1,183 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// Task configuration that is actually in effect, with defaults
+// filled in. Only task settings are included, nothing that could
+// be secret (api keys, hosts, etc) is, so it can be shared as is.
+type TaskEffectiveConfig struct {
+	// TASK_INTERVAL_MULTIPLIER, 1 if not set.
+	IntervalMultiplier float64 `json:"intervalMultiplier"`
+	// Concurrency limit of each pool, 0 is unlimited.
+	PoolConcurrency map[TaskPool]int `json:"poolConcurrency"`
+	// Empty if not set.
+	QuietHours       TaskQuietHours `json:"quietHours"`
+	StartupDelay     int            `json:"startupDelay"`
+	BreakerThreshold int            `json:"breakerThreshold"`
+	// How much each error class counts towards BreakerThreshold.
+	BreakerWeights map[BreakerErrorClass]int `json:"breakerWeights"`
+	// Seconds.
+	BreakerCooldown      int  `json:"breakerCooldown"`
+	CleanupImagesWorkers int  `json:"cleanupImagesWorkers"`
+	MergeDuplicates      bool `json:"mergeDuplicates"`
+	ArrNotifyAvailable   bool `json:"arrNotifyAvailable"`
+	ArrSyncRemovals      bool `json:"arrSyncRemovals"`
+	// Only used while ArrSyncRemovals is enabled.
+	ArrRemovalAction       ArrRemovalAction `json:"arrRemovalAction"`
+	StaleWatchingReminders bool             `json:"staleWatchingReminders"`
+	RotateLogs             bool             `json:"rotateLogs"`
+	// If telemetry is opted in to and has somewhere to go.
+	Telemetry         bool `json:"telemetry"`
+	StaleWatchingDays int  `json:"staleWatchingDays"`
+	// Seconds.
+	CompactActivityWindow int            `json:"compactActivityWindow"`
+	CompactActivityTypes  []ActivityType `json:"compactActivityTypes"`
+	Timezone              string         `json:"timezone"`
+	// TASK_HISTORY_MAX_RUNS, 0 is unlimited.
+	HistoryMaxRuns int `json:"historyMaxRuns"`
+	// If read heavy tasks are using TASK_READ_DB.
+	SeparateReadDb bool `json:"separateReadDb"`
+	// Out of range intervals adjusted at startup.
+	ScheduleAdjustments []TaskScheduleAdjustment `json:"scheduleAdjustments,omitempty"`
+	Tasks               []TaskEffectiveSettings  `json:"tasks"`
+}
+
+type TaskEffectiveSettings struct {
+	ID     string     `json:"id"`
+	Name   string     `json:"name"`
+	Origin TaskOrigin `json:"origin"`
+	Pool   TaskPool   `json:"pool"`
+	// Interval (seconds) the task has when nothing is configured.
+	DefaultSeconds int `json:"defaultSeconds"`
+	// Interval (seconds) in use, the minimum if a range is configured.
+	Seconds int `json:"seconds"`
+	// Set if the task runs at a random interval.
+	MaxSeconds int `json:"maxSeconds,omitempty"`
+	// If the interval comes from TASK_SCHEDULE (or TASK_SCHEDULE_RANGE),
+	// rather than the (multiplied) default.
+	Overridden bool `json:"overridden"`
+	// Set if the task runs after another task (TASK_AFTER),
+	// its interval then isn't used.
+	After *TaskAfter `json:"after,omitempty"`
+	// Set while the task is boosted, its interval is the boost interval.
+	Boosted   bool                `json:"boosted,omitempty"`
+	Priority  int                 `json:"priority"`
+	MissedRun TaskMissedRunPolicy `json:"missedRun"`
+	// TASK_SLA (seconds), 0 if not set.
+	SLA int `json:"sla"`
+	// TASK_DISABLE_AFTER_FAILURES, 0 if not set.
+	DisableAfterFailures int `json:"disableAfterFailures"`
+	// TASK_NICE in use (limited to 1-19), 0 if not set.
+	Nice int `json:"nice"`
+	// If runs are deferred while an import is running (TASK_DEFER_DURING_IMPORT).
+	DeferDuringImport bool `json:"deferDuringImport"`
+	// Windows of the day the task can run in (TASK_WINDOWS),
+	// empty if it can always run.
+	Windows []TaskWindow `json:"windows"`
+	// TASK_ERROR_LOG_WINDOW (seconds), 0 if every failure is logged.
+	ErrorLogWindow int `json:"errorLogWindow"`
+	// False if the task is disabled or currently has nothing to do and its
+	// runs are skipped (eg. the service it uses isn't configured or it is opt-in).
+	Enabled bool `json:"enabled"`
+	// Settings above that come from TASK_DEFAULTS, since the
+	// task doesn't set its own.
+	Inherited []TaskSetting `json:"inherited"`
+}
+
+// Get the task config currently in effect, for debugging.
+func getTaskEffectiveConfig() TaskEffectiveConfig {
+	tz, _ := time.Now().Zone()
+	// Getters below take the lock themselves, so
+	// it is released before calling them.
+	taskConfigMu.RLock()
+	quietHours := Config.TASK_QUIET_HOURS
+	startupDelay := Config.TASK_STARTUP_DELAY
+	mergeDuplicates := Config.TASK_MERGE_DUPLICATES
+	staleWatchingReminders := Config.TASK_STALE_WATCHING_REMINDERS
+	multiplier := Config.TASK_INTERVAL_MULTIPLIER
+	taskConfigMu.RUnlock()
+	if multiplier <= 0 {
+		multiplier = 1
+	}
+	cfg := TaskEffectiveConfig{
+		IntervalMultiplier: multiplier,
+		PoolConcurrency: map[TaskPool]int{
+			TASK_POOL_LIGHT: max(getTaskPoolLimit(TASK_POOL_LIGHT), 0),
+			TASK_POOL_HEAVY: max(getTaskPoolLimit(TASK_POOL_HEAVY), 0),
+		},
+		QuietHours:       quietHours,
+		StartupDelay:     startupDelay,
+		BreakerThreshold: getBreakerThreshold(),
+		BreakerWeights: map[BreakerErrorClass]int{
+			BREAKER_ERROR_AUTH:      getBreakerWeight(BREAKER_ERROR_AUTH),
+			BREAKER_ERROR_TRANSIENT: getBreakerWeight(BREAKER_ERROR_TRANSIENT),
+			BREAKER_ERROR_UNKNOWN:   getBreakerWeight(BREAKER_ERROR_UNKNOWN),
+		},
+		BreakerCooldown:        int(getBreakerCooldown().Seconds()),
+		CleanupImagesWorkers:   getImageWorkers(),
+		MergeDuplicates:        mergeDuplicates,
+		ArrNotifyAvailable:     Config.TASK_ARR_NOTIFY_AVAILABLE,
+		ArrSyncRemovals:        Config.TASK_ARR_SYNC_REMOVALS,
+		ArrRemovalAction:       getArrRemovalAction(),
+		StaleWatchingReminders: staleWatchingReminders,
+		RotateLogs:             Config.TASK_ROTATE_LOGS,
+		Telemetry:              isTelemetryEnabled(),
+		StaleWatchingDays:      getStaleWatchingDays(),
+		CompactActivityWindow:  int(getCompactActivityWindow().Seconds()),
+		CompactActivityTypes:   getCompactActivityTypes(),
+		Timezone:               tz,
+		HistoryMaxRuns:         Config.TASK_HISTORY_MAX_RUNS,
+		SeparateReadDb:         taskReadDb != nil && taskReadDb != taskDb,
+		ScheduleAdjustments:    taskScheduleAdjustments,
+		Tasks:                  []TaskEffectiveSettings{},
+	}
+	taskFuncsMu.RLock()
+	tfs := make(map[string]TaskFunc, len(taskFuncs))
+	for k, v := range taskFuncs {
+		tfs[k] = v
+	}
+	taskFuncsMu.RUnlock()
+	for id, tf := range tfs {
+		cfg.Tasks = append(cfg.Tasks, getTaskEffectiveSettings(id, tf))
+	}
+	sort.Slice(cfg.Tasks, func(i, j int) bool {
+		return cfg.Tasks[i].ID < cfg.Tasks[j].ID
+	})
+	return cfg
+}
+
+// Get the settings currently in effect for a task.
+func getTaskEffectiveSettings(id string, tf TaskFunc) TaskEffectiveSettings {
+	s := TaskEffectiveSettings{
+		ID:                   id,
+		Name:                 getTaskDisplayName(id),
+		Origin:               tf.origin,
+		Pool:                 getTaskPool(id),
+		DefaultSeconds:       int(tf.dd.Seconds()),
+		Seconds:              int(getTaskInterval(id, tf.dd).Seconds()),
+		Overridden:           getTaskSchedule(id) != 0,
+		Priority:             getTaskPriority(id),
+		MissedRun:            getTaskMissedRunPolicy(id),
+		SLA:                  getTaskSLA(id),
+		DisableAfterFailures: getTaskDisableAfterFailures(id),
+		Nice:                 getTaskNice(id),
+		DeferDuringImport:    isTaskDeferredDuringImport(id),
+		Windows:              getTaskWindows(id),
+		ErrorLogWindow:       max(getTaskErrorLogWindow(id), 0),
+		Enabled:              !isTaskDisabled(id) && (tf.shouldRun == nil || tf.shouldRun()),
+		Inherited:            getTaskInheritedSettings(id),
+	}
+	if a, ok := getTaskAfter(id); ok {
+		s.After = &a
+	}
+	if _, ok := getTaskBoost(id); ok {
+		s.Boosted = true
+	} else if r, ok := getTaskRange(id); ok {
+		s.MaxSeconds = r.Max
+		s.Overridden = true
+	}
+	return s
+}
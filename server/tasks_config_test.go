@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTaskEffectiveConfig(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_INTERVAL_MULTIPLIER = 2
+	Config.TASK_CONCURRENCY = 3
+	Config.TASK_POOL_CONCURRENCY = map[string]int{string(TASK_POOL_HEAVY): 1}
+	Config.TASK_SCHEDULE = map[string]int{"test_config_overridden": 600}
+	Config.TASK_SCHEDULE_RANGE = map[string]TaskScheduleRange{"test_config_range": {Min: 60, Max: 120}}
+	Config.TASK_DISABLED = map[string]bool{"test_config_disabled": true}
+	Config.TASK_SLA = map[string]int{"test_config_overridden": 30}
+	Config.TASK_DEFAULTS = TaskDefaults{SLA: 90}
+	// Secrets that must never be included.
+	Config.TMDB_KEY = "secret-tmdb-key"
+	Config.TASK_TRIGGER_SECRET = "secret-trigger"
+	Config.RADARR = []RadarrSettings{{ArrSettings: ArrSettings{Name: "main", Host: "http://secret-host", Key: "secret-arr-key"}}}
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_config_default":    {name: "Test Config Default", f: func() error { return nil }, dd: time.Hour},
+		"test_config_overridden": {name: "Test Config Overridden", f: func() error { return nil }, dd: time.Hour},
+		"test_config_range":      {name: "Test Config Range", f: func() error { return nil }, dd: time.Hour},
+		"test_config_disabled":   {name: "Test Config Disabled", f: func() error { return nil }, dd: time.Hour, pool: TASK_POOL_HEAVY},
+	})
+	r, token := newTestTaskRouter(t, newTestDb(t))
+
+	w := doTestRequest(t, r, http.MethodGet, "/api/task/config", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200: %s", w.Code, w.Body)
+	}
+	for _, secret := range []string{"secret-tmdb-key", "secret-trigger", "secret-host", "secret-arr-key"} {
+		if strings.Contains(w.Body.String(), secret) {
+			t.Errorf("effective config includes secret %q", secret)
+		}
+	}
+	var cfg TaskEffectiveConfig
+	if err := json.Unmarshal(w.Body.Bytes(), &cfg); err != nil {
+		t.Fatalf("failed to decode config: %v", err)
+	}
+	if cfg.IntervalMultiplier != 2 || cfg.PoolConcurrency[TASK_POOL_LIGHT] != 3 || cfg.PoolConcurrency[TASK_POOL_HEAVY] != 1 {
+		t.Errorf("got multiplier %v and pools %v, want 2 with 3 light and 1 heavy", cfg.IntervalMultiplier, cfg.PoolConcurrency)
+	}
+	tasks := map[string]TaskEffectiveSettings{}
+	for _, v := range cfg.Tasks {
+		tasks[v.ID] = v
+	}
+	if len(tasks) != 4 {
+		t.Fatalf("got tasks %v, want 4", cfg.Tasks)
+	}
+	for id, want := range map[string]struct {
+		seconds, maxSeconds, sla int
+		overridden, enabled      bool
+		pool                     TaskPool
+	}{
+		"test_config_default":    {7200, 0, 90, false, true, TASK_POOL_LIGHT},
+		"test_config_overridden": {600, 0, 30, true, true, TASK_POOL_LIGHT},
+		"test_config_range":      {60, 120, 90, true, true, TASK_POOL_LIGHT},
+		"test_config_disabled":   {7200, 0, 90, false, false, TASK_POOL_HEAVY},
+	} {
+		s := tasks[id]
+		if s.DefaultSeconds != 3600 || s.Seconds != want.seconds || s.MaxSeconds != want.maxSeconds || s.SLA != want.sla ||
+			s.Overridden != want.overridden || s.Enabled != want.enabled || s.Pool != want.pool {
+			t.Errorf("got %s settings %+v, want %+v", id, s, want)
+		}
+	}
+}
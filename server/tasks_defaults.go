@@ -0,0 +1,118 @@
+package main
+
+import "log/slog"
+
+// Defaults for per task settings, used by every task that doesn't
+// set its own in the matching per task config (eg. TASK_PRIORITY).
+type TaskDefaults struct {
+	// Default for TASK_PRIORITY.
+	Priority int `json:",omitempty"`
+	// Default for TASK_SLA (seconds).
+	SLA int `json:",omitempty"`
+	// Default for TASK_MISSED_RUN.
+	MissedRun TaskMissedRunPolicy `json:",omitempty"`
+	// Default for TASK_NICE.
+	Nice int `json:",omitempty"`
+	// Default for TASK_DISABLE_AFTER_FAILURES.
+	DisableAfterFailures int `json:",omitempty"`
+	// Default for TASK_DEFER_DURING_IMPORT. If not set, maintenance
+	// tasks are deferred and the rest aren't.
+	DeferDuringImport *bool `json:",omitempty"`
+	// Default for TASK_ERROR_LOG_WINDOW (seconds).
+	ErrorLogWindow int `json:",omitempty"`
+}
+
+// A setting a task can inherit from TASK_DEFAULTS, by its json key
+// in TaskEffectiveSettings.
+type TaskSetting string
+
+var (
+	TASK_SETTING_PRIORITY               TaskSetting = "priority"
+	TASK_SETTING_SLA                    TaskSetting = "sla"
+	TASK_SETTING_MISSED_RUN             TaskSetting = "missedRun"
+	TASK_SETTING_NICE                   TaskSetting = "nice"
+	TASK_SETTING_DISABLE_AFTER_FAILURES TaskSetting = "disableAfterFailures"
+	TASK_SETTING_DEFER_DURING_IMPORT    TaskSetting = "deferDuringImport"
+	TASK_SETTING_ERROR_LOG_WINDOW       TaskSetting = "errorLogWindow"
+)
+
+// Warn about TASK_DEFAULTS that are out of range, so it is noticed at
+// startup, instead of once per run. They are still ignored per run.
+func validateTaskDefaults() {
+	d := Config.TASK_DEFAULTS
+	if d.MissedRun != "" && d.MissedRun != TASK_MISSED_RUN_SKIP && d.MissedRun != TASK_MISSED_RUN_CATCH_UP {
+		slog.Error("validateTaskDefaults: Invalid default missed run policy. Using skip.", "policy", d.MissedRun)
+	}
+	if d.Nice < 0 || d.Nice > taskNiceMax {
+		slog.Warn("validateTaskDefaults: Default nice value out of range, it is limited to 1-19.", "nice", d.Nice)
+	}
+	if d.SLA < 0 || d.DisableAfterFailures < 0 || d.ErrorLogWindow < 0 {
+		slog.Warn("validateTaskDefaults: Negative defaults are ignored.", "sla", d.SLA, "disable_after_failures", d.DisableAfterFailures, "error_log_window", d.ErrorLogWindow)
+	}
+}
+
+// Get a tasks priority, from TASK_PRIORITY or TASK_DEFAULTS.
+func getTaskPriority(id string) int {
+	taskConfigMu.RLock()
+	defer taskConfigMu.RUnlock()
+	if p, ok := Config.TASK_PRIORITY[id]; ok {
+		return p
+	}
+	return Config.TASK_DEFAULTS.Priority
+}
+
+// Get a tasks expected max duration (seconds), from TASK_SLA
+// or TASK_DEFAULTS. 0 if not set.
+func getTaskSLA(id string) int {
+	taskConfigMu.RLock()
+	defer taskConfigMu.RUnlock()
+	if s, ok := Config.TASK_SLA[id]; ok {
+		return s
+	}
+	return Config.TASK_DEFAULTS.SLA
+}
+
+// Get the failures in a row after which a task disables itself, from
+// TASK_DISABLE_AFTER_FAILURES or TASK_DEFAULTS. 0 if not set, or if
+// the task is never auto disabled (see `TaskFunc.noAutoDisable`).
+func getTaskDisableAfterFailures(id string) int {
+	if tf, ok := getTaskFunc(id); ok && tf.noAutoDisable {
+		return 0
+	}
+	taskConfigMu.RLock()
+	defer taskConfigMu.RUnlock()
+	if l, ok := Config.TASK_DISABLE_AFTER_FAILURES[id]; ok {
+		return l
+	}
+	return Config.TASK_DEFAULTS.DisableAfterFailures
+}
+
+// Get which settings of a task are inherited from TASK_DEFAULTS,
+// rather than set for the task itself. Settings not set in either
+// aren't included.
+func getTaskInheritedSettings(id string) []TaskSetting {
+	taskConfigMu.RLock()
+	defer taskConfigMu.RUnlock()
+	d := Config.TASK_DEFAULTS
+	inherited := []TaskSetting{}
+	add := func(setting TaskSetting, isDefaultSet bool, isTaskSet bool) {
+		if isDefaultSet && !isTaskSet {
+			inherited = append(inherited, setting)
+		}
+	}
+	_, ok := Config.TASK_PRIORITY[id]
+	add(TASK_SETTING_PRIORITY, d.Priority != 0, ok)
+	_, ok = Config.TASK_SLA[id]
+	add(TASK_SETTING_SLA, d.SLA != 0, ok)
+	_, ok = Config.TASK_MISSED_RUN[id]
+	add(TASK_SETTING_MISSED_RUN, d.MissedRun != "", ok)
+	_, ok = Config.TASK_NICE[id]
+	add(TASK_SETTING_NICE, d.Nice != 0, ok)
+	_, ok = Config.TASK_DISABLE_AFTER_FAILURES[id]
+	add(TASK_SETTING_DISABLE_AFTER_FAILURES, d.DisableAfterFailures != 0, ok)
+	_, ok = Config.TASK_DEFER_DURING_IMPORT[id]
+	add(TASK_SETTING_DEFER_DURING_IMPORT, d.DeferDuringImport != nil, ok)
+	_, ok = Config.TASK_ERROR_LOG_WINDOW[id]
+	add(TASK_SETTING_ERROR_LOG_WINDOW, d.ErrorLogWindow != 0, ok)
+	return inherited
+}
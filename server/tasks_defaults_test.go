@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTaskDefaultsInherited(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_DEFAULTS = TaskDefaults{Priority: 5, SLA: 120, MissedRun: TASK_MISSED_RUN_CATCH_UP}
+	Config.TASK_PRIORITY = map[string]int{"test_defaults_own": 1}
+	Config.TASK_MISSED_RUN = map[string]TaskMissedRunPolicy{"test_defaults_own": TASK_MISSED_RUN_SKIP}
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_defaults_inherit": {name: "Test Defaults Inherit", f: func() error { return nil }, dd: time.Hour},
+		"test_defaults_own":     {name: "Test Defaults Own", f: func() error { return nil }, dd: time.Hour},
+	})
+	r, token := newTestTaskRouter(t, newTestDb(t))
+
+	for id, want := range map[string]struct {
+		priority  int
+		missedRun TaskMissedRunPolicy
+		inherited []TaskSetting
+	}{
+		"test_defaults_inherit": {5, TASK_MISSED_RUN_CATCH_UP, []TaskSetting{TASK_SETTING_PRIORITY, TASK_SETTING_SLA, TASK_SETTING_MISSED_RUN}},
+		"test_defaults_own":     {1, TASK_MISSED_RUN_SKIP, []TaskSetting{TASK_SETTING_SLA}},
+	} {
+		w := doTestRequest(t, r, http.MethodGet, "/api/task/"+id, token, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got %d getting %s, want 200: %s", w.Code, id, w.Body)
+		}
+		var resp TaskDetailResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode %s: %v", id, err)
+		}
+		s := resp.Settings
+		if s.Priority != want.priority || s.MissedRun != want.missedRun || s.SLA != 120 {
+			t.Errorf("got %s priority %d, missed run %s and sla %d, want %d, %s and the default 120", id, s.Priority, s.MissedRun, s.SLA, want.priority, want.missedRun)
+		}
+		if !reflect.DeepEqual(s.Inherited, want.inherited) {
+			t.Errorf("got %s inheriting %v, want %v", id, s.Inherited, want.inherited)
+		}
+	}
+}
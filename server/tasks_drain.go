@@ -0,0 +1,110 @@
+package main
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Drain state of the task scheduler. While draining, no new task runs
+// start, but runs in progress are left to finish, so the server can be
+// shut down without cutting any off (eg. for rolling deploys).
+type TaskDrainStatus struct {
+	Draining bool `json:"draining"`
+	// Set while draining.
+	Since *time.Time `json:"since,omitempty"`
+	// If draining and no task runs are left in progress.
+	Drained bool `json:"drained"`
+	// Set once drained.
+	DrainedAt *time.Time `json:"drainedAt,omitempty"`
+	// Ids of tasks still running.
+	Running []string `json:"running"`
+}
+
+var (
+	taskDrainSince time.Time
+	taskDrainedAt  time.Time
+	taskDrainMu    sync.Mutex
+)
+
+// If new task runs are being held back.
+func isTaskDraining() bool {
+	taskDrainMu.Lock()
+	defer taskDrainMu.Unlock()
+	return !taskDrainSince.IsZero()
+}
+
+// Stop new task runs from starting, runs in progress carry on.
+// Draining again while already draining changes nothing.
+func drainTasks() TaskDrainStatus {
+	taskDrainMu.Lock()
+	if taskDrainSince.IsZero() {
+		taskDrainSince = taskClock.Now()
+		taskDrainedAt = time.Time{}
+		slog.Info("drainTasks: Draining tasks, no new runs will start.")
+	}
+	taskDrainMu.Unlock()
+	checkTaskDrained()
+	return getTaskDrainStatus()
+}
+
+// Stop draining, task runs start as usual again.
+func resumeTasks() TaskDrainStatus {
+	taskDrainMu.Lock()
+	if !taskDrainSince.IsZero() {
+		slog.Info("resumeTasks: No longer draining tasks.")
+	}
+	taskDrainSince = time.Time{}
+	taskDrainedAt = time.Time{}
+	taskDrainMu.Unlock()
+	return getTaskDrainStatus()
+}
+
+// Mark the scheduler drained if draining and nothing is running
+// anymore. Called when draining starts and each time a run finishes.
+func checkTaskDrained() {
+	if len(getRunningTaskIds()) > 0 {
+		return
+	}
+	taskDrainMu.Lock()
+	if taskDrainSince.IsZero() || !taskDrainedAt.IsZero() {
+		taskDrainMu.Unlock()
+		return
+	}
+	taskDrainedAt = taskClock.Now()
+	since := taskDrainSince
+	taskDrainMu.Unlock()
+	slog.Info("checkTaskDrained: Tasks drained, nothing is running.", "draining_for", taskSince(since))
+	publishTaskEvent(TaskEvent{Type: TASK_EVENT_DRAINED, Time: taskDrainedAt})
+}
+
+func getTaskDrainStatus() TaskDrainStatus {
+	running := getRunningTaskIds()
+	taskDrainMu.Lock()
+	defer taskDrainMu.Unlock()
+	s := TaskDrainStatus{Running: running}
+	if !taskDrainSince.IsZero() {
+		t := taskDrainSince
+		s.Draining = true
+		s.Since = &t
+	}
+	if !taskDrainedAt.IsZero() {
+		t := taskDrainedAt
+		s.Drained = true
+		s.DrainedAt = &t
+	}
+	return s
+}
+
+// Get ids of tasks with a run in progress, sorted.
+func getRunningTaskIds() []string {
+	runningTasksMu.Lock()
+	defer runningTasksMu.Unlock()
+	ids := make([]string, 0, len(runningTasks))
+	for id := range runningTasks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
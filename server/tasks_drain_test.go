@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDrainLetsRunningTaskFinish(t *testing.T) {
+	useTestConfig(t)
+	t.Cleanup(func() {
+		resumeTasks()
+	})
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	var otherRuns atomic.Int32
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_drain_long": {
+			name: "Test Drain Long",
+			f: func() error {
+				close(started)
+				<-unblock
+				return nil
+			},
+			dd: time.Hour,
+		},
+		"test_drain_other": {
+			name: "Test Drain Other",
+			f: func() error {
+				otherRuns.Add(1)
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+	r, token := newTestTaskRouter(t, newTestDb(t))
+	getDrain := func(method string) TaskDrainStatus {
+		t.Helper()
+		w := doTestRequest(t, r, method, "/api/task/drain", token, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got %d for %s drain, want 200: %s", w.Code, method, w.Body)
+		}
+		var s TaskDrainStatus
+		if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil {
+			t.Fatalf("failed to decode drain status: %v", err)
+		}
+		return s
+	}
+
+	done := make(chan TaskRunOutcome)
+	go func() {
+		done <- runTaskOutcome("test_drain_long")
+	}()
+	<-started
+	s := getDrain(http.MethodPost)
+	if !s.Draining || s.Drained || !reflect.DeepEqual(s.Running, []string{"test_drain_long"}) {
+		t.Fatalf("got %+v draining with a run in progress, want draining and not drained", s)
+	}
+	if out := runTaskOutcome("test_drain_other"); out.Result != TASK_RUN_SKIPPED || out.Reason != "draining" {
+		t.Errorf("run while draining was %s (%s), want skipped for draining", out.Result, out.Reason)
+	}
+	if n := otherRuns.Load(); n != 0 {
+		t.Fatalf("task ran %d times while draining, want none", n)
+	}
+
+	close(unblock)
+	if out := <-done; out.Result != TASK_RUN_SUCCESS {
+		t.Fatalf("run in progress when draining was %s (%s), want it to finish", out.Result, out.Reason)
+	}
+	if s := getDrain(http.MethodGet); !s.Drained || s.DrainedAt == nil || len(s.Running) != 0 {
+		t.Errorf("got %+v once the run finished, want drained", s)
+	}
+	if s := getDrain(http.MethodDelete); s.Draining || s.Drained {
+		t.Errorf("got %+v after resuming, want not draining", s)
+	}
+	if out := runTaskOutcome("test_drain_other"); out.Result != TASK_RUN_SUCCESS || otherRuns.Load() != 1 {
+		t.Errorf("run after resuming was %s (%s), want it to run", out.Result, out.Reason)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// What a task config change would do, without it being applied.
+type TaskConfigValidation struct {
+	// If the change would be accepted.
+	Valid bool `json:"valid"`
+	// Why it wouldn't be, empty if valid.
+	Errors []string `json:"errors"`
+	// Scheduler wide settings that would change.
+	Settings []TaskSettingChange `json:"settings"`
+	// Tasks whose interval or enabled state would change.
+	Tasks []TaskStateChange `json:"tasks"`
+}
+
+type TaskSettingChange struct {
+	Setting string `json:"setting"`
+	Old     any    `json:"old"`
+	New     any    `json:"new"`
+}
+
+type TaskStateChange struct {
+	ID            string `json:"id"`
+	OldSeconds    int    `json:"oldSeconds"`
+	NewSeconds    int    `json:"newSeconds"`
+	OldMaxSeconds int    `json:"oldMaxSeconds,omitempty"`
+	NewMaxSeconds int    `json:"newMaxSeconds,omitempty"`
+	OldEnabled    bool   `json:"oldEnabled"`
+	NewEnabled    bool   `json:"newEnabled"`
+}
+
+func newTaskConfigValidation(errs []error) TaskConfigValidation {
+	v := TaskConfigValidation{Valid: len(errs) == 0, Errors: []string{}, Settings: []TaskSettingChange{}, Tasks: []TaskStateChange{}}
+	for _, err := range errs {
+		v.Errors = append(v.Errors, err.Error())
+	}
+	return v
+}
+
+// Check a task settings update like `updateTaskSettings` would, returning
+// what it would change. Nothing is changed.
+func validateTaskSettingsUpdate(req TaskSettingsUpdateRequest) TaskConfigValidation {
+	v := newTaskConfigValidation(checkTaskSettingsUpdate(req))
+	cur := getTaskSettings()
+	diffInt := func(name string, old int, new *int) {
+		if new != nil && *new != old {
+			v.Settings = append(v.Settings, TaskSettingChange{Setting: name, Old: old, New: *new})
+		}
+	}
+	diffBool := func(name string, old bool, new *bool) {
+		if new != nil && *new != old {
+			v.Settings = append(v.Settings, TaskSettingChange{Setting: name, Old: old, New: *new})
+		}
+	}
+	diffInt("concurrency", cur.Concurrency, req.Concurrency)
+	if req.PoolConcurrency != nil && fmt.Sprint(req.PoolConcurrency) != fmt.Sprint(cur.PoolConcurrency) {
+		v.Settings = append(v.Settings, TaskSettingChange{Setting: "poolConcurrency", Old: cur.PoolConcurrency, New: req.PoolConcurrency})
+	}
+	if req.QuietHours != nil && *req.QuietHours != cur.QuietHours {
+		v.Settings = append(v.Settings, TaskSettingChange{Setting: "quietHours", Old: cur.QuietHours, New: *req.QuietHours})
+	}
+	diffInt("startupDelay", cur.StartupDelay, req.StartupDelay)
+	diffInt("breakerThreshold", cur.BreakerThreshold, req.BreakerThreshold)
+	diffInt("breakerCooldown", cur.BreakerCooldown, req.BreakerCooldown)
+	diffInt("cleanupImagesWorkers", cur.CleanupImagesWorkers, req.CleanupImagesWorkers)
+	diffBool("mergeDuplicates", cur.MergeDuplicates, req.MergeDuplicates)
+	diffBool("staleWatchingReminders", cur.StaleWatchingReminders, req.StaleWatchingReminders)
+	if req.StaleWatchingReminders != nil && *req.StaleWatchingReminders != cur.StaleWatchingReminders {
+		// Its feature task is added or removed along with it.
+		featureTasksMu.Lock()
+		ft, ok := featureTasks["stale_watching_reminders"]
+		featureTasksMu.Unlock()
+		if ok {
+			secs := int(getTaskInterval("stale_watching_reminders", ft.task.dd).Seconds())
+			v.Tasks = append(v.Tasks, TaskStateChange{
+				ID:         "stale_watching_reminders",
+				OldSeconds: secs,
+				NewSeconds: secs,
+				OldEnabled: cur.StaleWatchingReminders,
+				NewEnabled: *req.StaleWatchingReminders,
+			})
+		}
+	}
+	diffBool("telemetry", cur.Telemetry, req.Telemetry)
+	if req.Telemetry != nil && *req.Telemetry != cur.Telemetry {
+		featureTasksMu.Lock()
+		ft, ok := featureTasks[taskIdSendTelemetry]
+		featureTasksMu.Unlock()
+		if ok {
+			telemetryUrl, _ := getTelemetryUrl()
+			secs := int(getTaskInterval(taskIdSendTelemetry, ft.task.dd).Seconds())
+			v.Tasks = append(v.Tasks, TaskStateChange{
+				ID:         taskIdSendTelemetry,
+				OldSeconds: secs,
+				NewSeconds: secs,
+				OldEnabled: isTelemetryEnabled(),
+				// Still needs somewhere to send to.
+				NewEnabled: *req.Telemetry && telemetryUrl != "",
+			})
+		}
+	}
+	return v
+}
+
+// Check a reschedule like `rescheduleTask` would, returning how the
+// tasks interval and enabled state would change. Nothing is changed.
+func validateTaskReschedule(id string, req TaskRescheduleRequest) (TaskConfigValidation, error) {
+	j := getTask(id)
+	if j == nil {
+		return TaskConfigValidation{}, errors.New("no task found")
+	}
+	var errs []error
+	if err := checkTaskReschedule(req); err != nil {
+		errs = append(errs, err)
+	} else if tf, ok := getTaskFunc(id); ok {
+		if err := checkTaskMinInterval(id, tf, *req.Seconds); err != nil {
+			errs = append(errs, err)
+			// With why, so the user knows what interval would be accepted.
+			for _, c := range getTaskIntervalConstraints(id, tf) {
+				if *req.Seconds < c.Seconds {
+					errs = append(errs, errors.New(c.Reason))
+				}
+			}
+		}
+	}
+	v := newTaskConfigValidation(errs)
+	if !v.Valid {
+		return v, nil
+	}
+	cur := jobToTaskResponse(*j)
+	c := TaskStateChange{
+		ID:            id,
+		OldSeconds:    cur.Seconds,
+		NewSeconds:    cur.Seconds,
+		OldMaxSeconds: cur.MaxSeconds,
+		NewMaxSeconds: cur.MaxSeconds,
+		OldEnabled:    !cur.Disabled,
+		NewEnabled:    !cur.Disabled,
+	}
+	if *req.Seconds == 0 {
+		c.NewEnabled = false
+	} else {
+		c.NewSeconds = *req.Seconds
+		c.NewMaxSeconds = req.MaxSeconds
+		c.NewEnabled = true
+	}
+	if c.NewSeconds != c.OldSeconds || c.NewMaxSeconds != c.OldMaxSeconds || c.NewEnabled != c.OldEnabled {
+		v.Tasks = append(v.Tasks, c)
+	}
+	return v, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+type TaskEventType string
+
+var (
+	TASK_EVENT_STARTED  TaskEventType = "started"
+	TASK_EVENT_FINISHED TaskEventType = "finished"
+	TASK_EVENT_SKIPPED  TaskEventType = "skipped"
+	// An integration started failing, sent by Check Integrations.
+	TASK_EVENT_INTEGRATION_FAILED TaskEventType = "integration_failed"
+	// An integration stopped failing, sent by Check Integrations.
+	TASK_EVENT_INTEGRATION_RECOVERED TaskEventType = "integration_recovered"
+	// Tasks finished draining, nothing is running. Not for any one task.
+	TASK_EVENT_DRAINED TaskEventType = "drained"
+)
+
+// Event sent to subscribers as tasks run.
+type TaskEvent struct {
+	Type TaskEventType `json:"type"`
+	// ID of task this event is for.
+	Task string    `json:"task"`
+	Time time.Time `json:"time"`
+	// Set on finished events (empty if the run succeeded)
+	// and integration failed events.
+	Error string `json:"error,omitempty"`
+	// Only set on finished events.
+	DurationMs int64 `json:"durationMs,omitempty"`
+	// Set on skipped events (why the run was skipped)
+	// and integration events (the integration name).
+	Reason string `json:"reason,omitempty"`
+}
+
+// Events buffered per subscriber, before new ones are dropped.
+const taskEventBuffer = 32
+
+var (
+	taskEventSubs   = map[chan TaskEvent]struct{}{}
+	taskEventSubsMu sync.Mutex
+)
+
+// Subscribe to task events.
+// Call the returned func to unsubscribe once done.
+func subscribeTaskEvents() (chan TaskEvent, func()) {
+	ch := make(chan TaskEvent, taskEventBuffer)
+	taskEventSubsMu.Lock()
+	taskEventSubs[ch] = struct{}{}
+	taskEventSubsMu.Unlock()
+	return ch, func() {
+		taskEventSubsMu.Lock()
+		delete(taskEventSubs, ch)
+		taskEventSubsMu.Unlock()
+	}
+}
+
+// Send event to all subscribers.
+// Never blocks, if a subscriber is full (slow client) the event is dropped for them.
+func publishTaskEvent(e TaskEvent) {
+	taskEventSubsMu.Lock()
+	defer taskEventSubsMu.Unlock()
+	for ch := range taskEventSubs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Amount of task event subscribers.
+func countTestTaskEventSubs() int {
+	taskEventSubsMu.Lock()
+	defer taskEventSubsMu.Unlock()
+	return len(taskEventSubs)
+}
+
+func TestTaskEventsStream(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_events": {
+			name: "Test Events",
+			f: func() error {
+				return errors.New("failed")
+			},
+			dd: time.Hour,
+		},
+	})
+	r, token := newTestTaskRouter(t, newTestDb(t))
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	subs := countTestTaskEventSubs()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/task/events", nil)
+	req.Header.Set("Authorization", token)
+	// Headers aren't sent until the first event, so connect in the background.
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	connected := make(chan result, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		connected <- result{resp, err}
+	}()
+	waitFor(t, "stream to subscribe", func() bool {
+		return countTestTaskEventSubs() == subs+1
+	})
+
+	runTaskOutcome("test_events")
+	var res result
+	select {
+	case res = <-connected:
+	case <-time.After(time.Second):
+		t.Fatal("timed out connecting to stream")
+	}
+	if res.err != nil {
+		t.Fatalf("failed to connect to stream: %v", res.err)
+	}
+	resp := res.resp
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got %d connecting to stream, want 200", resp.StatusCode)
+	}
+	var events []TaskEvent
+	sc := bufio.NewScanner(resp.Body)
+	for len(events) < 2 && sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data:")
+		if !ok {
+			continue
+		}
+		var e TaskEvent
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			t.Fatalf("failed to decode event %q: %v", data, err)
+		}
+		if e.Task == "test_events" {
+			events = append(events, e)
+		}
+	}
+	if len(events) != 2 || events[0].Type != TASK_EVENT_STARTED || events[1].Type != TASK_EVENT_FINISHED {
+		t.Fatalf("got events %+v, want started then finished", events)
+	}
+	if events[1].Error != "failed" {
+		t.Errorf("finished event has error %q, want the runs error", events[1].Error)
+	}
+
+	resp.Body.Close()
+	waitFor(t, "stream to unsubscribe", func() bool {
+		return countTestTaskEventSubs() == subs
+	})
+}
+
+func TestPublishTaskEventDropsForFullSubscribers(t *testing.T) {
+	events, unsub := subscribeTaskEvents()
+	defer unsub()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < taskEventBuffer*2; i++ {
+			publishTaskEvent(TaskEvent{Type: TASK_EVENT_STARTED, Task: "test_full"})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publishing blocked on a subscriber that isn't reading")
+	}
+	if n := len(events); n != taskEventBuffer {
+		t.Errorf("subscriber has %d events buffered, want %d", n, taskEventBuffer)
+	}
+}
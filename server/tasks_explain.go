@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Where a tasks interval comes from.
+type TaskIntervalSource string
+
+var (
+	// Boost interval, while the task is boosted.
+	TASK_INTERVAL_BOOST TaskIntervalSource = "boost"
+	// TASK_SCHEDULE_RANGE, the task runs at a random interval.
+	TASK_INTERVAL_RANGE TaskIntervalSource = "range"
+	// TASK_SCHEDULE.
+	TASK_INTERVAL_SCHEDULE TaskIntervalSource = "schedule"
+	// Default interval, scaled by TASK_INTERVAL_MULTIPLIER.
+	TASK_INTERVAL_MULTIPLIED TaskIntervalSource = "multiplied"
+	TASK_INTERVAL_DEFAULT    TaskIntervalSource = "default"
+)
+
+// How a tasks next run time was worked out, for debugging schedules.
+type TaskNextRunExplanation struct {
+	ID      string    `json:"id"`
+	NextRun time.Time `json:"nextRun"`
+	// Time of the run the next one is counted from, zero if
+	// the task hasn't ran since it was scheduled.
+	LastRun time.Time          `json:"lastRun"`
+	Source  TaskIntervalSource `json:"source"`
+	// Interval in use, the minimum if the task runs at a random interval.
+	Seconds int `json:"seconds"`
+	// Set if the task runs at a random interval.
+	MaxSeconds int `json:"maxSeconds,omitempty"`
+	// For random intervals, how far past the minimum interval the next run
+	// was put. Only known once the task has ran since it was scheduled.
+	OffsetSeconds int `json:"offsetSeconds,omitempty"`
+	// If the task caught up on a run it missed when it was scheduled.
+	CaughtUp  bool                `json:"caughtUp"`
+	MissedRun TaskMissedRunPolicy `json:"missedRun"`
+	// If the next run falls in quiet hours, so will be skipped.
+	InQuietHours bool `json:"inQuietHours"`
+	// First run outside of quiet hours, if the next run is inside them.
+	// Only known for tasks with a fixed interval.
+	FirstRunAfterQuietHours *time.Time `json:"firstRunAfterQuietHours,omitempty"`
+	// If the next run falls outside of the tasks TASK_WINDOWS, so will be skipped.
+	OutsideWindows bool `json:"outsideWindows"`
+	// Each step, in plain english.
+	Explanation []string `json:"explanation"`
+}
+
+var (
+	// Tasks that caught up on a missed run when they were scheduled.
+	taskCaughtUp   = map[string]bool{}
+	taskCaughtUpMu sync.Mutex
+)
+
+// Record if a task caught up on a missed run when it was scheduled.
+func setTaskCaughtUp(id string, caughtUp bool) {
+	taskCaughtUpMu.Lock()
+	defer taskCaughtUpMu.Unlock()
+	if caughtUp {
+		taskCaughtUp[id] = true
+	} else {
+		delete(taskCaughtUp, id)
+	}
+}
+
+func getTaskCaughtUp(id string) bool {
+	taskCaughtUpMu.Lock()
+	defer taskCaughtUpMu.Unlock()
+	return taskCaughtUp[id]
+}
+
+// Max runs looked ahead for the first one outside of quiet hours.
+const taskQuietHoursLookahead = 10000
+
+// Explain how the next run of a (recurring) task was worked out.
+func explainTaskNextRun(id string) (TaskNextRunExplanation, error) {
+	j := getTask(id)
+	if j == nil {
+		return TaskNextRunExplanation{}, errors.New("no task found")
+	}
+	nextRun, err := (*j).NextRun()
+	if err != nil {
+		slog.Error("explainTaskNextRun: Failed to get next run time for a job.", "job_name", id, "error", err)
+		return TaskNextRunExplanation{}, errors.New("failed to get next run")
+	}
+	// Zero if it hasn't ran yet.
+	lastRun, _ := (*j).LastRun()
+	tf, _ := getTaskFunc(id)
+	e := TaskNextRunExplanation{
+		ID:        id,
+		NextRun:   nextRun,
+		LastRun:   lastRun,
+		CaughtUp:  getTaskCaughtUp(id),
+		MissedRun: getTaskMissedRunPolicy(id),
+	}
+	steps := []string{}
+
+	r, isRange := getTaskRange(id)
+	b, isBoosted := getTaskBoost(id)
+	switch {
+	case isBoosted:
+		e.Source = TASK_INTERVAL_BOOST
+		e.Seconds = b.Seconds
+		steps = append(steps, fmt.Sprintf("Boosted until %s, so it runs every %s instead of on its usual schedule.", b.Until.Format(time.RFC3339), secondsDuration(b.Seconds)))
+	case isRange:
+		e.Source = TASK_INTERVAL_RANGE
+		e.Seconds = r.Min
+		e.MaxSeconds = r.Max
+		steps = append(steps, fmt.Sprintf("Runs at a random interval between %s and %s (TASK_SCHEDULE_RANGE).", secondsDuration(r.Min), secondsDuration(r.Max)))
+	case getTaskSchedule(id) != 0:
+		e.Source = TASK_INTERVAL_SCHEDULE
+		e.Seconds = getTaskSchedule(id)
+		steps = append(steps, fmt.Sprintf("Runs every %s (TASK_SCHEDULE).", secondsDuration(e.Seconds)))
+	default:
+		e.Seconds = int(getTaskSeconds(id, tf.dd).Seconds())
+		if m := getTaskIntervalMultiplier(); m > 0 && m != 1 {
+			e.Source = TASK_INTERVAL_MULTIPLIED
+			steps = append(steps, fmt.Sprintf("Runs every %s, its default of %s multiplied by TASK_INTERVAL_MULTIPLIER (%g).", secondsDuration(e.Seconds), tf.dd, m))
+		} else {
+			e.Source = TASK_INTERVAL_DEFAULT
+			steps = append(steps, fmt.Sprintf("Runs every %s, its default interval.", secondsDuration(e.Seconds)))
+		}
+	}
+
+	if e.CaughtUp {
+		steps = append(steps, "Missed a run while the server was down, so it ran as soon as it was scheduled, rather than waiting for its interval (TASK_MISSED_RUN is catch-up).")
+	} else if e.MissedRun == TASK_MISSED_RUN_SKIP {
+		steps = append(steps, "Runs missed while the server was down are skipped (TASK_MISSED_RUN is skip).")
+	}
+	if lastRun.IsZero() {
+		steps = append(steps, "Hasn't ran since it was scheduled, so its next run is one interval after it was scheduled.")
+		if d := getTaskStartupDelay(); d > 0 {
+			steps = append(steps, fmt.Sprintf("The scheduler started %s after the server (TASK_STARTUP_DELAY), so first runs are that much later.", secondsDuration(int(d.Seconds()))))
+		}
+	} else {
+		steps = append(steps, fmt.Sprintf("Last ran at %s, its next run is counted from then.", lastRun.Format(time.RFC3339)))
+		if isRange && !isBoosted {
+			e.OffsetSeconds = max(int(nextRun.Sub(lastRun).Seconds())-r.Min, 0)
+			steps = append(steps, fmt.Sprintf("A random offset of %s past the minimum interval was picked for the next run.", secondsDuration(e.OffsetSeconds)))
+		}
+	}
+	steps = append(steps, fmt.Sprintf("Next run is at %s.", nextRun.Format(time.RFC3339)))
+
+	if inTaskQuietHours(nextRun) {
+		e.InQuietHours = true
+		q := getTaskQuietHours()
+		if e.Source == TASK_INTERVAL_RANGE || e.Seconds <= 0 {
+			steps = append(steps, fmt.Sprintf("Next run falls in quiet hours (%s-%s), so it will be skipped.", q.Start, q.End))
+		} else {
+			t := nextRun
+			interval := time.Duration(e.Seconds) * time.Second
+			for i := 0; i < taskQuietHoursLookahead && inTaskQuietHours(t); i++ {
+				t = t.Add(interval)
+			}
+			if inTaskQuietHours(t) {
+				steps = append(steps, fmt.Sprintf("Next run falls in quiet hours (%s-%s), so it will be skipped.", q.Start, q.End))
+			} else {
+				e.FirstRunAfterQuietHours = &t
+				steps = append(steps, fmt.Sprintf("Next run falls in quiet hours (%s-%s), so it will be skipped. The first run outside of them is at %s.", q.Start, q.End, t.Format(time.RFC3339)))
+			}
+		}
+	}
+	if !inTaskWindow(id, nextRun) {
+		e.OutsideWindows = true
+		steps = append(steps, "Next run falls outside of the windows the task is allowed to run in (TASK_WINDOWS), so it will be skipped.")
+	}
+	if a, ok := getTaskAfter(id); ok {
+		steps = append(steps, fmt.Sprintf("Runs %s after %s succeeds (TASK_AFTER), so its scheduled runs are skipped.", secondsDuration(a.Delay), a.Task))
+	}
+	if isTaskDisabled(id) {
+		steps = append(steps, "The task is disabled, so its runs are skipped until it is enabled again.")
+	} else if tf.shouldRun != nil && !tf.shouldRun() {
+		steps = append(steps, "The task has nothing to do right now (eg. what it uses isn't configured), so its runs are skipped.")
+	}
+	e.Explanation = steps
+	return e, nil
+}
+
+// Seconds as a duration, for explanations.
+func secondsDuration(s int) time.Duration {
+	return time.Duration(s) * time.Second
+}
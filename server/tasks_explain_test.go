@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExplainTaskNextRunRandomOffset(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_SCHEDULE_RANGE = map[string]TaskScheduleRange{"test_explain": {Min: 1, Max: 3}}
+	var runs atomic.Int32
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_explain": {
+			name: "Test Explain",
+			f: func() error {
+				runs.Add(1)
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+	r, token := newTestTaskRouter(t, newTestDb(t))
+	get := func() TaskNextRunExplanation {
+		t.Helper()
+		w := doTestRequest(t, r, http.MethodGet, "/api/task/test_explain/next-run", token, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got %d explaining next run, want 200: %s", w.Code, w.Body)
+		}
+		var e TaskNextRunExplanation
+		if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+			t.Fatalf("failed to decode explanation: %v", err)
+		}
+		return e
+	}
+	taskScheduler.Start()
+	if e := get(); e.Source != TASK_INTERVAL_RANGE || e.Seconds != 1 || e.MaxSeconds != 3 || e.OffsetSeconds != 0 {
+		t.Errorf("got explanation %+v before running, want a 1-3s range with no offset known", e)
+	}
+
+	// First run is within the range max.
+	time.Sleep(3 * time.Second)
+	waitFor(t, "first run", func() bool {
+		return runs.Load() > 0
+	})
+	var (
+		e   TaskNextRunExplanation
+		gap time.Duration
+	)
+	waitFor(t, "last run to be recorded", func() bool {
+		e = get()
+		gap = e.NextRun.Sub(e.LastRun)
+		return !e.LastRun.IsZero() && gap > 0
+	})
+	if gap < time.Second || gap > 3*time.Second {
+		t.Fatalf("next run is %s after the last, want within the 1-3s range", gap)
+	}
+	want := int(gap.Seconds()) - 1
+	if e.OffsetSeconds != want {
+		t.Errorf("got offset %ds for a next run %s after the last, want %ds", e.OffsetSeconds, gap, want)
+	}
+	step := fmt.Sprintf("A random offset of %s past the minimum interval was picked for the next run.", secondsDuration(want))
+	if !slices.Contains(e.Explanation, step) {
+		t.Errorf("explanation %q is missing the applied offset %q", e.Explanation, step)
+	}
+}
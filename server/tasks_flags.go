@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Flag stored in the db that turns an experimental task on/off, so it
+// can be toggled from the admin ui without a config change or restart.
+// Flags are named by the id of the task they toggle.
+type TaskFlag struct {
+	Name      string    `gorm:"primaryKey" json:"name"`
+	Enabled   bool      `gorm:"not null" json:"enabled"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// State of a task flag, as returned by the api.
+type TaskFlagState struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	// Used while the flag hasn't been set.
+	Default bool `json:"default"`
+	// If the flag has been set, otherwise it is at its default.
+	Set bool `json:"set"`
+	// If the task is currently registered.
+	Registered bool `json:"registered"`
+}
+
+type TaskFlagUpdateRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// Experimental tasks, by id, and if they are enabled when their flag isn't set.
+// These are registered as feature tasks, so toggling their flag
+// registers/deregisters them (see `syncFeatureTasks`).
+// Existing ones default to on, so they keep running until turned off.
+var taskFlagDefaults = map[string]bool{
+	"sync_collections":        true,
+	"compute_recommendations": true,
+}
+
+var (
+	// Flags that have been set, loaded from the db in `setupTasks`.
+	taskFlags   = map[string]bool{}
+	taskFlagsMu sync.Mutex
+)
+
+// Load all set task flags from the db.
+// Flags for tasks that no longer exist are ignored.
+func loadTaskFlags(db *gorm.DB) {
+	var flags []TaskFlag
+	if res := db.Find(&flags); res.Error != nil {
+		// Flags stay at their defaults.
+		slog.Error("loadTaskFlags: Failed to get task flags!", "error", res.Error)
+		return
+	}
+	taskFlagsMu.Lock()
+	defer taskFlagsMu.Unlock()
+	taskFlags = map[string]bool{}
+	for _, f := range flags {
+		if _, ok := taskFlagDefaults[f.Name]; ok {
+			taskFlags[f.Name] = f.Enabled
+		}
+	}
+}
+
+// Get if a task flag is enabled, falling back to its default if not set.
+func isTaskFlagEnabled(name string) bool {
+	taskFlagsMu.Lock()
+	defer taskFlagsMu.Unlock()
+	if e, ok := taskFlags[name]; ok {
+		return e
+	}
+	return taskFlagDefaults[name]
+}
+
+// Get the state of a task flag, false if there is no flag by this name.
+func getTaskFlag(name string) (TaskFlagState, bool) {
+	def, ok := taskFlagDefaults[name]
+	if !ok {
+		return TaskFlagState{}, false
+	}
+	taskFlagsMu.Lock()
+	e, set := taskFlags[name]
+	taskFlagsMu.Unlock()
+	if !set {
+		e = def
+	}
+	_, registered := getTaskFunc(name)
+	return TaskFlagState{Name: name, Enabled: e, Default: def, Set: set, Registered: registered}, true
+}
+
+// Get the state of all task flags, sorted by name.
+func getTaskFlags() []TaskFlagState {
+	flags := []TaskFlagState{}
+	for name := range taskFlagDefaults {
+		if f, ok := getTaskFlag(name); ok {
+			flags = append(flags, f)
+		}
+	}
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Name < flags[j].Name
+	})
+	return flags
+}
+
+// Set a task flag and register/deregister its task to match.
+func setTaskFlag(db *gorm.DB, name string, enabled bool) (TaskFlagState, error) {
+	if _, ok := taskFlagDefaults[name]; !ok {
+		return TaskFlagState{}, errors.New("no flag found")
+	}
+	res := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"enabled", "updated_at"}),
+	}).Create(&TaskFlag{Name: name, Enabled: enabled})
+	if res.Error != nil {
+		slog.Error("setTaskFlag: Failed to save task flag!", "flag", name, "error", res.Error)
+		return TaskFlagState{}, errors.New("failed to save flag")
+	}
+	taskFlagsMu.Lock()
+	taskFlags[name] = enabled
+	taskFlagsMu.Unlock()
+	slog.Info("setTaskFlag: Task flag set.", "flag", name, "enabled", enabled)
+	syncFeatureTasks()
+	f, _ := getTaskFlag(name)
+	return f, nil
+}
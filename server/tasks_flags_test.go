@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// Clear set task flags until the test ends.
+func useTestTaskFlags(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		taskFlagsMu.Lock()
+		taskFlags = map[string]bool{}
+		taskFlagsMu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestTaskFlagTogglesRegistration(t *testing.T) {
+	useTestConfig(t)
+	useTestTaskFlags(t)
+	useTestScheduler(t, map[string]TaskFunc{})
+	db := newTestDb(t)
+	_, features := getTaskDefinitions(db, db)
+	useTestFeatureTasks(t, map[string]FeatureTask{"sync_collections": features["sync_collections"]})
+	r, token := newTestTaskRouter(t, db)
+	syncFeatureTasks()
+	if _, ok := getTaskFunc("sync_collections"); !ok {
+		t.Fatal("flagged task isn't registered while its flag is at its default")
+	}
+
+	set := func(enabled bool) TaskFlagState {
+		t.Helper()
+		w := doTestRequest(t, r, http.MethodPut, "/api/task/flags/sync_collections", token, map[string]bool{"enabled": enabled})
+		if w.Code != http.StatusOK {
+			t.Fatalf("got %d setting flag to %v, want 200: %s", w.Code, enabled, w.Body)
+		}
+		var f TaskFlagState
+		if err := json.Unmarshal(w.Body.Bytes(), &f); err != nil {
+			t.Fatalf("failed to decode flag: %v", err)
+		}
+		return f
+	}
+	if f := set(false); f.Enabled || !f.Set || f.Registered {
+		t.Errorf("got flag %+v after turning it off, want it set off and the task deregistered", f)
+	}
+	if getTask("sync_collections") != nil {
+		t.Error("task is still scheduled after turning its flag off")
+	}
+	// Loaded back from the db, eg. after a restart.
+	useTestTaskFlags(t)
+	loadTaskFlags(db)
+	if isTaskFlagEnabled("sync_collections") {
+		t.Error("flag turned off wasn't loaded from the db")
+	}
+
+	if f := set(true); !f.Enabled || !f.Registered {
+		t.Errorf("got flag %+v after turning it on, want the task registered", f)
+	}
+	w := doTestRequest(t, r, http.MethodGet, "/api/task/sync_collections", token, nil)
+	var d TaskDetailResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &d); err != nil {
+		t.Fatalf("failed to decode detail: %v", err)
+	}
+	if d.Flag == nil || !d.Flag.Enabled {
+		t.Errorf("task detail has flag %+v, want it enabled", d.Flag)
+	}
+	if w := doTestRequest(t, r, http.MethodPut, "/api/task/flags/test_missing", token, map[string]bool{"enabled": true}); w.Code != http.StatusNotFound {
+		t.Errorf("got %d setting a flag that doesn't exist, want 404", w.Code)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import "math"
+
+// How much each part counts towards the health score, adding up to 100.
+const (
+	// Share of runs since startup that succeeded.
+	taskHealthSuccessWeight = 60
+	// Lost in steps as failures in a row build up, all of it
+	// once taskHealthStreakMax runs in a row have failed.
+	taskHealthStreakWeight = 25
+	// Share of runs that finished within the tasks TASK_SLA.
+	// Given in full to tasks without an SLA.
+	taskHealthSLAWeight = 15
+	taskHealthStreakMax = 5
+)
+
+// Work out a tasks health, from 0 (broken) to 100 (healthy), from its
+// run stats since startup. Tasks that haven't ran yet are healthy,
+// there is nothing against them.
+func getTaskHealth(ts TaskStatus, hasSLA bool) int {
+	if ts.Runs <= 0 {
+		return 100
+	}
+	runs := float64(ts.Runs)
+	success := float64(ts.Runs-ts.Failures) / runs
+	streak := 1 - float64(min(ts.ConsecutiveFailures, taskHealthStreakMax))/taskHealthStreakMax
+	sla := 1.0
+	if hasSLA {
+		sla = float64(ts.Runs-ts.SlowRuns) / runs
+	}
+	score := success*taskHealthSuccessWeight + streak*taskHealthStreakWeight + sla*taskHealthSLAWeight
+	return int(math.Round(max(min(score, 100), 0)))
+}
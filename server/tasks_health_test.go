@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Bucket a health score, as the ui colors it.
+func getTestHealthBucket(health int) string {
+	switch {
+	case health >= 80:
+		return "healthy"
+	case health >= 50:
+		return "degraded"
+	default:
+		return "failing"
+	}
+}
+
+func TestTaskHealthFromRuns(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_SLA = map[string]int{"test_health_slow": 1}
+	// Runs of each task, oldest first: s succeeded, f failed,
+	// l succeeded but took longer than its SLA.
+	patterns := map[string]struct {
+		runs   string
+		health int
+		bucket string
+	}{
+		"test_health_new":       {"", 100, "healthy"},
+		"test_health_ok":        {"ssssssssss", 100, "healthy"},
+		"test_health_recovered": {"sffsssssss", 88, "healthy"},
+		"test_health_streak":    {"sssssssfff", 67, "degraded"},
+		"test_health_slow":      {"llllsss", 91, "healthy"},
+		"test_health_broken":    {"sffffffff", 22, "failing"},
+	}
+	tfs := map[string]TaskFunc{}
+	for id := range patterns {
+		tfs[id] = TaskFunc{name: id, f: func() error { return nil }, dd: time.Hour}
+	}
+	useTestScheduler(t, tfs)
+	for id, p := range patterns {
+		resetTaskStatus(id)
+		t.Cleanup(func() {
+			resetTaskStatus(id)
+		})
+		for _, r := range p.runs {
+			var (
+				dur time.Duration
+				err error
+			)
+			switch r {
+			case 'f':
+				err = errors.New("run failed")
+			case 'l':
+				dur = 2 * time.Second
+			}
+			recordTaskRun(id, time.Now(), dur, err)
+		}
+	}
+	r, token := newTestTaskRouter(t, newTestDb(t))
+
+	w := doTestRequest(t, r, http.MethodGet, "/api/task/", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d listing tasks, want 200: %s", w.Code, w.Body)
+	}
+	var tasks []AllTasksResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &tasks); err != nil {
+		t.Fatalf("failed to decode tasks: %v", err)
+	}
+	if len(tasks) != len(patterns) {
+		t.Fatalf("got %d tasks, want %d", len(tasks), len(patterns))
+	}
+	for _, v := range tasks {
+		p := patterns[v.ID]
+		if v.Health != p.health || getTestHealthBucket(v.Health) != p.bucket {
+			t.Errorf("%s with runs %q has health %d (%s), want %d (%s)", v.ID, p.runs, v.Health, getTestHealthBucket(v.Health), p.health, p.bucket)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type TaskRunResult string
+
+var (
+	TASK_RUN_SUCCESS TaskRunResult = "SUCCESS"
+	TASK_RUN_FAILED  TaskRunResult = "FAILED"
+	// Only returned from runs (eg. in a maintenance report), never saved to history.
+	TASK_RUN_SKIPPED   TaskRunResult = "SKIPPED"
+	TASK_RUN_CANCELLED TaskRunResult = "CANCELLED"
+)
+
+// A single run of a task, persisted so run history survives restarts.
+type TaskRun struct {
+	ID         uint          `gorm:"primarykey" json:"id"`
+	TaskID     string        `gorm:"index:idx_task_runs_task_started;not null" json:"taskId"`
+	StartedAt  time.Time     `gorm:"index:idx_task_runs_task_started;index;not null" json:"startedAt"`
+	DurationMs int64         `json:"durationMs"`
+	Result     TaskRunResult `gorm:"not null" json:"result"`
+	// Empty if the run succeeded.
+	Error string `json:"error,omitempty"`
+	// Numeric figures from the summary the run reported
+	// (see `setTaskSummary`), empty if it didn't report one.
+	Summary map[string]float64 `gorm:"serializer:json" json:"summary,omitempty"`
+}
+
+// Filters for querying task run history.
+type TaskRunQuery struct {
+	// Only runs of this task, all tasks if empty.
+	TaskID string
+	// Only runs started at or after this, if set.
+	From time.Time
+	// Only runs started before this, if set.
+	To time.Time
+}
+
+// How long task runs are kept for.
+const taskRunsKeepFor = 30 * 24 * time.Hour
+
+// Max runs returned by `getTaskRuns`.
+const taskRunsMaxLimit = 1000
+
+// Db task runs are saved to, set when tasks are setup.
+var taskDb *gorm.DB
+
+// Save a task run to history, removing runs of the task that are too old.
+func saveTaskRun(id string, start time.Time, dur time.Duration, err error) {
+	if taskDb == nil {
+		return
+	}
+	tr := TaskRun{
+		TaskID:     id,
+		StartedAt:  start,
+		DurationMs: dur.Milliseconds(),
+		Result:     TASK_RUN_SUCCESS,
+		Summary:    getTaskRunSummaryCounts(id, start),
+	}
+	if err != nil {
+		tr.Result = TASK_RUN_FAILED
+		tr.Error = err.Error()
+	}
+	if res := taskDb.Create(&tr); res.Error != nil {
+		slog.Error("saveTaskRun: Failed to save task run.", "job_name", id, "error", res.Error)
+		return
+	}
+	if res := taskDb.Where("task_id = ? AND started_at < ?", id, taskClock.Now().Add(-taskRunsKeepFor)).Delete(&TaskRun{}); res.Error != nil {
+		slog.Error("saveTaskRun: Failed to remove old task runs.", "job_name", id, "error", res.Error)
+	}
+	evictTaskRuns()
+}
+
+// Numeric figures of the summary a task reported during its run that
+// started at `start`, nil if it didn't report one.
+func getTaskRunSummaryCounts(id string, start time.Time) map[string]float64 {
+	ts := getTaskStatus(id)
+	if ts.SummaryAt == nil || ts.SummaryAt.Before(start) {
+		return nil
+	}
+	counts := map[string]float64{}
+	for k, v := range ts.Summary {
+		switch n := v.(type) {
+		case int:
+			counts[k] = float64(n)
+		case int32:
+			counts[k] = float64(n)
+		case int64:
+			counts[k] = float64(n)
+		case uint:
+			counts[k] = float64(n)
+		case uint64:
+			counts[k] = float64(n)
+		case float64:
+			counts[k] = n
+		}
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+	return counts
+}
+
+var (
+	// Runs evicted from history by TASK_HISTORY_MAX_RUNS since startup, by task id.
+	taskRunsEvicted   = map[string]int64{}
+	taskRunsEvictedMu sync.Mutex
+)
+
+// Remove the oldest runs (of any task) from history, until there are no
+// more than TASK_HISTORY_MAX_RUNS. Runs are never read back in a way that
+// would make them "recently used", so oldest started is least recently used.
+// Done in one statement, so nothing is counted after every run.
+func evictTaskRuns() {
+	taskConfigMu.RLock()
+	limit := Config.TASK_HISTORY_MAX_RUNS
+	taskConfigMu.RUnlock()
+	if limit <= 0 {
+		return
+	}
+	var evicted []string
+	res := taskDb.Raw(`DELETE FROM task_runs
+WHERE id NOT IN (SELECT id FROM task_runs ORDER BY started_at DESC, id DESC LIMIT ?)
+RETURNING task_id`, limit).Scan(&evicted)
+	if res.Error != nil {
+		slog.Error("evictTaskRuns: Failed to remove oldest task runs.", "error", res.Error)
+		return
+	}
+	if len(evicted) == 0 {
+		return
+	}
+	taskRunsEvictedMu.Lock()
+	for _, v := range evicted {
+		taskRunsEvicted[v]++
+	}
+	taskRunsEvictedMu.Unlock()
+	slog.Debug("evictTaskRuns: Evicted oldest task runs, history is over its limit.", "evicted", len(evicted), "limit", limit)
+}
+
+// Runs of a task evicted from history since startup, see `evictTaskRuns`.
+func getTaskRunsEvicted(id string) int64 {
+	taskRunsEvictedMu.Lock()
+	defer taskRunsEvictedMu.Unlock()
+	return taskRunsEvicted[id]
+}
+
+// Parse a task run query from request query params.
+// `from` and `to` must be RFC3339 times.
+func parseTaskRunQuery(task string, from string, to string) (TaskRunQuery, error) {
+	q := TaskRunQuery{TaskID: task}
+	if from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return TaskRunQuery{}, errors.New("query parameter 'from' is not a valid time")
+		}
+		q.From = t
+	}
+	if to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return TaskRunQuery{}, errors.New("query parameter 'to' is not a valid time")
+		}
+		q.To = t
+	}
+	return q, nil
+}
+
+func (q TaskRunQuery) apply(db *gorm.DB) *gorm.DB {
+	db = db.Model(&TaskRun{})
+	if q.TaskID != "" {
+		db = db.Where("task_id = ?", q.TaskID)
+	}
+	if !q.From.IsZero() {
+		db = db.Where("started_at >= ?", q.From)
+	}
+	if !q.To.IsZero() {
+		db = db.Where("started_at < ?", q.To)
+	}
+	return db
+}
+
+// Get task runs matching `q`, newest first.
+// Returns up to `limit` runs (capped at `taskRunsMaxLimit`).
+func getTaskRuns(db *gorm.DB, q TaskRunQuery, limit int) ([]TaskRun, error) {
+	if limit <= 0 || limit > taskRunsMaxLimit {
+		limit = taskRunsMaxLimit
+	}
+	runs := []TaskRun{}
+	if res := q.apply(db).Order("started_at DESC").Limit(limit).Find(&runs); res.Error != nil {
+		slog.Error("getTaskRuns: Failed to get task runs.", "error", res.Error)
+		return []TaskRun{}, errors.New("failed to get task runs")
+	}
+	return runs, nil
+}
+
+// Write task runs matching `q` to `w` as csv, oldest first.
+// Rows are streamed from the db, so large histories aren't held in memory.
+func writeTaskRunsCSV(db *gorm.DB, q TaskRunQuery, w io.Writer) error {
+	rows, err := q.apply(db).Order("started_at ASC").Rows()
+	if err != nil {
+		slog.Error("writeTaskRunsCSV: Failed to query task runs.", "error", err)
+		return errors.New("failed to get task runs")
+	}
+	defer rows.Close()
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"task", "started_at", "result", "duration_ms", "summary", "error"}); err != nil {
+		return err
+	}
+	for rows.Next() {
+		var tr TaskRun
+		if err := db.ScanRows(rows, &tr); err != nil {
+			slog.Error("writeTaskRunsCSV: Failed to scan task run.", "error", err)
+			return errors.New("failed to read task runs")
+		}
+		err := cw.Write([]string{
+			tr.TaskID,
+			tr.StartedAt.Format(time.RFC3339),
+			string(tr.Result),
+			strconv.FormatInt(tr.DurationMs, 10),
+			formatTaskRunSummary(tr.Summary),
+			tr.Error,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+// Format summary counts for a csv cell, as `key=value` pairs
+// sorted by key, eg. `failed=0; removed=3`.
+func formatTaskRunSummary(counts map[string]float64) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + strconv.FormatFloat(counts[k], 'f', -1, 64)
+	}
+	return strings.Join(pairs, "; ")
+}
+
+type TaskRanSinceResponse struct {
+	// If the task has started a run since the time asked about.
+	Ran bool `json:"ran"`
+	// When the task last started running, zero if it never has.
+	LastRun time.Time `json:"lastRun"`
+}
+
+// Check if a task has started a run since `since`, and when it last ran.
+// Uses the tasks in memory status, falling back to run history
+// for runs from before the server started.
+func taskRanSince(id string, since time.Time) (bool, time.Time, error) {
+	if _, ok := getTaskFunc(id); !ok {
+		return false, time.Time{}, errors.New("no task found")
+	}
+	last := getTaskStatus(id).LastRun
+	if last.IsZero() && taskDb != nil {
+		var tr TaskRun
+		res := taskDb.Where("task_id = ?", id).Order("started_at DESC").Limit(1).Find(&tr)
+		if res.Error != nil {
+			slog.Error("taskRanSince: Failed to get last run of task.", "job_name", id, "error", res.Error)
+			return false, time.Time{}, errors.New("failed to get last run")
+		}
+		last = tr.StartedAt
+	}
+	if last.IsZero() {
+		return false, time.Time{}, nil
+	}
+	return !last.Before(since), last, nil
+}
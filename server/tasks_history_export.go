@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Version of the task history export format.
+const taskHistoryExportVersion = 1
+
+// Task run history for moving to another server, see `importTaskHistory`.
+type TaskHistoryExport struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exportedAt"`
+	// Runs, oldest first.
+	Runs []TaskRun `json:"runs"`
+	// Stats of the exported runs, to check against after importing.
+	Stats []TaskRunStats `json:"stats"`
+}
+
+// Aggregate stats of the runs of a task in history.
+type TaskRunStats struct {
+	TaskID          string    `json:"taskId"`
+	Runs            int64     `json:"runs"`
+	Failures        int64     `json:"failures"`
+	TotalDurationMs int64     `json:"totalDurationMs"`
+	FirstRun        time.Time `json:"firstRun"`
+	LastRun         time.Time `json:"lastRun"`
+}
+
+type TaskHistoryImportResult struct {
+	Imported int `json:"imported"`
+	// Runs already in history (same task, started in the same second).
+	Duplicates int `json:"duplicates"`
+	// Runs older than history is kept for, they would be removed anyway.
+	Expired int `json:"expired"`
+	// Stats of all runs in history after the import.
+	Stats []TaskRunStats `json:"stats"`
+}
+
+// Get stats of task runs matching `q`, by task.
+func getTaskRunStats(db *gorm.DB, q TaskRunQuery) ([]TaskRunStats, error) {
+	var rows []struct {
+		TaskID          string
+		Runs            int64
+		Failures        int64
+		TotalDurationMs int64
+	}
+	res := q.apply(db).
+		Select("task_id, COUNT(*) AS runs, SUM(CASE WHEN result = ? THEN 1 ELSE 0 END) AS failures, COALESCE(SUM(duration_ms), 0) AS total_duration_ms", TASK_RUN_FAILED).
+		Group("task_id").
+		Order("task_id").
+		Scan(&rows)
+	if res.Error != nil {
+		slog.Error("getTaskRunStats: Failed to get task run stats.", "error", res.Error)
+		return []TaskRunStats{}, errors.New("failed to get task run stats")
+	}
+	stats := make([]TaskRunStats, 0, len(rows))
+	for _, r := range rows {
+		s := TaskRunStats{TaskID: r.TaskID, Runs: r.Runs, Failures: r.Failures, TotalDurationMs: r.TotalDurationMs}
+		// Read separately, sqlite returns MIN/MAX of times as text.
+		var first, last TaskRun
+		rq := TaskRunQuery{TaskID: r.TaskID, From: q.From, To: q.To}
+		if res := rq.apply(db).Order("started_at ASC").Limit(1).Find(&first); res.Error != nil {
+			slog.Error("getTaskRunStats: Failed to get first task run.", "job_name", r.TaskID, "error", res.Error)
+			return []TaskRunStats{}, errors.New("failed to get task run stats")
+		}
+		if res := rq.apply(db).Order("started_at DESC").Limit(1).Find(&last); res.Error != nil {
+			slog.Error("getTaskRunStats: Failed to get last task run.", "job_name", r.TaskID, "error", res.Error)
+			return []TaskRunStats{}, errors.New("failed to get task run stats")
+		}
+		s.FirstRun = first.StartedAt
+		s.LastRun = last.StartedAt
+		stats = append(stats, s)
+	}
+	return stats, nil
+}
+
+// Export task runs matching `q`, with their stats.
+func exportTaskHistory(db *gorm.DB, q TaskRunQuery) (TaskHistoryExport, error) {
+	runs := []TaskRun{}
+	if res := q.apply(db).Order("started_at ASC").Find(&runs); res.Error != nil {
+		slog.Error("exportTaskHistory: Failed to get task runs.", "error", res.Error)
+		return TaskHistoryExport{}, errors.New("failed to get task runs")
+	}
+	stats, err := getTaskRunStats(db, q)
+	if err != nil {
+		return TaskHistoryExport{}, err
+	}
+	return TaskHistoryExport{
+		Version:    taskHistoryExportVersion,
+		ExportedAt: time.Now(),
+		Runs:       runs,
+		Stats:      stats,
+	}, nil
+}
+
+// Read task runs from csv written by `writeTaskRunsCSV`.
+func readTaskRunsCSV(r io.Reader) ([]TaskRun, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.New("csv has no header")
+	}
+	// Exports from before runs had summaries have no summary column.
+	hasSummary := slices.Equal(header, []string{"task", "started_at", "result", "duration_ms", "summary", "error"})
+	if !hasSummary && !slices.Equal(header, []string{"task", "started_at", "result", "duration_ms", "error"}) {
+		return nil, errors.New("csv header is not task,started_at,result,duration_ms,summary,error")
+	}
+	var runs []TaskRun
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d is invalid", line)
+		}
+		started, err := time.Parse(time.RFC3339, rec[1])
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d: started_at is not a valid time", line)
+		}
+		dur, err := strconv.ParseInt(rec[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d: duration_ms is not a number", line)
+		}
+		tr := TaskRun{TaskID: rec[0], StartedAt: started, Result: TaskRunResult(rec[2]), DurationMs: dur, Error: rec[len(rec)-1]}
+		if hasSummary {
+			tr.Summary, err = parseTaskRunSummary(rec[4])
+			if err != nil {
+				return nil, fmt.Errorf("csv line %d: %w", line, err)
+			}
+		}
+		runs = append(runs, tr)
+	}
+	return runs, nil
+}
+
+// Parse summary counts from a csv cell written by `formatTaskRunSummary`.
+func parseTaskRunSummary(s string) (map[string]float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	counts := map[string]float64{}
+	for _, pair := range strings.Split(s, "; ") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return nil, errors.New("summary is not key=value pairs")
+		}
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, errors.New("summary value of " + k + " is not a number")
+		}
+		counts[k] = n
+	}
+	return counts, nil
+}
+
+// Check an imported task run is one that could have been saved.
+func checkImportedTaskRun(tr TaskRun) error {
+	if tr.TaskID == "" {
+		return errors.New("run has no task")
+	}
+	if tr.StartedAt.IsZero() {
+		return errors.New("run has no start time")
+	}
+	if tr.Result != TASK_RUN_SUCCESS && tr.Result != TASK_RUN_FAILED {
+		return errors.New("run result must be SUCCESS or FAILED")
+	}
+	if tr.DurationMs < 0 {
+		return errors.New("run duration can't be negative")
+	}
+	return nil
+}
+
+// Import task runs into history (eg. from an export of another server).
+// All runs are checked before any are imported, one invalid run fails
+// the import. Runs already in history, going by task and start time (to
+// the second, csv exports don't have more), are skipped so importing the
+// same export twice doesn't duplicate them.
+func importTaskHistory(db *gorm.DB, runs []TaskRun) (TaskHistoryImportResult, error) {
+	for i, tr := range runs {
+		if err := checkImportedTaskRun(tr); err != nil {
+			return TaskHistoryImportResult{}, fmt.Errorf("run %d: %w", i+1, err)
+		}
+	}
+	result := TaskHistoryImportResult{}
+	keepFrom := taskClock.Now().Add(-taskRunsKeepFor)
+	// Duplicates within the import itself.
+	seen := map[string]bool{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, tr := range runs {
+			started := tr.StartedAt.Local().Truncate(time.Second)
+			if started.Before(keepFrom) {
+				result.Expired++
+				continue
+			}
+			key := tr.TaskID + "|" + strconv.FormatInt(started.Unix(), 10)
+			if seen[key] {
+				result.Duplicates++
+				continue
+			}
+			seen[key] = true
+			var count int64
+			res := (TaskRunQuery{TaskID: tr.TaskID, From: started, To: started.Add(time.Second)}).apply(tx).Count(&count)
+			if res.Error != nil {
+				return res.Error
+			}
+			if count > 0 {
+				result.Duplicates++
+				continue
+			}
+			// Saved in local time, like runs saved by us.
+			n := TaskRun{TaskID: tr.TaskID, StartedAt: tr.StartedAt.Local(), DurationMs: tr.DurationMs, Result: tr.Result, Error: tr.Error, Summary: tr.Summary}
+			if res := tx.Create(&n); res.Error != nil {
+				return res.Error
+			}
+			result.Imported++
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("importTaskHistory: Failed to import task runs.", "error", err)
+		return TaskHistoryImportResult{}, errors.New("failed to import task runs")
+	}
+	slog.Info("importTaskHistory: Imported task runs.", "imported", result.Imported, "duplicates", result.Duplicates, "expired", result.Expired)
+	evictTaskRuns()
+	stats, err := getTaskRunStats(db, TaskRunQuery{})
+	if err != nil {
+		return TaskHistoryImportResult{}, err
+	}
+	result.Stats = stats
+	return result, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Check `got` stats match `want`, times compared by instant.
+func checkTestTaskRunStats(t *testing.T, what string, got []TaskRunStats, want []TaskRunStats) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: got stats %+v, want %+v", what, got, want)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.TaskID != w.TaskID || g.Runs != w.Runs || g.Failures != w.Failures || g.TotalDurationMs != w.TotalDurationMs ||
+			!g.FirstRun.Equal(w.FirstRun) || !g.LastRun.Equal(w.LastRun) {
+			t.Errorf("%s: got stats %+v, want %+v", what, g, w)
+		}
+	}
+}
+
+func TestTaskHistoryExportImportRoundTrip(t *testing.T) {
+	useTestConfig(t)
+	now := time.Now().Truncate(time.Second)
+	useFakeTaskClock(t, now)
+	useTestScheduler(t, map[string]TaskFunc{})
+	src := newTestDb(t)
+	taskDb = src
+	for i, tr := range []TaskRun{
+		{TaskID: "test_export_a", Result: TASK_RUN_SUCCESS, DurationMs: 120, Summary: map[string]float64{"removed": 3, "ratio": 0.5}},
+		{TaskID: "test_export_a", Result: TASK_RUN_FAILED, DurationMs: 40, Error: "server unreachable, retrying"},
+		{TaskID: "test_export_b", Result: TASK_RUN_SUCCESS, DurationMs: 900},
+		{TaskID: "test_export_a", Result: TASK_RUN_SUCCESS, DurationMs: 80},
+	} {
+		tr.StartedAt = now.Add(-time.Duration(4-i) * time.Hour)
+		src.Create(&tr)
+	}
+	srcRouter, srcToken := newTestTaskRouter(t, src)
+
+	w := doTestRequest(t, srcRouter, http.MethodGet, "/api/task/history/export", srcToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d exporting, want 200: %s", w.Code, w.Body)
+	}
+	var export TaskHistoryExport
+	if err := json.Unmarshal(w.Body.Bytes(), &export); err != nil {
+		t.Fatalf("failed to decode export: %v", err)
+	}
+	if len(export.Runs) != 4 || len(export.Stats) != 2 {
+		t.Fatalf("exported %d runs with stats %+v, want 4 runs of 2 tasks", len(export.Runs), export.Stats)
+	}
+	w = doTestRequest(t, srcRouter, http.MethodGet, "/api/task/history/csv", srcToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d exporting csv, want 200: %s", w.Code, w.Body)
+	}
+	exportCSV := w.Body.Bytes()
+
+	importInto := func(r http.Handler, token string, query string, body []byte) TaskHistoryImportResult {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/task/history/import"+query, bytes.NewReader(body))
+		req.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got %d importing%s, want 200: %s", w.Code, query, w.Body)
+		}
+		var res TaskHistoryImportResult
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("failed to decode import result: %v", err)
+		}
+		return res
+	}
+	exportJSON, _ := json.Marshal(export)
+	for _, c := range []struct {
+		format string
+		query  string
+		body   []byte
+	}{
+		{"json", "", exportJSON},
+		{"csv", "?format=csv", exportCSV},
+	} {
+		t.Run(c.format, func(t *testing.T) {
+			dst := newTestDb(t)
+			taskDb = dst
+			r, token := newTestTaskRouter(t, dst)
+
+			res := importInto(r, token, c.query, c.body)
+			if res.Imported != 4 || res.Duplicates != 0 || res.Expired != 0 {
+				t.Errorf("got result %+v, want 4 imported", res)
+			}
+			checkTestTaskRunStats(t, "first import", res.Stats, export.Stats)
+			// Both formats are the same runs, importing either again duplicates nothing.
+			for _, again := range [][]byte{exportJSON, exportCSV} {
+				q := ""
+				if bytes.Equal(again, exportCSV) {
+					q = "?format=csv"
+				}
+				res = importInto(r, token, q, again)
+				if res.Imported != 0 || res.Duplicates != 4 {
+					t.Errorf("got result %+v importing again%s, want 4 duplicates", res, q)
+				}
+				checkTestTaskRunStats(t, "import again", res.Stats, export.Stats)
+			}
+			var got TaskRun
+			dst.Where("task_id = ? AND duration_ms = ?", "test_export_a", 120).First(&got)
+			if want := map[string]float64{"removed": 3, "ratio": 0.5}; !reflect.DeepEqual(got.Summary, want) {
+				t.Errorf("imported run has summary %v, want %v", got.Summary, want)
+			}
+		})
+	}
+}
+
+func TestTaskHistoryImportInvalid(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{})
+	db := newTestDb(t)
+	taskDb = db
+	r, token := newTestTaskRouter(t, db)
+
+	valid := TaskRun{TaskID: "test_import", StartedAt: time.Now(), Result: TASK_RUN_SUCCESS}
+	invalid := TaskRun{TaskID: "test_import", StartedAt: time.Now(), Result: TASK_RUN_SKIPPED}
+	for name, body := range map[string]any{
+		"invalid run":     TaskHistoryExport{Version: taskHistoryExportVersion, Runs: []TaskRun{valid, invalid}},
+		"unknown version": TaskHistoryExport{Version: taskHistoryExportVersion + 1, Runs: []TaskRun{valid}},
+	} {
+		if w := doTestRequest(t, r, http.MethodPost, "/api/task/history/import", token, body); w.Code != http.StatusBadRequest {
+			t.Errorf("got %d importing with %s, want 400: %s", w.Code, name, w.Body)
+		}
+	}
+	var count int64
+	db.Model(&TaskRun{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d runs imported from invalid imports, want none", count)
+	}
+}
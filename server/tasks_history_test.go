@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTaskRunsCSVIncludesSummaryCounts(t *testing.T) {
+	useTestConfig(t)
+	clock := useFakeTaskClock(t, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	fail := false
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_history_csv": {
+			name: "Test History Csv",
+			f: func() error {
+				if fail {
+					return errors.New("server unreachable")
+				}
+				setTaskSummary("test_history_csv", map[string]any{
+					"removed": 3,
+					"failed":  0,
+					"ratio":   0.5,
+					// Not counts, left out.
+					"server": "sonarr",
+					"users":  map[string]any{"1": 2},
+				})
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+	taskDb = newTestDb(t)
+
+	runTaskOutcome("test_history_csv")
+	clock.Advance(time.Hour)
+	// Fails before reporting, so the last runs summary isn't saved with it.
+	fail = true
+	runTaskOutcome("test_history_csv")
+
+	var buf bytes.Buffer
+	if err := writeTaskRunsCSV(taskDb, TaskRunQuery{TaskID: "test_history_csv"}, &buf); err != nil {
+		t.Fatalf("failed to write csv: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read csv: %v", err)
+	}
+	want := [][]string{
+		{"task", "started_at", "result", "duration_ms", "summary", "error"},
+		{"test_history_csv", "2024-03-01T12:00:00Z", string(TASK_RUN_SUCCESS), "0", "failed=0; ratio=0.5; removed=3", ""},
+		{"test_history_csv", "2024-03-01T13:00:00Z", string(TASK_RUN_FAILED), "0", "", "server unreachable"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got csv rows\n%q\nwant\n%q", rows, want)
+	}
+}
+
+func TestTaskRanSince(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_ran":       {name: "Test Ran", f: func() error { return nil }, dd: time.Hour},
+		"test_ran_saved": {name: "Test Ran Saved", f: func() error { return nil }, dd: time.Hour},
+		"test_never_ran": {name: "Test Never Ran", f: func() error { return nil }, dd: time.Hour},
+	})
+	db := newTestDb(t)
+	taskDb = db
+	for _, id := range []string{"test_ran", "test_ran_saved", "test_never_ran"} {
+		resetTaskStatus(id)
+	}
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	recordTaskRun("test_ran", now.Add(-30*time.Minute), time.Second, nil)
+	// Only in history, eg. ran before a restart.
+	db.Create(&TaskRun{TaskID: "test_ran_saved", StartedAt: now.Add(-2 * time.Hour), Result: TASK_RUN_SUCCESS})
+
+	for _, c := range []struct {
+		id   string
+		ran  bool
+		last time.Time
+	}{
+		{"test_ran", true, now.Add(-30 * time.Minute)},
+		{"test_ran_saved", false, now.Add(-2 * time.Hour)},
+		{"test_never_ran", false, time.Time{}},
+	} {
+		ran, last, err := taskRanSince(c.id, now.Add(-time.Hour))
+		if err != nil {
+			t.Fatalf("%s failed: %v", c.id, err)
+		}
+		if ran != c.ran || !last.Equal(c.last) {
+			t.Errorf("%s got ran %v last %s, want %v and %s", c.id, ran, last, c.ran, c.last)
+		}
+	}
+	if ran, _, _ := taskRanSince("test_ran_saved", now.Add(-3*time.Hour)); !ran {
+		t.Error("saved run isn't counted as ran since before it")
+	}
+	if _, _, err := taskRanSince("test_missing", now); err == nil || err.Error() != "no task found" {
+		t.Errorf("unknown task got %v, want no task found", err)
+	}
+}
+
+func TestTaskHistoryCapEvictsOldest(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_HISTORY_MAX_RUNS = 3
+	clock := useFakeTaskClock(t, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	resetEvicted := func() {
+		taskRunsEvictedMu.Lock()
+		taskRunsEvicted = map[string]int64{}
+		taskRunsEvictedMu.Unlock()
+	}
+	resetEvicted()
+	t.Cleanup(resetEvicted)
+	f := func() error { return nil }
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_evict_a": {name: "Test Evict A", f: f, dd: time.Hour},
+		"test_evict_b": {name: "Test Evict B", f: f, dd: time.Hour},
+	})
+	taskDb = newTestDb(t)
+
+	start := clock.Now()
+	for _, id := range []string{"test_evict_a", "test_evict_b", "test_evict_a", "test_evict_b", "test_evict_a"} {
+		runTaskOutcome(id)
+		clock.Advance(time.Minute)
+	}
+	var runs []TaskRun
+	taskDb.Order("started_at").Find(&runs)
+	var got []string
+	for _, r := range runs {
+		got = append(got, r.TaskID+" "+r.StartedAt.Sub(start).String())
+	}
+	want := []string{"test_evict_a 2m0s", "test_evict_b 3m0s", "test_evict_a 4m0s"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("history has %q, want the newest 3 runs %q", got, want)
+	}
+	if a, b := getTaskRunsEvicted("test_evict_a"), getTaskRunsEvicted("test_evict_b"); a != 1 || b != 1 {
+		t.Errorf("got %d and %d runs evicted, want 1 of each task", a, b)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+)
+
+const (
+	// Imports (file imports) are made of separate requests, one per item,
+	// so there is no end to watch for. They count as running until no item
+	// has been imported for this long.
+	taskImportIdleAfter = 2 * time.Minute
+	// How long a run deferred because of an import waits before trying again.
+	taskImportDeferRetry = 1 * time.Minute
+)
+
+// Names of jobs (see `addJob`) that import content.
+var taskImportJobNames = []string{"trakt_import", "jf_sync", "plex_sync"}
+
+var (
+	// Running imports, by job id (or user for file imports), and when
+	// they expire. Imports that end explicitly (jobs) never expire.
+	taskImports   = map[string]time.Time{}
+	taskImportsMu sync.Mutex
+	// Tasks with a deferred run waiting to retry.
+	taskDeferred   = map[string]bool{}
+	taskDeferredMu sync.Mutex
+)
+
+// Register a job with the scheduler if it is an import,
+// conflicting tasks are deferred until it ends.
+func beginTaskImportJob(jobId string, name string) {
+	if !slices.Contains(taskImportJobNames, name) {
+		return
+	}
+	taskImportsMu.Lock()
+	defer taskImportsMu.Unlock()
+	taskImports[jobId] = time.Time{}
+	slog.Debug("beginTaskImportJob: Import started, deferring conflicting tasks.", "job_id", jobId, "name", name)
+}
+
+// Deregister a job, no-op if it wasn't an import.
+func endTaskImportJob(jobId string) {
+	taskImportsMu.Lock()
+	defer taskImportsMu.Unlock()
+	delete(taskImports, jobId)
+}
+
+// Record a file import item being imported by a user.
+func touchTaskImport(key string) {
+	taskImportsMu.Lock()
+	defer taskImportsMu.Unlock()
+	taskImports[key] = taskClock.Now().Add(taskImportIdleAfter)
+}
+
+// If any import is running.
+func isTaskImportActive() bool {
+	taskImportsMu.Lock()
+	defer taskImportsMu.Unlock()
+	now := taskClock.Now()
+	for k, until := range taskImports {
+		if until.IsZero() || now.Before(until) {
+			return true
+		}
+		delete(taskImports, k)
+	}
+	return false
+}
+
+// If a task should be deferred while an import is running, from
+// TASK_DEFER_DURING_IMPORT or TASK_DEFAULTS, defaulting to true for
+// maintenance tasks.
+func isTaskDeferredDuringImport(id string) bool {
+	taskConfigMu.RLock()
+	defer taskConfigMu.RUnlock()
+	if d, ok := Config.TASK_DEFER_DURING_IMPORT[id]; ok {
+		return d
+	}
+	if d := Config.TASK_DEFAULTS.DeferDuringImport; d != nil {
+		return *d
+	}
+	return slices.Contains(maintenanceTasks, id)
+}
+
+// Retry a run of a task deferred because of an import after
+// `taskImportDeferRetry`, unless a retry is already waiting.
+// The recurring schedule is left alone. Not retried without a scheduler.
+func deferTaskForImport(id string) {
+	if taskScheduler == nil {
+		// Running a single task from the cli.
+		slog.Info("deferTaskForImport: Not retrying deferred run, no scheduler is running.", "job_name", id)
+		return
+	}
+	taskDeferredMu.Lock()
+	if taskDeferred[id] {
+		taskDeferredMu.Unlock()
+		return
+	}
+	taskDeferred[id] = true
+	taskDeferredMu.Unlock()
+	at := time.Now().Add(taskImportDeferRetry)
+	_, err := taskScheduler.NewJob(
+		gocron.OneTimeJob(gocron.OneTimeJobStartDateTime(at)),
+		gocron.NewTask(runDeferredTask, id),
+		gocron.WithName(id),
+		gocron.WithTags(taskTagOneTime),
+		gocron.WithLimitedRuns(1),
+	)
+	if err != nil {
+		slog.Error("deferTaskForImport: Failed to add retry job!", "job_name", id, "error", err)
+		clearTaskDeferred(id)
+		return
+	}
+	slog.Info("deferTaskForImport: Task deferred until imports finish.", "job_name", id, "retry_at", at)
+}
+
+// Retry a deferred run, it is deferred again if imports are still running.
+func runDeferredTask(id string) {
+	clearTaskDeferred(id)
+	runTask(id)
+}
+
+func clearTaskDeferred(id string) {
+	taskDeferredMu.Lock()
+	defer taskDeferredMu.Unlock()
+	delete(taskDeferred, id)
+}
+
+// Record a run of a task deferred because of an import.
+func recordTaskDeferred(id string) {
+	taskStatusesMu.Lock()
+	defer taskStatusesMu.Unlock()
+	ts, ok := taskStatuses[id]
+	if !ok {
+		ts = &TaskStatus{}
+		taskStatuses[id] = ts
+	}
+	ts.Deferred++
+}
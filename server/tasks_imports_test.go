@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Clear running imports and deferred runs until the test ends.
+func useTestTaskImports(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		taskImportsMu.Lock()
+		taskImports = map[string]time.Time{}
+		taskImportsMu.Unlock()
+		taskDeferredMu.Lock()
+		taskDeferred = map[string]bool{}
+		taskDeferredMu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestMaintenanceDeferredDuringImport(t *testing.T) {
+	useTestConfig(t)
+	useTestTaskImports(t)
+	runs := map[string]int{}
+	useTestScheduler(t, map[string]TaskFunc{
+		"cleanup_tokens": {
+			name: "Cleanup Tokens",
+			f: func() error {
+				runs["cleanup_tokens"]++
+				return nil
+			},
+			dd: time.Hour,
+		},
+		"test_import_unrelated": {
+			name: "Test Import Unrelated",
+			f: func() error {
+				runs["test_import_unrelated"]++
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+	resetTaskStatus("cleanup_tokens")
+
+	// Not an import.
+	beginTaskImportJob("job_other", "other_job")
+	if isTaskImportActive() {
+		t.Fatal("import active for a job that isn't an import")
+	}
+	beginTaskImportJob("job_import", "trakt_import")
+	for i := 0; i < 2; i++ {
+		out := runTaskOutcome("cleanup_tokens")
+		if out.Result != TASK_RUN_SKIPPED || out.Reason != "deferred due to import" {
+			t.Fatalf("cleanup during an import was %s (%s), want deferred", out.Result, out.Reason)
+		}
+	}
+	if n := countTestOnceJobs("cleanup_tokens"); n != 1 {
+		t.Errorf("got %d retries of the deferred run, want 1", n)
+	}
+	if d := getTaskStatus("cleanup_tokens").Deferred; d != 2 {
+		t.Errorf("got %d deferred runs, want 2", d)
+	}
+	if out := runTaskOutcome("test_import_unrelated"); out.Result != TASK_RUN_SUCCESS {
+		t.Errorf("task that isn't maintenance was %s (%s) during an import, want success", out.Result, out.Reason)
+	}
+
+	endTaskImportJob("job_import")
+	runDeferredTask("cleanup_tokens")
+	if runs["cleanup_tokens"] != 1 {
+		t.Errorf("cleanup ran %d times once the import ended, want once", runs["cleanup_tokens"])
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// Pool a task runs in. Each pool has its own concurrency budget,
+// so long running tasks can't hold up quick ones.
+type TaskPool string
+
+var (
+	// Quick tasks, the default pool.
+	TASK_POOL_LIGHT TaskPool = "light"
+	// Tasks that can take a while (eg. scanning the db or syncing with external services).
+	TASK_POOL_HEAVY TaskPool = "heavy"
+)
+
+// A task run waiting for a free slot.
+type taskSlotWaiter struct {
+	id       string
+	priority int
+	// Order the waiter arrived in, breaks priority ties.
+	seq   uint64
+	ready chan struct{}
+}
+
+type taskSlotPool struct {
+	// Number of task runs holding a slot.
+	running int
+	waiting []*taskSlotWaiter
+}
+
+var (
+	taskSlotPools = map[TaskPool]*taskSlotPool{}
+	taskSlotsSeq  uint64
+	taskSlotsMu   sync.Mutex
+)
+
+// Create the slot pools, any existing state is dropped.
+// Should only be used at startup, before any tasks run.
+func setupTaskPools() {
+	taskSlotsMu.Lock()
+	defer taskSlotsMu.Unlock()
+	taskSlotPools = map[TaskPool]*taskSlotPool{
+		TASK_POOL_LIGHT: {},
+		TASK_POOL_HEAVY: {},
+	}
+}
+
+// Get the pool a task was registered in.
+func getTaskPool(id string) TaskPool {
+	if tf, ok := getTaskFunc(id); ok && tf.pool != "" {
+		return tf.pool
+	}
+	return TASK_POOL_LIGHT
+}
+
+// Get the concurrency limit of a pool, from TASK_POOL_CONCURRENCY,
+// falling back to TASK_CONCURRENCY. Zero or less is unlimited.
+func getTaskPoolLimit(p TaskPool) int {
+	taskConfigMu.RLock()
+	defer taskConfigMu.RUnlock()
+	if l, ok := Config.TASK_POOL_CONCURRENCY[string(p)]; ok {
+		return l
+	}
+	return Config.TASK_CONCURRENCY
+}
+
+// Must hold taskSlotsMu.
+func getTaskSlotPool(p TaskPool) *taskSlotPool {
+	sp, ok := taskSlotPools[p]
+	if !ok {
+		sp = &taskSlotPool{}
+		taskSlotPools[p] = sp
+	}
+	return sp
+}
+
+// Wait for a free slot in the tasks pool to run it in, if the pool has a limit.
+// When slots are full, the highest TASK_PRIORITY waiting task is given
+// the next free slot (oldest first on ties). This is best effort, running
+// tasks are never stopped to make room for a higher priority one.
+// Returns the pool the slot was taken in, which must be passed to
+// `releaseTaskSlot` (the task may be deregistered before it is released).
+// Returns false if no slot was taken (no limit set), in which case
+// `releaseTaskSlot` must not be called.
+func acquireTaskSlot(id string) (TaskPool, bool) {
+	pool := getTaskPool(id)
+	limit := getTaskPoolLimit(pool)
+	if limit <= 0 {
+		return pool, false
+	}
+	taskSlotsMu.Lock()
+	sp := getTaskSlotPool(pool)
+	if sp.running < limit && len(sp.waiting) == 0 {
+		sp.running++
+		taskSlotsMu.Unlock()
+		return pool, true
+	}
+	taskSlotsSeq++
+	w := &taskSlotWaiter{
+		id:       id,
+		priority: getTaskPriority(id),
+		seq:      taskSlotsSeq,
+		ready:    make(chan struct{}),
+	}
+	sp.waiting = append(sp.waiting, w)
+	taskSlotsMu.Unlock()
+	slog.Debug("acquireTaskSlot: Waiting for a free slot.", "job_name", id, "pool", pool, "priority", w.priority)
+	<-w.ready
+	return pool, true
+}
+
+// Release a slot taken by `acquireTaskSlot` in `pool`.
+// The slot is handed straight to the next waiting task in the pool, if there is one.
+func releaseTaskSlot(pool TaskPool) {
+	taskSlotsMu.Lock()
+	defer taskSlotsMu.Unlock()
+	sp := getTaskSlotPool(pool)
+	sp.running--
+	wakeTaskSlotWaitersLocked(pool, sp)
+}
+
+// Hand free slots to waiting tasks, after pool limits were changed.
+// Raising (or removing) a limit lets waiting tasks run straight away,
+// rather than when running tasks release their slots.
+func wakeTaskSlotWaiters() {
+	taskSlotsMu.Lock()
+	defer taskSlotsMu.Unlock()
+	for pool, sp := range taskSlotPools {
+		wakeTaskSlotWaitersLocked(pool, sp)
+	}
+}
+
+// Give free slots of `pool` to its waiting tasks, highest priority first.
+// After a limit is lowered, nothing is woken until enough slots are released.
+// Must hold taskSlotsMu.
+func wakeTaskSlotWaitersLocked(pool TaskPool, sp *taskSlotPool) {
+	limit := getTaskPoolLimit(pool)
+	for len(sp.waiting) > 0 && (limit <= 0 || sp.running < limit) {
+		next := 0
+		for i, w := range sp.waiting {
+			n := sp.waiting[next]
+			if w.priority > n.priority || (w.priority == n.priority && w.seq < n.seq) {
+				next = i
+			}
+		}
+		w := sp.waiting[next]
+		sp.waiting = append(sp.waiting[:next], sp.waiting[next+1:]...)
+		sp.running++
+		close(w.ready)
+	}
+}
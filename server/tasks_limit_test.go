@@ -0,0 +1,176 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTaskSlotReleasedToPoolAfterDeregister(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_POOL_CONCURRENCY = map[string]int{string(TASK_POOL_HEAVY): 1}
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_slot_heavy": {name: "Test Slot Heavy", f: func() error { return nil }, dd: time.Hour, pool: TASK_POOL_HEAVY},
+	})
+	token, ok := startTaskRun("test_slot_heavy")
+	if !ok {
+		t.Fatal("failed to start run")
+	}
+	pool, ok := acquireTaskSlot("test_slot_heavy")
+	if !ok || pool != TASK_POOL_HEAVY {
+		t.Fatalf("got slot in %q (%v), want heavy", pool, ok)
+	}
+	if !setTaskRunSlot("test_slot_heavy", token, pool) {
+		t.Fatal("failed to record slot")
+	}
+	// Deregistered while running, its pool can no longer be looked up.
+	if err := deregisterTask("test_slot_heavy"); err != nil {
+		t.Fatalf("failed to deregister: %v", err)
+	}
+	finishTaskRun("test_slot_heavy", token)
+	taskSlotsMu.Lock()
+	heavy := taskSlotPools[TASK_POOL_HEAVY].running
+	light := taskSlotPools[TASK_POOL_LIGHT].running
+	taskSlotsMu.Unlock()
+	if heavy != 0 || light != 0 {
+		t.Errorf("heavy pool has %d running, light pool has %d, want 0 and 0", heavy, light)
+	}
+}
+
+func TestTaskSlotHandedToHighestPriorityWaiter(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_CONCURRENCY = 1
+	Config.TASK_PRIORITY = map[string]int{"test_slot_high": 10}
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_slot_first": {name: "First", f: func() error { return nil }, dd: time.Hour},
+		"test_slot_low":   {name: "Low", f: func() error { return nil }, dd: time.Hour},
+		"test_slot_high":  {name: "High", f: func() error { return nil }, dd: time.Hour},
+	})
+	pool, _ := acquireTaskSlot("test_slot_first")
+	got := make(chan string, 2)
+	for _, id := range []string{"test_slot_low", "test_slot_high"} {
+		go func(id string) {
+			p, _ := acquireTaskSlot(id)
+			got <- id
+			releaseTaskSlot(p)
+		}(id)
+		waitFor(t, id+" to wait for a slot", func() bool {
+			taskSlotsMu.Lock()
+			defer taskSlotsMu.Unlock()
+			for _, w := range taskSlotPools[TASK_POOL_LIGHT].waiting {
+				if w.id == id {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	releaseTaskSlot(pool)
+	if first := <-got; first != "test_slot_high" {
+		t.Errorf("slot went to %s first, want test_slot_high", first)
+	}
+	<-got
+}
+
+func TestTaskSlotWaitersWokenWhenLimitRaised(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_CONCURRENCY = 1
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_slot_holder": {name: "Holder", f: func() error { return nil }, dd: time.Hour},
+		"test_slot_waiter": {name: "Waiter", f: func() error { return nil }, dd: time.Hour},
+	})
+	pool, _ := acquireTaskSlot("test_slot_holder")
+	got := make(chan TaskPool, 1)
+	go func() {
+		p, _ := acquireTaskSlot("test_slot_waiter")
+		got <- p
+	}()
+	waitFor(t, "the waiter to wait for a slot", func() bool {
+		taskSlotsMu.Lock()
+		defer taskSlotsMu.Unlock()
+		return len(taskSlotPools[TASK_POOL_LIGHT].waiting) == 1
+	})
+	two := 2
+	if _, err := updateTaskSettings(TaskSettingsUpdateRequest{Concurrency: &two}); err != nil {
+		t.Fatalf("failed to raise the limit: %v", err)
+	}
+	select {
+	case p := <-got:
+		releaseTaskSlot(p)
+	case <-time.After(time.Second):
+		t.Fatal("waiter didn't get a slot after the limit was raised")
+	}
+	releaseTaskSlot(pool)
+	taskSlotsMu.Lock()
+	running := taskSlotPools[TASK_POOL_LIGHT].running
+	taskSlotsMu.Unlock()
+	if running != 0 {
+		t.Errorf("light pool has %d running after both released, want 0", running)
+	}
+}
+
+func TestBusyHeavyPoolDoesNotBlockLightTasks(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_CONCURRENCY = 1
+	release := make(chan struct{})
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_pool_heavy": {
+			name: "Test Pool Heavy",
+			f: func() error {
+				<-release
+				return nil
+			},
+			dd:   time.Hour,
+			pool: TASK_POOL_HEAVY,
+		},
+		"test_pool_heavy_other": {name: "Test Pool Heavy Other", f: func() error { return nil }, dd: time.Hour, pool: TASK_POOL_HEAVY},
+		"test_pool_light":       {name: "Test Pool Light", f: func() error { return nil }, dd: time.Hour},
+	})
+	heavyDone := make(chan TaskRunOutcome)
+	go func() {
+		heavyDone <- runTaskOutcome("test_pool_heavy")
+	}()
+	waitFor(t, "heavy task to take its pools slot", func() bool {
+		taskSlotsMu.Lock()
+		defer taskSlotsMu.Unlock()
+		return taskSlotPools[TASK_POOL_HEAVY].running == 1
+	})
+	otherDone := make(chan TaskRunOutcome)
+	go func() {
+		otherDone <- runTaskOutcome("test_pool_heavy_other")
+	}()
+
+	lightDone := make(chan TaskRunOutcome)
+	go func() {
+		lightDone <- runTaskOutcome("test_pool_light")
+	}()
+	select {
+	case out := <-lightDone:
+		if out.Result != TASK_RUN_SUCCESS {
+			t.Errorf("light task run was %s (%s), want success", out.Result, out.Reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("light task blocked by the busy heavy pool")
+	}
+	select {
+	case <-otherDone:
+		t.Error("second heavy task ran while its pool was full")
+	default:
+	}
+
+	close(release)
+	for _, done := range []chan TaskRunOutcome{heavyDone, otherDone} {
+		if out := <-done; out.Result != TASK_RUN_SUCCESS {
+			t.Errorf("heavy task run was %s (%s), want success", out.Result, out.Reason)
+		}
+	}
+	pools := map[string]TaskPool{
+		"test_pool_heavy":       TASK_POOL_HEAVY,
+		"test_pool_heavy_other": TASK_POOL_HEAVY,
+		"test_pool_light":       TASK_POOL_LIGHT,
+	}
+	for _, v := range getAllTasks(false, false) {
+		if want := pools[v.ID]; v.Pool != want {
+			t.Errorf("%s reports pool %q, want %q", v.ID, v.Pool, want)
+		}
+	}
+}
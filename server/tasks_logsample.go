@@ -0,0 +1,73 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Sampling of a tasks failure logs, while it keeps failing with the same error.
+type taskErrorSample struct {
+	err string
+	// When the error was last logged.
+	loggedAt time.Time
+	// Failures not logged since then.
+	suppressed int
+}
+
+var (
+	taskErrorSamples   = map[string]*taskErrorSample{}
+	taskErrorSamplesMu sync.Mutex
+)
+
+// Get the window (seconds) repeated identical failures of a task are
+// logged once per, from TASK_ERROR_LOG_WINDOW or TASK_DEFAULTS.
+// 0 if not set, every failure is then logged.
+func getTaskErrorLogWindow(id string) int {
+	taskConfigMu.RLock()
+	defer taskConfigMu.RUnlock()
+	if w, ok := Config.TASK_ERROR_LOG_WINDOW[id]; ok {
+		return w
+	}
+	return Config.TASK_DEFAULTS.ErrorLogWindow
+}
+
+// Check if a tasks failure should be logged. The first failure with an
+// error is always logged, after that the same error is only logged once
+// per window. Returns the amount of failures not logged since it last was,
+// to be included in the log. Only logging is sampled, every failure is
+// still recorded in the tasks stats.
+func sampleTaskError(id string, err string, now time.Time) (bool, int) {
+	window := getTaskErrorLogWindow(id)
+	taskErrorSamplesMu.Lock()
+	defer taskErrorSamplesMu.Unlock()
+	if window <= 0 {
+		delete(taskErrorSamples, id)
+		return true, 0
+	}
+	s, ok := taskErrorSamples[id]
+	if !ok || s.err != err {
+		taskErrorSamples[id] = &taskErrorSample{err: err, loggedAt: now}
+		return true, 0
+	}
+	if now.Sub(s.loggedAt) < time.Duration(window)*time.Second {
+		s.suppressed++
+		return false, 0
+	}
+	suppressed := s.suppressed
+	s.loggedAt = now
+	s.suppressed = 0
+	return true, suppressed
+}
+
+// Stop sampling a tasks failures, once it succeeds. Returns the amount of
+// failures that weren't logged, so they can be mentioned once it recovers.
+func resetTaskErrorSample(id string) int {
+	taskErrorSamplesMu.Lock()
+	defer taskErrorSamplesMu.Unlock()
+	s, ok := taskErrorSamples[id]
+	if !ok {
+		return 0
+	}
+	delete(taskErrorSamples, id)
+	return s.suppressed
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTaskErrorLogSampling(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_ERROR_LOG_WINDOW = map[string]int{"test_log_sample": 60}
+	clock := useFakeTaskClock(t, time.Now())
+	resetTaskStatus("test_log_sample")
+	resetTaskErrorSample("test_log_sample")
+	t.Cleanup(func() {
+		resetTaskStatus("test_log_sample")
+		resetTaskErrorSample("test_log_sample")
+	})
+	var runErr error
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_log_sample": {
+			name: "Test Log Sample",
+			f: func() error {
+				return runErr
+			},
+			dd: time.Minute,
+		},
+	})
+	logs := useTestLogs(t)
+
+	// A run every 10 seconds, the error changes once.
+	for i, err := range []string{"down", "down", "down", "down", "down", "down", "down", "other", "other", "other", ""} {
+		if i > 0 {
+			clock.Advance(10 * time.Second)
+		}
+		runErr = nil
+		if err != "" {
+			runErr = errors.New(err)
+		}
+		runTaskOutcome("test_log_sample")
+	}
+
+	type logged struct {
+		msg        string
+		err        string
+		suppressed float64
+	}
+	got := []logged{}
+	sc := bufio.NewScanner(logs)
+	for sc.Scan() {
+		var l map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &l); err != nil {
+			t.Fatalf("failed to decode log line %q: %v", sc.Text(), err)
+		}
+		if l["job_name"] != "test_log_sample" || (l["msg"] != "runTask: Task failed." && l["msg"] != "runTask: Task succeeded after failing. Some failures were not logged.") {
+			continue
+		}
+		e, _ := l["error"].(string)
+		s, _ := l["suppressed"].(float64)
+		got = append(got, logged{l["msg"].(string), e, s})
+	}
+	want := []logged{
+		{"runTask: Task failed.", "down", 0},
+		// 5 runs within the window not logged.
+		{"runTask: Task failed.", "down", 5},
+		{"runTask: Task failed.", "other", 0},
+		{"runTask: Task succeeded after failing. Some failures were not logged.", "", 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got logs %+v, want %+v", got, want)
+	}
+	if s := getTaskStatus("test_log_sample"); s.Runs != 11 || s.Failures != 10 {
+		t.Errorf("got %d runs with %d failures, want every failure recorded (11 with 10)", s.Runs, s.Failures)
+	}
+}
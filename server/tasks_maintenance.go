@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Maintenance tasks, in the order they are ran by `startMaintenance`.
+// Cheap cleanups go first, so the slower ones have less to look at.
+var maintenanceTasks = []string{
+	"cleanup_tokens",
+	"cleanup_stuck_imports",
+	"detect_duplicates",
+	"cleanup_orphaned_episodes",
+	"cleanup_images",
+	"rotate_logs",
+}
+
+type TaskMaintenanceResult struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	TaskRunOutcome
+	// Summary the task reported, if it reports one.
+	Summary map[string]any `json:"summary,omitempty"`
+}
+
+// Report of the current (or last) maintenance run.
+type TaskMaintenanceReport struct {
+	Running    bool       `json:"running"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// If the run was cancelled before all tasks ran.
+	Cancelled bool `json:"cancelled,omitempty"`
+	// One per maintenance task, in the order they run.
+	// Tasks that haven't run yet aren't included.
+	Results []TaskMaintenanceResult `json:"results"`
+}
+
+var (
+	maintenanceReport *TaskMaintenanceReport
+	maintenanceCancel chan struct{}
+	maintenanceMu     sync.Mutex
+)
+
+// Start running all maintenance tasks once, one after another.
+// Runs go through `runTaskOutcome`, so they follow the same rules as scheduled
+// runs (eg. a task that is already running is skipped) and the tasks schedules
+// aren't changed.
+func startMaintenance() (TaskMaintenanceReport, error) {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	if maintenanceReport != nil && maintenanceReport.Running {
+		return TaskMaintenanceReport{}, errors.New("maintenance is already running")
+	}
+	maintenanceReport = &TaskMaintenanceReport{
+		Running:   true,
+		StartedAt: taskClock.Now(),
+		Results:   []TaskMaintenanceResult{},
+	}
+	maintenanceCancel = make(chan struct{})
+	go runMaintenance(maintenanceCancel)
+	slog.Info("startMaintenance: Started running maintenance tasks.", "tasks", maintenanceTasks)
+	return copyMaintenanceReport(), nil
+}
+
+func runMaintenance(cancel chan struct{}) {
+	for _, id := range maintenanceTasks {
+		select {
+		case <-cancel:
+			finishMaintenance(true)
+			return
+		default:
+		}
+		r := TaskMaintenanceResult{ID: id, Name: getTaskDisplayName(id)}
+		r.TaskRunOutcome = runTaskOutcome(id)
+		if r.Result == TASK_RUN_SUCCESS {
+			r.Summary = getTaskStatus(id).Summary
+		}
+		maintenanceMu.Lock()
+		maintenanceReport.Results = append(maintenanceReport.Results, r)
+		maintenanceMu.Unlock()
+	}
+	finishMaintenance(false)
+}
+
+func finishMaintenance(cancelled bool) {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	now := taskClock.Now()
+	maintenanceReport.Running = false
+	maintenanceReport.FinishedAt = &now
+	maintenanceReport.Cancelled = cancelled
+	if cancelled {
+		for _, id := range maintenanceTasks[len(maintenanceReport.Results):] {
+			maintenanceReport.Results = append(maintenanceReport.Results, TaskMaintenanceResult{
+				ID:             id,
+				Name:           getTaskDisplayName(id),
+				TaskRunOutcome: TaskRunOutcome{Result: TASK_RUN_CANCELLED},
+			})
+		}
+	}
+	slog.Info("finishMaintenance: Finished running maintenance tasks.", "cancelled", cancelled, "took", now.Sub(maintenanceReport.StartedAt))
+}
+
+// Cancel the running maintenance. The task running right now
+// finishes (tasks can't be stopped part way), the rest are not ran.
+func cancelMaintenance() error {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	if maintenanceReport == nil || !maintenanceReport.Running {
+		return errors.New("maintenance is not running")
+	}
+	select {
+	case <-maintenanceCancel:
+		// Already cancelled, waiting on the current task.
+	default:
+		close(maintenanceCancel)
+	}
+	return nil
+}
+
+// Get the report of the current (or last) maintenance run.
+func getMaintenanceReport() (TaskMaintenanceReport, error) {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	if maintenanceReport == nil {
+		return TaskMaintenanceReport{}, errors.New("maintenance has not been ran")
+	}
+	return copyMaintenanceReport(), nil
+}
+
+// Must be called with maintenanceMu held.
+func copyMaintenanceReport() TaskMaintenanceReport {
+	r := *maintenanceReport
+	r.Results = append([]TaskMaintenanceResult{}, maintenanceReport.Results...)
+	return r
+}
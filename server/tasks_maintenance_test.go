@@ -0,0 +1,125 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Register a fake task for each maintenance task, calling `f` when
+// one runs. Clears the maintenance report until the test ends.
+func useTestMaintenanceTasks(t *testing.T, f func(id string)) {
+	t.Helper()
+	tfs := map[string]TaskFunc{}
+	for _, id := range maintenanceTasks {
+		resetTaskStatus(id)
+		tfs[id] = TaskFunc{
+			name: "Test " + id,
+			f: func() error {
+				f(id)
+				return nil
+			},
+			dd: time.Hour,
+		}
+	}
+	useTestScheduler(t, tfs)
+	reset := func() {
+		maintenanceMu.Lock()
+		maintenanceReport = nil
+		maintenanceCancel = nil
+		maintenanceMu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// Wait for the running maintenance to finish and return its report.
+func waitTestMaintenance(t *testing.T) TaskMaintenanceReport {
+	t.Helper()
+	var r TaskMaintenanceReport
+	waitFor(t, "maintenance to finish", func() bool {
+		r, _ = getMaintenanceReport()
+		return !r.Running
+	})
+	return r
+}
+
+func TestMaintenanceRunsInOrder(t *testing.T) {
+	useTestConfig(t)
+	var (
+		ran []string
+		mu  sync.Mutex
+	)
+	useTestMaintenanceTasks(t, func(id string) {
+		mu.Lock()
+		ran = append(ran, id)
+		mu.Unlock()
+		setTaskSummary(id, map[string]any{"task": id})
+	})
+
+	if _, err := startMaintenance(); err != nil {
+		t.Fatalf("failed to start maintenance: %v", err)
+	}
+	r := waitTestMaintenance(t)
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(ran, maintenanceTasks) {
+		t.Fatalf("tasks ran in order %q, want %q", ran, maintenanceTasks)
+	}
+	if r.Cancelled || r.FinishedAt == nil || len(r.Results) != len(maintenanceTasks) {
+		t.Fatalf("got report %+v, want a finished result for each task", r)
+	}
+	for i, res := range r.Results {
+		if res.ID != maintenanceTasks[i] || res.Result != TASK_RUN_SUCCESS {
+			t.Errorf("result %d is %s %s, want %s success", i, res.ID, res.Result, maintenanceTasks[i])
+		}
+		if res.Summary["task"] != res.ID {
+			t.Errorf("result for %s has summary %v, want its own summary", res.ID, res.Summary)
+		}
+	}
+	for _, id := range maintenanceTasks {
+		if getTask(id) == nil {
+			t.Errorf("recurring job of %s is gone after maintenance", id)
+		}
+	}
+}
+
+func TestMaintenanceCancel(t *testing.T) {
+	useTestConfig(t)
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	useTestMaintenanceTasks(t, func(id string) {
+		if id == maintenanceTasks[0] {
+			close(started)
+			<-unblock
+		}
+	})
+
+	if err := cancelMaintenance(); err == nil {
+		t.Error("cancelled maintenance that isn't running")
+	}
+	if _, err := startMaintenance(); err != nil {
+		t.Fatalf("failed to start maintenance: %v", err)
+	}
+	<-started
+	if _, err := startMaintenance(); err == nil {
+		t.Error("started maintenance while it was already running")
+	}
+	if err := cancelMaintenance(); err != nil {
+		t.Fatalf("failed to cancel: %v", err)
+	}
+	close(unblock)
+	r := waitTestMaintenance(t)
+	if !r.Cancelled || len(r.Results) != len(maintenanceTasks) {
+		t.Fatalf("got report %+v, want a cancelled result for each task", r)
+	}
+	if res := r.Results[0]; res.Result != TASK_RUN_SUCCESS {
+		t.Errorf("task running when cancelled was %s, want it to finish", res.Result)
+	}
+	for _, res := range r.Results[1:] {
+		if res.Result != TASK_RUN_CANCELLED {
+			t.Errorf("%s was %s after cancelling, want cancelled", res.ID, res.Result)
+		}
+	}
+}
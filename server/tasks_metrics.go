@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Only allow requests that send the configured TASK_METRICS_SECRET as a
+// bearer token. Every request is rejected if no secret is configured.
+// Wrong secrets count towards the same lockout as task triggers (see
+// `TaskTriggerRequired`), so the secret can't be guessed.
+func TaskMetricsRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if Config.TASK_METRICS_SECRET == "" {
+			slog.Warn("TaskMetricsRequired: Task metrics denied, TASK_METRICS_SECRET is not set.")
+			c.AbortWithStatus(403)
+			return
+		}
+		ip := c.ClientIP()
+		if isTaskTriggerLockedOut(ip) {
+			slog.Warn("TaskMetricsRequired: Task metrics denied, too many failed attempts.", "ip", ip)
+			c.AbortWithStatus(429)
+			return
+		}
+		secret, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || secret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(Config.TASK_METRICS_SECRET)) != 1 {
+			slog.Warn("TaskMetricsRequired: Task metrics denied, secret missing or invalid.", "ip", ip)
+			recordTaskTriggerFailure(ip)
+			c.AbortWithStatus(401)
+			return
+		}
+		c.Next()
+	}
+}
+
+// A metric in the task metrics exposition.
+type taskMetric struct {
+	name string
+	help string
+	// `counter` or `gauge`.
+	kind string
+	// Value of the metric for a task. Runs have one per result,
+	// keyed by the `result` label, everything else has one keyed by "".
+	values func(id string, ts TaskStatus) map[string]float64
+}
+
+// Every task metric has the labels:
+//   - task: the tasks id (eg. `cleanup_tokens`), never changes.
+//   - origin: where the task was defined (`builtin`, `config` or `api`).
+//   - pool: pool the task runs in (`light` or `heavy`).
+//
+// watcharr_task_runs_total also has `result` (`success`, `failed`, `skipped` or `deferred`).
+// Label sets are stable, so dashboards can be templated on them.
+var taskMetrics = []taskMetric{
+	{
+		name: "watcharr_task_runs_total",
+		help: "Runs of the task since startup, by result. Skipped only counts runs skipped because something the task needs was unavailable.",
+		kind: "counter",
+		values: func(id string, ts TaskStatus) map[string]float64 {
+			return map[string]float64{
+				"success":  float64(ts.Runs - ts.Failures),
+				"failed":   float64(ts.Failures),
+				"skipped":  float64(ts.Skipped),
+				"deferred": float64(ts.Deferred),
+			}
+		},
+	},
+	{
+		name: "watcharr_task_slow_runs_total",
+		help: "Runs of the task since startup that took longer than its TASK_SLA.",
+		kind: "counter",
+		values: func(id string, ts TaskStatus) map[string]float64 {
+			return map[string]float64{"": float64(ts.SlowRuns)}
+		},
+	},
+	{
+		name: "watcharr_task_consecutive_failures",
+		help: "Runs of the task in a row that have failed.",
+		kind: "gauge",
+		values: func(id string, ts TaskStatus) map[string]float64 {
+			return map[string]float64{"": float64(ts.ConsecutiveFailures)}
+		},
+	},
+	{
+		name: "watcharr_task_last_run_timestamp_seconds",
+		help: "Unix time the task last started running, 0 if it hasn't ran since startup.",
+		kind: "gauge",
+		values: func(id string, ts TaskStatus) map[string]float64 {
+			if ts.LastRun.IsZero() {
+				return map[string]float64{"": 0}
+			}
+			return map[string]float64{"": float64(ts.LastRun.Unix())}
+		},
+	},
+	{
+		name: "watcharr_task_last_duration_seconds",
+		help: "How long the tasks last run took.",
+		kind: "gauge",
+		values: func(id string, ts TaskStatus) map[string]float64 {
+			return map[string]float64{"": float64(ts.LastDurationMs) / 1000}
+		},
+	},
+	{
+		name: "watcharr_task_running",
+		help: "1 if the task is running right now, otherwise 0.",
+		kind: "gauge",
+		values: func(id string, ts TaskStatus) map[string]float64 {
+			if getTaskRunningSince(id).IsZero() {
+				return map[string]float64{"": 0}
+			}
+			return map[string]float64{"": 1}
+		},
+	},
+	{
+		name: "watcharr_task_history_evicted_total",
+		help: "Runs of the task removed from history since startup, because history was over TASK_HISTORY_MAX_RUNS.",
+		kind: "counter",
+		values: func(id string, ts TaskStatus) map[string]float64 {
+			return map[string]float64{"": float64(getTaskRunsEvicted(id))}
+		},
+	},
+	{
+		name: "watcharr_task_disabled",
+		help: "1 if the task is disabled, otherwise 0.",
+		kind: "gauge",
+		values: func(id string, ts TaskStatus) map[string]float64 {
+			if isTaskDisabled(id) {
+				return map[string]float64{"": 1}
+			}
+			return map[string]float64{"": 0}
+		},
+	},
+}
+
+// Write metrics for all tasks, in the prometheus text exposition format.
+func writeTaskMetrics(w io.Writer) error {
+	taskFuncsMu.RLock()
+	ids := make([]string, 0, len(taskFuncs))
+	origins := make(map[string]TaskOrigin, len(taskFuncs))
+	for id, tf := range taskFuncs {
+		ids = append(ids, id)
+		origins[id] = tf.origin
+	}
+	taskFuncsMu.RUnlock()
+	sort.Strings(ids)
+	statuses := make(map[string]TaskStatus, len(ids))
+	for _, id := range ids {
+		statuses[id] = getTaskStatus(id)
+	}
+	var b strings.Builder
+	for _, m := range taskMetrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, id := range ids {
+			labels := fmt.Sprintf(`task="%s",origin="%s",pool="%s"`, escapeMetricLabel(id), escapeMetricLabel(string(origins[id])), escapeMetricLabel(string(getTaskPool(id))))
+			vals := m.values(id, statuses[id])
+			keys := make([]string, 0, len(vals))
+			for k := range vals {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				l := labels
+				if k != "" {
+					l += `,result="` + k + `"`
+				}
+				fmt.Fprintf(&b, "%s{%s} %s\n", m.name, l, strconv.FormatFloat(vals[k], 'f', -1, 64))
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Escape a label value for the prometheus text format.
+func escapeMetricLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTaskMetricsExposition(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	builtin, _ := getTaskDefinitions(db, db)
+	core := []string{"cleanup_tokens", "cleanup_images", "generate_list_previews"}
+	tfs := map[string]TaskFunc{}
+	for _, id := range core {
+		tfs[id] = builtin[id]
+	}
+	useTestScheduler(t, tfs)
+	useTestTaskTriggers(t)
+	r, token := newTestTaskRouter(t, db)
+
+	if w := doTestRequest(t, r, http.MethodGet, "/api/task/metrics", "Bearer secret", nil); w.Code != http.StatusForbidden {
+		t.Errorf("got %d with no secret configured, want 403", w.Code)
+	}
+	Config.TASK_METRICS_SECRET = "secret"
+	// Scrapers don't have a user, admin tokens aren't accepted.
+	if w := doTestRequest(t, r, http.MethodGet, "/api/task/metrics", token, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("got %d with an admin token, want 401", w.Code)
+	}
+	if w := doTestRequest(t, r, http.MethodGet, "/api/task/metrics", "Bearer wrong", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("got %d with the wrong secret, want 401", w.Code)
+	}
+	w := doTestRequest(t, r, http.MethodGet, "/api/task/metrics", "Bearer secret", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d getting metrics, want 200: %s", w.Code, w.Body)
+	}
+	body := w.Body.String()
+	names := []string{
+		"watcharr_task_runs_total",
+		"watcharr_task_slow_runs_total",
+		"watcharr_task_consecutive_failures",
+		"watcharr_task_last_run_timestamp_seconds",
+		"watcharr_task_last_duration_seconds",
+		"watcharr_task_running",
+		"watcharr_task_history_evicted_total",
+		"watcharr_task_disabled",
+	}
+	for _, name := range names {
+		if !strings.Contains(body, "# HELP "+name+" ") || !strings.Contains(body, "# TYPE "+name+" ") {
+			t.Errorf("%s has no help or type line", name)
+		}
+		for _, id := range core {
+			labels := fmt.Sprintf(`{task="%s",origin="builtin",pool="%s"`, id, getTaskPool(id))
+			if name == "watcharr_task_runs_total" {
+				for _, result := range []string{"success", "failed", "skipped", "deferred"} {
+					if l := name + labels + `,result="` + result + `"} `; !strings.Contains(body, l) {
+						t.Errorf("metrics are missing %s", l)
+					}
+				}
+				continue
+			}
+			if l := name + labels + "} "; !strings.Contains(body, l) {
+				t.Errorf("metrics are missing %s", l)
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log/slog"
+	"runtime"
+)
+
+// Highest nice value (lowest priority) a task can be given.
+const taskNiceMax = 19
+
+// Get the nice value configured for a task in TASK_NICE (or TASK_DEFAULTS),
+// limited to 1-19. 0 if not set (or invalid), the task runs at normal priority.
+func getTaskNice(id string) int {
+	taskConfigMu.RLock()
+	nice, ok := Config.TASK_NICE[id]
+	if !ok {
+		nice = Config.TASK_DEFAULTS.Nice
+	}
+	taskConfigMu.RUnlock()
+	if nice <= 0 {
+		return 0
+	}
+	return min(nice, taskNiceMax)
+}
+
+// Run a tasks func with its OS priority lowered to its TASK_NICE.
+// Go can't set the priority of a goroutine, so the func is run on its
+// own OS thread, which is lowered instead. This only covers work done on
+// that goroutine, goroutines it starts (eg. worker pools) and the rest of
+// the server keep their normal priority. Lowering the priority is best
+// effort, if it fails (or isn't supported) the task still runs.
+func runWithTaskNice(id string, f func() error) error {
+	nice := getTaskNice(id)
+	if nice == 0 {
+		return f()
+	}
+	type result struct {
+		err error
+		p   any
+	}
+	done := make(chan result, 1)
+	go func() {
+		// Never unlocked, so the thread is thrown away once this goroutine
+		// exits. Raising its priority again needs privileges we likely
+		// don't have, it must not be reused for anything else.
+		runtime.LockOSThread()
+		var r result
+		defer func() {
+			r.p = recover()
+			done <- r
+		}()
+		if err := setThreadNice(nice); err != nil {
+			slog.Warn("runWithTaskNice: Failed to lower priority, running at normal priority.", "job_name", id, "nice", nice, "error", err)
+		}
+		r.err = f()
+	}()
+	r := <-done
+	if r.p != nil {
+		// Panic on the callers goroutine, like the func was called directly.
+		panic(r.p)
+	}
+	return r.err
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// Per thread priorities are only supported on linux. Setting the
+// priority of the whole process would slow down the rest of the server.
+func setThreadNice(nice int) error {
+	return errors.New("lowering task priority is not supported on this platform")
+}
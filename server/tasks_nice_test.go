@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGetTaskNiceLimits(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_DEFAULTS.Nice = 5
+	Config.TASK_NICE = map[string]int{"test_nice_off": 0, "test_nice_negative": -10, "test_nice_high": 40, "test_nice": 10}
+	for id, want := range map[string]int{
+		"test_nice_default":  5,
+		"test_nice_off":      0,
+		"test_nice_negative": 0,
+		"test_nice_high":     taskNiceMax,
+		"test_nice":          10,
+	} {
+		if got := getTaskNice(id); got != want {
+			t.Errorf("%s has nice %d, want %d", id, got, want)
+		}
+	}
+}
+
+func TestRunWithTaskNice(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_NICE = map[string]int{"test_nice": taskNiceMax}
+	want := errors.New("task failed")
+	for _, id := range []string{"test_nice_unset", "test_nice"} {
+		ran := false
+		err := runWithTaskNice(id, func() error {
+			ran = true
+			return want
+		})
+		if !ran || err != want {
+			t.Errorf("%s ran %v and returned %v, want it ran and returned its error", id, ran, err)
+		}
+	}
+
+	// Panics on the lowered thread reach the caller.
+	defer func() {
+		if p := recover(); p != "task panicked" {
+			t.Errorf("recovered %v, want the tasks panic", p)
+		}
+	}()
+	runWithTaskNice("test_nice", func() error {
+		panic("task panicked")
+	})
+	t.Error("panic in a lowered task wasn't passed on")
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Progress of a `runParallel` call.
+type ParallelProgress struct {
+	// Items finished, including failed ones.
+	Done   int
+	Failed int
+	Total  int
+}
+
+// Run `fn` on each item, with at most `workers` running at once, for
+// tasks that process many independent items. Errors from all items are
+// joined together, a failing item doesn't stop the rest.
+// Once `ctx` is done no more items are started (those already running are
+// waited on) and its error is included in the returned error.
+// If set, `onProgress` is called after each item finishes, never at
+// the same time as itself.
+func runParallel[T any](ctx context.Context, items []T, workers int, fn func(context.Context, T) error, onProgress func(ParallelProgress)) (ParallelProgress, error) {
+	workers = max(min(workers, len(items)), 1)
+	var (
+		p    = ParallelProgress{Total: len(items)}
+		errs []error
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+	)
+	queue := make(chan T)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range queue {
+				err := fn(ctx, v)
+				mu.Lock()
+				p.Done++
+				if err != nil {
+					p.Failed++
+					errs = append(errs, err)
+				}
+				if onProgress != nil {
+					onProgress(p)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, v := range items {
+		// Checked first, so a done ctx never starts another item.
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case queue <- v:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return p, errors.Join(errs...)
+}
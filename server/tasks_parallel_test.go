@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRunParallelJoinsErrors(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5, 6}
+	var ran atomic.Int32
+	p, err := runParallel(context.Background(), items, 3, func(_ context.Context, v int) error {
+		ran.Add(1)
+		if v%2 == 0 {
+			return fmt.Errorf("item %d failed", v)
+		}
+		return nil
+	}, nil)
+	if ran.Load() != 6 {
+		t.Errorf("ran %d items, want all 6 (failures don't stop the rest)", ran.Load())
+	}
+	if p.Done != 6 || p.Failed != 3 || p.Total != 6 {
+		t.Errorf("got progress %+v, want 6 done with 3 failed", p)
+	}
+	for _, want := range []string{"item 2 failed", "item 4 failed", "item 6 failed"} {
+		// errors.Join puts each error on its own line.
+		if err == nil || !slices.Contains(strings.Split(err.Error(), "\n"), want) {
+			t.Errorf("error %v is missing %q", err, want)
+		}
+	}
+}
+
+func TestRunParallelProgress(t *testing.T) {
+	items := make([]int, 50)
+	var (
+		calls    int
+		lastDone int
+		inside   atomic.Int32
+	)
+	_, err := runParallel(context.Background(), items, 8, func(_ context.Context, _ int) error {
+		return nil
+	}, func(p ParallelProgress) {
+		if inside.Add(1) != 1 {
+			t.Error("progress called at the same time as itself")
+		}
+		calls++
+		if p.Done != lastDone+1 || p.Total != 50 {
+			t.Errorf("got progress %+v after %d done", p, lastDone)
+		}
+		lastDone = p.Done
+		inside.Add(-1)
+	})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if calls != 50 {
+		t.Errorf("progress called %d times, want once per item", calls)
+	}
+}
+
+func TestRunParallelStopsWhenCancelled(t *testing.T) {
+	items := make([]int, 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	var ran atomic.Int32
+	p, err := runParallel(ctx, items, 2, func(_ context.Context, _ int) error {
+		if ran.Add(1) == 5 {
+			cancel()
+		}
+		return nil
+	}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want it to include the cancel", err)
+	}
+	// Items already handed to a worker still finish.
+	if n := ran.Load(); n < 5 || n > 7 {
+		t.Errorf("ran %d items after cancelling at 5, want about 5", n)
+	}
+	if p.Done != int(ran.Load()) {
+		t.Errorf("progress has %d done, want %d", p.Done, ran.Load())
+	}
+}
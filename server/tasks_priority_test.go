@@ -0,0 +1,43 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTaskPriorityAdmitsCleanupTokensFirst(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_CONCURRENCY = 1
+	Config.TASK_PRIORITY = map[string]int{"cleanup_tokens": 5}
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_priority_holder": {name: "Holder", f: func() error { return nil }, dd: time.Hour},
+		"test_priority_a":      {name: "A", f: func() error { return nil }, dd: time.Hour},
+		"test_priority_b":      {name: "B", f: func() error { return nil }, dd: time.Hour},
+		"cleanup_tokens":       {name: "Cleanup Tokens", f: func() error { return nil }, dd: time.Hour},
+	})
+	pool, _ := acquireTaskSlot("test_priority_holder")
+	admitted := make(chan string, 3)
+	// Cleanup tokens arrives last, but is preferred over the earlier waiters.
+	for i, id := range []string{"test_priority_a", "test_priority_b", "cleanup_tokens"} {
+		go func() {
+			p, _ := acquireTaskSlot(id)
+			admitted <- id
+			releaseTaskSlot(p)
+		}()
+		waitFor(t, id+" to wait for a slot", func() bool {
+			taskSlotsMu.Lock()
+			defer taskSlotsMu.Unlock()
+			return len(taskSlotPools[TASK_POOL_LIGHT].waiting) == i+1
+		})
+	}
+	releaseTaskSlot(pool)
+	var order []string
+	for range 3 {
+		order = append(order, <-admitted)
+	}
+	// Equal priorities are admitted in the order they arrived.
+	if want := []string{"cleanup_tokens", "test_priority_a", "test_priority_b"}; !slices.Equal(order, want) {
+		t.Errorf("admitted %v, want %v", order, want)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+const taskIdRetryTaskProbes = "retry_task_probes"
+
+// Longest a warmup probe can take before it counts as failed. Probes run
+// at startup, one that hangs mustn't hold up the server.
+var taskProbeTimeout = 10 * time.Second
+
+// A task held back from the scheduler because its warmup probe failed.
+type TaskProbeStatus struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Error from the last time the probe ran.
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	LastTry  time.Time `json:"lastTry"`
+}
+
+type pendingTaskProbe struct {
+	tf     TaskFunc
+	status TaskProbeStatus
+}
+
+var (
+	// Tasks waiting for their probe to pass, by id.
+	pendingTaskProbes   = map[string]*pendingTaskProbe{}
+	pendingTaskProbesMu sync.Mutex
+)
+
+// Run the warmup probe of `tf`, failing if it takes longer than
+// taskProbeTimeout. A probe that times out is left to finish on its own.
+func runTaskProbe(tf TaskFunc) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- tf.probe()
+	}()
+	timer := time.NewTimer(taskProbeTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return errors.New("probe timed out")
+	}
+}
+
+// Run the warmup probes of `tasks` at the same time, so startup waits
+// for the slowest probe rather than all of them.
+// Returns the probe error of each task whose probe failed.
+func runTaskProbes(tasks map[string]TaskFunc) map[string]error {
+	var (
+		failed   = map[string]error{}
+		failedMu sync.Mutex
+		wg       sync.WaitGroup
+	)
+	for id, tf := range tasks {
+		if tf.probe == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(id string, tf TaskFunc) {
+			defer wg.Done()
+			if err := runTaskProbe(tf); err != nil {
+				failedMu.Lock()
+				failed[id] = err
+				failedMu.Unlock()
+			}
+		}(id, tf)
+	}
+	wg.Wait()
+	return failed
+}
+
+// Run the warmup probes of `tasks`. Tasks whose probe fails are held
+// back (instead of being scheduled to fail every run) until Retry Task
+// Probes sees them pass. Returns the ids of the tasks held back.
+func probeTasks(tasks map[string]TaskFunc) map[string]bool {
+	heldBack := map[string]bool{}
+	for id, err := range runTaskProbes(tasks) {
+		slog.Warn("probeTasks: Warmup probe failed, task won't be scheduled until it passes.", "job_name", id, "error", err)
+		holdBackTask(id, tasks[id], err, 1)
+		heldBack[id] = true
+	}
+	return heldBack
+}
+
+// Hold back task `id` until its probe passes, see `probeTasks`.
+func holdBackTask(id string, tf TaskFunc, err error, attempts int) {
+	pendingTaskProbesMu.Lock()
+	defer pendingTaskProbesMu.Unlock()
+	pendingTaskProbes[id] = &pendingTaskProbe{
+		tf: tf,
+		status: TaskProbeStatus{
+			ID:       id,
+			Name:     tf.name,
+			Error:    err.Error(),
+			Attempts: attempts,
+			LastTry:  taskClock.Now(),
+		},
+	}
+}
+
+// If any tasks are waiting for their probe to pass.
+func hasPendingTaskProbes() bool {
+	pendingTaskProbesMu.Lock()
+	defer pendingTaskProbesMu.Unlock()
+	return len(pendingTaskProbes) > 0
+}
+
+// Probe tasks that were held back again, registering those that pass.
+// Tasks still failing stay held back, that isn't an error of this task.
+func retryTaskProbes() error {
+	pendingTaskProbesMu.Lock()
+	pending := make(map[string]*pendingTaskProbe, len(pendingTaskProbes))
+	for k, v := range pendingTaskProbes {
+		pending[k] = v
+	}
+	pendingTaskProbesMu.Unlock()
+	tasks := make(map[string]TaskFunc, len(pending))
+	for id, p := range pending {
+		tasks[id] = p.tf
+	}
+	// Probed without holding the lock, they can be slow.
+	failed := runTaskProbes(tasks)
+	registered := 0
+	for id, p := range pending {
+		err := failed[id]
+		pendingTaskProbesMu.Lock()
+		p.status.Attempts++
+		p.status.LastTry = taskClock.Now()
+		if err != nil {
+			p.status.Error = err.Error()
+			pendingTaskProbesMu.Unlock()
+			slog.Debug("retryTaskProbes: Warmup probe still failing.", "job_name", id, "attempts", p.status.Attempts, "error", err)
+			continue
+		}
+		delete(pendingTaskProbes, id)
+		pendingTaskProbesMu.Unlock()
+		if err := registerTask(id, p.tf); err != nil {
+			// Held back again, so it is retried next run rather than lost.
+			slog.Error("retryTaskProbes: Warmup probe passed, but failed to register task.", "job_name", id, "error", err)
+			holdBackTask(id, p.tf, err, p.status.Attempts)
+			continue
+		}
+		slog.Info("retryTaskProbes: Warmup probe passed, task scheduled.", "job_name", id, "attempts", p.status.Attempts)
+		registered++
+	}
+	setTaskSummary(taskIdRetryTaskProbes, map[string]any{
+		"probed":     len(pending),
+		"registered": registered,
+		"waiting":    len(getPendingTaskProbes()),
+	})
+	return nil
+}
+
+// Get tasks waiting for their probe to pass, sorted by id.
+func getPendingTaskProbes() []TaskProbeStatus {
+	pendingTaskProbesMu.Lock()
+	defer pendingTaskProbesMu.Unlock()
+	resp := make([]TaskProbeStatus, 0, len(pendingTaskProbes))
+	for _, p := range pendingTaskProbes {
+		resp = append(resp, p.status)
+	}
+	sort.Slice(resp, func(i, j int) bool {
+		return resp[i].ID < resp[j].ID
+	})
+	return resp
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Clear held back tasks until the test ends.
+func useTestTaskProbes(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		pendingTaskProbesMu.Lock()
+		pendingTaskProbes = map[string]*pendingTaskProbe{}
+		pendingTaskProbesMu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func isTaskPending(id string) bool {
+	for _, p := range getPendingTaskProbes() {
+		if p.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTaskProbeDefersSchedulingUntilItPasses(t *testing.T) {
+	useTestConfig(t)
+	useTestTaskProbes(t)
+	old := taskProbeTimeout
+	taskProbeTimeout = 50 * time.Millisecond
+	t.Cleanup(func() {
+		taskProbeTimeout = old
+	})
+	useTestScheduler(t, map[string]TaskFunc{})
+	var reachable atomic.Bool
+	hang := make(chan struct{})
+	t.Cleanup(func() {
+		close(hang)
+	})
+	noop := func() error { return nil }
+	tasks := map[string]TaskFunc{
+		"test_probe_ok": {name: "Test Probe Ok", f: noop, dd: time.Hour, probe: noop},
+		"test_probe_down": {
+			name: "Test Probe Down",
+			f:    noop,
+			dd:   time.Hour,
+			probe: func() error {
+				if !reachable.Load() {
+					return errors.New("connection refused")
+				}
+				return nil
+			},
+		},
+		"test_probe_hangs": {
+			name: "Test Probe Hangs",
+			f:    noop,
+			dd:   time.Hour,
+			probe: func() error {
+				<-hang
+				return nil
+			},
+		},
+	}
+	start := time.Now()
+	heldBack := probeTasks(tasks)
+	if waited := time.Since(start); waited > time.Second {
+		t.Errorf("probing took %s, want about the probe timeout", waited)
+	}
+	if len(heldBack) != 2 || !heldBack["test_probe_down"] || !heldBack["test_probe_hangs"] {
+		t.Fatalf("held back %v, want the down and hanging tasks", heldBack)
+	}
+	for id, tf := range tasks {
+		if !heldBack[id] {
+			if err := registerTask(id, tf); err != nil {
+				t.Fatalf("failed to register %s: %v", id, err)
+			}
+		}
+	}
+	if getTask("test_probe_down") != nil {
+		t.Fatal("task was scheduled while its probe fails")
+	}
+
+	// Still down, stays held back.
+	if err := retryTaskProbes(); err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+	if getTask("test_probe_down") != nil || !isTaskPending("test_probe_down") {
+		t.Fatal("task was scheduled while its probe still fails")
+	}
+
+	reachable.Store(true)
+	if err := retryTaskProbes(); err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+	if getTask("test_probe_down") == nil {
+		t.Error("task wasn't scheduled once its probe passed")
+	}
+	if isTaskPending("test_probe_down") {
+		t.Error("task still held back once its probe passed")
+	}
+	if !isTaskPending("test_probe_hangs") {
+		t.Error("hanging task isn't held back anymore")
+	}
+}
+
+func TestTaskProbeKeptPendingWhenRegisterFails(t *testing.T) {
+	useTestConfig(t)
+	useTestTaskProbes(t)
+	noop := func() error { return nil }
+	tf := TaskFunc{name: "Test Probe Taken", f: noop, dd: time.Hour, probe: noop}
+	// Something else already has the id, so registering fails.
+	useTestScheduler(t, map[string]TaskFunc{"test_probe_taken": tf})
+	holdBackTask("test_probe_taken", tf, errors.New("connection refused"), 1)
+	if err := retryTaskProbes(); err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+	ps := getPendingTaskProbes()
+	if len(ps) != 1 || ps[0].ID != "test_probe_taken" {
+		t.Fatalf("got pending %+v, want the task that failed to register", ps)
+	}
+	if ps[0].Attempts != 2 || ps[0].Error != "task already exists" {
+		t.Errorf("got pending %+v, want 2 attempts with the register error", ps[0])
+	}
+}
@@ -0,0 +1,181 @@
+// Database backed queue, for one off units of work that are event driven
+// rather than periodic (eg. retrying a failed image download).
+// Work is enqueued from anywhere, then processed by the Process Queue task.
+// Being stored in the db means queued work survives restarts.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type QueuedTaskStatus string
+
+var (
+	QUEUED_PENDING QueuedTaskStatus = "PENDING"
+	QUEUED_RUNNING QueuedTaskStatus = "RUNNING"
+	QUEUED_DONE    QueuedTaskStatus = "DONE"
+	QUEUED_FAILED  QueuedTaskStatus = "FAILED"
+)
+
+const (
+	// Attempts before a queued task is marked as failed.
+	queuedTaskMaxAttempts = 5
+	// Max queued tasks processed per run.
+	queuedTaskBatchSize = 50
+	// How long finished queued tasks are kept before being removed.
+	queuedTaskDoneMaxAge = 24 * time.Hour
+)
+
+type QueuedTask struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Type of work, decides which handler processes it.
+	Type   string           `gorm:"not null" json:"type"`
+	Status QueuedTaskStatus `gorm:"index;not null" json:"status"`
+	// Json data for the handler.
+	Payload   string `json:"payload"`
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"lastError,omitempty"`
+	// Won't be processed before this time, used to back off retries.
+	RunAfter time.Time `gorm:"index" json:"runAfter"`
+}
+
+// Processes a queued tasks payload.
+type QueueHandler func(db *gorm.DB, payload string) error
+
+// Handlers for each type of queued work.
+var queueHandlers = map[string]QueueHandler{
+	"download_poster": func(db *gorm.DB, payload string) error {
+		var p struct {
+			PosterPath string `json:"posterPath"`
+		}
+		if err := json.Unmarshal([]byte(payload), &p); err != nil {
+			return err
+		}
+		return downloadPosterFor("process_queue", p.PosterPath, false)
+	},
+}
+
+// Add work to the queue.
+func enqueueTask(db *gorm.DB, t string, payload any) error {
+	if _, ok := queueHandlers[t]; !ok {
+		return errors.New("no handler for queued task type")
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	res := db.Create(&QueuedTask{
+		Type:     t,
+		Status:   QUEUED_PENDING,
+		Payload:  string(b),
+		RunAfter: taskClock.Now(),
+	})
+	if res.Error != nil {
+		slog.Error("enqueueTask: Failed to add to queue", "type", t, "error", res.Error)
+		return errors.New("failed to add to queue")
+	}
+	return nil
+}
+
+// Claim a queued task, so no other run processes it.
+// Returns false if it was already claimed.
+func claimQueuedTask(db *gorm.DB, id uint) (bool, error) {
+	res := db.Model(&QueuedTask{}).
+		Where("id = ? AND status = ?", id, QUEUED_PENDING).
+		Update("status", QUEUED_RUNNING)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// Complete a claimed queued task.
+// On error it is retried later with backoff, until out of attempts.
+func completeQueuedTask(db *gorm.DB, qt QueuedTask, runErr error) error {
+	if runErr == nil {
+		// Map used so the error of a failed attempt is cleared.
+		return db.Model(&qt).Updates(map[string]any{"status": QUEUED_DONE, "last_error": ""}).Error
+	}
+	qt.Attempts++
+	u := map[string]any{
+		"attempts":   qt.Attempts,
+		"last_error": runErr.Error(),
+		"status":     QUEUED_PENDING,
+		// 1m, 2m, 4m, 8m..
+		"run_after": taskClock.Now().Add(time.Minute * time.Duration(1<<(qt.Attempts-1))),
+	}
+	if qt.Attempts >= queuedTaskMaxAttempts {
+		u["status"] = QUEUED_FAILED
+	}
+	return db.Model(&qt).Updates(u).Error
+}
+
+// Reset queued tasks left running (eg. server stopped mid run),
+// so they are picked up again.
+func resetRunningQueuedTasks(db *gorm.DB) {
+	res := db.Model(&QueuedTask{}).Where("status = ?", QUEUED_RUNNING).Update("status", QUEUED_PENDING)
+	if res.Error != nil {
+		slog.Error("resetRunningQueuedTasks: Failed to reset queued tasks", "error", res.Error)
+		return
+	}
+	if res.RowsAffected > 0 {
+		slog.Info("resetRunningQueuedTasks: Reset queued tasks left running.", "amount", res.RowsAffected)
+	}
+}
+
+// Process due queued tasks.
+func processQueue(db *gorm.DB) error {
+	res := db.Where("status = ? AND updated_at < ?", QUEUED_DONE, taskClock.Now().Add(-queuedTaskDoneMaxAge)).Delete(&QueuedTask{})
+	if res.Error != nil {
+		slog.Error("processQueue: Failed to remove old finished queued tasks", "error", res.Error)
+	}
+	var due []QueuedTask
+	res = db.Where("status = ? AND run_after <= ?", QUEUED_PENDING, taskClock.Now()).
+		Order("run_after ASC").
+		Limit(queuedTaskBatchSize).
+		Find(&due)
+	if res.Error != nil {
+		slog.Error("processQueue: Failed to get due queued tasks", "error", res.Error)
+		return errors.New("failed to get due queued tasks")
+	}
+	failed := 0
+	for _, v := range due {
+		ok, err := claimQueuedTask(db, v.ID)
+		if err != nil {
+			slog.Error("processQueue: Failed to claim queued task", "id", v.ID, "error", err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		h, ok := queueHandlers[v.Type]
+		if !ok {
+			err = errors.New("no handler for queued task type")
+		} else {
+			err = h(db, v.Payload)
+		}
+		if err != nil {
+			slog.Error("processQueue: Queued task failed", "id", v.ID, "type", v.Type, "attempt", v.Attempts+1, "error", err)
+			failed++
+		}
+		if err := completeQueuedTask(db, v, err); err != nil {
+			slog.Error("processQueue: Failed to complete queued task", "id", v.ID, "error", err)
+		}
+	}
+	if len(due) > 0 {
+		slog.Debug("processQueue: Processed queued tasks.", "amount", len(due), "failed", failed)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d queued tasks failed", failed, len(due))
+	}
+	return nil
+}
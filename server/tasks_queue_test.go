@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestQueuedTaskRetriedAfterFailing(t *testing.T) {
+	clock := useFakeTaskClock(t, time.Now())
+	db := newTestDb(t)
+	fails := 1
+	queueHandlers["test_flaky"] = func(db *gorm.DB, payload string) error {
+		if fails > 0 {
+			fails--
+			return errors.New("tmdb unreachable")
+		}
+		return nil
+	}
+	t.Cleanup(func() {
+		delete(queueHandlers, "test_flaky")
+	})
+	if err := enqueueTask(db, "test_flaky", map[string]string{"posterPath": "/p.jpg"}); err != nil {
+		t.Fatalf("failed to enqueue: %v", err)
+	}
+	if err := enqueueTask(db, "test_no_handler", nil); err == nil {
+		t.Error("enqueued a type with no handler")
+	}
+
+	if err := processQueue(db); err == nil {
+		t.Fatal("failing queued task didn't fail the run")
+	}
+	var qt QueuedTask
+	db.Take(&qt)
+	if qt.Status != QUEUED_PENDING || qt.Attempts != 1 || qt.LastError != "tmdb unreachable" {
+		t.Fatalf("got %+v after failing, want pending with 1 attempt and its error", qt)
+	}
+	// Backing off, not retried yet.
+	if ok, _ := claimQueuedTask(db, qt.ID); !ok {
+		t.Fatal("failed to claim pending queued task")
+	}
+	if ok, _ := claimQueuedTask(db, qt.ID); ok {
+		t.Fatal("claimed a queued task twice")
+	}
+	resetRunningQueuedTasks(db)
+	if err := processQueue(db); err != nil {
+		t.Fatalf("processed queued task before its backoff ended: %v", err)
+	}
+	if fails != 0 {
+		t.Fatal("handler ran before the backoff ended")
+	}
+
+	clock.Advance(time.Minute)
+	if err := processQueue(db); err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+	db.Take(&qt)
+	if qt.Status != QUEUED_DONE || qt.LastError != "" {
+		t.Errorf("got %+v after retrying, want done with the error cleared", qt)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+type TaskQuietHours struct {
+	// Start of quiet hours, in 24h `HH:MM` format (eg. "18:00").
+	Start string `json:",omitempty"`
+	// End of quiet hours, in 24h `HH:MM` format (eg. "22:00").
+	// Can be before Start for windows that go past midnight.
+	End string `json:",omitempty"`
+}
+
+// Get start and end of quiet hours as minutes into the day.
+func (q TaskQuietHours) minutes() (int, int, error) {
+	s, e, err := parseDayWindow(q.Start, q.End)
+	if err != nil {
+		return 0, 0, fmt.Errorf("quiet hours: %w", err)
+	}
+	return s, e, nil
+}
+
+// Get the configured quiet hours.
+func getTaskQuietHours() TaskQuietHours {
+	taskConfigMu.RLock()
+	defer taskConfigMu.RUnlock()
+	return Config.TASK_QUIET_HOURS
+}
+
+// If `t` falls inside the configured quiet hours window.
+// Always false if quiet hours aren't configured (or are invalid).
+func inTaskQuietHours(t time.Time) bool {
+	q := getTaskQuietHours()
+	if q.Start == "" || q.End == "" {
+		return false
+	}
+	start, end, err := q.minutes()
+	if err != nil {
+		slog.Error("inTaskQuietHours: Quiet hours config is invalid, ignoring.", "error", err)
+		return false
+	}
+	return inDayWindow(t, start, end)
+}
+
+// Parse the 24h `HH:MM` start and end of a window
+// of the day, into minutes into the day.
+func parseDayWindow(start string, end string) (int, int, error) {
+	s, err := time.Parse("15:04", start)
+	if err != nil {
+		return 0, 0, errors.New("invalid start")
+	}
+	e, err := time.Parse("15:04", end)
+	if err != nil {
+		return 0, 0, errors.New("invalid end")
+	}
+	return s.Hour()*60 + s.Minute(), e.Hour()*60 + e.Minute(), nil
+}
+
+// If `t` falls between `start` and `end` (minutes into the day).
+// `end` can be before `start` for windows that go past midnight.
+func inDayWindow(t time.Time, start int, end int) bool {
+	// Scheduler runs in local time, so windows do too.
+	t = t.In(time.Local)
+	m := t.Hour()*60 + t.Minute()
+	if start <= end {
+		return m >= start && m < end
+	}
+	// Window goes past midnight.
+	return m >= start || m < end
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTaskQuietHoursSkipRunsPastMidnight(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_QUIET_HOURS = TaskQuietHours{Start: "23:00", End: "06:00"}
+	clock := useFakeTaskClock(t, time.Date(2024, 3, 1, 22, 30, 0, 0, time.Local))
+	runs := 0
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_quiet": {
+			name: "Test Quiet",
+			f: func() error {
+				runs++
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+
+	for _, step := range []struct {
+		advance time.Duration
+		want    TaskRunResult
+	}{
+		// 22:30, before quiet hours.
+		{0, TASK_RUN_SUCCESS},
+		// 23:00, they start.
+		{30 * time.Minute, TASK_RUN_SKIPPED},
+		// 02:00 the next day, still in them.
+		{3 * time.Hour, TASK_RUN_SKIPPED},
+		// 05:59, the last quiet minute.
+		{3*time.Hour + 59*time.Minute, TASK_RUN_SKIPPED},
+		// 06:00, they are over.
+		{time.Minute, TASK_RUN_SUCCESS},
+	} {
+		clock.Advance(step.advance)
+		out := runTaskOutcome("test_quiet")
+		if out.Result != step.want {
+			t.Fatalf("run at %s was %s (%s), want %s", clock.Now().Format("15:04"), out.Result, out.Reason, step.want)
+		}
+		if out.Result == TASK_RUN_SKIPPED && out.Reason != "quiet hours" {
+			t.Errorf("run at %s skipped for %q, want quiet hours", clock.Now().Format("15:04"), out.Reason)
+		}
+	}
+	if runs != 2 {
+		t.Errorf("task ran %d times, want 2 (outside quiet hours)", runs)
+	}
+}
+
+func TestTaskQuietHoursChangedWhileRunning(t *testing.T) {
+	useTestConfig(t)
+	clock := useFakeTaskClock(t, time.Date(2024, 3, 1, 12, 30, 0, 0, time.Local))
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_quiet_update": {
+			name: "Test Quiet Update",
+			f: func() error {
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+	if out := runTaskOutcome("test_quiet_update"); out.Result != TASK_RUN_SUCCESS {
+		t.Fatalf("run without quiet hours was %s (%s)", out.Result, out.Reason)
+	}
+
+	quiet := TaskQuietHours{Start: "12:00", End: "13:00"}
+	if _, err := updateTaskSettings(TaskSettingsUpdateRequest{QuietHours: &quiet}); err != nil {
+		t.Fatalf("failed to set quiet hours: %v", err)
+	}
+	if out := runTaskOutcome("test_quiet_update"); out.Result != TASK_RUN_SKIPPED {
+		t.Errorf("run inside the new quiet hours was %s, want skipped", out.Result)
+	}
+	clock.Advance(30 * time.Minute)
+	if out := runTaskOutcome("test_quiet_update"); out.Result != TASK_RUN_SUCCESS {
+		t.Errorf("run when the new quiet hours end was %s (%s), want success", out.Result, out.Reason)
+	}
+}
+
+func TestTaskQuietHoursInSchedulerTimezone(t *testing.T) {
+	useTestConfig(t)
+	oldLocal := time.Local
+	time.Local = time.FixedZone("UTC+5", 5*60*60)
+	t.Cleanup(func() {
+		time.Local = oldLocal
+	})
+	Config.TASK_QUIET_HOURS = TaskQuietHours{Start: "18:00", End: "22:00"}
+	// 12:30 UTC, 17:30 for the scheduler.
+	clock := useFakeTaskClock(t, time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC))
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_quiet_tz": {
+			name: "Test Quiet Tz",
+			f: func() error {
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+
+	for _, step := range []struct {
+		advance time.Duration
+		want    TaskRunResult
+	}{
+		// 17:30 local.
+		{0, TASK_RUN_SUCCESS},
+		// 18:00 local, 13:00 UTC.
+		{30 * time.Minute, TASK_RUN_SKIPPED},
+		// 21:59 local.
+		{3*time.Hour + 59*time.Minute, TASK_RUN_SKIPPED},
+		// 22:00 local, 17:00 UTC.
+		{time.Minute, TASK_RUN_SUCCESS},
+	} {
+		clock.Advance(step.advance)
+		if out := runTaskOutcome("test_quiet_tz"); out.Result != step.want {
+			t.Errorf("run at %s UTC was %s (%s), want %s", clock.Now().UTC().Format("15:04"), out.Result, out.Reason, step.want)
+		}
+	}
+}
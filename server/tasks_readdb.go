@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log/slog"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Set in `setupTasks`, the same as `taskDb` unless TASK_READ_DB is configured.
+var taskReadDb *gorm.DB
+
+// Get the connection read heavy tasks scan with, so their reads don't
+// contend with user facing writes on `db`. This is TASK_READ_DB if it is
+// configured (and can be opened), otherwise it is `db` itself.
+// Read heavy tasks still write (if they do) through `db`.
+func openTaskReadDb(db *gorm.DB) *gorm.DB {
+	if Config.TASK_READ_DB == "" {
+		return db
+	}
+	rdb, err := gorm.Open(sqlite.Open(Config.TASK_READ_DB), &gorm.Config{TranslateError: true})
+	if err != nil {
+		slog.Error("openTaskReadDb: Failed to open read database, falling back to the main database.", "error", err)
+		return db
+	}
+	if err := pingTaskDb(rdb); err != nil {
+		slog.Error("openTaskReadDb: Read database is unavailable, falling back to the main database.", "error", err)
+		if sqlDb, err := rdb.DB(); err == nil {
+			sqlDb.Close()
+		}
+		return db
+	}
+	slog.Info("openTaskReadDb: Read heavy tasks will read from the read database.")
+	return rdb
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"path"
+	"testing"
+)
+
+func TestReadHeavyTasksUseReadDb(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	if rdb := openTaskReadDb(db); rdb != db {
+		t.Error("got a separate read database without TASK_READ_DB")
+	}
+	Config.TASK_READ_DB = path.Join(t.TempDir(), "missing", "read.db")
+	if rdb := openTaskReadDb(db); rdb != db {
+		t.Error("didn't fall back to the main database when the read database can't be opened")
+	}
+
+	Config.TASK_READ_DB = path.Join(t.TempDir(), "read.db")
+	rdb := openTaskReadDb(db)
+	if rdb == db {
+		t.Fatal("read database wasn't opened with TASK_READ_DB")
+	}
+	t.Cleanup(func() {
+		if sqlDb, err := rdb.DB(); err == nil {
+			sqlDb.Close()
+		}
+	})
+	if err := rdb.AutoMigrate(dbModels...); err != nil {
+		t.Fatalf("failed to migrate read database: %v", err)
+	}
+	// Lists only exist in the read database.
+	a := User{Username: "alice"}
+	rdb.Create(&a)
+	b := User{Username: "bob"}
+	rdb.Create(&b)
+	shared, extra := 1, 2
+	rdb.Create(&Watched{UserID: a.ID, ContentID: &shared, Status: FINISHED})
+	rdb.Create(&Watched{UserID: b.ID, ContentID: &shared, Status: FINISHED})
+	rdb.Create(&Watched{UserID: b.ID, ContentID: &extra, Status: FINISHED})
+
+	_, features := getTaskDefinitions(db, rdb)
+	if err := features["compute_recommendations"].task.f(); err != nil {
+		t.Fatalf("compute failed: %v", err)
+	}
+	var stored, inRead int64
+	db.Model(&UserRecommendation{}).Where("user_id = ? AND content_id = ?", a.ID, extra).Count(&stored)
+	rdb.Model(&UserRecommendation{}).Count(&inRead)
+	if stored != 1 || inRead != 0 {
+		t.Errorf("got %d recommendations in the main database and %d in the read one, want it read from the read database and saved to the main one", stored, inRead)
+	}
+}
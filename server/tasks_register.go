@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+// Built-in task that only exists while the feature it belongs to is enabled.
+type FeatureTask struct {
+	// The task is registered while this returns true.
+	enabled func() bool
+	task    TaskFunc
+}
+
+var (
+	// Feature tasks by id, set in `setupTasks`.
+	featureTasks map[string]FeatureTask
+	// Built-in tasks left unregistered by `setupTasks` because their
+	// `shouldRun` was false, by id. Also guarded by `featureTasksMu`.
+	conditionalTasks = map[string]TaskFunc{}
+	featureTasksMu   sync.Mutex
+)
+
+// Keep back tasks in `tfs` that have nothing to do (their `shouldRun`
+// is false) from being registered, until `syncFeatureTasks` finds they
+// have. Tasks in `skip` are left alone. Returns the ids kept back.
+func holdBackConditionalTasks(tfs map[string]TaskFunc, skip map[string]bool) map[string]bool {
+	featureTasksMu.Lock()
+	defer featureTasksMu.Unlock()
+	held := map[string]bool{}
+	for id, tf := range tfs {
+		if skip[id] || tf.shouldRun == nil || tf.shouldRun() {
+			continue
+		}
+		slog.Info("holdBackConditionalTasks: Not registering task, it has nothing to do.", "job_name", id)
+		conditionalTasks[id] = tf
+		held[id] = true
+	}
+	return held
+}
+
+// Add a task to the running scheduler.
+// Tasks without an origin are treated as built-in.
+func registerTask(id string, tf TaskFunc) error {
+	if tf.origin == "" {
+		tf.origin = TASK_ORIGIN_BUILTIN
+	}
+	taskFuncsMu.Lock()
+	if _, ok := taskFuncs[id]; ok {
+		taskFuncsMu.Unlock()
+		return errors.New("task already exists")
+	}
+	taskFuncs[id] = tf
+	taskFuncsMu.Unlock()
+	if err := addTaskToScheduler(id, tf.dd); err != nil {
+		taskFuncsMu.Lock()
+		delete(taskFuncs, id)
+		taskFuncsMu.Unlock()
+		return err
+	}
+	slog.Info("registerTask: Task registered.", "job_name", id, "origin", tf.origin)
+	return nil
+}
+
+// Remove a task from the running scheduler, along with its status,
+// breakers and boost. A run already in progress is left to finish.
+// Its config (schedule, etc) is kept, in case it is registered again.
+func deregisterTask(id string) error {
+	if _, ok := getTaskFunc(id); !ok {
+		return errors.New("no task found")
+	}
+	if _, ok := getTaskBoost(id); ok {
+		unboostTask(id)
+	}
+	// Remove all jobs for this task, including any one time runs.
+	for _, j := range taskScheduler.Jobs() {
+		if j.Name() != id {
+			continue
+		}
+		if err := taskScheduler.RemoveJob(j.ID()); err != nil {
+			slog.Error("deregisterTask: Failed to remove job!", "job_name", id, "error", err)
+			return errors.New("failed to remove job")
+		}
+	}
+	taskFuncsMu.Lock()
+	delete(taskFuncs, id)
+	taskFuncsMu.Unlock()
+	resetTaskStatus(id)
+	resetTaskBreakers(id)
+	slog.Info("deregisterTask: Task deregistered.", "job_name", id)
+	return nil
+}
+
+// Register feature tasks whose feature has been enabled and deregister
+// those whose feature has been disabled. Also registers kept back tasks
+// (see `holdBackConditionalTasks`) that have something to do now.
+// Should be called after any setting that toggles a feature task, or
+// that a tasks `shouldRun` depends on, changes.
+func syncFeatureTasks() {
+	featureTasksMu.Lock()
+	defer featureTasksMu.Unlock()
+	for id, tf := range conditionalTasks {
+		if !tf.shouldRun() {
+			continue
+		}
+		if err := registerTask(id, tf); err != nil {
+			slog.Error("syncFeatureTasks: Failed to register kept back task", "job_name", id, "error", err)
+			continue
+		}
+		delete(conditionalTasks, id)
+	}
+	for id, ft := range featureTasks {
+		_, registered := getTaskFunc(id)
+		enabled := ft.enabled()
+		if enabled && !registered {
+			if err := registerTask(id, ft.task); err != nil {
+				slog.Error("syncFeatureTasks: Failed to register task", "job_name", id, "error", err)
+			}
+		} else if !enabled && registered {
+			if err := deregisterTask(id); err != nil {
+				slog.Error("syncFeatureTasks: Failed to deregister task", "job_name", id, "error", err)
+			}
+		}
+	}
+}
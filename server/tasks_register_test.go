@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestTaskWithNothingToDoNotRegistered(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{})
+	useTestFeatureTasks(t, map[string]FeatureTask{})
+	db := newTestDb(t)
+	builtin, _ := getTaskDefinitions(db, db)
+	tfs := map[string]TaskFunc{
+		taskIdRefreshArrQueues:  builtin[taskIdRefreshArrQueues],
+		taskIdCheckArrDownloads: builtin[taskIdCheckArrDownloads],
+		"cleanup_tokens":        builtin["cleanup_tokens"],
+	}
+	held := holdBackConditionalTasks(tfs, map[string]bool{taskIdCheckArrDownloads: true})
+	if len(held) != 1 || !held[taskIdRefreshArrQueues] {
+		t.Fatalf("kept back %v, want only the arr task not skipped", held)
+	}
+	syncFeatureTasks()
+	if _, ok := getTaskFunc(taskIdRefreshArrQueues); ok {
+		t.Fatal("task registered with no arr servers")
+	}
+
+	// Adding a server gives it something to do.
+	if err := addRadarr(RadarrSettings{ArrSettings: ArrSettings{Name: "test_register", Host: "http://localhost", Key: "key"}}); err != nil {
+		t.Fatalf("failed to add radarr: %v", err)
+	}
+	if _, ok := getTaskFunc(taskIdRefreshArrQueues); !ok {
+		t.Fatal("task not registered once a server was added")
+	}
+	if getTask(taskIdRefreshArrQueues) == nil {
+		t.Error("task registered without a job")
+	}
+	// Only registered once.
+	syncFeatureTasks()
+	featureTasksMu.Lock()
+	n := len(conditionalTasks)
+	featureTasksMu.Unlock()
+	if n != 0 {
+		t.Errorf("%d tasks still kept back", n)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// A report task defined in TASK_REPORTS, runs a SELECT and caches its rows.
+type TaskReport struct {
+	// Task id, must be unique and made of lowercase letters, numbers and `_`.
+	ID string
+	// Display name, the ID if not set.
+	Name string
+	// Seconds between runs, a day if not set.
+	Interval int
+	// A single SELECT (or WITH ... SELECT) statement.
+	Query string
+}
+
+// Cached result of a reports last successful run.
+type TaskReportResult struct {
+	ID    string           `json:"id"`
+	Name  string           `json:"name"`
+	RanAt time.Time        `json:"ranAt"`
+	Rows  []map[string]any `json:"rows"`
+	// Set if there were more rows than `taskReportMaxRows`, the rest are cut off.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Most rows cached per report.
+const taskReportMaxRows = 1000
+
+var (
+	taskReportIdRegex   = regexp.MustCompile(`^[a-z0-9_]+$`)
+	taskReportResults   = map[string]TaskReportResult{}
+	taskReportResultsMu sync.Mutex
+)
+
+// Check a report query is a single read only statement.
+// Only a first line of defence, reports also run with the connection
+// set to query only, so sqlite itself refuses any writes.
+func checkTaskReportQuery(q string) error {
+	q = strings.TrimSuffix(strings.TrimSpace(q), ";")
+	if strings.Contains(stripTaskReportQuoted(q), ";") {
+		return errors.New("report query must be a single statement")
+	}
+	fields := strings.Fields(q)
+	if len(fields) == 0 {
+		return errors.New("report query must be a SELECT statement")
+	}
+	first := strings.ToUpper(fields[0])
+	if first != "SELECT" && first != "WITH" {
+		return errors.New("report query must be a SELECT statement")
+	}
+	return nil
+}
+
+// Remove quoted strings and identifiers from `q`, so a `;` inside one
+// isn't mistaken for the end of the statement. A quote escaped by doubling it
+// just closes and reopens the string, so needs no special handling.
+func stripTaskReportQuoted(q string) string {
+	var (
+		b     strings.Builder
+		quote rune
+	)
+	for _, c := range q {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// Get task funcs for all valid reports in TASK_REPORTS, keyed by id.
+// Invalid reports are logged and left out.
+func getTaskReportFuncs(db *gorm.DB) map[string]TaskFunc {
+	tfs := map[string]TaskFunc{}
+	for _, r := range Config.TASK_REPORTS {
+		if !taskReportIdRegex.MatchString(r.ID) {
+			slog.Error("getTaskReportFuncs: Skipping report, id must be lowercase letters, numbers and `_`.", "id", r.ID)
+			continue
+		}
+		if _, exists := tfs[r.ID]; exists {
+			slog.Error("getTaskReportFuncs: Skipping report, id is used by another report.", "id", r.ID)
+			continue
+		}
+		if err := checkTaskReportQuery(r.Query); err != nil {
+			slog.Error("getTaskReportFuncs: Skipping report, query is not allowed.", "id", r.ID, "error", err)
+			continue
+		}
+		name := r.Name
+		if name == "" {
+			name = r.ID
+		}
+		report := r
+		tf := TaskFunc{
+			name:   name,
+			origin: TASK_ORIGIN_CONFIG,
+			f: func() error {
+				return runTaskReport(db, report)
+			},
+			dd:   24 * time.Hour,
+			pool: TASK_POOL_HEAVY,
+			db:   db,
+		}
+		if r.Interval != 0 {
+			floor, ceiling := getTaskIntervalBounds(tf)
+			if s, bad := clampTaskInterval(r.Interval, floor, ceiling); s > 0 {
+				if bad {
+					slog.Warn("getTaskReportFuncs: Report interval out of range.", "id", r.ID, "from", r.Interval, "to", s)
+				}
+				tf.dd = time.Duration(s) * time.Second
+			}
+		}
+		tfs[r.ID] = tf
+	}
+	return tfs
+}
+
+// Run a reports query in a transaction that is always rolled back, on a
+// connection set to query only, then cache its rows.
+func runTaskReport(db *gorm.DB, r TaskReport) error {
+	if err := checkTaskReportQuery(r.Query); err != nil {
+		return err
+	}
+	tx := db.Begin()
+	if tx.Error != nil {
+		slog.Error("runTaskReport: Failed to start transaction", "id", r.ID, "error", tx.Error)
+		return errors.New("failed to start transaction")
+	}
+	defer tx.Rollback()
+	if err := tx.Exec("PRAGMA query_only = ON").Error; err != nil {
+		slog.Error("runTaskReport: Failed to make connection query only", "id", r.ID, "error", err)
+		return errors.New("failed to make connection query only")
+	}
+	// The connection goes back to the pool after, it must be writable again.
+	defer tx.Exec("PRAGMA query_only = OFF")
+	rows := []map[string]any{}
+	q := "SELECT * FROM (" + strings.TrimSuffix(strings.TrimSpace(r.Query), ";") + ") LIMIT ?"
+	if err := tx.Raw(q, taskReportMaxRows+1).Scan(&rows).Error; err != nil {
+		slog.Error("runTaskReport: Report query failed", "id", r.ID, "error", err)
+		return fmt.Errorf("report query failed: %w", err)
+	}
+	res := TaskReportResult{ID: r.ID, Name: getTaskDisplayName(r.ID), RanAt: taskClock.Now(), Rows: rows}
+	if len(rows) > taskReportMaxRows {
+		res.Rows = rows[:taskReportMaxRows]
+		res.Truncated = true
+	}
+	// Text columns can come back as bytes, which would be base64 encoded as json.
+	for _, row := range res.Rows {
+		for k, v := range row {
+			if b, ok := v.([]byte); ok {
+				row[k] = string(b)
+			}
+		}
+	}
+	taskReportResultsMu.Lock()
+	taskReportResults[r.ID] = res
+	taskReportResultsMu.Unlock()
+	setTaskSummary(r.ID, map[string]any{"rows": len(res.Rows), "truncated": res.Truncated})
+	return nil
+}
+
+// Get the cached result of a reports last successful run.
+func getTaskReportResult(id string) (TaskReportResult, error) {
+	taskReportResultsMu.Lock()
+	defer taskReportResultsMu.Unlock()
+	res, ok := taskReportResults[id]
+	if !ok {
+		return TaskReportResult{}, errors.New("no report result found")
+	}
+	return res, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+func TestCheckTaskReportQuery(t *testing.T) {
+	for q, ok := range map[string]bool{
+		"SELECT 1":                                 true,
+		"  select 1;  ":                            true,
+		"SELECT\n\tid FROM users":                  true,
+		"WITH x AS (SELECT 1) SELECT * FROM x":     true,
+		"SELECT ';' AS semi":                       true,
+		"SELECT 'it''s; fine', \"a;b\" FROM users": true,
+		"":                            false,
+		"   ":                         false,
+		"DELETE FROM users":           false,
+		"SELECT 1; DELETE FROM users": false,
+		"SELECT 'a'; DELETE FROM users WHERE 'b';": false,
+		"SELECT 'it''s'; DROP TABLE users":         false,
+		"UPDATE users SET username = 'SELECT'":     false,
+	} {
+		if err := checkTaskReportQuery(q); (err == nil) != ok {
+			t.Errorf("query %q allowed %t, want %t (error: %v)", q, err == nil, ok, err)
+		}
+	}
+}
+
+func TestTaskReportCachesRows(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	db.Create(&User{Username: "one"})
+	db.Create(&User{Username: "two"})
+	r := TaskReport{ID: "test_report_users", Query: "SELECT username FROM users ORDER BY username;"}
+	if err := runTaskReport(db, r); err != nil {
+		t.Fatalf("report failed: %v", err)
+	}
+	res, err := getTaskReportResult(r.ID)
+	if err != nil {
+		t.Fatalf("no cached result: %v", err)
+	}
+	if len(res.Rows) != 2 || res.Rows[0]["username"] != "one" || res.Rows[1]["username"] != "two" {
+		t.Errorf("got rows %v, want both users", res.Rows)
+	}
+}
+
+func TestTaskReportRejectsMutatingQuery(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	db.Create(&User{Username: "one"})
+	for _, q := range []string{
+		"DELETE FROM users",
+		"SELECT 1; DELETE FROM users",
+	} {
+		if err := runTaskReport(db, TaskReport{ID: "test_report_mutate", Query: q}); err == nil {
+			t.Errorf("report %q ran", q)
+		}
+	}
+	var n int64
+	db.Model(&User{}).Count(&n)
+	if n != 1 {
+		t.Errorf("users left %d, want 1", n)
+	}
+	// The connection goes back to the pool writable.
+	if err := db.Create(&User{Username: "two"}).Error; err != nil {
+		t.Errorf("failed to write after the report: %v", err)
+	}
+}
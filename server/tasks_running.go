@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// A task run in progress.
+type taskRunState struct {
+	// Unique to each run, so a run that was force unlocked
+	// can't clear the state of a newer run when it finishes.
+	token uint64
+	since time.Time
+	// If this run holds a slot in its tasks pool.
+	slot bool
+	// Pool the slot was taken in.
+	pool TaskPool
+	// If an admin asked for this run to stop, see `cancelTaskRun`.
+	cancelled bool
+	// Done once the run is cancelled or finishes, see `getTaskRunContext`.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Runs going longer than this are considered stuck.
+const taskStuckAfter = time.Hour
+
+var (
+	runningTasks    = map[string]*taskRunState{}
+	runningTasksSeq uint64
+	runningTasksMu  sync.Mutex
+)
+
+// Mark a task as running. Only one run of a task can happen at once,
+// returns false if the task is already running.
+func startTaskRun(id string) (uint64, bool) {
+	return startTaskRunWithTimeout(id, 0)
+}
+
+// Mark a task as running like `startTaskRun`. If `timeout` isn't
+// zero, the runs context is cancelled once it has passed.
+func startTaskRunWithTimeout(id string, timeout time.Duration) (uint64, bool) {
+	runningTasksMu.Lock()
+	defer runningTasksMu.Unlock()
+	if st, ok := runningTasks[id]; ok {
+		if taskSince(st.since) > taskStuckAfter {
+			slog.Warn("startTaskRun: Task has been running for a long time and may be stuck. It can be force unlocked if so.", "job_name", id, "running_since", st.since)
+		}
+		return 0, false
+	}
+	runningTasksSeq++
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	runningTasks[id] = &taskRunState{token: runningTasksSeq, since: taskClock.Now(), ctx: ctx, cancel: cancel}
+	return runningTasksSeq, true
+}
+
+// Record that a run holds a concurrency slot.
+// Returns false if the run was force unlocked, the caller must then release the slot.
+func setTaskRunSlot(id string, token uint64, pool TaskPool) bool {
+	runningTasksMu.Lock()
+	defer runningTasksMu.Unlock()
+	st, ok := runningTasks[id]
+	if !ok || st.token != token {
+		return false
+	}
+	st.slot = true
+	st.pool = pool
+	return true
+}
+
+// Mark a run as finished, releasing its concurrency slot if it has one.
+// Does nothing if the run was force unlocked.
+func finishTaskRun(id string, token uint64) {
+	runningTasksMu.Lock()
+	st, ok := runningTasks[id]
+	if !ok || st.token != token {
+		runningTasksMu.Unlock()
+		return
+	}
+	delete(runningTasks, id)
+	runningTasksMu.Unlock()
+	st.cancel()
+	if st.slot {
+		releaseTaskSlot(st.pool)
+	}
+	checkTaskDrained()
+}
+
+// Get when a task started running, zero if it isn't running.
+func getTaskRunningSince(id string) time.Time {
+	runningTasksMu.Lock()
+	defer runningTasksMu.Unlock()
+	if st, ok := runningTasks[id]; ok {
+		return st.since
+	}
+	return time.Time{}
+}
+
+// Clear a tasks running state so it can run again, for when a run is stuck.
+// The stuck runs context is cancelled, but a run that ignores its context
+// may keep going, and could run at the same time as the next run.
+func forceUnlockTask(id string) error {
+	if _, ok := getTaskFunc(id); !ok {
+		return errors.New("no task found")
+	}
+	runningTasksMu.Lock()
+	st, ok := runningTasks[id]
+	if !ok {
+		runningTasksMu.Unlock()
+		return errors.New("task is not running")
+	}
+	delete(runningTasks, id)
+	runningTasksMu.Unlock()
+	// A stuck run still going that uses its context stops now.
+	st.cancel()
+	if st.slot {
+		releaseTaskSlot(st.pool)
+	}
+	slog.Warn("forceUnlockTask: Task force unlocked! If its stuck run is still going, it may now run at the same time as its next run.", "job_name", id, "running_since", st.since)
+	return nil
+}
+
+// Ask the current run of a task to stop. Only for tasks that are
+// `cancellable`, they check `isTaskRunCancelled` (or the context from
+// `getTaskRunContext`) as they go and stop
+// early (tasks can't be stopped from outside).
+func cancelTaskRun(id string) error {
+	tf, ok := getTaskFunc(id)
+	if !ok {
+		return errors.New("no task found")
+	}
+	if !tf.cancellable {
+		return errors.New("task can't be cancelled")
+	}
+	runningTasksMu.Lock()
+	defer runningTasksMu.Unlock()
+	st, ok := runningTasks[id]
+	if !ok {
+		return errors.New("task is not running")
+	}
+	st.cancelled = true
+	st.cancel()
+	slog.Info("cancelTaskRun: Asked task run to stop.", "job_name", id, "running_since", st.since)
+	return nil
+}
+
+// Get the context of the current run of a task, done once the run is
+// cancelled (see `cancelTaskRun`) or finishes. For tasks handing it to
+// things that take one, eg. `runParallel`. If the task isn't running
+// (eg. its function was called directly) it is never done.
+func getTaskRunContext(id string) context.Context {
+	runningTasksMu.Lock()
+	defer runningTasksMu.Unlock()
+	if st, ok := runningTasks[id]; ok {
+		return st.ctx
+	}
+	return context.Background()
+}
+
+// If the current run of a task has been asked to stop.
+func isTaskRunCancelled(id string) bool {
+	runningTasksMu.Lock()
+	defer runningTasksMu.Unlock()
+	st, ok := runningTasks[id]
+	return ok && st.cancelled
+}
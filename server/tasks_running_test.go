@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestForceUnlockStuckTask(t *testing.T) {
+	useTestConfig(t)
+	clock := useFakeTaskClock(t, time.Now())
+	runs := 0
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_stuck": {
+			name: "Test Stuck",
+			f: func() error {
+				runs++
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+	if err := forceUnlockTask("test_stuck"); err == nil || err.Error() != "task is not running" {
+		t.Errorf("unlocking a task that isn't running got %v, want task is not running", err)
+	}
+	// A run that never finishes.
+	stuck, ok := startTaskRun("test_stuck")
+	if !ok {
+		t.Fatal("failed to start run")
+	}
+	stuckCtx := getTaskRunContext("test_stuck")
+	clock.Advance(taskStuckAfter + time.Minute)
+	if out := runTaskOutcome("test_stuck"); out.Result != TASK_RUN_SKIPPED || out.Reason != "already running" {
+		t.Fatalf("run while stuck was %s (%s), want skipped as already running", out.Result, out.Reason)
+	}
+
+	if err := forceUnlockTask("test_stuck"); err != nil {
+		t.Fatalf("failed to force unlock: %v", err)
+	}
+	if since := getTaskRunningSince("test_stuck"); !since.IsZero() {
+		t.Errorf("still running since %s after force unlock", since)
+	}
+	if stuckCtx.Err() == nil {
+		t.Error("stuck runs context wasn't cancelled")
+	}
+	if out := runTaskOutcome("test_stuck"); out.Result != TASK_RUN_SUCCESS || runs != 1 {
+		t.Fatalf("run after force unlock was %s (%s) with %d runs, want success", out.Result, out.Reason, runs)
+	}
+
+	// The stuck run finishing late doesn't unlock a newer run.
+	token, ok := startTaskRun("test_stuck")
+	if !ok {
+		t.Fatal("failed to start another run")
+	}
+	finishTaskRun("test_stuck", stuck)
+	if getTaskRunningSince("test_stuck").IsZero() {
+		t.Error("stuck run finishing unlocked the newer run")
+	}
+	finishTaskRun("test_stuck", token)
+	if !getTaskRunningSince("test_stuck").IsZero() {
+		t.Error("run is still running after finishing")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Window of the day a task is allowed to run in.
+type TaskWindow struct {
+	// Start of the window, in 24h `HH:MM` format (eg. "18:00").
+	Start string
+	// End of the window, in 24h `HH:MM` format (eg. "23:00").
+	// Can be before Start for windows that go past midnight.
+	End string
+}
+
+// Get start and end of the window as minutes into the day.
+func (w TaskWindow) minutes() (int, int, error) {
+	s, e, err := parseDayWindow(w.Start, w.End)
+	if err != nil {
+		return 0, 0, fmt.Errorf("window: %w", err)
+	}
+	return s, e, nil
+}
+
+// Get the valid windows of a task from TASK_WINDOWS.
+// Invalid windows are left out (they are warned about at startup).
+func getTaskWindows(id string) []TaskWindow {
+	taskConfigMu.RLock()
+	defer taskConfigMu.RUnlock()
+	windows := []TaskWindow{}
+	for _, w := range Config.TASK_WINDOWS[id] {
+		if _, _, err := w.minutes(); err == nil {
+			windows = append(windows, w)
+		}
+	}
+	return windows
+}
+
+// If a task is allowed to run at `t`, because it has no windows
+// (it can always run) or `t` falls inside one of them.
+func inTaskWindow(id string, t time.Time) bool {
+	windows := getTaskWindows(id)
+	if len(windows) == 0 {
+		// A task with only invalid windows can always run.
+		return true
+	}
+	for _, w := range windows {
+		start, end, _ := w.minutes()
+		if inDayWindow(t, start, end) {
+			return true
+		}
+	}
+	return false
+}
+
+// Warn about invalid TASK_WINDOWS at startup, they are ignored.
+func validateTaskWindows(ids map[string]bool) {
+	taskConfigMu.RLock()
+	defer taskConfigMu.RUnlock()
+	for id, windows := range Config.TASK_WINDOWS {
+		if !ids[id] {
+			slog.Warn("validateTaskWindows: Windows set for a task that doesn't exist.", "job_name", id)
+			continue
+		}
+		for _, w := range windows {
+			if _, _, err := w.minutes(); err != nil {
+				slog.Error("validateTaskWindows: Invalid window, ignoring it.", "job_name", id, "window", w, "error", err)
+			} else if w.Start == w.End {
+				slog.Warn("validateTaskWindows: Window starts and ends at the same time, the task will never run in it.", "job_name", id, "window", w)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTaskWindowsPastMidnight(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_WINDOWS = map[string][]TaskWindow{
+		"test_windows": {{Start: "18:00", End: "01:00"}, {Start: "07:00", End: "08:00"}},
+		// Only invalid windows, it can always run.
+		"test_windows_invalid": {{Start: "6pm", End: "23:00"}},
+	}
+	clock := useFakeTaskClock(t, time.Date(2024, 3, 1, 17, 30, 0, 0, time.Local))
+	runs := 0
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_windows": {
+			name: "Test Windows",
+			f: func() error {
+				runs++
+				return nil
+			},
+			dd: time.Hour,
+		},
+		"test_windows_invalid": {
+			name: "Test Windows Invalid",
+			f: func() error {
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+
+	for _, step := range []struct {
+		advance time.Duration
+		want    TaskRunResult
+	}{
+		// 17:30, before the evening window.
+		{0, TASK_RUN_SKIPPED},
+		// 18:00, it opens.
+		{30 * time.Minute, TASK_RUN_SUCCESS},
+		// 23:59.
+		{5*time.Hour + 59*time.Minute, TASK_RUN_SUCCESS},
+		// 00:30 the next day, still in it.
+		{31 * time.Minute, TASK_RUN_SUCCESS},
+		// 01:00, it has closed.
+		{30 * time.Minute, TASK_RUN_SKIPPED},
+		// 06:59, just before the morning window.
+		{5*time.Hour + 59*time.Minute, TASK_RUN_SKIPPED},
+		// 07:30, in the morning window.
+		{31 * time.Minute, TASK_RUN_SUCCESS},
+		// 08:00, past both.
+		{30 * time.Minute, TASK_RUN_SKIPPED},
+	} {
+		clock.Advance(step.advance)
+		out := runTaskOutcome("test_windows")
+		if out.Result != step.want {
+			t.Fatalf("run at %s was %s (%s), want %s", clock.Now().Format("15:04"), out.Result, out.Reason, step.want)
+		}
+		if out.Result == TASK_RUN_SKIPPED && out.Reason != "outside allowed windows" {
+			t.Errorf("run at %s skipped for %q, want outside allowed windows", clock.Now().Format("15:04"), out.Reason)
+		}
+		if out := runTaskOutcome("test_windows_invalid"); out.Result != TASK_RUN_SUCCESS {
+			t.Errorf("run with only invalid windows at %s was %s (%s), want success", clock.Now().Format("15:04"), out.Result, out.Reason)
+		}
+	}
+	if runs != 4 {
+		t.Errorf("task ran %d times, want 4 (inside its windows)", runs)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"maps"
+	"sort"
+	"time"
+)
+
+// Settings that apply to the task scheduler as a whole, rather than one task.
+type TaskSettings struct {
+	// TASK_CONCURRENCY, 0 is unlimited.
+	Concurrency int `json:"concurrency"`
+	// TASK_POOL_CONCURRENCY, per pool overrides of Concurrency.
+	PoolConcurrency map[string]int `json:"poolConcurrency"`
+	// TASK_QUIET_HOURS, empty if not set.
+	QuietHours TaskQuietHours `json:"quietHours"`
+	// TASK_STARTUP_DELAY (seconds), takes effect next startup.
+	StartupDelay int `json:"startupDelay"`
+	// TASK_BREAKER_THRESHOLD, 0 uses the default.
+	BreakerThreshold int `json:"breakerThreshold"`
+	// TASK_BREAKER_COOLDOWN (seconds), 0 uses the default.
+	BreakerCooldown int `json:"breakerCooldown"`
+	// TASK_CLEANUP_IMAGES_WORKERS, 0 uses the default.
+	CleanupImagesWorkers int `json:"cleanupImagesWorkers"`
+	// TASK_MERGE_DUPLICATES
+	MergeDuplicates bool `json:"mergeDuplicates"`
+	// TASK_STALE_WATCHING_REMINDERS, toggling it adds/removes
+	// the Stale Watching Reminders task straight away.
+	StaleWatchingReminders bool `json:"staleWatchingReminders"`
+	// TASK_TELEMETRY, toggling it adds/removes the Send Telemetry
+	// task straight away (if TASK_TELEMETRY_URL is set).
+	Telemetry bool `json:"telemetry"`
+	// Timezone the scheduler (and quiet hours) run in.
+	// This is the servers local timezone, it can't be changed here.
+	Timezone string `json:"timezone"`
+}
+
+// Only included fields are updated.
+type TaskSettingsUpdateRequest struct {
+	Concurrency            *int            `json:"concurrency"`
+	PoolConcurrency        map[string]int  `json:"poolConcurrency"`
+	QuietHours             *TaskQuietHours `json:"quietHours"`
+	StartupDelay           *int            `json:"startupDelay"`
+	BreakerThreshold       *int            `json:"breakerThreshold"`
+	BreakerCooldown        *int            `json:"breakerCooldown"`
+	CleanupImagesWorkers   *int            `json:"cleanupImagesWorkers"`
+	MergeDuplicates        *bool           `json:"mergeDuplicates"`
+	StaleWatchingReminders *bool           `json:"staleWatchingReminders"`
+	Telemetry              *bool           `json:"telemetry"`
+}
+
+func getTaskSettings() TaskSettings {
+	tz, _ := time.Now().Zone()
+	taskConfigMu.RLock()
+	defer taskConfigMu.RUnlock()
+	return TaskSettings{
+		Concurrency:            Config.TASK_CONCURRENCY,
+		PoolConcurrency:        maps.Clone(Config.TASK_POOL_CONCURRENCY),
+		QuietHours:             Config.TASK_QUIET_HOURS,
+		StartupDelay:           Config.TASK_STARTUP_DELAY,
+		BreakerThreshold:       Config.TASK_BREAKER_THRESHOLD,
+		BreakerCooldown:        Config.TASK_BREAKER_COOLDOWN,
+		CleanupImagesWorkers:   Config.TASK_CLEANUP_IMAGES_WORKERS,
+		MergeDuplicates:        Config.TASK_MERGE_DUPLICATES,
+		StaleWatchingReminders: Config.TASK_STALE_WATCHING_REMINDERS,
+		Telemetry:              Config.TASK_TELEMETRY,
+		Timezone:               tz,
+	}
+}
+
+// Validate and save task settings.
+// Nothing is changed if any included setting is invalid.
+func updateTaskSettings(req TaskSettingsUpdateRequest) (TaskSettings, error) {
+	if errs := checkTaskSettingsUpdate(req); len(errs) > 0 {
+		return TaskSettings{}, errs[0]
+	}
+	taskConfigMu.Lock()
+	if req.Concurrency != nil {
+		Config.TASK_CONCURRENCY = *req.Concurrency
+	}
+	if req.PoolConcurrency != nil {
+		Config.TASK_POOL_CONCURRENCY = maps.Clone(req.PoolConcurrency)
+	}
+	if req.QuietHours != nil {
+		Config.TASK_QUIET_HOURS = *req.QuietHours
+	}
+	if req.StartupDelay != nil {
+		Config.TASK_STARTUP_DELAY = *req.StartupDelay
+	}
+	if req.BreakerThreshold != nil {
+		Config.TASK_BREAKER_THRESHOLD = *req.BreakerThreshold
+	}
+	if req.BreakerCooldown != nil {
+		Config.TASK_BREAKER_COOLDOWN = *req.BreakerCooldown
+	}
+	if req.CleanupImagesWorkers != nil {
+		Config.TASK_CLEANUP_IMAGES_WORKERS = *req.CleanupImagesWorkers
+	}
+	if req.MergeDuplicates != nil {
+		Config.TASK_MERGE_DUPLICATES = *req.MergeDuplicates
+	}
+	if req.StaleWatchingReminders != nil {
+		Config.TASK_STALE_WATCHING_REMINDERS = *req.StaleWatchingReminders
+	}
+	if req.Telemetry != nil {
+		Config.TASK_TELEMETRY = *req.Telemetry
+	}
+	taskConfigMu.Unlock()
+	if err := writeConfig(); err != nil {
+		slog.Error("updateTaskSettings: Failed to write updated config to file!", "error", err)
+		return TaskSettings{}, errors.New("failed to write config")
+	}
+	if req.Concurrency != nil || req.PoolConcurrency != nil {
+		wakeTaskSlotWaiters()
+	}
+	syncFeatureTasks()
+	slog.Info("updateTaskSettings: Task settings updated.", "settings", getTaskSettings())
+	return getTaskSettings(), nil
+}
+
+// Check all included settings are valid, returning every problem found.
+func checkTaskSettingsUpdate(req TaskSettingsUpdateRequest) []error {
+	var errs []error
+	nonNegative := []struct {
+		name string
+		v    *int
+	}{
+		{"concurrency", req.Concurrency},
+		{"startupDelay", req.StartupDelay},
+		{"breakerThreshold", req.BreakerThreshold},
+		{"breakerCooldown", req.BreakerCooldown},
+		{"cleanupImagesWorkers", req.CleanupImagesWorkers},
+	}
+	for _, n := range nonNegative {
+		if n.v != nil && *n.v < 0 {
+			errs = append(errs, errors.New(n.name+" can't be negative"))
+		}
+	}
+	// Sorted so the errors come back in the same order every time.
+	pools := make([]string, 0, len(req.PoolConcurrency))
+	for k := range req.PoolConcurrency {
+		pools = append(pools, k)
+	}
+	sort.Strings(pools)
+	for _, k := range pools {
+		v := req.PoolConcurrency[k]
+		if k != string(TASK_POOL_LIGHT) && k != string(TASK_POOL_HEAVY) {
+			errs = append(errs, errors.New("unknown task pool: "+k))
+		} else if v < 0 {
+			errs = append(errs, errors.New("poolConcurrency can't be negative"))
+		}
+	}
+	if req.QuietHours != nil {
+		q := *req.QuietHours
+		// Both empty disables quiet hours.
+		if q.Start != "" || q.End != "" {
+			if _, _, err := q.minutes(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errs
+}
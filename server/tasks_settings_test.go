@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetTaskSettingsHandler(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{})
+	Config.TASK_CONCURRENCY = 3
+	Config.TASK_POOL_CONCURRENCY = map[string]int{"heavy": 1}
+	Config.TASK_STARTUP_DELAY = 30
+	r, token := newTestTaskRouter(t, newTestDb(t))
+
+	if w := doTestRequest(t, r, http.MethodGet, "/api/task/settings", "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("got %d without a token, want 401", w.Code)
+	}
+	w := doTestRequest(t, r, http.MethodGet, "/api/task/settings", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var s TaskSettings
+	if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil {
+		t.Fatalf("failed to decode settings: %v", err)
+	}
+	if s.Concurrency != 3 || s.PoolConcurrency["heavy"] != 1 || s.StartupDelay != 30 || s.Timezone == "" {
+		t.Errorf("got settings %+v, want those in the config", s)
+	}
+
+	// The returned map isn't the configs.
+	getTaskSettings().PoolConcurrency["heavy"] = 5
+	if Config.TASK_POOL_CONCURRENCY["heavy"] != 1 {
+		t.Error("changing the returned settings changed the config")
+	}
+}
+
+func TestUpdateTaskSettingsHandler(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{})
+	Config.TASK_CONCURRENCY = 3
+	r, token := newTestTaskRouter(t, newTestDb(t))
+
+	// Invalid, nothing changes, even the valid settings.
+	w := doTestRequest(t, r, http.MethodPatch, "/api/task/settings", token, map[string]any{
+		"concurrency":     5,
+		"poolConcurrency": map[string]int{"huge": 1},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("got %d for an unknown pool, want 400: %s", w.Code, w.Body)
+	}
+	if w := doTestRequest(t, r, http.MethodPatch, "/api/task/settings", token, map[string]any{
+		"quietHours": map[string]string{"start": "25:00", "end": "06:00"},
+	}); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d for bad quiet hours, want 400", w.Code)
+	}
+	if Config.TASK_CONCURRENCY != 3 || Config.TASK_POOL_CONCURRENCY != nil {
+		t.Fatalf("invalid update changed the config: %d %v", Config.TASK_CONCURRENCY, Config.TASK_POOL_CONCURRENCY)
+	}
+
+	// Validating only reports what would change.
+	w = doTestRequest(t, r, http.MethodPatch, "/api/task/settings?validate=true", token, map[string]any{"concurrency": 5})
+	if w.Code != http.StatusOK || Config.TASK_CONCURRENCY != 3 {
+		t.Fatalf("validating got %d and changed concurrency to %d: %s", w.Code, Config.TASK_CONCURRENCY, w.Body)
+	}
+
+	w = doTestRequest(t, r, http.MethodPatch, "/api/task/settings", token, map[string]any{
+		"concurrency":     5,
+		"poolConcurrency": map[string]int{"heavy": 2},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var s TaskSettings
+	if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil {
+		t.Fatalf("failed to decode settings: %v", err)
+	}
+	if s.Concurrency != 5 || s.PoolConcurrency["heavy"] != 2 {
+		t.Errorf("got settings %+v, want the update", s)
+	}
+	if Config.TASK_CONCURRENCY != 5 || Config.TASK_POOL_CONCURRENCY["heavy"] != 2 {
+		t.Errorf("config wasn't updated: %d %v", Config.TASK_CONCURRENCY, Config.TASK_POOL_CONCURRENCY)
+	}
+	b, err := os.ReadFile(path.Join(DataPath, "watcharr.json"))
+	if err != nil {
+		t.Fatalf("config wasn't written: %v", err)
+	}
+	var saved ServerConfig
+	if err := json.Unmarshal(b, &saved); err != nil || saved.TASK_CONCURRENCY != 5 {
+		t.Errorf("written config has concurrency %d (%v), want 5", saved.TASK_CONCURRENCY, err)
+	}
+}
+
+func TestCheckTaskSettingsUpdateStableOrder(t *testing.T) {
+	req := TaskSettingsUpdateRequest{PoolConcurrency: map[string]int{"zz": 1, "heavy": -1, "aa": 1, "light": -1, "mm": 1}}
+	want := []string{"unknown task pool: aa", "poolConcurrency can't be negative", "poolConcurrency can't be negative", "unknown task pool: mm", "unknown task pool: zz"}
+	for i := 0; i < 20; i++ {
+		errs := checkTaskSettingsUpdate(req)
+		if len(errs) != len(want) {
+			t.Fatalf("got errors %v, want %v", errs, want)
+		}
+		for j, err := range errs {
+			if err.Error() != want[j] {
+				t.Fatalf("got errors %v, want %v", errs, want)
+			}
+		}
+	}
+}
+
+// Settings are changed while a task is running, run with -race.
+func TestUpdateTaskSettingsDuringRun(t *testing.T) {
+	useTestConfig(t)
+	started, done := make(chan struct{}), make(chan struct{})
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_settings_race": {
+			name: "Test Settings Race",
+			f: func() error {
+				close(started)
+				// Keep reading settings until they are done changing.
+				for {
+					select {
+					case <-done:
+						return nil
+					default:
+						getImageWorkers()
+						getBreakerThreshold()
+						getBreakerCooldown()
+						getTaskQuietHours()
+						getTaskStartupDelay()
+						isMergeDuplicatesEnabled()
+						isStaleWatchingRemindersEnabled()
+						isTelemetryEnabled()
+						getTaskEffectiveConfig()
+					}
+				}
+			},
+			dd: time.Hour,
+		},
+	})
+	useTestFeatureTasks(t, map[string]FeatureTask{})
+	r, token := newTestTaskRouter(t, newTestDb(t))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runTask("test_settings_race")
+	}()
+	<-started
+	for i := range 20 {
+		w := doTestRequest(t, r, http.MethodPatch, "/api/task/settings", token, map[string]any{
+			"quietHours":             map[string]string{"start": "03:00", "end": "04:00"},
+			"startupDelay":           i,
+			"breakerThreshold":       i,
+			"breakerCooldown":        i,
+			"cleanupImagesWorkers":   i,
+			"mergeDuplicates":        i%2 == 0,
+			"staleWatchingReminders": i%2 == 0,
+			"telemetry":              i%2 == 0,
+		})
+		if w.Code != http.StatusOK {
+			t.Errorf("got %d: %s", w.Code, w.Body)
+			break
+		}
+	}
+	close(done)
+	wg.Wait()
+}
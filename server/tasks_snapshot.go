@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Version of the snapshot format, bumped when it changes.
+const taskSnapshotVersion = 1
+
+// State of the whole task scheduler at a point in time, for attaching
+// to bug reports. Secrets (keys, hosts, etc) are never included, and
+// any that make it into errors or summaries are redacted.
+type TaskSnapshot struct {
+	Version   int                 `json:"version"`
+	CreatedAt time.Time           `json:"createdAt"`
+	Config    TaskEffectiveConfig `json:"config"`
+	Tasks     []TaskSnapshotTask  `json:"tasks"`
+}
+
+type TaskSnapshotTask struct {
+	AllTasksResponse
+	Settings TaskEffectiveSettings `json:"settings"`
+}
+
+// What restoring a snapshot changed.
+type TaskSnapshotRestoreResult struct {
+	// Tasks whose schedule and stats were restored.
+	Restored []string `json:"restored"`
+	// Tasks in the snapshot that don't exist here (eg. config or report
+	// tasks not configured on this server), they are left out.
+	Missing []string `json:"missing"`
+}
+
+// Restoring overwrites schedules and stats, so is only allowed in dev mode.
+func isTaskSnapshotRestoreAllowed() bool {
+	return os.Getenv("MODE") == "DEV"
+}
+
+// Take a snapshot of the scheduler: every recurring task, its schedule,
+// next run, stats and effective settings.
+func getTaskSnapshot() TaskSnapshot {
+	s := TaskSnapshot{
+		Version:   taskSnapshotVersion,
+		CreatedAt: taskClock.Now(),
+		Config:    getTaskEffectiveConfig(),
+		Tasks:     []TaskSnapshotTask{},
+	}
+	for _, t := range getAllTasks(false, true) {
+		if t.OneTime {
+			continue
+		}
+		tf, ok := getTaskFunc(t.ID)
+		if !ok {
+			continue
+		}
+		t.LastError = redactTaskSnapshotText(t.LastError)
+		if t.Summary != nil {
+			summary := make(map[string]any, len(t.Summary))
+			for k, v := range t.Summary {
+				if str, ok := v.(string); ok {
+					v = redactTaskSnapshotText(str)
+				}
+				summary[k] = v
+			}
+			t.Summary = summary
+		}
+		s.Tasks = append(s.Tasks, TaskSnapshotTask{AllTasksResponse: t, Settings: getTaskEffectiveSettings(t.ID, tf)})
+	}
+	sort.Slice(s.Tasks, func(i, j int) bool {
+		return s.Tasks[i].ID < s.Tasks[j].ID
+	})
+	return s
+}
+
+// Replace any secret from config found in `s`.
+func redactTaskSnapshotText(s string) string {
+	if s == "" {
+		return s
+	}
+	secrets := []string{Config.JWT_SECRET, Config.TMDB_KEY, Config.TASK_TRIGGER_SECRET, Config.TASK_METRICS_SECRET, Config.TASK_TELEMETRY_URL, Config.JELLYFIN_HOST, Config.PLEX_HOST, Config.TRAKT_SYNC.ClientSecret, Config.TWITCH.AccessToken}
+	if Config.TWITCH.ClientSecret != nil {
+		secrets = append(secrets, *Config.TWITCH.ClientSecret)
+	}
+	for _, v := range Config.SONARR {
+		secrets = append(secrets, v.Key, v.Host)
+	}
+	for _, v := range Config.RADARR {
+		secrets = append(secrets, v.Key, v.Host)
+	}
+	for _, v := range secrets {
+		// Short values would redact too much and aren't real secrets.
+		if len(v) >= 4 {
+			s = strings.ReplaceAll(s, v, "[redacted]")
+		}
+	}
+	return s
+}
+
+// Load a snapshot into this server, for reproducing scheduling bugs.
+// Each task in it that exists here is rescheduled (or disabled) to
+// match, and has its stats replaced. Next runs can't be restored, they
+// follow from the restored schedules. Only allowed in dev mode.
+func restoreTaskSnapshot(s TaskSnapshot) (TaskSnapshotRestoreResult, error) {
+	if !isTaskSnapshotRestoreAllowed() {
+		return TaskSnapshotRestoreResult{}, errors.New("restoring snapshots is only allowed in dev mode")
+	}
+	if s.Version != taskSnapshotVersion {
+		return TaskSnapshotRestoreResult{}, errors.New("unsupported snapshot version")
+	}
+	// Check every task first, so a bad one doesn't leave the
+	// scheduler half restored.
+	for _, t := range s.Tasks {
+		if err := checkTaskSnapshotTask(t); err != nil {
+			slog.Warn("restoreTaskSnapshot: Snapshot has an invalid task.", "job_name", t.ID, "error", err)
+			return TaskSnapshotRestoreResult{}, errors.New("invalid snapshot task " + t.ID + ": " + err.Error())
+		}
+	}
+	res := TaskSnapshotRestoreResult{Restored: []string{}, Missing: []string{}}
+	for _, t := range s.Tasks {
+		tf, ok := getTaskFunc(t.ID)
+		if !ok || getTask(t.ID) == nil {
+			res.Missing = append(res.Missing, t.ID)
+			continue
+		}
+		if t.Disabled {
+			if err := setTaskEnabled(t.ID, false); err != nil {
+				slog.Error("restoreTaskSnapshot: Failed to disable task", "job_name", t.ID, "error", err)
+				return res, errors.New("failed to restore task " + t.ID)
+			}
+		} else {
+			cur := getTaskEffectiveSettings(t.ID, tf)
+			// Only rescheduled if it differs, so defaults aren't turned into overrides.
+			if isTaskDisabled(t.ID) || cur.Seconds != t.Seconds || cur.MaxSeconds != t.MaxSeconds {
+				seconds := t.Seconds
+				if err := rescheduleTask(t.ID, TaskRescheduleRequest{Seconds: &seconds, MaxSeconds: t.MaxSeconds}); err != nil {
+					slog.Error("restoreTaskSnapshot: Failed to reschedule task", "job_name", t.ID, "error", err)
+					return res, errors.New("failed to restore task " + t.ID)
+				}
+			}
+		}
+		status := t.TaskStatus
+		taskStatusesMu.Lock()
+		taskStatuses[t.ID] = &status
+		taskStatusesMu.Unlock()
+		res.Restored = append(res.Restored, t.ID)
+	}
+	slog.Info("restoreTaskSnapshot: Snapshot restored.", "created_at", s.CreatedAt, "restored", len(res.Restored), "missing", len(res.Missing))
+	return res, nil
+}
+
+// Check that a task from a snapshot can be restored here. Tasks that
+// don't exist here are fine, they are skipped.
+func checkTaskSnapshotTask(t TaskSnapshotTask) error {
+	tf, ok := getTaskFunc(t.ID)
+	if !ok || getTask(t.ID) == nil || t.Disabled {
+		return nil
+	}
+	seconds := t.Seconds
+	if err := checkTaskReschedule(TaskRescheduleRequest{Seconds: &seconds, MaxSeconds: t.MaxSeconds}); err != nil {
+		return err
+	}
+	return checkTaskMinInterval(t.ID, tf, seconds)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTaskSnapshotRoundTrip(t *testing.T) {
+	useTestConfig(t)
+	t.Setenv("MODE", "DEV")
+	noop := func() error { return nil }
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_snapshot_a": {name: "Test Snapshot A", f: noop, dd: time.Hour},
+		"test_snapshot_b": {name: "Test Snapshot B", f: noop, dd: time.Hour},
+		"test_snapshot_c": {name: "Test Snapshot C", f: noop, dd: time.Hour},
+	})
+	seconds := 600
+	if err := rescheduleTask("test_snapshot_a", TaskRescheduleRequest{Seconds: &seconds, MaxSeconds: 900}); err != nil {
+		t.Fatalf("failed to reschedule: %v", err)
+	}
+	if err := setTaskEnabled("test_snapshot_b", false); err != nil {
+		t.Fatalf("failed to disable: %v", err)
+	}
+	setTaskSummary("test_snapshot_c", map[string]any{"items": 3})
+
+	b, err := json.Marshal(getTaskSnapshot())
+	if err != nil {
+		t.Fatalf("failed to marshal snapshot: %v", err)
+	}
+	var s TaskSnapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		t.Fatalf("failed to unmarshal snapshot: %v", err)
+	}
+	want := snapshotTaskSet(s)
+
+	// Put everything back, then restore.
+	seconds = 3600
+	if err := rescheduleTask("test_snapshot_a", TaskRescheduleRequest{Seconds: &seconds}); err != nil {
+		t.Fatalf("failed to reschedule: %v", err)
+	}
+	if err := setTaskEnabled("test_snapshot_b", true); err != nil {
+		t.Fatalf("failed to enable: %v", err)
+	}
+	setTaskSummary("test_snapshot_c", nil)
+	if got := snapshotTaskSet(getTaskSnapshot()); got == want {
+		t.Fatal("tasks match the snapshot before restoring it")
+	}
+
+	s.Tasks = append(s.Tasks, TaskSnapshotTask{AllTasksResponse: AllTasksResponse{ID: "test_snapshot_gone", Seconds: 60}})
+	res, err := restoreTaskSnapshot(s)
+	if err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+	if len(res.Restored) != 3 || len(res.Missing) != 1 || res.Missing[0] != "test_snapshot_gone" {
+		t.Errorf("got result %+v, want 3 restored and the gone task missing", res)
+	}
+	if got := snapshotTaskSet(getTaskSnapshot()); got != want {
+		t.Errorf("restored tasks\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestTaskSnapshotRestoreInvalidChangesNothing(t *testing.T) {
+	useTestConfig(t)
+	t.Setenv("MODE", "DEV")
+	noop := func() error { return nil }
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_snapshot_ok":    {name: "Test Snapshot Ok", f: noop, dd: time.Hour},
+		"test_snapshot_z_bad": {name: "Test Snapshot Z Bad", f: noop, dd: time.Hour},
+	})
+	s := getTaskSnapshot()
+	before := snapshotTaskSet(s)
+	for i := range s.Tasks {
+		switch s.Tasks[i].ID {
+		case "test_snapshot_ok":
+			s.Tasks[i].Seconds = 600
+		case "test_snapshot_z_bad":
+			s.Tasks[i].Seconds = 600
+			s.Tasks[i].MaxSeconds = 300
+		}
+	}
+	if _, err := restoreTaskSnapshot(s); err == nil {
+		t.Fatal("restored a snapshot with an invalid task")
+	}
+	if got := snapshotTaskSet(getTaskSnapshot()); got != before {
+		t.Errorf("invalid snapshot changed tasks\n%s\nwant\n%s", got, before)
+	}
+}
+
+// The parts of each task a restore should reproduce.
+func snapshotTaskSet(s TaskSnapshot) string {
+	b, _ := json.Marshal(func() []any {
+		ts := []any{}
+		for _, t := range s.Tasks {
+			ts = append(ts, []any{t.ID, t.Seconds, t.MaxSeconds, t.Disabled, t.Summary})
+		}
+		return ts
+	}())
+	return string(b)
+}
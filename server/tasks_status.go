@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Status of a tasks runs, kept in memory so admins can
+// see if any tasks are failing without digging through logs.
+type TaskStatus struct {
+	// When the task last started running.
+	LastRun time.Time `json:"lastRun"`
+	// How long the last run took (milliseconds).
+	LastDurationMs int64 `json:"lastDurationMs"`
+	// Error returned by the last run, empty if it succeeded.
+	LastError string `json:"lastError,omitempty"`
+	// Number of runs in a row that have failed.
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+	// Total number of runs since startup.
+	Runs int `json:"runs"`
+	// Total number of failed runs since startup.
+	Failures int `json:"failures"`
+	// Total number of runs skipped since startup, for any
+	// reason (eg. quiet hours, or the db was unavailable).
+	Skipped int `json:"skipped"`
+	// Why the last skipped run was skipped.
+	LastSkipReason string `json:"lastSkipReason,omitempty"`
+	// Total number of runs deferred since startup, because an import was running.
+	Deferred int `json:"deferred"`
+	// If the last run took longer than the tasks TASK_SLA.
+	LastRunSlow bool `json:"lastRunSlow"`
+	// Total number of runs that took longer than the tasks TASK_SLA.
+	SlowRuns int `json:"slowRuns"`
+	// Figures reported by the last run that set them (eg. amount of
+	// items processed), only for tasks that report any.
+	Summary map[string]any `json:"summary,omitempty"`
+	// When the summary was set.
+	SummaryAt *time.Time `json:"summaryAt,omitempty"`
+}
+
+// Latest summary of a task, for the dashboard.
+type TaskSummary struct {
+	Summary map[string]any `json:"summary"`
+	At      time.Time      `json:"at"`
+}
+
+// A failed task run.
+type TaskError struct {
+	// ID of task that failed.
+	Task string `json:"task"`
+	// When the failed run started.
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+// Max amount of recent errors kept (across all tasks).
+const taskRecentErrorsMax = 100
+
+var (
+	taskStatuses = map[string]*TaskStatus{}
+	// Recent errors from all tasks, oldest first.
+	taskRecentErrors []TaskError
+	taskStatusesMu   sync.Mutex
+)
+
+// Outcome of a call to `runTaskOutcome`.
+type TaskRunOutcome struct {
+	Result TaskRunResult `json:"result"`
+	// Why the run was skipped, or the error it failed with.
+	Reason     string `json:"reason,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// Run a task by id, recording the outcome in its status.
+// All scheduled jobs call this, instead of the task func directly.
+func runTask(id string) {
+	runTaskOutcome(id)
+}
+
+// Run a task by id like `runTask`, cancelling the runs context
+// after `timeout` (if not zero). Used by one time runs.
+func runTaskWithTimeout(id string, timeout time.Duration) {
+	runTaskOutcomeWithTimeout(id, timeout)
+}
+
+// Run a task by id like `runTask`, returning how the run went.
+func runTaskOutcome(id string) TaskRunOutcome {
+	return runTaskOutcomeWithTimeout(id, 0)
+}
+
+// Run a task by id like `runTaskWithTimeout`, returning how the run went.
+func runTaskOutcomeWithTimeout(id string, timeout time.Duration) TaskRunOutcome {
+	tf, ok := getTaskFunc(id)
+	if !ok {
+		slog.Error("runTask: Task does not exist.", "job_name", id)
+		return TaskRunOutcome{Result: TASK_RUN_SKIPPED, Reason: "no task found"}
+	}
+	start := taskClock.Now()
+	skip := func(reason string) TaskRunOutcome {
+		recordTaskSkip(id, reason)
+		publishTaskEvent(TaskEvent{Type: TASK_EVENT_SKIPPED, Task: id, Time: start, Reason: reason})
+		return TaskRunOutcome{Result: TASK_RUN_SKIPPED, Reason: reason}
+	}
+	if isTaskDisabled(id) {
+		slog.Debug("runTask: Skipping run, task is disabled.", "job_name", id)
+		return skip("disabled")
+	}
+	if inTaskQuietHours(start) {
+		slog.Info("runTask: Skipping run, inside quiet hours.", "job_name", id, "quiet_hours", getTaskQuietHours())
+		return skip("quiet hours")
+	}
+	if !inTaskWindow(id, start) {
+		slog.Info("runTask: Skipping run, outside of the tasks allowed windows.", "job_name", id, "windows", getTaskWindows(id))
+		return skip("outside allowed windows")
+	}
+	if isTaskDeferredDuringImport(id) && isTaskImportActive() {
+		slog.Info("runTask: Deferring run, an import is running.", "job_name", id)
+		recordTaskDeferred(id)
+		deferTaskForImport(id)
+		return skip("deferred due to import")
+	}
+	if tf.db != nil {
+		if err := pingTaskDb(tf.db); err != nil {
+			slog.Warn("runTask: Skipping run, database is unavailable.", "job_name", id, "error", err)
+			return skip("database unavailable")
+		}
+	}
+	if tf.shouldRun != nil && !tf.shouldRun() {
+		// Debug only, these would be noisy.
+		slog.Debug("runTask: Skipping run, task has nothing to do.", "job_name", id)
+		return skip("nothing to do")
+	}
+	token, ok := startTaskRunWithTimeout(id, timeout)
+	if !ok {
+		slog.Info("runTask: Skipping run, task is already running.", "job_name", id)
+		return skip("already running")
+	}
+	defer finishTaskRun(id, token)
+	// Checked once marked running, so a drain can't
+	// be reported complete while this run starts.
+	if isTaskDraining() {
+		slog.Info("runTask: Skipping run, tasks are draining.", "job_name", id)
+		return skip("draining")
+	}
+	if pool, ok := acquireTaskSlot(id); ok {
+		if !setTaskRunSlot(id, token, pool) {
+			// Force unlocked while waiting, don't run.
+			releaseTaskSlot(pool)
+			return skip("force unlocked")
+		}
+		if isTaskDraining() {
+			// Started draining while waiting for a slot.
+			slog.Info("runTask: Skipping run, tasks are draining.", "job_name", id)
+			return skip("draining")
+		}
+		// Time spent waiting for a slot doesn't count towards the run.
+		start = taskClock.Now()
+	}
+	publishTaskEvent(TaskEvent{Type: TASK_EVENT_STARTED, Task: id, Time: start})
+	startTaskWorkload(id)
+	err := runWithTaskNice(id, tf.f)
+	dur := taskSince(start)
+	finishTaskWorkload(id)
+	recordTaskRun(id, start, dur, err)
+	if err != nil {
+		checkTaskAutoDisable(id, err)
+	}
+	saveTaskRun(id, start, dur, err)
+	fe := TaskEvent{Type: TASK_EVENT_FINISHED, Task: id, Time: taskClock.Now(), DurationMs: dur.Milliseconds()}
+	out := TaskRunOutcome{Result: TASK_RUN_SUCCESS, DurationMs: dur.Milliseconds()}
+	if err != nil {
+		fe.Error = err.Error()
+		out.Result = TASK_RUN_FAILED
+		out.Reason = err.Error()
+	} else {
+		startTasksAfter(id)
+	}
+	publishTaskEvent(fe)
+	return out
+}
+
+// Max time to wait on the database to respond to a ping.
+const taskDbPingTimeout = 5 * time.Second
+
+// Check the database connection is usable.
+func pingTaskDb(db *gorm.DB) error {
+	sqlDb, err := db.DB()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), taskDbPingTimeout)
+	defer cancel()
+	return sqlDb.PingContext(ctx)
+}
+
+// Record a skipped run of a task, and why it was skipped. Skips don't
+// count as failures, so they don't affect the tasks failure streak.
+func recordTaskSkip(id string, reason string) {
+	taskStatusesMu.Lock()
+	defer taskStatusesMu.Unlock()
+	ts, ok := taskStatuses[id]
+	if !ok {
+		ts = &TaskStatus{}
+		taskStatuses[id] = ts
+	}
+	ts.Skipped++
+	ts.LastSkipReason = reason
+}
+
+// Record the result of a task run.
+func recordTaskRun(id string, start time.Time, dur time.Duration, err error) {
+	taskStatusesMu.Lock()
+	defer taskStatusesMu.Unlock()
+	ts, ok := taskStatuses[id]
+	if !ok {
+		ts = &TaskStatus{}
+		taskStatuses[id] = ts
+	}
+	ts.LastRun = start
+	ts.LastDurationMs = dur.Milliseconds()
+	ts.Runs++
+	ts.LastRunSlow = false
+	if sla := getTaskSLA(id); sla > 0 && dur > time.Duration(sla)*time.Second {
+		ts.LastRunSlow = true
+		ts.SlowRuns++
+		slog.Warn("runTask: Task took longer than its expected max duration.", "job_name", id, "duration", dur, "sla", time.Duration(sla)*time.Second)
+	}
+	if err != nil {
+		ts.LastError = err.Error()
+		ts.ConsecutiveFailures++
+		ts.Failures++
+		// Kept in order of when runs started, a long run can
+		// finish after others that started later than it.
+		i := len(taskRecentErrors)
+		for i > 0 && taskRecentErrors[i-1].Time.After(start) {
+			i--
+		}
+		taskRecentErrors = slices.Insert(taskRecentErrors, i, TaskError{Task: id, Time: start, Error: err.Error()})
+		if len(taskRecentErrors) > taskRecentErrorsMax {
+			taskRecentErrors = taskRecentErrors[len(taskRecentErrors)-taskRecentErrorsMax:]
+		}
+		if ok, suppressed := sampleTaskError(id, err.Error(), start); ok {
+			slog.Error("runTask: Task failed.", "job_name", id, "consecutive_failures", ts.ConsecutiveFailures, "suppressed", suppressed, "error", err)
+		}
+	} else {
+		if suppressed := resetTaskErrorSample(id); suppressed > 0 {
+			slog.Info("runTask: Task succeeded after failing. Some failures were not logged.", "job_name", id, "suppressed", suppressed)
+		}
+		ts.LastError = ""
+		ts.ConsecutiveFailures = 0
+	}
+}
+
+// Set the summary of a tasks run, replacing any previous one.
+// Called by the task func itself while it runs.
+func setTaskSummary(id string, summary map[string]any) {
+	taskStatusesMu.Lock()
+	defer taskStatusesMu.Unlock()
+	ts, ok := taskStatuses[id]
+	if !ok {
+		ts = &TaskStatus{}
+		taskStatuses[id] = ts
+	}
+	now := taskClock.Now()
+	ts.Summary = summary
+	ts.SummaryAt = &now
+	logTaskSummary(id, summary)
+}
+
+// Log a tasks run summary, as one json attribute if LOG_TASK_SUMMARY_JSON
+// is enabled, otherwise as an attribute per figure.
+func logTaskSummary(id string, summary map[string]any) {
+	if Config.LOG_TASK_SUMMARY_JSON {
+		b, err := json.Marshal(summary)
+		if err != nil {
+			slog.Error("logTaskSummary: Failed to marshal summary", "job_name", id, "error", err)
+			return
+		}
+		slog.Info("logTaskSummary: Task run summary.", "job_name", id, "summary", string(b))
+		return
+	}
+	keys := make([]string, 0, len(summary))
+	for k := range summary {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	args := []any{"job_name", id}
+	for _, k := range keys {
+		args = append(args, k, summary[k])
+	}
+	slog.Info("logTaskSummary: Task run summary.", args...)
+}
+
+// Get a copy of a tasks status.
+func getTaskStatus(id string) TaskStatus {
+	taskStatusesMu.Lock()
+	defer taskStatusesMu.Unlock()
+	if ts, ok := taskStatuses[id]; ok {
+		return *ts
+	}
+	return TaskStatus{}
+}
+
+// Get most recent errors from all tasks, newest first.
+// Returns up to `limit` errors, or all kept errors if `limit` is <= 0.
+func getTaskRecentErrors(limit int) []TaskError {
+	taskStatusesMu.Lock()
+	defer taskStatusesMu.Unlock()
+	errs := []TaskError{}
+	for i := len(taskRecentErrors) - 1; i >= 0; i-- {
+		if limit > 0 && len(errs) >= limit {
+			break
+		}
+		errs = append(errs, taskRecentErrors[i])
+	}
+	return errs
+}
+
+// Get the latest summary of every task that has set one, by task id.
+// Lets the dashboard show all of them in one request, instead of
+// getting each tasks details.
+func getTaskSummaries() map[string]TaskSummary {
+	taskStatusesMu.Lock()
+	defer taskStatusesMu.Unlock()
+	summaries := map[string]TaskSummary{}
+	for id, ts := range taskStatuses {
+		if ts.Summary == nil || ts.SummaryAt == nil {
+			continue
+		}
+		summaries[id] = TaskSummary{Summary: ts.Summary, At: *ts.SummaryAt}
+	}
+	return summaries
+}
+
+// Reset a tasks run status back to zero.
+func resetTaskStatus(id string) {
+	taskStatusesMu.Lock()
+	defer taskStatusesMu.Unlock()
+	delete(taskStatuses, id)
+}
+
+// Reset a tasks count of failures in a row, keeping the rest of its status.
+func resetTaskConsecutiveFailures(id string) {
+	taskStatusesMu.Lock()
+	defer taskStatusesMu.Unlock()
+	if ts, ok := taskStatuses[id]; ok {
+		ts.ConsecutiveFailures = 0
+	}
+}
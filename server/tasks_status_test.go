@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Clear the recent errors of all tasks until the test ends.
+func useTestTaskRecentErrors(t *testing.T) {
+	t.Helper()
+	taskStatusesMu.Lock()
+	old := taskRecentErrors
+	taskRecentErrors = nil
+	taskStatusesMu.Unlock()
+	t.Cleanup(func() {
+		taskStatusesMu.Lock()
+		taskRecentErrors = old
+		taskStatusesMu.Unlock()
+	})
+}
+
+func TestTaskRecentErrorsAcrossTasks(t *testing.T) {
+	useTestConfig(t)
+	useTestTaskRecentErrors(t)
+	for _, id := range []string{"test_errors_a", "test_errors_b"} {
+		resetTaskStatus(id)
+	}
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	recordTaskRun("test_errors_a", start, time.Second, errors.New("a first"))
+	recordTaskRun("test_errors_b", start.Add(time.Minute), time.Second, errors.New("b first"))
+	recordTaskRun("test_errors_a", start.Add(2*time.Minute), time.Second, nil)
+	// Started before b failed, but took longer to finish.
+	recordTaskRun("test_errors_a", start.Add(30*time.Second), 2*time.Minute, errors.New("a slow"))
+	recordTaskRun("test_errors_b", start.Add(3*time.Minute), time.Second, errors.New("b second"))
+
+	want := []TaskError{
+		{Task: "test_errors_b", Time: start.Add(3 * time.Minute), Error: "b second"},
+		{Task: "test_errors_b", Time: start.Add(time.Minute), Error: "b first"},
+		{Task: "test_errors_a", Time: start.Add(30 * time.Second), Error: "a slow"},
+		{Task: "test_errors_a", Time: start, Error: "a first"},
+	}
+	if got := getTaskRecentErrors(0); !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors %+v, want newest first %+v", got, want)
+	}
+	if got := getTaskRecentErrors(2); !reflect.DeepEqual(got, want[:2]) {
+		t.Errorf("got limited errors %+v, want %+v", got, want[:2])
+	}
+}
+
+func TestTaskSLASlowRuns(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_SLA = map[string]int{"test_sla": 60}
+	clock := useFakeTaskClock(t, time.Now())
+	took := 10 * time.Second
+	finished := 0
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_sla": {
+			name: "Test SLA",
+			f: func() error {
+				clock.Advance(took)
+				finished++
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+	resetTaskStatus("test_sla")
+
+	for _, run := range []struct {
+		took     time.Duration
+		slow     bool
+		slowRuns int
+	}{
+		{10 * time.Second, false, 0},
+		{90 * time.Second, true, 1},
+		{time.Minute, false, 1},
+		{2 * time.Minute, true, 2},
+	} {
+		took = run.took
+		if out := runTaskOutcome("test_sla"); out.Result != TASK_RUN_SUCCESS {
+			t.Fatalf("run taking %s was %s (%s), want success", run.took, out.Result, out.Reason)
+		}
+		d, err := getTaskDetail("test_sla")
+		if err != nil {
+			t.Fatalf("failed to get detail: %v", err)
+		}
+		if d.LastRunSlow != run.slow || d.SlowRuns != run.slowRuns {
+			t.Errorf("run taking %s got slow %v with %d slow runs, want %v with %d", run.took, d.LastRunSlow, d.SlowRuns, run.slow, run.slowRuns)
+		}
+	}
+	if finished != 4 {
+		t.Errorf("%d runs finished, want all 4 (slow runs aren't cancelled)", finished)
+	}
+}
+
+func TestTaskSkipsWithDbUnavailable(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	builtin, _ := getTaskDefinitions(db, db)
+	useTestScheduler(t, map[string]TaskFunc{"cleanup_tokens": builtin["cleanup_tokens"]})
+	resetTaskStatus("cleanup_tokens")
+	sqlDb, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get db handle: %v", err)
+	}
+	sqlDb.Close()
+
+	out := runTaskOutcome("cleanup_tokens")
+	if out.Result != TASK_RUN_SKIPPED || out.Reason != "database unavailable" {
+		t.Fatalf("run with a closed db was %s (%s), want skipped as database unavailable", out.Result, out.Reason)
+	}
+	ts := getTaskStatus("cleanup_tokens")
+	if ts.Skipped != 1 || ts.Runs != 0 || ts.Failures != 0 || ts.ConsecutiveFailures != 0 {
+		t.Errorf("got status %+v, want only a skip counted", ts)
+	}
+}
+
+func TestTaskSkipsCounted(t *testing.T) {
+	useTestConfig(t)
+	useFakeTaskClock(t, time.Date(2024, 1, 1, 3, 30, 0, 0, time.Local))
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_skips_counted": {
+			name: "Test Skips Counted",
+			f: func() error {
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+	resetTaskStatus("test_skips_counted")
+
+	Config.TASK_QUIET_HOURS = TaskQuietHours{Start: "03:00", End: "04:00"}
+	if out := runTaskOutcome("test_skips_counted"); out.Result != TASK_RUN_SKIPPED {
+		t.Fatalf("run in quiet hours was %s, want skipped", out.Result)
+	}
+	Config.TASK_QUIET_HOURS = TaskQuietHours{}
+	drainTasks()
+	t.Cleanup(func() { resumeTasks() })
+	if out := runTaskOutcome("test_skips_counted"); out.Result != TASK_RUN_SKIPPED {
+		t.Fatalf("run while draining was %s, want skipped", out.Result)
+	}
+	ts := getTaskStatus("test_skips_counted")
+	if ts.Skipped != 2 || ts.LastSkipReason != "draining" || ts.Runs != 0 {
+		t.Errorf("got status %+v, want both skips counted, the last while draining", ts)
+	}
+}
+
+// Capture logs as json lines until the test ends.
+func useTestLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var b bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&b, nil)))
+	t.Cleanup(func() {
+		slog.SetDefault(prev)
+	})
+	return &b
+}
+
+func TestLogTaskSummaryFormats(t *testing.T) {
+	useTestConfig(t)
+	for _, c := range []struct {
+		name string
+		json bool
+	}{
+		{"text", false},
+		{"json", true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			Config.LOG_TASK_SUMMARY_JSON = c.json
+			logs := useTestLogs(t)
+			logTaskSummary("test_summary_log", map[string]any{"removed": 3, "kept": 1})
+
+			var line map[string]any
+			if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+				t.Fatalf("failed to parse log line %q: %v", logs, err)
+			}
+			if line["job_name"] != "test_summary_log" {
+				t.Errorf("got job_name %v, want test_summary_log", line["job_name"])
+			}
+			s, structured := line["summary"].(string)
+			if structured != c.json {
+				t.Fatalf("log line %q has summary attribute %v, want it only in json mode", logs, structured)
+			}
+			if !c.json {
+				if line["removed"] != 3.0 || line["kept"] != 1.0 {
+					t.Errorf("log line %q is missing an attribute per figure", logs)
+				}
+				return
+			}
+			var summary map[string]int
+			if err := json.Unmarshal([]byte(s), &summary); err != nil {
+				t.Fatalf("failed to parse summary %q: %v", s, err)
+			}
+			if summary["removed"] != 3 || summary["kept"] != 1 {
+				t.Errorf("got summary %v, want all figures", summary)
+			}
+			if _, ok := line["removed"]; ok {
+				t.Errorf("log line %q has figures outside the summary attribute", logs)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTaskSummariesLatestRun(t *testing.T) {
+	useTestConfig(t)
+	clock := useFakeTaskClock(t, time.Now())
+	db := newTestDb(t)
+	builtin, _ := getTaskDefinitions(db, db)
+	ids := []string{"cleanup_tokens", "check_migrations", "check_tmdb_rate_limits"}
+	tfs := map[string]TaskFunc{}
+	for _, id := range ids {
+		tfs[id] = builtin[id]
+		resetTaskStatus(id)
+		t.Cleanup(func() {
+			resetTaskStatus(id)
+		})
+	}
+	useTestScheduler(t, tfs)
+	ensureTaskIndexes(db)
+	r, token := newTestTaskRouter(t, db)
+	getSummaries := func() map[string]TaskSummary {
+		t.Helper()
+		w := doTestRequest(t, r, http.MethodGet, "/api/task/summaries", token, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got %d getting summaries, want 200: %s", w.Code, w.Body)
+		}
+		var s map[string]TaskSummary
+		if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil {
+			t.Fatalf("failed to decode summaries: %v", err)
+		}
+		return s
+	}
+	// Other tasks may have summaries from earlier tests.
+	for id, v := range getSummaries() {
+		if tfs[id].f != nil {
+			t.Fatalf("got %s summary %+v before it ran, want none", id, v)
+		}
+	}
+
+	addTestToken(t, db, 1, time.Hour)
+	for _, id := range ids {
+		if out := runTaskOutcome(id); out.Result != TASK_RUN_SUCCESS {
+			t.Fatalf("%s run was %s (%s), want success", id, out.Result, out.Reason)
+		}
+	}
+	first := getSummaries()
+	clock.Advance(time.Second)
+	addTestToken(t, db, 1, time.Hour)
+	addTestToken(t, db, 1, time.Hour)
+	if out := runTaskOutcome("cleanup_tokens"); out.Result != TASK_RUN_SUCCESS {
+		t.Fatalf("second cleanup_tokens run was %s (%s), want success", out.Result, out.Reason)
+	}
+
+	s := getSummaries()
+	for _, id := range ids {
+		if _, ok := s[id]; !ok {
+			t.Fatalf("%s has no summary after running", id)
+		}
+	}
+	// Numbers are float64 once decoded.
+	if got := s["cleanup_tokens"]; got.Summary["removedTokens"] != float64(2) || !got.At.After(first["cleanup_tokens"].At) {
+		t.Errorf("got cleanup_tokens summary %+v, want the second run removing 2 (first was %+v)", got, first["cleanup_tokens"])
+	}
+	if got := s["check_migrations"]; got.Summary["state"] != string(MIGRATIONS_CURRENT) || !got.At.Equal(first["check_migrations"].At) {
+		t.Errorf("got check_migrations summary %+v, want its only run", got)
+	}
+	if got := s["check_tmdb_rate_limits"]; got.Summary["trend"] == nil {
+		t.Errorf("got check_tmdb_rate_limits summary %+v, want its only run", got)
+	}
+}
@@ -0,0 +1,731 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestStartTaskSchedulerWaitsForStartupDelay(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_STARTUP_DELAY = 30
+	// Before the scheduler, so it is stopped before the clock is put back.
+	c := useFakeTaskClock(t, time.Now())
+	var runs atomic.Int32
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_startup_delay": {
+			name: "Test Startup Delay",
+			f: func() error {
+				runs.Add(1)
+				return nil
+			},
+			dd: 10 * time.Millisecond,
+		},
+	})
+	var slept time.Duration
+	c.onSleep = func(d time.Duration) {
+		slept = d
+		// Long enough for the job to have run a few times if it had been started.
+		time.Sleep(100 * time.Millisecond)
+		if n := runs.Load(); n != 0 {
+			t.Errorf("task ran %d times during the startup delay", n)
+		}
+	}
+	startTaskScheduler()
+	if slept != 30*time.Second {
+		t.Errorf("slept for %s, want 30s", slept)
+	}
+	waitFor(t, "task to run after the startup delay", func() bool {
+		return runs.Load() > 0
+	})
+}
+
+func TestStartTaskSchedulerWithoutDelay(t *testing.T) {
+	useTestConfig(t)
+	c := useFakeTaskClock(t, time.Now())
+	useTestScheduler(t, map[string]TaskFunc{})
+	c.onSleep = func(d time.Duration) {
+		t.Errorf("slept for %s with no startup delay set", d)
+	}
+	startTaskScheduler()
+}
+
+// One time jobs of task `id` in the scheduler.
+func countTestOnceJobs(id string) int {
+	n := 0
+	for _, j := range taskScheduler.Jobs() {
+		if j.Name() == id && slices.Contains(j.Tags(), taskTagOneTime) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestScheduleTaskOnceRunsOnce(t *testing.T) {
+	useTestConfig(t)
+	var runs atomic.Int32
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_once": {
+			name: "Test Once",
+			f: func() error {
+				runs.Add(1)
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+	if err := scheduleTaskOnce("test_once", TaskRunOnceRequest{At: time.Now().Add(-time.Minute)}); err == nil {
+		t.Error("scheduled a run in the past")
+	}
+	if err := scheduleTaskOnce("test_missing", TaskRunOnceRequest{At: time.Now().Add(time.Minute)}); err == nil {
+		t.Error("scheduled a run of a task that doesn't exist")
+	}
+	if err := scheduleTaskOnce("test_once", TaskRunOnceRequest{At: time.Now().Add(200 * time.Millisecond)}); err != nil {
+		t.Fatalf("failed to schedule: %v", err)
+	}
+	if n := countTestOnceJobs("test_once"); n != 1 {
+		t.Fatalf("got %d one time jobs, want 1", n)
+	}
+	taskScheduler.Start()
+	waitFor(t, "one time run", func() bool {
+		return runs.Load() == 1
+	})
+	waitFor(t, "one time job to be removed", func() bool {
+		return countTestOnceJobs("test_once") == 0
+	})
+	time.Sleep(300 * time.Millisecond)
+	if n := runs.Load(); n != 1 {
+		t.Errorf("task ran %d times, want once", n)
+	}
+	if getTask("test_once") == nil {
+		t.Error("recurring job was removed with the one time job")
+	}
+}
+
+func TestScheduleTaskOnceTimeout(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_once_timeout": {
+			name: "Test Once Timeout",
+			f: func() error {
+				ctx := getTaskRunContext("test_once_timeout")
+				if _, ok := ctx.Deadline(); !ok {
+					return nil
+				}
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			dd: time.Hour,
+		},
+	})
+	for _, secs := range []int{-1, int(taskRunTimeoutMax.Seconds()) + 1} {
+		if err := scheduleTaskOnce("test_once_timeout", TaskRunOnceRequest{At: time.Now().Add(time.Minute), TimeoutSeconds: secs}); err == nil {
+			t.Errorf("scheduled a run with a timeout of %d seconds", secs)
+		}
+	}
+	if err := scheduleTaskOnce("test_once_timeout", TaskRunOnceRequest{At: time.Now().Add(time.Minute), TimeoutSeconds: 60}); err != nil {
+		t.Fatalf("failed to schedule with a timeout: %v", err)
+	}
+
+	// Only the run given the timeout has one.
+	out := runTaskOutcomeWithTimeout("test_once_timeout", 50*time.Millisecond)
+	if out.Result != TASK_RUN_FAILED || out.Reason != context.DeadlineExceeded.Error() {
+		t.Errorf("run with a timeout was %s (%s), want it to fail once timed out", out.Result, out.Reason)
+	}
+	if out := runTaskOutcome("test_once_timeout"); out.Result != TASK_RUN_SUCCESS {
+		t.Errorf("next run was %s (%s), want success without a timeout", out.Result, out.Reason)
+	}
+}
+
+// Query plan sqlite would use for `query`, one detail line per step.
+func getTestQueryPlan(t *testing.T, db *gorm.DB, query string, args ...any) string {
+	t.Helper()
+	rows, err := db.Raw("EXPLAIN QUERY PLAN "+query, args...).Rows()
+	if err != nil {
+		t.Fatalf("failed to explain query: %v", err)
+	}
+	defer rows.Close()
+	var plan []string
+	for rows.Next() {
+		var (
+			id, parent, notused int
+			detail              string
+		)
+		if err := rows.Scan(&id, &parent, &notused, &detail); err != nil {
+			t.Fatalf("failed to scan query plan: %v", err)
+		}
+		plan = append(plan, detail)
+	}
+	return strings.Join(plan, "\n")
+}
+
+func TestEnsureTaskIndexesUsedByCleanups(t *testing.T) {
+	db := newTestDb(t)
+	for _, v := range taskIndexes {
+		if err := db.Exec("DROP INDEX IF EXISTS " + v.name).Error; err != nil {
+			t.Fatalf("failed to drop %s: %v", v.name, err)
+		}
+	}
+	cleanup := "DELETE FROM tokens WHERE created_at < ?"
+	before := getTestQueryPlan(t, db, cleanup, time.Now())
+	if strings.Contains(before, "idx_tokens_created_at") {
+		t.Fatalf("token cleanup uses the index before it exists: %s", before)
+	}
+
+	ensureTaskIndexes(db)
+	// Again, once they exist.
+	ensureTaskIndexes(db)
+	for _, v := range taskIndexes {
+		if !db.Migrator().HasIndex(v.model, v.name) {
+			t.Errorf("index %s wasn't created", v.name)
+		}
+	}
+	if after := getTestQueryPlan(t, db, cleanup, time.Now()); !strings.Contains(after, "USING INDEX idx_tokens_created_at") {
+		t.Errorf("token cleanup doesn't use its index: %s", after)
+	}
+	if after := getTestQueryPlan(t, db, "SELECT id FROM users WHERE avatar_id = ?", 1); !strings.Contains(after, "idx_users_avatar_id") {
+		t.Errorf("avatar lookup doesn't use its index: %s", after)
+	}
+}
+
+func TestGetAllTasksFailingOnly(t *testing.T) {
+	useTestConfig(t)
+	recovered := false
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_healthy": {name: "Test Healthy", f: func() error { return nil }, dd: time.Hour},
+		"test_failing": {name: "Test Failing", f: func() error { return errors.New("failed") }, dd: time.Hour},
+		"test_recovered": {
+			name: "Test Recovered",
+			f: func() error {
+				if !recovered {
+					return errors.New("failed")
+				}
+				return nil
+			},
+			dd: time.Hour,
+		},
+		"test_never_ran": {name: "Test Never Ran", f: func() error { return nil }, dd: time.Hour},
+	})
+	for _, id := range []string{"test_healthy", "test_failing", "test_recovered"} {
+		resetTaskStatus(id)
+		runTaskOutcome(id)
+	}
+	runTaskOutcome("test_failing")
+	recovered = true
+	runTaskOutcome("test_recovered")
+
+	ids := func(tasks []AllTasksResponse) []string {
+		ids := []string{}
+		for _, v := range tasks {
+			ids = append(ids, v.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	if got := ids(getAllTasks(true, false)); !slices.Equal(got, []string{"test_failing"}) {
+		t.Errorf("got failing tasks %v, want only test_failing", got)
+	}
+	if got := ids(getAllTasks(false, false)); len(got) != 4 {
+		t.Errorf("got tasks %v, want all 4", got)
+	}
+	failing := getAllTasks(true, false)[0]
+	if failing.ConsecutiveFailures != 2 || failing.LastError != "failed" {
+		t.Errorf("got failing task %+v, want 2 failures with its error", failing.TaskStatus)
+	}
+}
+
+func TestRemoveCustomTask(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{})
+	if err := registerTask("test_custom", TaskFunc{name: "Test Custom", origin: TASK_ORIGIN_API, f: func() error { return nil }, dd: time.Hour}); err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+	Config.TASK_SCHEDULE = map[string]int{"test_custom": 600}
+	Config.TASK_DISABLED = map[string]bool{"test_custom": true}
+	Config.TASK_SLA = map[string]int{"test_custom": 60, "other": 60}
+	Config.TASK_WINDOWS = map[string][]TaskWindow{"test_custom": {{Start: "18:00", End: "23:00"}}}
+	if err := removeTask("test_custom"); err != nil {
+		t.Fatalf("failed to remove: %v", err)
+	}
+	if getTask("test_custom") != nil {
+		t.Error("task still scheduled")
+	}
+	if _, ok := getTaskFunc("test_custom"); ok {
+		t.Error("task still registered")
+	}
+	_, scheduled := Config.TASK_SCHEDULE["test_custom"]
+	_, windowed := Config.TASK_WINDOWS["test_custom"]
+	if scheduled || Config.TASK_DISABLED["test_custom"] || Config.TASK_SLA["test_custom"] != 0 || windowed {
+		t.Error("tasks config wasn't removed with it")
+	}
+	if Config.TASK_SLA["other"] != 60 {
+		t.Error("another tasks config was removed")
+	}
+	if err := removeTask("test_custom"); err == nil || err.Error() != "no task found" {
+		t.Errorf("removing again got %v, want no task found", err)
+	}
+}
+
+func TestRemoveBuiltinTaskRefused(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_builtin": {name: "Test Builtin", f: func() error { return nil }, dd: time.Hour},
+	})
+	if err := removeTask("test_builtin"); err == nil || err.Error() != "built-in tasks cannot be removed" {
+		t.Fatalf("got %v, want built-in tasks cannot be removed", err)
+	}
+	if getTask("test_builtin") == nil {
+		t.Error("built-in task was removed")
+	}
+}
+
+func TestTaskDetailJobIDStableAcrossReschedule(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_job_id": {name: "Test Job ID", f: func() error { return nil }, dd: time.Hour},
+	})
+	before, err := getTaskDetail("test_job_id")
+	if err != nil {
+		t.Fatalf("failed to get detail: %v", err)
+	}
+	if before.JobID == "" {
+		t.Fatal("detail has no job id")
+	}
+	seconds := 2 * 60 * 60
+	if err := rescheduleTask("test_job_id", TaskRescheduleRequest{Seconds: &seconds}); err != nil {
+		t.Fatalf("failed to reschedule: %v", err)
+	}
+	after, err := getTaskDetail("test_job_id")
+	if err != nil {
+		t.Fatalf("failed to get detail after reschedule: %v", err)
+	}
+	if after.JobID != before.JobID {
+		t.Errorf("job id changed from %s to %s on reschedule", before.JobID, after.JobID)
+	}
+}
+
+func TestCoreTasksReportBuiltinOrigin(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	builtin, _ := getTaskDefinitions(db, db)
+	core := map[string]TaskFunc{}
+	for _, id := range []string{"cleanup_tokens", "cleanup_images", "generate_list_previews"} {
+		tf, ok := builtin[id]
+		if !ok {
+			t.Fatalf("%s isn't a built-in task", id)
+		}
+		core[id] = tf
+	}
+	useTestScheduler(t, core)
+	if err := registerTask("test_api", TaskFunc{name: "Test API", origin: TASK_ORIGIN_API, f: func() error { return nil }, dd: time.Hour}); err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+
+	all := getAllTasks(false, false)
+	if len(all) != 4 {
+		t.Fatalf("got %d tasks, want 4", len(all))
+	}
+	for _, v := range all {
+		want := TASK_ORIGIN_BUILTIN
+		if v.ID == "test_api" {
+			want = TASK_ORIGIN_API
+		}
+		if v.Origin != want {
+			t.Errorf("%s has origin %q, want %q", v.ID, v.Origin, want)
+		}
+	}
+	for id := range core {
+		d, err := getTaskDetail(id)
+		if err != nil {
+			t.Fatalf("failed to get detail of %s: %v", id, err)
+		}
+		if d.Origin != TASK_ORIGIN_BUILTIN {
+			t.Errorf("detail of %s has origin %q, want builtin", id, d.Origin)
+		}
+	}
+}
+
+func TestResetTaskStartsFresh(t *testing.T) {
+	useTestConfig(t)
+	failing := true
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_reset": {
+			name: "Test Reset",
+			f: func() error {
+				if failing {
+					return errors.New("failed")
+				}
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+	resetTaskStatus("test_reset")
+	openTestBreaker(t, "test_reset", "radarr main")
+	runTaskOutcome("test_reset")
+	runTaskOutcome("test_reset")
+	before, _ := getTaskDetail("test_reset")
+
+	d, err := resetTask("test_reset")
+	if err != nil {
+		t.Fatalf("failed to reset: %v", err)
+	}
+	if !reflect.DeepEqual(d.TaskStatus, TaskStatus{}) {
+		t.Errorf("got status %+v after reset, want it zeroed", d.TaskStatus)
+	}
+	if b := getTaskBreakers("test_reset"); len(b) != 0 {
+		t.Errorf("got breakers %+v after reset, want none", b)
+	}
+	if !d.NextRun.Equal(before.NextRun) || d.Disabled {
+		t.Errorf("reset changed the schedule, next run %s (was %s), disabled %v", d.NextRun, before.NextRun, d.Disabled)
+	}
+
+	failing = false
+	runTaskOutcome("test_reset")
+	s := getTaskStatus("test_reset")
+	if s.Runs != 1 || s.Failures != 0 || s.ConsecutiveFailures != 0 || s.LastError != "" {
+		t.Errorf("got status %+v after a run, want 1 successful run", s)
+	}
+	if _, err := resetTask("test_missing"); err == nil || err.Error() != "no task found" {
+		t.Errorf("resetting a missing task got %v, want no task found", err)
+	}
+}
+
+func TestRescheduleTaskRandomRange(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_range": {name: "Test Range", f: func() error { return nil }, dd: time.Hour},
+	})
+	seconds := 50 * 60
+	if err := rescheduleTask("test_range", TaskRescheduleRequest{Seconds: &seconds, MaxSeconds: seconds - 1}); err == nil {
+		t.Error("rescheduled with max seconds below seconds")
+	}
+	if err := rescheduleTask("test_range", TaskRescheduleRequest{Seconds: &seconds, MaxSeconds: 70 * 60}); err != nil {
+		t.Fatalf("failed to reschedule: %v", err)
+	}
+	if r := Config.TASK_SCHEDULE_RANGE["test_range"]; r.Min != 50*60 || r.Max != 70*60 {
+		t.Fatalf("got range %+v, want 50 to 70 minutes", r)
+	}
+	start := time.Now()
+	taskScheduler.Start()
+	var next []time.Time
+	waitFor(t, "next runs", func() bool {
+		next, _ = (*getTask("test_range")).NextRuns(20)
+		return len(next) == 20
+	})
+	// First run is picked when the scheduler starts.
+	if first := next[0].Sub(start); first < 50*time.Minute-time.Second || first > 70*time.Minute+time.Second {
+		t.Errorf("first run is %s after starting, want 50 to 70 minutes", first)
+	}
+	for i := 1; i < len(next); i++ {
+		if gap := next[i].Sub(next[i-1]); gap < 50*time.Minute || gap > 70*time.Minute {
+			t.Fatalf("run %d is %s after the last, want 50 to 70 minutes", i, gap)
+		}
+	}
+	if next[2].Sub(next[1]) == next[1].Sub(next[0]) && next[3].Sub(next[2]) == next[1].Sub(next[0]) {
+		t.Error("gaps between runs aren't random")
+	}
+	d, err := getTaskDetail("test_range")
+	if err != nil {
+		t.Fatalf("failed to get detail: %v", err)
+	}
+	if !d.NextRun.Equal(next[0]) {
+		t.Errorf("detail shows next run %s, want %s", d.NextRun, next[0])
+	}
+}
+
+func TestTaskLookupByIDWhenRenamed(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_named": {name: "Test Named", f: func() error { return nil }, dd: time.Hour},
+	})
+	Config.TASK_NAMES = map[string]string{"test_named": "Tâche Nommée"}
+	r, token := newTestTaskRouter(t, newTestDb(t))
+
+	w := doTestRequest(t, r, http.MethodGet, "/api/task/test_named", token, nil)
+	var d TaskDetailResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &d); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d (%v) getting by id, want 200: %s", w.Code, err, w.Body)
+	}
+	if d.ID != "test_named" || d.Name != "Tâche Nommée" {
+		t.Errorf("got id %q and name %q, want the stable id and configured name", d.ID, d.Name)
+	}
+	seconds := 2 * 60 * 60
+	if w := doTestRequest(t, r, http.MethodPut, "/api/task/test_named", token, TaskRescheduleRequest{Seconds: &seconds}); w.Code != http.StatusOK {
+		t.Errorf("got %d rescheduling by id, want 200: %s", w.Code, w.Body)
+	}
+	for _, name := range []string{"Tâche Nommée", "Test Named"} {
+		if w := doTestRequest(t, r, http.MethodPut, "/api/task/"+url.PathEscape(name), token, TaskRescheduleRequest{Seconds: &seconds}); w.Code != http.StatusNotFound {
+			t.Errorf("got %d rescheduling by name %q, want 404", w.Code, name)
+		}
+	}
+	if s := Config.TASK_SCHEDULE["test_named"]; s != seconds {
+		t.Errorf("got schedule %d, want %d", s, seconds)
+	}
+}
+
+func TestTaskMissedRunPolicies(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_MISSED_RUN = map[string]TaskMissedRunPolicy{
+		"test_catch_up":        TASK_MISSED_RUN_CATCH_UP,
+		"test_catch_up_recent": TASK_MISSED_RUN_CATCH_UP,
+		"test_catch_up_never":  TASK_MISSED_RUN_CATCH_UP,
+	}
+	useTestScheduler(t, map[string]TaskFunc{})
+	db := newTestDb(t)
+	taskDb = db
+	// Server was down for the last 3 hours.
+	for id, ago := range map[string]time.Duration{
+		"test_catch_up":        3 * time.Hour,
+		"test_catch_up_recent": 30 * time.Minute,
+		"test_skip":            3 * time.Hour,
+	} {
+		db.Create(&TaskRun{TaskID: id, StartedAt: time.Now().Add(-ago), Result: TASK_RUN_SUCCESS})
+	}
+
+	var runs sync.Map
+	for _, id := range []string{"test_catch_up", "test_catch_up_recent", "test_catch_up_never", "test_skip"} {
+		if err := registerTask(id, TaskFunc{
+			name: id,
+			f: func() error {
+				runs.Store(id, true)
+				return nil
+			},
+			dd: time.Hour,
+		}); err != nil {
+			t.Fatalf("failed to register %s: %v", id, err)
+		}
+	}
+	if getTaskMissedRunPolicy("test_skip") != TASK_MISSED_RUN_SKIP {
+		t.Errorf("default missed run policy is %s, want skip", getTaskMissedRunPolicy("test_skip"))
+	}
+	taskScheduler.Start()
+	waitFor(t, "missed run to be caught up", func() bool {
+		_, ok := runs.Load("test_catch_up")
+		return ok
+	})
+	time.Sleep(100 * time.Millisecond)
+	for _, id := range []string{"test_catch_up_recent", "test_catch_up_never", "test_skip"} {
+		if _, ok := runs.Load(id); ok {
+			t.Errorf("%s ran straight away, want it to wait for its next run", id)
+		}
+	}
+}
+
+func TestRescheduleTaskKeepsElapsedTime(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_anchor":       {name: "Test Anchor", f: func() error { return nil }, dd: time.Hour},
+		"test_anchor_fresh": {name: "Test Anchor Fresh", f: func() error { return nil }, dd: time.Hour},
+	})
+	for _, id := range []string{"test_anchor", "test_anchor_fresh"} {
+		resetTaskStatus(id)
+	}
+	taskScheduler.Start()
+	last := time.Now().Add(-20 * time.Minute)
+	recordTaskRun("test_anchor", last, time.Second, nil)
+
+	nextRun := func(id string) time.Time {
+		var next time.Time
+		waitFor(t, "next run of "+id, func() bool {
+			next, _ = (*getTask(id)).NextRun()
+			return !next.IsZero()
+		})
+		return next
+	}
+	near := func(got time.Time, want time.Time) bool {
+		return got.Sub(want).Abs() < 2*time.Second
+	}
+	seconds := 30 * 60
+	for _, id := range []string{"test_anchor", "test_anchor_fresh"} {
+		if err := rescheduleTask(id, TaskRescheduleRequest{Seconds: &seconds}); err != nil {
+			t.Fatalf("failed to reschedule %s: %v", id, err)
+		}
+	}
+	// 20 minutes of the new 30 have already passed.
+	if next, want := nextRun("test_anchor"), last.Add(30*time.Minute); !near(next, want) {
+		t.Errorf("got next run %s, want 30 minutes after the last run %s", next, want)
+	}
+	// Never ran, waits the new interval from now.
+	if next, want := nextRun("test_anchor_fresh"), time.Now().Add(30*time.Minute); !near(next, want) {
+		t.Errorf("got next run %s for a task that never ran, want about %s", next, want)
+	}
+}
+
+func TestTaskIntervalMultiplier(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_INTERVAL_MULTIPLIER = 2
+	Config.TASK_SCHEDULE = map[string]int{"test_overridden": 600}
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_default":    {name: "Test Default", f: func() error { return nil }, dd: time.Hour},
+		"test_overridden": {name: "Test Overridden", f: func() error { return nil }, dd: time.Hour},
+	})
+	taskScheduler.Start()
+	if gap := getTestRunGap(t, "test_default"); gap != 2*time.Hour {
+		t.Errorf("default interval is %s, want it doubled to 2h", gap)
+	}
+	if gap := getTestRunGap(t, "test_overridden"); gap != 10*time.Minute {
+		t.Errorf("overridden interval is %s, want it kept at 10m", gap)
+	}
+	Config.TASK_INTERVAL_MULTIPLIER = 0
+	if d := getTaskSeconds("test_default", time.Hour); d != time.Hour {
+		t.Errorf("got %s with no multiplier, want the default 1h", d)
+	}
+}
+
+func TestSeedTaskRunKeepsSchedule(t *testing.T) {
+	useTestConfig(t)
+	var runs atomic.Int32
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_seed": {
+			name: "Test Seed",
+			f: func() error {
+				runs.Add(1)
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+	taskScheduler.Start()
+	next, err := (*getTask("test_seed")).NextRun()
+	if err != nil {
+		t.Fatalf("failed to get next run: %v", err)
+	}
+	for _, secs := range []int{-1, taskSeedMaxSeconds + 1} {
+		if _, err := seedTaskRun("test_seed", TaskSeedRequest{Seconds: secs}); err == nil {
+			t.Errorf("seeded a run %d seconds out", secs)
+		}
+	}
+	if _, err := seedTaskRun("test_missing", TaskSeedRequest{}); err == nil {
+		t.Error("seeded a run of a task that doesn't exist")
+	}
+
+	start := time.Now()
+	resp, err := seedTaskRun("test_seed", TaskSeedRequest{Seconds: 1})
+	if err != nil {
+		t.Fatalf("failed to seed: %v", err)
+	}
+	if d := resp.At.Sub(start); d < time.Second || d > 2*time.Second {
+		t.Errorf("seeded run is %s out, want 1s", d)
+	}
+	if n := countTestOnceJobs("test_seed"); n != 1 {
+		t.Fatalf("got %d one time jobs, want 1", n)
+	}
+	time.Sleep(time.Until(resp.At))
+	waitFor(t, "seeded run", func() bool {
+		return runs.Load() == 1
+	})
+	waitFor(t, "seeded job to be removed", func() bool {
+		return countTestOnceJobs("test_seed") == 0
+	})
+	if got, _ := (*getTask("test_seed")).NextRun(); !got.Equal(next) {
+		t.Errorf("next recurring run moved from %s to %s", next, got)
+	}
+	if gap := getTestRunGap(t, "test_seed"); gap != time.Hour {
+		t.Errorf("recurring runs are %s apart after the seeded run, want 1h", gap)
+	}
+}
+
+func TestRescheduleTaskHandlerSeconds(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_reschedule_handler": {
+			name: "Test Reschedule Handler",
+			f: func() error {
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+	r, token := newTestTaskRouter(t, newTestDb(t))
+	put := func(body any) *httptest.ResponseRecorder {
+		return doTestRequest(t, r, http.MethodPut, "/api/task/test_reschedule_handler", token, body)
+	}
+
+	if w := put(map[string]int{"seconds": 0}); w.Code != http.StatusOK {
+		t.Fatalf("got %d rescheduling to 0, want 200: %s", w.Code, w.Body)
+	}
+	if !isTaskDisabled("test_reschedule_handler") {
+		t.Error("task isn't disabled after rescheduling to 0")
+	}
+	for _, body := range []any{map[string]int{"seconds": -60}, map[string]int{}} {
+		if w := put(body); w.Code != http.StatusBadRequest {
+			t.Errorf("got %d rescheduling with %v, want 400", w.Code, body)
+		}
+	}
+	if !isTaskDisabled("test_reschedule_handler") {
+		t.Error("invalid reschedule enabled the task")
+	}
+	if w := put(map[string]int{"seconds": 7200}); w.Code != http.StatusOK {
+		t.Fatalf("got %d rescheduling to 7200, want 200: %s", w.Code, w.Body)
+	}
+	if isTaskDisabled("test_reschedule_handler") {
+		t.Error("task is still disabled after rescheduling it")
+	}
+	if s := Config.TASK_SCHEDULE["test_reschedule_handler"]; s != 7200 {
+		t.Errorf("got scheduled seconds %d, want 7200", s)
+	}
+}
+
+func TestHiddenTasksLeftOutOfList(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_HIDDEN = map[string]bool{"test_hidden": true}
+	var runs atomic.Int32
+	f := func() error {
+		runs.Add(1)
+		return nil
+	}
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_hidden":  {name: "Test Hidden", f: f, dd: time.Hour},
+		"test_visible": {name: "Test Visible", f: f, dd: time.Hour},
+	})
+	r, token := newTestTaskRouter(t, newTestDb(t))
+	list := func(url string) []string {
+		t.Helper()
+		w := doTestRequest(t, r, http.MethodGet, url, token, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got %d listing tasks, want 200: %s", w.Code, w.Body)
+		}
+		var tasks []AllTasksResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &tasks); err != nil {
+			t.Fatalf("failed to decode tasks: %v", err)
+		}
+		ids := []string{}
+		for _, v := range tasks {
+			ids = append(ids, v.ID)
+			if v.Hidden != (v.ID == "test_hidden") {
+				t.Errorf("%s listed with hidden %v", v.ID, v.Hidden)
+			}
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	if got := list("/api/task/"); !reflect.DeepEqual(got, []string{"test_visible"}) {
+		t.Errorf("listed %q by default, want only the visible task", got)
+	}
+	if got := list("/api/task/?includeHidden=true"); !reflect.DeepEqual(got, []string{"test_hidden", "test_visible"}) {
+		t.Errorf("listed %q with includeHidden, want both tasks", got)
+	}
+
+	// Still runs and reports metrics.
+	if out := runTaskOutcome("test_hidden"); out.Result != TASK_RUN_SUCCESS || runs.Load() != 1 {
+		t.Errorf("hidden task run was %s (%s), want success", out.Result, out.Reason)
+	}
+	Config.TASK_METRICS_SECRET = "secret"
+	w := doTestRequest(t, r, http.MethodGet, "/api/task/metrics", "Bearer secret", nil)
+	if !strings.Contains(w.Body.String(), `watcharr_task_runs_total{task="test_hidden"`) {
+		t.Error("hidden task is missing from metrics")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header that external triggers send TASK_TRIGGER_SECRET in.
+const taskTriggerHeader = "X-Task-Trigger-Secret"
+
+const (
+	// Min time between external triggers of the same task.
+	taskTriggerMinInterval = 30 * time.Second
+	// How long after being triggered the task runs.
+	taskTriggerDelay = time.Second
+	// Failed auths an ip gets within `taskTriggerFailureWindow`, before
+	// all its triggers are rejected until the window ends.
+	taskTriggerMaxFailures   = 5
+	taskTriggerFailureWindow = 15 * time.Minute
+)
+
+type TaskTriggerResponse struct {
+	// When the triggered run starts.
+	At time.Time `json:"at"`
+}
+
+var (
+	// When each task was last triggered externally.
+	taskTriggerLast   = map[string]time.Time{}
+	taskTriggerLastMu sync.Mutex
+)
+
+// Failed trigger auths from one ip, since `since`.
+type taskTriggerFailures struct {
+	count int
+	since time.Time
+}
+
+var (
+	// Client ip -> its recent failed auths.
+	taskTriggerFails   = map[string]*taskTriggerFailures{}
+	taskTriggerFailsMu sync.Mutex
+)
+
+// If `ip` failed auth too many times recently to try again yet.
+func isTaskTriggerLockedOut(ip string) bool {
+	taskTriggerFailsMu.Lock()
+	defer taskTriggerFailsMu.Unlock()
+	f, ok := taskTriggerFails[ip]
+	if !ok {
+		return false
+	}
+	if taskSince(f.since) >= taskTriggerFailureWindow {
+		delete(taskTriggerFails, ip)
+		return false
+	}
+	return f.count >= taskTriggerMaxFailures
+}
+
+// Count a failed auth from `ip`. Ips whose window has ended are
+// removed while here, so guessing from many ips doesn't grow the map forever.
+func recordTaskTriggerFailure(ip string) {
+	taskTriggerFailsMu.Lock()
+	defer taskTriggerFailsMu.Unlock()
+	for k, f := range taskTriggerFails {
+		if taskSince(f.since) >= taskTriggerFailureWindow {
+			delete(taskTriggerFails, k)
+		}
+	}
+	f, ok := taskTriggerFails[ip]
+	if !ok {
+		f = &taskTriggerFailures{since: taskClock.Now()}
+		taskTriggerFails[ip] = f
+	}
+	f.count++
+}
+
+// Only allow requests that send the configured TASK_TRIGGER_SECRET.
+// Every request is rejected if no secret is configured. Ips that send a
+// wrong secret `taskTriggerMaxFailures` times are locked out for the
+// rest of `taskTriggerFailureWindow`, so the secret can't be guessed.
+func TaskTriggerRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if Config.TASK_TRIGGER_SECRET == "" {
+			slog.Warn("TaskTriggerRequired: Task trigger denied, TASK_TRIGGER_SECRET is not set.")
+			c.AbortWithStatus(403)
+			return
+		}
+		ip := c.ClientIP()
+		if isTaskTriggerLockedOut(ip) {
+			slog.Warn("TaskTriggerRequired: Task trigger denied, too many failed attempts.", "ip", ip)
+			c.AbortWithStatus(429)
+			return
+		}
+		secret := c.GetHeader(taskTriggerHeader)
+		if secret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(Config.TASK_TRIGGER_SECRET)) != 1 {
+			slog.Warn("TaskTriggerRequired: Task trigger denied, secret missing or invalid.", "ip", ip)
+			recordTaskTriggerFailure(ip)
+			c.AbortWithStatus(401)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Trigger a run of a task from outside (eg. an external cron).
+// The run goes through a one time job, like `scheduleTaskOnce`, so it
+// follows the same rules as scheduled runs. Each task can only be
+// triggered once per `taskTriggerMinInterval`.
+// Triggering a task that is already running is rejected. If a scheduled
+// run starts in the moment before the triggered one does, the triggered
+// run is skipped like any other overlapping run, they never run at once.
+func triggerTask(id string) (TaskTriggerResponse, error) {
+	if _, ok := getTaskFunc(id); !ok {
+		return TaskTriggerResponse{}, errors.New("no task found")
+	}
+	if since := getTaskRunningSince(id); !since.IsZero() {
+		slog.Info("triggerTask: Not triggering task, it is already running.", "job_name", id, "running_since", since)
+		return TaskTriggerResponse{}, errors.New("task is already running")
+	}
+	now := taskClock.Now()
+	taskTriggerLastMu.Lock()
+	last, triggered := taskTriggerLast[id]
+	if triggered && now.Sub(last) < taskTriggerMinInterval {
+		taskTriggerLastMu.Unlock()
+		return TaskTriggerResponse{}, errors.New("task was triggered too recently")
+	}
+	taskTriggerLast[id] = now
+	taskTriggerLastMu.Unlock()
+	// The scheduler runs on the wall clock, not the task clock.
+	at := time.Now().Add(taskTriggerDelay)
+	if err := scheduleTaskOnce(id, TaskRunOnceRequest{At: at}); err != nil {
+		// Failed triggers don't count towards the limit.
+		taskTriggerLastMu.Lock()
+		if taskTriggerLast[id].Equal(now) {
+			if triggered {
+				taskTriggerLast[id] = last
+			} else {
+				delete(taskTriggerLast, id)
+			}
+		}
+		taskTriggerLastMu.Unlock()
+		return TaskTriggerResponse{}, err
+	}
+	slog.Info("triggerTask: Task triggered externally.", "job_name", id, "at", at)
+	return TaskTriggerResponse{At: at}, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Clear failed trigger auths and last triggers until the test ends.
+func useTestTaskTriggers(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		taskTriggerFailsMu.Lock()
+		taskTriggerFails = map[string]*taskTriggerFailures{}
+		taskTriggerFailsMu.Unlock()
+		taskTriggerLastMu.Lock()
+		taskTriggerLast = map[string]time.Time{}
+		taskTriggerLastMu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// Trigger task `id` through `r`, sending `secret` if not empty.
+func doTestTrigger(r http.Handler, id string, secret string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/trigger/task/"+id, nil)
+	if secret != "" {
+		req.Header.Set(taskTriggerHeader, secret)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestTaskTriggerAuth(t *testing.T) {
+	useTestConfig(t)
+	useTestTaskTriggers(t)
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_trigger": {
+			name: "Test Trigger",
+			f: func() error {
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+	r, _ := newTestTaskRouter(t, newTestDb(t))
+
+	if w := doTestTrigger(r, "test_trigger", "secret"); w.Code != http.StatusForbidden {
+		t.Errorf("got %d with no secret configured, want 403", w.Code)
+	}
+	Config.TASK_TRIGGER_SECRET = "secret"
+	if w := doTestTrigger(r, "test_trigger", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("got %d without a secret, want 401", w.Code)
+	}
+	if w := doTestTrigger(r, "test_missing", "secret"); w.Code != http.StatusNotFound {
+		t.Errorf("got %d for an unknown task, want 404", w.Code)
+	}
+	if w := doTestTrigger(r, "test_trigger", "secret"); w.Code != http.StatusAccepted {
+		t.Fatalf("got %d with the secret, want 202: %s", w.Code, w.Body)
+	}
+	if n := countTestOnceJobs("test_trigger"); n != 1 {
+		t.Errorf("triggered task has %d one time runs, want 1", n)
+	}
+	if w := doTestTrigger(r, "test_trigger", "secret"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("got %d triggering again straight away, want 429", w.Code)
+	}
+}
+
+func TestTaskTriggerMinInterval(t *testing.T) {
+	useTestConfig(t)
+	useTestTaskTriggers(t)
+	clock := useFakeTaskClock(t, time.Now())
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_trigger_interval": {
+			name: "Test Trigger Interval",
+			f: func() error {
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+	Config.TASK_TRIGGER_SECRET = "secret"
+	r, _ := newTestTaskRouter(t, newTestDb(t))
+
+	if w := doTestTrigger(r, "test_trigger_interval", "secret"); w.Code != http.StatusAccepted {
+		t.Fatalf("got %d with the secret, want 202: %s", w.Code, w.Body)
+	}
+	clock.Advance(taskTriggerMinInterval - time.Second)
+	if w := doTestTrigger(r, "test_trigger_interval", "secret"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("got %d before the min interval passed, want 429", w.Code)
+	}
+	clock.Advance(time.Second)
+	if w := doTestTrigger(r, "test_trigger_interval", "secret"); w.Code != http.StatusAccepted {
+		t.Errorf("got %d once the min interval passed, want 202: %s", w.Code, w.Body)
+	}
+	if n := countTestOnceJobs("test_trigger_interval"); n != 2 {
+		t.Errorf("triggered task has %d one time runs, want 2", n)
+	}
+}
+
+func TestTaskTriggerLocksOutFailedAuth(t *testing.T) {
+	useTestConfig(t)
+	useTestTaskTriggers(t)
+	clock := useFakeTaskClock(t, time.Now())
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_trigger_lockout": {
+			name: "Test Trigger Lockout",
+			f: func() error {
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+	Config.TASK_TRIGGER_SECRET = "secret"
+	r, _ := newTestTaskRouter(t, newTestDb(t))
+
+	for i := 0; i < taskTriggerMaxFailures; i++ {
+		if w := doTestTrigger(r, "test_trigger_lockout", "guess"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("got %d for wrong secret %d, want 401", w.Code, i+1)
+		}
+	}
+	// Locked out, even with the right secret.
+	if w := doTestTrigger(r, "test_trigger_lockout", "secret"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("got %d after too many failures, want 429", w.Code)
+	}
+	clock.Advance(taskTriggerFailureWindow)
+	if w := doTestTrigger(r, "test_trigger_lockout", "secret"); w.Code != http.StatusAccepted {
+		t.Errorf("got %d once the window ended, want 202: %s", w.Code, w.Body)
+	}
+}
+
+func TestTaskTriggerWhileRunning(t *testing.T) {
+	useTestConfig(t)
+	useTestTaskTriggers(t)
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_trigger_running": {
+			name: "Test Trigger Running",
+			f: func() error {
+				close(started)
+				<-unblock
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+	Config.TASK_TRIGGER_SECRET = "secret"
+	r, _ := newTestTaskRouter(t, newTestDb(t))
+
+	// Scheduled run, holding the tasks lock.
+	done := make(chan TaskRunOutcome)
+	go func() {
+		done <- runTaskOutcome("test_trigger_running")
+	}()
+	<-started
+	if w := doTestTrigger(r, "test_trigger_running", "secret"); w.Code != http.StatusConflict {
+		t.Errorf("got %d triggering while running, want 409: %s", w.Code, w.Body)
+	}
+	if n := countTestOnceJobs("test_trigger_running"); n != 0 {
+		t.Errorf("trigger while running scheduled %d runs, want none", n)
+	}
+	close(unblock)
+	if out := <-done; out.Result != TASK_RUN_SUCCESS {
+		t.Fatalf("scheduled run was %s (%s), want success", out.Result, out.Reason)
+	}
+	if w := doTestTrigger(r, "test_trigger_running", "secret"); w.Code != http.StatusAccepted {
+		t.Errorf("got %d triggering once the run finished, want 202: %s", w.Code, w.Body)
+	}
+}
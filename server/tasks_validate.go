@@ -0,0 +1,114 @@
+package main
+
+import (
+	"log"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+const (
+	// Shortest interval a light task can be configured to run at.
+	taskIntervalFloorLight = 10 * time.Second
+	// Shortest interval a heavy task can be configured to run at,
+	// higher so a typo can't have them hammering the db or external apis.
+	taskIntervalFloorHeavy = 5 * time.Minute
+	// Longest interval any task can be configured to run at.
+	taskIntervalCeiling = 365 * 24 * time.Hour
+)
+
+// A configured interval that was out of range and changed at startup.
+type TaskScheduleAdjustment struct {
+	ID string `json:"id"`
+	// Config key the interval is from, eg. `TASK_SCHEDULE`.
+	Key string `json:"key"`
+	// Interval (seconds) configured.
+	From int `json:"from"`
+	// Interval (seconds) now in use, 0 if the task is back on its default.
+	To int `json:"to"`
+}
+
+// Adjustments made to the task schedule config at startup.
+var taskScheduleAdjustments []TaskScheduleAdjustment
+
+// Get the range of intervals (seconds) a task can be configured to run at.
+func getTaskIntervalBounds(tf TaskFunc) (int, int) {
+	floor := taskIntervalFloorLight
+	if tf.pool == TASK_POOL_HEAVY {
+		floor = taskIntervalFloorHeavy
+	}
+	return int(floor.Seconds()), int(taskIntervalCeiling.Seconds())
+}
+
+// Check the intervals in TASK_SCHEDULE and TASK_SCHEDULE_RANGE of `tasks`
+// are within their bounds, before they are given to the scheduler.
+// Intervals below zero are removed (the default is used), others out of
+// range are clamped. The fixed config is written to file. With
+// TASK_SCHEDULE_STRICT on, startup is stopped instead.
+func validateTaskSchedules(tasks map[string]TaskFunc) {
+	var adjusted []TaskScheduleAdjustment
+	taskConfigMu.Lock()
+	for id, tf := range tasks {
+		floor, ceiling := getTaskIntervalBounds(tf)
+		if s, ok := Config.TASK_SCHEDULE[id]; ok {
+			if to, bad := clampTaskInterval(s, floor, ceiling); bad {
+				adjusted = append(adjusted, TaskScheduleAdjustment{ID: id, Key: "TASK_SCHEDULE", From: s, To: to})
+				if to == 0 {
+					delete(Config.TASK_SCHEDULE, id)
+				} else {
+					Config.TASK_SCHEDULE[id] = to
+				}
+			}
+		}
+		if r, ok := Config.TASK_SCHEDULE_RANGE[id]; ok {
+			minTo, minBad := clampTaskInterval(r.Min, floor, ceiling)
+			maxTo, maxBad := clampTaskInterval(r.Max, floor, ceiling)
+			if minBad {
+				adjusted = append(adjusted, TaskScheduleAdjustment{ID: id, Key: "TASK_SCHEDULE_RANGE.Min", From: r.Min, To: minTo})
+			}
+			if maxBad {
+				adjusted = append(adjusted, TaskScheduleAdjustment{ID: id, Key: "TASK_SCHEDULE_RANGE.Max", From: r.Max, To: maxTo})
+			}
+			if minBad || maxBad {
+				if minTo == 0 || maxTo == 0 || minTo >= maxTo {
+					// Nothing sane left of it.
+					delete(Config.TASK_SCHEDULE_RANGE, id)
+				} else {
+					Config.TASK_SCHEDULE_RANGE[id] = TaskScheduleRange{Min: minTo, Max: maxTo}
+				}
+			}
+		}
+	}
+	taskConfigMu.Unlock()
+	if len(adjusted) == 0 {
+		return
+	}
+	sort.SliceStable(adjusted, func(i, j int) bool {
+		return adjusted[i].ID < adjusted[j].ID
+	})
+	for _, a := range adjusted {
+		slog.Warn("validateTaskSchedules: Task interval out of range.", "job_name", a.ID, "key", a.Key, "from", a.From, "to", a.To)
+	}
+	if Config.TASK_SCHEDULE_STRICT {
+		log.Fatal("Task schedule config has out of range intervals (see above), fix them or disable TASK_SCHEDULE_STRICT.")
+	}
+	taskScheduleAdjustments = append(taskScheduleAdjustments, adjusted...)
+	slog.Info("validateTaskSchedules: Adjusted out of range task intervals.", "adjusted", len(adjusted))
+	if err := writeConfig(); err != nil {
+		slog.Error("validateTaskSchedules: Failed to write updated config to file!", "error", err)
+	}
+}
+
+// Clamp interval `s` to `floor`-`ceiling`. Intervals below zero become 0
+// (use the default). Returns the new interval and if it had to change.
+func clampTaskInterval(s int, floor int, ceiling int) (int, bool) {
+	if s < 0 {
+		return 0, true
+	}
+	if s == 0 {
+		// Not set, the default is used.
+		return 0, false
+	}
+	to := min(max(s, floor), ceiling)
+	return to, to != s
+}
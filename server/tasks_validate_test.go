@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValidateTaskSchedulesMalformed(t *testing.T) {
+	useTestConfig(t)
+	taskScheduleAdjustments = nil
+	t.Cleanup(func() {
+		taskScheduleAdjustments = nil
+	})
+	Config.TASK_SCHEDULE = map[string]int{
+		"test_negative": -60,
+		"test_fast":     1,
+		"test_heavy":    60,
+		"test_slow":     int((2 * taskIntervalCeiling).Seconds()),
+		"test_ok":       3600,
+	}
+	Config.TASK_SCHEDULE_RANGE = map[string]TaskScheduleRange{
+		"test_range":        {Min: 1, Max: 120},
+		"test_range_broken": {Min: -1, Max: 120},
+	}
+	f := func() error { return nil }
+	validateTaskSchedules(map[string]TaskFunc{
+		"test_negative":     {name: "Test Negative", f: f, dd: time.Hour},
+		"test_fast":         {name: "Test Fast", f: f, dd: time.Hour},
+		"test_heavy":        {name: "Test Heavy", f: f, dd: time.Hour, pool: TASK_POOL_HEAVY},
+		"test_slow":         {name: "Test Slow", f: f, dd: time.Hour},
+		"test_ok":           {name: "Test OK", f: f, dd: time.Hour},
+		"test_range":        {name: "Test Range", f: f, dd: time.Hour},
+		"test_range_broken": {name: "Test Range Broken", f: f, dd: time.Hour},
+	})
+
+	light := int(taskIntervalFloorLight.Seconds())
+	wantSchedule := map[string]int{
+		"test_fast":  light,
+		"test_heavy": int(taskIntervalFloorHeavy.Seconds()),
+		"test_slow":  int(taskIntervalCeiling.Seconds()),
+		"test_ok":    3600,
+	}
+	if !reflect.DeepEqual(Config.TASK_SCHEDULE, wantSchedule) {
+		t.Errorf("got schedule %v, want %v", Config.TASK_SCHEDULE, wantSchedule)
+	}
+	wantRange := map[string]TaskScheduleRange{"test_range": {Min: light, Max: 120}}
+	if !reflect.DeepEqual(Config.TASK_SCHEDULE_RANGE, wantRange) {
+		t.Errorf("got ranges %v, want %v", Config.TASK_SCHEDULE_RANGE, wantRange)
+	}
+	want := []TaskScheduleAdjustment{
+		{ID: "test_fast", Key: "TASK_SCHEDULE", From: 1, To: light},
+		{ID: "test_heavy", Key: "TASK_SCHEDULE", From: 60, To: int(taskIntervalFloorHeavy.Seconds())},
+		{ID: "test_negative", Key: "TASK_SCHEDULE", From: -60, To: 0},
+		{ID: "test_range", Key: "TASK_SCHEDULE_RANGE.Min", From: 1, To: light},
+		{ID: "test_range_broken", Key: "TASK_SCHEDULE_RANGE.Min", From: -1, To: 0},
+		{ID: "test_slow", Key: "TASK_SCHEDULE", From: int((2 * taskIntervalCeiling).Seconds()), To: int(taskIntervalCeiling.Seconds())},
+	}
+	if !reflect.DeepEqual(taskScheduleAdjustments, want) {
+		t.Errorf("got adjustments %+v, want %+v", taskScheduleAdjustments, want)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+const (
+	// Runs of each task whose workload is remembered.
+	taskWorkloadRuns = 10
+	// Default percent of the task tmdb budget one task should use on
+	// average, see TASK_TMDB_SHARE.
+	taskTMDBDefaultShare = 10
+)
+
+// A lower limit on how often a task can be scheduled. A tasks minimum
+// interval is the highest of its constraints.
+type TaskIntervalConstraint struct {
+	// What the constraint comes from, eg. `pool`.
+	Name string `json:"name"`
+	// Shortest interval (seconds) allowed by this constraint.
+	Seconds int `json:"seconds"`
+	// Why, for showing to the user.
+	Reason string `json:"reason"`
+}
+
+type taskWorkload struct {
+	// Tmdb requests made by the current run.
+	current int
+	// Tmdb requests made by recent runs, oldest first.
+	runs []int
+}
+
+var (
+	taskWorkloads   = map[string]*taskWorkload{}
+	taskWorkloadsMu sync.Mutex
+)
+
+// Count a tmdb request made by task `id`.
+func countTaskRequest(id string) {
+	taskWorkloadsMu.Lock()
+	defer taskWorkloadsMu.Unlock()
+	w, ok := taskWorkloads[id]
+	if !ok {
+		w = &taskWorkload{}
+		taskWorkloads[id] = w
+	}
+	w.current++
+}
+
+// Start counting the workload of a run of task `id`.
+func startTaskWorkload(id string) {
+	taskWorkloadsMu.Lock()
+	defer taskWorkloadsMu.Unlock()
+	if w, ok := taskWorkloads[id]; ok {
+		w.current = 0
+	}
+}
+
+// Remember the workload of the run of task `id` that just finished.
+// Only tasks that have made tmdb requests are remembered.
+func finishTaskWorkload(id string) {
+	taskWorkloadsMu.Lock()
+	defer taskWorkloadsMu.Unlock()
+	w, ok := taskWorkloads[id]
+	if !ok {
+		return
+	}
+	w.runs = append(w.runs, w.current)
+	if len(w.runs) > taskWorkloadRuns {
+		w.runs = w.runs[len(w.runs)-taskWorkloadRuns:]
+	}
+	w.current = 0
+}
+
+// Most tmdb requests made by one of the recent runs of task `id`.
+func getTaskPeakRequests(id string) int {
+	taskWorkloadsMu.Lock()
+	defer taskWorkloadsMu.Unlock()
+	peak := 0
+	if w, ok := taskWorkloads[id]; ok {
+		for _, r := range w.runs {
+			peak = max(peak, r)
+		}
+	}
+	return peak
+}
+
+func getTaskTMDBShare() int {
+	if Config.TASK_TMDB_SHARE > 0 && Config.TASK_TMDB_SHARE <= 100 {
+		return Config.TASK_TMDB_SHARE
+	}
+	return taskTMDBDefaultShare
+}
+
+// Get the constraints on how often task `id` can be scheduled: the floor
+// of its pool, and for tasks making tmdb requests, the interval that
+// keeps their busiest recent run within TASK_TMDB_SHARE of the tmdb
+// requests tasks can make.
+func getTaskIntervalConstraints(id string, tf TaskFunc) []TaskIntervalConstraint {
+	floor, _ := getTaskIntervalBounds(tf)
+	cs := []TaskIntervalConstraint{{
+		Name:    "pool",
+		Seconds: floor,
+		Reason:  fmt.Sprintf("Tasks in the %s pool can't run more often than every %s.", tf.pool, secondsDuration(floor)),
+	}}
+	if peak := getTaskPeakRequests(id); peak > 0 {
+		// Requests per second this task can use on average.
+		budget := max(getTMDBLimiterLimit()-getTMDBLimiterReserved(), 1) * getTaskTMDBShare()
+		// Rounded up, budget is in hundredths of a request.
+		s := (peak*100 + budget - 1) / budget
+		cs = append(cs, TaskIntervalConstraint{
+			Name:    "tmdbRateLimit",
+			Seconds: s,
+			Reason:  fmt.Sprintf("Recent runs made up to %d tmdb requests, running more often than every %s would use more than %d%% of the tmdb requests tasks can make.", peak, secondsDuration(s), getTaskTMDBShare()),
+		})
+	}
+	return cs
+}
+
+// Shortest interval (seconds) task `id` can be scheduled at,
+// the highest of its constraints.
+func getTaskMinSeconds(id string, tf TaskFunc) int {
+	m := 0
+	for _, c := range getTaskIntervalConstraints(id, tf) {
+		m = max(m, c.Seconds)
+	}
+	return m
+}
+
+// Check task `id` can be rescheduled to run every `seconds`.
+func checkTaskMinInterval(id string, tf TaskFunc, seconds int) error {
+	if seconds == 0 {
+		// Disabling is always fine.
+		return nil
+	}
+	for _, c := range getTaskIntervalConstraints(id, tf) {
+		if seconds < c.Seconds {
+			slog.Warn("checkTaskMinInterval: Interval is below the tasks minimum.", "job_name", id, "seconds", seconds, "constraint", c.Name, "min_seconds", c.Seconds)
+			return errors.New("seconds is below the tasks minimum interval")
+		}
+	}
+	return nil
+}
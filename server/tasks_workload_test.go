@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestTaskWorkloadRaisesMinInterval(t *testing.T) {
+	useTestConfig(t)
+	Config.TMDB_RATE_LIMIT = 10
+	Config.TMDB_USER_RESERVE = 20
+	Config.TASK_TMDB_SHARE = 10
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_workload": {
+			name: "Test Workload",
+			f: func() error {
+				// Each item of the run caches its content,
+				// like imports and syncs through `getOrCacheContentFor`.
+				for i := 0; i < 600; i++ {
+					countTaskRequest("test_workload")
+				}
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+	tf, _ := getTaskFunc("test_workload")
+	static, _ := getTaskIntervalBounds(tf)
+	if m := getTaskMinSeconds("test_workload", tf); m != static {
+		t.Fatalf("min interval before any runs is %d, want the static %d", m, static)
+	}
+	runTaskOutcome("test_workload")
+	// Tasks get 8 of the 10 requests per second, this one 10% of that.
+	if m := getTaskMinSeconds("test_workload", tf); m != 750 {
+		t.Fatalf("min interval after the run is %d, want 750", m)
+	}
+	seconds := 600
+	if err := rescheduleTask("test_workload", TaskRescheduleRequest{Seconds: &seconds}); err == nil {
+		t.Error("rescheduled below the workload floor")
+	}
+	seconds = 750
+	if err := rescheduleTask("test_workload", TaskRescheduleRequest{Seconds: &seconds}); err != nil {
+		t.Errorf("failed to reschedule at the workload floor: %v", err)
+	}
+}
+
+func TestTaskImageDownloadsCountedWhenMade(t *testing.T) {
+	useTestConfig(t)
+	useTestTMDBLimiter(t)
+	cached := path.Join(DataPath, "cached.jpg")
+	if err := os.WriteFile(cached, []byte("img"), 0644); err != nil {
+		t.Fatalf("failed to write cached image: %v", err)
+	}
+	startTaskWorkload("test_image_workload")
+	for _, tc := range []struct {
+		task  string
+		outf  string
+		force bool
+	}{
+		// Counted.
+		{"test_image_workload", path.Join(DataPath, "missing.jpg"), false},
+		{"test_image_workload", cached, true},
+		// Skipped by `download`, or not a task.
+		{"test_image_workload", cached, false},
+		{"", path.Join(DataPath, "missing.jpg"), false},
+	} {
+		if err := waitTMDBImageQuota(tc.task, tc.outf, tc.force); err != nil {
+			t.Fatalf("failed to get quota for %+v: %v", tc, err)
+		}
+	}
+	finishTaskWorkload("test_image_workload")
+	if peak := getTaskPeakRequests("test_image_workload"); peak != 2 {
+		t.Errorf("counted %d image downloads, want 2", peak)
+	}
+}
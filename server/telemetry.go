@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"runtime"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	taskIdSendTelemetry = "send_telemetry"
+	// Bumped whenever the payload changes, so receivers can tell versions apart.
+	telemetryPayloadVersion = 1
+	telemetryTimeout        = 30 * time.Second
+)
+
+// Everything the Send Telemetry task sends. Only totals are included,
+// nothing about any single user or their list (no ids, usernames,
+// titles, etc), and nothing about the server (hosts, keys, config).
+// Tasks are only broken down for builtin ones, since config and report
+// task ids are chosen by admins and could say something about them.
+type TelemetryPayload struct {
+	Version int    `json:"version"`
+	Os      string `json:"os"`
+	Arch    string `json:"arch"`
+	Users   int64  `json:"users"`
+	// Content on at least one watched list, by type. Content only
+	// cached (eg. from searches or trending) isn't counted.
+	Content map[ContentType]int64 `json:"content"`
+	// Watched list entries across all users, by status.
+	Watched map[WatchedStatus]int64 `json:"watched"`
+	Tasks   TelemetryTasks          `json:"tasks"`
+}
+
+type TelemetryTasks struct {
+	Total int `json:"total"`
+	// Tasks whose last run failed.
+	Failing int `json:"failing"`
+	// Run counts since startup, across all tasks.
+	Runs     int `json:"runs"`
+	Failures int `json:"failures"`
+	// Run counts since startup, for builtin tasks only.
+	Builtin map[string]TelemetryTaskHealth `json:"builtin"`
+}
+
+type TelemetryTaskHealth struct {
+	Runs     int `json:"runs"`
+	Failures int `json:"failures"`
+}
+
+// What would be sent, so admins can check before opting in.
+type TelemetryPreviewResponse struct {
+	Enabled bool             `json:"enabled"`
+	Payload TelemetryPayload `json:"payload"`
+}
+
+// Telemetry is opt-in, it is only sent once enabled and given somewhere to go.
+func isTelemetryEnabled() bool {
+	_, ok := getTelemetryUrl()
+	return ok
+}
+
+// Get where to send telemetry, and if it is enabled.
+func getTelemetryUrl() (string, bool) {
+	taskConfigMu.RLock()
+	defer taskConfigMu.RUnlock()
+	return Config.TASK_TELEMETRY_URL, Config.TASK_TELEMETRY && Config.TASK_TELEMETRY_URL != ""
+}
+
+// Build the telemetry payload from the db and task stats.
+func getTelemetryPayload(db *gorm.DB) (TelemetryPayload, error) {
+	p := TelemetryPayload{
+		Version: telemetryPayloadVersion,
+		Os:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+		Content: map[ContentType]int64{},
+		Watched: map[WatchedStatus]int64{},
+		Tasks:   TelemetryTasks{Builtin: map[string]TelemetryTaskHealth{}},
+	}
+	if res := db.Model(&User{}).Count(&p.Users); res.Error != nil {
+		slog.Error("getTelemetryPayload: Failed to count users", "error", res.Error)
+		return TelemetryPayload{}, errors.New("failed to count users")
+	}
+	var content []struct {
+		Type  ContentType
+		Count int64
+	}
+	res := db.Model(&Content{}).
+		Select("type, COUNT(*) AS count").
+		Where("EXISTS (SELECT 1 FROM watcheds w WHERE w.content_id = contents.id AND w.deleted_at IS NULL)").
+		Group("type").
+		Scan(&content)
+	if res.Error != nil {
+		slog.Error("getTelemetryPayload: Failed to count content", "error", res.Error)
+		return TelemetryPayload{}, errors.New("failed to count content")
+	}
+	for _, c := range content {
+		p.Content[c.Type] = c.Count
+	}
+	var watched []struct {
+		Status WatchedStatus
+		Count  int64
+	}
+	if res := db.Model(&Watched{}).Select("status, COUNT(*) AS count").Group("status").Scan(&watched); res.Error != nil {
+		slog.Error("getTelemetryPayload: Failed to count watched entries", "error", res.Error)
+		return TelemetryPayload{}, errors.New("failed to count watched entries")
+	}
+	for _, w := range watched {
+		p.Watched[w.Status] = w.Count
+	}
+	taskFuncsMu.RLock()
+	origins := make(map[string]TaskOrigin, len(taskFuncs))
+	for id, tf := range taskFuncs {
+		origins[id] = tf.origin
+	}
+	taskFuncsMu.RUnlock()
+	for id, origin := range origins {
+		ts := getTaskStatus(id)
+		p.Tasks.Total++
+		p.Tasks.Runs += ts.Runs
+		p.Tasks.Failures += ts.Failures
+		if ts.ConsecutiveFailures > 0 {
+			p.Tasks.Failing++
+		}
+		if origin == TASK_ORIGIN_BUILTIN {
+			p.Tasks.Builtin[id] = TelemetryTaskHealth{Runs: ts.Runs, Failures: ts.Failures}
+		}
+	}
+	return p, nil
+}
+
+// Get what would be sent by the Send Telemetry task right now.
+func getTelemetryPreview(db *gorm.DB) (TelemetryPreviewResponse, error) {
+	p, err := getTelemetryPayload(db)
+	if err != nil {
+		return TelemetryPreviewResponse{}, err
+	}
+	return TelemetryPreviewResponse{Enabled: isTelemetryEnabled(), Payload: p}, nil
+}
+
+// Send the telemetry payload to TASK_TELEMETRY_URL.
+func sendTelemetry(db *gorm.DB) error {
+	u, ok := getTelemetryUrl()
+	if !ok {
+		// Registered only while enabled, but never send if it was just turned off.
+		return nil
+	}
+	p, err := getTelemetryPayload(db)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		slog.Error("sendTelemetry: Failed to marshal payload", "error", err)
+		return errors.New("failed to marshal payload")
+	}
+	client := &http.Client{Timeout: telemetryTimeout}
+	res, err := client.Post(u, "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		// The url could have a token in it, so the error (which
+		// includes it) is never returned or logged, only its cause.
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		slog.Error("sendTelemetry: Request failed", "error", err)
+		return errors.New("failed to send telemetry")
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		slog.Error("sendTelemetry: Non 2xx status code", "status_code", res.StatusCode)
+		return errors.New("failed to send telemetry, endpoint returned " + res.Status)
+	}
+	setTaskSummary(taskIdSendTelemetry, map[string]any{"users": p.Users, "tasks": p.Tasks.Total})
+	return nil
+}
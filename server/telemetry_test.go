@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTelemetryPayloadOnlyAggregates(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{
+		"test_telemetry": {
+			name: "Test Telemetry",
+			f: func() error {
+				return nil
+			},
+			dd: time.Hour,
+		},
+	})
+	db := newTestDb(t)
+	alice := User{Username: "alice"}
+	db.Create(&alice)
+	bob := User{Username: "bob"}
+	db.Create(&bob)
+	tracked := Content{TmdbID: 401, Title: "Tracked Movie", Type: MOVIE}
+	db.Create(&tracked)
+	show := Content{TmdbID: 402, Title: "Tracked Show", Type: SHOW}
+	db.Create(&show)
+	// Only cached, eg. from a search.
+	db.Create(&Content{TmdbID: 403, Title: "Searched Movie", Type: MOVIE})
+	removed := Content{TmdbID: 404, Title: "Removed Movie", Type: MOVIE}
+	db.Create(&removed)
+	db.Create(&Watched{UserID: alice.ID, ContentID: &tracked.ID, Status: FINISHED})
+	db.Create(&Watched{UserID: bob.ID, ContentID: &tracked.ID, Status: WATCHING})
+	db.Create(&Watched{UserID: bob.ID, ContentID: &show.ID, Status: FINISHED})
+	w := Watched{UserID: alice.ID, ContentID: &removed.ID, Status: PLANNED}
+	db.Create(&w)
+	db.Delete(&w)
+
+	p, err := getTelemetryPayload(db)
+	if err != nil {
+		t.Fatalf("failed to build payload: %v", err)
+	}
+	if p.Users != 2 {
+		t.Errorf("got %d users, want 2", p.Users)
+	}
+	if want := map[ContentType]int64{MOVIE: 1, SHOW: 1}; !reflect.DeepEqual(p.Content, want) {
+		t.Errorf("got content %v, want only content on a watched list %v", p.Content, want)
+	}
+	if want := map[WatchedStatus]int64{FINISHED: 2, WATCHING: 1}; !reflect.DeepEqual(p.Watched, want) {
+		t.Errorf("got watched %v, want %v", p.Watched, want)
+	}
+	if p.Tasks.Total != 1 {
+		t.Errorf("got %d tasks, want 1", p.Tasks.Total)
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("failed to marshal payload: %v", err)
+	}
+	for _, private := range []string{"alice", "bob", "Tracked Movie", "401"} {
+		if strings.Contains(string(b), private) {
+			t.Errorf("payload includes %q: %s", private, b)
+		}
+	}
+}
+
+func TestSendTelemetryOptIn(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{})
+	db := newTestDb(t)
+	var (
+		posts   atomic.Int32
+		payload TelemetryPayload
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts.Add(1)
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("failed to decode sent payload: %v", err)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	for _, c := range []struct {
+		enabled bool
+		url     string
+	}{
+		{false, ""},
+		{true, ""},
+		{false, srv.URL},
+	} {
+		Config.TASK_TELEMETRY, Config.TASK_TELEMETRY_URL = c.enabled, c.url
+		if isTelemetryEnabled() {
+			t.Errorf("telemetry enabled with flag %v and url %q", c.enabled, c.url)
+		}
+		if err := sendTelemetry(db); err != nil {
+			t.Errorf("send failed while disabled: %v", err)
+		}
+	}
+	if n := posts.Load(); n != 0 {
+		t.Fatalf("sent telemetry %d times without opting in", n)
+	}
+
+	Config.TASK_TELEMETRY, Config.TASK_TELEMETRY_URL = true, srv.URL
+	if err := sendTelemetry(db); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if n := posts.Load(); n != 1 || payload.Version != telemetryPayloadVersion {
+		t.Errorf("sent %d times with payload %+v, want the payload once", n, payload)
+	}
+}
+
+func TestSendTelemetryFailureHidesUrl(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{})
+	db := newTestDb(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	// Closed, so sending fails.
+	srv.Close()
+	logs := useTestLogs(t)
+
+	Config.TASK_TELEMETRY, Config.TASK_TELEMETRY_URL = true, srv.URL+"/secret_token"
+	err := sendTelemetry(db)
+	if err == nil {
+		t.Fatal("send to a closed server didn't fail")
+	}
+	if strings.Contains(err.Error(), "secret_token") {
+		t.Errorf("returned error has the url in it: %v", err)
+	}
+	if strings.Contains(logs.String(), "secret_token") {
+		t.Errorf("logs have the url in them: %s", logs)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"os"
 	"time"
 )
 
@@ -256,6 +257,42 @@ type WatchProvider struct {
 	ProviderID      int    `json:"provider_id"`
 	ProviderName    string `json:"provider_name"`
 	DisplayPriority int    `json:"display_priority"`
+	LogoPath        string `json:"logo_path"`
+}
+
+// Only the collection of /movie/{id}, for when that is all we need.
+type TMDBMovieCollectionRef struct {
+	BelongsToCollection *struct {
+		ID int `json:"id"`
+	} `json:"belongs_to_collection"`
+}
+
+// Response of /collection/{id}.
+type TMDBCollectionDetails struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	PosterPath string `json:"poster_path"`
+	Parts      []struct {
+		ID          int    `json:"id"`
+		Title       string `json:"title"`
+		PosterPath  string `json:"poster_path"`
+		ReleaseDate string `json:"release_date"`
+	} `json:"parts"`
+}
+
+// Response of /{movie,tv}/{id}/watch/providers.
+type TMDBWatchProviders struct {
+	ID int `json:"id"`
+	// Keyed by region (eg. `US`), regions without any providers are left out.
+	Results map[string]TMDBRegionWatchProviders `json:"results"`
+}
+
+type TMDBRegionWatchProviders struct {
+	Link     string          `json:"link"`
+	Flatrate []WatchProvider `json:"flatrate"`
+	Free     []WatchProvider `json:"free"`
+	Rent     []WatchProvider `json:"rent"`
+	Buy      []WatchProvider `json:"buy"`
 }
 
 type TMDBContentVideos struct {
@@ -601,6 +638,17 @@ type TMDBRegions struct {
 	} `json:"results"`
 }
 
+// Error for a non 200 response from tmdb.
+// Its message is the response body, like errors from tmdb have always been.
+type TMDBStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e TMDBStatusError) Error() string {
+	return e.Body
+}
+
 func getTMDBKey() string {
 	if Config.TMDB_KEY != "" {
 		return Config.TMDB_KEY
@@ -609,8 +657,20 @@ func getTMDBKey() string {
 }
 
 func tmdbAPIRequest(ep string, p map[string]string) ([]byte, error) {
-	slog.Debug("tmdbAPIRequest", "endpoint", ep, "params", p)
-	base, err := url.Parse("https://api.themoviedb.org/3")
+	return tmdbAPIRequestAs(TMDB_TIER_USER, ep, p)
+}
+
+// Make a tmdb api request for a task, it waits for quota left over
+// from user requests (see `takeTMDBQuota`). The request counts towards
+// the workload of task `task`, see `getTaskIntervalConstraints`.
+func tmdbTaskAPIRequest(task string, ep string, p map[string]string) ([]byte, error) {
+	countTaskRequest(task)
+	return tmdbAPIRequestAs(TMDB_TIER_TASK, ep, p)
+}
+
+func tmdbAPIRequestAs(tier TMDBRequestTier, ep string, p map[string]string) ([]byte, error) {
+	slog.Debug("tmdbAPIRequest", "endpoint", ep, "params", p, "tier", tier)
+	base, err := url.Parse(tmdbAPIBase)
 	if err != nil {
 		return nil, errors.New("failed to parse api uri")
 	}
@@ -629,11 +689,15 @@ func tmdbAPIRequest(ep string, p map[string]string) ([]byte, error) {
 	// Add params to url
 	base.RawQuery = params.Encode()
 
+	if err := waitTMDBQuota(tier); err != nil {
+		return nil, err
+	}
 	// Run get request
 	res, err := http.Get(base.String())
 	if err != nil {
 		return nil, err
 	}
+	recordTMDBResponse(res)
 	body, err := io.ReadAll(res.Body)
 	res.Body.Close()
 	if err != nil {
@@ -641,13 +705,64 @@ func tmdbAPIRequest(ep string, p map[string]string) ([]byte, error) {
 	}
 	if res.StatusCode != 200 {
 		slog.Error("TMDB non 200 status code:", "status_code", res.StatusCode)
-		return nil, errors.New(string(body))
+		return nil, TMDBStatusError{StatusCode: res.StatusCode, Body: string(body)}
 	}
 	return body, nil
 }
 
 func tmdbRequest(ep string, p map[string]string, resp interface{}) error {
-	body, err := tmdbAPIRequest(ep, p)
+	return tmdbRequestAs(TMDB_TIER_USER, ep, p, resp)
+}
+
+// Like `tmdbRequest`, for tasks. See `tmdbTaskAPIRequest`.
+func tmdbTaskRequest(task string, ep string, p map[string]string, resp interface{}) error {
+	countTaskRequest(task)
+	return tmdbRequestAs(TMDB_TIER_TASK, ep, p, resp)
+}
+
+var (
+	// Base url of the tmdb api.
+	tmdbAPIBase = "https://api.themoviedb.org/3"
+	// Base url of tmdb images, followed by the size (eg. `w500`) and image path.
+	tmdbImageBase = "https://image.tmdb.org/t/p/"
+)
+
+// Make a tmdb request for task `task`, or for a user if `task` is empty.
+// For code shared by tasks and the api.
+func tmdbRequestFor(task string, ep string, p map[string]string, resp interface{}) error {
+	if task == "" {
+		return tmdbRequest(ep, p, resp)
+	}
+	return tmdbTaskRequest(task, ep, p, resp)
+}
+
+// Like `tmdbRequestFor`, returning the raw response.
+func tmdbAPIRequestFor(task string, ep string, p map[string]string) ([]byte, error) {
+	if task == "" {
+		return tmdbAPIRequest(ep, p)
+	}
+	return tmdbTaskAPIRequest(task, ep, p)
+}
+
+// Wait for quota for task `task` to download a tmdb image to `outf`.
+// Task image downloads count like their api requests, so a task fetching
+// lots of images is held back the same way. User downloads, and those
+// `download` would skip (not `force`d and already cached), don't wait.
+func waitTMDBImageQuota(task string, outf string, force bool) error {
+	if task == "" {
+		return nil
+	}
+	if !force {
+		if _, err := os.Stat(outf); err == nil {
+			return nil
+		}
+	}
+	countTaskRequest(task)
+	return waitTMDBQuota(TMDB_TIER_TASK)
+}
+
+func tmdbRequestAs(tier TMDBRequestTier, ep string, p map[string]string, resp interface{}) error {
+	body, err := tmdbAPIRequestAs(tier, ep, p)
 	if err != nil {
 		return err
 	}
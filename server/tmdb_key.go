@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type TMDBKeyState string
+
+var (
+	TMDB_KEY_VALID   TMDBKeyState = "VALID"
+	TMDB_KEY_INVALID TMDBKeyState = "INVALID"
+	// Tmdb couldn't be reached (or answered with an error that wasn't
+	// about our key), so we don't know.
+	TMDB_KEY_UNKNOWN TMDBKeyState = "UNKNOWN"
+)
+
+// Last known state of our tmdb api key, from the Check TMDB Key task.
+type TMDBKeyStatus struct {
+	State TMDBKeyState `json:"state"`
+	// Why the last check failed, empty if the key is valid.
+	Error string `json:"error,omitempty"`
+	// Zero if the key hasn't been checked since startup.
+	CheckedAt time.Time `json:"checkedAt"`
+	// When State last changed.
+	Since time.Time `json:"since"`
+}
+
+var (
+	tmdbKeyStatus = TMDBKeyStatus{State: TMDB_KEY_UNKNOWN}
+	// If admins were told the key is invalid, since it was last valid.
+	// Checks that can't reach tmdb in between don't reset it, so a flaky
+	// connection doesn't notify them again each time the key is rejected.
+	tmdbKeyInvalidNotified bool
+	tmdbKeyStatusMu        sync.Mutex
+)
+
+// Check our tmdb api key is still accepted, with a cheap authenticated
+// request. Admins are notified once when the key becomes invalid, not on
+// every failed check, and not when tmdb just can't be reached.
+func checkTMDBKey(db *gorm.DB) error {
+	state := TMDB_KEY_VALID
+	var checkErr error
+	if _, err := tmdbTaskAPIRequest("check_tmdb_key", "/authentication", map[string]string{}); err != nil {
+		var se TMDBStatusError
+		if errors.As(err, &se) && se.StatusCode == http.StatusUnauthorized {
+			state = TMDB_KEY_INVALID
+			checkErr = errors.New("tmdb rejected our api key")
+		} else {
+			// Errors include the request url (with our key), so aren't returned as is.
+			slog.Debug("checkTMDBKey: TMDB request failed.", "error", err)
+			state = TMDB_KEY_UNKNOWN
+			checkErr = errors.New("request to tmdb failed")
+		}
+	}
+	now := time.Now()
+	tmdbKeyStatusMu.Lock()
+	prev := tmdbKeyStatus.State
+	tmdbKeyStatus.CheckedAt = now
+	tmdbKeyStatus.Error = ""
+	if checkErr != nil {
+		tmdbKeyStatus.Error = checkErr.Error()
+	}
+	if state != prev {
+		tmdbKeyStatus.State = state
+		tmdbKeyStatus.Since = now
+	}
+	notify := state == TMDB_KEY_INVALID && !tmdbKeyInvalidNotified
+	switch state {
+	case TMDB_KEY_INVALID:
+		tmdbKeyInvalidNotified = true
+	case TMDB_KEY_VALID:
+		tmdbKeyInvalidNotified = false
+	}
+	tmdbKeyStatusMu.Unlock()
+	if notify {
+		slog.Error("checkTMDBKey: TMDB api key is invalid, metadata features will not work until it is replaced.")
+		notifyAdmins(db, NOTIFICATION_TMDB_KEY, "TMDB rejected the server's api key, so searching and fetching details won't work. Set a valid TMDB_KEY in the server settings.")
+	} else if state == TMDB_KEY_VALID && prev == TMDB_KEY_INVALID {
+		slog.Info("checkTMDBKey: TMDB api key is valid again.")
+	}
+	setTaskSummary("check_tmdb_key", map[string]any{"state": state})
+	return checkErr
+}
+
+// Get the last known state of our tmdb api key.
+func getTMDBKeyStatus() TMDBKeyStatus {
+	tmdbKeyStatusMu.Lock()
+	defer tmdbKeyStatusMu.Unlock()
+	return tmdbKeyStatus
+}
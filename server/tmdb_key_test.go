@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Reset the known tmdb key state until the test ends.
+func useTestTMDBKeyStatus(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		tmdbKeyStatusMu.Lock()
+		tmdbKeyStatus = TMDBKeyStatus{State: TMDB_KEY_UNKNOWN}
+		tmdbKeyInvalidNotified = false
+		tmdbKeyStatusMu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestCheckTMDBKeyInvalidNotifiesOnce(t *testing.T) {
+	useTestConfig(t)
+	useTestTMDBLimiter(t)
+	useTestTMDBKeyStatus(t)
+	Config.TASK_DEFAULTS.DisableAfterFailures = 1
+	var status atomic.Int32
+	useTestTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/3/authentication" {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+		w.WriteHeader(int(status.Load()))
+		w.Write([]byte(`{"success":true}`))
+	}))
+	useTestScheduler(t, map[string]TaskFunc{
+		"check_tmdb_key": {
+			name: "Check TMDB Key",
+			f: func() error {
+				return checkTMDBKey(taskDb)
+			},
+			dd:            24 * time.Hour,
+			noAutoDisable: true,
+		},
+	})
+	taskDb = newTestDb(t)
+	admin := User{Username: "admin", Permissions: PERM_ADMIN}
+	if err := taskDb.Create(&admin).Error; err != nil {
+		t.Fatalf("failed to create admin: %v", err)
+	}
+	countNotifs := func() int64 {
+		var n int64
+		taskDb.Model(&Notification{}).Where("user_id = ? AND type = ?", admin.ID, NOTIFICATION_TMDB_KEY).Count(&n)
+		return n
+	}
+
+	status.Store(http.StatusUnauthorized)
+	if out := runTaskOutcome("check_tmdb_key"); out.Result != TASK_RUN_FAILED {
+		t.Fatalf("check with a rejected key was %s, want failed", out.Result)
+	}
+	if s := getTMDBKeyStatus(); s.State != TMDB_KEY_INVALID || s.CheckedAt.IsZero() {
+		t.Fatalf("got key status %+v, want invalid", s)
+	}
+	if n := countNotifs(); n != 1 {
+		t.Fatalf("admin got %d notifications, want 1", n)
+	}
+
+	// Flapping between unreachable and rejected doesn't notify again.
+	for _, code := range []int32{http.StatusInternalServerError, http.StatusUnauthorized, http.StatusBadGateway, http.StatusUnauthorized} {
+		status.Store(code)
+		runTaskOutcome("check_tmdb_key")
+	}
+	if n := countNotifs(); n != 1 {
+		t.Errorf("admin got %d notifications after flapping, want 1", n)
+	}
+	if isTaskDisabled("check_tmdb_key") {
+		t.Error("check task was auto disabled for finding the key invalid")
+	}
+
+	// Once it's valid again, the next time it's rejected is news.
+	status.Store(http.StatusOK)
+	runTaskOutcome("check_tmdb_key")
+	if s := getTMDBKeyStatus(); s.State != TMDB_KEY_VALID || s.Error != "" {
+		t.Fatalf("got key status %+v, want valid", s)
+	}
+	status.Store(http.StatusUnauthorized)
+	runTaskOutcome("check_tmdb_key")
+	if n := countNotifs(); n != 2 {
+		t.Errorf("admin got %d notifications, want 2 after the key was rejected again", n)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Who a tmdb request is for, user requests take precedence over tasks.
+type TMDBRequestTier string
+
+var (
+	// Requests a user is waiting on (eg. search, details).
+	TMDB_TIER_USER TMDBRequestTier = "user"
+	// Requests made by tasks in the background.
+	TMDB_TIER_TASK TMDBRequestTier = "task"
+)
+
+const (
+	// Default max tmdb requests per second, across all requests.
+	tmdbLimiterDefaultLimit = 40
+	// Default share (percent) of each second kept for user requests.
+	tmdbLimiterDefaultReserve = 25
+	// How often waiting task requests check if they can go yet.
+	tmdbLimiterPoll = 50 * time.Millisecond
+)
+
+// Longest a task request waits for quota before giving up, so a task
+// can't be held up forever (eg. by a long Retry-After from tmdb).
+var tmdbLimiterMaxWait = 2 * time.Minute
+
+// Current use of the shared tmdb request quota.
+type TMDBQuotaUsage struct {
+	// Max requests per second (TMDB_RATE_LIMIT).
+	Limit int `json:"limit"`
+	// Requests per second only user requests can use (TMDB_USER_RESERVE).
+	Reserved int `json:"reserved"`
+	// Requests made in the last second, by tier.
+	LastSecond map[TMDBRequestTier]int `json:"lastSecond"`
+	// Task requests that had to wait for quota since startup,
+	// and how long they waited in total.
+	TaskWaits  int64 `json:"taskWaits"`
+	TaskWaitMs int64 `json:"taskWaitMs"`
+}
+
+type tmdbLimiterRequest struct {
+	at   time.Time
+	tier TMDBRequestTier
+}
+
+var (
+	// Requests made in the last second, oldest first.
+	tmdbLimiterRecent     []tmdbLimiterRequest
+	tmdbLimiterTaskWaits  int64
+	tmdbLimiterTaskWaitMs int64
+	tmdbLimiterMu         sync.Mutex
+)
+
+func getTMDBLimiterLimit() int {
+	if Config.TMDB_RATE_LIMIT > 0 {
+		return Config.TMDB_RATE_LIMIT
+	}
+	return tmdbLimiterDefaultLimit
+}
+
+// Requests per second kept for user requests. At least one request
+// per second is always left for tasks, so they can't be stalled forever.
+func getTMDBLimiterReserved() int {
+	reserve := tmdbLimiterDefaultReserve
+	if Config.TMDB_USER_RESERVE > 0 && Config.TMDB_USER_RESERVE <= 100 {
+		reserve = Config.TMDB_USER_RESERVE
+	}
+	limit := getTMDBLimiterLimit()
+	return max(min(limit*reserve/100, limit-1), 0)
+}
+
+// Remove requests older than a second. Must hold tmdbLimiterMu.
+func pruneTMDBLimiter(now time.Time) {
+	i := 0
+	for i < len(tmdbLimiterRecent) && now.Sub(tmdbLimiterRecent[i].at) >= time.Second {
+		i++
+	}
+	tmdbLimiterRecent = tmdbLimiterRecent[i:]
+}
+
+// Try to take quota for a request. User requests always get it, going
+// over the limit is better than making a user wait (tmdb will tell us
+// with a 429 if it is really too much). Task requests only get what
+// isn't reserved for users, and none while tmdb is asking us to wait
+// (Retry-After), so they back off as user demand goes up.
+func takeTMDBQuota(tier TMDBRequestTier, now time.Time) bool {
+	tmdbLimiterMu.Lock()
+	defer tmdbLimiterMu.Unlock()
+	pruneTMDBLimiter(now)
+	if tier == TMDB_TIER_TASK {
+		tmdbRateLimitBucketsMu.Lock()
+		throttled := now.Before(tmdbRetryAfter)
+		tmdbRateLimitBucketsMu.Unlock()
+		if throttled || len(tmdbLimiterRecent) >= getTMDBLimiterLimit()-getTMDBLimiterReserved() {
+			return false
+		}
+	}
+	tmdbLimiterRecent = append(tmdbLimiterRecent, tmdbLimiterRequest{at: now, tier: tier})
+	return true
+}
+
+// Wait for quota to make a tmdb request, see `takeTMDBQuota`.
+// Only task requests ever wait, they give up after `tmdbLimiterMaxWait`.
+func waitTMDBQuota(tier TMDBRequestTier) error {
+	if takeTMDBQuota(tier, time.Now()) {
+		return nil
+	}
+	start := time.Now()
+	deadline := start.Add(tmdbLimiterMaxWait)
+	var err error
+	for !takeTMDBQuota(tier, time.Now()) {
+		if time.Now().After(deadline) {
+			slog.Warn("waitTMDBQuota: Gave up waiting for quota.", "tier", tier, "waited", time.Since(start))
+			err = errors.New("timed out waiting for tmdb quota")
+			break
+		}
+		time.Sleep(tmdbLimiterPoll)
+	}
+	tmdbLimiterMu.Lock()
+	tmdbLimiterTaskWaits++
+	tmdbLimiterTaskWaitMs += time.Since(start).Milliseconds()
+	tmdbLimiterMu.Unlock()
+	return err
+}
+
+// Get current use of the shared tmdb quota.
+func getTMDBQuotaUsage() TMDBQuotaUsage {
+	now := time.Now()
+	tmdbLimiterMu.Lock()
+	defer tmdbLimiterMu.Unlock()
+	pruneTMDBLimiter(now)
+	u := TMDBQuotaUsage{
+		Limit:      getTMDBLimiterLimit(),
+		Reserved:   getTMDBLimiterReserved(),
+		LastSecond: map[TMDBRequestTier]int{TMDB_TIER_USER: 0, TMDB_TIER_TASK: 0},
+		TaskWaits:  tmdbLimiterTaskWaits,
+		TaskWaitMs: tmdbLimiterTaskWaitMs,
+	}
+	for _, r := range tmdbLimiterRecent {
+		u.LastSecond[r.tier]++
+	}
+	return u
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Clear limiter state until the test ends.
+func useTestTMDBLimiter(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		tmdbLimiterMu.Lock()
+		tmdbLimiterRecent = nil
+		tmdbLimiterMu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestTMDBUserReserveLeavesQuotaForTasks(t *testing.T) {
+	useTestConfig(t)
+	Config.TMDB_RATE_LIMIT = 4
+	Config.TMDB_USER_RESERVE = 100
+	if r := getTMDBLimiterReserved(); r != 3 {
+		t.Errorf("reserved %d of 4, want 3", r)
+	}
+	Config.TMDB_RATE_LIMIT = 1
+	if r := getTMDBLimiterReserved(); r != 0 {
+		t.Errorf("reserved %d of 1, want 0", r)
+	}
+}
+
+func TestTMDBTaskQuotaWaitsForNextSecond(t *testing.T) {
+	useTestConfig(t)
+	useTestTMDBLimiter(t)
+	Config.TMDB_RATE_LIMIT = 4
+	Config.TMDB_USER_RESERVE = 100
+	now := time.Now()
+	if !takeTMDBQuota(TMDB_TIER_TASK, now) {
+		t.Fatal("first task request didn't get quota")
+	}
+	if takeTMDBQuota(TMDB_TIER_TASK, now) {
+		t.Error("second task request got quota in the same second")
+	}
+	for i := 0; i < 5; i++ {
+		if !takeTMDBQuota(TMDB_TIER_USER, now) {
+			t.Fatal("user request didn't get quota")
+		}
+	}
+	if !takeTMDBQuota(TMDB_TIER_TASK, now.Add(time.Second)) {
+		t.Error("task request didn't get quota the next second")
+	}
+}
+
+func TestWaitTMDBQuotaGivesUp(t *testing.T) {
+	useTestConfig(t)
+	useTestTMDBLimiter(t)
+	old := tmdbLimiterMaxWait
+	tmdbLimiterMaxWait = 100 * time.Millisecond
+	t.Cleanup(func() {
+		tmdbLimiterMaxWait = old
+	})
+	tmdbRateLimitBucketsMu.Lock()
+	oldRetry := tmdbRetryAfter
+	tmdbRetryAfter = time.Now().Add(time.Hour)
+	tmdbRateLimitBucketsMu.Unlock()
+	t.Cleanup(func() {
+		tmdbRateLimitBucketsMu.Lock()
+		tmdbRetryAfter = oldRetry
+		tmdbRateLimitBucketsMu.Unlock()
+	})
+	start := time.Now()
+	if err := waitTMDBQuota(TMDB_TIER_TASK); err == nil {
+		t.Fatal("got quota while tmdb asked us to wait")
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Errorf("waited %s before giving up, want about 100ms", waited)
+	}
+	if err := waitTMDBQuota(TMDB_TIER_USER); err != nil {
+		t.Errorf("user request failed to get quota: %v", err)
+	}
+}
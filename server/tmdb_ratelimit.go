@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// How long tmdb responses are kept count of.
+	tmdbRateLimitKeep = 24 * time.Hour
+	// Default 429s in an hour after which the Check TMDB Rate Limits task warns.
+	tmdbRateLimitDefaultWarn = 10
+)
+
+// TMDB responses (and how many were 429s) in a minute.
+type tmdbRateLimitBucket struct {
+	requests    int
+	rateLimited int
+}
+
+// TMDB responses over a window of time.
+type TMDBRateLimitWindow struct {
+	Requests    int `json:"requests"`
+	RateLimited int `json:"rateLimited"`
+}
+
+// Which way 429s from tmdb are going, this hour compared to the one before.
+type TMDBRateLimitTrend string
+
+var (
+	TMDB_RATE_LIMIT_RISING  TMDBRateLimitTrend = "rising"
+	TMDB_RATE_LIMIT_STEADY  TMDBRateLimitTrend = "steady"
+	TMDB_RATE_LIMIT_FALLING TMDBRateLimitTrend = "falling"
+)
+
+// How often the server has been rate limited by tmdb recently.
+// Counts are since startup, for at most the last 24 hours.
+type TMDBRateLimitSummary struct {
+	Last5Minutes TMDBRateLimitWindow `json:"last5Minutes"`
+	LastHour     TMDBRateLimitWindow `json:"lastHour"`
+	Last24Hours  TMDBRateLimitWindow `json:"last24Hours"`
+	// 429s in each of the last 24 hours, oldest first.
+	Hourly []int              `json:"hourly"`
+	Trend  TMDBRateLimitTrend `json:"trend"`
+	// Set once tmdb has rate limited us since startup.
+	LastRateLimitedAt *time.Time `json:"lastRateLimitedAt,omitempty"`
+	// When tmdb asked us to wait until (Retry-After) in its last 429.
+	// Task requests are held back until then, user requests aren't.
+	RetryAfter *time.Time `json:"retryAfter,omitempty"`
+	// If tmdb is currently asking us to wait (RetryAfter is in the future).
+	Throttled bool `json:"throttled"`
+	// 429s in an hour the Check TMDB Rate Limits task warns at.
+	WarnAt int `json:"warnAt"`
+	// Current use of the request quota shared by users and tasks.
+	Quota TMDBQuotaUsage `json:"quota"`
+}
+
+var (
+	// Counts of tmdb responses, by unix minute.
+	tmdbRateLimitBuckets   = map[int64]*tmdbRateLimitBucket{}
+	tmdbLastRateLimitedAt  time.Time
+	tmdbRetryAfter         time.Time
+	tmdbRateLimitBucketsMu sync.Mutex
+)
+
+// Record a response from tmdb, for the rate limit summary.
+func recordTMDBResponse(res *http.Response) {
+	now := time.Now()
+	minute := now.Unix() / 60
+	tmdbRateLimitBucketsMu.Lock()
+	defer tmdbRateLimitBucketsMu.Unlock()
+	b, ok := tmdbRateLimitBuckets[minute]
+	if !ok {
+		b = &tmdbRateLimitBucket{}
+		tmdbRateLimitBuckets[minute] = b
+		// Only pruned when a new minute starts, the rest of the time
+		// there is nothing new to remove.
+		oldest := now.Add(-tmdbRateLimitKeep).Unix() / 60
+		for m := range tmdbRateLimitBuckets {
+			if m < oldest {
+				delete(tmdbRateLimitBuckets, m)
+			}
+		}
+	}
+	b.requests++
+	if res.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+	b.rateLimited++
+	tmdbLastRateLimitedAt = now
+	if s, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && s > 0 {
+		tmdbRetryAfter = now.Add(time.Duration(s) * time.Second)
+	}
+}
+
+func getTMDBRateLimitWarn() int {
+	if Config.TASK_TMDB_RATE_LIMIT_WARN > 0 {
+		return Config.TASK_TMDB_RATE_LIMIT_WARN
+	}
+	return tmdbRateLimitDefaultWarn
+}
+
+// Summarize how often tmdb has rate limited us recently.
+func getTMDBRateLimitSummary() TMDBRateLimitSummary {
+	now := time.Now()
+	minute := now.Unix() / 60
+	s := TMDBRateLimitSummary{Hourly: make([]int, 24), WarnAt: getTMDBRateLimitWarn(), Quota: getTMDBQuotaUsage()}
+	tmdbRateLimitBucketsMu.Lock()
+	defer tmdbRateLimitBucketsMu.Unlock()
+	for m, b := range tmdbRateLimitBuckets {
+		ago := minute - m
+		if ago < 0 || ago >= 24*60 {
+			continue
+		}
+		if ago < 5 {
+			s.Last5Minutes.Requests += b.requests
+			s.Last5Minutes.RateLimited += b.rateLimited
+		}
+		if ago < 60 {
+			s.LastHour.Requests += b.requests
+			s.LastHour.RateLimited += b.rateLimited
+		}
+		s.Last24Hours.Requests += b.requests
+		s.Last24Hours.RateLimited += b.rateLimited
+		s.Hourly[23-ago/60] += b.rateLimited
+	}
+	switch cur, prev := s.Hourly[23], s.Hourly[22]; {
+	case cur > prev:
+		s.Trend = TMDB_RATE_LIMIT_RISING
+	case cur < prev:
+		s.Trend = TMDB_RATE_LIMIT_FALLING
+	default:
+		s.Trend = TMDB_RATE_LIMIT_STEADY
+	}
+	if !tmdbLastRateLimitedAt.IsZero() {
+		t := tmdbLastRateLimitedAt
+		s.LastRateLimitedAt = &t
+	}
+	if !tmdbRetryAfter.IsZero() {
+		t := tmdbRetryAfter
+		s.RetryAfter = &t
+		s.Throttled = now.Before(t)
+	}
+	return s
+}
+
+// Check how often tmdb has been rate limiting us, warning when it
+// happened TASK_TMDB_RATE_LIMIT_WARN times or more in the last hour,
+// so admins can slow down tasks that use it.
+func checkTMDBRateLimits() error {
+	s := getTMDBRateLimitSummary()
+	setTaskSummary("check_tmdb_rate_limits", map[string]any{
+		"requests":    s.LastHour.Requests,
+		"rateLimited": s.LastHour.RateLimited,
+		"trend":       s.Trend,
+	})
+	if s.LastHour.RateLimited >= s.WarnAt {
+		slog.Warn("checkTMDBRateLimits: Rate limited by tmdb often in the last hour. Consider running tasks that use tmdb less often.", "rate_limited", s.LastHour.RateLimited, "requests", s.LastHour.Requests, "trend", s.Trend)
+		return errors.New("rate limited by tmdb " + strconv.Itoa(s.LastHour.RateLimited) + " times in the last hour")
+	}
+	return nil
+}
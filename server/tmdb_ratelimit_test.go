@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Clear recorded tmdb responses until the test ends.
+func useTestTMDBRateLimits(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		tmdbRateLimitBucketsMu.Lock()
+		tmdbRateLimitBuckets = map[int64]*tmdbRateLimitBucket{}
+		tmdbLastRateLimitedAt = time.Time{}
+		tmdbRetryAfter = time.Time{}
+		tmdbRateLimitBucketsMu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestTMDBRateLimitSummary(t *testing.T) {
+	useTestConfig(t)
+	useTestTMDBLimiter(t)
+	useTestTMDBRateLimits(t)
+	useTestScheduler(t, map[string]TaskFunc{})
+	Config.TASK_TMDB_RATE_LIMIT_WARN = 4
+	useTestTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/3/movie/limited") {
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	// Rate limited more the hour before.
+	tmdbRateLimitBucketsMu.Lock()
+	tmdbRateLimitBuckets[time.Now().Unix()/60-90] = &tmdbRateLimitBucket{requests: 20, rateLimited: 6}
+	tmdbRateLimitBucketsMu.Unlock()
+
+	var resp map[string]any
+	for _, ep := range []string{"/movie/1", "/movie/limited1", "/movie/2", "/movie/limited2", "/movie/limited3", "/movie/3"} {
+		err := tmdbRequest(ep, map[string]string{}, &resp)
+		if limited := strings.Contains(ep, "limited"); limited != (err != nil) {
+			t.Fatalf("request to %s failed with %v", ep, err)
+		}
+	}
+
+	s := getTMDBRateLimitSummary()
+	if want := (TMDBRateLimitWindow{Requests: 6, RateLimited: 3}); s.Last5Minutes != want || s.LastHour != want {
+		t.Errorf("got last 5 minutes %+v and hour %+v, want %+v", s.Last5Minutes, s.LastHour, want)
+	}
+	if want := (TMDBRateLimitWindow{Requests: 26, RateLimited: 9}); s.Last24Hours != want {
+		t.Errorf("got last 24 hours %+v, want %+v", s.Last24Hours, want)
+	}
+	wantHourly := make([]int, 24)
+	wantHourly[22], wantHourly[23] = 6, 3
+	if !reflect.DeepEqual(s.Hourly, wantHourly) {
+		t.Errorf("got hourly %v, want %v", s.Hourly, wantHourly)
+	}
+	if s.Trend != TMDB_RATE_LIMIT_FALLING {
+		t.Errorf("got trend %s, want falling", s.Trend)
+	}
+	if !s.Throttled || s.RetryAfter == nil || s.RetryAfter.Before(time.Now().Add(50*time.Second)) || s.LastRateLimitedAt == nil {
+		t.Errorf("got throttled %v until %v, last limited at %v, want throttled for the Retry-After", s.Throttled, s.RetryAfter, s.LastRateLimitedAt)
+	}
+
+	if err := checkTMDBRateLimits(); err != nil {
+		t.Errorf("check warned at %d 429s in the hour, under the 4 it warns at: %v", s.LastHour.RateLimited, err)
+	}
+	tmdbRequest("/movie/limited4", map[string]string{}, &resp)
+	if err := checkTMDBRateLimits(); err == nil {
+		t.Error("check didn't warn at 4 429s in the hour")
+	}
+	want := map[string]any{"requests": 7, "rateLimited": 4, "trend": TMDB_RATE_LIMIT_FALLING}
+	if got := getTaskStatus("check_tmdb_rate_limits").Summary; !reflect.DeepEqual(got, want) {
+		t.Errorf("got task summary %v, want %v", got, want)
+	}
+
+	r, token := newTestTaskRouter(t, newTestDb(t))
+	w := doTestRequest(t, r, http.MethodGet, "/api/task/tmdb_rate_limits", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200: %s", w.Code, w.Body)
+	}
+	var got TMDBRateLimitSummary
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode summary: %v", err)
+	}
+	if got.LastHour.RateLimited != 4 || got.WarnAt != 4 || !got.Throttled {
+		t.Errorf("endpoint returned %+v, want 4 429s in the hour, warning at 4 and throttled", got)
+	}
+}
@@ -39,11 +39,74 @@ func createOneUseToken(db *gorm.DB, t TokenType, userId uint) (string, error) {
 }
 
 // Cleans up tokens older than 2m.
-func cleanupTokens(db *gorm.DB) {
+func cleanupTokens(db *gorm.DB) error {
 	slog.Debug("cleanupTokens: Cleaning up old tokens from db")
-	twoMinsAgo := time.Now().Add(-tokenMaxAge)
-	resp := db.Where("created_at < ?", twoMinsAgo).Delete(&Token{})
+	twoMinsAgo := taskClock.Now().Add(-tokenMaxAge)
+	resp := expiredTokens(db, tokenMaxAge).Delete(&Token{})
 	if resp.Error != nil {
 		slog.Error("cleanupTokens: Failed to run DELETE on old tokens!", "error", resp.Error)
+		return errors.New("failed to delete old tokens")
 	}
+	removed := resp.RowsAffected
+	// Count tokens still valid, a sudden rise could mean someone is abusing them.
+	var active int64
+	resp = db.Model(&Token{}).Where("created_at >= ?", twoMinsAgo).Count(&active)
+	if resp.Error != nil {
+		slog.Error("cleanupTokens: Failed to count active tokens!", "error", resp.Error)
+		return errors.New("failed to count active tokens")
+	}
+	setTaskSummary("cleanup_tokens", map[string]any{"removedTokens": removed, "activeTokens": active})
+	return nil
+}
+
+// Tokens older than `grace`, which a cleanup removes.
+// Shared by the cleanup and its preview, so they can't disagree.
+func expiredTokens(db *gorm.DB, grace time.Duration) *gorm.DB {
+	return db.Where("tokens.created_at < ?", taskClock.Now().Add(-grace))
+}
+
+// A token a cleanup would remove, without its value.
+type TokenCleanupPreviewToken struct {
+	ID        uint      `json:"id"`
+	UserID    uint      `json:"userId"`
+	Username  string    `json:"username"`
+	Type      TokenType `json:"type"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type TokenCleanupPreview struct {
+	// Grace period (seconds) the preview was made with.
+	Grace  int                        `json:"grace"`
+	Tokens []TokenCleanupPreviewToken `json:"tokens"`
+	// Ids of users that would lose a token.
+	Users []uint `json:"users"`
+}
+
+// Get the tokens a cleanup with a grace period of `grace` would remove,
+// without removing anything. Uses the tokens max age if `grace` isn't set.
+func previewTokenCleanup(db *gorm.DB, grace time.Duration) (TokenCleanupPreview, error) {
+	if grace < 0 {
+		return TokenCleanupPreview{}, errors.New("grace can't be negative")
+	}
+	if grace == 0 {
+		grace = tokenMaxAge
+	}
+	p := TokenCleanupPreview{Grace: int(grace.Seconds()), Tokens: []TokenCleanupPreviewToken{}, Users: []uint{}}
+	res := expiredTokens(db.Model(&Token{}), grace).
+		Select("tokens.id, tokens.user_id, users.username, tokens.type, tokens.created_at").
+		Joins("LEFT JOIN users ON users.id = tokens.user_id").
+		Order("tokens.created_at").
+		Scan(&p.Tokens)
+	if res.Error != nil {
+		slog.Error("previewTokenCleanup: Failed to get old tokens!", "error", res.Error)
+		return TokenCleanupPreview{}, errors.New("failed to get old tokens")
+	}
+	seen := map[uint]bool{}
+	for _, t := range p.Tokens {
+		if !seen[t.UserID] {
+			seen[t.UserID] = true
+			p.Users = append(p.Users, t.UserID)
+		}
+	}
+	return p, nil
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Add a token for `userId` created `ago`.
+func addTestToken(t *testing.T, db *gorm.DB, userId uint, ago time.Duration) Token {
+	t.Helper()
+	tk := Token{Value: "token", Type: TOKENTYPE_ADMIN, UserID: userId, CreatedAt: time.Now().Add(-ago)}
+	if err := db.Create(&tk).Error; err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	return tk
+}
+
+func TestCleanupTokensCountsActive(t *testing.T) {
+	useTestConfig(t)
+	resetTaskStatus("cleanup_tokens")
+	db := newTestDb(t)
+	for _, ago := range []time.Duration{time.Hour, 3 * time.Minute, 30 * time.Second, 0} {
+		addTestToken(t, db, 1, ago)
+	}
+	if err := cleanupTokens(db); err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+	s := getTaskStatus("cleanup_tokens").Summary
+	if s["removedTokens"] != int64(2) || s["activeTokens"] != int64(2) {
+		t.Errorf("got summary %v, want 2 removed and 2 active", s)
+	}
+	var left int64
+	db.Model(&Token{}).Count(&left)
+	if left != 2 {
+		t.Errorf("%d tokens left, want the 2 active", left)
+	}
+}
+
+func TestPreviewTokenCleanupMatchesCleanup(t *testing.T) {
+	useTestConfig(t)
+	useTestScheduler(t, map[string]TaskFunc{})
+	db := newTestDb(t)
+	r, token := newTestTaskRouter(t, db)
+	alice := User{Username: "alice"}
+	db.Create(&alice)
+	bob := User{Username: "bob"}
+	db.Create(&bob)
+	old := addTestToken(t, db, alice.ID, time.Hour)
+	expired := addTestToken(t, db, bob.ID, 3*time.Minute)
+	addTestToken(t, db, alice.ID, 30*time.Second)
+
+	preview := func(query string) TokenCleanupPreview {
+		t.Helper()
+		w := doTestRequest(t, r, http.MethodGet, "/api/task/cleanup_tokens/preview"+query, token, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got %d previewing with %q, want 200: %s", w.Code, query, w.Body)
+		}
+		var p TokenCleanupPreview
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatalf("failed to decode preview: %v", err)
+		}
+		return p
+	}
+	p := preview("?grace=600")
+	if len(p.Tokens) != 1 || p.Tokens[0].ID != old.ID || p.Tokens[0].Username != "alice" {
+		t.Errorf("got tokens %+v with a 10m grace, want only the hour old one", p.Tokens)
+	}
+	for _, q := range []string{"?grace=-1", "?grace=soon"} {
+		if w := doTestRequest(t, r, http.MethodGet, "/api/task/cleanup_tokens/preview"+q, token, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("got %d previewing with %q, want 400", w.Code, q)
+		}
+	}
+
+	p = preview("")
+	if want := []uint{alice.ID, bob.ID}; !reflect.DeepEqual(p.Users, want) {
+		t.Errorf("got users %v, want %v", p.Users, want)
+	}
+	var before []uint
+	db.Model(&Token{}).Pluck("id", &before)
+	if err := cleanupTokens(db); err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+	var after []uint
+	db.Model(&Token{}).Pluck("id", &after)
+	var removed []uint
+	for _, id := range before {
+		if !slices.Contains(after, id) {
+			removed = append(removed, id)
+		}
+	}
+	var previewed []uint
+	for _, tk := range p.Tokens {
+		previewed = append(previewed, tk.ID)
+	}
+	slices.Sort(removed)
+	slices.Sort(previewed)
+	if want := []uint{old.ID, expired.ID}; !reflect.DeepEqual(removed, want) || !reflect.DeepEqual(previewed, removed) {
+		t.Errorf("cleanup removed %v and the preview had %v, want both %v", removed, previewed, want)
+	}
+}
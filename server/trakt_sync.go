@@ -0,0 +1,468 @@
+// Trakt.tv sync.
+// Pushes users newly watched movies/episodes to their linked trakt account.
+// Requires TRAKT_SYNC to be configured with a trakt api app, users then
+// opt-in by linking their account (via trakts device code auth flow).
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TraktSyncSettings struct {
+	// Client ID of trakt api app.
+	ClientID string `json:",omitempty"`
+	// Client secret of trakt api app.
+	ClientSecret string `json:",omitempty"`
+}
+
+// A users linked trakt account.
+type TraktSync struct {
+	ID           uint      `gorm:"primarykey" json:"-"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"-"`
+	UserID       uint      `gorm:"uniqueIndex;not null" json:"-"`
+	AccessToken  string    `gorm:"not null" json:"-"`
+	RefreshToken string    `gorm:"not null" json:"-"`
+	ExpiresAt    time.Time `json:"-"`
+	// Sync cursor, only items watched after this are pushed to trakt.
+	LastSyncedAt time.Time `json:"lastSyncedAt"`
+	// Set when trakt rejects our refresh token, the user
+	// must link their account again for syncing to continue.
+	NeedsReauth bool `gorm:"not null;default:false" json:"needsReauth"`
+}
+
+// A watched movie or episode already pushed to a users trakt history.
+// Entries are edited (eg. rated) long after being watched, which moves
+// them past the sync cursor, these stop them being pushed again.
+type TraktSyncedItem struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint `gorm:"uniqueIndex:trakt_synced_item;not null"`
+	WatchedID uint `gorm:"uniqueIndex:trakt_synced_item;not null"`
+	// 0 for movies.
+	WatchedEpisodeID uint `gorm:"uniqueIndex:trakt_synced_item;not null;default:0"`
+}
+
+// How a users trakt sync went, for the tasks summary.
+type TraktSyncUserResult struct {
+	Pushed int    `json:"pushed"`
+	Error  string `json:"error,omitempty"`
+}
+
+type TraktDeviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURL string `json:"verification_url"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+type TraktLinkRequest struct {
+	// `device_code` returned when starting the link.
+	DeviceCode string `json:"deviceCode" binding:"required"`
+}
+
+type TraktTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+type TraktSyncHistoryIds struct {
+	Tmdb int `json:"tmdb"`
+}
+
+type TraktSyncHistoryMovie struct {
+	WatchedAt time.Time           `json:"watched_at"`
+	Ids       TraktSyncHistoryIds `json:"ids"`
+}
+
+type TraktSyncHistoryEpisode struct {
+	Number    int       `json:"number"`
+	WatchedAt time.Time `json:"watched_at"`
+}
+
+type TraktSyncHistorySeason struct {
+	Number   int                       `json:"number"`
+	Episodes []TraktSyncHistoryEpisode `json:"episodes"`
+}
+
+type TraktSyncHistoryShow struct {
+	Ids     TraktSyncHistoryIds      `json:"ids"`
+	Seasons []TraktSyncHistorySeason `json:"seasons"`
+}
+
+type TraktSyncHistoryRequest struct {
+	Movies []TraktSyncHistoryMovie `json:"movies"`
+	Shows  []TraktSyncHistoryShow  `json:"shows"`
+}
+
+var errTraktNeedsReauth = errors.New("trakt link needs to be relinked")
+
+// Base url of the trakt api.
+var traktAPIBase = "https://api.trakt.tv"
+
+// Trakt sync is opt-in, only enabled when configured.
+func isTraktSyncEnabled() bool {
+	return Config.TRAKT_SYNC.ClientID != "" && Config.TRAKT_SYNC.ClientSecret != ""
+}
+
+// Start linking a users trakt account.
+// The user must visit the returned `verification_url` and enter the
+// `user_code`, then call `traktSyncLinkFinish` with the `device_code`.
+func traktSyncLinkStart() (TraktDeviceCode, error) {
+	if !isTraktSyncEnabled() {
+		return TraktDeviceCode{}, errors.New("trakt sync is not enabled")
+	}
+	var dc TraktDeviceCode
+	_, err := traktAuthedRequest(http.MethodPost, "/oauth/device/code", "", map[string]string{
+		"client_id": Config.TRAKT_SYNC.ClientID,
+	}, &dc)
+	if err != nil {
+		slog.Error("traktSyncLinkStart: Failed to get device code", "error", err)
+		return TraktDeviceCode{}, errors.New("failed to start trakt link")
+	}
+	return dc, nil
+}
+
+// Finish linking a users trakt account.
+// Errors with `authorization pending` if the user hasn't entered their code yet.
+func traktSyncLinkFinish(db *gorm.DB, userId uint, req TraktLinkRequest) error {
+	if !isTraktSyncEnabled() {
+		return errors.New("trakt sync is not enabled")
+	}
+	var tr TraktTokenResponse
+	status, err := traktAuthedRequest(http.MethodPost, "/oauth/device/token", "", map[string]string{
+		"code":          req.DeviceCode,
+		"client_id":     Config.TRAKT_SYNC.ClientID,
+		"client_secret": Config.TRAKT_SYNC.ClientSecret,
+	}, &tr)
+	if err != nil {
+		switch status {
+		case http.StatusBadRequest, http.StatusTooManyRequests:
+			return errors.New("authorization pending")
+		case http.StatusGone:
+			return errors.New("code expired")
+		case http.StatusTeapot:
+			return errors.New("code denied")
+		}
+		slog.Error("traktSyncLinkFinish: Failed to get token", "status", status, "error", err)
+		return errors.New("failed to link trakt")
+	}
+	var ts TraktSync
+	// Map used so `needs_reauth` is reset when relinking.
+	res := db.Where(TraktSync{UserID: userId}).Assign(map[string]any{
+		"access_token":  tr.AccessToken,
+		"refresh_token": tr.RefreshToken,
+		"expires_at":    time.Unix(tr.CreatedAt+tr.ExpiresIn, 0),
+		// Only sync what is watched from now on.
+		"last_synced_at": time.Now(),
+		"needs_reauth":   false,
+	}).FirstOrCreate(&ts)
+	if res.Error != nil {
+		slog.Error("traktSyncLinkFinish: Failed to save link", "error", res.Error)
+		return errors.New("failed to save trakt link")
+	}
+	return nil
+}
+
+// Get a users trakt link, errors if not linked.
+func getTraktSync(db *gorm.DB, userId uint) (TraktSync, error) {
+	var ts TraktSync
+	res := db.Where("user_id = ?", userId).Take(&ts)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return TraktSync{}, errors.New("trakt not linked")
+		}
+		slog.Error("getTraktSync: Failed to get link", "error", res.Error)
+		return TraktSync{}, errors.New("failed to get trakt link")
+	}
+	return ts, nil
+}
+
+// Unlink a users trakt account.
+func traktSyncUnlink(db *gorm.DB, userId uint) error {
+	res := db.Where("user_id = ?", userId).Delete(&TraktSync{})
+	if res.Error != nil {
+		slog.Error("traktSyncUnlink: Failed to delete link", "error", res.Error)
+		return errors.New("failed to unlink trakt")
+	}
+	// Relinking only syncs what is watched from then on, these aren't needed.
+	if res := db.Where("user_id = ?", userId).Delete(&TraktSyncedItem{}); res.Error != nil {
+		slog.Error("traktSyncUnlink: Failed to delete synced items", "user_id", userId, "error", res.Error)
+	}
+	return nil
+}
+
+// Push newly watched items for all linked users to trakt.
+func syncToTrakt(db *gorm.DB) error {
+	if !isTraktSyncEnabled() {
+		slog.Debug("syncToTrakt: Trakt sync not enabled, skipping.")
+		return nil
+	}
+	var links []TraktSync
+	if res := db.Find(&links); res.Error != nil {
+		slog.Error("syncToTrakt: Failed to get linked users", "error", res.Error)
+		return errors.New("failed to get linked users")
+	}
+	var errs []error
+	// User id -> how their sync went.
+	users := map[string]TraktSyncUserResult{}
+	pushedTotal := 0
+	needsReauth := 0
+	for _, v := range links {
+		if v.NeedsReauth {
+			slog.Debug("syncToTrakt: Skipping user, their trakt link needs to be relinked.", "user_id", v.UserID)
+			needsReauth++
+			continue
+		}
+		pushed, err := syncUserToTrakt(db, &v)
+		r := TraktSyncUserResult{Pushed: pushed}
+		pushedTotal += pushed
+		if err != nil {
+			slog.Error("syncToTrakt: Failed to sync user", "user_id", v.UserID, "pushed", pushed, "error", err)
+			errs = append(errs, fmt.Errorf("user %d: %w", v.UserID, err))
+			r.Error = err.Error()
+		} else {
+			slog.Info("syncToTrakt: Synced user", "user_id", v.UserID, "pushed", pushed)
+		}
+		users[strconv.FormatUint(uint64(v.UserID), 10)] = r
+	}
+	setTaskSummary("sync_to_trakt", map[string]any{
+		"pushed":      pushedTotal,
+		"failedUsers": len(errs),
+		"needsReauth": needsReauth,
+		"users":       users,
+	})
+	return errors.Join(errs...)
+}
+
+// Push a users items watched since their sync cursor to trakt.
+// Items already pushed (see TraktSyncedItem) aren't pushed again.
+// Returns number of items pushed.
+func syncUserToTrakt(db *gorm.DB, ts *TraktSync) (int, error) {
+	// Refresh token if it expires before our next run would.
+	if time.Until(ts.ExpiresAt) < 24*time.Hour {
+		if _, err := traktSyncRefreshTokenWithin(db, ts, 24*time.Hour); err != nil {
+			return 0, err
+		}
+	}
+	syncStart := time.Now()
+	var movies []struct {
+		WatchedID uint
+		TmdbID    int
+		UpdatedAt time.Time
+	}
+	res := db.Model(&Watched{}).
+		Select("watcheds.id AS watched_id, contents.tmdb_id, watcheds.updated_at").
+		Joins("JOIN contents ON contents.id = watcheds.content_id AND contents.type = ?", MOVIE).
+		Joins("LEFT JOIN trakt_synced_items tsi ON tsi.user_id = watcheds.user_id AND tsi.watched_id = watcheds.id AND tsi.watched_episode_id = 0").
+		Where("watcheds.user_id = ? AND watcheds.status = ? AND watcheds.updated_at > ? AND tsi.id IS NULL", ts.UserID, FINISHED, ts.LastSyncedAt).
+		Scan(&movies)
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to get watched movies: %w", res.Error)
+	}
+	var episodes []struct {
+		WatchedEpisodeID uint
+		WatchedID        uint
+		TmdbID           int
+		SeasonNumber     int
+		EpisodeNumber    int
+		UpdatedAt        time.Time
+	}
+	res = db.Model(&WatchedEpisode{}).
+		Select("watched_episodes.id AS watched_episode_id, watched_episodes.watched_id, contents.tmdb_id, watched_episodes.season_number, watched_episodes.episode_number, watched_episodes.updated_at").
+		Joins("JOIN watcheds ON watcheds.id = watched_episodes.watched_id").
+		Joins("JOIN contents ON contents.id = watcheds.content_id").
+		Joins("LEFT JOIN trakt_synced_items tsi ON tsi.user_id = watched_episodes.user_id AND tsi.watched_id = watched_episodes.watched_id AND tsi.watched_episode_id = watched_episodes.id").
+		Where("watched_episodes.user_id = ? AND watched_episodes.status = ? AND watched_episodes.updated_at > ? AND tsi.id IS NULL", ts.UserID, FINISHED, ts.LastSyncedAt).
+		Scan(&episodes)
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to get watched episodes: %w", res.Error)
+	}
+	if len(movies) == 0 && len(episodes) == 0 {
+		return 0, nil
+	}
+	hr := TraktSyncHistoryRequest{
+		Movies: []TraktSyncHistoryMovie{},
+		Shows:  []TraktSyncHistoryShow{},
+	}
+	for _, v := range movies {
+		hr.Movies = append(hr.Movies, TraktSyncHistoryMovie{WatchedAt: v.UpdatedAt, Ids: TraktSyncHistoryIds{Tmdb: v.TmdbID}})
+	}
+	// Group episodes into their show and season.
+	shows := map[int]map[int][]TraktSyncHistoryEpisode{}
+	for _, v := range episodes {
+		if shows[v.TmdbID] == nil {
+			shows[v.TmdbID] = map[int][]TraktSyncHistoryEpisode{}
+		}
+		shows[v.TmdbID][v.SeasonNumber] = append(shows[v.TmdbID][v.SeasonNumber], TraktSyncHistoryEpisode{Number: v.EpisodeNumber, WatchedAt: v.UpdatedAt})
+	}
+	for tmdbId, seasons := range shows {
+		s := TraktSyncHistoryShow{Ids: TraktSyncHistoryIds{Tmdb: tmdbId}}
+		for num, eps := range seasons {
+			s.Seasons = append(s.Seasons, TraktSyncHistorySeason{Number: num, Episodes: eps})
+		}
+		hr.Shows = append(hr.Shows, s)
+	}
+	status, err := traktAuthedRequest(http.MethodPost, "/sync/history", ts.AccessToken, hr, nil)
+	if err != nil {
+		if status == http.StatusTooManyRequests {
+			// Cursor not moved, so these will be retried next run.
+			return 0, errors.New("rate limited by trakt, will retry next run")
+		}
+		return 0, fmt.Errorf("failed to push history: %w", err)
+	}
+	pushed := len(movies) + len(episodes)
+	synced := make([]TraktSyncedItem, 0, pushed)
+	for _, v := range movies {
+		synced = append(synced, TraktSyncedItem{UserID: ts.UserID, WatchedID: v.WatchedID})
+	}
+	for _, v := range episodes {
+		synced = append(synced, TraktSyncedItem{UserID: ts.UserID, WatchedID: v.WatchedID, WatchedEpisodeID: v.WatchedEpisodeID})
+	}
+	if res := db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&synced, 100); res.Error != nil {
+		return pushed, fmt.Errorf("pushed but failed to save synced items: %w", res.Error)
+	}
+	ts.LastSyncedAt = syncStart
+	if res := db.Model(ts).Update("last_synced_at", syncStart); res.Error != nil {
+		return pushed, fmt.Errorf("pushed but failed to save sync cursor: %w", res.Error)
+	}
+	return pushed, nil
+}
+
+var (
+	// Held while refreshing a users trakt token, by user id.
+	traktRefreshLocks   = map[uint]*sync.Mutex{}
+	traktRefreshLocksMu sync.Mutex
+)
+
+func getTraktRefreshLock(userId uint) *sync.Mutex {
+	traktRefreshLocksMu.Lock()
+	defer traktRefreshLocksMu.Unlock()
+	l, ok := traktRefreshLocks[userId]
+	if !ok {
+		l = &sync.Mutex{}
+		traktRefreshLocks[userId] = l
+	}
+	return l
+}
+
+// Refresh a users trakt access token if it expires within `within`.
+// Trakt refresh tokens can only be used once, and more than one task
+// refreshes them, so the link is read again under a per user lock and
+// `ts` updated from it. If another task refreshed it in the meantime,
+// nothing is sent. Returns whether the token was refreshed.
+func traktSyncRefreshTokenWithin(db *gorm.DB, ts *TraktSync, within time.Duration) (bool, error) {
+	l := getTraktRefreshLock(ts.UserID)
+	l.Lock()
+	defer l.Unlock()
+	var cur TraktSync
+	if res := db.Where("id = ?", ts.ID).Take(&cur); res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return false, errors.New("trakt link was removed")
+		}
+		return false, fmt.Errorf("failed to get trakt link: %w", res.Error)
+	}
+	*ts = cur
+	if ts.NeedsReauth {
+		return false, errTraktNeedsReauth
+	}
+	if time.Until(ts.ExpiresAt) >= within {
+		slog.Debug("traktSyncRefreshTokenWithin: Token was already refreshed.", "user_id", ts.UserID, "expires_at", ts.ExpiresAt)
+		return false, nil
+	}
+	if err := traktSyncRefreshToken(db, ts); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Refresh a users trakt access token and save it.
+// Use `traktSyncRefreshTokenWithin`, which stops
+// the same refresh token being sent twice.
+// If trakt rejects the refresh token, the link is flagged
+// as needing reauth and `errTraktNeedsReauth` is returned.
+func traktSyncRefreshToken(db *gorm.DB, ts *TraktSync) error {
+	var tr TraktTokenResponse
+	status, err := traktAuthedRequest(http.MethodPost, "/oauth/token", "", map[string]string{
+		"refresh_token": ts.RefreshToken,
+		"client_id":     Config.TRAKT_SYNC.ClientID,
+		"client_secret": Config.TRAKT_SYNC.ClientSecret,
+		"redirect_uri":  "urn:ietf:wg:oauth:2.0:oob",
+		"grant_type":    "refresh_token",
+	}, &tr)
+	if err != nil {
+		if status == http.StatusBadRequest || status == http.StatusUnauthorized {
+			ts.NeedsReauth = true
+			if res := db.Model(ts).Update("needs_reauth", true); res.Error != nil {
+				slog.Error("traktSyncRefreshToken: Failed to flag link as needing reauth", "user_id", ts.UserID, "error", res.Error)
+			}
+			return errTraktNeedsReauth
+		}
+		return fmt.Errorf("failed to refresh token: %w", err)
+	}
+	ts.AccessToken = tr.AccessToken
+	ts.RefreshToken = tr.RefreshToken
+	ts.ExpiresAt = time.Unix(tr.CreatedAt+tr.ExpiresIn, 0)
+	res := db.Model(ts).Updates(TraktSync{AccessToken: ts.AccessToken, RefreshToken: ts.RefreshToken, ExpiresAt: ts.ExpiresAt})
+	if res.Error != nil {
+		return fmt.Errorf("failed to save refreshed token: %w", res.Error)
+	}
+	return nil
+}
+
+// Make a request to the trakt api using our configured trakt app.
+// `token` is optional, only needed for requests made on behalf of a user.
+// Returns response status code, so callers can handle specific failures.
+func traktAuthedRequest(method string, ep string, token string, body any, resp any) (int, error) {
+	var rb io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		rb = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, traktAPIBase+ep, rb)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Add("trakt-api-key", Config.TRAKT_SYNC.ClientID)
+	req.Header.Add("trakt-api-version", "2")
+	req.Header.Add("Content-type", "application/json")
+	if token != "" {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if !(res.StatusCode >= 200 && res.StatusCode <= 299) {
+		if res.StatusCode == http.StatusTooManyRequests {
+			slog.Warn("traktAuthedRequest: Rate limited", "retry_after", res.Header.Get("Retry-After"))
+		}
+		return res.StatusCode, errors.New("non success status code: " + strconv.Itoa(res.StatusCode))
+	}
+	if resp != nil {
+		if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+			return res.StatusCode, err
+		}
+	}
+	return res.StatusCode, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Send trakt api requests to `handler` until the test ends.
+func useTestTrakt(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	old := traktAPIBase
+	traktAPIBase = srv.URL
+	t.Cleanup(func() {
+		traktAPIBase = old
+		srv.Close()
+	})
+}
+
+func TestSyncToTraktPushesEachItemOnce(t *testing.T) {
+	useTestConfig(t)
+	Config.TRAKT_SYNC = TraktSyncSettings{ClientID: "id", ClientSecret: "secret"}
+	var (
+		pushes []TraktSyncHistoryRequest
+		mu     sync.Mutex
+	)
+	useTestTrakt(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sync/history" {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var hr TraktSyncHistoryRequest
+		if err := json.NewDecoder(r.Body).Decode(&hr); err != nil {
+			t.Errorf("failed to decode pushed history: %v", err)
+		}
+		mu.Lock()
+		pushes = append(pushes, hr)
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	db := newTestDb(t)
+	user := User{Username: "trakt"}
+	db.Create(&user)
+	db.Create(&TraktSync{
+		UserID:       user.ID,
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Now().Add(30 * 24 * time.Hour),
+		LastSyncedAt: time.Now().Add(-time.Hour),
+	})
+	movie := Content{TmdbID: 603, Title: "The Matrix", Type: MOVIE}
+	db.Create(&movie)
+	w := Watched{UserID: user.ID, ContentID: &movie.ID, Status: FINISHED}
+	db.Create(&w)
+
+	if err := syncToTrakt(db); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if len(pushes) != 1 || len(pushes[0].Movies) != 1 || pushes[0].Movies[0].Ids.Tmdb != 603 {
+		t.Fatalf("got pushes %+v, want the watched movie", pushes)
+	}
+	s := getTaskStatus("sync_to_trakt").Summary
+	if s["pushed"] != 1 || s["failedUsers"] != 0 {
+		t.Errorf("got summary %v, want 1 pushed and no failures", s)
+	}
+
+	// Rating it later moves it past the cursor, but it was already pushed.
+	time.Sleep(10 * time.Millisecond)
+	db.Model(&w).Update("rating", 9)
+	if err := syncToTrakt(db); err != nil {
+		t.Fatalf("second sync failed: %v", err)
+	}
+	if len(pushes) != 1 {
+		t.Errorf("edited movie was pushed again: %+v", pushes[1:])
+	}
+}
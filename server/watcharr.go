@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -31,9 +32,15 @@ type GormModel struct {
 var (
 	ServerInSetup = false
 	logLevel      = new(slog.LevelVar)
+	// Log file we write to, nil if only logging to stdout.
+	logFile *lumberjack.Logger
 )
 
 func main() {
+	// Run a single task then exit, instead of starting the server (see `runTaskCli`).
+	runTaskId := flag.String("run-task", "", "Run a single task by id to completion, then exit.")
+	flag.Parse()
+
 	err := godotenv.Load()
 	if err != nil {
 		// Do not fail if file does not exist
@@ -50,6 +57,7 @@ func main() {
 	}
 
 	setLoggingLevel()
+	setLogFileConfig()
 
 	// Ensure data dir exists
 	err = ensureDirExists(DataPath)
@@ -69,24 +77,16 @@ func main() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	err = db.AutoMigrate(
-		&User{},
-		&UserServices{},
-		&Content{},
-		&Watched{},
-		&WatchedSeason{},
-		&WatchedEpisode{},
-		&Activity{},
-		&Token{},
-		&Follow{},
-		&Image{},
-		&Game{},
-		&ArrRequest{},
-		&Tag{},
-	)
+	err = db.AutoMigrate(dbModels...)
 	if err != nil {
 		log.Fatal("Failed to auto migrate database:", err)
 	}
+	ensureTaskIndexes(db)
+	checkMigrationsAtStartup(db)
+
+	if *runTaskId != "" {
+		os.Exit(runTaskCli(db, *runTaskId))
+	}
 
 	if isProd {
 		go runUI()
@@ -126,6 +126,7 @@ func main() {
 			proxy.ServeHTTP(c.Writer, c.Request)
 		})
 	}
+	startEventBus(db)
 	br := newBaseRouter(db, gine.Group("/api"))
 	// Only add setup routes if there are no users found in db.
 	var userCount int64
@@ -156,9 +157,11 @@ func main() {
 	br.addSonarrRoutes()
 	br.addRadarrRoutes()
 	br.addArrRequestRoutes()
+	br.addArrQueueRoutes()
 	br.addJobRoutes()
 	br.addTaskRoutes()
 	br.addTagRoutes()
+	br.addNotificationRoutes()
 	br.rg.Static("/img", path.Join(DataPath, "img"))
 
 	go setupTasks(db)
@@ -169,13 +172,14 @@ func main() {
 // Setup slog defaults
 func setupLogging() io.Writer {
 	// logLevel = new(slog.LevelVar)
-	multiw := io.MultiWriter(&lumberjack.Logger{
+	logFile = &lumberjack.Logger{
 		Filename:   path.Join(DataPath, "watcharr.log"),
 		MaxSize:    1, // megabytes
 		MaxBackups: 3,
 		MaxAge:     28, // days
 		Compress:   false,
-	}, os.Stdout)
+	}
+	multiw := io.MultiWriter(logFile, os.Stdout)
 	slog.SetDefault(slog.New(
 		slog.NewTextHandler(multiw, &slog.HandlerOptions{Level: logLevel}),
 	))
@@ -192,6 +196,19 @@ func setLoggingLevel() {
 	slog.Info("Logging level set", "logging_level", logLevel)
 }
 
+// Set log file rotation settings from config.
+// Must be called before anything else starts logging (the
+// logger doesn't lock these settings).
+func setLogFileConfig() {
+	if Config.LOG_MAX_SIZE > 0 {
+		logFile.MaxSize = Config.LOG_MAX_SIZE
+	}
+	if Config.LOG_MAX_BACKUPS > 0 {
+		logFile.MaxBackups = Config.LOG_MAX_BACKUPS
+	}
+	logFile.Compress = Config.LOG_COMPRESS
+}
+
 // Run UI server
 func runUI() {
 	cmd := exec.Command("node", "ui/index.js")
@@ -79,6 +79,9 @@ func getWatched(db *gorm.DB, userId uint) []Watched {
 	watched := new([]Watched)
 	res := db.Model(&Watched{}).
 		Preload("Content").
+		Preload("Content.WatchProviders").
+		Preload("Content.Collection").
+		Preload("Content.Rating").
 		Preload("Game").
 		Preload("Game.Poster").
 		Preload("Activity").
@@ -147,9 +150,15 @@ func getPublicWatched(db *gorm.DB, userId uint, username string) ([]Watched, err
 }
 
 func addWatched(db *gorm.DB, userId uint, ar WatchedAddRequest, at ActivityType) (Watched, error) {
+	return addWatchedFor("", db, userId, ar, at)
+}
+
+// Like `addWatched`, for task (or import) `task`. Content it caches is
+// requested from tmdb as a task request.
+func addWatchedFor(task string, db *gorm.DB, userId uint, ar WatchedAddRequest, at ActivityType) (Watched, error) {
 	slog.Debug("Adding watched item", "userId", userId, "contentType", ar.ContentType, "contentId", ar.ContentID)
 	// Get content cache (or cache it if we don't have it locally)
-	content, err := getOrCacheContent(db, ar.ContentType, ar.ContentID)
+	content, err := getOrCacheContentFor(task, db, ar.ContentType, ar.ContentID)
 	if err != nil {
 		return Watched{}, err
 	}
@@ -214,6 +223,10 @@ func addWatched(db *gorm.DB, userId uint, ar WatchedAddRequest, at ActivityType)
 	}
 	watched.Activity = append(watched.Activity, activity)
 	watched.Content = &content
+	publishEvent(db, Event{Type: EVENT_WATCHED_ADDED, UserID: userId, WatchedID: watched.ID, ContentID: content.ID})
+	if content.Type == SHOW && watched.Status == WATCHING {
+		queueCalendarRefresh(db, userId)
+	}
 	return watched, nil
 }
 
@@ -249,9 +262,19 @@ func updateWatched(db *gorm.DB, userId uint, id uint, ar WatchedUpdateRequest) (
 	addedActivity := Activity{}
 	if ar.Rating != 0 {
 		addedActivity, _ = addActivity(db, userId, ActivityAddRequest{WatchedID: id, Type: RATING_CHANGED, Data: strconv.Itoa(int(ar.Rating))})
+		e := Event{Type: EVENT_RATING_CHANGED, UserID: userId, WatchedID: id}
+		if upwat.ContentID != nil {
+			e.ContentID = *upwat.ContentID
+		}
+		publishEvent(db, e)
 	}
 	if ar.Status != "" {
 		addedActivity, _ = addActivity(db, userId, ActivityAddRequest{WatchedID: id, Type: STATUS_CHANGED, Data: string(ar.Status)})
+		if ar.Status == WATCHING {
+			queueCalendarRefresh(db, userId)
+		} else {
+			removeFromCalendar(db, userId, id)
+		}
 	}
 	if ar.Thoughts != "" {
 		addedActivity, _ = addActivity(db, userId, ActivityAddRequest{WatchedID: id, Type: THOUGHTS_CHANGED})
@@ -295,6 +318,8 @@ func removeWatched(db *gorm.DB, userId uint, id uint) (WatchedRemoveResponse, er
 		return WatchedRemoveResponse{}, errors.New("no watched entry found")
 	}
 	addedActivity, _ := addActivity(db, userId, ActivityAddRequest{WatchedID: id, Type: REMOVED_WATCHED})
+	publishEvent(db, Event{Type: EVENT_WATCHED_REMOVED, UserID: userId, WatchedID: id})
+	removeFromCalendar(db, userId, id)
 	return WatchedRemoveResponse{NewActivity: addedActivity}, nil
 }
 
@@ -329,7 +354,10 @@ func download(url string, outf string, force bool) (err error) {
 	}
 
 	// Create the file
-	out, err := os.Create(outf)
+	// Written to a temp file first, then moved into place once done, so an
+	// interrupted download never leaves a partial file under the real name.
+	tmpf := outf + imageTempSuffix
+	out, err := os.Create(tmpf)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			slog.Warn("download: Failed to create out file, trying to recover by ensuring directories exist.", "outf", outf)
@@ -339,7 +367,7 @@ func download(url string, outf string, force bool) (err error) {
 				return err
 			}
 			// If dirs made, try making file again
-			out, err = os.Create(outf)
+			out, err = os.Create(tmpf)
 			if err != nil {
 				slog.Error("download: Failed to create out file again in recovery attempt.", "outf", outf, "error", err)
 				return err
@@ -350,12 +378,23 @@ func download(url string, outf string, force bool) (err error) {
 			return err
 		}
 	}
-	defer out.Close()
 
 	// Write the body to file
 	_, err = io.Copy(out, resp.Body)
 	if err != nil {
 		slog.Error("download: Failed to write file to our file.", "outf", outf, "error", err)
+		out.Close()
+		os.Remove(tmpf)
+		return err
+	}
+	if err = out.Close(); err != nil {
+		slog.Error("download: Failed to close our file.", "outf", outf, "error", err)
+		os.Remove(tmpf)
+		return err
+	}
+	if err = os.Rename(tmpf, outf); err != nil {
+		slog.Error("download: Failed to move downloaded file into place.", "outf", outf, "error", err)
+		os.Remove(tmpf)
 		return err
 	}
 
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"gorm.io/gorm"
+)
+
+// A user + content/game pair that has more than one watched entry.
+type WatchedDuplicate struct {
+	UserID uint
+	// Zero if duplicates are for a game.
+	ContentID int
+	// Zero if duplicates are for content.
+	GameID int
+	Count  int
+}
+
+func isMergeDuplicatesEnabled() bool {
+	taskConfigMu.RLock()
+	defer taskConfigMu.RUnlock()
+	return Config.TASK_MERGE_DUPLICATES
+}
+
+// Detect users that have more than one watched entry for the same content or game.
+// Unique indexes should stop this from happening, but bad imports or older
+// databases (where an index couldn't be created) may still have them.
+// Duplicates are only merged if TASK_MERGE_DUPLICATES is enabled.
+func detectDuplicateWatched(db *gorm.DB) error {
+	var dupes []WatchedDuplicate
+	res := db.Raw(`SELECT user_id, content_id, 0 AS game_id, COUNT(*) AS count
+FROM watcheds
+WHERE deleted_at IS NULL AND content_id IS NOT NULL
+GROUP BY user_id, content_id
+HAVING COUNT(*) > 1
+UNION ALL
+SELECT user_id, 0 AS content_id, game_id, COUNT(*) AS count
+FROM watcheds
+WHERE deleted_at IS NULL AND game_id IS NOT NULL
+GROUP BY user_id, game_id
+HAVING COUNT(*) > 1;`).Scan(&dupes)
+	if res.Error != nil {
+		slog.Error("detectDuplicateWatched: Failed to scan for duplicates", "error", res.Error)
+		return errors.New("failed to scan for duplicates")
+	}
+	if len(dupes) == 0 {
+		slog.Debug("detectDuplicateWatched: No duplicates found.")
+		setTaskSummary("detect_duplicates", map[string]any{"found": 0, "merged": 0})
+		return nil
+	}
+	for _, v := range dupes {
+		slog.Warn("detectDuplicateWatched: Found duplicate watched entries", "user_id", v.UserID, "content_id", v.ContentID, "game_id", v.GameID, "count", v.Count)
+	}
+	if !isMergeDuplicatesEnabled() {
+		slog.Info("detectDuplicateWatched: Found duplicates, merging is disabled.")
+		setTaskSummary("detect_duplicates", map[string]any{"found": len(dupes), "merged": 0})
+		return nil
+	}
+	merged := 0
+	var errs []error
+	for _, v := range dupes {
+		if err := mergeDuplicateWatched(db, v); err != nil {
+			slog.Error("detectDuplicateWatched: Failed to merge duplicates", "user_id", v.UserID, "content_id", v.ContentID, "game_id", v.GameID, "error", err)
+			errs = append(errs, err)
+			continue
+		}
+		merged++
+	}
+	setTaskSummary("detect_duplicates", map[string]any{"found": len(dupes), "merged": merged})
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to merge %d of %d duplicates: %w", len(errs), len(dupes), errors.Join(errs...))
+	}
+	return nil
+}
+
+// Merge duplicate watched entries into the most complete one.
+// Missing details are filled from the other entries, their activity,
+// seasons and episodes are moved over (where they don't conflict)
+// and then they are removed.
+func mergeDuplicateWatched(db *gorm.DB, d WatchedDuplicate) error {
+	var entries []Watched
+	q := db.Where("user_id = ?", d.UserID).Preload("WatchedSeasons").Preload("WatchedEpisodes").Order("created_at ASC")
+	if d.ContentID != 0 {
+		q = q.Where("content_id = ?", d.ContentID)
+	} else {
+		q = q.Where("game_id = ?", d.GameID)
+	}
+	if res := q.Find(&entries); res.Error != nil {
+		return res.Error
+	}
+	if len(entries) < 2 {
+		return nil
+	}
+	// Keep most complete entry, oldest wins ties.
+	keep := 0
+	for i := range entries {
+		if watchedCompleteness(entries[i]) > watchedCompleteness(entries[keep]) {
+			keep = i
+		}
+	}
+	k := entries[keep]
+	return db.Transaction(func(tx *gorm.DB) error {
+		for i, v := range entries {
+			if i == keep {
+				continue
+			}
+			if k.Status == "" {
+				k.Status = v.Status
+			}
+			if k.Rating == 0 {
+				k.Rating = v.Rating
+			}
+			if k.Thoughts == "" {
+				k.Thoughts = v.Thoughts
+			}
+			if err := tx.Model(&Activity{}).Where("watched_id = ?", v.ID).Update("watched_id", k.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec(`UPDATE watched_seasons SET watched_id = ?
+WHERE watched_id = ? AND season_number NOT IN (SELECT season_number FROM watched_seasons WHERE watched_id = ?)`, k.ID, v.ID, k.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec(`UPDATE watched_episodes SET watched_id = ?
+WHERE watched_id = ? AND NOT EXISTS (
+	SELECT 1 FROM watched_episodes we
+	WHERE we.watched_id = ? AND we.season_number = watched_episodes.season_number AND we.episode_number = watched_episodes.episode_number
+)`, k.ID, v.ID, k.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("id = ?", v.ID).Delete(&Watched{}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&Watched{}).Where("id = ?", k.ID).
+			Select("status", "rating", "thoughts").
+			Updates(Watched{Status: k.Status, Rating: k.Rating, Thoughts: k.Thoughts}).Error
+	})
+}
+
+// Rough score of how much detail a watched entry has.
+func watchedCompleteness(w Watched) int {
+	score := len(w.WatchedSeasons) + len(w.WatchedEpisodes)
+	if w.Status != "" {
+		score++
+	}
+	if w.Rating != 0 {
+		score++
+	}
+	if w.Thoughts != "" {
+		score++
+	}
+	return score
+}
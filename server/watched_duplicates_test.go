@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// Add two watched entries of `content` for `user`, dropping the unique
+// index first, like an older database where it couldn't be created.
+func addTestDuplicateWatched(t *testing.T, db *gorm.DB, user User, content Content) (Watched, Watched) {
+	t.Helper()
+	if err := db.Migrator().DropIndex(&Watched{}, "usernctnidx"); err != nil {
+		t.Fatalf("failed to drop unique index: %v", err)
+	}
+	older := Watched{UserID: user.ID, ContentID: &content.ID, Status: FINISHED}
+	if err := db.Create(&older).Error; err != nil {
+		t.Fatalf("failed to create watched: %v", err)
+	}
+	if err := db.Create(&WatchedSeason{UserID: user.ID, WatchedID: older.ID, SeasonNumber: 1, Status: FINISHED}).Error; err != nil {
+		t.Fatalf("failed to create watched season: %v", err)
+	}
+	newer := Watched{UserID: user.ID, ContentID: &content.ID, Status: PLANNED, Rating: 9}
+	if err := db.Create(&newer).Error; err != nil {
+		t.Fatalf("failed to create duplicate watched: %v", err)
+	}
+	if err := db.Create(&Activity{UserID: user.ID, WatchedID: newer.ID, Type: RATING_CHANGED, Data: "9"}).Error; err != nil {
+		t.Fatalf("failed to create activity: %v", err)
+	}
+	return older, newer
+}
+
+func TestDetectDuplicateWatchedReportsOnly(t *testing.T) {
+	useTestConfig(t)
+	resetTaskStatus("detect_duplicates")
+	db := newTestDb(t)
+	user := User{Username: "user"}
+	db.Create(&user)
+	content := Content{TmdbID: 501, Title: "Duplicated Show", Type: SHOW}
+	db.Create(&content)
+	addTestDuplicateWatched(t, db, user, content)
+
+	if err := detectDuplicateWatched(db); err != nil {
+		t.Fatalf("detect failed: %v", err)
+	}
+	s := getTaskStatus("detect_duplicates").Summary
+	if s["found"] != 1 || s["merged"] != 0 {
+		t.Errorf("got summary %v, want 1 found and 0 merged", s)
+	}
+	var n int64
+	db.Model(&Watched{}).Where("user_id = ?", user.ID).Count(&n)
+	if n != 2 {
+		t.Errorf("got %d watched entries, want both kept with merging disabled", n)
+	}
+}
+
+func TestDetectDuplicateWatchedMerges(t *testing.T) {
+	useTestConfig(t)
+	Config.TASK_MERGE_DUPLICATES = true
+	resetTaskStatus("detect_duplicates")
+	db := newTestDb(t)
+	user := User{Username: "user"}
+	db.Create(&user)
+	content := Content{TmdbID: 502, Title: "Duplicated Show", Type: SHOW}
+	db.Create(&content)
+	older, newer := addTestDuplicateWatched(t, db, user, content)
+
+	if err := detectDuplicateWatched(db); err != nil {
+		t.Fatalf("detect failed: %v", err)
+	}
+	s := getTaskStatus("detect_duplicates").Summary
+	if s["found"] != 1 || s["merged"] != 1 {
+		t.Errorf("got summary %v, want 1 found and 1 merged", s)
+	}
+	var entries []Watched
+	db.Where("user_id = ?", user.ID).Preload("WatchedSeasons").Find(&entries)
+	if len(entries) != 1 {
+		t.Fatalf("got %d watched entries after merging, want 1", len(entries))
+	}
+	// Equally complete, so the older one is kept and
+	// its missing rating filled in from the newer one.
+	w := entries[0]
+	if w.ID != older.ID || w.Status != FINISHED || w.Rating != 9 || len(w.WatchedSeasons) != 1 {
+		t.Errorf("got kept entry %d with status %s, rating %v and %d seasons, want %d finished with rating 9 and 1 season",
+			w.ID, w.Status, w.Rating, len(w.WatchedSeasons), older.ID)
+	}
+	var moved int64
+	db.Model(&Activity{}).Where("watched_id = ?", newer.ID).Count(&moved)
+	if moved != 0 {
+		t.Errorf("%d activities left on the removed entry", moved)
+	}
+
+	if err := detectDuplicateWatched(db); err != nil {
+		t.Fatalf("second detect failed: %v", err)
+	}
+	if s := getTaskStatus("detect_duplicates").Summary; s["found"] != 0 {
+		t.Errorf("got summary %v after merging, want none found", s)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+
+	"gorm.io/gorm"
+)
+
+// Condition matching rows of `table` whose watched entry doesn't exist
+// at all, or isn't a show. Entries that are only soft deleted still count
+// as a parent, re-adding the show restores the entry, so its progress
+// must be kept for it.
+func orphanedProgressWhere(table string) string {
+	return `NOT EXISTS (
+	SELECT 1 FROM watcheds w
+	JOIN contents c ON c.id = w.content_id
+	WHERE w.id = ` + table + `.watched_id AND c.type = 'tv'
+)`
+}
+
+// Remove season and episode progress that has no show on a watched list
+// to belong to, eg. left behind when its entry was removed outside of the
+// api. These can't be seen or removed by their user, but would be wrongly
+// picked up by a new entry that reuses the watched id.
+func cleanupOrphanedEpisodes(db *gorm.DB) error {
+	var seasons, episodes int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Unscoped().Where(orphanedProgressWhere("watched_episodes")).Delete(&WatchedEpisode{})
+		if res.Error != nil {
+			return res.Error
+		}
+		episodes = res.RowsAffected
+		res = tx.Unscoped().Where(orphanedProgressWhere("watched_seasons")).Delete(&WatchedSeason{})
+		if res.Error != nil {
+			return res.Error
+		}
+		seasons = res.RowsAffected
+		return nil
+	})
+	if err != nil {
+		slog.Error("cleanupOrphanedEpisodes: Failed to remove orphaned progress", "error", err)
+		return errors.New("failed to remove orphaned progress")
+	}
+	if seasons > 0 || episodes > 0 {
+		slog.Info("cleanupOrphanedEpisodes: Removed orphaned progress.", "seasons", seasons, "episodes", episodes)
+	}
+	setTaskSummary("cleanup_orphaned_episodes", map[string]any{"removedSeasons": seasons, "removedEpisodes": episodes})
+	return nil
+}
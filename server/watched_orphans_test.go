@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+func TestCleanupOrphanedEpisodes(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	user := User{Username: "orphans"}
+	db.Create(&user)
+	progress := func(w Watched, season int, episodes ...int) {
+		db.Create(&WatchedSeason{UserID: user.ID, WatchedID: w.ID, SeasonNumber: season, Status: WATCHING})
+		for _, e := range episodes {
+			db.Create(&WatchedEpisode{UserID: user.ID, WatchedID: w.ID, SeasonNumber: season, EpisodeNumber: e, Status: FINISHED})
+		}
+	}
+	tracked := addTestShowWatched(t, db, user, 1201, WATCHING)
+	progress(tracked, 1, 1, 2)
+	// Kept for when the show is re-added.
+	removed := addTestShowWatched(t, db, user, 1202, FINISHED)
+	progress(removed, 1, 1)
+	db.Delete(&removed)
+	// Gone for good.
+	gone := addTestShowWatched(t, db, user, 1203, FINISHED)
+	progress(gone, 2, 1, 2)
+	db.Unscoped().Delete(&gone)
+	// Movies have no seasons.
+	movie := Content{TmdbID: 1204, Title: "Movie", Type: MOVIE}
+	db.Create(&movie)
+	mw := Watched{UserID: user.ID, ContentID: &movie.ID, Status: FINISHED}
+	db.Create(&mw)
+	progress(mw, 1)
+
+	if err := cleanupOrphanedEpisodes(db); err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+	s := getTaskStatus("cleanup_orphaned_episodes").Summary
+	if s["removedSeasons"] != int64(2) || s["removedEpisodes"] != int64(2) {
+		t.Errorf("got summary %v, want 2 seasons and 2 episodes removed", s)
+	}
+	for _, c := range []struct {
+		w                 Watched
+		seasons, episodes int64
+	}{
+		{tracked, 1, 2},
+		{removed, 1, 1},
+		{gone, 0, 0},
+		{mw, 0, 0},
+	} {
+		var seasons, episodes int64
+		db.Unscoped().Model(&WatchedSeason{}).Where("watched_id = ?", c.w.ID).Count(&seasons)
+		db.Unscoped().Model(&WatchedEpisode{}).Where("watched_id = ?", c.w.ID).Count(&episodes)
+		if seasons != c.seasons || episodes != c.episodes {
+			t.Errorf("watched %d has %d seasons and %d episodes, want %d and %d", c.w.ID, seasons, episodes, c.seasons, c.episodes)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"gorm.io/gorm"
+)
+
+// Default days without activity before a watching entry is stale.
+const staleWatchingDefaultDays = 180
+
+// Watching entry that has had no activity for too long.
+type StaleWatched struct {
+	ID     uint
+	UserID uint
+	Title  string
+}
+
+func isStaleWatchingRemindersEnabled() bool {
+	taskConfigMu.RLock()
+	defer taskConfigMu.RUnlock()
+	return Config.TASK_STALE_WATCHING_REMINDERS
+}
+
+func getStaleWatchingDays() int {
+	if Config.TASK_STALE_WATCHING_DAYS > 0 {
+		return Config.TASK_STALE_WATCHING_DAYS
+	}
+	return staleWatchingDefaultDays
+}
+
+// Find watched entries still in WATCHING status that have had
+// no activity (or updates) for TASK_STALE_WATCHING_DAYS and
+// notify their owner once. A reminder is only sent again if
+// there has been activity on the entry since the last one.
+func remindStaleWatching(db *gorm.DB) error {
+	days := getStaleWatchingDays()
+	cutoff := taskClock.Now().AddDate(0, 0, -days)
+	var stale []StaleWatched
+	res := db.Raw(`WITH last AS (
+	SELECT w.id, w.user_id, w.content_id, w.game_id,
+		MAX(w.updated_at, COALESCE((SELECT MAX(a.created_at) FROM activities a WHERE a.watched_id = w.id AND a.deleted_at IS NULL), w.updated_at)) AS last_activity
+	FROM watcheds w
+	WHERE w.deleted_at IS NULL AND w.status = ?
+)
+SELECT last.id, last.user_id, COALESCE(c.title, g.name, '') AS title
+FROM last
+LEFT JOIN contents c ON c.id = last.content_id
+LEFT JOIN games g ON g.id = last.game_id
+WHERE last.last_activity < ?
+AND NOT EXISTS (
+	SELECT 1 FROM notifications n
+	WHERE n.watched_id = last.id AND n.type = ? AND n.created_at >= last.last_activity
+);`, WATCHING, cutoff, NOTIFICATION_STALE_WATCHING).Scan(&stale)
+	if res.Error != nil {
+		slog.Error("remindStaleWatching: Failed to find stale watching entries", "error", res.Error)
+		return errors.New("failed to find stale watching entries")
+	}
+	sent := 0
+	var errs []error
+	for _, v := range stale {
+		id := v.ID
+		title := v.Title
+		if title == "" {
+			title = "something"
+		}
+		n := Notification{
+			UserID:    v.UserID,
+			WatchedID: &id,
+			Type:      NOTIFICATION_STALE_WATCHING,
+			Message:   fmt.Sprintf("You haven't watched %s in over %d days. Still watching?", title, days),
+		}
+		if err := db.Create(&n).Error; err != nil {
+			slog.Error("remindStaleWatching: Failed to create reminder", "watched_id", v.ID, "error", err)
+			errs = append(errs, err)
+			continue
+		}
+		sent++
+	}
+	setTaskSummary("stale_watching_reminders", map[string]any{"found": len(stale), "sent": sent})
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to send %d of %d reminders: %w", len(errs), len(stale), errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Add a watched entry of new content `tmdbId`, last updated `ago`.
+func addTestWatchedUpdated(t *testing.T, db *gorm.DB, userId uint, tmdbId int, status WatchedStatus, ago time.Duration) Watched {
+	t.Helper()
+	c := Content{TmdbID: tmdbId, Title: "Show " + strconv.Itoa(tmdbId), Type: SHOW}
+	if err := db.Create(&c).Error; err != nil {
+		t.Fatalf("failed to create content: %v", err)
+	}
+	at := time.Now().Add(-ago)
+	w := Watched{UserID: userId, ContentID: &c.ID, Status: status, GormModel: GormModel{CreatedAt: at, UpdatedAt: at}}
+	if err := db.Create(&w).Error; err != nil {
+		t.Fatalf("failed to create watched: %v", err)
+	}
+	return w
+}
+
+// Get the watched ids of stale watching reminders sent.
+func getTestStaleReminders(t *testing.T, db *gorm.DB) map[uint]int {
+	t.Helper()
+	var ns []Notification
+	if err := db.Where("type = ?", NOTIFICATION_STALE_WATCHING).Find(&ns).Error; err != nil {
+		t.Fatalf("failed to get reminders: %v", err)
+	}
+	sent := map[uint]int{}
+	for _, v := range ns {
+		sent[*v.WatchedID]++
+	}
+	return sent
+}
+
+func TestRemindStaleWatching(t *testing.T) {
+	useTestConfig(t)
+	resetTaskStatus("stale_watching_reminders")
+	db := newTestDb(t)
+	user := User{Username: "user"}
+	db.Create(&user)
+	day := 24 * time.Hour
+	stale := addTestWatchedUpdated(t, db, user.ID, 1, WATCHING, 200*day)
+	active := addTestWatchedUpdated(t, db, user.ID, 2, WATCHING, 200*day)
+	db.Create(&Activity{UserID: user.ID, WatchedID: active.ID, Type: SEASON_STATUS_CHANGED, GormModel: GormModel{CreatedAt: time.Now().Add(-10 * day)}})
+	recent := addTestWatchedUpdated(t, db, user.ID, 3, WATCHING, 10*day)
+	addTestWatchedUpdated(t, db, user.ID, 4, FINISHED, 200*day)
+
+	if err := remindStaleWatching(db); err != nil {
+		t.Fatalf("remind failed: %v", err)
+	}
+	if sent := getTestStaleReminders(t, db); len(sent) != 1 || sent[stale.ID] != 1 {
+		t.Fatalf("got reminders %v, want one for entry %d", sent, stale.ID)
+	}
+	if s := getTaskStatus("stale_watching_reminders").Summary; s["found"] != 1 || s["sent"] != 1 {
+		t.Errorf("got summary %v, want 1 found and sent", s)
+	}
+
+	// Already reminded.
+	if err := remindStaleWatching(db); err != nil {
+		t.Fatalf("second remind failed: %v", err)
+	}
+	if sent := getTestStaleReminders(t, db); sent[stale.ID] != 1 {
+		t.Errorf("got %d reminders for entry %d, want it reminded once", sent[stale.ID], stale.ID)
+	}
+
+	Config.TASK_STALE_WATCHING_DAYS = 5
+	if err := remindStaleWatching(db); err != nil {
+		t.Fatalf("remind with a shorter threshold failed: %v", err)
+	}
+	sent := getTestStaleReminders(t, db)
+	if len(sent) != 3 || sent[stale.ID] != 1 || sent[active.ID] != 1 || sent[recent.ID] != 1 {
+		t.Errorf("got reminders %v with a 5 day threshold, want one each for all watching entries", sent)
+	}
+}
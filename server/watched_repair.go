@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"gorm.io/gorm"
+)
+
+// A watched entry (or one of its seasons) whose status contradicts its progress.
+type ProgressRepair struct {
+	// Watched season id, 0 when repairing the show itself.
+	ID           uint
+	UserID       uint
+	WatchedID    uint
+	SeasonNumber int
+	Status       WatchedStatus
+}
+
+// Repair rules, each finds entries in a state the show automations
+// (see `hookEpisodeStatusChanged`) would never leave them in, and sets
+// the status they would have set. Only users with AutomateShowStatuses
+// enabled are repaired, others may have set these statuses on purpose.
+var progressRepairRules = []struct {
+	name string
+	// Query finding entries to repair, must select `ProgressRepair` fields.
+	query string
+	// Status the entry is set to.
+	status WatchedStatus
+	// If the rule repairs seasons, rather than shows.
+	seasons bool
+	reason  string
+}{
+	{
+		// Hook step 2.
+		name: "seasonsStarted",
+		query: `SELECT ws.id, ws.user_id, ws.watched_id, ws.season_number, ws.status
+FROM watched_seasons ws
+JOIN watcheds w ON w.id = ws.watched_id AND w.deleted_at IS NULL
+JOIN users u ON u.id = ws.user_id
+WHERE ws.deleted_at IS NULL AND COALESCE(ws.status, '') IN ('', 'PLANNED') AND COALESCE(u.automate_show_statuses, 1) = 1
+AND EXISTS (
+	SELECT 1 FROM watched_episodes we
+	WHERE we.watched_id = ws.watched_id AND we.season_number = ws.season_number
+	AND we.deleted_at IS NULL AND we.status IN ('WATCHING', 'FINISHED')
+);`,
+		status:  WATCHING,
+		seasons: true,
+		reason:  "Season had episodes watched while it had a status of %s.",
+	},
+	{
+		// Hook step 3.
+		name: "showsStarted",
+		query: `SELECT 0 AS id, w.user_id, w.id AS watched_id, 0 AS season_number, w.status
+FROM watcheds w
+JOIN contents c ON c.id = w.content_id AND c.type = 'tv'
+JOIN users u ON u.id = w.user_id
+WHERE w.deleted_at IS NULL AND COALESCE(w.status, '') IN ('', 'PLANNED') AND COALESCE(u.automate_show_statuses, 1) = 1
+AND EXISTS (
+	SELECT 1 FROM watched_episodes we
+	WHERE we.watched_id = w.id AND we.deleted_at IS NULL AND we.status IN ('WATCHING', 'FINISHED')
+);`,
+		status: WATCHING,
+		reason: "Show had episodes watched while it had a status of %s.",
+	},
+	{
+		// A finished show has no season still being watched.
+		name: "seasonsFinished",
+		query: `SELECT ws.id, ws.user_id, ws.watched_id, ws.season_number, ws.status
+FROM watched_seasons ws
+JOIN watcheds w ON w.id = ws.watched_id AND w.deleted_at IS NULL
+JOIN users u ON u.id = ws.user_id
+WHERE ws.deleted_at IS NULL AND ws.status = 'WATCHING' AND w.status = 'FINISHED' AND COALESCE(u.automate_show_statuses, 1) = 1;`,
+		status:  FINISHED,
+		seasons: true,
+		reason:  "Show is finished while the season had a status of %s.",
+	},
+}
+
+// Find and repair watched entries whose status contradicts their
+// progress, eg. a finished show with a season still being watched.
+// Rules are ran in order, each repair is logged and added as
+// automated activity on the entry, so users can see what changed.
+func repairProgress(db *gorm.DB) error {
+	summary := map[string]any{}
+	var errs []error
+	for _, rule := range progressRepairRules {
+		var found []ProgressRepair
+		if res := db.Raw(rule.query).Scan(&found); res.Error != nil {
+			slog.Error("repairProgress: Failed to find entries to repair", "rule", rule.name, "error", res.Error)
+			errs = append(errs, fmt.Errorf("%s: failed to find entries to repair", rule.name))
+			continue
+		}
+		repaired := 0
+		for _, r := range found {
+			old := r.Status
+			if old == "" {
+				old = "none"
+			}
+			reason := fmt.Sprintf(rule.reason, old)
+			var (
+				res   *gorm.DB
+				aType ActivityType
+				data  map[string]any
+			)
+			if rule.seasons {
+				res = db.Model(&WatchedSeason{}).Where("id = ?", r.ID).Update("status", rule.status)
+				aType = SEASON_STATUS_CHANGED_AUTO
+				data = map[string]any{"season": r.SeasonNumber, "status": rule.status, "reason": reason}
+			} else {
+				res = db.Model(&Watched{}).Where("id = ?", r.WatchedID).Update("status", rule.status)
+				aType = STATUS_CHANGED_AUTO
+				data = map[string]any{"status": rule.status, "reason": reason}
+			}
+			if res.Error != nil {
+				slog.Error("repairProgress: Failed to repair entry", "rule", rule.name, "watched_id", r.WatchedID, "season", r.SeasonNumber, "error", res.Error)
+				errs = append(errs, res.Error)
+				continue
+			}
+			slog.Info("repairProgress: Repaired entry.", "rule", rule.name, "user_id", r.UserID, "watched_id", r.WatchedID, "season", r.SeasonNumber, "old_status", old, "new_status", rule.status)
+			j, _ := json.Marshal(data)
+			addActivity(db, r.UserID, ActivityAddRequest{WatchedID: r.WatchedID, Type: aType, Data: string(j)})
+			repaired++
+		}
+		summary[rule.name] = repaired
+	}
+	setTaskSummary("repair_progress", summary)
+	if len(errs) > 0 {
+		return fmt.Errorf("failed %d repairs: %w", len(errs), errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// Add show `tmdbId` to the watched list of `user` with `status`.
+func addTestShowWatched(t *testing.T, db *gorm.DB, user User, tmdbId int, status WatchedStatus) Watched {
+	t.Helper()
+	c := Content{TmdbID: tmdbId, Title: "Show", Type: SHOW}
+	if err := db.Create(&c).Error; err != nil {
+		t.Fatalf("failed to create content: %v", err)
+	}
+	w := Watched{UserID: user.ID, ContentID: &c.ID, Status: status}
+	if err := db.Create(&w).Error; err != nil {
+		t.Fatalf("failed to create watched: %v", err)
+	}
+	return w
+}
+
+func TestRepairProgress(t *testing.T) {
+	useTestConfig(t)
+	db := newTestDb(t)
+	user := User{Username: "auto"}
+	db.Create(&user)
+	manualSetting := false
+	manual := User{Username: "manual", UserSettings: UserSettings{AutomateShowStatuses: &manualSetting}}
+	db.Create(&manual)
+
+	// Planned, with an episode watched.
+	started := addTestShowWatched(t, db, user, 801, PLANNED)
+	startedSeason := WatchedSeason{UserID: user.ID, WatchedID: started.ID, SeasonNumber: 1, Status: PLANNED}
+	db.Create(&startedSeason)
+	db.Create(&WatchedEpisode{UserID: user.ID, WatchedID: started.ID, SeasonNumber: 1, EpisodeNumber: 1, Status: WATCHING})
+	// Finished, with a season still being watched.
+	finished := addTestShowWatched(t, db, user, 802, FINISHED)
+	finishedSeason := WatchedSeason{UserID: user.ID, WatchedID: finished.ID, SeasonNumber: 2, Status: WATCHING}
+	db.Create(&finishedSeason)
+	// Consistent already.
+	planned := addTestShowWatched(t, db, user, 803, PLANNED)
+	plannedSeason := WatchedSeason{UserID: user.ID, WatchedID: planned.ID, SeasonNumber: 1, Status: PLANNED}
+	db.Create(&plannedSeason)
+	db.Create(&WatchedEpisode{UserID: user.ID, WatchedID: planned.ID, SeasonNumber: 1, EpisodeNumber: 1, Status: PLANNED})
+	watching := addTestShowWatched(t, db, user, 804, WATCHING)
+	watchingSeason := WatchedSeason{UserID: user.ID, WatchedID: watching.ID, SeasonNumber: 1, Status: WATCHING}
+	db.Create(&watchingSeason)
+	// Inconsistent, but the user doesn't automate statuses.
+	manualShow := addTestShowWatched(t, db, manual, 805, PLANNED)
+	db.Create(&WatchedEpisode{UserID: manual.ID, WatchedID: manualShow.ID, SeasonNumber: 1, EpisodeNumber: 1, Status: FINISHED})
+
+	if err := repairProgress(db); err != nil {
+		t.Fatalf("repair failed: %v", err)
+	}
+	want := map[string]any{"seasonsStarted": 1, "showsStarted": 1, "seasonsFinished": 1}
+	if s := getTaskStatus("repair_progress").Summary; !reflect.DeepEqual(s, want) {
+		t.Errorf("got summary %v, want %v", s, want)
+	}
+	for _, c := range []struct {
+		w    Watched
+		want WatchedStatus
+	}{
+		{started, WATCHING},
+		{finished, FINISHED},
+		{planned, PLANNED},
+		{watching, WATCHING},
+		{manualShow, PLANNED},
+	} {
+		var got Watched
+		db.Take(&got, c.w.ID)
+		if got.Status != c.want {
+			t.Errorf("show %d is %s, want %s", c.w.ID, got.Status, c.want)
+		}
+	}
+	for _, c := range []struct {
+		s    WatchedSeason
+		want WatchedStatus
+	}{
+		{startedSeason, WATCHING},
+		{finishedSeason, FINISHED},
+		{plannedSeason, PLANNED},
+		{watchingSeason, WATCHING},
+	} {
+		var got WatchedSeason
+		db.Take(&got, c.s.ID)
+		if got.Status != c.want {
+			t.Errorf("season %d of show %d is %s, want %s", c.s.SeasonNumber, c.s.WatchedID, got.Status, c.want)
+		}
+	}
+	var n int64
+	db.Model(&Activity{}).Where("watched_id = ? AND type = ?", started.ID, STATUS_CHANGED_AUTO).Count(&n)
+	if n != 1 {
+		t.Errorf("got %d automated status activity for the repaired show, want 1", n)
+	}
+
+	// Nothing left to repair.
+	if err := repairProgress(db); err != nil {
+		t.Fatalf("second repair failed: %v", err)
+	}
+	want = map[string]any{"seasonsStarted": 0, "showsStarted": 0, "seasonsFinished": 0}
+	if s := getTaskStatus("repair_progress").Summary; !reflect.DeepEqual(s, want) {
+		t.Errorf("got summary %v after repairing, want %v", s, want)
+	}
+}
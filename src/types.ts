@@ -83,10 +83,69 @@ export interface Content {
   tmdbId: number;
   title: string;
   poster_path: string;
+  backdrop_path: string;
   overview: string;
   type: ContentType;
   release_date: string;
   first_air_date: string;
+  watchProviders?: ContentWatchProviders;
+  collection?: ContentCollection;
+  rating?: ContentRating;
+}
+
+export interface ContentWatchProviders {
+  region: string;
+  providers: TMDBWatchProvider[];
+  link?: string;
+  updatedAt: string;
+}
+
+export interface ContentCollection {
+  collectionId: number;
+  updatedAt: string;
+}
+
+export interface ContentRating {
+  average: number;
+  count: number;
+  updatedAt: string;
+}
+
+export interface CalendarEpisode {
+  content?: Content;
+  seasonNumber: number;
+  episodeNumber: number;
+  name: string;
+  airDate: string;
+  createdAt: string;
+}
+
+export interface Collection {
+  id: number;
+  name: string;
+  posterPath: string;
+  parts: CollectionPart[];
+  updatedAt: string;
+}
+
+export interface CollectionPart {
+  tmdbId: number;
+  title: string;
+  posterPath: string;
+  releaseDate: string;
+}
+
+export interface UserRecommendation {
+  content?: Content;
+  rank: number;
+  score: number;
+  createdAt: string;
+}
+
+export interface CollectionProgress {
+  collection: Collection;
+  tracked: number[];
+  finished: number[];
 }
 
 export interface Activity extends dbModel {
@@ -1025,7 +1084,14 @@ export interface RadarrTestResponse {
   rootFolders: RootFolder[];
 }
 
-export type ArrRequestStatus = "PENDING" | "APPROVED" | "AUTO_APPROVED" | "DENIED" | "FOUND";
+export type ArrRequestStatus =
+  | "PENDING"
+  | "APPROVED"
+  | "AUTO_APPROVED"
+  | "DENIED"
+  | "FOUND"
+  | "AVAILABLE"
+  | "REMOVED";
 
 export interface ArrRequestResponse {
   id: number;
@@ -1035,6 +1101,7 @@ export interface ArrRequestResponse {
   arrId: number;
   content: Content;
   status: ArrRequestStatus;
+  found: boolean;
   requestJson: string;
   username: string;
 }
@@ -1243,13 +1310,73 @@ export interface GetJobResponse {
 }
 
 export interface TaskRescheduleRequest {
+  /**
+   * 0 disables the task, more than 0 reschedules (and enables) it.
+   */
   seconds: number;
 }
 
 export interface AllTasksResponse {
+  id: string;
   name: string;
   nextRun: Date;
   seconds: number;
+  disabled?: boolean;
+  autoDisabled?: TaskAutoDisabled;
+  hidden?: boolean;
+  health: number;
+  minSeconds: number;
+}
+
+export interface TaskIntervalConstraint {
+  name: string;
+  seconds: number;
+  reason: string;
+}
+
+export interface TaskSummary {
+  summary: { [key: string]: any };
+  at: Date;
+}
+
+export interface TaskAuditEntry {
+  id: number;
+  createdAt: Date;
+  userId: number;
+  username: string;
+  // Empty for SETTINGS, they aren't for one task.
+  taskId: string;
+  action:
+    | "RESCHEDULE"
+    | "DISABLE"
+    | "ENABLE"
+    | "RUN_ONCE"
+    | "SEED"
+    | "BOOST"
+    | "UNBOOST"
+    | "UNLOCK"
+    | "CANCEL"
+    | "RESET"
+    | "REMOVE"
+    | "RESTORE"
+    | "SETTINGS";
+  oldSeconds?: number;
+  newSeconds?: number;
+  runAt?: Date;
+}
+
+export interface TaskAutoDisabled {
+  at: Date;
+  failures: number;
+  reason: string;
+}
+
+export interface TaskFlagState {
+  name: string;
+  enabled: boolean;
+  default: boolean;
+  set: boolean;
+  registered: boolean;
 }
 
 export interface Tag extends dbModel {